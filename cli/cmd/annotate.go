@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// AnnotateCmd attaches curators' notes to patches and facts
+var AnnotateCmd = &cobra.Command{
+	Use:   "annotate <patch-id>",
+	Short: "Attach editorial notes to a patch or one of its facts",
+	Long: `Attach a curator's note to a patch stored under --data, or with --fact to
+one of its facts, so editorial context ("sponsored segment", "speaker
+later retracted this") travels with the knowledge it is about. Notes are
+kept in patch/annotations and claim/annotations with who wrote them
+(--by, default the current user) and when; the visualization shows them
+beside the patch and fact, and they are exported with them. Every copy
+of the patch under --data is updated.
+
+With --backend, the note is also sent to the backend's
+/api/patches/<id>/annotations. Backends without that endpoint, or that
+don't have the patch, receive the notes with the patch itself when it is
+imported (vkm bundle import); the local copy is always saved first.
+
+Patch and fact IDs may be shortened to a unique prefix of at least 8
+characters. --list prints the notes of a patch and its facts.
+
+Examples:
+  vkm annotate 5d1e8a7c --note "Interview recorded before the 2024 results"
+  vkm annotate 5d1e8a7c --fact 3f2a9c1e --note "Speaker retracted this in a later episode"
+  vkm annotate 5d1e8a7c --list`,
+	Args: cobra.ExactArgs(1),
+	RunE: runAnnotate,
+}
+
+var (
+	annotateDataDir string
+	annotateNote    string
+	annotateFact    string
+	annotateBy      string
+	annotateList    bool
+	annotateBackend string
+)
+
+func init() {
+	AnnotateCmd.Flags().StringVar(&annotateDataDir, "data", "data", "Directory holding local patches")
+	AnnotateCmd.Flags().StringVar(&annotateNote, "note", "", "Note to attach")
+	AnnotateCmd.Flags().StringVar(&annotateFact, "fact", "", "Annotate this fact of the patch instead of the patch")
+	AnnotateCmd.Flags().StringVar(&annotateBy, "by", "", "Who writes the note (default the current user)")
+	AnnotateCmd.Flags().BoolVar(&annotateList, "list", false, "Print the patch's notes instead of adding one")
+	AnnotateCmd.Flags().StringVarP(&annotateBackend, "backend", "b", "", "Backend API URL to send the note to as well")
+}
+
+// Annotation is a curator's note on a patch or fact
+type Annotation struct {
+	Note string    `json:"annotation/note"`
+	By   string    `json:"annotation/by"`
+	At   time.Time `json:"annotation/at"`
+}
+
+// describe prints an annotation on one line, e.g.
+// "2025-03-01 10:15 alice: Speaker retracted this"
+func (a Annotation) describe() string {
+	return fmt.Sprintf("%s %s: %s", a.At.Local().Format("2006-01-02 15:04"), a.By, a.Note)
+}
+
+func runAnnotate(cmd *cobra.Command, args []string) error {
+	note := strings.TrimSpace(annotateNote)
+	if !annotateList && note == "" {
+		return fmt.Errorf("--note is required (or --list to print notes)")
+	}
+
+	review, err := loadFactReview(annotateDataDir)
+	if err != nil {
+		return err
+	}
+	file, err := review.resolvePatch(args[0])
+	if err != nil {
+		return err
+	}
+	patch := file.Patch
+
+	var fact *Fact
+	if annotateFact != "" {
+		if fact, err = resolvePatchFact(patch, annotateFact); err != nil {
+			return err
+		}
+	}
+
+	if annotateList {
+		writeAnnotations(os.Stdout, patch, fact)
+		return nil
+	}
+
+	by := strings.TrimSpace(annotateBy)
+	if by == "" {
+		if u, err := user.Current(); err == nil {
+			by = u.Username
+		}
+	}
+	a := Annotation{Note: note, By: orDefault(by, "unknown"), At: time.Now().UTC()}
+
+	patchID := patch.ID
+	for i := range review.files {
+		p := review.files[i].Patch
+		if p.ID != patchID {
+			continue
+		}
+		if fact == nil {
+			p.Annotations = append(p.Annotations, a)
+		} else {
+			for j := range p.Facts {
+				if p.Facts[j].ID == fact.ID {
+					p.Facts[j].Annotations = append(p.Facts[j].Annotations, a)
+				}
+			}
+		}
+		review.changed[i] = true
+	}
+	if err := review.save(); err != nil {
+		return err
+	}
+	if fact == nil {
+		fmt.Printf("✓ Annotated patch %s: %s\n", patchID, a.describe())
+	} else {
+		fmt.Printf("✓ Annotated fact %s of patch %s: %s\n", fact.ID, patchID, a.describe())
+	}
+
+	if annotateBackend == "" {
+		return nil
+	}
+	factID := ""
+	if fact != nil {
+		factID = fact.ID
+	}
+	supported, err := sendAnnotation(cmd.Context(), annotateBackend, patchID, factID, a)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Warning: failed to send the note to the backend: %v (it is saved locally)\n", err)
+	case !supported:
+		fmt.Printf("  Backend at %s doesn't accept annotations for this patch; the note is kept locally and sent with the patch when it is imported\n", annotateBackend)
+	default:
+		fmt.Printf("  ✓ Sent to %s\n", annotateBackend)
+	}
+	return nil
+}
+
+// resolvePatch finds the patch id names, exactly or as a unique prefix,
+// and returns its first copy
+func (r *factReview) resolvePatch(id string) (*localPatchFile, error) {
+	var found *localPatchFile
+	for i := range r.files {
+		p := r.files[i].Patch
+		if p.ID == id {
+			return &r.files[i], nil
+		}
+		if len(id) >= 8 && strings.HasPrefix(p.ID, id) {
+			if found == nil {
+				found = &r.files[i]
+			} else if found.Patch.ID != p.ID {
+				return nil, fmt.Errorf("patch ID prefix %q is ambiguous (%s, %s)", id, found.Patch.ID, p.ID)
+			}
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no patch %q under %s", id, r.dir)
+	}
+	return found, nil
+}
+
+// resolvePatchFact finds the fact of p that id names, exactly or as a
+// unique prefix
+func resolvePatchFact(p *Patch, id string) (*Fact, error) {
+	var found *Fact
+	for i := range p.Facts {
+		f := &p.Facts[i]
+		if f.ID == id {
+			return f, nil
+		}
+		if len(id) >= 8 && strings.HasPrefix(f.ID, id) {
+			if found != nil {
+				return nil, fmt.Errorf("fact ID prefix %q is ambiguous (%s, %s)", id, found.ID, f.ID)
+			}
+			found = f
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("patch %s has no fact %q", p.ID, id)
+	}
+	return found, nil
+}
+
+// writeAnnotations prints the notes of a patch and its facts, or of one
+// fact
+func writeAnnotations(w io.Writer, p *Patch, only *Fact) {
+	count := 0
+	if only == nil {
+		fmt.Fprintf(w, "Patch %s (%s)\n", p.ID, patchSource(p))
+		for _, a := range p.Annotations {
+			fmt.Fprintf(w, "  %s\n", a.describe())
+			count++
+		}
+	}
+	for i := range p.Facts {
+		f := &p.Facts[i]
+		if (only != nil && f.ID != only.ID) || (only == nil && len(f.Annotations) == 0) {
+			continue
+		}
+		fmt.Fprintf(w, "Fact %s: %q\n", f.ID, f.Text)
+		for _, a := range f.Annotations {
+			fmt.Fprintf(w, "  %s\n", a.describe())
+			count++
+		}
+	}
+	if count == 0 {
+		fmt.Fprintln(w, "No notes")
+	}
+}
+
+// sendAnnotation posts a note to the backend's annotations endpoint. A
+// backend without one (or without the patch) answers 404, 405 or 501,
+// reported as unsupported rather than as an error.
+func sendAnnotation(ctx context.Context, backendURL, patchID, factID string, a Annotation) (bool, error) {
+	payload := map[string]interface{}{
+		"annotation/note": a.Note,
+		"annotation/by":   a.By,
+		"annotation/at":   a.At,
+	}
+	if factID != "" {
+		payload["fact-id"] = factID
+	}
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal annotation: %w", err)
+	}
+
+	endpoint := strings.TrimSuffix(backendURL, "/") + "/api/patches/" + url.PathEscape(patchID) + "/annotations"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return false, nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return true, fmt.Errorf("backend error (status %d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
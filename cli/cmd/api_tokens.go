@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// API token roles, from least to most privileged
+const (
+	RoleRead   = "read"
+	RoleSubmit = "submit"
+	RoleAdmin  = "admin"
+)
+
+// apiToken is one entry of the tokens file
+type apiToken struct {
+	Name string
+	Role string
+}
+
+// apiTokenStore maps SHA-256 token hashes to their entries. Only hashes are
+// kept in memory; the file itself holds "<role> <token> [name]" lines.
+type apiTokenStore struct {
+	byHash map[string]apiToken
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func validRole(role string) bool {
+	return role == RoleRead || role == RoleSubmit || role == RoleAdmin
+}
+
+// loadAPITokens reads a tokens file. Blank lines and # comments are ignored.
+func loadAPITokens(path string) (*apiTokenStore, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tokens file: %w", err)
+	}
+	defer file.Close()
+
+	store := &apiTokenStore{byHash: make(map[string]apiToken)}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 2 || !validRole(fields[0]) {
+			return nil, fmt.Errorf("%s:%d: expected \"<read|submit|admin> <token> [name]\"", path, line)
+		}
+		name := fmt.Sprintf("token-%d", line)
+		if len(fields) > 2 {
+			name = fields[2]
+		}
+		store.byHash[hashToken(fields[1])] = apiToken{Name: name, Role: fields[0]}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tokens file: %w", err)
+	}
+
+	if len(store.byHash) == 0 {
+		return nil, fmt.Errorf("no tokens defined in %s", path)
+	}
+	return store, nil
+}
+
+// Lookup returns the entry for a bearer token
+func (s *apiTokenStore) Lookup(token string) (apiToken, bool) {
+	t, ok := s.byHash[hashToken(token)]
+	return t, ok
+}
+
+// roleAllows reports whether a role may perform an action requiring need.
+// Admin may do anything; read and submit are separate, so a submit-only
+// token used by CI cannot browse the queue and a read-only dashboard token
+// cannot add to it.
+func roleAllows(role, need string) bool {
+	return role == RoleAdmin || role == need
+}
+
+// require wraps a handler so only tokens holding the needed role reach it
+func (s *apiTokenStore) require(need string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="vkm"`)
+			writeJSONError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		entry, ok := s.Lookup(strings.TrimSpace(token))
+		if !ok {
+			writeJSONError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		if !roleAllows(entry.Role, need) {
+			writeJSONError(w, http.StatusForbidden, fmt.Sprintf("token %q (%s) may not perform %s actions", entry.Name, entry.Role, need))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// ServeTokenCmd generates API tokens for serve api
+var ServeTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Generate an API token for vkm serve api",
+	Long: `Generate a random API token with the given role and append it to the
+tokens file. The token is printed once; keep it somewhere safe.
+
+Roles:
+  read    list and inspect jobs
+  submit  queue new URLs for processing
+  admin   everything, including deleting jobs
+
+Example:
+  vkm serve token --role submit --name ci --tokens data/api-tokens`,
+	RunE: runServeToken,
+}
+
+var (
+	tokenRole string
+	tokenName string
+)
+
+func init() {
+	ServeCmd.AddCommand(ServeTokenCmd)
+
+	ServeTokenCmd.Flags().StringVar(&tokenRole, "role", RoleRead, "Token role (read, submit, admin)")
+	ServeTokenCmd.Flags().StringVar(&tokenName, "name", "", "Name identifying the token holder (required)")
+	ServeTokenCmd.Flags().StringVar(&serveTokensPath, "tokens", "data/api-tokens", "Tokens file")
+
+	ServeTokenCmd.MarkFlagRequired("name")
+}
+
+func runServeToken(cmd *cobra.Command, args []string) error {
+	if !validRole(tokenRole) {
+		return fmt.Errorf("invalid role %q (use read, submit or admin)", tokenRole)
+	}
+	if strings.ContainsAny(tokenName, " \t\n") {
+		return fmt.Errorf("token name must not contain whitespace")
+	}
+
+	var raw [24]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := "vkm_" + hex.EncodeToString(raw[:])
+
+	if err := os.MkdirAll(filepath.Dir(serveTokensPath), 0755); err != nil {
+		return fmt.Errorf("failed to create tokens directory: %w", err)
+	}
+	file, err := os.OpenFile(serveTokensPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open tokens file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintf(file, "%s %s %s\n", tokenRole, token, tokenName); err != nil {
+		return fmt.Errorf("failed to write token: %w", err)
+	}
+
+	fmt.Printf("Created %s token for %s in %s:\n\n  %s\n", tokenRole, tokenName, serveTokensPath, token)
+	return nil
+}
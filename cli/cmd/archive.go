@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultDownloadArchive is the archive shared by download-simple,
+// download-playlist and pipeline
+const defaultDownloadArchive = "data/download-archive.txt"
+
+// downloadArchiveHelp documents --download-archive and --force
+const downloadArchiveHelp = `Download archive:
+  Every completed video is appended to --download-archive, one
+  "<site> <id>" line each ("youtube dQw4w9WgXcQ", "soundcloud 1234567")
+  as in yt-dlp's --download-archive, so the file can be shared with
+  yt-dlp itself. download-simple, download-playlist and
+  pipeline all read and extend the same file and skip listed videos, even
+  after their files were cleaned up. --force fetches them again; an empty
+  --download-archive disables the archive.`
+
+var (
+	downloadArchivePath string
+	downloadForce       bool
+)
+
+// downloadArchive is the set of "<site> <id>" entries recorded in an
+// archive file. A nil archive is empty and ignores additions.
+type downloadArchive struct {
+	path string
+	mu   sync.Mutex
+	ids  map[string]bool
+}
+
+// openDownloadArchive reads an archive file; a missing file is an empty
+// archive and an empty path disables it
+func openDownloadArchive(path string) (*downloadArchive, error) {
+	if path == "" {
+		return nil, nil
+	}
+	a := &downloadArchive{path: path, ids: make(map[string]bool)}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open download archive: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if extractor, id, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " "); ok && id != "" {
+			a.ids[archiveKey(extractor, id)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read download archive: %w", err)
+	}
+	return a, nil
+}
+
+// archiveKey is the archive line for a video: its site (yt-dlp's
+// extractor) and ID
+func archiveKey(site, videoID string) string {
+	return strings.ToLower(site) + " " + videoID
+}
+
+// Has reports whether site's videoID is in the archive
+func (a *downloadArchive) Has(site, videoID string) bool {
+	if a == nil || site == "" || videoID == "" {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.ids[archiveKey(site, videoID)]
+}
+
+// Add records videoID, downloaded from item's URL, as completed. Failures
+// to write are reported as warnings, since the download itself succeeded.
+func (a *downloadArchive) Add(item pipelineItem, videoID string) {
+	site := siteForURL(item.URL)
+	if a == nil || site == "" || videoID == "" {
+		return
+	}
+	key := archiveKey(site, videoID)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.ids[key] {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update download archive: %v\n", err)
+		return
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update download archive: %v\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, key); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update download archive: %v\n", err)
+		return
+	}
+	a.ids[key] = true
+}
+
+// Skip reports whether item is archived and should not be fetched again.
+// Items on other sites are only known once listed in a playlist, since
+// their IDs can't be read from the URL.
+func (a *downloadArchive) Skip(item pipelineItem) bool {
+	return !downloadForce && a.Has(siteForURL(item.URL), orDefault(item.VideoID, videoIDFromURL(item.URL)))
+}
+
+// videoIDFromURL extracts the video ID from the usual YouTube URL forms
+// (watch?v=, youtu.be/, /shorts/, /live/, /embed/), or returns ""
+func videoIDFromURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.TrimPrefix(u.Hostname(), "www."), "m.")
+
+	var id string
+	switch host {
+	case "youtu.be":
+		id = strings.Trim(u.Path, "/")
+	case "youtube.com", "music.youtube.com", "youtube-nocookie.com":
+		if v := u.Query().Get("v"); v != "" {
+			id = v
+			break
+		}
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) == 2 && (parts[0] == "shorts" || parts[0] == "live" || parts[0] == "embed") {
+			id = parts[1]
+		}
+	}
+	if !youtubeIDPattern.MatchString(id) {
+		return ""
+	}
+	return id
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// defaultChunkLength is the --chunk-length recordings longer than which
+// are transcribed in pieces
+const defaultChunkLength = time.Hour
+
+// chunkBitrate is the bitrate chunks are encoded at: an hour of mono MP3
+// at 48 kbit/s is about 21 MB, under Whisper's 25 MB upload limit
+const chunkBitrate = "48k"
+
+// pipelineChunkLength is the --chunk-length of pipeline and watch
+var pipelineChunkLength time.Duration
+
+// chunkOverlap is how much each chunk runs into the next, so words cut
+// at a chunk boundary are heard whole in one of them. Merging drops the
+// repeated speech.
+const chunkOverlap = 10 * time.Second
+
+// audioChunk is a piece of a longer recording and where it starts in it
+type audioChunk struct {
+	Path   string
+	Offset float64
+}
+
+// splitAudio cuts the audio of path into chunks of length, each running
+// chunkOverlap into the next, in dir with ffmpeg, re-encoded as mono MP3
+// at chunkBitrate so each fits Whisper's upload limit. Without ffprobe to
+// measure the recording, chunks are cut back to back instead.
+func splitAudio(ctx context.Context, path, dir string, length time.Duration) ([]audioChunk, time.Duration, error) {
+	if _, err := findTool("ffmpeg"); err != nil {
+		return nil, 0, fmt.Errorf("%w (required to split long recordings; --chunk-length 0 sends them whole)", err)
+	}
+	encode := []string{"-vn", "-ac", "1", "-c:a", "libmp3lame", "-b:a", chunkBitrate}
+
+	seconds, err := probeDuration(ctx, path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		chunks, err := splitAudioSegments(ctx, path, dir, length, encode)
+		return chunks, 0, err
+	}
+
+	total := time.Duration(seconds) * time.Second
+	count := 1
+	if total > length+chunkOverlap {
+		count = int((total - chunkOverlap + length - 1) / length)
+	}
+	chunks := make([]audioChunk, count)
+	for i := range chunks {
+		start := time.Duration(i) * length
+		chunkPath := filepath.Join(dir, fmt.Sprintf("chunk-%03d.mp3", i))
+		args := append([]string{"-y", "-loglevel", "error",
+			"-ss", fmt.Sprint(start.Seconds()), "-t", fmt.Sprint((length + chunkOverlap).Seconds()),
+			"-i", toolPath(path)}, encode...)
+		if out, err := toolCommand(ctx, "ffmpeg", append(args, toolPath(chunkPath))...).CombinedOutput(); err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, ctx.Err()
+			}
+			return nil, 0, fmt.Errorf("ffmpeg failed to cut chunk %d of %s: %v: %s", i+1, path, err, strings.TrimSpace(string(out)))
+		}
+		chunks[i] = audioChunk{Path: chunkPath, Offset: start.Seconds()}
+	}
+	return chunks, chunkOverlap, nil
+}
+
+// splitAudioSegments cuts path into back-to-back chunks of length with
+// ffmpeg's segment muxer, which needs no duration up front
+func splitAudioSegments(ctx context.Context, path, dir string, length time.Duration, encode []string) ([]audioChunk, error) {
+	args := append([]string{"-y", "-loglevel", "error", "-i", toolPath(path)}, encode...)
+	args = append(args,
+		"-f", "segment", "-segment_time", fmt.Sprint(int(length.Seconds())), "-reset_timestamps", "1",
+		toolPath(filepath.Join(dir, "chunk-%03d.mp3")),
+	)
+	if out, err := toolCommand(ctx, "ffmpeg", args...).CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("ffmpeg failed to split %s: %v: %s", path, err, strings.TrimSpace(string(out)))
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "chunk-*.mp3"))
+	if err != nil || len(paths) == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no chunks of %s", path)
+	}
+	sort.Strings(paths)
+	chunks := make([]audioChunk, len(paths))
+	for i, p := range paths {
+		chunks[i] = audioChunk{Path: p, Offset: float64(i) * length.Seconds()}
+	}
+	return chunks, nil
+}
+
+// transcribeInChunks transcribes a recording longer than length with the
+// Whisper API one chunk at a time, returning a single response whose
+// segments are timed in the whole recording, with the speech chunks
+// share merged. Each chunk's transcription is cached as it completes, so
+// a rerun after a failed chunk resumes at that chunk.
+func transcribeInChunks(ctx context.Context, path, apiKey string, length time.Duration) (*WhisperResponse, error) {
+	dir, err := newTempDir("chunks-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	recordingKey, err := whisperFileKey(path)
+	if err != nil {
+		return nil, err
+	}
+	chunks, overlap, err := splitAudio(ctx, path, dir, length)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("  Split into %d chunks of up to %s\n", len(chunks), length)
+
+	merged := &WhisperResponse{}
+	for i, chunk := range chunks {
+		fmt.Printf("  Transcribing chunk %d/%d...\n", i+1, len(chunks))
+		resp, err := requestWhisperResumable(ctx, chunk.Path, apiKey, whisperChunkKey(recordingKey, length, overlap, i))
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d/%d: %w (completed chunks are kept and reused on a rerun)", i+1, len(chunks), err)
+		}
+		if merged.Language == "" {
+			merged.Language = resp.Language
+		}
+		mergeChunk(merged, resp, chunk.Offset, overlap)
+	}
+	return merged, nil
+}
+
+// mergeChunk appends the transcription of a chunk starting offset seconds
+// into the recording to merged. Where the chunk overlaps the previous
+// one, segments starting before the middle of the overlap are taken from
+// the previous chunk and the rest from this one, so a segment spanning
+// the middle is kept once, with the words the previous chunk's last
+// segment already ended with dropped.
+func mergeChunk(merged, resp *WhisperResponse, offset float64, overlap time.Duration) {
+	if len(resp.Segments) == 0 {
+		// Models without timestamps give the text alone
+		merged.Text = joinOverlapping(merged.Text, resp.Text)
+		return
+	}
+
+	cut := offset + overlap.Seconds()/2
+	if overlap > 0 && len(merged.Segments) > 0 {
+		kept := merged.Segments[:0]
+		for _, seg := range merged.Segments {
+			if seg.Start < cut {
+				kept = append(kept, seg)
+			}
+		}
+		merged.Segments = kept
+	}
+	// Words are split at the middle of the overlap alike
+	if overlap > 0 && len(merged.Words) > 0 {
+		kept := merged.Words[:0]
+		for _, w := range merged.Words {
+			if w.Start < cut {
+				kept = append(kept, w)
+			}
+		}
+		merged.Words = kept
+	}
+	for _, w := range resp.Words {
+		w.Start += offset
+		w.End += offset
+		if overlap > 0 && offset > 0 && w.Start < cut {
+			continue
+		}
+		merged.Words = append(merged.Words, w)
+	}
+	first := true
+	for _, seg := range resp.Segments {
+		seg.Start += offset
+		seg.End += offset
+		if overlap > 0 && offset > 0 && seg.Start < cut {
+			continue
+		}
+		if first && len(merged.Segments) > 0 {
+			seg.Text = trimOverlap(merged.Segments[len(merged.Segments)-1].Text, seg.Text)
+			if strings.TrimSpace(seg.Text) == "" {
+				continue
+			}
+		}
+		first = false
+		merged.Segments = append(merged.Segments, seg)
+	}
+
+	texts := make([]string, 0, len(merged.Segments))
+	for _, seg := range merged.Segments {
+		if text := strings.TrimSpace(seg.Text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	merged.Text = strings.Join(texts, " ")
+}
+
+// maxOverlapWords bounds how many words two chunks' texts are compared
+// over: the speech of chunkOverlap and then some
+const maxOverlapWords = 60
+
+// trimOverlap returns next without the leading words that repeat the
+// words prev ends with. Words are compared ignoring case and punctuation,
+// and a repeat must be at least two words long to count.
+func trimOverlap(prev, next string) string {
+	prevWords := strings.Fields(prev)
+	nextWords := strings.Fields(next)
+	if len(prevWords) > maxOverlapWords {
+		prevWords = prevWords[len(prevWords)-maxOverlapWords:]
+	}
+	for n := min(len(prevWords), len(nextWords), maxOverlapWords); n >= 2; n-- {
+		match := true
+		for i := 0; i < n; i++ {
+			if overlapWord(prevWords[len(prevWords)-n+i]) != overlapWord(nextWords[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return strings.Join(nextWords[n:], " ")
+		}
+	}
+	return next
+}
+
+// overlapWord normalizes a word for trimOverlap
+func overlapWord(w string) string {
+	return strings.ToLower(strings.TrimFunc(w, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}))
+}
+
+// joinOverlapping joins the texts of consecutive chunks, dropping the
+// words they share
+func joinOverlapping(prev, next string) string {
+	next = strings.TrimSpace(trimOverlap(prev, strings.TrimSpace(next)))
+	switch {
+	case prev == "":
+		return next
+	case next == "":
+		return prev
+	}
+	return prev + " " + next
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// whisperAPIFormats are the file extensions the Whisper API accepts; it
+// tells formats apart by the uploaded file's name
+var whisperAPIFormats = map[string]bool{
+	"flac": true, "m4a": true, "mp3": true, "mp4": true, "mpeg": true,
+	"mpga": true, "oga": true, "ogg": true, "wav": true, "webm": true,
+}
+
+// whisperContainerAliases map extensions the Whisper API rejects to an
+// accepted one naming the same container. Files whose content is in that
+// container are sent under the accepted name, with no decoding: yt-dlp's
+// Opus downloads are Ogg files, its .m4b, .m4v and .mov ones MP4.
+var whisperContainerAliases = map[string]string{
+	"opus": "ogg",
+	"m4b":  "m4a",
+	"m4v":  "mp4",
+	"mov":  "mp4",
+	"3gp":  "mp4",
+	"weba": "webm",
+}
+
+// errWhisperFormat marks a transcription the Whisper API refused because
+// it couldn't decode the audio
+var errWhisperFormat = errors.New("audio format rejected")
+
+// whisperFormatRejected reports whether a Whisper API error body refuses
+// the audio's format
+func whisperFormatRejected(body []byte) bool {
+	msg := strings.ToLower(string(body))
+	return strings.Contains(msg, "invalid file format") ||
+		strings.Contains(msg, "could not be decoded") ||
+		strings.Contains(msg, "format is not supported")
+}
+
+// sniffContainer names the container of the file at path from its first
+// bytes: "ogg", "mp4" (ISO base media, including M4A), "webm"
+// (Matroska), or "" if it isn't one of those
+func sniffContainer(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return ""
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return "ogg"
+	case bytes.Equal(head[4:8], []byte("ftyp")):
+		return "mp4"
+	case bytes.HasPrefix(head, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		return "webm"
+	}
+	return ""
+}
+
+// containerOf is the container files with an accepted extension are in
+func containerOf(ext string) string {
+	switch ext {
+	case "m4a", "mp4":
+		return "mp4"
+	case "oga", "ogg":
+		return "ogg"
+	}
+	return ext
+}
+
+// whisperUploadAudio returns a file holding path's audio in a format the
+// Whisper API accepts, and how it was converted ("" when path is sent
+// as it is). Files in an accepted container are linked into dir under an
+// accepted name; others, or any file with force, are converted to mono
+// MP3 with ffmpeg.
+func whisperUploadAudio(ctx context.Context, path, dir string, force bool) (string, string, error) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if !force {
+		if whisperAPIFormats[ext] {
+			return path, "", nil
+		}
+		if alias, ok := whisperContainerAliases[ext]; ok && sniffContainer(path) == containerOf(alias) {
+			upload := filepath.Join(dir, "audio."+alias)
+			if err := os.Link(path, upload); err != nil {
+				if err := copyFile(path, upload); err != nil {
+					return "", "", err
+				}
+			}
+			return upload, fmt.Sprintf("%s sent as %s (same container)", ext, alias), nil
+		}
+	}
+
+	if _, err := findTool("ffmpeg"); err != nil {
+		return "", "", fmt.Errorf("the Whisper API can't read %s audio and converting it needs ffmpeg: %w", orDefault(ext, "this"), err)
+	}
+	upload := filepath.Join(dir, "audio.mp3")
+	out, err := toolCommand(ctx, "ffmpeg", "-nostdin", "-y", "-loglevel", "error", "-i", toolPath(path),
+		"-vn", "-ac", "1", "-c:a", "libmp3lame", "-b:a", chunkBitrate, toolPath(upload)).CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		return "", "", fmt.Errorf("ffmpeg failed to convert %s for the Whisper API: %v: %s", filepath.Base(path), err, strings.TrimSpace(string(out)))
+	}
+	fmt.Printf("  Converted %s to MP3 with ffmpeg for the Whisper API\n", filepath.Base(path))
+	return upload, fmt.Sprintf("%s converted to mp3 (ffmpeg, mono %s)", orDefault(ext, "audio"), chunkBitrate), nil
+}
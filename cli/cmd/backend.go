@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// BackendCmd groups commands that manage the Clojure backend
+var BackendCmd = &cobra.Command{
+	Use:   "backend",
+	Short: "Manage the knowledge graph backend",
+	Long: `Manage the Clojure knowledge graph backend from the Go CLI.
+
+Examples:
+  vkm backend init
+  vkm backend init --core ../core --force
+  vkm backend info`,
+}
+
+// BackendInitCmd installs the Datomic schema
+var BackendInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the Datomic database and install the schema",
+	Long: `Create the Datomic database and install the knowledge graph schema.
+
+The backend API server installs the schema itself when it starts, so if a
+backend is already answering at --backend there is nothing to do. Otherwise
+this runs the documented Clojure initialization in the core directory:
+
+  clojure -M:run init
+
+which creates the database configured in core/resources/config.edn and
+transacts resources/schema/datomic-schema.edn. Use --force to run it even
+when a backend is up (e.g. against a persistent Datomic URI).
+
+Requirements: Clojure CLI (clojure or clj) on PATH`,
+	RunE: runBackendInit,
+}
+
+var (
+	backendURL     string
+	backendCoreDir string
+	backendForce   bool
+)
+
+func init() {
+	BackendCmd.AddCommand(BackendInitCmd)
+
+	BackendInitCmd.Flags().StringVarP(&backendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	BackendInitCmd.Flags().StringVar(&backendCoreDir, "core", "core", "Path to the Clojure core project")
+	BackendInitCmd.Flags().BoolVar(&backendForce, "force", false, "Run the Clojure init even if the backend is reachable")
+}
+
+func runBackendInit(cmd *cobra.Command, args []string) error {
+	if !backendForce {
+		if stats, err := fetchBackendStats(cmd.Context(), backendURL); err == nil {
+			fmt.Printf("✓ Backend at %s is running; schema was installed at startup\n", backendURL)
+			fmt.Printf("  Stats: %s\n", stats)
+			return nil
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(backendCoreDir, "deps.edn")); err != nil {
+		return fmt.Errorf("no deps.edn in %s (set --core to the Clojure core project)", backendCoreDir)
+	}
+
+	clojure := "clojure"
+	if !commandExists(clojure) {
+		clojure = "clj"
+		if !commandExists(clojure) {
+			return missingToolError("clojure")
+		}
+	}
+
+	fmt.Printf("Initializing database with: %s -M:run init (in %s)\n", clojure, backendCoreDir)
+
+	initCmd := toolCommand(cmd.Context(), clojure, "-M:run", "init")
+	initCmd.Dir = backendCoreDir
+	initCmd.Stdout = os.Stdout
+	initCmd.Stderr = os.Stderr
+	if err := initCmd.Run(); err != nil {
+		return fmt.Errorf("backend init failed: %w", err)
+	}
+
+	fmt.Println("\n✓ Database created and schema installed")
+	fmt.Println("\nNext step: Start the backend")
+	fmt.Printf("  cd %s && clojure -M:server\n", backendCoreDir)
+	return nil
+}
+
+// fetchBackendStats returns the raw /api/stats body, which only succeeds
+// once the backend has a database with the schema installed
+func fetchBackendStats(ctx context.Context, baseURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/api/stats", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("backend returned status %d", resp.StatusCode)
+	}
+	return string(body), nil
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// BackendInfoCmd shows how the backend is configured
+var BackendInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show the backend's models, schema version, patch counts and storage",
+	Long: `Query the backend's /api/info for its configuration: the Claude model it
+extracts facts with and whether it has a CLAUDE_API_KEY, its embedding
+model, the database it stores patches in, the version of its installed
+schema (a hash of the schema file), its patch, fact, edge, morphism and
+motive counts, and storage statistics.
+
+Run it before a big ingestion run to confirm the server side is set up as
+expected. Warnings flag an in-memory database, whose patches are lost
+when the backend restarts, and a missing CLAUDE_API_KEY, without which
+the backend extracts no facts.
+
+Examples:
+  vkm backend info
+  vkm backend info --backend http://graph.internal:3000 --format json`,
+	Args: cobra.NoArgs,
+	RunE: runBackendInfo,
+}
+
+var backendInfoFormat string
+
+func init() {
+	BackendCmd.AddCommand(BackendInfoCmd)
+
+	BackendInfoCmd.Flags().StringVarP(&backendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	BackendInfoCmd.Flags().StringVar(&backendInfoFormat, "format", "text", "Output format (text, json)")
+}
+
+// BackendInfo is the backend's /api/info answer
+type BackendInfo struct {
+	Service    string `json:"service"`
+	Version    string `json:"version"`
+	Extraction struct {
+		Model      string   `json:"model"`
+		Strategies []string `json:"strategies"`
+		APIKeySet  bool     `json:"api-key-set"`
+	} `json:"extraction"`
+	Embeddings struct {
+		Model      string `json:"model"`
+		Dimensions int    `json:"dimensions"`
+	} `json:"embeddings"`
+	Database struct {
+		URI      string `json:"uri"`
+		InMemory bool   `json:"in-memory"`
+		Schema   struct {
+			Version    string `json:"version"`
+			Attributes int    `json:"attributes"`
+		} `json:"schema"`
+		BasisT int64 `json:"basis-t"`
+		Datoms int64 `json:"datoms"`
+	} `json:"database"`
+	Counts struct {
+		Patches   int `json:"patches"`
+		Facts     int `json:"facts"`
+		Edges     int `json:"edges"`
+		Morphisms int `json:"morphisms"`
+		Motives   int `json:"motives"`
+	} `json:"counts"`
+}
+
+func runBackendInfo(cmd *cobra.Command, args []string) error {
+	if backendInfoFormat != "text" && backendInfoFormat != "json" {
+		return fmt.Errorf("unknown format %q (use text or json)", backendInfoFormat)
+	}
+	info, raw, err := fetchBackendInfo(cmd.Context(), backendURL)
+	if err != nil {
+		return err
+	}
+	if backendInfoFormat == "json" {
+		_, err := os.Stdout.Write(append(raw, '\n'))
+		return err
+	}
+
+	fmt.Printf("Backend:     %s (%s %s)\n", backendURL, orDefault(info.Service, "unknown service"), orDefault(info.Version, "?"))
+	fmt.Printf("Extraction:  %s (strategies: %s)\n", orDefault(info.Extraction.Model, "unknown"), strings.Join(info.Extraction.Strategies, ", "))
+	fmt.Printf("Embeddings:  %s (%d dimensions)\n", orDefault(info.Embeddings.Model, "unknown"), info.Embeddings.Dimensions)
+	fmt.Printf("Database:    %s\n", orDefault(info.Database.URI, "not initialized"))
+	fmt.Printf("Schema:      version %s (%d attributes)\n", orDefault(info.Database.Schema.Version, "unknown"), info.Database.Schema.Attributes)
+	fmt.Printf("Storage:     %d datoms, basis t %d\n", info.Database.Datoms, info.Database.BasisT)
+	c := info.Counts
+	fmt.Printf("Contents:    %d patches, %d facts, %d edges, %d morphisms, %d motives\n",
+		c.Patches, c.Facts, c.Edges, c.Morphisms, c.Motives)
+
+	var warnings []string
+	if !info.Extraction.APIKeySet {
+		warnings = append(warnings, "The backend has no CLAUDE_API_KEY and will extract no facts")
+	}
+	if info.Database.InMemory {
+		warnings = append(warnings, "The database is in memory: its patches are lost when the backend restarts")
+	}
+	if len(warnings) > 0 {
+		fmt.Println()
+	}
+	for _, w := range warnings {
+		fmt.Printf("⚠ %s\n", w)
+	}
+	return nil
+}
+
+// fetchBackendInfo returns the backend's /api/info, parsed and raw
+func fetchBackendInfo(ctx context.Context, baseURL string) (*BackendInfo, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/api/info", nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("backend not reachable at %s: %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, fmt.Errorf("backend at %s has no /api/info; upgrade it to inspect its configuration", baseURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("backend error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var info BackendInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse backend info: %w", err)
+	}
+	return &info, body, nil
+}
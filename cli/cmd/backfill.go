@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Backfill is the persisted cursor of a channel archive backfill. PageToken
+// is the uploads-playlist page being worked on and PageOffset the number of
+// its entries already handled, so a restart re-fetches one page and
+// continues where the previous run stopped.
+type Backfill struct {
+	ChannelID   string
+	PlaylistID  string
+	PageToken   string
+	PageOffset  int
+	Position    int
+	Total       int
+	CompletedAt *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// BackfillDay counts a backfill's outcomes on one quota day
+type BackfillDay struct {
+	Day       string
+	Processed int
+	Skipped   int
+	Failed    int
+	Facts     int
+}
+
+const backfillColumns = `channel_id, playlist_id, page_token, page_offset, position, total,
+	completed_at, created_at, updated_at`
+
+func scanBackfill(row interface{ Scan(...interface{}) error }) (*Backfill, error) {
+	var b Backfill
+	var completed sql.NullTime
+	err := row.Scan(&b.ChannelID, &b.PlaylistID, &b.PageToken, &b.PageOffset, &b.Position, &b.Total,
+		&completed, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if completed.Valid {
+		b.CompletedAt = &completed.Time
+	}
+	return &b, nil
+}
+
+// GetBackfill returns the backfill cursor for a channel, or nil if none
+// has been started
+func (m *Manifest) GetBackfill(channelID string) (*Backfill, error) {
+	b, err := scanBackfill(m.db.QueryRow(
+		"SELECT "+backfillColumns+" FROM backfills WHERE channel_id = ?", channelID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backfill for %s: %w", channelID, err)
+	}
+	return b, nil
+}
+
+// SaveBackfill inserts or updates a backfill cursor
+func (m *Manifest) SaveBackfill(b *Backfill) error {
+	return m.write(func(tx *sql.Tx) error {
+		return saveBackfill(tx, b)
+	})
+}
+
+func saveBackfill(tx *sql.Tx, b *Backfill) error {
+	now := time.Now().UTC()
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = now
+	}
+	b.UpdatedAt = now
+
+	_, err := tx.Exec(`
+		INSERT INTO backfills (channel_id, playlist_id, page_token, page_offset, position, total,
+			completed_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(channel_id) DO UPDATE SET
+			playlist_id  = excluded.playlist_id,
+			page_token   = excluded.page_token,
+			page_offset  = excluded.page_offset,
+			position     = excluded.position,
+			total        = excluded.total,
+			completed_at = excluded.completed_at,
+			updated_at   = excluded.updated_at`,
+		b.ChannelID, b.PlaylistID, b.PageToken, b.PageOffset, b.Position, b.Total,
+		b.CompletedAt, b.CreatedAt, b.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save backfill for %s: %w", b.ChannelID, err)
+	}
+	return nil
+}
+
+// AdvanceBackfill saves the cursor and adds an item's outcome to the day's
+// counts in one transaction, so a crash never counts an item twice
+func (m *Manifest) AdvanceBackfill(b *Backfill, day string, outcome BackfillDay) error {
+	return m.write(func(tx *sql.Tx) error {
+		if err := saveBackfill(tx, b); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO backfill_days (channel_id, day, processed, skipped, failed, facts)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(channel_id, day) DO UPDATE SET
+				processed = processed + excluded.processed,
+				skipped   = skipped + excluded.skipped,
+				failed    = failed + excluded.failed,
+				facts     = facts + excluded.facts`,
+			b.ChannelID, day, outcome.Processed, outcome.Skipped, outcome.Failed, outcome.Facts)
+		if err != nil {
+			return fmt.Errorf("failed to record backfill progress: %w", err)
+		}
+		return nil
+	})
+}
+
+// BackfillDays returns a channel's per-day counts, oldest first
+func (m *Manifest) BackfillDays(channelID string) ([]BackfillDay, error) {
+	rows, err := m.db.Query(`
+		SELECT day, processed, skipped, failed, facts FROM backfill_days
+		WHERE channel_id = ? ORDER BY day`, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backfill progress: %w", err)
+	}
+	defer rows.Close()
+
+	var days []BackfillDay
+	for rows.Next() {
+		var d BackfillDay
+		if err := rows.Scan(&d.Day, &d.Processed, &d.Skipped, &d.Failed, &d.Facts); err != nil {
+			return nil, fmt.Errorf("failed to read backfill progress: %w", err)
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// GetBackfillDay returns a channel's counts for one day
+func (m *Manifest) GetBackfillDay(channelID, day string) (BackfillDay, error) {
+	d := BackfillDay{Day: day}
+	err := m.db.QueryRow(`
+		SELECT processed, skipped, failed, facts FROM backfill_days
+		WHERE channel_id = ? AND day = ?`, channelID, day).
+		Scan(&d.Processed, &d.Skipped, &d.Failed, &d.Facts)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return d, fmt.Errorf("failed to read backfill progress: %w", err)
+	}
+	return d, nil
+}
+
+// DeleteBackfill removes a channel's cursor and daily counts
+func (m *Manifest) DeleteBackfill(channelID string) error {
+	return m.write(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM backfills WHERE channel_id = ?", channelID); err != nil {
+			return fmt.Errorf("failed to reset backfill for %s: %w", channelID, err)
+		}
+		if _, err := tx.Exec("DELETE FROM backfill_days WHERE channel_id = ?", channelID); err != nil {
+			return fmt.Errorf("failed to reset backfill for %s: %w", channelID, err)
+		}
+		return nil
+	})
+}
+
+// VideoProcessed reports whether any manifest item for videoID reached the
+// processed state, whatever URL form it was submitted under
+func (m *Manifest) VideoProcessed(videoID string) (bool, error) {
+	var n int
+	err := m.db.QueryRow("SELECT COUNT(*) FROM items WHERE video_id = ? AND state = ?",
+		videoID, ItemProcessed).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to read manifest item: %w", err)
+	}
+	return n > 0, nil
+}
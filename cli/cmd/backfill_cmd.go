@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// BackfillCmd ingests a channel's upload archive over as many days as it
+// takes, checkpointing its position in the manifest
+var BackfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Ingest a channel's whole upload archive over several days",
+	Long: `Walk a channel's uploads playlist (newest first) with the YouTube Data
+API and run every video through the pipeline, for archives too large to
+ingest in one sitting.
+
+The cursor position in the uploads list is saved in the manifest after
+every video, so an interrupted or budget-limited run picks up where it
+stopped when started again. Videos the manifest already records as
+processed are skipped. Failed videos are recorded in the manifest and
+passed over; rerun them with 'vkm pipeline'.
+
+Each quota day (midnight Pacific, when Google resets Data API quota) at
+most --daily-videos are processed. When that budget or the Data API quota
+runs out, backfill prints the day's progress report and exits, or with
+--wait sleeps until the next day and continues. Patches are committed at
+the video's publish date by default (--commit-time publish).
+
+--prefer-captions transcribes from existing captions where a video has
+them, as in 'vkm pipeline'.
+
+Requires YOUTUBE_API_KEY plus everything 'vkm pipeline' needs.
+
+Examples:
+  vkm backfill --channel UCxxx --all --daily-videos 40 --wait
+  vkm backfill --channel UCxxx --max 200
+  vkm backfill --channel UCxxx --status`,
+	RunE: runBackfill,
+}
+
+var (
+	backfillChannel     string
+	backfillAll         bool
+	backfillMax         int
+	backfillDailyVideos int
+	backfillWait        bool
+	backfillStatus      bool
+	backfillReset       bool
+	backfillCommitTime  string
+)
+
+func init() {
+	BackfillCmd.Flags().StringVar(&backfillChannel, "channel", "", "YouTube channel ID (UC...)")
+	BackfillCmd.Flags().BoolVar(&backfillAll, "all", false, "Backfill the channel's entire upload archive")
+	BackfillCmd.Flags().IntVar(&backfillMax, "max", 0, "Only backfill the newest N uploads")
+	BackfillCmd.Flags().IntVar(&backfillDailyVideos, "daily-videos", 25, "Maximum videos to process per quota day")
+	BackfillCmd.Flags().BoolVar(&backfillWait, "wait", false, "Sleep until the next quota day instead of exiting when the budget is spent")
+	BackfillCmd.Flags().BoolVar(&backfillStatus, "status", false, "Print the backfill's progress and exit")
+	BackfillCmd.Flags().BoolVar(&backfillReset, "reset", false, "Discard the saved cursor and start again from the newest upload")
+	BackfillCmd.Flags().StringVar(&backfillCommitTime, "commit-time", commitTimePublish, "Patch timestamp source (ingest, publish)")
+	BackfillCmd.Flags().StringVarP(&pipelineOutputDir, "output", "o", "data/pipeline", "Working directory for pipeline files")
+	BackfillCmd.Flags().StringVarP(&pipelineBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	BackfillCmd.Flags().DurationVar(&pipelineWaitBackend, "wait-for-backend", 0, "Wait up to this long (e.g. 60s) for the backend to become healthy")
+	BackfillCmd.Flags().BoolVarP(&pipelineKeepFiles, "keep-files", "k", false, "Keep downloaded videos and transcripts after processing")
+	BackfillCmd.Flags().StringVar(&pipelineManifest, "manifest", "data/manifest.db", "SQLite manifest holding items and the backfill cursor")
+	BackfillCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	BackfillCmd.Flags().StringVar(&pipelineNames, "name-template", defaultNameTemplate, "Go template for downloaded and transcript file names")
+	BackfillCmd.Flags().StringVar(&outputLayout, "layout", layoutFlat, "Output layout: flat, or per-video for a directory of files per video")
+	BackfillCmd.Flags().BoolVar(&pipelineCaptions, "prefer-captions", false, "Use existing YouTube captions instead of downloading and transcribing audio")
+	BackfillCmd.Flags().StringVar(&captionLangs, "caption-langs", defaultCaptionLangs, "Caption languages to accept, as yt-dlp --sub-langs")
+	BackfillCmd.MarkFlagRequired("channel")
+}
+
+func runBackfill(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	manifest, err := openManifest(pipelineManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	if backfillReset {
+		if err := manifest.DeleteBackfill(backfillChannel); err != nil {
+			return err
+		}
+		fmt.Printf("Reset backfill cursor for %s\n", backfillChannel)
+		if !backfillAll && backfillMax <= 0 {
+			return nil
+		}
+	}
+
+	if backfillStatus {
+		return printBackfillStatus(manifest, backfillChannel)
+	}
+
+	if !backfillAll && backfillMax <= 0 {
+		return fmt.Errorf("use --all to backfill the whole archive, or --max N for the newest N uploads")
+	}
+	if backfillDailyVideos <= 0 {
+		return fmt.Errorf("--daily-videos must be positive")
+	}
+	if backfillCommitTime != commitTimeIngest && backfillCommitTime != commitTimePublish {
+		return fmt.Errorf("unknown commit time %q (use ingest or publish)", backfillCommitTime)
+	}
+	pipelineCommitTime = backfillCommitTime
+
+	if err := checkPipelinePrerequisites(cmd.Context()); err != nil {
+		return err
+	}
+	client, err := newYouTubeDataClient(ctx, youtubeAPIKey(), manifest)
+	if err != nil {
+		return err
+	}
+
+	bf, err := manifest.GetBackfill(backfillChannel)
+	if err != nil {
+		return err
+	}
+	if bf == nil {
+		playlistID, err := client.UploadsPlaylistID(ctx, backfillChannel)
+		if err != nil {
+			return err
+		}
+		bf = &Backfill{ChannelID: backfillChannel, PlaylistID: playlistID}
+		if err := manifest.SaveBackfill(bf); err != nil {
+			return err
+		}
+	}
+	if bf.CompletedAt != nil {
+		fmt.Printf("Backfill of %s completed on %s (%d videos). Use --reset to start over.\n",
+			bf.ChannelID, bf.CompletedAt.Local().Format("2006-01-02"), bf.Position)
+		return nil
+	}
+
+	run, err := newPipelineRun(pipelineOutputDir)
+	if err != nil {
+		return err
+	}
+	defer run.Close()
+
+	fmt.Println("=== VKM Channel Backfill ===")
+	fmt.Printf("Channel: %s (uploads playlist %s)\n", bf.ChannelID, bf.PlaylistID)
+	if bf.Position > 0 {
+		fmt.Printf("Resuming at position %d\n", bf.Position)
+	}
+	fmt.Printf("Budget: %d videos per day\n\n", backfillDailyVideos)
+
+	day := youtubeQuotaDay(time.Now())
+	var page *playlistPage
+
+	for ctx.Err() == nil {
+		if !backfillAll && bf.Position >= backfillMax {
+			break
+		}
+
+		if today := youtubeQuotaDay(time.Now()); today != day {
+			printBackfillDay(manifest, bf, day)
+			day = today
+		}
+
+		stats, err := manifest.GetBackfillDay(bf.ChannelID, day)
+		if err != nil {
+			return err
+		}
+		if stats.Processed+stats.Failed >= backfillDailyVideos {
+			printBackfillDay(manifest, bf, day)
+			if !backfillWait {
+				fmt.Printf("Daily budget of %d videos reached; run again tomorrow to resume.\n", backfillDailyVideos)
+				return nil
+			}
+			if !waitForQuotaDay(ctx) {
+				break
+			}
+			continue
+		}
+
+		if page == nil {
+			page, err = client.PlaylistPage(ctx, bf.PlaylistID, bf.PageToken)
+			if errors.Is(err, errQuotaExhausted) {
+				printBackfillDay(manifest, bf, day)
+				if !backfillWait {
+					fmt.Printf("%v; run again after the quota resets to resume.\n", err)
+					return nil
+				}
+				if !waitForQuotaDay(ctx) {
+					break
+				}
+				continue
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				return err
+			}
+			if page.Total > 0 {
+				bf.Total = int(page.Total)
+			}
+		}
+
+		if bf.PageOffset >= len(page.Entries) {
+			if page.NextToken == "" {
+				now := time.Now().UTC()
+				bf.CompletedAt = &now
+				if err := manifest.SaveBackfill(bf); err != nil {
+					return err
+				}
+				break
+			}
+			bf.PageToken = page.NextToken
+			bf.PageOffset = 0
+			if err := manifest.SaveBackfill(bf); err != nil {
+				return err
+			}
+			page = nil
+			continue
+		}
+
+		entry := page.Entries[bf.PageOffset]
+		var outcome BackfillDay
+
+		// New uploads shift the list, so a resumed page can repeat videos;
+		// the manifest catches those as well as earlier pipeline runs
+		done, err := manifest.VideoProcessed(entry.VideoID)
+		if err != nil {
+			return err
+		}
+		if done {
+			fmt.Printf("Skipping %s (already processed)\n", entry.VideoID)
+			outcome.Skipped = 1
+		} else {
+			fmt.Printf("[%d/%d] %s\n", bf.Position+1, bf.Total, entry.Title)
+			result, err := run.processItem(ctx, pipelineItem{
+				URL:         entry.URL,
+				VideoID:     entry.VideoID,
+				PublishedAt: entry.PublishedAt,
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					// Leave the cursor on this video so the next run retries it
+					break
+				}
+				outcome.Failed = 1
+			} else {
+				outcome.Processed = 1
+				outcome.Facts = result.FactsCount
+			}
+		}
+
+		bf.PageOffset++
+		bf.Position++
+		if err := manifest.AdvanceBackfill(bf, day, outcome); err != nil {
+			return err
+		}
+	}
+
+	printBackfillDay(manifest, bf, day)
+	switch {
+	case bf.CompletedAt != nil:
+		fmt.Printf("Backfill complete: walked all %d uploads of %s\n", bf.Position, bf.ChannelID)
+	case ctx.Err() != nil:
+		fmt.Printf("Interrupted at position %d; run again to resume.\n", bf.Position)
+	default:
+		fmt.Printf("Reached --max %d uploads.\n", backfillMax)
+	}
+	return nil
+}
+
+// printBackfillDay prints the progress report for one quota day
+func printBackfillDay(m *Manifest, bf *Backfill, day string) {
+	stats, err := m.GetBackfillDay(bf.ChannelID, day)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+	fmt.Printf("\n── %s: %d processed, %d skipped, %d failed, %d facts · position %s\n\n",
+		day, stats.Processed, stats.Skipped, stats.Failed, stats.Facts, backfillPosition(bf))
+}
+
+// backfillPosition formats the cursor as "position/total" when the total
+// is known
+func backfillPosition(bf *Backfill) string {
+	if bf.Total > 0 {
+		return fmt.Sprintf("%d/%d", bf.Position, bf.Total)
+	}
+	return fmt.Sprintf("%d", bf.Position)
+}
+
+// waitForQuotaDay sleeps until the next quota day begins, returning false
+// if ctx is canceled first
+func waitForQuotaDay(ctx context.Context) bool {
+	now := time.Now().In(youtubeQuotaLocation)
+	y, mo, d := now.Date()
+	next := time.Date(y, mo, d+1, 0, 0, 0, 0, youtubeQuotaLocation)
+	fmt.Printf("Waiting until %s to continue...\n", next.Local().Format("2006-01-02 15:04"))
+
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func printBackfillStatus(m *Manifest, channelID string) error {
+	bf, err := m.GetBackfill(channelID)
+	if err != nil {
+		return err
+	}
+	if bf == nil {
+		fmt.Printf("No backfill started for %s\n", channelID)
+		return nil
+	}
+
+	state := "in progress"
+	if bf.CompletedAt != nil {
+		state = "completed " + bf.CompletedAt.Local().Format("2006-01-02")
+	}
+	fmt.Printf("Backfill of %s: %s, position %s\n", bf.ChannelID, state, backfillPosition(bf))
+	fmt.Printf("Started %s, last progress %s\n\n",
+		bf.CreatedAt.Local().Format("2006-01-02 15:04"), bf.UpdatedAt.Local().Format("2006-01-02 15:04"))
+
+	days, err := m.BackfillDays(channelID)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tPROCESSED\tSKIPPED\tFAILED\tFACTS")
+	var total BackfillDay
+	for _, d := range days {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", d.Day, d.Processed, d.Skipped, d.Failed, d.Facts)
+		total.Processed += d.Processed
+		total.Skipped += d.Skipped
+		total.Failed += d.Failed
+		total.Facts += d.Facts
+	}
+	fmt.Fprintf(w, "total\t%d\t%d\t%d\t%d\n", total.Processed, total.Skipped, total.Failed, total.Facts)
+	return w.Flush()
+}
@@ -0,0 +1,733 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// BundleCmd packages everything vkm knows about one video into a zip
+var BundleCmd = &cobra.Command{
+	Use:   "bundle [video-id]",
+	Short: "Package a video's transcript and facts for sharing",
+	Long: `Package one video's metadata, transcript, extracted patch and provenance
+into a portable zip that another vkm user can import with 'vkm bundle import'.
+
+Files are looked up through the manifest and by scanning --data: the
+yt-dlp .info.json, the transcript (Whisper JSON preferred over plain text),
+the document patch (from a sandbox run, or fetched from --backend when it
+only exists there) and any supplementary comment patches.
+
+Bundle layout:
+  bundle.json          video, provenance and SHA-256 of every file
+  info.json            yt-dlp metadata
+  transcript.json/.txt transcript
+  patch.json           extracted document patch
+  supplementary/*.json low-trust supplementary patches
+
+Examples:
+  vkm bundle dQw4w9WgXcQ -o talk.zip
+  vkm bundle import talk.zip --backend http://localhost:3000
+  vkm bundle import talk.zip --sandbox`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBundleExport,
+}
+
+// BundleImportCmd imports a bundle into the local data directory and graph
+var BundleImportCmd = &cobra.Command{
+	Use:   "import [bundle.zip]",
+	Short: "Import a bundle into the local graph",
+	Long: `Import a bundle created with 'vkm bundle'. Checksums are verified, the
+metadata and transcript are copied under --data, and the patch is stored
+as-is through the backend's /api/patches endpoint (or in a new sandbox run
+with --sandbox), so facts are not re-extracted. The original patch ID and
+export time are kept in the patch metadata. Bundles without a patch fall
+back to uploading the transcript for extraction.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBundleImport,
+}
+
+var (
+	bundleOutput     string
+	bundleDataDir    string
+	bundleManifest   string
+	bundleBackendURL string
+	bundleSandbox    bool
+	bundleSandboxDir string
+)
+
+func init() {
+	BundleCmd.AddCommand(BundleImportCmd)
+
+	BundleCmd.PersistentFlags().StringVar(&bundleDataDir, "data", "data", "Data directory to search (export) or populate (import)")
+	BundleCmd.PersistentFlags().StringVar(&bundleManifest, "manifest", "data/manifest.db", "SQLite manifest recording item progress")
+	BundleCmd.PersistentFlags().StringVarP(&bundleBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	BundleCmd.PersistentFlags().StringVar(&bundleSandboxDir, "sandbox-dir", "data/sandbox", "Root directory for sandbox runs")
+
+	BundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", "", "Bundle file (default <video-id>.vkm.zip)")
+	BundleImportCmd.Flags().BoolVar(&bundleSandbox, "sandbox", false, "Store the patch in a new sandbox run instead of the backend")
+}
+
+// bundleFormat is bumped when the bundle layout changes incompatibly
+const bundleFormat = 1
+
+// BundleManifest is bundle.json, describing the video and its files
+type BundleManifest struct {
+	Format     int               `json:"format"`
+	VideoID    string            `json:"video_id"`
+	URL        string            `json:"url,omitempty"`
+	Title      string            `json:"title,omitempty"`
+	Channel    string            `json:"channel,omitempty"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Provenance BundleProvenance  `json:"provenance"`
+	Files      map[string]string `json:"files"`
+}
+
+// BundleProvenance records where the bundled artifacts came from
+type BundleProvenance struct {
+	PatchID         string     `json:"patch_id,omitempty"`
+	PatchFrom       string     `json:"patch_from,omitempty"`
+	PatchTimestamp  *time.Time `json:"patch_timestamp,omitempty"`
+	Transcript      string     `json:"transcript,omitempty"`
+	AudioConversion string     `json:"audio_conversion,omitempty"`
+	ManifestState   string     `json:"manifest_state,omitempty"`
+	ProcessedAt     *time.Time `json:"processed_at,omitempty"`
+}
+
+// videoArtifacts are the local files found for one video
+type videoArtifacts struct {
+	infoPath       string
+	transcriptPath string
+	patch          *Patch
+	patchPath      string
+	supplementary  []*Patch
+}
+
+func runBundleExport(cmd *cobra.Command, args []string) error {
+	videoID := args[0]
+	output := bundleOutput
+	if output == "" {
+		output = videoID + ".vkm.zip"
+	}
+
+	manifest, err := openManifest(bundleManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	item, err := manifest.ItemByVideoID(videoID)
+	if err != nil {
+		return err
+	}
+
+	found, err := findVideoArtifacts(bundleDataDir, videoID, item)
+	if err != nil {
+		return err
+	}
+
+	bm := BundleManifest{
+		Format:     bundleFormat,
+		VideoID:    videoID,
+		URL:        "https://www.youtube.com/watch?v=" + videoID,
+		ExportedAt: time.Now().UTC(),
+		Files:      make(map[string]string),
+	}
+	if item != nil {
+		bm.URL = item.URL
+		bm.Provenance.ManifestState = item.State
+		bm.Provenance.AudioConversion = item.AudioConversion
+		if item.State == ItemProcessed {
+			processed := item.UpdatedAt.UTC()
+			bm.Provenance.ProcessedAt = &processed
+		}
+	}
+
+	files := make(map[string][]byte)
+
+	if found.infoPath != "" {
+		data, err := os.ReadFile(found.infoPath)
+		if err != nil {
+			return fmt.Errorf("failed to read metadata: %w", err)
+		}
+		files["info.json"] = data
+		if info, err := loadVideoMetadata(found.infoPath); err == nil {
+			f := nameFieldsFromInfo(info)
+			bm.Title, bm.Channel = f.Title, f.Channel
+		}
+	}
+
+	if found.transcriptPath != "" {
+		data, err := os.ReadFile(found.transcriptPath)
+		if err != nil {
+			return fmt.Errorf("failed to read transcript: %w", err)
+		}
+		files["transcript"+filepath.Ext(found.transcriptPath)] = data
+		bm.Provenance.Transcript = filepath.Base(found.transcriptPath)
+	}
+
+	// Patches that only exist in the backend are fetched from it
+	if found.patch == nil && item != nil && item.PatchID != "" {
+		patch, err := fetchBackendPatch(cmd.Context(), bundleBackendURL, item.PatchID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: patch %s not found locally and not fetched from backend: %v\n", item.PatchID, err)
+		} else {
+			found.patch = patch
+			found.patchPath = bundleBackendURL
+		}
+	}
+
+	if found.patch != nil {
+		data, err := json.MarshalIndent(found.patch, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal patch: %w", err)
+		}
+		files["patch.json"] = data
+		ts := found.patch.Timestamp.UTC()
+		bm.Provenance.PatchID = found.patch.ID
+		bm.Provenance.PatchFrom = found.patchPath
+		bm.Provenance.PatchTimestamp = &ts
+	}
+
+	for _, patch := range found.supplementary {
+		data, err := json.MarshalIndent(patch, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal patch: %w", err)
+		}
+		files["supplementary/"+patch.ID+".json"] = data
+	}
+
+	if files["transcript.json"] == nil && files["transcript.txt"] == nil && files["patch.json"] == nil {
+		return fmt.Errorf("no transcript or patch found for %s under %s", videoID, bundleDataDir)
+	}
+
+	if err := writeBundle(output, bm, files); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Bundled %s → %s\n", videoID, output)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %s (%d bytes)\n", name, len(files[name]))
+	}
+	return nil
+}
+
+// findVideoArtifacts scans root for a video's metadata, transcript and
+// patches. Paths recorded in the manifest item take precedence.
+func findVideoArtifacts(root, videoID string, item *ManifestItem) (*videoArtifacts, error) {
+	found := &videoArtifacts{}
+	var textTranscripts []string
+	var patches []*Patch
+	patchPaths := make(map[*Patch]string)
+
+	if item != nil && item.AudioPath != "" {
+		info := infoPathFor(item.AudioPath)
+		if _, err := os.Stat(info); err == nil {
+			found.infoPath = info
+		}
+	}
+	if item != nil && item.TranscriptPath != "" {
+		if _, err := os.Stat(item.TranscriptPath); err == nil {
+			found.transcriptPath = item.TranscriptPath
+		}
+	}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		switch {
+		case strings.HasSuffix(name, ".info.json"):
+			if found.infoPath == "" && sidecarVideoID(strings.TrimSuffix(path, ".info.json")) == videoID {
+				found.infoPath = path
+			}
+		case strings.HasSuffix(name, ".preview.json"):
+		case strings.HasSuffix(name, ".json"):
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			var shape map[string]json.RawMessage
+			if json.Unmarshal(data, &shape) != nil {
+				return nil
+			}
+			if _, ok := shape["patch/facts"]; ok {
+				var patch Patch
+				if json.Unmarshal(data, &patch) == nil && patch.SourceID == videoID {
+					patches = append(patches, &patch)
+					patchPaths[&patch] = path
+				}
+			} else if _, ok := shape["transcript"]; ok && found.transcriptPath == "" {
+				var t Transcript
+				if json.Unmarshal(data, &t) == nil && t.VideoID == videoID {
+					found.transcriptPath = path
+				}
+			}
+		case strings.HasSuffix(name, ".txt"):
+			textTranscripts = append(textTranscripts, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+
+	// Text transcripts mirror the audio's name, which may not contain the ID
+	if found.transcriptPath == "" {
+		bases := []string{videoID}
+		if found.infoPath != "" {
+			bases = append(bases, filepath.Base(strings.TrimSuffix(found.infoPath, ".info.json")))
+		}
+		for _, path := range textTranscripts {
+			base := strings.TrimSuffix(filepath.Base(path), ".txt")
+			for _, want := range bases {
+				if base == want {
+					found.transcriptPath = path
+				}
+			}
+		}
+	}
+
+	// The document patch is the one the manifest recorded, else the newest
+	sort.Slice(patches, func(i, j int) bool { return patches[i].Timestamp.After(patches[j].Timestamp) })
+	for _, patch := range patches {
+		if patch.Source != "document" {
+			found.supplementary = append(found.supplementary, patch)
+			continue
+		}
+		if found.patch == nil || (item != nil && patch.ID == item.PatchID) {
+			found.patch = patch
+			found.patchPath = patchPaths[patch]
+		}
+	}
+
+	return found, nil
+}
+
+// fetchBackendPatch reads a stored patch from the backend and converts the
+// Datomic pull result into the CLI's patch form
+func fetchBackendPatch(ctx context.Context, backendURL, patchID string) (*Patch, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", backendURL+"/api/patches/"+patchID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("backend error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	type ref struct {
+		ID json.Number `json:"db/id"`
+	}
+	var pulled struct {
+		Timestamp string `json:"patch/timestamp"`
+		Source    string `json:"patch/source"`
+		SourceID  string `json:"patch/source-id"`
+		Metadata  string `json:"patch/metadata"`
+		Facts     []struct {
+			ID               json.Number `json:"db/id"`
+			Text             string      `json:"claim/text"`
+			Topic            string      `json:"claim/topic"`
+			Confidence       float64     `json:"claim/confidence"`
+			ExtractedFrom    string      `json:"claim/extracted-from"`
+			TimestampInVideo float64     `json:"claim/timestamp-in-video"`
+			ValidFrom        string      `json:"claim/valid-from"`
+			Tags             []string    `json:"claim/tags"`
+		} `json:"claim/_patch"`
+		Edges []struct {
+			ID       json.Number `json:"db/id"`
+			From     ref         `json:"edge/from"`
+			To       ref         `json:"edge/to"`
+			Relation string      `json:"edge/relation"`
+			Strength float64     `json:"edge/strength"`
+		} `json:"edge/_patch"`
+	}
+	if err := json.Unmarshal(body, &pulled); err != nil {
+		return nil, fmt.Errorf("failed to parse patch: %w", err)
+	}
+
+	timestamp, _ := time.Parse(time.RFC3339, pulled.Timestamp)
+	patch := &Patch{
+		ID:        patchID,
+		Timestamp: timestamp,
+		Source:    pulled.Source,
+		SourceID:  pulled.SourceID,
+		Facts:     make([]Fact, 0, len(pulled.Facts)),
+		Edges:     make([]Edge, 0, len(pulled.Edges)),
+	}
+	if pulled.Metadata != "" {
+		// The backend stores metadata as an EDN string
+		patch.Metadata = map[string]interface{}{"backend-metadata": pulled.Metadata}
+	}
+	for _, f := range pulled.Facts {
+		validFrom, _ := time.Parse(time.RFC3339, f.ValidFrom)
+		patch.Facts = append(patch.Facts, Fact{
+			ID:               f.ID.String(),
+			Text:             f.Text,
+			Topic:            f.Topic,
+			Confidence:       f.Confidence,
+			ExtractedFrom:    f.ExtractedFrom,
+			TimestampInVideo: f.TimestampInVideo,
+			ValidFrom:        validFrom,
+			Tags:             f.Tags,
+		})
+	}
+	for _, e := range pulled.Edges {
+		patch.Edges = append(patch.Edges, Edge{
+			ID:       e.ID.String(),
+			From:     e.From.ID.String(),
+			To:       e.To.ID.String(),
+			Relation: e.Relation,
+			Strength: e.Strength,
+		})
+	}
+	return patch, nil
+}
+
+// writeBundle writes bundle.json and files into a zip at path, recording
+// each file's checksum in the manifest
+func writeBundle(path string, bm BundleManifest, files map[string][]byte) error {
+	for name, data := range files {
+		sum := sha256.Sum256(data)
+		bm.Files[name] = hex.EncodeToString(sum[:])
+	}
+	manifestData, err := json.MarshalIndent(bm, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bundle manifest: %w", err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: bm.ExportedAt})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	if err := add("bundle.json", manifestData); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := add(name, files[name]); err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
+
+// bundleMaxFileBytes caps each file read from a bundle, so a crafted zip
+// can't expand into more than it could ever legitimately hold
+const bundleMaxFileBytes = 64 << 20
+
+// readBundle reads a bundle and verifies every file against its checksum.
+// Only bundle.json and the files it lists are read.
+func readBundle(path string) (*BundleManifest, map[string][]byte, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer zr.Close()
+
+	entries := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+	var bm BundleManifest
+	data, err := readBundleFile(entries["bundle.json"])
+	if err == nil {
+		err = json.Unmarshal(data, &bm)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a vkm bundle (bundle.json missing or invalid): %w", err)
+	}
+	if bm.Format > bundleFormat {
+		return nil, nil, fmt.Errorf("bundle format %d is newer than this vkm supports (%d)", bm.Format, bundleFormat)
+	}
+	if bm.VideoID == "" || strings.ContainsAny(bm.VideoID, `/\.`) {
+		return nil, nil, fmt.Errorf("bundle has an invalid video ID %q", bm.VideoID)
+	}
+
+	files := make(map[string][]byte, len(bm.Files))
+	for name, want := range bm.Files {
+		f, ok := entries[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("bundle is missing %s", name)
+		}
+		data, err := readBundleFile(f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s from bundle: %w", name, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != want {
+			return nil, nil, fmt.Errorf("checksum mismatch for %s", name)
+		}
+		files[name] = data
+	}
+	return &bm, files, nil
+}
+
+// readBundleFile reads one file of a bundle, up to bundleMaxFileBytes
+func readBundleFile(f *zip.File) ([]byte, error) {
+	if f == nil {
+		return nil, fmt.Errorf("not found")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, bundleMaxFileBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > bundleMaxFileBytes {
+		return nil, fmt.Errorf("over the %s limit for a bundled file", formatBytes(bundleMaxFileBytes))
+	}
+	return data, nil
+}
+
+func runBundleImport(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	bm, files, err := readBundle(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Importing %s", bm.VideoID)
+	if bm.Title != "" {
+		fmt.Printf(" (%s)", bm.Title)
+	}
+	fmt.Printf(", exported %s\n", bm.ExportedAt.Local().Format("2006-01-02 15:04"))
+
+	// Metadata and transcript land where download and transcribe put them
+	if data, ok := files["info.json"]; ok {
+		path := filepath.Join(bundleDataDir, "videos", bm.VideoID+".info.json")
+		if err := writeImportedFile(path, data); err != nil {
+			return err
+		}
+		fmt.Printf("  ✓ Metadata: %s\n", path)
+	}
+
+	var transcriptPath, plainText string
+	for _, name := range []string{"transcript.json", "transcript.txt"} {
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		transcriptPath = filepath.Join(bundleDataDir, "transcripts", bm.VideoID+filepath.Ext(name))
+		if err := writeImportedFile(transcriptPath, data); err != nil {
+			return err
+		}
+		plainText = string(data)
+		if filepath.Ext(name) == ".json" {
+			var t Transcript
+			if err := json.Unmarshal(data, &t); err == nil {
+				plainText = transcriptText(&t)
+			}
+		}
+		fmt.Printf("  ✓ Transcript: %s\n", transcriptPath)
+		break
+	}
+
+	var sb *sandbox
+	if bundleSandbox {
+		if sb, err = newSandbox(bundleSandboxDir); err != nil {
+			return err
+		}
+	}
+
+	var patchID string
+	var factsCount int
+	if data, ok := files["patch.json"]; ok {
+		var patch Patch
+		if err := json.Unmarshal(data, &patch); err != nil {
+			return fmt.Errorf("failed to parse bundled patch: %w", err)
+		}
+		if patch.Metadata == nil {
+			patch.Metadata = make(map[string]interface{})
+		}
+		patch.Metadata["bundle-patch-id"] = patch.ID
+		patch.Metadata["bundle-exported-at"] = bm.ExportedAt.Format(time.RFC3339)
+		factsCount = len(patch.Facts)
+
+		if sb != nil {
+			patch.Metadata["sandbox-run"] = sb.RunID
+			patch.ID = newUUID()
+			if _, err := sb.SavePatch(patch); err != nil {
+				return err
+			}
+			patchID = patch.ID
+		} else if patchID, err = importPatchToBackend(ctx, bundleBackendURL, patch); err != nil {
+			return err
+		}
+	} else if plainText != "" {
+		fmt.Println("  Bundle has no patch; extracting facts from the transcript")
+		commit := patchCommit{Metadata: map[string]interface{}{"bundle-exported-at": bm.ExportedAt.Format(time.RFC3339)}}
+		if sb != nil {
+			patchID, factsCount, err = extractToSandbox(ctx, sb, plainText, bm.VideoID, commit, nil)
+		} else {
+			pipelineBackendURL = bundleBackendURL
+			patchID, factsCount, err = uploadToBackend(ctx, plainText, bm.VideoID, commit)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if patchID != "" {
+		fmt.Printf("  ✓ Patch: %s (%d facts)\n", patchID, factsCount)
+	}
+
+	// Supplementary patches stay local, as in the pipeline
+	for name, data := range files {
+		if !strings.HasPrefix(name, "supplementary/") {
+			continue
+		}
+		var patch Patch
+		if err := json.Unmarshal(data, &patch); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", name, err)
+			continue
+		}
+		// The bundle's ID names the file, so it is replaced as the main
+		// patch's is; a crafted one could point outside the data directory
+		if patch.Metadata == nil {
+			patch.Metadata = make(map[string]interface{})
+		}
+		patch.Metadata["bundle-patch-id"] = patch.ID
+		patch.ID = newUUID()
+		var path string
+		if sb != nil {
+			patch.Metadata["sandbox-run"] = sb.RunID
+			path, err = sb.SavePatch(patch)
+		} else {
+			dir := filepath.Join(bundleDataDir, "supplementary")
+			if err = os.MkdirAll(dir, 0755); err == nil {
+				path, err = savePatchFile(dir, patch)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  ✓ Supplementary: %s\n", path)
+	}
+
+	// Sandbox imports stay out of the manifest, like sandbox pipeline runs
+	if sb == nil && patchID != "" {
+		manifest, err := openManifest(bundleManifest)
+		if err != nil {
+			return err
+		}
+		defer manifest.Close()
+		recordItem(manifest, ManifestItem{
+			URL:            bm.URL,
+			VideoID:        bm.VideoID,
+			State:          ItemProcessed,
+			TranscriptPath: transcriptPath,
+			PatchID:        patchID,
+		})
+	}
+
+	fmt.Println("Import complete!")
+	return nil
+}
+
+// writeImportedFile writes data to path, creating parent directories
+func writeImportedFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// importPatchToBackend stores a pre-built patch through /api/patches and
+// returns the backend's ID for it
+func importPatchToBackend(ctx context.Context, backendURL string, patch Patch) (string, error) {
+	reqBody, err := json.Marshal(patch)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal patch: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", backendURL+"/api/patches", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("backend error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		PatchID json.Number `json:"patch-id"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	return result.PatchID.String(), nil
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCaptionLangs selects English manual or automatic captions
+const defaultCaptionLangs = "en.*,en"
+
+// transcriptFromCaptions is the manifest's transcript model for
+// transcripts built from YouTube captions
+const transcriptFromCaptions = "youtube-captions"
+
+// captionTranscript fetches a video's captions with yt-dlp and converts them
+// to a Transcript saved as JSON in dir, with the video's .info.json beside
+// it, both named with names. It returns nil media when the video has no
+// captions in langs, so callers can fall back to audio and Whisper.
+func captionTranscript(ctx context.Context, item pipelineItem, dir, langs string, names *nameTemplate) (*downloadedMedia, *Transcript, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp, err := newTempDir("captions-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	args := []string{
+		"--skip-download", "--write-subs", "--write-auto-subs",
+		"--sub-langs", langs, "--sub-format", "vtt",
+		"--write-info-json", "--windows-filenames",
+		"--quiet", "--no-playlist",
+		"--output", filepath.Join(toolPath(tmp), "%(id)s.%(ext)s"),
+	}
+	args = append(append(args, sponsorBlockArgs()...), "--", item.URL)
+	var stderr bytes.Buffer
+	c, cleanup := ytDlpCommand(ctx, args...)
+	defer cleanup()
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, fmt.Errorf("failed to fetch captions: %w", ytDlpError(err, stderr.String()))
+	}
+
+	infos, _ := filepath.Glob(filepath.Join(tmp, "*.info.json"))
+	if len(infos) == 0 {
+		return nil, nil, fmt.Errorf("yt-dlp wrote no metadata for %s", item.URL)
+	}
+	info, err := loadVideoMetadata(infos[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	fields := nameFieldsFromInfo(info)
+	if fields.PlaylistIndex == 0 {
+		fields.PlaylistIndex = item.PlaylistIndex
+	}
+
+	// yt-dlp prefers manual captions to automatic ones in the same
+	// language; with several languages the first by name wins
+	vtts, _ := filepath.Glob(filepath.Join(tmp, "*.vtt"))
+	if len(vtts) == 0 {
+		return nil, nil, nil
+	}
+	sort.Strings(vtts)
+	data, err := os.ReadFile(vtts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	segments := dropRemovedCues(parseVTT(string(data)), removedSegments(info))
+	if len(segments) == 0 {
+		return nil, nil, nil
+	}
+
+	transcript := &Transcript{
+		VideoID:    fields.ID,
+		Title:      fields.Title,
+		Language:   captionLanguage(vtts[0]),
+		Transcript: segments,
+	}
+	if published := publishedAtFromInfo(info); !published.IsZero() {
+		transcript.PublishedAt = published.Format(time.RFC3339)
+	}
+	assignChapters(transcript, chaptersFromInfo(info))
+
+	out, err := json.MarshalIndent(transcript, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal transcript: %w", err)
+	}
+	media := &downloadedMedia{
+		VideoID:  fields.ID,
+		Path:     filepath.Join(dir, fields.ID+".json"),
+		InfoPath: filepath.Join(dir, fields.ID+".info.json"),
+		Captions: true,
+	}
+	if err := os.WriteFile(media.Path, out, 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to write transcript: %w", err)
+	}
+	if err := moveFile(infos[0], media.InfoPath); err != nil {
+		return nil, nil, fmt.Errorf("failed to save metadata: %w", err)
+	}
+	if err := applyNameTemplate(names, dir, media, fields); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return media, transcript, nil
+}
+
+// dropRemovedCues drops the caption cues centered in SponsorBlock
+// segments, which skipping the download left in the captions
+func dropRemovedCues(cues []TranscriptSegment, removed []sponsorSegment) []TranscriptSegment {
+	if len(removed) == 0 {
+		return cues
+	}
+	kept := cues[:0]
+	for _, c := range cues {
+		if !insideSegments(c.Timestamp+c.Duration/2, removed) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// captionLanguage reads the language code from a yt-dlp subtitle file
+// name (<id>.<lang>.vtt)
+func captionLanguage(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".vtt")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// parseVTT converts WebVTT cues into transcript segments. Automatic
+// captions show each line twice as it scrolls up, so lines already
+// emitted by the previous cue are dropped, along with the near-zero
+// cues YouTube inserts between them.
+func parseVTT(vtt string) []TranscriptSegment {
+	var segments []TranscriptSegment
+	last := ""
+	lines := strings.Split(strings.ReplaceAll(vtt, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		start, end, ok := parseVTTTiming(lines[i])
+		if !ok {
+			continue
+		}
+
+		var text []string
+		// Auto captions pad cues with whitespace-only lines; only an
+		// empty line ends a cue
+		for i++; i < len(lines) && lines[i] != ""; i++ {
+			line := strings.TrimSpace(vttTagPattern.ReplaceAllString(lines[i], ""))
+			if line == "" || line == last {
+				continue
+			}
+			text = append(text, line)
+			last = line
+		}
+		if len(text) == 0 || end-start < 0.05 {
+			continue
+		}
+		segments = append(segments, TranscriptSegment{
+			Timestamp: start,
+			Text:      strings.Join(text, " "),
+			Duration:  end - start,
+		})
+	}
+	return segments
+}
+
+// parseVTTTiming parses a cue timing line ("00:01:02.500 --> 00:01:04.000
+// align:start") into seconds
+func parseVTTTiming(line string) (start, end float64, ok bool) {
+	from, rest, found := strings.Cut(line, "-->")
+	if !found {
+		return 0, 0, false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return 0, 0, false
+	}
+	start, err1 := parseVTTTimestamp(strings.TrimSpace(from))
+	end, err2 := parseVTTTimestamp(fields[0])
+	if err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// parseVTTTimestamp parses hh:mm:ss.ttt or mm:ss.ttt into seconds
+func parseVTTTimestamp(ts string) (float64, error) {
+	parts := strings.Split(ts, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", ts)
+	}
+	var seconds float64
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", ts)
+		}
+		seconds = seconds*60 + v
+	}
+	return seconds, nil
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ListCmd queries the catalog of downloaded and processed media
+var ListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List downloaded and processed media from the manifest",
+	Long: `List the media vkm has downloaded, transcribed or processed.
+
+Every stage records what it learned about an item in the manifest: its
+state, the files it saved, and the title, channel and publish date from
+its metadata. 'vkm list' queries that catalog, so finding a video never
+means globbing the output directories.
+
+--collection lists the items ingested under a collection (the
+--collection of the downloading or ingesting command). --channel and
+--title match case-insensitively anywhere in the name, and
+--since/--until bound the publish date (YYYY-MM-DD, inclusive). Items
+recorded before the catalog existed have no title, channel or date until
+a stage touches them again.
+
+Examples:
+  vkm list --state processed
+  vkm list --channel "lex fridman" --since 2024-01-01
+  vkm list --title transformer --paths
+  vkm list --collection scaling-laws --state processed`,
+	RunE: runList,
+}
+
+var (
+	listManifest   string
+	listState      string
+	listCollection string
+	listChannel    string
+	listTitle      string
+	listSince      string
+	listUntil      string
+	listLimit      int
+	listPaths      bool
+)
+
+func init() {
+	ListCmd.Flags().StringVar(&listManifest, "manifest", "data/manifest.db", "SQLite manifest holding the catalog")
+	ListCmd.Flags().StringVar(&listState, "state", "", "Only list items in this state (pending, downloaded, transcribed, processed, failed, canceled)")
+	ListCmd.Flags().StringVar(&listCollection, "collection", "", "Only list items in this collection")
+	ListCmd.Flags().StringVar(&listChannel, "channel", "", "Only list items whose channel contains this text")
+	ListCmd.Flags().StringVar(&listTitle, "title", "", "Only list items whose title contains this text")
+	ListCmd.Flags().StringVar(&listSince, "since", "", "Only list items published on or after this date (YYYY-MM-DD)")
+	ListCmd.Flags().StringVar(&listUntil, "until", "", "Only list items published on or before this date (YYYY-MM-DD)")
+	ListCmd.Flags().IntVar(&listLimit, "limit", 100, "Maximum items to list (0 for all)")
+	ListCmd.Flags().BoolVar(&listPaths, "paths", false, "Show audio and transcript paths instead of the URL")
+}
+
+// catalogFilter selects items from the catalog; empty fields match all
+type catalogFilter struct {
+	State      string
+	Collection string
+	Channel    string
+	Title      string
+	// Since and Until bound the publish date, as YYYY-MM-DD
+	Since string
+	Until string
+	Limit int
+}
+
+// CatalogItems returns the items matching f, most recently published
+// first, with undated items last
+func (m *Manifest) CatalogItems(f catalogFilter) ([]*ManifestItem, error) {
+	var where []string
+	var args []interface{}
+	if f.State != "" {
+		where = append(where, "state = ?")
+		args = append(args, f.State)
+	}
+	if f.Collection != "" {
+		where = append(where, "collection = ?")
+		args = append(args, f.Collection)
+	}
+	if f.Channel != "" {
+		where = append(where, "channel LIKE ? ESCAPE '\\'")
+		args = append(args, likePattern(f.Channel))
+	}
+	if f.Title != "" {
+		where = append(where, "title LIKE ? ESCAPE '\\'")
+		args = append(args, likePattern(f.Title))
+	}
+	if f.Since != "" {
+		where = append(where, "published >= ?")
+		args = append(args, f.Since)
+	}
+	if f.Until != "" {
+		where = append(where, "published <= ?")
+		args = append(args, f.Until)
+	}
+
+	query := "SELECT " + manifestItemColumns + " FROM items"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY published IS NULL, published DESC, updated_at DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query catalog: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*ManifestItem
+	for rows.Next() {
+		item, err := scanManifestItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query catalog: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// likePattern matches text anywhere in a column with LIKE, which SQLite
+// compares case-insensitively for ASCII
+func likePattern(text string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+	return "%" + escaped + "%"
+}
+
+// withCatalog fills in the item's catalog fields from the info.json at
+// infoPath. Unreadable metadata leaves them empty, so the stored values
+// are kept.
+func withCatalog(item ManifestItem, infoPath string) ManifestItem {
+	if infoPath == "" {
+		return item
+	}
+	info, err := loadVideoMetadata(infoPath)
+	if err != nil {
+		return item
+	}
+	f := nameFieldsFromInfo(info)
+	item.Title, item.Channel, item.Published = f.Title, f.Channel, f.Date
+	item.InfoPath = infoPath
+	if item.VideoID == "" {
+		item.VideoID = f.ID
+	}
+	return item
+}
+
+// itemMetadataPath returns where the item's info.json is, from the
+// catalog or else beside its audio or transcript
+func itemMetadataPath(item *ManifestItem) string {
+	if item.InfoPath != "" {
+		return item.InfoPath
+	}
+	return itemInfoPath(item)
+}
+
+// GetVideoInfo extracts useful metadata for a video in the manifest m.
+// Besides the info.json fields, "thumbnail_path" and "description_path"
+// name the thumbnail and description files saved beside it, and
+// "description" falls back to the description file's text.
+func GetVideoInfo(m *Manifest, videoID string) (map[string]interface{}, error) {
+	item, err := m.ItemByVideoID(videoID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || itemMetadataPath(item) == "" {
+		return nil, fmt.Errorf("metadata not found for video %s", videoID)
+	}
+	infoPath := itemMetadataPath(item)
+
+	info, err := loadVideoMetadata(infoPath)
+	if err != nil {
+		return nil, err
+	}
+	media := &downloadedMedia{VideoID: videoID, InfoPath: infoPath}
+	findSidecars(media)
+	if media.ThumbnailPath != "" {
+		info["thumbnail_path"] = media.ThumbnailPath
+	}
+	if media.DescriptionPath != "" {
+		info["description_path"] = media.DescriptionPath
+		if d, _ := info["description"].(string); d == "" {
+			if data, err := os.ReadFile(media.DescriptionPath); err == nil {
+				info["description"] = string(data)
+			}
+		}
+	}
+	return info, nil
+}
+
+// ListDownloadedVideos lists the audio of every video in the manifest m
+// that is still on disk
+func ListDownloadedVideos(m *Manifest) ([]string, error) {
+	items, err := m.Items()
+	if err != nil {
+		return nil, err
+	}
+	var videos []string
+	for _, item := range items {
+		if item.AudioPath != "" && fileExists(item.AudioPath) {
+			videos = append(videos, item.AudioPath)
+		}
+	}
+	return videos, nil
+}
+
+// shortTitle cuts long titles so the table stays readable
+func shortTitle(title string) string {
+	runes := []rune(title)
+	if len(runes) <= 60 {
+		return title
+	}
+	return string(runes[:59]) + "…"
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	for _, date := range []string{listSince, listUntil} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return fmt.Errorf("invalid date %q (use YYYY-MM-DD)", date)
+		}
+	}
+
+	manifest, err := openManifest(listManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	items, err := manifest.CatalogItems(catalogFilter{
+		State:      listState,
+		Collection: listCollection,
+		Channel:    listChannel,
+		Title:      listTitle,
+		Since:      listSince,
+		Until:      listUntil,
+		Limit:      listLimit,
+	})
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Println("No matching items")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if listPaths {
+		fmt.Fprintln(w, "ID\tSTATE\tTITLE\tAUDIO\tTRANSCRIPT")
+	} else {
+		fmt.Fprintln(w, "ID\tSTATE\tCOLLECTION\tPUBLISHED\tCHANNEL\tTITLE\tURL")
+	}
+	for _, item := range items {
+		title := shortTitle(orDefault(item.Title, "-"))
+		if listPaths {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", orDefault(item.VideoID, "-"), item.State, title,
+				orDefault(item.AudioPath, "-"), orDefault(item.TranscriptPath, "-"))
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", orDefault(item.VideoID, "-"), item.State,
+			orDefault(item.Collection, "-"), orDefault(item.Published, "-"), orDefault(item.Channel, "-"), title, item.URL)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Chapter is a titled span of a video, from its chapter markers
+type Chapter struct {
+	Title string  `json:"title"`
+	Start float64 `json:"start"`
+	// End is 0 for a last chapter of unknown length
+	End float64 `json:"end,omitempty"`
+}
+
+// chapterLinePattern matches a chapter marker line of a video
+// description: a timestamp, optionally bracketed or bulleted, then a
+// title ("0:00 Intro", "(12:30) - Results", "1:02:03 | Q&A")
+var chapterLinePattern = regexp.MustCompile(`^\s*(?:[-•*]\s*)?[(\[]?((?:\d{1,2}:)?\d{1,2}:\d{2})[)\]]?\s*(?:[-–—:|]\s*)?(\S.*)$`)
+
+// minChapterLength is YouTube's shortest chapter; timestamp lists with
+// shorter gaps are not chapters
+const minChapterLength = 10
+
+// chaptersFromInfo reads a video's chapters from its info.json: yt-dlp's
+// "chapters" (or those 'vkm download' saves), with consecutive chapters of
+// the same title merged, else the chapter markers in its description
+func chaptersFromInfo(info map[string]interface{}) []Chapter {
+	var chapters []Chapter
+	raw, _ := info["chapters"].([]interface{})
+	for _, c := range raw {
+		ch, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		title, _ := ch["title"].(string)
+		start, ok := ch["start_time"].(float64)
+		if !ok {
+			start, _ = ch["start"].(float64)
+		}
+		end, ok := ch["end_time"].(float64)
+		if !ok {
+			end, _ = ch["end"].(float64)
+		}
+		title = strings.TrimSpace(title)
+		// Twitch VODs get a chapter each time the streamer switches
+		// category, so the same game can follow itself
+		if n := len(chapters); n > 0 && title != "" && chapters[n-1].Title == title && (chapters[n-1].End == 0 || chapters[n-1].End >= start) {
+			chapters[n-1].End = end
+			continue
+		}
+		chapters = append(chapters, Chapter{Title: title, Start: start, End: end})
+	}
+	if len(chapters) > 0 {
+		return chapters
+	}
+
+	description, _ := info["description"].(string)
+	duration, _ := info["duration"].(float64)
+	return chaptersFromDescription(description, duration)
+}
+
+// chaptersFromDescription parses the chapter markers of a video
+// description the way YouTube does: at least three timestamped lines,
+// the first at 0:00, in order and at least minChapterLength seconds
+// apart. Anything else is an ordinary list of timestamps, and yields none.
+func chaptersFromDescription(description string, duration float64) []Chapter {
+	var chapters []Chapter
+	for _, line := range strings.Split(description, "\n") {
+		m := chapterLinePattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		start := parseChapterTime(m[1])
+		if len(chapters) == 0 && start != 0 {
+			continue
+		}
+		if n := len(chapters); n > 0 && start < chapters[n-1].Start+minChapterLength {
+			return nil
+		}
+		chapters = append(chapters, Chapter{Title: strings.TrimSpace(m[2]), Start: start})
+	}
+	if len(chapters) < 3 {
+		return nil
+	}
+	for i := range chapters {
+		if i+1 < len(chapters) {
+			chapters[i].End = chapters[i+1].Start
+		} else if duration > chapters[i].Start {
+			chapters[i].End = duration
+		}
+	}
+	return chapters
+}
+
+// parseChapterTime converts m:ss or h:mm:ss to seconds
+func parseChapterTime(s string) float64 {
+	var seconds float64
+	for _, part := range strings.Split(s, ":") {
+		n, _ := strconv.Atoi(part)
+		seconds = seconds*60 + float64(n)
+	}
+	return seconds
+}
+
+// chapterAt returns the chapter playing at t seconds into the video, or nil
+func chapterAt(chapters []Chapter, t float64) *Chapter {
+	for i := len(chapters) - 1; i >= 0; i-- {
+		if t >= chapters[i].Start {
+			if chapters[i].End > 0 && t >= chapters[i].End {
+				return nil
+			}
+			return &chapters[i]
+		}
+	}
+	return nil
+}
+
+// assignChapters records chapters in t and labels each segment with the
+// chapter it starts in
+func assignChapters(t *Transcript, chapters []Chapter) {
+	if len(chapters) == 0 {
+		return
+	}
+	t.Chapters = chapters
+	for i := range t.Transcript {
+		if c := chapterAt(chapters, t.Transcript[i].Timestamp); c != nil {
+			t.Transcript[i].Chapter = c.Title
+		}
+	}
+}
+
+// chapterSection is the transcript text of one chapter
+type chapterSection struct {
+	Chapter Chapter
+	Text    string
+}
+
+// chapterSections splits a transcript with chapters into them, in order,
+// leaving out chapters without speech. Segments before the first chapter
+// join it and those past the last one's end join the last. It returns
+// nil for transcripts without chapters.
+func chapterSections(t *Transcript) []chapterSection {
+	if t == nil || len(t.Chapters) == 0 {
+		return nil
+	}
+	texts := make([][]string, len(t.Chapters))
+	for _, seg := range t.Transcript {
+		i := 0
+		for j, c := range t.Chapters {
+			if seg.Timestamp >= c.Start {
+				i = j
+			}
+		}
+		texts[i] = append(texts[i], seg.Text)
+	}
+	var sections []chapterSection
+	for i, c := range t.Chapters {
+		if len(texts[i]) > 0 {
+			sections = append(sections, chapterSection{Chapter: c, Text: strings.Join(texts[i], " ")})
+		}
+	}
+	return sections
+}
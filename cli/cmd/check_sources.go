@@ -0,0 +1,354 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// CheckSourcesCmd checks that the videos behind local patches still exist
+var CheckSourcesCmd = &cobra.Command{
+	Use:   "check-sources",
+	Short: "Check that source videos are still online",
+	Long: `Check whether the YouTube videos that local patches under --data were
+extracted from are still available, and record the result, along with the
+source's license (see 'vkm licenses'), in each patch's metadata:
+
+  available  public and playable
+  at-risk    still playable but unlisted, age-restricted, members-only
+             or blocked in some regions, and so likely to disappear
+  private    made private by the uploader
+  removed    deleted, rejected or taken down
+
+With YOUTUBE_API_KEY set, videos are looked up 50 at a time through the
+Data API (1 quota unit per lookup); videos it doesn't return, and all
+videos without a key, are checked one by one with yt-dlp. Sources checked
+within --recheck-after are skipped.
+
+With --archive, the audio of at-risk sources is downloaded to
+--archive-dir while it still can be, unless the manifest shows it is
+already on disk.
+
+Examples:
+  vkm check-sources
+  vkm check-sources --archive --recheck-after 0`,
+	RunE: runCheckSources,
+}
+
+var (
+	checkDataDir      string
+	checkManifest     string
+	checkArchive      bool
+	checkArchiveDir   string
+	checkRecheckAfter time.Duration
+)
+
+func init() {
+	CheckSourcesCmd.Flags().StringVar(&checkDataDir, "data", "data", "Directory holding local patches")
+	CheckSourcesCmd.Flags().StringVar(&checkManifest, "manifest", "data/manifest.db", "SQLite manifest of downloads and API quota")
+	CheckSourcesCmd.Flags().BoolVar(&checkArchive, "archive", false, "Download audio of at-risk sources")
+	CheckSourcesCmd.Flags().StringVar(&checkArchiveDir, "archive-dir", "data/archive", "Directory for archived audio")
+	CheckSourcesCmd.Flags().DurationVar(&checkRecheckAfter, "recheck-after", 24*time.Hour, "Skip sources checked more recently than this (0 = check all)")
+}
+
+// Source availability statuses
+const (
+	sourceAvailable = "available"
+	sourceAtRisk    = "at-risk"
+	sourcePrivate   = "private"
+	sourceRemoved   = "removed"
+)
+
+// Patch metadata keys written by check-sources
+const (
+	metaSourceStatus    = "source-status"
+	metaSourceReason    = "source-status-reason"
+	metaSourceCheckedAt = "source-checked-at"
+	metaSourceArchive   = "source-archive"
+)
+
+// sourceStatus is the availability of one source video
+type sourceStatus struct {
+	VideoID string
+	Status  string
+	Reason  string
+	// License is the video's license, when the lookup reported it
+	License *sourceLicense
+}
+
+// youtubeIDPattern matches the source IDs of patches extracted from videos
+var youtubeIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+func runCheckSources(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if err := checkYtDlpInstalled(); err != nil {
+		return err
+	}
+
+	files, err := loadLocalPatchFiles(checkDataDir)
+	if err != nil {
+		return err
+	}
+	manifest, err := openManifest(checkManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	// Patch files per source video, and the videos due for a check
+	bySource := make(map[string][]localPatchFile)
+	var due []string
+	now := time.Now().UTC()
+	for _, f := range files {
+		id := f.Patch.SourceID
+		if !youtubeIDPattern.MatchString(id) {
+			continue
+		}
+		if _, seen := bySource[id]; !seen && !checkedSince(f.Patch, now.Add(-checkRecheckAfter)) {
+			due = append(due, id)
+		}
+		bySource[id] = append(bySource[id], f)
+	}
+	sort.Strings(due)
+	fmt.Printf("%d source videos, %d due for a check\n", len(bySource), len(due))
+	if len(due) == 0 {
+		return nil
+	}
+
+	statuses, err := lookupSourceStatuses(ctx, manifest, due)
+	if err != nil {
+		return err
+	}
+
+	var names *nameTemplate
+	if checkArchive {
+		if names, err = parseNameTemplate(defaultNameTemplate); err != nil {
+			return err
+		}
+	}
+
+	counts := make(map[string]int)
+	unknown := 0
+	var affected []sourceStatus
+	for _, id := range due {
+		s, ok := statuses[id]
+		if !ok {
+			unknown++
+			continue
+		}
+		counts[s.Status]++
+
+		archived := ""
+		if checkArchive && s.Status == sourceAtRisk {
+			archived = archiveSource(ctx, manifest, id, names)
+		}
+		for _, f := range bySource[id] {
+			markSourceStatus(f.Patch, s, now, archived)
+			if err := writePatchFile(f.Path, *f.Patch); err != nil {
+				return err
+			}
+		}
+		if s.Status != sourceAvailable {
+			affected = append(affected, s)
+		}
+	}
+
+	if len(affected) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "\nVIDEO\tSTATUS\tREASON\tPATCHES")
+		for _, s := range affected {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", s.VideoID, s.Status, s.Reason, len(bySource[s.VideoID]))
+		}
+		w.Flush()
+	}
+
+	fmt.Printf("\n%d available, %d at risk, %d private, %d removed",
+		counts[sourceAvailable], counts[sourceAtRisk], counts[sourcePrivate], counts[sourceRemoved])
+	if unknown > 0 {
+		fmt.Printf(", %d could not be checked", unknown)
+	}
+	fmt.Println()
+	return ctx.Err()
+}
+
+// checkedSince reports whether p's source was checked after t
+func checkedSince(p *Patch, t time.Time) bool {
+	checked, _ := p.Metadata[metaSourceCheckedAt].(string)
+	at, err := time.Parse(time.RFC3339, checked)
+	return err == nil && at.After(t)
+}
+
+// markSourceStatus records a check result in p's metadata
+func markSourceStatus(p *Patch, s sourceStatus, at time.Time, archived string) {
+	if p.Metadata == nil {
+		p.Metadata = make(map[string]interface{})
+	}
+	p.Metadata[metaSourceStatus] = s.Status
+	p.Metadata[metaSourceCheckedAt] = at.Format(time.RFC3339)
+	if s.Reason != "" {
+		p.Metadata[metaSourceReason] = s.Reason
+	} else {
+		delete(p.Metadata, metaSourceReason)
+	}
+	if archived != "" {
+		p.Metadata[metaSourceArchive] = archived
+	}
+	if s.License != nil {
+		setPatchLicense(p, *s.License)
+	}
+}
+
+// lookupSourceStatuses checks videos through the Data API when a key is
+// set and quota remains, and with yt-dlp otherwise. Videos that could not
+// be checked are missing from the result.
+func lookupSourceStatuses(ctx context.Context, m *Manifest, ids []string) (map[string]sourceStatus, error) {
+	statuses := make(map[string]sourceStatus)
+	remaining := ids
+
+	if key := youtubeAPIKey(); key != "" {
+		client, err := newYouTubeDataClient(ctx, key, m)
+		if err != nil {
+			return nil, err
+		}
+		var missing []string
+		for i := 0; i < len(ids); i += 50 {
+			chunk := ids[i:min(i+50, len(ids))]
+			found, err := client.VideoAvailability(ctx, chunk)
+			if err != nil {
+				if ctx.Err() != nil {
+					return statuses, ctx.Err()
+				}
+				if !errors.Is(err, errQuotaExhausted) {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+				// Fall back to yt-dlp for everything not looked up yet
+				missing = append(missing, ids[i:]...)
+				break
+			}
+			for _, id := range chunk {
+				if s, ok := found[id]; ok {
+					statuses[id] = s
+				} else {
+					missing = append(missing, id)
+				}
+			}
+		}
+		remaining = missing
+	}
+
+	for i, id := range remaining {
+		if ctx.Err() != nil {
+			return statuses, ctx.Err()
+		}
+		fmt.Printf("[%d/%d] Checking %s with yt-dlp\n", i+1, len(remaining), id)
+		s, err := checkSourceWithYtDlp(ctx, id)
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", id, err)
+			}
+			continue
+		}
+		statuses[id] = s
+	}
+	return statuses, nil
+}
+
+// ytDlpUnavailable maps fragments of yt-dlp error messages to statuses.
+// Checked in order; the first match wins.
+var ytDlpUnavailable = []struct {
+	fragment, status, reason string
+}{
+	{"Private video", sourcePrivate, "private"},
+	{"account associated with this video has been terminated", sourceRemoved, "channel terminated"},
+	{"copyright claim", sourceRemoved, "copyright claim"},
+	{"violating YouTube's", sourceRemoved, "removed for policy violation"},
+	{"removed by the uploader", sourceRemoved, "removed by the uploader"},
+	{"Video unavailable", sourceRemoved, "unavailable"},
+	{"Sign in to confirm your age", sourceAtRisk, "age-restricted"},
+	{"members-only", sourceAtRisk, "members-only"},
+	{"Join this channel", sourceAtRisk, "members-only"},
+	{"not made this video available in your country", sourceAtRisk, "blocked in some regions"},
+}
+
+// checkSourceWithYtDlp asks yt-dlp for a video's metadata. Errors that
+// identify the video as gone are statuses; anything else (network
+// trouble, say) is returned as an error.
+func checkSourceWithYtDlp(ctx context.Context, videoID string) (sourceStatus, error) {
+	s := sourceStatus{VideoID: videoID}
+	var stdout, stderr bytes.Buffer
+	c, cleanup := ytDlpCommand(ctx, "--skip-download", "--dump-single-json", "--no-playlist",
+		"--no-warnings", "https://www.youtube.com/watch?v="+videoID)
+	defer cleanup()
+	c.Stdout, c.Stderr = &stdout, &stderr
+
+	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			return s, ctx.Err()
+		}
+		msg := stderr.String()
+		for _, u := range ytDlpUnavailable {
+			if strings.Contains(msg, u.fragment) {
+				s.Status, s.Reason = u.status, u.reason
+				return s, nil
+			}
+		}
+		return s, fmt.Errorf("yt-dlp failed: %w", ytDlpError(err, msg))
+	}
+
+	var info struct {
+		Availability string `json:"availability"`
+		AgeLimit     int    `json:"age_limit"`
+		License      string `json:"license"`
+		Extractor    string `json:"extractor_key"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		return s, fmt.Errorf("failed to parse yt-dlp metadata: %w", err)
+	}
+	if l, ok := licenseFromYtDlp(info.License, info.Extractor); ok {
+		s.License = &l
+	}
+	switch info.Availability {
+	case "private":
+		s.Status, s.Reason = sourcePrivate, "private"
+	case "unlisted", "needs_auth", "subscriber_only", "premium_only":
+		s.Status, s.Reason = sourceAtRisk, strings.ReplaceAll(info.Availability, "_", "-")
+	default:
+		s.Status = sourceAvailable
+		if info.AgeLimit >= 18 {
+			s.Status, s.Reason = sourceAtRisk, "age-restricted"
+		}
+	}
+	return s, nil
+}
+
+// archiveSource downloads a source's audio to the archive directory and
+// returns its path, or "" if it could not. Sources 'vkm clean' pruned
+// are downloaded again, as their audio is gone.
+func archiveSource(ctx context.Context, m *Manifest, videoID string, names *nameTemplate) string {
+	item := pipelineItem{URL: "https://www.youtube.com/watch?v=" + videoID, VideoID: videoID}
+	if prev, err := m.ItemByVideoID(videoID); err == nil && prev != nil {
+		item.URL = prev.URL
+	}
+
+	media, skipped, err := resumeDownload(ctx, ytDlpDownloader{Transcode: transcodeOptions{Format: audioFormat}}, m, item, checkArchiveDir, "", names, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to archive %s: %v\n", videoID, err)
+		return ""
+	}
+	if skipped {
+		fmt.Printf("  ✓ %s already on disk: %s\n", videoID, media.Path)
+	} else {
+		fmt.Printf("  ✓ Archived %s: %s\n", videoID, media.Path)
+	}
+	return media.Path
+}
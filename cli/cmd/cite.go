@@ -0,0 +1,383 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// CiteCmd formats citations of facts' sources
+var CiteCmd = &cobra.Command{
+	Use:   "cite <fact-id|query>",
+	Short: "Cite the source video and timestamp of facts (BibTeX, CSL-JSON)",
+	Long: `Generate citations for papers written from graph-derived knowledge. Each
+points to the fact's source: its video, channel, publish date, and a link
+to the timestamp of the segment the fact was extracted from.
+
+The argument is a fact ID, or else a query: the facts whose claims
+contain every word of it are cited, most confident first, up to --limit.
+Rejected and merged facts are never cited.
+
+Sources are described from the manifest's catalog (title, channel,
+publish date), falling back to the patch's metadata. YouTube links jump
+to the timestamp with &t=; other links get a #t= media fragment.
+
+Formats (--format):
+  bibtex    @misc entries for LaTeX (\usepackage{url} for the links)
+  csl-json  CSL-JSON items for Zotero, Pandoc and other CSL processors
+
+Examples:
+  vkm cite fact-3f2a9c
+  vkm cite "scaling laws" --limit 3
+  vkm cite "mixture of experts" --format csl-json -o refs.json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCite,
+}
+
+var (
+	citeFormat   string
+	citeDataDir  string
+	citeManifest string
+	citeLimit    int
+	citeOutput   string
+)
+
+// Citation formats
+const (
+	citeFormatBibTeX  = "bibtex"
+	citeFormatCSLJSON = "csl-json"
+)
+
+func init() {
+	CiteCmd.Flags().StringVar(&citeFormat, "format", citeFormatBibTeX, "Citation format (bibtex, csl-json)")
+	CiteCmd.Flags().StringVar(&citeDataDir, "data", "data", "Directory holding local patches")
+	CiteCmd.Flags().StringVar(&citeManifest, "manifest", "data/manifest.db", "SQLite manifest cataloging sources")
+	CiteCmd.Flags().IntVar(&citeLimit, "limit", 5, "Most facts a query cites")
+	CiteCmd.Flags().StringVarP(&citeOutput, "output", "o", "", "Write citations to this file instead of stdout")
+}
+
+// citation is a fact with the source it is cited from
+type citation struct {
+	Key       string
+	Fact      Fact
+	Title     string
+	Channel   string
+	Site      string
+	URL       string
+	Published time.Time
+	Accessed  time.Time
+}
+
+func runCite(cmd *cobra.Command, args []string) error {
+	if citeFormat != citeFormatBibTeX && citeFormat != citeFormatCSLJSON {
+		return fmt.Errorf("unknown format %q (use %s or %s)", citeFormat, citeFormatBibTeX, citeFormatCSLJSON)
+	}
+	if citeLimit <= 0 {
+		return fmt.Errorf("--limit must be positive")
+	}
+
+	patches, err := loadLocalPatches(citeDataDir)
+	if err != nil {
+		return err
+	}
+	manifest, err := openManifest(citeManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	found := citedFacts(patches, args[0], citeLimit)
+	if len(found) == 0 {
+		return fmt.Errorf("no fact with ID %q or matching it as a query", args[0])
+	}
+
+	keys := make(map[string]int)
+	var cites []citation
+	for _, pf := range found {
+		c, err := citeFact(manifest, pf.Patch, pf.Fact)
+		if err != nil {
+			return err
+		}
+		c.Key = citationKey(c, keys)
+		cites = append(cites, c)
+	}
+
+	var out string
+	if citeFormat == citeFormatCSLJSON {
+		var buf strings.Builder
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(cslItems(cites)); err != nil {
+			return fmt.Errorf("failed to marshal citations: %w", err)
+		}
+		out = buf.String()
+	} else {
+		var entries []string
+		for _, c := range cites {
+			entries = append(entries, bibtexEntry(c))
+		}
+		out = strings.Join(entries, "\n")
+	}
+
+	if citeOutput == "" {
+		fmt.Print(out)
+		return nil
+	}
+	if err := os.WriteFile(citeOutput, []byte(out), 0644); err != nil {
+		return fmt.Errorf("failed to write citations: %w", err)
+	}
+	fmt.Printf("✓ Wrote %d citation(s) to %s\n", len(cites), citeOutput)
+	return nil
+}
+
+// patchFact is a fact and the patch holding it
+type patchFact struct {
+	Patch *Patch
+	Fact  Fact
+}
+
+// citedFacts returns the live fact with ID arg, or else up to limit live
+// facts whose text contains every word of arg, most confident first
+func citedFacts(patches []*Patch, arg string, limit int) []patchFact {
+	var matches []patchFact
+	words := strings.Fields(strings.ToLower(arg))
+	for _, p := range patches {
+		for _, f := range p.Facts {
+			if f.Retired() {
+				continue
+			}
+			if f.ID == arg {
+				return []patchFact{{p, f}}
+			}
+			text := strings.ToLower(f.Text)
+			all := len(words) > 0
+			for _, w := range words {
+				if !strings.Contains(text, w) {
+					all = false
+					break
+				}
+			}
+			if all {
+				matches = append(matches, patchFact{p, f})
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Fact.Confidence > matches[j].Fact.Confidence })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// citeFact describes the source of a fact from the manifest's catalog,
+// else from its patch's metadata
+func citeFact(m *Manifest, p *Patch, f Fact) (citation, error) {
+	c := citation{Fact: f, Accessed: time.Now()}
+	c.Title, _ = p.Metadata["title"].(string)
+	c.URL = patchSourceURL(p)
+	if s, _ := p.Metadata["published-at"].(string); s != "" {
+		c.Published, _ = time.Parse(time.RFC3339, s)
+	}
+
+	if p.SourceID != "" {
+		item, err := m.ItemByVideoID(p.SourceID)
+		if err != nil {
+			return c, err
+		}
+		if item != nil {
+			c.Title = orDefault(item.Title, c.Title)
+			c.Channel = item.Channel
+			c.URL = orDefault(item.URL, c.URL)
+			if t, err := time.Parse("2006-01-02", item.Published); err == nil {
+				c.Published = t
+			}
+		}
+	}
+	c.Title = orDefault(c.Title, patchSource(p))
+	if c.URL != "" {
+		c.Site = siteForURL(c.URL)
+		c.URL = timestampedURL(c.URL, f.TimestampInVideo)
+	}
+	return c, nil
+}
+
+// timestampedURL links to seconds into the video at rawURL: YouTube's t
+// parameter, or a media fragment elsewhere
+func timestampedURL(rawURL string, seconds float64) string {
+	if seconds <= 0 {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	t := strconv.Itoa(int(seconds))
+	if siteForURL(rawURL) == siteYouTube {
+		q := u.Query()
+		q.Del("t")
+		u.RawQuery = q.Encode()
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		// Appended rather than encoded with the rest, which would sort it
+		// before the video's v
+		u.RawQuery += "t=" + t + "s"
+	} else {
+		u.Fragment = "t=" + t
+	}
+	return u.String()
+}
+
+// citeSiteNames are the names sources on these sites are published in
+var citeSiteNames = map[string]string{
+	siteYouTube:  "YouTube",
+	"vimeo":      "Vimeo",
+	"soundcloud": "SoundCloud",
+	"tedtalk":    "TED",
+}
+
+// locator describes where in the source a fact is, e.g. "at 12:34"
+func (c citation) locator() string {
+	if c.Fact.TimestampInVideo <= 0 {
+		return ""
+	}
+	return "at " + formatVideoOffset(c.Fact.TimestampInVideo)
+}
+
+// nonKeyChars are stripped from words making up citation keys
+var nonKeyChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// citationKey returns a key like "lexfridman2024scaling", unique among
+// the keys given out so far (suffixed b, c, ... when taken)
+func citationKey(c citation, used map[string]int) string {
+	first := func(s string) string {
+		for _, w := range strings.Fields(strings.ToLower(s)) {
+			if w = nonKeyChars.ReplaceAllString(w, ""); len(w) > 3 {
+				return w
+			}
+		}
+		return ""
+	}
+	key := orDefault(nonKeyChars.ReplaceAllString(strings.ToLower(c.Channel), ""), "source")
+	if !c.Published.IsZero() {
+		key += strconv.Itoa(c.Published.Year())
+	}
+	key += first(c.Title)
+
+	n := used[key]
+	used[key]++
+	if n > 0 {
+		key += string(rune('a' + n))
+	}
+	return key
+}
+
+// bibtexEscaper escapes LaTeX's special characters
+var bibtexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`, "{", `\{`, "}", `\}`, "&", `\&`, "%", `\%`,
+	"$", `\$`, "#", `\#`, "_", `\_`, "~", `\textasciitilde{}`, "^", `\textasciicircum{}`,
+)
+
+// bibtexEntry formats a citation as a BibTeX @misc entry
+func bibtexEntry(c citation) string {
+	var b strings.Builder
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "  %-12s = {%s},\n", name, value)
+		}
+	}
+	fmt.Fprintf(&b, "@misc{%s,\n", c.Key)
+	if c.Channel != "" {
+		// Double braces keep a channel name from being split into first
+		// and last names
+		field("author", "{"+bibtexEscaper.Replace(c.Channel)+"}")
+	}
+	field("title", "{"+bibtexEscaper.Replace(c.Title)+"}")
+	if !c.Published.IsZero() {
+		field("year", strconv.Itoa(c.Published.Year()))
+		fmt.Fprintf(&b, "  %-12s = %s,\n", "month", strings.ToLower(c.Published.Month().String()[:3]))
+	}
+	howpublished := "Video"
+	if site := citeSiteNames[c.Site]; site != "" {
+		howpublished += ", " + site
+	}
+	field("howpublished", howpublished)
+	if c.URL != "" {
+		field("url", c.URL)
+		field("urldate", c.Accessed.Format("2006-01-02"))
+	}
+	note := fmt.Sprintf("``%s''", bibtexEscaper.Replace(c.Fact.Text))
+	if loc := c.locator(); loc != "" {
+		note = strings.ToUpper(loc[:1]) + loc[1:] + ": " + note
+	}
+	field("note", note)
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// cslItem is a CSL-JSON bibliography item
+type cslItem struct {
+	ID             string    `json:"id"`
+	Type           string    `json:"type"`
+	Title          string    `json:"title"`
+	Author         []cslName `json:"author,omitempty"`
+	ContainerTitle string    `json:"container-title,omitempty"`
+	Medium         string    `json:"medium"`
+	URL            string    `json:"URL,omitempty"`
+	Issued         *cslDate  `json:"issued,omitempty"`
+	Accessed       *cslDate  `json:"accessed,omitempty"`
+	Locator        string    `json:"locator,omitempty"`
+	Note           string    `json:"note"`
+}
+
+type cslName struct {
+	Literal string `json:"literal"`
+}
+
+type cslDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+func newCSLDate(t time.Time) *cslDate {
+	return &cslDate{DateParts: [][]int{{t.Year(), int(t.Month()), t.Day()}}}
+}
+
+// cslItems converts citations to CSL-JSON items. Online videos are CSL's
+// motion_picture type, as Zotero exports them.
+func cslItems(cites []citation) []cslItem {
+	items := make([]cslItem, 0, len(cites))
+	for _, c := range cites {
+		item := cslItem{
+			ID:             c.Key,
+			Type:           "motion_picture",
+			Title:          c.Title,
+			ContainerTitle: citeSiteNames[c.Site],
+			Medium:         "Video",
+			URL:            c.URL,
+			Note:           c.Fact.Text,
+		}
+		if c.Channel != "" {
+			item.Author = []cslName{{Literal: c.Channel}}
+		}
+		if !c.Published.IsZero() {
+			item.Issued = newCSLDate(c.Published)
+		}
+		if c.URL != "" {
+			item.Accessed = newCSLDate(c.Accessed)
+		}
+		if c.Fact.TimestampInVideo > 0 {
+			item.Locator = formatVideoOffset(c.Fact.TimestampInVideo)
+		}
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// CleanCmd reclaims disk space from items the pipeline is done with
+var CleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove downloaded audio that has been transcribed",
+	Long: `Reclaim disk space by removing the audio of items the manifest shows
+were transcribed: once a transcript exists, the audio is only needed to
+transcribe again.
+
+Cleaned items are marked in the manifest, so downloads, playlist syncs
+and watch runs keep treating them as done instead of fetching the audio
+again (download commands' --force fetches it anyway). Metadata sidecars
+(.info.json, thumbnails, descriptions) stay, as does every file of an
+item that is still pending, failed or only downloaded, and the .part
+files interrupted downloads resume from.
+
+--keep-transcripts=false also removes the transcripts of items whose
+patch is stored in the backend. --orphans also removes audio files under
+--videos that no manifest item refers to, such as leftovers of downloads
+made without a manifest or of items since removed from it.
+
+--older-than limits cleaning to items last updated (orphans: modified)
+longer ago than that: a duration such as 36h, or days and weeks as 30d
+or 2w.
+
+Examples:
+  vkm clean --dry-run
+  vkm clean --older-than 30d
+  vkm clean --keep-transcripts=false --orphans`,
+	Args: cobra.NoArgs,
+	RunE: runClean,
+}
+
+var (
+	cleanManifest        string
+	cleanVideoDir        string
+	cleanOlderThan       string
+	cleanKeepTranscripts bool
+	cleanOrphans         bool
+	cleanDryRun          bool
+)
+
+func init() {
+	CleanCmd.Flags().StringVar(&cleanManifest, "manifest", "data/manifest.db", "SQLite manifest of the items to clean")
+	CleanCmd.Flags().StringVar(&cleanVideoDir, "videos", "data/videos", "Directory searched for orphaned audio (with --orphans)")
+	CleanCmd.Flags().StringVar(&cleanOlderThan, "older-than", "", "Only clean items untouched for this long (e.g. 36h, 30d, 2w)")
+	CleanCmd.Flags().BoolVar(&cleanKeepTranscripts, "keep-transcripts", true, "Keep transcripts; false also removes those of items with a stored patch")
+	CleanCmd.Flags().BoolVar(&cleanOrphans, "orphans", false, "Also remove audio under --videos that no manifest item refers to")
+	CleanCmd.Flags().BoolVar(&cleanDryRun, "dry-run", false, "List what would be removed without removing it")
+}
+
+// Pruned reports whether 'vkm clean' removed the item's files
+func (item *ManifestItem) Pruned() bool {
+	return !item.PrunedAt.IsZero()
+}
+
+// MarkPruned records that the files of the item for url were removed
+func (m *Manifest) MarkPruned(url string) error {
+	return m.write(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("UPDATE items SET pruned_at = ? WHERE url = ?", time.Now().UTC(), url); err != nil {
+			return fmt.Errorf("failed to record cleaned item: %w", err)
+		}
+		return nil
+	})
+}
+
+// parseAge parses a duration that may also be given in days or weeks
+// ("30d", "2w")
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			if v, err := strconv.ParseFloat(n, 64); err == nil && v >= 0 {
+				return time.Duration(v * float64(unit)), nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (use a duration such as 36h, or days and weeks as 30d, 2w)", s)
+	}
+	return d, nil
+}
+
+// cleanTally counts what a clean removed
+type cleanTally struct {
+	files int
+	bytes int64
+}
+
+// remove deletes path, or reports it in a dry run
+func (t *cleanTally) remove(path, why string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if cleanDryRun {
+		fmt.Printf("Would remove %s (%s, %s)\n", path, why, formatBytes(info.Size()))
+	} else if err := os.Remove(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", path, err)
+		return false
+	} else {
+		fmt.Printf("✓ Removed %s (%s, %s)\n", path, why, formatBytes(info.Size()))
+	}
+	t.files++
+	t.bytes += info.Size()
+	return true
+}
+
+func runClean(cmd *cobra.Command, args []string) error {
+	var cutoff time.Time
+	if cleanOlderThan != "" {
+		age, err := parseAge(cleanOlderThan)
+		if err != nil {
+			return err
+		}
+		cutoff = time.Now().Add(-age)
+	}
+
+	manifest, err := openManifest(cleanManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	items, err := manifest.Items()
+	if err != nil {
+		return err
+	}
+
+	var tally cleanTally
+	known := make(map[string]bool)
+	for _, item := range items {
+		known[filepath.Clean(item.AudioPath)] = true
+		if !cutoff.IsZero() && item.UpdatedAt.After(cutoff) {
+			continue
+		}
+		if item.State != ItemTranscribed && item.State != ItemProcessed {
+			continue
+		}
+
+		transcribed := item.TranscriptPath != "" && fileExists(item.TranscriptPath)
+		pruned := false
+		if item.AudioPath != "" && transcribed {
+			pruned = tally.remove(item.AudioPath, "transcribed")
+		}
+		if !cleanKeepTranscripts && item.State == ItemProcessed && item.PatchID != "" && transcribed {
+			pruned = tally.remove(item.TranscriptPath, "patch "+item.PatchID) || pruned
+		}
+		if pruned && !cleanDryRun {
+			if err := manifest.MarkPruned(item.URL); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+	}
+
+	if cleanOrphans {
+		files, err := findAudioFiles(cleanVideoDir)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to find audio files: %w", err)
+		}
+		for _, path := range files {
+			if known[filepath.Clean(path)] {
+				continue
+			}
+			if info, err := os.Stat(path); err != nil || (!cutoff.IsZero() && info.ModTime().After(cutoff)) {
+				continue
+			}
+			tally.remove(path, "not in the manifest")
+		}
+	}
+
+	verb := "Removed"
+	if cleanDryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("\n%s %d files (%s)\n", verb, tally.files, formatBytes(tally.bytes))
+	return nil
+}
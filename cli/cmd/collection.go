@@ -0,0 +1,38 @@
+package cmd
+
+// metaCollection is the patch metadata key naming the collection its
+// source was ingested under
+const metaCollection = "collection"
+
+// collectionFlagUsage is the --collection help shared by ingesting commands
+const collectionFlagUsage = "Collection (research project) to file ingested items and their patches under"
+
+// ingestCollection is the --collection of the command ingesting items.
+// recordItem files manifest items under it, and patches extracted from
+// them carry it in their metadata.
+var ingestCollection string
+
+// withCollection stamps the --collection onto a patch's metadata, keeping
+// a collection the commit already names
+func (c patchCommit) withCollection() patchCommit {
+	if ingestCollection == "" {
+		return c
+	}
+	if _, ok := c.Metadata[metaCollection]; ok {
+		return c
+	}
+	meta := make(map[string]interface{}, len(c.Metadata)+1)
+	for k, v := range c.Metadata {
+		meta[k] = v
+	}
+	meta[metaCollection] = ingestCollection
+	c.Metadata = meta
+	return c
+}
+
+// patchCollection returns the collection a patch's source was ingested
+// under, or "" if none
+func patchCollection(p *Patch) string {
+	c, _ := p.Metadata[metaCollection].(string)
+	return c
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// VideoComment is a top-level YouTube comment
+type VideoComment struct {
+	ID          string
+	Author      string
+	Text        string
+	LikeCount   int64
+	ReplyCount  int64
+	PublishedAt time.Time
+}
+
+// Comment facts are extracted with a smaller model and weighted down: they
+// supplement the video's own claims rather than stand beside them.
+const (
+	commentTrustFactor = 0.5
+	commentMinChars    = 80
+	commentMinWords    = 12
+	commentPrompt      = "The following are viewer comments on a video. Extract only factual claims " +
+		"that add to or dispute what the video says: corrections, counterpoints, references " +
+		"and clarifications. Ignore praise, jokes, questions and personal anecdotes.\n\n" +
+		"For each fact, provide:\n" +
+		"- text: A clear, atomic claim (one fact per entry)\n" +
+		"- confidence: Your certainty this is factual (0.0-1.0)\n" +
+		"- topic: A single keyword category\n\n" +
+		"Comments:\n---\n%s\n---\n\n" +
+		"Respond ONLY with a valid JSON array, nothing else (an empty array if nothing qualifies):\n" +
+		"[{\"text\": \"...\", \"confidence\": 0.7, \"topic\": \"correction\"}]"
+)
+
+// Patch metadata keys linking a comment patch to the video's own patch,
+// as metaSplitParent links the parts of a split upload
+const (
+	// metaSupplementOf is the ID of the patch the facts supplement
+	metaSupplementOf = "supplement-of"
+	// metaVideoID is the video the comments were left on
+	metaVideoID = "video-id"
+)
+
+var (
+	commentURLPattern       = regexp.MustCompile(`https?://\S+`)
+	commentTimestampPattern = regexp.MustCompile(`\b\d{1,2}:\d{2}(?::\d{2})?\b`)
+)
+
+// substantiveComments keeps comments long enough to carry a claim once
+// links and timestamps are stripped
+func substantiveComments(comments []VideoComment) []VideoComment {
+	var kept []VideoComment
+	for _, c := range comments {
+		text := commentURLPattern.ReplaceAllString(c.Text, "")
+		text = strings.TrimSpace(commentTimestampPattern.ReplaceAllString(text, ""))
+		if utf8.RuneCountInString(text) < commentMinChars || len(strings.Fields(text)) < commentMinWords {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// extractCommentFacts runs lightweight extraction over a video's comments
+// and returns them as low-trust supplementary facts
+func extractCommentFacts(ctx context.Context, videoID string, comments []VideoComment) ([]Fact, error) {
+	if len(comments) == 0 {
+		return nil, nil
+	}
+
+	var b strings.Builder
+	for _, c := range comments {
+		fmt.Fprintf(&b, "[%d likes] %s\n\n", c.LikeCount, strings.TrimSpace(c.Text))
+	}
+
+	facts, err := extractFactsWithPrompt(ctx, claudeLightModel, fmt.Sprintf(commentPrompt, b.String()), videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range facts {
+		facts[i].Confidence *= commentTrustFactor
+		facts[i].ExtractedFrom = "youtube-comments:" + videoID
+		facts[i].Tags = append(facts[i].Tags, "supplementary", "youtube-comment")
+	}
+	return facts, nil
+}
+
+// newCommentPatch wraps comment facts in a patch tied to the video and
+// to parentID, the patch of the video's own facts
+func newCommentPatch(videoID, parentID string, facts []Fact, commentCount int) Patch {
+	patch := newPatch(videoID, facts)
+	patch.Source = "youtube-channel"
+	patch.Metadata = map[string]interface{}{
+		metaSupplementOf: parentID,
+		metaVideoID:      videoID,
+		"supplementary":  "youtube-comments",
+		"trust":          "low",
+		"comment-count":  commentCount,
+		"prompt-version": promptVersion(commentPrompt),
+	}
+	return patch
+}
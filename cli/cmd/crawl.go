@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errRobotsDisallowed means a site's robots.txt forbids fetching a URL
+var errRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+// maxRobotsBytes caps how much of a robots.txt is read, as Google does
+const maxRobotsBytes = 500 * 1024
+
+// politeCrawler fetches pages one at a time, obeying each site's
+// robots.txt and waiting at least its delay (or the site's Crawl-delay,
+// if longer) between requests to the same host
+type politeCrawler struct {
+	client *http.Client
+	delay  time.Duration
+	robots map[string]*robotsRules // by scheme://host
+	last   map[string]time.Time    // by host
+}
+
+func newPoliteCrawler(delay time.Duration) *politeCrawler {
+	return &politeCrawler{
+		client: &http.Client{Timeout: 30 * time.Second},
+		delay:  delay,
+		robots: make(map[string]*robotsRules),
+		last:   make(map[string]time.Time),
+	}
+}
+
+// Get fetches rawURL once robots.txt allows it and the host's delay has
+// passed. Responses other than 200 OK are returned as errors.
+func (c *politeCrawler) Get(ctx context.Context, rawURL string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid URL %q (use http or https)", rawURL)
+	}
+	rules, err := c.rules(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if !rules.Allowed(u.RequestURI()) {
+		return nil, errRobotsDisallowed
+	}
+
+	resp, err := c.fetch(ctx, u.String(), max(c.delay, rules.delay))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned status %d", rawURL, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// rules returns the robots.txt rules for u's site, fetching them once
+func (c *politeCrawler) rules(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	site := u.Scheme + "://" + u.Host
+	if r, ok := c.robots[site]; ok {
+		return r, nil
+	}
+
+	resp, err := c.fetch(ctx, site+"/robots.txt", c.delay)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to fetch robots.txt of %s: %w", u.Host, err)
+	}
+	defer resp.Body.Close()
+
+	// Per RFC 9309, a missing robots.txt allows everything and a server
+	// error forbids everything until it can be read
+	var r *robotsRules
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		r = parseRobots(io.LimitReader(resp.Body, maxRobotsBytes), "vkm")
+	case resp.StatusCode >= 500:
+		r = &robotsRules{disallowAll: true}
+	default:
+		r = &robotsRules{}
+	}
+	c.robots[site] = r
+	return r, nil
+}
+
+// fetch sends a GET once delay has passed since the last request to the
+// same host
+func (c *politeCrawler) fetch(ctx context.Context, rawURL string, delay time.Duration) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	host := req.URL.Hostname()
+	if wait := time.Until(c.last[host].Add(delay)); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c.last[host] = time.Now()
+	return c.client.Do(req)
+}
+
+// robotsRules are the robots.txt rules that apply to vkm on one site
+type robotsRules struct {
+	allow       []string
+	disallow    []string
+	delay       time.Duration
+	disallowAll bool
+}
+
+// Allowed reports whether path may be fetched: the longest matching rule
+// wins, and Allow wins ties
+func (r *robotsRules) Allowed(path string) bool {
+	if r.disallowAll {
+		return false
+	}
+	if path == "" {
+		path = "/"
+	}
+	best, allowed := -1, true
+	for _, p := range r.allow {
+		if robotsMatch(p, path) && len(p) >= best {
+			best, allowed = len(p), true
+		}
+	}
+	for _, p := range r.disallow {
+		if robotsMatch(p, path) && len(p) > best {
+			best, allowed = len(p), false
+		}
+	}
+	return allowed
+}
+
+// robotsMatch matches a robots.txt path pattern, with * wildcards and a
+// trailing $ anchor, against a path
+func robotsMatch(pattern, path string) bool {
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.TrimSuffix(pattern, "$")), `\*`, ".*")
+	if strings.HasSuffix(pattern, "$") {
+		expr += "$"
+	}
+	re, err := regexp.Compile(expr)
+	return err == nil && re.MatchString(path)
+}
+
+// parseRobots reads the rules of the group for agent, or of the * group
+// when no group names it
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	type group struct {
+		agents []string
+		rules  robotsRules
+	}
+	var groups []*group
+	var current *group
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgents = true
+			continue
+		case "allow":
+			if current != nil && value != "" {
+				current.rules.allow = append(current.rules.allow, value)
+			}
+		case "disallow":
+			if current != nil && value != "" {
+				current.rules.disallow = append(current.rules.disallow, value)
+			}
+		case "crawl-delay":
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && current != nil {
+				current.rules.delay = time.Duration(secs * float64(time.Second))
+			}
+		}
+		inAgents = false
+	}
+
+	var fallback *robotsRules
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a == agent {
+				return &g.rules
+			}
+			if a == "*" && fallback == nil {
+				fallback = &g.rules
+			}
+		}
+	}
+	if fallback == nil {
+		return &robotsRules{}
+	}
+	return fallback
+}
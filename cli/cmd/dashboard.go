@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	_ "embed"
+	"net/http"
+	"time"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// stageProgress maps an item's pipeline state to a rough completion
+// fraction for running jobs
+var stageProgress = map[string]float64{
+	ItemPending:     0,
+	ItemDownloaded:  1.0 / 3,
+	ItemTranscribed: 2.0 / 3,
+	ItemProcessed:   1,
+}
+
+// runningJob is a running job with its current pipeline stage
+type runningJob struct {
+	*Job
+	Stage    string  `json:"stage"`
+	Progress float64 `json:"progress"`
+}
+
+// attentionItem is a processed item that failed a quality gate
+type attentionItem struct {
+	URL       string    `json:"url"`
+	Title     string    `json:"title,omitempty"`
+	PatchID   string    `json:"patch_id"`
+	Reasons   string    `json:"reasons"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// dashboardData is the payload behind the dashboard page
+type dashboardData struct {
+	GeneratedAt  time.Time                 `json:"generated_at"`
+	Queue        map[string]int            `json:"queue"`
+	Running      []runningJob              `json:"running"`
+	Failures     []*Job                    `json:"failures"`
+	Attention    []attentionItem           `json:"attention"`
+	UsageDay     string                    `json:"usage_day"`
+	Usage        map[string]int            `json:"usage"`
+	YouTubeQuota int                       `json:"youtube_quota"`
+	Sources      map[string]map[string]int `json:"sources"`
+}
+
+// collectDashboard gathers queue, usage and per-source stats from the manifest
+func collectDashboard(m *Manifest) (*dashboardData, error) {
+	counts, err := m.JobCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	data := &dashboardData{
+		GeneratedAt:  time.Now().UTC(),
+		Queue:        make(map[string]int),
+		Running:      []runningJob{},
+		Sources:      counts,
+		UsageDay:     youtubeQuotaDay(time.Now()),
+		YouTubeQuota: youtubeDailyQuota(),
+	}
+	for _, states := range counts {
+		for state, n := range states {
+			data.Queue[state] += n
+		}
+	}
+
+	running, err := m.ListJobs(JobRunning, 20)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range running {
+		rj := runningJob{Job: job, Stage: ItemPending}
+		if item, err := m.GetItem(job.URL); err == nil && item != nil {
+			rj.Stage = item.State
+			rj.Progress = stageProgress[item.State]
+		}
+		data.Running = append(data.Running, rj)
+	}
+
+	if data.Failures, err = m.ListJobs(JobFailed, 10); err != nil {
+		return nil, err
+	}
+	if data.Failures == nil {
+		data.Failures = []*Job{}
+	}
+
+	attention, err := m.AttentionItems()
+	if err != nil {
+		return nil, err
+	}
+	data.Attention = []attentionItem{}
+	for _, item := range attention {
+		if len(data.Attention) == 10 {
+			break
+		}
+		data.Attention = append(data.Attention, attentionItem{
+			URL:       item.URL,
+			Title:     item.Title,
+			PatchID:   item.PatchID,
+			Reasons:   item.Attention,
+			UpdatedAt: item.UpdatedAt,
+		})
+	}
+
+	if data.Usage, err = m.UsageByAPI(data.UsageDay); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// serveDashboardPage serves the static page; it reads /api/dashboard with
+// a token the user pastes in, so the page itself needs no auth
+func serveDashboardPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(dashboardHTML)
+}
+
+func (a *apiServer) dashboard(w http.ResponseWriter, r *http.Request) {
+	data, err := collectDashboard(a.manifest)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, data)
+}
@@ -0,0 +1,334 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// DepsCmd manages the external tools vkm depends on
+var DepsCmd = &cobra.Command{
+	Use:   "deps",
+	Short: "Manage external tools vkm depends on",
+	Long: `Manage the external tools vkm runs. Tools installed this way live in the
+managed binary directory (VKM_BIN_DIR, by default the user cache
+directory) and take precedence over copies on PATH.
+
+Examples:
+  vkm deps check
+  vkm deps install yt-dlp ffmpeg
+  vkm deps update yt-dlp`,
+}
+
+// DepsUpdateCmd installs the latest release of a tool
+var DepsUpdateCmd = &cobra.Command{
+	Use:   "update [tool]",
+	Short: "Install the latest release of a tool",
+	Long: `Download the latest release of a tool into the managed binary directory,
+verifying it against the release's published checksums.
+
+YouTube changes regularly break yt-dlp's extractor until a new release
+catches up, so vkm warns when yt-dlp is older than VKM_YTDLP_MAX_AGE days
+(default 60, 0 disables the check), and suggests this command when a
+download fails the way an outdated extractor does.
+
+Supported tools: yt-dlp
+
+Example:
+  vkm deps update yt-dlp`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDepsUpdate,
+}
+
+var depsForce bool
+
+func init() {
+	DepsCmd.AddCommand(DepsUpdateCmd)
+
+	DepsUpdateCmd.Flags().BoolVar(&depsForce, "force", false, "Reinstall even if the managed copy is up to date")
+}
+
+// ytDlpReleasesURL is the GitHub API endpoint for yt-dlp's releases
+const ytDlpReleasesURL = "https://api.github.com/repos/yt-dlp/yt-dlp/releases"
+
+// defaultYtDlpMaxAge is how many days old yt-dlp may be before vkm warns
+const defaultYtDlpMaxAge = 60
+
+func runDepsUpdate(cmd *cobra.Command, args []string) error {
+	if args[0] != "yt-dlp" {
+		return fmt.Errorf("unsupported tool %q (supported: yt-dlp)", args[0])
+	}
+	return installYtDlp(cmd.Context(), "", depsForce)
+}
+
+// installYtDlp installs the yt-dlp release tagged tag ("" for the latest)
+// into the managed binary directory, unless it is already there
+func installYtDlp(ctx context.Context, tag string, force bool) error {
+	release, err := fetchYtDlpRelease(ctx, tag)
+	if err != nil {
+		return err
+	}
+
+	target := managedToolPath("yt-dlp")
+	if current, err := ytDlpVersion(target); err == nil {
+		if current == release.Tag && !force {
+			fmt.Printf("✓ yt-dlp %s is up to date (%s)\n", current, target)
+			return nil
+		}
+		fmt.Printf("Updating yt-dlp %s → %s\n", current, release.Tag)
+	} else {
+		fmt.Printf("Installing yt-dlp %s\n", release.Tag)
+	}
+
+	asset := ytDlpAssetName()
+	url, ok := release.Assets[asset]
+	if !ok {
+		return fmt.Errorf("release %s has no %s build", release.Tag, asset)
+	}
+	sums, ok := release.Assets["SHA2-256SUMS"]
+	if !ok {
+		return fmt.Errorf("release %s publishes no checksums", release.Tag)
+	}
+	want, err := fetchReleaseChecksum(ctx, sums, asset)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := downloadVerified(ctx, url, target, want); err != nil {
+		return err
+	}
+
+	version, err := ytDlpVersion(target)
+	if err != nil {
+		return fmt.Errorf("installed yt-dlp failed to run: %w", err)
+	}
+	fmt.Printf("✓ Installed yt-dlp %s: %s\n", version, target)
+	return nil
+}
+
+// ytDlpRelease is a GitHub release (of yt-dlp, or the ffmpeg builds) and
+// its download URLs by asset name
+type ytDlpRelease struct {
+	Tag    string
+	Assets map[string]string
+}
+
+// fetchYtDlpRelease looks up the yt-dlp release tagged tag, or the
+// latest for ""
+func fetchYtDlpRelease(ctx context.Context, tag string) (*ytDlpRelease, error) {
+	return fetchGitHubRelease(ctx, ytDlpReleasesURL, tag)
+}
+
+// fetchGitHubRelease looks up a release of the GitHub repository whose
+// releases API is at releasesURL: the one tagged tag, or the latest
+func fetchGitHubRelease(ctx context.Context, releasesURL, tag string) (*ytDlpRelease, error) {
+	endpoint := releasesURL + "/latest"
+	if tag != "" {
+		endpoint = releasesURL + "/tags/" + url.PathEscape(tag)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up release %s: %w", orDefault(tag, "latest"), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("GitHub API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var data struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to parse release: %w", err)
+	}
+
+	release := &ytDlpRelease{Tag: data.TagName, Assets: make(map[string]string)}
+	for _, a := range data.Assets {
+		release.Assets[a.Name] = a.URL
+	}
+	return release, nil
+}
+
+// ytDlpAssetName is the release asset with a standalone build for this
+// platform. Other platforms get the zipapp, which needs Python.
+func ytDlpAssetName() string {
+	switch runtime.GOOS + "/" + runtime.GOARCH {
+	case "linux/amd64":
+		return "yt-dlp_linux"
+	case "linux/arm64":
+		return "yt-dlp_linux_aarch64"
+	case "darwin/amd64", "darwin/arm64":
+		return "yt-dlp_macos"
+	case "windows/amd64", "windows/arm64":
+		return "yt-dlp.exe"
+	case "windows/386":
+		return "yt-dlp_x86.exe"
+	}
+	return "yt-dlp"
+}
+
+// fetchReleaseChecksum reads asset's SHA-256 from a SHA2-256SUMS file
+func fetchReleaseChecksum(ctx context.Context, url, asset string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download checksums: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download checksums (status %d)", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read checksums: %w", err)
+	}
+	return "", fmt.Errorf("no checksum published for %s", asset)
+}
+
+// downloadVerified downloads url to path, replacing it only once the
+// download is complete and matches the SHA-256 sum
+func downloadVerified(ctx context.Context, url, path, sum string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s (status %d)", url, resp.StatusCode)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".download-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != sum {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", url, got, sum)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return fmt.Errorf("failed to make %s executable: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to install %s: %w", path, err)
+	}
+	return nil
+}
+
+// ytDlpVersion runs yt-dlp at path and returns its version
+func ytDlpVersion(path string) (string, error) {
+	out, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ytDlpMaxAge returns how many days old yt-dlp may get before vkm warns,
+// from VKM_YTDLP_MAX_AGE; 0 disables the warning
+func ytDlpMaxAge() int {
+	if v, err := strconv.Atoi(os.Getenv("VKM_YTDLP_MAX_AGE")); err == nil && v >= 0 {
+		return v
+	}
+	return defaultYtDlpMaxAge
+}
+
+// warnIfYtDlpStale warns when a yt-dlp version (its release date, as in
+// 2024.03.10 or nightly 2024.03.10.232707) is older than ytDlpMaxAge days
+func warnIfYtDlpStale(version string) {
+	maxAge := ytDlpMaxAge()
+	if maxAge == 0 || len(version) < 10 {
+		return
+	}
+	released, err := time.Parse("2006.01.02", version[:10])
+	if err != nil {
+		return
+	}
+	if age := int(time.Since(released).Hours() / 24); age > maxAge {
+		fmt.Fprintf(os.Stderr, "Warning: yt-dlp %s is %d days old; YouTube changes often break older releases. Run 'vkm deps update yt-dlp'.\n", version, age)
+	}
+}
+
+// ytDlpBreakage are fragments of yt-dlp errors that usually mean YouTube
+// changed in a way only a newer yt-dlp handles
+var ytDlpBreakage = []string{
+	"Unable to extract",
+	"nsig extraction failed",
+	"Signature extraction failed",
+	"Failed to extract any player response",
+	"Confirm you are on the latest version",
+	"HTTP Error 403: Forbidden",
+}
+
+// ytDlpError adds the last line yt-dlp printed to err and, when the
+// output looks like a broken extractor, how to update, or when it needs
+// an account, how to sign in
+func ytDlpError(err error, stderr string) error {
+	if line := lastLine(stderr); line != "" {
+		err = fmt.Errorf("%w: %s", err, line)
+	}
+	for _, fragment := range ytDlpBreakage {
+		if strings.Contains(stderr, fragment) {
+			return fmt.Errorf("%w (yt-dlp may be out of date; run 'vkm deps update yt-dlp')", err)
+		}
+	}
+	if hint := youtubeAuthHint(stderr); hint != "" {
+		return fmt.Errorf("%w%s", err, hint)
+	}
+	return err
+}
@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// DepsInstallCmd installs pinned releases of the tools vkm runs
+var DepsInstallCmd = &cobra.Command{
+	Use:   "install [tool[@version]...]",
+	Short: "Install pinned releases of yt-dlp and ffmpeg",
+	Long: `Download standalone builds of vkm's tools into the managed binary
+directory, verified against their releases' published checksums, so
+downloads work without pip or a package manager.
+
+Without arguments yt-dlp is installed at the release this vkm was tested
+with (` + pinnedYtDlpVersion + `). Name another release as yt-dlp@<version>, or use
+'vkm deps update yt-dlp' for the latest.
+
+ffmpeg (with ffprobe) is installed on request, from the ` + pinnedFFmpegVersion + ` release
+line of the BtbN/FFmpeg-Builds static builds for Linux and Windows;
+on macOS install it with Homebrew. Extracting the Linux build needs tar
+with xz support.
+
+whisper.cpp-model@<model> downloads a ggml model for 'vkm transcribe
+--engine whisper.cpp' into the model directory (VKM_MODEL_DIR), which
+otherwise happens on first use; --force downloads it again.
+
+Examples:
+  vkm deps install
+  vkm deps install yt-dlp ffmpeg
+  vkm deps install yt-dlp@2025.09.26
+  vkm deps install whisper.cpp-model@large-v3`,
+	RunE: runDepsInstall,
+}
+
+// DepsCheckCmd reports the tools vkm finds and their versions
+var DepsCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Show which tools vkm uses, where from and at which versions",
+	Long: `List the external tools vkm runs, where each is found (the managed
+binary directory or PATH) and its version, compared with the pinned
+release 'vkm deps install' provides. Exits with an error when a tool
+every download needs (yt-dlp or ffmpeg) is missing.
+
+Example:
+  vkm deps check`,
+	Args: cobra.NoArgs,
+	RunE: runDepsCheck,
+}
+
+func init() {
+	DepsCmd.AddCommand(DepsInstallCmd)
+	DepsCmd.AddCommand(DepsCheckCmd)
+
+	DepsInstallCmd.Flags().BoolVar(&depsForce, "force", false, "Reinstall even if the managed copy is at the requested version")
+}
+
+// The tool releases 'vkm deps install' installs by default
+const (
+	pinnedYtDlpVersion  = "2025.09.26"
+	pinnedFFmpegVersion = "7.1"
+)
+
+// ffmpegReleasesURL is the GitHub API endpoint of the static ffmpeg
+// builds; their "latest" release carries the newest build of each
+// release line
+const ffmpegReleasesURL = "https://api.github.com/repos/BtbN/FFmpeg-Builds/releases"
+
+// managedToolPath is where a managed copy of a tool is installed
+func managedToolPath(name string) string {
+	path := filepath.Join(managedBinDir(), name)
+	if runtime.GOOS == "windows" {
+		path += ".exe"
+	}
+	return path
+}
+
+func runDepsInstall(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{"yt-dlp"}
+	}
+	for _, arg := range args {
+		tool, version, _ := strings.Cut(arg, "@")
+		var err error
+		switch tool {
+		case "yt-dlp":
+			err = installYtDlp(cmd.Context(), orDefault(version, pinnedYtDlpVersion), depsForce)
+		case "ffmpeg":
+			err = installFFmpeg(cmd.Context(), orDefault(version, pinnedFFmpegVersion), depsForce)
+		case "whisper.cpp-model":
+			var path string
+			if path, err = ensureWhisperCppModel(cmd.Context(), orDefault(version, "base"), depsForce); err == nil {
+				fmt.Printf("✓ whisper.cpp model %s is installed (%s)\n", orDefault(version, "base"), path)
+			}
+		default:
+			err = fmt.Errorf("unsupported tool %q (supported: yt-dlp, ffmpeg, whisper.cpp-model)", tool)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ffmpegAssetName is the build of the version release line for this
+// platform, or "" if there is none
+func ffmpegAssetName(version string) string {
+	platform := map[string]string{
+		"linux/amd64":   "linux64",
+		"linux/arm64":   "linuxarm64",
+		"windows/amd64": "win64",
+		"windows/arm64": "winarm64",
+	}[runtime.GOOS+"/"+runtime.GOARCH]
+	if platform == "" {
+		return ""
+	}
+	ext := ".tar.xz"
+	if runtime.GOOS == "windows" {
+		ext = ".zip"
+	}
+	return fmt.Sprintf("ffmpeg-n%s-latest-%s-gpl-%s%s", version, platform, version, ext)
+}
+
+// installFFmpeg installs ffmpeg and ffprobe of the version release line
+// into the managed binary directory, unless they are already there
+func installFFmpeg(ctx context.Context, version string, force bool) error {
+	asset := ffmpegAssetName(version)
+	if asset == "" {
+		return fmt.Errorf("no static ffmpeg build for %s/%s; install it with %s", runtime.GOOS, runtime.GOARCH, installHint("ffmpeg"))
+	}
+
+	target := managedToolPath("ffmpeg")
+	if current, err := toolVersion(target); err == nil && !force {
+		if strings.HasPrefix(current, "n"+version) || strings.HasPrefix(current, version) {
+			fmt.Printf("✓ ffmpeg %s is installed (%s)\n", current, target)
+			return nil
+		}
+	}
+	fmt.Printf("Installing ffmpeg %s\n", version)
+
+	release, err := fetchGitHubRelease(ctx, ffmpegReleasesURL, "latest")
+	if err != nil {
+		return err
+	}
+	url, ok := release.Assets[asset]
+	if !ok {
+		return fmt.Errorf("the ffmpeg builds have no %s (is %s a release line they build?)", asset, version)
+	}
+	sums, ok := release.Assets["checksums.sha256"]
+	if !ok {
+		return fmt.Errorf("the ffmpeg builds publish no checksums")
+	}
+	want, err := fetchReleaseChecksum(ctx, sums, asset)
+	if err != nil {
+		return err
+	}
+
+	dir, err := newTempDir("ffmpeg-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	archive := filepath.Join(dir, asset)
+	if err := downloadVerified(ctx, url, archive, want); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(managedBinDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if err := extractArchiveBinary(ctx, archive, dir, name, managedToolPath(name)); err != nil {
+			return err
+		}
+	}
+
+	installed, err := toolVersion(target)
+	if err != nil {
+		return fmt.Errorf("installed ffmpeg failed to run: %w", err)
+	}
+	fmt.Printf("✓ Installed ffmpeg %s: %s\n", installed, target)
+	return nil
+}
+
+// extractArchiveBinary copies the bin/<name> of a build archive (.zip, or
+// .tar.xz unpacked with tar into dir) to target
+func extractArchiveBinary(ctx context.Context, archive, dir, name, target string) error {
+	var src io.ReadCloser
+	if strings.HasSuffix(archive, ".zip") {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", archive, err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if strings.HasSuffix(f.Name, "/bin/"+name+".exe") {
+				if src, err = f.Open(); err != nil {
+					return fmt.Errorf("failed to extract %s: %w", f.Name, err)
+				}
+				break
+			}
+		}
+	} else {
+		// The archive is unpacked once for all its binaries
+		paths, _ := filepath.Glob(filepath.Join(dir, "*", "bin", name))
+		if len(paths) == 0 {
+			if out, err := exec.CommandContext(ctx, "tar", "-xJf", archive, "-C", dir).CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to unpack %s (tar needs xz support): %v: %s", archive, err, strings.TrimSpace(string(out)))
+			}
+			paths, _ = filepath.Glob(filepath.Join(dir, "*", "bin", name))
+		}
+		if len(paths) > 0 {
+			f, err := os.Open(paths[0])
+			if err != nil {
+				return fmt.Errorf("failed to extract %s: %w", name, err)
+			}
+			src = f
+		}
+	}
+	if src == nil {
+		return fmt.Errorf("%s has no %s binary", filepath.Base(archive), name)
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".install-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return fmt.Errorf("failed to make %s executable: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to install %s: %w", target, err)
+	}
+	return nil
+}
+
+// toolVersion runs an ffmpeg-style tool at path and returns the version
+// from its "<tool> version <version> ..." banner
+func toolVersion(path string) (string, error) {
+	out, err := exec.Command(path, "-version").Output()
+	if err != nil {
+		return "", err
+	}
+	banner, _, _ := strings.Cut(string(out), "\n")
+	fields := strings.Fields(banner)
+	if len(fields) < 3 || fields[1] != "version" {
+		return "", fmt.Errorf("unexpected version output from %s", path)
+	}
+	return fields[2], nil
+}
+
+// checkedTool is a tool 'vkm deps check' reports on
+type checkedTool struct {
+	Name     string
+	Required bool
+	Pinned   string
+	Version  func(path string) (string, error)
+}
+
+var checkedTools = []checkedTool{
+	{Name: "yt-dlp", Required: true, Pinned: pinnedYtDlpVersion, Version: ytDlpVersion},
+	{Name: "ffmpeg", Required: true, Pinned: pinnedFFmpegVersion, Version: toolVersion},
+	{Name: "ffprobe", Pinned: pinnedFFmpegVersion, Version: toolVersion},
+	{Name: "whisper"},
+	{Name: "whisper-cli"},
+	{Name: "pdftotext"},
+}
+
+func runDepsCheck(cmd *cobra.Command, args []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOOL\tSOURCE\tVERSION\tPINNED\tPATH")
+	var missing []string
+	for _, t := range checkedTools {
+		path, err := findTool(t.Name)
+		if err != nil {
+			status := "optional"
+			if t.Required {
+				status = "required"
+				missing = append(missing, t.Name)
+			}
+			fmt.Fprintf(w, "%s\tmissing (%s)\t-\t%s\t-\n", t.Name, status, orDefault(t.Pinned, "-"))
+			continue
+		}
+		source := "PATH"
+		if path == managedToolPath(t.Name) {
+			source = "managed"
+		}
+		version := "-"
+		if t.Version != nil {
+			if version, err = t.Version(path); err != nil {
+				version = "fails to run"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Name, source, version, orDefault(t.Pinned, "-"), path)
+	}
+	w.Flush()
+
+	if path, err := findTool("yt-dlp"); err == nil {
+		if version, err := ytDlpVersion(path); err == nil {
+			warnIfYtDlpStale(version)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s; run 'vkm deps install %s'", strings.Join(missing, " and "), strings.Join(missing, " "))
+	}
+	return nil
+}
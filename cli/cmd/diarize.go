@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// diarizeScript diarizes audio with pyannote.audio, for transcribers that
+// don't label speakers themselves
+//
+//go:embed diarize/pyannote_diarize.py
+var diarizeScript []byte
+
+// diarizePipeline is the pyannote pipeline speakers are diarized with
+const diarizePipeline = "pyannote/speaker-diarization-3.1"
+
+// diarizeHelp describes the diarization pass for commands' --help
+const diarizeHelp = `With --diarize, each segment is labeled with its speaker (SPEAKER_00,
+SPEAKER_01, ...), and the transcript text the facts are extracted from
+names the speaker at each change of speaker. Deepgram and AssemblyAI
+label speakers themselves; for Whisper transcripts a separate pass
+diarizes the audio with pyannote.audio and each segment takes the
+speaker who talks most during it. The pass needs python3 with
+pyannote.audio (pip install pyannote.audio), ffmpeg, and a Hugging Face
+token in HF_TOKEN that has accepted the conditions of
+` + diarizePipeline + `. --speakers tells it how many
+speakers there are, when known.`
+
+// speakerTurn is a stretch of audio one speaker talks in, in seconds
+type speakerTurn struct {
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Speaker string  `json:"speaker"`
+}
+
+// diarization is the output of the diarization pass: the speaker turns,
+// and a voice embedding per speaker in the format 'vkm speakers import'
+// reads
+type diarization struct {
+	speakerVoicesFile
+	Turns []speakerTurn `json:"turns"`
+}
+
+// checkDiarizer checks the diarization pass can run: python3 and ffmpeg
+// are installed and HF_TOKEN is set. Whether pyannote.audio is installed
+// is only known once it runs.
+func checkDiarizer() error {
+	if _, err := findTool("python3"); err != nil {
+		return fmt.Errorf("diarization needs python3 with pyannote.audio: %w", err)
+	}
+	if _, err := findTool("ffmpeg"); err != nil {
+		return fmt.Errorf("diarization needs ffmpeg: %w", err)
+	}
+	if os.Getenv("HF_TOKEN") == "" {
+		return fmt.Errorf("HF_TOKEN environment variable not set (required to diarize with %s)", diarizePipeline)
+	}
+	return nil
+}
+
+// diarizeAudio runs the diarization pass over audioPath, converted to
+// 16 kHz mono WAV with ffmpeg first. numSpeakers, if positive, fixes how
+// many speakers are found.
+func diarizeAudio(ctx context.Context, audioPath string, numSpeakers int) (*diarization, error) {
+	if err := checkDiarizer(); err != nil {
+		return nil, err
+	}
+
+	dir, err := newTempDir("diarize-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "pyannote_diarize.py")
+	if err := os.WriteFile(script, diarizeScript, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write diarization script: %w", err)
+	}
+	wav := filepath.Join(dir, "audio.wav")
+	out, err := toolCommand(ctx, "ffmpeg", "-nostdin", "-y", "-loglevel", "error", "-i", toolPath(audioPath),
+		"-vn", "-ac", "1", "-ar", "16000", toolPath(wav)).CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("ffmpeg failed to convert %s for diarization: %v: %s", filepath.Base(audioPath), err, strings.TrimSpace(string(out)))
+	}
+
+	args := []string{toolPath(script), toolPath(wav), "--pipeline", diarizePipeline}
+	if numSpeakers > 0 {
+		args = append(args, "--num-speakers", strconv.Itoa(numSpeakers))
+	}
+	c := toolCommand(ctx, "python3", args...)
+	var stderr strings.Builder
+	c.Stderr = &stderr
+	stdout, err := c.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// pyannote logs progress to stderr; its last line says what failed
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		return nil, fmt.Errorf("diarization failed: %v: %s", err, lines[len(lines)-1])
+	}
+
+	var d diarization
+	if err := json.Unmarshal(stdout, &d); err != nil {
+		return nil, fmt.Errorf("failed to parse diarization: %w", err)
+	}
+	return &d, nil
+}
+
+// mergeSpeakerTurns labels each of a transcript's segments with the
+// speaker who talks most during it. Segments without a duration take the
+// speaker of the turn they start in; segments no turn overlaps are left
+// unlabeled. Segment and turn times must be on the same clock, so turns
+// are merged before segments are placed in their video.
+func mergeSpeakerTurns(t *Transcript, turns []speakerTurn) {
+	for i := range t.Transcript {
+		seg := &t.Transcript[i]
+		start, end := seg.Timestamp, seg.Timestamp+seg.Duration
+		talk := make(map[string]float64)
+		best := ""
+		for _, turn := range turns {
+			overlap := min(end, turn.End) - max(start, turn.Start)
+			if seg.Duration <= 0 && start >= turn.Start && start < turn.End {
+				// Any containing turn wins over none
+				overlap = turn.End - turn.Start
+			}
+			if overlap <= 0 {
+				continue
+			}
+			talk[turn.Speaker] += overlap
+			if best == "" || talk[turn.Speaker] > talk[best] {
+				best = turn.Speaker
+			}
+		}
+		seg.Speaker = best
+	}
+}
+
+// speakers returns the speaker labels of a transcript in the order they
+// first speak, or nil for a transcript that isn't diarized
+func (t *Transcript) speakers() []string {
+	if t == nil {
+		return nil
+	}
+	var labels []string
+	seen := make(map[string]bool)
+	for _, seg := range t.Transcript {
+		if seg.Speaker != "" && !seen[seg.Speaker] {
+			seen[seg.Speaker] = true
+			labels = append(labels, seg.Speaker)
+		}
+	}
+	return labels
+}
+
+// diarizeTranscript labels the speakers of a transcript of audioPath with
+// the diarization pass, returning the diarization. The transcript must
+// still be on the audio's clock (see mergeSpeakerTurns).
+func diarizeTranscript(ctx context.Context, t *Transcript, audioPath string, numSpeakers int) (*diarization, error) {
+	if len(t.Transcript) == 0 || (len(t.Transcript) == 1 && t.Transcript[0].Duration == 0) {
+		return nil, fmt.Errorf("diarization needs a transcript with timestamped segments")
+	}
+	fmt.Println("  Diarizing speakers with pyannote.audio...")
+	d, err := diarizeAudio(ctx, audioPath, numSpeakers)
+	if err != nil {
+		return nil, err
+	}
+	mergeSpeakerTurns(t, d.Turns)
+	fmt.Printf("  ✓ %d speaker(s) in %d turns\n", len(d.Speakers), len(d.Turns))
+	return d, nil
+}
+
+// saveSpeakerVoices writes a diarization's voice embeddings beside a
+// transcript, as <transcript>.voices.json for 'vkm speakers import'.
+// The channel is taken from the audio's info.json, if it has one.
+func saveSpeakerVoices(d *diarization, transcriptPath, videoID, infoPath string) (string, error) {
+	if len(d.Speakers) == 0 {
+		return "", nil
+	}
+	voices := d.speakerVoicesFile
+	voices.VideoID = videoID
+	if info, err := loadVideoMetadata(infoPath); err == nil {
+		voices.Channel, _ = info["channel"].(string)
+		if id, _ := info["id"].(string); id != "" {
+			voices.VideoID = id
+		}
+	}
+	data, err := json.MarshalIndent(voices, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal speaker voices: %w", err)
+	}
+	path := strings.TrimSuffix(transcriptPath, filepath.Ext(transcriptPath)) + ".voices.json"
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write speaker voices: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,65 @@
+"""Speaker diarization for vkm, run by 'vkm transcribe --diarize'.
+
+Diarizes an audio file with pyannote.audio and prints JSON to stdout:
+
+  {"model": "<embedding model>",
+   "turns": [{"start": 0.0, "end": 4.2, "speaker": "SPEAKER_00"}, ...],
+   "speakers": [{"label": "SPEAKER_00", "embedding": [...], "seconds": 2710.5}, ...]}
+
+"speakers" is in the voice file format 'vkm speakers import' reads.
+Requires pyannote.audio (pip install pyannote.audio) and a Hugging Face
+token with access to the pipeline's gated models in HF_TOKEN.
+"""
+
+import argparse
+import json
+import os
+import sys
+
+
+def main():
+    parser = argparse.ArgumentParser()
+    parser.add_argument("audio")
+    parser.add_argument("--pipeline", default="pyannote/speaker-diarization-3.1")
+    parser.add_argument("--num-speakers", type=int, default=0)
+    args = parser.parse_args()
+
+    try:
+        from pyannote.audio import Pipeline
+    except ImportError:
+        sys.exit("pyannote.audio is not installed (pip install pyannote.audio)")
+
+    pipeline = Pipeline.from_pretrained(args.pipeline, use_auth_token=os.environ.get("HF_TOKEN"))
+    if pipeline is None:
+        sys.exit(f"could not load {args.pipeline}; set HF_TOKEN to a token that has accepted its conditions")
+
+    options = {"return_embeddings": True}
+    if args.num_speakers > 0:
+        options["num_speakers"] = args.num_speakers
+    diarization, embeddings = pipeline(args.audio, **options)
+
+    turns = []
+    seconds = {}
+    for turn, _, label in diarization.itertracks(yield_label=True):
+        turns.append({"start": round(turn.start, 3), "end": round(turn.end, 3), "speaker": label})
+        seconds[label] = seconds.get(label, 0.0) + turn.duration
+
+    # Embeddings are in the order of the diarization's labels
+    speakers = []
+    for label, embedding in zip(diarization.labels(), embeddings):
+        speakers.append({
+            "label": label,
+            "embedding": [float(x) for x in embedding],
+            "seconds": round(seconds.get(label, 0.0), 1),
+        })
+
+    # Voices are only comparable with voices of the same embedding model,
+    # which the pipeline names in its embedding parameter
+    model = getattr(pipeline, "embedding", None)
+    if not isinstance(model, str):
+        model = args.pipeline
+    json.dump({"model": model, "turns": turns, "speakers": speakers}, sys.stdout)
+
+
+if __name__ == "__main__":
+    main()
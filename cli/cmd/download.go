@@ -3,13 +3,10 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
-	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/kkdai/youtube/v2"
-	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 )
 
@@ -19,11 +16,38 @@ var DownloadCmd = &cobra.Command{
 	Short: "Download videos from a YouTube channel",
 	Long: `Download videos from a YouTube channel for processing.
 
-Videos are downloaded as audio-only (MP3) to minimize storage and
-processing time, since we only need audio for transcription.
+The channel's uploads playlist is listed with the YouTube Data API v3
+(--api-key or YOUTUBE_API_KEY), newest first, optionally limited to videos
+published between --date-from and --date-to (inclusive, YYYY-MM-DD). Each
+listing page costs one unit of the daily quota tracked in --manifest (see
+'vkm report quota'). Without a key, or once the quota is spent, only the
+channel's RSS feed is available, which lists the 15 most recent uploads.
+
+Videos are downloaded as audio-only to minimize storage and processing
+time, since we only need audio for transcription. YouTube serves audio
+as M4A (AAC) or WebM (Opus) streams; each is transcoded with ffmpeg to
+--format (MP3 by default), optionally resampled (--sample-rate 16000
+matches what Whisper uses) and re-encoded at --bitrate. Streams already
+in --format with no other option set are kept as they are.
+--no-transcode skips ffmpeg and saves the stream under the extension of
+its container (.m4a or .webm). Videos already downloaded, as recorded in
+--manifest, are skipped.
 
 Example:
-  vkm download --channel UCxxx --output data/videos --max-videos 50`,
+  vkm download --channel UCxxx --output data/videos --max-videos 50
+  vkm download --channel UCxxx --date-from 2024-01-01 --date-to 2024-06-30
+  vkm download --channel UCxxx --date-from 2024-01-01 --dry-run
+
+` + downloaderHelp + `
+
+` + rateLimitHelp + `
+
+` + dryRunHelp + ` Channel listings don't include durations, so they are looked
+  up with yt-dlp when it is installed.
+
+` + nameTemplateHelp + `
+
+` + layoutHelp,
 	RunE: runDownload,
 }
 
@@ -34,6 +58,15 @@ var (
 	dateFrom   string
 	dateTo     string
 	audioOnly  bool
+
+	downloadNameTemplate string
+	downloadAPIKey       string
+	downloadManifest     string
+
+	downloadFormat      string
+	downloadSampleRate  int
+	downloadBitrate     string
+	downloadNoTranscode bool
 )
 
 func init() {
@@ -43,10 +76,27 @@ func init() {
 	DownloadCmd.Flags().StringVar(&dateFrom, "date-from", "", "Download videos from this date (YYYY-MM-DD)")
 	DownloadCmd.Flags().StringVar(&dateTo, "date-to", "", "Download videos until this date (YYYY-MM-DD)")
 	DownloadCmd.Flags().BoolVar(&audioOnly, "audio-only", true, "Download audio only (default: true)")
+	DownloadCmd.Flags().StringVar(&downloadNameTemplate, "name-template", defaultNameTemplate, "Go template for output file names")
+	DownloadCmd.Flags().StringVar(&outputLayout, "layout", layoutFlat, "Output layout: flat, or per-video for a directory of files per video")
+	DownloadCmd.Flags().StringVar(&downloadAPIKey, "api-key", "", "YouTube Data API key (default $YOUTUBE_API_KEY)")
+	DownloadCmd.Flags().StringVar(&downloadManifest, "manifest", "data/manifest.db", "SQLite manifest recording downloads and Data API quota")
+	DownloadCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	DownloadCmd.Flags().StringVar(&downloadFormat, "format", "mp3", "Audio format to transcode downloads to (mp3, m4a, wav, opus, flac)")
+	DownloadCmd.Flags().IntVar(&downloadSampleRate, "sample-rate", 0, "Audio sample rate in Hz (e.g. 16000; 0 keeps the stream's)")
+	DownloadCmd.Flags().StringVar(&downloadBitrate, "bitrate", "", "Audio bitrate (e.g. 64k; default is ffmpeg's for the format)")
+	DownloadCmd.Flags().BoolVar(&downloadNoTranscode, "no-transcode", false, "Keep the downloaded stream as is, named for its container")
+
+	DownloadCmd.Flags().StringVar(&downloaderChoice, "downloader", downloaderAuto, "Downloader to use (auto, yt-dlp, native)")
+	DownloadCmd.Flags().StringVar(&downloadRateLimit, "rate-limit", "", "Maximum download rate in bytes per second (e.g. 500K, 2M)")
+	DownloadCmd.Flags().DurationVar(&downloadSleepBetween, "sleep-between", 0, "Time to wait between downloads (e.g. 5s)")
+	DownloadCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the videos that would be downloaded, without downloading")
 
 	DownloadCmd.MarkFlagRequired("channel")
 }
 
+// VideoMetadata is what 'vkm download' learns about a video. It is saved
+// as an info.json sidecar (see videoMetadataInfo); older versions saved it
+// as is in <id>.json, which 'vkm normalize' converts.
 type VideoMetadata struct {
 	VideoID     string    `json:"video_id"`
 	Title       string    `json:"title"`
@@ -54,142 +104,160 @@ type VideoMetadata struct {
 	PublishedAt time.Time `json:"published_at"`
 	Duration    int       `json:"duration"`
 	FilePath    string    `json:"file_path"`
+	Chapters    []Chapter `json:"chapters,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Thumbnail   string    `json:"thumbnail,omitempty"`
 }
 
 func runDownload(cmd *cobra.Command, args []string) error {
-	// Create output directory
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+	if !downloadNoTranscode && !dryRun {
+		if err := checkTranscodeOptions(transcodeOptions{Format: downloadFormat, SampleRate: downloadSampleRate, Bitrate: downloadBitrate}); err != nil {
+			return err
+		}
+		if _, err := findTool("ffmpeg"); err != nil {
+			return fmt.Errorf("%w (required to transcode downloads; --no-transcode keeps the original streams)", err)
+		}
+	}
+	after, err := parseDateFlag("date-from", dateFrom)
+	if err != nil {
+		return err
+	}
+	before, err := parseDateFlag("date-to", dateTo)
+	if err != nil {
+		return err
+	}
+	if !before.IsZero() {
+		// --date-to is inclusive
+		before = before.AddDate(0, 0, 1)
+	}
+	if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+		return fmt.Errorf("--date-from must not be after --date-to")
 	}
 
 	fmt.Printf("Downloading videos from channel: %s\n", channelID)
 	fmt.Printf("Output directory: %s\n", outputDir)
 	fmt.Printf("Max videos: %d\n", maxVideos)
-
-	// Initialize YouTube client
-	client := youtube.Client{}
-
-	// For this example, we'll show how to download a single video
-	// In production, you would:
-	// 1. Use YouTube Data API to list channel videos
-	// 2. Filter by date range
-	// 3. Download each video
-
-	// NOTE: This is a simplified example.
-	// Full implementation would require YouTube Data API v3 integration
-	// to list channel videos, which requires API credentials.
-
-	fmt.Println("\nNOTE: Full channel download requires YouTube Data API v3 credentials.")
-	fmt.Println("For now, this is a template showing the download structure.")
-	fmt.Println("\nTo implement full channel download:")
-	fmt.Println("1. Get YouTube Data API key from Google Cloud Console")
-	fmt.Println("2. Use google.golang.org/api/youtube/v3 to list channel videos")
-	fmt.Println("3. Filter by date range and download each video")
-
-	// Example: Download a single video if video ID is provided
-	if len(args) > 0 {
-		videoID := args[0]
-		if err := downloadVideo(&client, videoID, outputDir); err != nil {
-			return fmt.Errorf("failed to download video %s: %w", videoID, err)
-		}
+	if dateFrom != "" || dateTo != "" {
+		fmt.Printf("Published: %s to %s\n", orDefault(dateFrom, "beginning"), orDefault(dateTo, "today"))
 	}
 
-	return nil
-}
-
-func downloadVideo(client *youtube.Client, videoID string, outputDir string) error {
-	fmt.Printf("\nDownloading video: %s\n", videoID)
+	apiKey := downloadAPIKey
+	if apiKey == "" {
+		apiKey = youtubeAPIKey()
+	}
+	if apiKey == "" {
+		fmt.Fprintln(os.Stderr, "Warning: no YouTube Data API key (--api-key or YOUTUBE_API_KEY); only the 15 most recent uploads can be listed")
+	}
 
-	// Get video metadata
-	video, err := client.GetVideo(videoID)
+	manifest, err := openManifest(downloadManifest)
 	if err != nil {
-		return fmt.Errorf("failed to get video metadata: %w", err)
+		return err
 	}
+	defer manifest.Close()
 
-	fmt.Printf("Title: %s\n", video.Title)
-	fmt.Printf("Author: %s\n", video.Author)
-	fmt.Printf("Duration: %s\n", video.Duration)
-
-	// Get audio stream
-	formats := video.Formats.WithAudioChannels()
-	if len(formats) == 0 {
-		return fmt.Errorf("no audio formats available")
+	entries, err := listChannelVideos(cmd.Context(), channelID, maxVideos, after, before, apiKey, manifest)
+	if err != nil {
+		return fmt.Errorf("failed to list channel videos: %w", err)
 	}
+	fmt.Printf("Found %d videos\n", len(entries))
 
-	// Choose format (prefer smallest audio for efficiency)
-	format := formats[0]
-	for _, f := range formats {
-		if f.Bitrate < format.Bitrate {
-			format = f
+	if dryRun {
+		items := make([]pipelineItem, len(entries))
+		for i, e := range entries {
+			items[i] = pipelineItem{URL: "https://www.youtube.com/watch?v=" + e.VideoID, VideoID: e.VideoID, Title: e.Title, PublishedAt: e.PublishedAt}
+		}
+		if err := fillVideoDetails(cmd.Context(), items); err != nil {
+			return err
 		}
+		fmt.Println()
+		printDryRun(items, "downloaded", func(pipelineItem) string { return "" })
+		return nil
 	}
 
-	fmt.Printf("Format: %s (bitrate: %d)\n", format.MimeType, format.Bitrate)
+	// Create output directory
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
 
-	// Prepare output file
-	outputPath := filepath.Join(outputDir, fmt.Sprintf("%s.mp3", videoID))
-	file, err := os.Create(outputPath)
+	names, err := parseNameTemplate(downloadNameTemplate)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return err
 	}
-	defer file.Close()
-
-	// Download stream with progress bar
-	stream, size, err := client.GetStream(video, &format)
+	if err := names.setLayout(outputLayout); err != nil {
+		return err
+	}
+	transcode := transcodeOptions{Format: downloadFormat, SampleRate: downloadSampleRate, Bitrate: downloadBitrate}
+	downloader, err := selectDownloader(transcode, downloadNoTranscode)
 	if err != nil {
-		return fmt.Errorf("failed to get stream: %w", err)
+		return err
 	}
-	defer stream.Close()
 
-	bar := progressbar.DefaultBytes(
-		size,
-		"downloading",
-	)
+	var failed []string
+	downloaded, skipped := 0, 0
+	for i, entry := range entries {
+		if cmd.Context().Err() != nil {
+			fmt.Println("Interrupted")
+			break
+		}
+		fmt.Printf("\n[%d/%d] %s (%s)\n", i+1, len(entries), entry.Title, entry.PublishedAt.Format("2006-01-02"))
+		item := pipelineItem{URL: "https://www.youtube.com/watch?v=" + entry.VideoID, VideoID: entry.VideoID}
+		media, present, err := downloadResumable(cmd.Context(), downloader, manifest, item, outputDir, "", names)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Warning: Failed to download %s: %v\n", entry.VideoID, err)
+			failed = append(failed, entry.VideoID)
+		case present:
+			fmt.Printf("Already downloaded: %s\n", media.Path)
+			skipped++
+		default:
+			if media.Path != "" {
+				fmt.Printf("Saved as: %s\n", media.Path)
+			}
+			downloaded++
+		}
+	}
 
-	// Copy stream to file with progress
-	_, err = io.Copy(io.MultiWriter(file, bar), stream)
-	if err != nil {
-		return fmt.Errorf("failed to download stream: %w", err)
+	// Videos already present, and those an interruption left, aren't
+	// counted as downloaded
+	fmt.Printf("\nDownloaded %d/%d videos to %s\n", downloaded, len(entries), outputDir)
+	if skipped > 0 {
+		fmt.Printf("Skipped %d already downloaded\n", skipped)
+	}
+	if len(failed) > 0 {
+		fmt.Printf("Failed: %s\n", strings.Join(failed, ", "))
 	}
 
-	fmt.Printf("\nDownloaded to: %s\n", outputPath)
+	return nil
+}
 
-	// Save metadata
-	metadata := VideoMetadata{
-		VideoID:     videoID,
-		Title:       video.Title,
-		ChannelID:   video.Author,
-		PublishedAt: video.PublishDate,
-		Duration:    int(video.Duration.Seconds()),
-		FilePath:    outputPath,
+// parseDateFlag parses a YYYY-MM-DD flag value as midnight UTC; an empty
+// value gives the zero time
+func parseDateFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
 	}
-
-	metadataPath := filepath.Join(outputDir, fmt.Sprintf("%s.json", videoID))
-	if err := saveMetadata(metadata, metadataPath); err != nil {
-		return fmt.Errorf("failed to save metadata: %w", err)
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s %q (use YYYY-MM-DD)", name, value)
 	}
+	return t, nil
+}
 
-	return nil
+// orDefault returns s, or def when s is empty
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
 }
 
+// saveMetadata writes metadata as the video's canonical sidecar, in
+// yt-dlp's info.json format
 func saveMetadata(metadata VideoMetadata, path string) error {
-	data, err := json.MarshalIndent(metadata, "", "  ")
+	data, err := json.MarshalIndent(videoMetadataInfo(metadata), "", "  ")
 	if err != nil {
 		return err
 	}
 
 	return os.WriteFile(path, data, 0644)
 }
-
-// Helper function to download channel videos (template)
-func downloadChannelVideos(channelID string, maxVideos int, outputDir string) error {
-	// This would require YouTube Data API v3
-	// Steps:
-	// 1. Initialize YouTube Data API client with credentials
-	// 2. List channel uploads playlist
-	// 3. Get video IDs from playlist
-	// 4. Filter by date range if specified
-	// 5. Download each video using downloadVideo()
-
-	return fmt.Errorf("channel download requires YouTube Data API v3 - not implemented in this template")
-}
@@ -1,28 +1,45 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 )
 
 // DownloadSimpleCmd downloads videos using yt-dlp
 var DownloadSimpleCmd = &cobra.Command{
-	Use:   "download-simple [video-urls...]",
-	Short: "Download videos using yt-dlp",
-	Long: `Download YouTube videos using yt-dlp (must be installed).
+	Use:   "download-simple [video-urls...|-]",
+	Short: "Download videos and audio using yt-dlp",
+	Long: `Download YouTube videos, or audio and video from SoundCloud, Vimeo and
+any other site yt-dlp supports (see Sites below), using yt-dlp, or
+YouTube videos with the built-in YouTube client when yt-dlp isn't
+installed (see Downloader below).
 
 This is a simplified download that works with direct video URLs.
 For bulk channel downloads, use download --channel.
 
-Requirements:
-  - yt-dlp installed: pip install yt-dlp
-  - ffmpeg installed: brew install ffmpeg (or apt install ffmpeg)
+Downloads are recorded in the manifest, so running the same command again
+skips videos whose audio is already on disk and continues interrupted
+downloads from yt-dlp's partial files.
+
+With --prefer-captions, videos that have manual or automatic captions in
+--caption-langs get a transcript built from them in --transcripts instead
+of an audio download, so they need no Whisper transcription; only videos
+without captions are downloaded as audio.
+
+Requirements (recommended; see Downloader below):
+  - yt-dlp on PATH (pip install yt-dlp, brew install yt-dlp or
+    winget install yt-dlp.yt-dlp)
+  - ffmpeg on PATH (brew/apt install ffmpeg or winget install Gyan.FFmpeg)
 
 Examples:
   # Single video
@@ -31,28 +48,92 @@ Examples:
   # Multiple videos
   vkm download-simple https://youtube.com/watch?v=abc123 https://youtube.com/watch?v=def456
 
+  # A SoundCloud track and a Vimeo video, each site named its own way
+  vkm download-simple \
+    --site-name-template soundcloud='{{.ChannelSlug}}/{{.TitleSlug}}' \
+    https://soundcloud.com/artist/track-name https://vimeo.com/76979871
+
   # With custom output directory
-  vkm download-simple --output ./my-videos https://youtube.com/watch?v=abc123`,
+  vkm download-simple --output ./my-videos https://youtube.com/watch?v=abc123
+
+  # Four downloads at a time from a list of URLs
+  vkm download-simple --concurrency 4 --from-file urls.txt
+
+  # URLs generated by a script
+  ./list-talks.sh | vkm download-simple -
+
+` + siteHelp + `
+
+` + downloaderHelp + `
+
+` + rateLimitHelp + `
+
+` + urlListHelp + `
+
+` + downloadArchiveHelp + `
+
+` + sponsorBlockHelp + `
+
+` + nameTemplateHelp + `
+
+` + layoutHelp,
 	RunE: runDownloadSimple,
 }
 
 var (
-	simpleOutputDir string
-	audioFormat     string
+	simpleOutputDir    string
+	audioFormat        string
+	simpleNameTemplate string
+	simpleManifest     string
+	simpleConcurrency  int
+	simpleCaptions     bool
+	simpleTranscripts  string
+	captionLangs       string
 )
 
 func init() {
 	DownloadSimpleCmd.Flags().StringVarP(&simpleOutputDir, "output", "o", "data/videos", "Output directory")
 	DownloadSimpleCmd.Flags().StringVar(&audioFormat, "format", "mp3", "Audio format (mp3, wav, m4a)")
+	DownloadSimpleCmd.Flags().StringVar(&simpleNameTemplate, "name-template", defaultNameTemplate, "Go template for output file names")
+	DownloadSimpleCmd.Flags().StringVar(&outputLayout, "layout", layoutFlat, "Output layout: flat, or per-video for a directory of files per video")
+	DownloadSimpleCmd.Flags().StringToStringVar(&siteNameTemplates, "site-name-template", nil, "Name template for one site, as site=template (repeatable)")
+	DownloadSimpleCmd.Flags().StringVar(&simpleManifest, "manifest", "data/manifest.db", "SQLite manifest recording completed downloads")
+	DownloadSimpleCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	DownloadSimpleCmd.Flags().IntVarP(&simpleConcurrency, "concurrency", "j", 1, "Number of downloads to run in parallel")
+	DownloadSimpleCmd.Flags().BoolVar(&simpleCaptions, "prefer-captions", false, "Save existing YouTube captions as transcripts instead of downloading audio")
+	DownloadSimpleCmd.Flags().StringVar(&simpleTranscripts, "transcripts", "data/transcripts", "Directory for caption transcripts (with --prefer-captions)")
+	DownloadSimpleCmd.Flags().StringVar(&captionLangs, "caption-langs", defaultCaptionLangs, "Caption languages to accept, as yt-dlp --sub-langs")
+	DownloadSimpleCmd.Flags().StringVar(&downloadArchivePath, "download-archive", defaultDownloadArchive, "File listing completed videos to skip")
+	DownloadSimpleCmd.Flags().BoolVar(&downloadForce, "force", false, "Download videos even if the download archive lists them")
+	DownloadSimpleCmd.Flags().StringVar(&sponsorBlockCategories, "sponsorblock-remove", defaultSponsorBlockCategories, "SponsorBlock categories to cut from audio and captions (none keeps videos whole)")
+	DownloadSimpleCmd.Flags().StringVar(&downloaderChoice, "downloader", downloaderAuto, "Downloader to use (auto, yt-dlp, native)")
+	DownloadSimpleCmd.Flags().StringVar(&downloadRateLimit, "rate-limit", "", "Maximum download rate in bytes per second (e.g. 500K, 2M)")
+	DownloadSimpleCmd.Flags().DurationVar(&downloadSleepBetween, "sleep-between", 0, "Time to wait between downloads (e.g. 5s)")
+	DownloadSimpleCmd.Flags().StringVar(&urlListFile, "from-file", "", "Read more video URLs from this file, one per line (- for stdin)")
 }
 
 func runDownloadSimple(cmd *cobra.Command, args []string) error {
-	if len(args) == 0 {
-		return fmt.Errorf("no video URLs provided")
+	args, err := expandURLArgs(args)
+	if err != nil {
+		return err
+	}
+	if simpleConcurrency < 1 {
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+
+	downloader, err := selectDownloader(transcodeOptions{Format: audioFormat}, false)
+	if err != nil {
+		return err
+	}
+	if err := checkMediaURLs(args, downloader); err != nil {
+		return err
 	}
 
-	// Check if yt-dlp is installed
-	if err := checkYtDlpInstalled(); err != nil {
+	names, err := parseSiteNameTemplates(simpleNameTemplate, siteNameTemplates)
+	if err != nil {
+		return err
+	}
+	if err := names.setLayout(outputLayout); err != nil {
 		return err
 	}
 
@@ -61,89 +142,440 @@ func runDownloadSimple(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
+	manifest, err := openManifest(simpleManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	archive, err := openDownloadArchive(downloadArchivePath)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	transcriptDir := ""
+	if simpleCaptions {
+		transcriptDir = captionDir(names, simpleTranscripts, simpleOutputDir)
+	}
+	workers := min(simpleConcurrency, len(args))
 	fmt.Printf("Downloading %d video(s) to %s\n\n", len(args), simpleOutputDir)
+	if workers > 1 {
+		// Interleaved progress bars are unreadable; download errors are
+		// still reported with each failure
+		downloadQuiet = true
+		defer func() { downloadQuiet = false }()
+	}
 
-	for i, url := range args {
-		fmt.Printf("[%d/%d] Downloading: %s\n", i+1, len(args), url)
+	var (
+		mu        sync.Mutex
+		finished  int
+		captioned int
+		failures  []downloadFailure
+	)
+	report := func(url string, media *downloadedMedia, skipped bool, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		finished++
+		prefix := ""
+		if workers > 1 {
+			prefix = fmt.Sprintf("[%d/%d] ", finished, len(args))
+		}
+		switch {
+		case err != nil:
+			failures = append(failures, downloadFailure{URL: url, Err: err})
+			fmt.Fprintf(os.Stderr, "%s✗ Failed to download %s: %v\n\n", prefix, url, err)
+		case skipped && media.Path == "":
+			fmt.Printf("%s✓ In download archive: %s (use --force to download again)\n\n", prefix, media.VideoID)
+		case skipped:
+			fmt.Printf("%s✓ Already downloaded: %s\n\n", prefix, media.Path)
+		case media.Captions:
+			captioned++
+			fmt.Printf("%s✓ Transcript from captions: %s\n\n", prefix, media.Path)
+		default:
+			fmt.Printf("%s✓ Downloaded successfully: %s\n\n", prefix, media.Path)
+		}
+	}
 
-		if err := downloadVideoWithYtDlp(url, simpleOutputDir); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Failed to download %s: %v\n", url, err)
-			continue
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				url := args[i]
+				if workers == 1 {
+					fmt.Printf("[%d/%d] Downloading: %s\n", i+1, len(args), url)
+				}
+				item := pipelineItem{URL: url, VideoID: videoIDFromURL(url)}
+				if archive.Skip(item) {
+					report(url, &downloadedMedia{VideoID: item.VideoID}, true, nil)
+					continue
+				}
+				media, skipped, err := downloadResumable(ctx, downloader, manifest, item, simpleOutputDir, transcriptDir, names)
+				if ctx.Err() != nil {
+					return
+				}
+				if err == nil {
+					archive.Add(item, media.VideoID)
+				}
+				report(url, media, skipped, err)
+			}
+		}()
+	}
+
+feed:
+	for i := range args {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			break feed
 		}
+	}
+	close(queue)
+	wg.Wait()
 
-		fmt.Printf("✓ Downloaded successfully\n\n")
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if len(failures) > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d downloads failed:\n", len(failures), len(args))
+		for _, f := range failures {
+			fmt.Fprintf(os.Stderr, "  %s: %v\n", f.URL, f.Err)
+		}
+		fmt.Fprintln(os.Stderr)
 	}
 
 	fmt.Println("Download complete!")
 	fmt.Printf("Videos saved to: %s\n", simpleOutputDir)
+	if captioned > 0 {
+		fmt.Printf("Transcripts from captions saved to: %s (%d videos)\n", transcriptDir, captioned)
+	}
 	fmt.Println("\nNext step: Transcribe the videos")
 	fmt.Printf("  vkm transcribe --input %s --output data/transcripts\n", simpleOutputDir)
 
 	return nil
 }
 
+// downloadFailure is a URL that could not be downloaded and why
+type downloadFailure struct {
+	URL string
+	Err error
+}
+
 func checkYtDlpInstalled() error {
-	cmd := exec.Command("yt-dlp", "--version")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("yt-dlp not found. Install with: pip install yt-dlp")
+	path, err := findTool("yt-dlp")
+	if err != nil {
+		return err
 	}
+	version, err := ytDlpVersion(path)
+	if err != nil {
+		return fmt.Errorf("yt-dlp at %s failed to run: %w", path, err)
+	}
+	warnIfYtDlpStale(version)
 	return nil
 }
 
-func downloadVideoWithYtDlp(url string, outputDir string) error {
-	// Download audio only in specified format
-	outputTemplate := filepath.Join(outputDir, "%(id)s.%(ext)s")
+// downloadVideoWithYtDlp downloads one video's audio as <id>.<ext> with
+// an <id>.info.json sidecar; callers apply name templates afterwards
+func downloadVideoWithYtDlp(ctx context.Context, url string, outputDir string) (*downloadedMedia, error) {
+	return ytDlpDownloader{Transcode: transcodeOptions{Format: audioFormat}}.Download(ctx, url, outputDir)
+}
+
+// downloadResumable downloads url's audio into dir with d and names it, unless the
+// manifest shows the audio is already on disk, in which case it reports the
+// earlier download as skipped. So are items whose files 'vkm clean'
+// removed once they were transcribed, unless --force. With a
+// transcriptDir, the video's captions are saved there as a transcript
+// when it has any, and audio is only downloaded when it doesn't. A known
+// item.VideoID lets a download made under another URL form count, and
+// item.PlaylistIndex fills the template field single-video downloads
+// lack. Fetches wait out --sleep-between after the previous one. An
+// interrupted download leaves yt-dlp's .part file behind, which the next
+// attempt continues.
+func downloadResumable(ctx context.Context, d videoDownloader, m *Manifest, item pipelineItem, dir, transcriptDir string, names *nameTemplate) (*downloadedMedia, bool, error) {
+	return resumeDownload(ctx, d, m, item, dir, transcriptDir, names, !downloadForce)
+}
+
+// resumeDownload is downloadResumable, skipping items 'vkm clean' pruned
+// only with skipPruned; callers that need the audio itself pass false
+func resumeDownload(ctx context.Context, d videoDownloader, m *Manifest, item pipelineItem, dir, transcriptDir string, names *nameTemplate, skipPruned bool) (*downloadedMedia, bool, error) {
+	url, videoID := item.URL, item.VideoID
+	prev, err := m.GetItem(url)
+	if err == nil && prev == nil && videoID != "" {
+		prev, err = m.ItemByVideoID(videoID)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if prev != nil && prev.State != ItemPending {
+		if prev.Pruned() && skipPruned {
+			return &downloadedMedia{VideoID: prev.VideoID, Path: orDefault(prev.TranscriptPath, prev.AudioPath)}, true, nil
+		}
+		if _, err := os.Stat(prev.AudioPath); err == nil && prev.AudioPath != "" {
+			return &downloadedMedia{VideoID: prev.VideoID, Path: prev.AudioPath}, true, nil
+		}
+		if _, err := os.Stat(prev.TranscriptPath); err == nil && prev.TranscriptPath != "" && transcriptDir != "" {
+			return &downloadedMedia{VideoID: prev.VideoID, Path: prev.TranscriptPath, Captions: true}, true, nil
+		}
+	}
 
-	args := []string{
-		"--extract-audio",
-		"--audio-format", audioFormat,
-		"--output", outputTemplate,
-		"--write-info-json", // Save metadata
-		"--no-playlist",     // Don't download playlists
-		"--quiet",           // Suppress most output
-		"--progress",        // Show progress
-		url,
+	if err := downloadPacer.wait(ctx); err != nil {
+		return nil, false, err
 	}
 
-	cmd := exec.Command("yt-dlp", args...)
+	// Items the pipeline already took further keep their state; only the
+	// audio is fetched again
+	state := ItemDownloaded
+	if prev != nil && (prev.State == ItemTranscribed || prev.State == ItemProcessed) {
+		state = prev.State
+	} else {
+		recordItem(m, ManifestItem{URL: url, VideoID: videoID, State: ItemPending})
+	}
+
+	if transcriptDir != "" && d.Features().Captions {
+		media, _, err := captionTranscript(ctx, item, transcriptDir, captionLangs, names)
+		downloadPacer.done(downloadSleepBetween)
+		if err != nil && ctx.Err() != nil {
+			return nil, false, err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; downloading audio instead\n", err)
+		}
+		if media != nil {
+			if state == ItemDownloaded {
+				state = ItemTranscribed
+			}
+			recordItem(m, withCatalog(ManifestItem{URL: url, VideoID: media.VideoID, State: state, TranscriptPath: media.Path, TranscriptModel: transcriptFromCaptions}, media.InfoPath))
+			return media, false, nil
+		}
+	}
+
+	media, err := d.Download(ctx, url, dir)
+	downloadPacer.done(downloadSleepBetween)
+	if err != nil {
+		if state == ItemDownloaded {
+			failed := ItemFailed
+			if ctx.Err() != nil {
+				failed = ItemCanceled
+			}
+			recordItem(m, ManifestItem{URL: url, State: failed, Error: err.Error()})
+		}
+		return nil, false, err
+	}
+	if info, err := loadVideoMetadata(media.InfoPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to read metadata for %s: %v\n", media.VideoID, err)
+	} else {
+		fields := nameFieldsFromInfo(info)
+		if fields.PlaylistIndex == 0 {
+			fields.PlaylistIndex = item.PlaylistIndex
+		}
+		if err := applyNameTemplate(names, dir, media, fields); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	recordItem(m, withCatalog(ManifestItem{URL: url, VideoID: media.VideoID, State: state, AudioPath: media.Path}, media.InfoPath))
+	return media, false, nil
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// runYtDlpDownload runs yt-dlp and returns the files it produced. yt-dlp
+// records each final path (after audio extraction) in a temp file, so
+// callers don't have to guess which file in the directory is new.
+func runYtDlpDownload(ctx context.Context, args []string) ([]*downloadedMedia, error) {
+	printed, err := newTempFile("ytdlp-*.txt")
+	if err != nil {
+		return nil, err
+	}
+	printed.Close()
+	defer os.Remove(printed.Name())
+
+	args = append([]string{"--print-to-file", "after_move:%(id)s\t%(filepath)s", printed.Name()}, args...)
+
+	// stderr is kept to explain failures even when it is also shown
+	var stderr bytes.Buffer
+	cmd, cleanup := ytDlpCommand(ctx, args...)
+	defer cleanup()
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if downloadQuiet {
+		cmd.Stdout = io.Discard
+		cmd.Stderr = &stderr
+	}
+
+	runErr := cmd.Run()
+	if runErr != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if runErr != nil {
+		runErr = ytDlpError(runErr, stderr.String())
+	}
+
+	// Collect what finished even if a later item failed
+	f, err := os.Open(printed.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read yt-dlp output: %w", err)
+	}
+	defer f.Close()
+
+	var media []*downloadedMedia
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		id, path, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok || path == "" {
+			continue
+		}
+		media = append(media, &downloadedMedia{
+			VideoID:  id,
+			Path:     path,
+			InfoPath: strings.TrimSuffix(path, filepath.Ext(path)) + ".info.json",
+		})
+	}
 
-	return cmd.Run()
+	if runErr != nil && len(media) == 0 {
+		return nil, runErr
+	}
+	return media, nil
 }
 
 // DownloadPlaylistCmd downloads a full playlist
 var DownloadPlaylistCmd = &cobra.Command{
-	Use:   "download-playlist [playlist-url]",
-	Short: "Download full YouTube playlist",
-	Long: `Download all videos from a YouTube playlist.
+	Use:   "download-playlist [playlist-urls...|-]",
+	Short: "Download a full playlist, set or album",
+	Long: `Download all videos from a YouTube playlist, or every item of a
+collection on another site yt-dlp supports: a SoundCloud set, a Vimeo
+showcase, a Bandcamp album (see Sites below).
+
+Requirements: yt-dlp recommended (see Downloader below)
+
+Videos are downloaded one by one and recorded in the manifest, so running
+the command again skips videos whose audio is already on disk and
+continues interrupted downloads.
+
+--prefer-captions saves transcripts built from existing captions instead
+of audio, as for download-simple.
+
+Several playlists are downloaded one after another, each up to
+--max-videos.
+
+Examples:
+  vkm download-playlist https://youtube.com/playlist?list=PLxxx
+  vkm download-playlist --from-file playlists.txt
+  vkm download-playlist --dry-run https://youtube.com/playlist?list=PLxxx
+  vkm download-playlist https://soundcloud.com/artist/sets/live-recordings
+
+` + siteHelp + `
+
+` + downloaderHelp + `
+
+` + rateLimitHelp + `
+
+` + dryRunHelp + `
 
-Requirements: yt-dlp installed
+` + urlListHelp + `
 
-Example:
-  vkm download-playlist https://youtube.com/playlist?list=PLxxx`,
+` + downloadArchiveHelp + `
+
+` + sponsorBlockHelp + `
+
+` + durationFilterHelp + `
+
+` + nameTemplateHelp + `
+
+` + layoutHelp,
 	RunE: runDownloadPlaylist,
 }
 
 var (
-	playlistOutputDir string
-	playlistMaxVideos int
+	playlistOutputDir    string
+	playlistMaxVideos    int
+	playlistNameTemplate string
+	playlistManifest     string
+	playlistCaptions     bool
+	playlistTranscripts  string
 )
 
 func init() {
 	DownloadPlaylistCmd.Flags().StringVarP(&playlistOutputDir, "output", "o", "data/videos", "Output directory")
 	DownloadPlaylistCmd.Flags().IntVar(&playlistMaxVideos, "max-videos", 50, "Maximum videos to download")
+	DownloadPlaylistCmd.Flags().StringVar(&playlistNameTemplate, "name-template", defaultPlaylistNameTemplate, "Go template for output file names")
+	DownloadPlaylistCmd.Flags().StringVar(&outputLayout, "layout", layoutFlat, "Output layout: flat, or per-video for a directory of files per video")
+	DownloadPlaylistCmd.Flags().StringToStringVar(&siteNameTemplates, "site-name-template", nil, "Name template for one site, as site=template (repeatable)")
+	DownloadPlaylistCmd.Flags().StringVar(&playlistManifest, "manifest", "data/manifest.db", "SQLite manifest recording completed downloads")
+	DownloadPlaylistCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	DownloadPlaylistCmd.Flags().BoolVar(&playlistCaptions, "prefer-captions", false, "Save existing YouTube captions as transcripts instead of downloading audio")
+	DownloadPlaylistCmd.Flags().StringVar(&playlistTranscripts, "transcripts", "data/transcripts", "Directory for caption transcripts (with --prefer-captions)")
+	DownloadPlaylistCmd.Flags().StringVar(&captionLangs, "caption-langs", defaultCaptionLangs, "Caption languages to accept, as yt-dlp --sub-langs")
+	DownloadPlaylistCmd.Flags().StringVar(&downloadArchivePath, "download-archive", defaultDownloadArchive, "File listing completed videos to skip")
+	DownloadPlaylistCmd.Flags().BoolVar(&downloadForce, "force", false, "Download videos even if the download archive lists them")
+	DownloadPlaylistCmd.Flags().StringVar(&sponsorBlockCategories, "sponsorblock-remove", defaultSponsorBlockCategories, "SponsorBlock categories to cut from audio and captions (none keeps videos whole)")
+	DownloadPlaylistCmd.Flags().StringVar(&downloaderChoice, "downloader", downloaderAuto, "Downloader to use (auto, yt-dlp, native)")
+	DownloadPlaylistCmd.Flags().StringVar(&downloadRateLimit, "rate-limit", "", "Maximum download rate in bytes per second (e.g. 500K, 2M)")
+	DownloadPlaylistCmd.Flags().DurationVar(&downloadSleepBetween, "sleep-between", 0, "Time to wait between downloads (e.g. 5s)")
+	DownloadPlaylistCmd.Flags().DurationVar(&minDuration, "min-duration", 0, "Skip videos shorter than this (e.g. 2m)")
+	DownloadPlaylistCmd.Flags().DurationVar(&maxDuration, "max-duration", 0, "Skip videos longer than this (e.g. 3h)")
+	DownloadPlaylistCmd.Flags().StringVar(&urlListFile, "from-file", "", "Read more playlist URLs from this file, one per line (- for stdin)")
+	DownloadPlaylistCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the videos that would be downloaded, without downloading")
 }
 
 func runDownloadPlaylist(cmd *cobra.Command, args []string) error {
-	if len(args) == 0 {
-		return fmt.Errorf("no playlist URL provided")
+	playlistURLs, err := expandURLArgs(args)
+	if err != nil {
+		return err
+	}
+
+	downloader, err := selectDownloader(transcodeOptions{Format: audioFormat}, false)
+	if err != nil {
+		return err
+	}
+	if err := checkMediaURLs(playlistURLs, downloader); err != nil {
+		return err
+	}
+
+	if err := checkDurationLimits(); err != nil {
+		return err
+	}
+	names, err := parseSiteNameTemplates(playlistNameTemplate, siteNameTemplates)
+	if err != nil {
+		return err
+	}
+	if err := names.setLayout(outputLayout); err != nil {
+		return err
+	}
+
+	fmt.Printf("Downloading %d playlist(s): %s\n", len(playlistURLs), strings.Join(playlistURLs, ", "))
+	fmt.Printf("Output directory: %s\n", playlistOutputDir)
+	fmt.Printf("Max videos: %d\n\n", playlistMaxVideos)
+
+	archive, err := openDownloadArchive(downloadArchivePath)
+	if err != nil {
+		return err
 	}
 
-	playlistURL := args[0]
+	var entries []pipelineItem
+	for _, playlistURL := range playlistURLs {
+		found, err := downloader.ListPlaylist(cmd.Context(), playlistURL)
+		if err != nil {
+			return err
+		}
+		if len(found) > playlistMaxVideos {
+			found = found[:playlistMaxVideos]
+		}
+		entries = append(entries, found...)
+	}
 
-	// Check if yt-dlp is installed
-	if err := checkYtDlpInstalled(); err != nil {
+	if dryRun {
+		return dryRunDownloads(cmd.Context(), entries, archive, playlistManifest)
+	}
+	if entries, err = applyDurationLimits(cmd.Context(), entries); err != nil {
 		return err
 	}
 
@@ -152,29 +584,47 @@ func runDownloadPlaylist(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	fmt.Printf("Downloading playlist: %s\n", playlistURL)
-	fmt.Printf("Output directory: %s\n", playlistOutputDir)
-	fmt.Printf("Max videos: %d\n\n", playlistMaxVideos)
-
-	outputTemplate := filepath.Join(playlistOutputDir, "%(playlist_index)s-%(id)s.%(ext)s")
+	manifest, err := openManifest(playlistManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
 
-	args = []string{
-		"--extract-audio",
-		"--audio-format", audioFormat,
-		"--output", outputTemplate,
-		"--write-info-json",
-		"--max-downloads", fmt.Sprintf("%d", playlistMaxVideos),
-		"--yes-playlist",
-		playlistURL,
+	transcriptDir := ""
+	if playlistCaptions {
+		transcriptDir = captionDir(names, playlistTranscripts, playlistOutputDir)
 	}
 
-	dlCmd := exec.Command("yt-dlp", args...)
-	dlCmd.Stdout = os.Stdout
-	dlCmd.Stderr = os.Stderr
+	var downloaded, captioned, skipped, failed int
+	for i, entry := range entries {
+		fmt.Printf("[%d/%d] %s\n", i+1, len(entries), entry.URL)
+		if archive.Skip(entry) {
+			fmt.Printf("✓ In download archive: %s\n", entry.VideoID)
+			skipped++
+			continue
+		}
 
-	if err := dlCmd.Run(); err != nil {
-		return fmt.Errorf("download failed: %w", err)
+		media, done, err := downloadResumable(cmd.Context(), downloader, manifest, entry, playlistOutputDir, transcriptDir, names)
+		if err == nil {
+			archive.Add(entry, media.VideoID)
+		}
+		switch {
+		case err != nil && cmd.Context().Err() != nil:
+			return err
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Warning: Failed to download %s: %v\n", entry.URL, err)
+			failed++
+		case done:
+			fmt.Printf("✓ Already downloaded: %s\n", media.Path)
+			skipped++
+		case media.Captions:
+			fmt.Printf("✓ Transcript from captions: %s\n", media.Path)
+			captioned++
+		default:
+			downloaded++
+		}
 	}
+	fmt.Printf("\n%d downloaded, %d transcribed from captions, %d already present or archived, %d failed\n", downloaded, captioned, skipped, failed)
 
 	fmt.Println("\nPlaylist download complete!")
 	fmt.Printf("Videos saved to: %s\n", playlistOutputDir)
@@ -197,43 +647,6 @@ func loadVideoMetadata(infoJsonPath string) (map[string]interface{}, error) {
 	return metadata, nil
 }
 
-// GetVideoInfo extracts useful metadata
-func GetVideoInfo(videoID string, videosDir string) (map[string]interface{}, error) {
-	// Find the info.json file
-	infoPath := filepath.Join(videosDir, videoID+".info.json")
-
-	if _, err := os.Stat(infoPath); os.IsNotExist(err) {
-		// Try to find it by globbing
-		pattern := filepath.Join(videosDir, "*"+videoID+"*.info.json")
-		matches, _ := filepath.Glob(pattern)
-		if len(matches) > 0 {
-			infoPath = matches[0]
-		} else {
-			return nil, fmt.Errorf("metadata not found for video %s", videoID)
-		}
-	}
-
-	return loadVideoMetadata(infoPath)
-}
-
-// ListDownloadedVideos lists all downloaded videos in a directory
-func ListDownloadedVideos(dir string) ([]string, error) {
-	var videos []string
-
-	// Find all .mp3 files (or other audio formats)
-	patterns := []string{"*.mp3", "*.wav", "*.m4a"}
-
-	for _, pattern := range patterns {
-		matches, err := filepath.Glob(filepath.Join(dir, pattern))
-		if err != nil {
-			continue
-		}
-		videos = append(videos, matches...)
-	}
-
-	return videos, nil
-}
-
 // CleanFilename removes problematic characters from filenames
 func CleanFilename(name string) string {
 	// Replace problematic characters
@@ -247,5 +660,32 @@ func CleanFilename(name string) string {
 	name = strings.ReplaceAll(name, ">", "-")
 	name = strings.ReplaceAll(name, "|", "-")
 
+	// Control characters are invalid on Windows and awkward everywhere
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+
+	// Windows silently drops trailing dots and spaces, which would make
+	// two different names collide
+	name = strings.TrimRight(name, ". ")
+
+	// Device names are reserved on Windows with any extension (CON.mp3)
+	stem := strings.ToUpper(strings.SplitN(name, ".", 2)[0])
+	if windowsReservedNames[stem] {
+		name = "_" + name
+	}
+
 	return name
 }
+
+// windowsReservedNames are device names Windows refuses as file names
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
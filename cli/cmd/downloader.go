@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kkdai/youtube/v2"
+	"github.com/schollz/progressbar/v3"
+)
+
+// downloaderHelp documents --downloader
+const downloaderHelp = `Downloader:
+  Videos are downloaded with yt-dlp when it is installed. Without it (or
+  with --downloader native) the built-in YouTube client is used instead,
+  which needs no external tools but can't remove SponsorBlock segments or
+  fetch captions (--prefer-captions), and keeps audio in its original
+  container (.m4a or .webm) when ffmpeg isn't installed to transcode it.
+  Each video's thumbnail and full description are saved beside its
+  audio (as .jpg and .description) and renamed with it.
+  The downloader in use and the features it lacks are printed at the
+  start. YouTube breaks the built-in client more often than yt-dlp, which
+  is updated within days; install yt-dlp for unattended use.`
+
+// Values of --downloader
+const (
+	downloaderAuto   = "auto"
+	downloaderYtDlp  = "yt-dlp"
+	downloaderNative = "native"
+)
+
+// downloaderChoice is the --downloader of the download commands
+var downloaderChoice string
+
+// downloadQuiet hides downloaders' progress output while several
+// downloads run at once
+var downloadQuiet bool
+
+// downloaderFeatures is what a downloader can do beyond fetching audio
+type downloaderFeatures struct {
+	SponsorBlock bool
+	Captions     bool
+	Transcode    bool
+	// OtherSites is downloading from sites other than YouTube
+	OtherSites bool
+}
+
+// videoDownloader fetches a video's audio as <id>.<ext> with an
+// <id>.info.json sidecar in yt-dlp's format, and the video's thumbnail
+// and full description (<id>.description) when it has them; callers
+// apply name templates afterwards
+type videoDownloader interface {
+	Name() string
+	Features() downloaderFeatures
+	Download(ctx context.Context, url, outputDir string) (*downloadedMedia, error)
+	// ListPlaylist lists a playlist's videos in order, without publish dates
+	ListPlaylist(ctx context.Context, playlistURL string) ([]pipelineItem, error)
+}
+
+// selectDownloader picks the downloader for --downloader and reports it
+// with the features it lacks. In auto mode a missing or broken yt-dlp
+// falls back to the built-in client.
+func selectDownloader(transcode transcodeOptions, noTranscode bool) (videoDownloader, error) {
+	rate, err := parseRateLimit(downloadRateLimit)
+	if err != nil {
+		return nil, err
+	}
+	if downloadSleepBetween < 0 {
+		return nil, fmt.Errorf("--sleep-between must not be negative")
+	}
+	printPacing := func() {
+		if rate > 0 {
+			fmt.Printf("  Rate limit: %s per download\n", formatRate(rate))
+		}
+		if downloadSleepBetween > 0 {
+			fmt.Printf("  Sleep between downloads: %s\n", downloadSleepBetween)
+		}
+	}
+
+	var ytDlpErr error
+	switch downloaderChoice {
+	case downloaderAuto, downloaderYtDlp:
+		if ytDlpErr = checkYtDlpInstalled(); ytDlpErr == nil {
+			d := ytDlpDownloader{Transcode: transcode, NoTranscode: noTranscode, RateLimit: rate}
+			fmt.Printf("Downloader: %s\n", d.Name())
+			printPacing()
+			return d, nil
+		}
+		if downloaderChoice == downloaderYtDlp {
+			return nil, ytDlpErr
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v; falling back to the built-in YouTube client\n", ytDlpErr)
+	case downloaderNative:
+	default:
+		return nil, fmt.Errorf("unknown --downloader %q (use auto, yt-dlp or native)", downloaderChoice)
+	}
+
+	client := &youtube.Client{HTTPClient: &http.Client{Transport: &youtubeAuthTransport{next: http.DefaultTransport}}}
+	d := nativeDownloader{Client: client, Transcode: transcode, NoTranscode: noTranscode, RateLimit: rate}
+	if !noTranscode {
+		if err := checkTranscodeOptions(transcode); err != nil {
+			return nil, err
+		}
+		d.NoTranscode = !commandExists("ffmpeg")
+	}
+	fmt.Printf("Downloader: %s\n", d.Name())
+	var missing []string
+	if sponsorBlockArgs() != nil {
+		missing = append(missing, "SponsorBlock removal")
+	}
+	missing = append(missing, "captions (--prefer-captions)")
+	fmt.Printf("  Not available: %s\n", strings.Join(missing, ", "))
+	if d.NoTranscode && !noTranscode {
+		fmt.Printf("  ffmpeg not found: audio is kept as downloaded (.m4a or .webm) instead of %s\n", transcode.Format)
+	}
+	printPacing()
+	return d, nil
+}
+
+// ytDlpDownloader downloads with yt-dlp, extracting audio with ffmpeg
+type ytDlpDownloader struct {
+	Transcode   transcodeOptions
+	NoTranscode bool
+	// RateLimit caps the download in bytes per second; 0 is no limit
+	RateLimit int64
+}
+
+func (ytDlpDownloader) Name() string { return "yt-dlp" }
+
+func (ytDlpDownloader) Features() downloaderFeatures {
+	return downloaderFeatures{SponsorBlock: true, Captions: true, Transcode: true, OtherSites: true}
+}
+
+func (d ytDlpDownloader) Download(ctx context.Context, url, outputDir string) (*downloadedMedia, error) {
+	outputTemplate := filepath.Join(toolPath(outputDir), "%(id)s.%(ext)s")
+
+	var args []string
+	if d.NoTranscode {
+		args = []string{"--format", "bestaudio/best"}
+	} else {
+		// Thumbnails come as WebP; JPEG is what everything can show
+		args = []string{"--extract-audio", "--audio-format", d.Transcode.Format, "--convert-thumbnails", "jpg"}
+		if d.Transcode.Bitrate != "" {
+			args = append(args, "--audio-quality", d.Transcode.Bitrate)
+		}
+		if d.Transcode.SampleRate > 0 {
+			args = append(args, "--postprocessor-args", fmt.Sprintf("ExtractAudio:-ar %d", d.Transcode.SampleRate))
+		}
+	}
+	args = append(args,
+		"--output", outputTemplate,
+		"--write-info-json", // Save metadata
+		"--write-thumbnail",
+		"--write-description",
+		"--windows-filenames",
+		"--no-playlist", // Don't download playlists
+		"--quiet",       // Suppress most output
+		"--progress",    // Show progress
+	)
+	if d.RateLimit > 0 {
+		args = append(args, "--limit-rate", strconv.FormatInt(d.RateLimit, 10))
+	}
+	// "--" ends the options, so a URL can never be read as one
+	args = append(append(args, sponsorBlockArgs()...), "--", url)
+
+	media, err := runYtDlpDownload(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(media) == 0 {
+		return nil, fmt.Errorf("yt-dlp reported no downloaded file")
+	}
+	findSidecars(media[0])
+	if removed, err := markRemovedSegments(media[0].InfoPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record SponsorBlock segments of %s: %v\n", media[0].VideoID, err)
+	} else if len(removed) > 0 {
+		fmt.Printf("  Removed %s of SponsorBlock segments from %s\n", describeRemoved(removed), media[0].VideoID)
+	}
+	return media[0], nil
+}
+
+func (ytDlpDownloader) ListPlaylist(ctx context.Context, playlistURL string) ([]pipelineItem, error) {
+	return expandPlaylist(ctx, playlistURL, false)
+}
+
+// nativeDownloader downloads with the built-in YouTube client, saving the
+// smallest audio stream and transcoding it with ffmpeg
+type nativeDownloader struct {
+	Client      *youtube.Client
+	Transcode   transcodeOptions
+	NoTranscode bool
+	// RateLimit caps the download in bytes per second; 0 is no limit
+	RateLimit int64
+}
+
+func (nativeDownloader) Name() string { return "built-in YouTube client" }
+
+func (d nativeDownloader) Features() downloaderFeatures {
+	return downloaderFeatures{Transcode: !d.NoTranscode}
+}
+
+func (d nativeDownloader) Download(ctx context.Context, url, outputDir string) (*downloadedMedia, error) {
+	if site := siteForURL(url); site != siteYouTube {
+		return nil, fmt.Errorf("%s is not a YouTube URL; the %s only downloads from YouTube", url, d.Name())
+	}
+	video, err := d.Client.GetVideoContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get video metadata: %w", err)
+	}
+	fmt.Printf("Title: %s\n", video.Title)
+	fmt.Printf("Author: %s\n", video.Author)
+	fmt.Printf("Duration: %s\n", video.Duration)
+
+	// Get audio stream
+	formats := video.Formats.WithAudioChannels()
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("no audio formats available")
+	}
+
+	// Choose format (prefer smallest audio for efficiency)
+	format := formats[0]
+	for _, f := range formats {
+		if f.Bitrate < format.Bitrate {
+			format = f
+		}
+	}
+
+	fmt.Printf("Format: %s (bitrate: %d)\n", format.MimeType, format.Bitrate)
+
+	// The stream is saved under its container's extension, then
+	// transcoded to the requested format unless it already matches
+	streamExt := streamExtension(format.MimeType)
+	streamPath := filepath.Join(outputDir, fmt.Sprintf("%s.%s", video.ID, streamExt))
+	partPath := streamPath + ".part"
+	file, err := os.Create(partPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(partPath)
+
+	// Download stream with progress bar
+	stream, size, err := d.Client.GetStreamContext(ctx, video, &format)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to get stream: %w", err)
+	}
+	defer stream.Close()
+	var source io.Reader = stream
+	if d.RateLimit > 0 {
+		source = newThrottledReader(ctx, stream, d.RateLimit)
+	}
+
+	var progress io.Writer = io.Discard
+	if !downloadQuiet {
+		progress = progressbar.DefaultBytes(size, "downloading")
+	}
+
+	// Copy stream to file with progress
+	_, err = io.Copy(io.MultiWriter(file, progress), source)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to download stream: %w", err)
+	}
+
+	outputPath := streamPath
+	if d.NoTranscode || !needsTranscode(streamExt, d.Transcode) {
+		if err := os.Rename(partPath, streamPath); err != nil {
+			return nil, fmt.Errorf("failed to save stream: %w", err)
+		}
+	} else {
+		outputPath = filepath.Join(outputDir, fmt.Sprintf("%s.%s", video.ID, d.Transcode.Format))
+		fmt.Printf("\nTranscoding %s to %s...\n", streamExt, d.Transcode.Format)
+		if err := transcodeAudio(ctx, partPath, outputPath, d.Transcode); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Printf("\nDownloaded to: %s\n", outputPath)
+
+	// Save metadata
+	metadata := VideoMetadata{
+		VideoID:     video.ID,
+		Title:       video.Title,
+		ChannelID:   video.ChannelID,
+		PublishedAt: video.PublishDate,
+		Duration:    int(video.Duration.Seconds()),
+		FilePath:    outputPath,
+		Chapters:    chaptersFromDescription(video.Description, video.Duration.Seconds()),
+		Description: video.Description,
+	}
+	media := &downloadedMedia{VideoID: video.ID, Path: outputPath, InfoPath: filepath.Join(outputDir, fmt.Sprintf("%s.info.json", video.ID))}
+
+	// The thumbnail and description are extras; a video without them is
+	// still a download
+	if len(video.Thumbnails) > 0 {
+		thumb := video.Thumbnails[0]
+		for _, t := range video.Thumbnails {
+			if t.Width > thumb.Width {
+				thumb = t
+			}
+		}
+		metadata.Thumbnail = thumb.URL
+		if path, err := saveThumbnail(ctx, thumb.URL, filepath.Join(outputDir, video.ID)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save thumbnail of %s: %v\n", video.ID, err)
+		} else {
+			media.ThumbnailPath = path
+		}
+	}
+	if video.Description != "" {
+		path := filepath.Join(outputDir, video.ID+".description")
+		if err := os.WriteFile(path, []byte(video.Description), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save description of %s: %v\n", video.ID, err)
+		} else {
+			media.DescriptionPath = path
+		}
+	}
+
+	if err := saveMetadata(metadata, media.InfoPath); err != nil {
+		return nil, fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return media, nil
+}
+
+// saveThumbnail downloads a thumbnail image to base plus the extension of
+// its URL (.jpg unless it names another image format) and returns its path
+func saveThumbnail(ctx context.Context, thumbURL, base string) (string, error) {
+	ext := ".jpg"
+	if u, err := url.Parse(thumbURL); err == nil {
+		for _, e := range thumbnailExtensions {
+			if strings.HasSuffix(u.Path, e) {
+				ext = e
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", thumbURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return "", err
+	}
+	path := base + ext
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (d nativeDownloader) ListPlaylist(ctx context.Context, playlistURL string) ([]pipelineItem, error) {
+	if site := siteForURL(playlistURL); site != siteYouTube {
+		return nil, fmt.Errorf("%s is not a YouTube URL; the %s only lists YouTube playlists", playlistURL, d.Name())
+	}
+	playlist, err := d.Client.GetPlaylistContext(ctx, playlistURL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to list playlist %s: %w", playlistURL, err)
+	}
+	items := make([]pipelineItem, 0, len(playlist.Videos))
+	for i, v := range playlist.Videos {
+		items = append(items, pipelineItem{
+			URL:           "https://www.youtube.com/watch?v=" + v.ID,
+			VideoID:       v.ID,
+			PlaylistID:    playlist.ID,
+			PlaylistIndex: i + 1,
+			Title:         v.Title,
+			Duration:      v.Duration,
+		})
+	}
+	return items, nil
+}
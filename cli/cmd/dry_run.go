@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// dryRunHelp documents --dry-run
+const dryRunHelp = `Dry run:
+  --dry-run lists the videos that would be downloaded or processed, with
+  their IDs, titles, durations and estimated audio sizes, and exits. Only
+  metadata is fetched (channel and playlist listings, and yt-dlp metadata
+  for videos the listing didn't describe): no media is downloaded, no
+  output directories are created and no paid API is called. Videos the
+  run would skip, by the download archive or the duration limits, are
+  listed with the reason.`
+
+var dryRun bool
+
+// estimatedAudioBytesPerSecond approximates downloaded audio sizes: the
+// mp3 yt-dlp extracts at its default quality averages about 128 kbps
+const estimatedAudioBytesPerSecond = 128000 / 8
+
+// fillVideoDetails looks up the titles and durations items lack with one
+// metadata-only yt-dlp call. Videos yt-dlp can't describe keep what they
+// have; the dry run shows them as unknown.
+func fillVideoDetails(ctx context.Context, items []pipelineItem) error {
+	var urls []string
+	for _, item := range items {
+		if item.Title == "" || item.Duration == 0 {
+			urls = append(urls, item.URL)
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	if _, err := findTool("yt-dlp"); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; titles and durations are unknown\n", err)
+		return nil
+	}
+
+	args := append([]string{"--skip-download", "--dump-json", "--no-playlist", "--ignore-errors", "--no-warnings", "--quiet", "--"}, urls...)
+	var stderr bytes.Buffer
+	c, cleanup := ytDlpCommand(ctx, args...)
+	defer cleanup()
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil && len(out) == 0 {
+		fmt.Fprintf(os.Stderr, "Warning: failed to look up videos: %v\n", ytDlpError(err, stderr.String()))
+		return nil
+	}
+
+	type details struct {
+		ID         string  `json:"id"`
+		Title      string  `json:"title"`
+		Duration   float64 `json:"duration"`
+		WebpageURL string  `json:"webpage_url"`
+	}
+	byID := make(map[string]details)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var d details
+		if json.Unmarshal(scanner.Bytes(), &d) == nil && d.ID != "" {
+			byID[d.ID] = d
+		}
+	}
+	for i := range items {
+		item := &items[i]
+		d, ok := byID[orDefault(item.VideoID, videoIDFromURL(item.URL))]
+		if !ok {
+			continue
+		}
+		item.VideoID = d.ID
+		if item.Title == "" {
+			item.Title = d.Title
+		}
+		if item.Duration == 0 {
+			item.Duration = time.Duration(d.Duration * float64(time.Second))
+		}
+	}
+	return nil
+}
+
+// printDryRun lists the videos a run would act on. skip returns why an
+// item would be skipped, or "" if it would be acted on; verb names the
+// action ("downloaded", "processed").
+func printDryRun(items []pipelineItem, verb string, skip func(pipelineItem) string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tVIDEO\tTITLE\tDURATION\tEST. SIZE\tSTATUS")
+
+	var total time.Duration
+	count, skipped, unknown := 0, 0, 0
+	for i, item := range items {
+		duration, size := "?", "?"
+		if item.Duration > 0 {
+			duration = formatVideoOffset(item.Duration.Seconds())
+			size = "~" + formatBytes(int64(item.Duration.Seconds()*estimatedAudioBytesPerSecond))
+		}
+		status := "would be " + verb
+		if reason := skip(item); reason != "" {
+			status = "skip: " + reason
+			skipped++
+		} else {
+			count++
+			total += item.Duration
+			if item.Duration == 0 {
+				unknown++
+			}
+		}
+		title := item.Title
+		if r := []rune(title); len(r) > 60 {
+			title = string(r[:57]) + "..."
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, orDefault(item.VideoID, orDefault(videoIDFromURL(item.URL), item.URL)), orDefault(title, "?"), duration, size, status)
+	}
+	w.Flush()
+
+	fmt.Printf("\nDry run: %d video(s) would be %s, %s of audio (~%s)", count, verb,
+		formatVideoOffset(total.Seconds()), formatBytes(int64(total.Seconds()*estimatedAudioBytesPerSecond)))
+	if unknown > 0 {
+		fmt.Printf(", plus %d of unknown length", unknown)
+	}
+	if skipped > 0 {
+		fmt.Printf("; %d skipped", skipped)
+	}
+	fmt.Println()
+}
+
+// dryRunDownloads prints a download dry run for items, skipping what the
+// download archive lists or the manifest at manifestPath has on disk
+func dryRunDownloads(ctx context.Context, items []pipelineItem, archive *downloadArchive, manifestPath string) error {
+	if err := fillVideoDetails(ctx, items); err != nil {
+		return err
+	}
+	// Only an existing manifest is read; a dry run creates none
+	var m *Manifest
+	if _, err := os.Stat(manifestPath); err == nil {
+		if m, err = openManifest(manifestPath); err != nil {
+			return err
+		}
+		defer m.Close()
+	}
+	printDryRun(items, "downloaded", func(item pipelineItem) string {
+		if reason := durationSkipReason(item); reason != "" {
+			return reason
+		}
+		if archive.Skip(item) {
+			return "in download archive"
+		}
+		if path := downloadedAudioPath(m, item); path != "" {
+			return "already downloaded to " + path
+		}
+		return ""
+	})
+	return nil
+}
+
+// downloadedAudioPath returns where the manifest records item's audio,
+// if that file still exists, or ""
+func downloadedAudioPath(m *Manifest, item pipelineItem) string {
+	if m == nil {
+		return ""
+	}
+	prev, err := m.GetItem(item.URL)
+	if err == nil && prev == nil && item.VideoID != "" {
+		prev, err = m.ItemByVideoID(item.VideoID)
+	}
+	if err != nil || prev == nil || prev.State == ItemPending || prev.AudioPath == "" {
+		return ""
+	}
+	if _, err := os.Stat(prev.AudioPath); err != nil {
+		return ""
+	}
+	return prev.AudioPath
+}
+
+// dryRunPipeline prints a pipeline dry run for items. Sandbox runs ignore
+// the download archive, as real ones do.
+func dryRunPipeline(ctx context.Context, items []pipelineItem) error {
+	if err := fillVideoDetails(ctx, items); err != nil {
+		return err
+	}
+	var archive *downloadArchive
+	if !pipelineSandbox {
+		var err error
+		if archive, err = openDownloadArchive(downloadArchivePath); err != nil {
+			return err
+		}
+	}
+	fmt.Println()
+	printDryRun(items, "processed", func(item pipelineItem) string {
+		if reason := durationSkipReason(item); reason != "" {
+			return reason
+		}
+		if archive.Skip(item) {
+			return "in download archive"
+		}
+		return ""
+	})
+	return nil
+}
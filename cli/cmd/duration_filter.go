@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// durationFilterHelp documents --min-duration and --max-duration
+const durationFilterHelp = `Duration limits:
+  --min-duration and --max-duration skip videos shorter or longer than a
+  duration such as 90s, 20m or 3h, so --max-duration 3h passes over
+  10-hour compilation streams. Lengths come from the playlist listing,
+  else from a metadata-only yt-dlp lookup made before anything is
+  downloaded. Skipped videos are listed with the reason; videos whose
+  length can't be found out are kept.`
+
+var (
+	minDuration time.Duration
+	maxDuration time.Duration
+)
+
+// checkDurationLimits validates --min-duration and --max-duration
+func checkDurationLimits() error {
+	if minDuration < 0 || maxDuration < 0 {
+		return fmt.Errorf("--min-duration and --max-duration must not be negative")
+	}
+	if maxDuration > 0 && minDuration > maxDuration {
+		return fmt.Errorf("--min-duration %s is longer than --max-duration %s", minDuration, maxDuration)
+	}
+	return nil
+}
+
+// durationSkipReason returns why item's length is outside the duration
+// limits, or "" if it is within them or unknown
+func durationSkipReason(item pipelineItem) string {
+	switch {
+	case item.Duration == 0:
+		return ""
+	case minDuration > 0 && item.Duration < minDuration:
+		return fmt.Sprintf("%s long, under --min-duration %s", formatVideoOffset(item.Duration.Seconds()), minDuration)
+	case maxDuration > 0 && item.Duration > maxDuration:
+		return fmt.Sprintf("%s long, over --max-duration %s", formatVideoOffset(item.Duration.Seconds()), maxDuration)
+	}
+	return ""
+}
+
+// applyDurationLimits looks up the lengths items lack and drops the items
+// outside the duration limits, reporting each
+func applyDurationLimits(ctx context.Context, items []pipelineItem) ([]pipelineItem, error) {
+	if minDuration == 0 && maxDuration == 0 {
+		return items, nil
+	}
+	if err := fillVideoDetails(ctx, items); err != nil {
+		return nil, err
+	}
+	kept := items[:0:0]
+	for _, item := range items {
+		if reason := durationSkipReason(item); reason != "" {
+			fmt.Printf("Skipping %s (%s)\n", orDefault(item.Title, item.URL), reason)
+			continue
+		}
+		if item.Duration == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: length of %s is unknown; not skipping it\n", item.URL)
+		}
+		kept = append(kept, item)
+	}
+	if skipped := len(items) - len(kept); skipped > 0 {
+		fmt.Printf("Skipped %d video(s) outside the duration limits\n\n", skipped)
+	}
+	return kept, nil
+}
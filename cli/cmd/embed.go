@@ -0,0 +1,470 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// EmbedCmd computes and migrates embeddings for the local store
+var EmbedCmd = &cobra.Command{
+	Use:   "embed",
+	Short: "Embed local facts and transcript segments",
+	Long: `Compute OpenAI embeddings (OPENAI_API_KEY) for the facts in local patches
+and the segments of Whisper JSON transcripts under --data, storing vectors
+in the manifest and rebuilding the similarity index under --index-dir.
+
+Vectors from different models are not comparable, so the store has one
+active model. Items already embedded with it are skipped unless their
+text changed. To switch models run with --recompute: every item is
+re-embedded with --model in batches, the old model's vectors are dropped
+only once all items are done, and the index is rebuilt for the new model.
+An interrupted run (Ctrl-C, API errors) keeps every finished batch;
+running the same command again resumes where it stopped.
+
+Models named ollama:<model> (e.g. ollama:nomic-embed-text) are computed
+by a local Ollama server (OLLAMA_HOST, default localhost:11434) and need
+no API key.
+
+` + profileHelp + `
+
+Examples:
+  vkm embed
+  vkm embed --recompute --model text-embedding-3-large --batch 200
+  vkm embed --profile gpu`,
+	RunE: runEmbed,
+}
+
+var (
+	embedModel     string
+	embedRecompute bool
+	embedBatch     int
+	embedDataDir   string
+	embedManifest  string
+	embedIndexDir  string
+	embedKinds     []string
+)
+
+func init() {
+	EmbedCmd.Flags().StringVar(&embedModel, "model", "", "Embedding model (default: the store's active model, else "+defaultEmbeddingModel+")")
+	EmbedCmd.Flags().BoolVar(&embedRecompute, "recompute", false, "Migrate the store to --model, re-embedding every item")
+	EmbedCmd.Flags().IntVar(&embedBatch, "batch", 100, "Texts per embeddings API request")
+	EmbedCmd.Flags().StringVar(&embedDataDir, "data", "data", "Directory holding patches and transcripts")
+	EmbedCmd.Flags().StringVar(&embedManifest, "manifest", "data/manifest.db", "SQLite manifest storing the vectors")
+	EmbedCmd.Flags().StringVar(&embedIndexDir, "index-dir", "data/embeddings", "Directory for the rebuilt similarity index")
+	EmbedCmd.Flags().StringVar(&runProfileName, "profile", "", "Preset of flags to apply (gpu)")
+	EmbedCmd.Flags().StringSliceVar(&embedKinds, "kind", []string{embedKindFact, embedKindSegment}, "What to embed (fact, segment)")
+}
+
+// Kinds of embedded items
+const (
+	embedKindFact    = "fact"
+	embedKindSegment = "segment"
+)
+
+// settingEmbeddingModel names the store's active embedding model
+const settingEmbeddingModel = "embedding_model"
+
+// embedRetries is how often a failed batch is retried before giving up
+const embedRetries = 3
+
+// embedItem is one text to embed
+type embedItem struct {
+	Kind string
+	ID   string
+	Text string
+	Hash string
+}
+
+func runEmbed(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if err := applyProfile(cmd); err != nil {
+		return err
+	}
+	if embedBatch <= 0 || embedBatch > 2048 {
+		return fmt.Errorf("--batch must be between 1 and 2048")
+	}
+
+	manifest, err := openManifest(embedManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	active, err := manifest.Setting(settingEmbeddingModel)
+	if err != nil {
+		return err
+	}
+	model := embedModel
+	if model == "" {
+		model = active
+	}
+	if model == "" {
+		model = defaultEmbeddingModel
+	}
+	if _, local := ollamaModel(model); !local && os.Getenv("OPENAI_API_KEY") == "" {
+		return fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
+	if active != "" && model != active && !embedRecompute {
+		return fmt.Errorf("store vectors use %s; pass --recompute to migrate them to %s", active, model)
+	}
+
+	items, err := collectEmbedItems(embedDataDir, embedKinds)
+	if err != nil {
+		return err
+	}
+	done, err := manifest.EmbeddingHashes(model)
+	if err != nil {
+		return err
+	}
+
+	var todo []embedItem
+	for _, item := range items {
+		if done[item.Kind+":"+item.ID] != item.Hash {
+			todo = append(todo, item)
+		}
+	}
+
+	fmt.Printf("Model: %s", model)
+	if active != "" && active != model {
+		fmt.Printf(" (migrating from %s)", active)
+	}
+	fmt.Printf("\n%d items, %d already embedded, %d to embed\n", len(items), len(items)-len(todo), len(todo))
+
+	start := time.Now()
+	embedded := 0
+	for i := 0; i < len(todo); i += embedBatch {
+		if ctx.Err() != nil {
+			break
+		}
+		batch := todo[i:min(i+embedBatch, len(todo))]
+		texts := make([]string, len(batch))
+		for j, item := range batch {
+			texts[j] = item.Text
+		}
+
+		var vecs [][]float64
+		for attempt := 1; ; attempt++ {
+			vecs, err = embedTextsWithModel(ctx, model, texts)
+			if err == nil || ctx.Err() != nil || attempt == embedRetries {
+				break
+			}
+			fmt.Fprintf(os.Stderr, "Warning: batch failed (attempt %d/%d): %v\n", attempt, embedRetries, err)
+			time.Sleep(time.Duration(attempt*attempt) * 2 * time.Second)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return fmt.Errorf("embedding failed after %d of %d items (rerun to resume): %w", embedded, len(todo), err)
+		}
+
+		if err := manifest.SaveEmbeddings(model, batch, vecs); err != nil {
+			return err
+		}
+		embedded += len(batch)
+
+		elapsed := time.Since(start)
+		eta := time.Duration(float64(elapsed) / float64(embedded) * float64(len(todo)-embedded))
+		fmt.Printf("  %d/%d (%.0f%%) · ETA %s\n", embedded, len(todo), 100*float64(embedded)/float64(len(todo)), eta.Round(time.Second))
+	}
+
+	if embedded < len(todo) {
+		fmt.Printf("Interrupted after %d/%d items; run the same command again to resume.\n", embedded, len(todo))
+		return nil
+	}
+
+	if active != model {
+		if dropped, err := manifest.DeleteEmbeddingsExcept(model); err != nil {
+			return err
+		} else if dropped > 0 {
+			fmt.Printf("Dropped %d vectors from previous models\n", dropped)
+		}
+		if err := manifest.SetSetting(settingEmbeddingModel, model); err != nil {
+			return err
+		}
+	}
+
+	path := filepath.Join(embedIndexDir, CleanFilename(model)+".idx")
+	count, err := writeEmbeddingIndex(manifest, model, path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Index rebuilt: %s (%d vectors)\n", path, count)
+	return nil
+}
+
+// collectEmbedItems gathers fact texts from local patches and segment
+// texts from Whisper JSON transcripts under root
+func collectEmbedItems(root string, kinds []string) ([]embedItem, error) {
+	want := make(map[string]bool)
+	for _, k := range kinds {
+		if k != embedKindFact && k != embedKindSegment {
+			return nil, fmt.Errorf("unknown kind %q (use fact or segment)", k)
+		}
+		want[k] = true
+	}
+
+	var items []embedItem
+	add := func(kind, id, text string) {
+		if item, ok := newEmbedItem(kind, id, text); ok {
+			items = append(items, item)
+		}
+	}
+
+	if want[embedKindFact] {
+		patches, err := loadLocalPatches(root)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, p := range patches {
+			for _, f := range p.Facts {
+				if !seen[f.ID] {
+					seen[f.ID] = true
+					add(embedKindFact, f.ID, f.Text)
+				}
+			}
+		}
+	}
+
+	if want[embedKindSegment] {
+		seen := make(map[string]bool)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".json") ||
+				strings.HasSuffix(path, ".info.json") || strings.HasSuffix(path, ".preview.json") {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			var t Transcript
+			if json.Unmarshal(data, &t) != nil || t.VideoID == "" || len(t.Transcript) == 0 || seen[t.VideoID] {
+				return nil
+			}
+			seen[t.VideoID] = true
+			for i, seg := range t.Transcript {
+				add(embedKindSegment, fmt.Sprintf("%s#%d", t.VideoID, i), seg.Text)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+		}
+	}
+
+	return items, nil
+}
+
+// newEmbedItem prepares text for embedding, keyed by a hash of the text so
+// edits are re-embedded. Blank texts are skipped.
+func newEmbedItem(kind, id, text string) (embedItem, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return embedItem{}, false
+	}
+	sum := sha256.Sum256([]byte(text))
+	return embedItem{Kind: kind, ID: id, Text: text, Hash: hex.EncodeToString(sum[:8])}, true
+}
+
+// Setting returns a stored setting, or "" if unset
+func (m *Manifest) Setting(key string) (string, error) {
+	var value string
+	err := m.db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read setting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// SetSetting stores a setting
+func (m *Manifest) SetSetting(key, value string) error {
+	return m.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO settings (key, value) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, value)
+		if err != nil {
+			return fmt.Errorf("failed to save setting %s: %w", key, err)
+		}
+		return nil
+	})
+}
+
+// EmbeddingHashes returns the text hash of every item embedded with model,
+// keyed by "kind:id"
+func (m *Manifest) EmbeddingHashes(model string) (map[string]string, error) {
+	rows, err := m.db.Query("SELECT kind, item_id, text_hash FROM embeddings WHERE model = ?", model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var kind, id, hash string
+		if err := rows.Scan(&kind, &id, &hash); err != nil {
+			return nil, fmt.Errorf("failed to read embeddings: %w", err)
+		}
+		hashes[kind+":"+id] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// SaveEmbeddings stores one batch of vectors in a single transaction
+func (m *Manifest) SaveEmbeddings(model string, items []embedItem, vecs [][]float64) error {
+	now := time.Now().UTC()
+	return m.write(func(tx *sql.Tx) error {
+		for i, item := range items {
+			if i >= len(vecs) || len(vecs[i]) == 0 {
+				return fmt.Errorf("embeddings API returned no vector for %s %s", item.Kind, item.ID)
+			}
+			_, err := tx.Exec(`
+				INSERT INTO embeddings (kind, item_id, model, text_hash, dims, vector, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT(kind, item_id, model) DO UPDATE SET
+					text_hash  = excluded.text_hash,
+					dims       = excluded.dims,
+					vector     = excluded.vector,
+					created_at = excluded.created_at`,
+				item.Kind, item.ID, model, item.Hash, len(vecs[i]), encodeVector(vecs[i]), now)
+			if err != nil {
+				return fmt.Errorf("failed to save embedding: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteEmbeddingsExcept drops vectors of every model but keep
+func (m *Manifest) DeleteEmbeddingsExcept(keep string) (int64, error) {
+	var n int64
+	err := m.write(func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM embeddings WHERE model != ?", keep)
+		if err != nil {
+			return fmt.Errorf("failed to drop old embeddings: %w", err)
+		}
+		n, _ = res.RowsAffected()
+		return nil
+	})
+	return n, err
+}
+
+// encodeVector packs a vector as little-endian float32s
+func encodeVector(v []float64) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(x)))
+	}
+	return buf
+}
+
+// embeddingIndexMagic starts every index file
+const embeddingIndexMagic = "VKMIDX1\n"
+
+// writeEmbeddingIndex writes all of a model's vectors to a flat index:
+// the magic, uint32 dimensions and count, then per item a uint16-length
+// "kind:id" key followed by its L2-normalized float32 vector, sorted by
+// key. Cosine similarity against the index is then a plain dot product.
+func writeEmbeddingIndex(m *Manifest, model, path string) (int, error) {
+	rows, err := m.db.Query("SELECT kind, item_id, dims, vector FROM embeddings WHERE model = ?", model)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	type entry struct {
+		key    string
+		vector []byte
+	}
+	var entries []entry
+	dims := 0
+	for rows.Next() {
+		var kind, id string
+		var d int
+		var vector []byte
+		if err := rows.Scan(&kind, &id, &d, &vector); err != nil {
+			return 0, fmt.Errorf("failed to read embeddings: %w", err)
+		}
+		if dims == 0 {
+			dims = d
+		}
+		if d != dims || len(vector) != 4*d {
+			return 0, fmt.Errorf("embedding %s:%s has %d dimensions, expected %d", kind, id, d, dims)
+		}
+		entries = append(entries, entry{key: kind + ":" + id, vector: normalizeVector(vector)})
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read embeddings: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create index: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	w := bufio.NewWriter(f)
+	w.WriteString(embeddingIndexMagic)
+	binary.Write(w, binary.LittleEndian, uint32(dims))
+	binary.Write(w, binary.LittleEndian, uint32(len(entries)))
+	for _, e := range entries {
+		binary.Write(w, binary.LittleEndian, uint16(len(e.key)))
+		w.WriteString(e.key)
+		w.Write(e.vector)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return 0, fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write index: %w", err)
+	}
+
+	// Swap the finished index in so readers never see a partial file
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("failed to replace index: %w", err)
+	}
+	return len(entries), nil
+}
+
+// normalizeVector scales a packed float32 vector to unit length
+func normalizeVector(packed []byte) []byte {
+	n := len(packed) / 4
+	var norm float64
+	for i := 0; i < n; i++ {
+		x := float64(math.Float32frombits(binary.LittleEndian.Uint32(packed[4*i:])))
+		norm += x * x
+	}
+	out := make([]byte, len(packed))
+	if norm == 0 {
+		return out
+	}
+	norm = math.Sqrt(norm)
+	for i := 0; i < n; i++ {
+		x := float64(math.Float32frombits(binary.LittleEndian.Uint32(packed[4*i:])))
+		binary.LittleEndian.PutUint32(out[4*i:], math.Float32bits(float32(x/norm)))
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// transcriptFromEmbeddedSubs is the manifest's transcript model for
+// transcripts read from a video file's subtitle track. It counts as an
+// imported transcript, so transcribe and the pipeline don't run Whisper
+// over the file's audio.
+const transcriptFromEmbeddedSubs = transcriptImported + "embedded-subs"
+
+// textSubtitleCodecs are the subtitle codecs ffmpeg can convert to
+// WebVTT. Image-based subtitles (DVD, Blu-ray PGS, DVB) have no text.
+var textSubtitleCodecs = map[string]bool{"subrip": true, "srt": true, "ass": true, "ssa": true, "webvtt": true, "mov_text": true, "text": true}
+
+// subtitleTrack is a subtitle stream of a media file, as ffprobe reports
+// it
+type subtitleTrack struct {
+	Index    int
+	Codec    string
+	Language string
+	Title    string
+	Default  bool
+}
+
+// probeSubtitleTracks lists the subtitle streams of a media file with
+// ffprobe
+func probeSubtitleTracks(ctx context.Context, path string) ([]subtitleTrack, error) {
+	if _, err := findTool("ffprobe"); err != nil {
+		return nil, err
+	}
+	out, err := toolCommand(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "s",
+		"-show_entries", "stream=index,codec_name:stream_tags=language,title:stream_disposition=default",
+		"-of", "json",
+		toolPath(path)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	var probed struct {
+		Streams []struct {
+			Index       int               `json:"index"`
+			Codec       string            `json:"codec_name"`
+			Tags        map[string]string `json:"tags"`
+			Disposition map[string]int    `json:"disposition"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &probed); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	tracks := make([]subtitleTrack, 0, len(probed.Streams))
+	for _, s := range probed.Streams {
+		lang := strings.ToLower(s.Tags["language"])
+		if lang == "und" {
+			lang = ""
+		}
+		tracks = append(tracks, subtitleTrack{
+			Index:    s.Index,
+			Codec:    s.Codec,
+			Language: lang,
+			Title:    s.Tags["title"],
+			Default:  s.Disposition["default"] == 1,
+		})
+	}
+	return tracks, nil
+}
+
+// pickSubtitleTrack chooses the text track to transcribe from: the first
+// in lang (a two- or three-letter code; empty for any), preferring the
+// default track, else the default track, else the first. It returns nil
+// when no track has text.
+func pickSubtitleTrack(tracks []subtitleTrack, lang string) *subtitleTrack {
+	var text []subtitleTrack
+	for _, t := range tracks {
+		if textSubtitleCodecs[t.Codec] {
+			text = append(text, t)
+		}
+	}
+	if len(text) == 0 {
+		return nil
+	}
+	first := func(match func(subtitleTrack) bool) *subtitleTrack {
+		for i := range text {
+			if match(text[i]) {
+				return &text[i]
+			}
+		}
+		return nil
+	}
+	if lang = normalizeLanguage(lang); lang != "" {
+		inLang := func(t subtitleTrack) bool {
+			return t.Language == lang || (len(lang) == 2 && strings.HasPrefix(t.Language, lang))
+		}
+		if t := first(func(t subtitleTrack) bool { return inLang(t) && t.Default }); t != nil {
+			return t
+		}
+		if t := first(inLang); t != nil {
+			return t
+		}
+	}
+	if t := first(func(t subtitleTrack) bool { return t.Default }); t != nil {
+		return t
+	}
+	return &text[0]
+}
+
+// embeddedSubsTranscript reads a transcript from the subtitle track of a
+// video file picked for lang, converting it to WebVTT with ffmpeg. It
+// returns a nil transcript when the file has no text subtitles.
+func embeddedSubsTranscript(ctx context.Context, path, lang string) (*Transcript, *subtitleTrack, error) {
+	tracks, err := probeSubtitleTracks(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	track := pickSubtitleTrack(tracks, lang)
+	if track == nil {
+		return nil, nil, nil
+	}
+
+	tmp, err := newTempDir("subs-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(tmp)
+	vtt := filepath.Join(tmp, "subs.vtt")
+	cmd := toolCommand(ctx, "ffmpeg",
+		"-y", "-loglevel", "error",
+		"-i", toolPath(path),
+		"-map", "0:"+strconv.Itoa(track.Index),
+		"-f", "webvtt",
+		toolPath(vtt))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, fmt.Errorf("ffmpeg failed to extract subtitle track %d: %v: %s", track.Index, err, strings.TrimSpace(string(out)))
+	}
+	data, err := os.ReadFile(vtt)
+	if err != nil {
+		return nil, nil, err
+	}
+	segments := parseVTT(string(data))
+	if len(segments) == 0 {
+		return nil, nil, nil
+	}
+	return &Transcript{Language: track.Language, Transcript: segments}, track, nil
+}
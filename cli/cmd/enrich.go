@@ -0,0 +1,795 @@
+package cmd
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// EnrichCmd backfills newer enrichments onto older local patches
+var EnrichCmd = &cobra.Command{
+	Use:   "enrich",
+	Short: "Re-enrich older local patches within a time and cost budget",
+	Long: `Bring local patches under --data up to date with enrichments added after
+they were extracted, oldest patches first, stopping when --budget time or
+--max-cost dollars of API spend is used up. Run it again (or let
+'vkm serve --enrich-at' run it nightly) and it continues where it stopped.
+
+Steps (--steps):
+  embeddings     embed facts missing from the manifest's vector store
+                 with its active model (OPENAI_API_KEY)
+  corroboration  record, per fact, the other sources stating a fact that
+                 embeds within --threshold cosine similarity
+  entities       link facts to the people, organizations, products and
+                 places they mention, with one spelling per entity across
+                 the store (CLAUDE_API_KEY). A new name that plausibly
+                 matches entities already in the store ("Altman" and
+                 "Sam Altman") is settled by --entity-rules, then by
+                 earlier decisions, then with --interactive by asking;
+                 otherwise it stays an entity of its own and is listed
+                 at the end.
+  profiles       (optional) crawl the about page of each source's YouTube
+                 channel and up to --profile-links of the websites it
+                 links to, and save what they say about who produces the
+                 source as a profile patch under <data>/profiles that the
+                 source's patches link to (metadata "source-profile").
+                 Sites are crawled politely: robots.txt is obeyed and
+                 each host gets at most one request per --crawl-delay (or
+                 its Crawl-delay, if longer). Profiles are refreshed after
+                 30 days.
+
+Each patch records which version of each step it has in its metadata, so
+a step is redone only when it changes (a new embedding model or
+threshold, a revised entity prompt). When a new source corroborates an
+older fact, the older patch is updated too. Costs are estimated from
+list prices and text length, not billed usage.
+
+Decisions made at the --interactive prompt are remembered in the
+manifest and applied to every later run. For unattended runs, settle
+names in --entity-rules instead, which takes precedence:
+  entities:
+    - name: Altman
+      link: Sam Altman
+    - name: Mercury
+      separate: true
+
+Examples:
+  vkm enrich --budget 20m --max-cost 0.50
+  vkm enrich --steps entities --interactive
+  vkm enrich --steps embeddings,corroboration --threshold 0.9
+  vkm enrich --steps profiles --crawl-delay 5s`,
+	RunE: runEnrich,
+}
+
+var (
+	enrichDataDir   string
+	enrichManifest  string
+	enrichSteps     []string
+	enrichBudget    time.Duration
+	enrichMaxCost   float64
+	enrichThreshold float64
+
+	enrichCrawlDelay   time.Duration
+	enrichProfileLinks int
+
+	enrichInteractive bool
+	enrichEntityRules string
+)
+
+func init() {
+	EnrichCmd.Flags().StringVar(&enrichDataDir, "data", "data", "Directory holding local patches")
+	EnrichCmd.Flags().StringVar(&enrichManifest, "manifest", "data/manifest.db", "SQLite manifest storing the vectors")
+	EnrichCmd.Flags().StringSliceVar(&enrichSteps, "steps", []string{enrichStepEmbeddings, enrichStepCorroboration, enrichStepEntities}, "Enrichment steps to run")
+	EnrichCmd.Flags().DurationVar(&enrichBudget, "budget", 30*time.Minute, "Stop after this much time (0 = no limit)")
+	EnrichCmd.Flags().Float64Var(&enrichMaxCost, "max-cost", 1.00, "Stop before spending more than this many USD on APIs (0 = no limit)")
+	EnrichCmd.Flags().Float64Var(&enrichThreshold, "threshold", 0.85, "Minimum cosine similarity for facts to corroborate each other")
+	EnrichCmd.Flags().DurationVar(&enrichCrawlDelay, "crawl-delay", 2*time.Second, "Minimum time between requests to the same host (profiles step)")
+	EnrichCmd.Flags().IntVar(&enrichProfileLinks, "profile-links", 5, "Maximum linked websites to crawl per channel (profiles step)")
+	EnrichCmd.Flags().BoolVar(&enrichInteractive, "interactive", false, "Ask which entity an ambiguous name refers to and remember the answer (entities step)")
+	EnrichCmd.Flags().StringVar(&enrichEntityRules, "entity-rules", defaultEntityRules, "YAML file settling ambiguous entity names (entities step)")
+}
+
+// Enrichment steps
+const (
+	enrichStepEmbeddings    = "embeddings"
+	enrichStepCorroboration = "corroboration"
+	enrichStepEntities      = "entities"
+	enrichStepProfiles      = "profiles"
+)
+
+// Patch metadata keys written by enrichment
+const (
+	metaEnriched      = "enriched"
+	metaEntities      = "entities"
+	metaCorroboration = "corroborated-by"
+)
+
+const entityPrompt = "List the named entities (people, organizations, products, places, " +
+	"models, datasets) each numbered fact mentions. Name each entity by its canonical full " +
+	"name, as an encyclopedia would title it, so different spellings of the same entity match.\n\n" +
+	"Facts:\n%s\n" +
+	"Respond ONLY with a valid JSON array, nothing else:\n" +
+	"[{\"fact\": 1, \"entities\": [\"OpenAI\"]}]"
+
+// tokenPrices are approximate list prices in USD per million input and
+// output tokens, used to keep enrichment within its cost budget
+var tokenPrices = map[string][2]float64{
+	claudeLightModel:         {0.80, 4.00},
+	claudeModel:              {3.00, 15.00},
+	"text-embedding-3-small": {0.02, 0},
+	"text-embedding-3-large": {0.13, 0},
+	"text-embedding-ada-002": {0.10, 0},
+}
+
+// estimateCost prices a request from its text lengths at roughly four
+// characters per token. Unknown models are priced like claudeModel.
+func estimateCost(model string, inChars, outChars int) float64 {
+	price, ok := tokenPrices[model]
+	if !ok {
+		price = tokenPrices[claudeModel]
+	}
+	return (float64(inChars)/4*price[0] + float64(outChars)/4*price[1]) / 1e6
+}
+
+// enrichOptions configures one enrichment run
+type enrichOptions struct {
+	DataDir   string
+	IndexDir  string
+	Steps     []string
+	Budget    time.Duration
+	MaxCost   float64
+	Threshold float64
+
+	CrawlDelay   time.Duration
+	ProfileLinks int
+
+	// Interactive asks about ambiguous entity names on the terminal
+	Interactive bool
+	EntityRules string
+}
+
+// enrichSummary reports what an enrichment run did
+type enrichSummary struct {
+	Patches      int
+	Embedded     int
+	Corroborated int
+	Linked       int
+	Profiled     int
+	Pending      int
+	Cost         float64
+	Stopped      string
+}
+
+// enrichLimits tracks the time and estimated spend left in a run
+type enrichLimits struct {
+	deadline time.Time
+	maxCost  float64
+	spent    float64
+}
+
+// exhausted returns why the run must stop, or "" if it may continue
+func (b *enrichLimits) exhausted() string {
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return "time budget reached"
+	}
+	if b.maxCost > 0 && b.spent >= b.maxCost {
+		return "cost budget reached"
+	}
+	return ""
+}
+
+// afford reports whether cost fits in what is left of the cost budget
+func (b *enrichLimits) afford(cost float64) bool {
+	return b.maxCost <= 0 || b.spent+cost <= b.maxCost
+}
+
+func runEnrich(cmd *cobra.Command, args []string) error {
+	manifest, err := openManifest(enrichManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	_, err = runEnrichment(cmd.Context(), manifest, enrichOptionsFromFlags())
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Interrupted; run the same command again to continue.")
+		return nil
+	}
+	return err
+}
+
+// enrichOptionsFromFlags builds options from the enrich flags, which the
+// serve modes share for their nightly runs
+func enrichOptionsFromFlags() enrichOptions {
+	return enrichOptions{
+		DataDir:   enrichDataDir,
+		IndexDir:  filepath.Join(enrichDataDir, "embeddings"),
+		Steps:     enrichSteps,
+		Budget:    enrichBudget,
+		MaxCost:   enrichMaxCost,
+		Threshold: enrichThreshold,
+
+		CrawlDelay:   enrichCrawlDelay,
+		ProfileLinks: enrichProfileLinks,
+
+		Interactive: enrichInteractive,
+		EntityRules: orDefault(enrichEntityRules, defaultEntityRules),
+	}
+}
+
+// runEnrichment brings local patches up to date with the selected steps,
+// oldest first, until the budget runs out. Finished patches are written as
+// it goes, so an interrupted run loses at most the patch in progress.
+func runEnrichment(ctx context.Context, m *Manifest, opts enrichOptions) (*enrichSummary, error) {
+	steps := make(map[string]bool)
+	for _, s := range opts.Steps {
+		switch s {
+		case enrichStepEmbeddings, enrichStepCorroboration, enrichStepEntities, enrichStepProfiles:
+			steps[s] = true
+		default:
+			return nil, fmt.Errorf("unknown step %q (use embeddings, corroboration, entities or profiles)", s)
+		}
+	}
+	if steps[enrichStepEmbeddings] && os.Getenv("OPENAI_API_KEY") == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
+	if steps[enrichStepEntities] && os.Getenv("CLAUDE_API_KEY") == "" {
+		return nil, fmt.Errorf("CLAUDE_API_KEY environment variable not set")
+	}
+
+	files, err := loadLocalPatchFiles(opts.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	// Copies of a patch are enriched once and written to every path
+	var patches []*Patch
+	paths := make(map[string][]string)
+	for _, f := range files {
+		if _, ok := paths[f.Patch.ID]; !ok {
+			patches = append(patches, f.Patch)
+		}
+		paths[f.Patch.ID] = append(paths[f.Patch.ID], f.Path)
+	}
+	sort.SliceStable(patches, func(i, j int) bool { return patches[i].Timestamp.Before(patches[j].Timestamp) })
+
+	model, err := m.Setting(settingEmbeddingModel)
+	if err != nil {
+		return nil, err
+	}
+	if model == "" {
+		model = defaultEmbeddingModel
+	}
+	versions := map[string]string{
+		enrichStepCorroboration: fmt.Sprintf("%s@%.2f", model, opts.Threshold),
+		enrichStepEntities:      promptVersion(entityPrompt),
+	}
+
+	start := time.Now()
+	budget := &enrichLimits{maxCost: opts.MaxCost}
+	if opts.Budget > 0 {
+		budget.deadline = start.Add(opts.Budget)
+	}
+	summary := &enrichSummary{}
+	fmt.Printf("Enriching %d patches under %s (steps: %s)\n", len(patches), opts.DataDir, strings.Join(opts.Steps, ", "))
+
+	if steps[enrichStepEmbeddings] {
+		n, err := enrichEmbeddings(ctx, m, model, patches, budget)
+		summary.Embedded = n
+		if n > 0 {
+			path := filepath.Join(opts.IndexDir, CleanFilename(model)+".idx")
+			if _, err := writeEmbeddingIndex(m, model, path); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	var corpus []indexedFact
+	if steps[enrichStepCorroboration] {
+		vectors, err := m.EmbeddingVectors(model, embedKindFact)
+		if err != nil {
+			return summary, err
+		}
+		corpus = indexFacts(patches, vectors)
+	}
+
+	save := func(p *Patch) error {
+		for _, path := range paths[p.ID] {
+			if err := writePatchFile(path, *p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// Older patches that gain a corroborating source are written at the end
+	touched := make(map[string]*Patch)
+	entities := knownEntities(patches)
+	entitiesBlocked := false
+	var resolver *entityResolver
+	if steps[enrichStepEntities] {
+		if resolver, err = newEntityResolver(m, opts.EntityRules, opts.Interactive); err != nil {
+			return summary, err
+		}
+	}
+
+	for _, p := range patches {
+		if ctx.Err() != nil || summary.Stopped != "" {
+			break
+		}
+		needCorroboration := steps[enrichStepCorroboration] && enrichedVersion(p, enrichStepCorroboration) != versions[enrichStepCorroboration]
+		needEntities := steps[enrichStepEntities] && !entitiesBlocked && enrichedVersion(p, enrichStepEntities) != versions[enrichStepEntities]
+		if len(p.Facts) == 0 || (!needCorroboration && !needEntities) {
+			continue
+		}
+		if reason := budget.exhausted(); reason != "" {
+			summary.Stopped = reason
+			break
+		}
+
+		var done []string
+		if needCorroboration {
+			if n, ok := corroborateFacts(p, corpus, opts.Threshold, versions[enrichStepCorroboration], touched); ok {
+				setEnrichedVersion(p, enrichStepCorroboration, versions[enrichStepCorroboration])
+				summary.Corroborated += n
+				done = append(done, fmt.Sprintf("%d corroborated", n))
+			}
+		}
+		if needEntities {
+			n, err := linkEntities(ctx, p, entities, resolver, budget)
+			switch {
+			case errors.Is(err, errOverBudget):
+				// Cheaper steps can still run on the remaining patches
+				entitiesBlocked = true
+			case err != nil:
+				if ctx.Err() != nil {
+					break
+				}
+				fmt.Fprintf(os.Stderr, "✗ %s: entity linking failed: %v\n", p.ID, err)
+			default:
+				setEnrichedVersion(p, enrichStepEntities, versions[enrichStepEntities])
+				summary.Linked += n
+				done = append(done, fmt.Sprintf("%d linked to entities", n))
+			}
+		}
+		if len(done) == 0 {
+			continue
+		}
+
+		if err := save(p); err != nil {
+			return summary, err
+		}
+		delete(touched, p.ID)
+		summary.Patches++
+		fmt.Printf("✓ %s (%s): %s\n", orDefault(p.SourceID, p.ID), p.Timestamp.Format("2006-01-02"), strings.Join(done, ", "))
+	}
+	for _, p := range touched {
+		if err := save(p); err != nil {
+			return summary, err
+		}
+	}
+
+	if steps[enrichStepProfiles] && ctx.Err() == nil && summary.Stopped == "" {
+		n, err := enrichProfiles(ctx, m, opts, patches, budget, save)
+		summary.Profiled = n
+		if err != nil && ctx.Err() == nil {
+			return summary, err
+		}
+	}
+
+	if entitiesBlocked && summary.Stopped == "" {
+		summary.Stopped = "cost budget reached"
+	}
+	for _, p := range patches {
+		for _, step := range []string{enrichStepCorroboration, enrichStepEntities} {
+			if steps[step] && len(p.Facts) > 0 && enrichedVersion(p, step) != versions[step] {
+				summary.Pending++
+				break
+			}
+		}
+	}
+	summary.Cost = budget.spent
+
+	fmt.Printf("\nEnriched %d patches: %d facts embedded, %d corroborated, %d linked to entities (~$%.4f, %s)\n",
+		summary.Patches, summary.Embedded, summary.Corroborated, summary.Linked, summary.Cost, time.Since(start).Round(time.Second))
+	if steps[enrichStepProfiles] {
+		fmt.Printf("Crawled %d source profiles\n", summary.Profiled)
+	}
+	if resolver != nil && len(resolver.Unresolved) > 0 {
+		fmt.Printf("%d ambiguous entity names kept as entities of their own: %s\n", len(resolver.Unresolved), strings.Join(resolver.Unresolved, ", "))
+		fmt.Println("Settle them with --interactive or in --entity-rules")
+	}
+	if summary.Pending > 0 {
+		reason := summary.Stopped
+		switch {
+		case ctx.Err() != nil:
+			reason = "interrupted"
+		case reason == "":
+			reason = "facts not embedded yet or failures"
+		}
+		fmt.Printf("%d patches still pending (%s); the next run continues\n", summary.Pending, reason)
+	}
+	return summary, ctx.Err()
+}
+
+// enrichEmbeddings embeds facts missing from the vector store, oldest
+// patches first, and returns how many it embedded
+func enrichEmbeddings(ctx context.Context, m *Manifest, model string, patches []*Patch, budget *enrichLimits) (int, error) {
+	done, err := m.EmbeddingHashes(model)
+	if err != nil {
+		return 0, err
+	}
+
+	var todo []embedItem
+	seen := make(map[string]bool)
+	for _, p := range patches {
+		for _, f := range p.Facts {
+			item, ok := newEmbedItem(embedKindFact, f.ID, f.Text)
+			if !ok || seen[f.ID] || done[embedKindFact+":"+f.ID] == item.Hash {
+				continue
+			}
+			seen[f.ID] = true
+			todo = append(todo, item)
+		}
+	}
+
+	embedded := 0
+	for i := 0; i < len(todo); i += 100 {
+		if ctx.Err() != nil || budget.exhausted() != "" {
+			break
+		}
+		batch := todo[i:min(i+100, len(todo))]
+		texts := make([]string, len(batch))
+		chars := 0
+		for j, item := range batch {
+			texts[j] = item.Text
+			chars += len(item.Text)
+		}
+		cost := estimateCost(model, chars, 0)
+		if !budget.afford(cost) {
+			break
+		}
+
+		vecs, err := embedTextsWithModel(ctx, model, texts)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return embedded, fmt.Errorf("embedding failed: %w", err)
+		}
+		budget.spent += cost
+		if err := m.SaveEmbeddings(model, batch, vecs); err != nil {
+			return embedded, err
+		}
+		embedded += len(batch)
+	}
+	if embedded > 0 {
+		fmt.Printf("✓ Embedded %d of %d facts with %s\n", embedded, len(todo), model)
+	}
+	return embedded, nil
+}
+
+// enrichedVersion returns the version of step p was enriched with, or ""
+func enrichedVersion(p *Patch, step string) string {
+	enriched, _ := p.Metadata[metaEnriched].(map[string]interface{})
+	version, _ := enriched[step].(string)
+	return version
+}
+
+// setEnrichedVersion records that p was enriched with version of step
+func setEnrichedVersion(p *Patch, step, version string) {
+	if p.Metadata == nil {
+		p.Metadata = make(map[string]interface{})
+	}
+	enriched, _ := p.Metadata[metaEnriched].(map[string]interface{})
+	if enriched == nil {
+		enriched = make(map[string]interface{})
+		p.Metadata[metaEnriched] = enriched
+	}
+	enriched[step] = version
+}
+
+// patchSource identifies the source a patch was extracted from
+func patchSource(p *Patch) string {
+	return orDefault(p.SourceID, p.ID)
+}
+
+// indexedFact is an embedded fact with the patch it belongs to
+type indexedFact struct {
+	ID     string
+	Patch  *Patch
+	Vector []float32
+}
+
+// indexFacts pairs each embedded fact with its patch
+func indexFacts(patches []*Patch, vectors map[string][]float32) []indexedFact {
+	var corpus []indexedFact
+	seen := make(map[string]bool)
+	for _, p := range patches {
+		for _, f := range p.Facts {
+			if v, ok := vectors[f.ID]; ok && !seen[f.ID] {
+				seen[f.ID] = true
+				corpus = append(corpus, indexedFact{ID: f.ID, Patch: p, Vector: v})
+			}
+		}
+	}
+	return corpus
+}
+
+// corroborateFacts records, for each of p's facts, the other sources with
+// a fact at least threshold similar, and adds p's source to those facts
+// in patches already corroborated with version. It returns how many facts
+// have corroboration, or false if some of p's facts are not embedded yet.
+func corroborateFacts(p *Patch, corpus []indexedFact, threshold float64, version string, touched map[string]*Patch) (int, bool) {
+	byID := make(map[string][]float32)
+	for _, f := range corpus {
+		if f.Patch == p {
+			byID[f.ID] = f.Vector
+		}
+	}
+	for _, f := range p.Facts {
+		if byID[f.ID] == nil {
+			return 0, false
+		}
+	}
+
+	source := patchSource(p)
+	sources := make(map[string]interface{})
+	corroborated := 0
+	for _, f := range p.Facts {
+		vec := byID[f.ID]
+		var by []string
+		for _, other := range corpus {
+			otherSource := patchSource(other.Patch)
+			if otherSource == source || dotProduct(vec, other.Vector) < threshold {
+				continue
+			}
+			by = appendUnique(by, otherSource)
+			if other.Patch != p && enrichedVersion(other.Patch, enrichStepCorroboration) == version &&
+				addCorroboration(other.Patch, other.ID, source) {
+				touched[other.Patch.ID] = other.Patch
+			}
+		}
+		if len(by) > 0 {
+			sort.Strings(by)
+			sources[f.ID] = by
+			corroborated++
+		}
+	}
+
+	if p.Metadata == nil {
+		p.Metadata = make(map[string]interface{})
+	}
+	p.Metadata[metaCorroboration] = sources
+	return corroborated, true
+}
+
+// addCorroboration adds source to the sources corroborating factID in p,
+// reporting whether it was new
+func addCorroboration(p *Patch, factID, source string) bool {
+	sources, _ := p.Metadata[metaCorroboration].(map[string]interface{})
+	if sources == nil {
+		sources = make(map[string]interface{})
+		p.Metadata[metaCorroboration] = sources
+	}
+	existing := stringList(sources[factID])
+	for _, s := range existing {
+		if s == source {
+			return false
+		}
+	}
+	existing = append(existing, source)
+	sort.Strings(existing)
+	sources[factID] = existing
+	return true
+}
+
+// stringList reads a []string from decoded JSON metadata
+func stringList(v interface{}) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// appendUnique appends s to list unless it is already present
+func appendUnique(list []string, s string) []string {
+	for _, existing := range list {
+		if existing == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// dotProduct is the cosine similarity of two unit vectors
+func dotProduct(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+// errOverBudget means a request would exceed the run's cost budget
+var errOverBudget = errors.New("cost budget reached")
+
+// knownEntities maps the case-folded names of entities already linked in
+// patches to their spelling, so new links reuse it
+func knownEntities(patches []*Patch) map[string]string {
+	names := make(map[string]string)
+	for _, p := range patches {
+		linked, _ := p.Metadata[metaEntities].(map[string]interface{})
+		for _, v := range linked {
+			for _, name := range stringList(v) {
+				if key := strings.ToLower(name); names[key] == "" {
+					names[key] = name
+				}
+			}
+		}
+	}
+	return names
+}
+
+// linkEntities asks Claude for the entities each of p's facts mentions and
+// records them in p's metadata, returning how many facts have entities.
+// New names are settled by resolver when they may be a known entity.
+func linkEntities(ctx context.Context, p *Patch, names map[string]string, resolver *entityResolver, budget *enrichLimits) (int, error) {
+	var list strings.Builder
+	for i, f := range p.Facts {
+		fmt.Fprintf(&list, "%d. %s\n", i+1, f.Text)
+	}
+	prompt := fmt.Sprintf(entityPrompt, list.String())
+	// Allow for an answer of about 60 characters per fact
+	if !budget.afford(estimateCost(claudeLightModel, len(prompt), 60*len(p.Facts))) {
+		return 0, errOverBudget
+	}
+
+	answer, err := askClaude(ctx, claudeLightModel, prompt)
+	if err != nil {
+		return 0, err
+	}
+	budget.spent += estimateCost(claudeLightModel, len(prompt), len(answer))
+	if m := codeBlockPattern.FindStringSubmatch(answer); m != nil {
+		answer = m[1]
+	}
+
+	var picked []struct {
+		Fact     int      `json:"fact"`
+		Entities []string `json:"entities"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(answer)), &picked); err != nil {
+		return 0, fmt.Errorf("failed to parse entities: %w", err)
+	}
+
+	linked := make(map[string]interface{})
+	for _, pick := range picked {
+		if pick.Fact < 1 || pick.Fact > len(p.Facts) {
+			continue
+		}
+		var entities []string
+		for _, name := range pick.Entities {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			key := strings.ToLower(name)
+			if names[key] == "" {
+				names[key] = resolver.resolve(name, p.Facts[pick.Fact-1].Text, names)
+			}
+			entities = appendUnique(entities, names[key])
+		}
+		if len(entities) > 0 {
+			linked[p.Facts[pick.Fact-1].ID] = entities
+		}
+	}
+
+	if p.Metadata == nil {
+		p.Metadata = make(map[string]interface{})
+	}
+	p.Metadata[metaEntities] = linked
+	return len(linked), nil
+}
+
+// EmbeddingVectors returns model's vectors of one kind, normalized to unit
+// length and keyed by item ID
+func (m *Manifest) EmbeddingVectors(model, kind string) (map[string][]float32, error) {
+	rows, err := m.db.Query("SELECT item_id, vector FROM embeddings WHERE model = ? AND kind = ?", model, kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	vectors := make(map[string][]float32)
+	for rows.Next() {
+		var id string
+		var packed []byte
+		if err := rows.Scan(&id, &packed); err != nil {
+			return nil, fmt.Errorf("failed to read embeddings: %w", err)
+		}
+		packed = normalizeVector(packed)
+		vec := make([]float32, len(packed)/4)
+		for i := range vec {
+			vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(packed[4*i:]))
+		}
+		vectors[id] = vec
+	}
+	return vectors, rows.Err()
+}
+
+// Nightly enrichment runs as a job in the serve queue, so it shows up in
+// 'vkm jobs' and can be canceled like any other job
+const (
+	enrichJobURL    = "vkm:enrich"
+	enrichJobOrigin = "nightly"
+)
+
+// serveEnrichAt is the local time of day serve modes queue enrichment
+var serveEnrichAt string
+
+func init() {
+	for _, cmd := range []*cobra.Command{ServeAPICmd, ServeWebhooksCmd} {
+		cmd.Flags().StringVar(&serveEnrichAt, "enrich-at", "", "Queue 'vkm enrich' daily at this local time (HH:MM)")
+		cmd.Flags().DurationVar(&enrichBudget, "enrich-budget", 30*time.Minute, "Time budget for each nightly enrichment")
+		cmd.Flags().Float64Var(&enrichMaxCost, "enrich-max-cost", 1.00, "Cost budget in USD for each nightly enrichment")
+		cmd.Flags().StringVar(&enrichDataDir, "enrich-data", "data", "Directory holding the local patches to enrich")
+	}
+}
+
+// isEnrichJob reports whether job is a scheduled enrichment rather than a
+// URL to process. Only the scheduler can queue one; a submitted
+// "vkm:enrich" URL fails like any other bad URL.
+func isEnrichJob(job *Job) bool {
+	return job.URL == enrichJobURL && job.Origin == enrichJobOrigin
+}
+
+// scheduleDailyJob queues the internal job url from origin every day at
+// the time of day in at, until ctx is done; name describes it in messages
+func scheduleDailyJob(ctx context.Context, m *Manifest, at time.Time, url, origin, name string) {
+	for {
+		next := nextDailyRun(time.Now(), at)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		if job, err := m.EnqueueJob(url, origin); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			fmt.Printf("Queued %s as job %d\n", name, job.ID)
+		}
+	}
+}
+
+// nextDailyRun returns the first time after now at at's hour and minute
+func nextDailyRun(now, at time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultEntityRules is where entity rules are read from; a missing file
+// means no rules
+const defaultEntityRules = "data/entity-rules.yaml"
+
+// entityDecidedByUser marks decisions made at the --interactive prompt
+const entityDecidedByUser = "interactive"
+
+// entityRule settles one ambiguous name in an entity rules file: link it
+// to an existing entity, or keep it as an entity of its own
+type entityRule struct {
+	Name     string `yaml:"name"`
+	Link     string `yaml:"link"`
+	Separate bool   `yaml:"separate"`
+}
+
+// entityRulesConfig is the format of --entity-rules:
+//
+//	entities:
+//	  - name: Altman
+//	    link: Sam Altman
+//	  - name: Mercury
+//	    separate: true
+type entityRulesConfig struct {
+	Entities []entityRule `yaml:"entities"`
+}
+
+// loadEntityRules reads an entity rules file into the spelling each
+// case-folded name resolves to. A missing file has no rules.
+func loadEntityRules(path string) (map[string]string, error) {
+	rules := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entity rules: %w", err)
+	}
+	var c entityRulesConfig
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse entity rules %s: %w", path, err)
+	}
+	for i, r := range c.Entities {
+		name := strings.TrimSpace(r.Name)
+		link := strings.TrimSpace(r.Link)
+		if name == "" || (link == "") == !r.Separate {
+			return nil, fmt.Errorf("entity rules %s: rule %d needs a name and exactly one of link or separate", path, i+1)
+		}
+		if r.Separate {
+			link = name
+		}
+		rules[strings.ToLower(name)] = link
+	}
+	return rules, nil
+}
+
+// EntityDecisions returns the remembered spelling each case-folded
+// ambiguous name resolves to
+func (m *Manifest) EntityDecisions() (map[string]string, error) {
+	rows, err := m.db.Query("SELECT name, entity FROM entity_decisions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entity decisions: %w", err)
+	}
+	defer rows.Close()
+
+	decisions := make(map[string]string)
+	for rows.Next() {
+		var name, entity string
+		if err := rows.Scan(&name, &entity); err != nil {
+			return nil, fmt.Errorf("failed to read entity decisions: %w", err)
+		}
+		decisions[name] = entity
+	}
+	return decisions, rows.Err()
+}
+
+// RecordEntityDecision remembers that name refers to entity
+func (m *Manifest) RecordEntityDecision(name, entity, decidedBy string) error {
+	return m.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO entity_decisions (name, entity, decided_by, decided_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(name) DO UPDATE SET
+				entity     = excluded.entity,
+				decided_by = excluded.decided_by,
+				decided_at = excluded.decided_at`,
+			strings.ToLower(name), entity, decidedBy, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("failed to record entity decision: %w", err)
+		}
+		return nil
+	})
+}
+
+// entityResolver settles names the entities step links that plausibly
+// match several entities already in the store. Rules come first, then
+// decisions remembered in the manifest, then, in interactive mode, the
+// user; a name nobody decided stays an entity of its own.
+type entityResolver struct {
+	m         *Manifest
+	rules     map[string]string
+	decisions map[string]string
+	// in and out are the terminal interactive choices are made on; a nil
+	// in means no one is asked
+	in  *bufio.Reader
+	out io.Writer
+	// Unresolved are the ambiguous names kept separate without a decision
+	Unresolved []string
+}
+
+// newEntityResolver loads rules from rulesPath and the manifest's
+// remembered decisions, asking on stdin when interactive
+func newEntityResolver(m *Manifest, rulesPath string, interactive bool) (*entityResolver, error) {
+	rules, err := loadEntityRules(rulesPath)
+	if err != nil {
+		return nil, err
+	}
+	decisions, err := m.EntityDecisions()
+	if err != nil {
+		return nil, err
+	}
+	r := &entityResolver{m: m, rules: rules, decisions: decisions, out: os.Stdout}
+	if interactive {
+		r.in = bufio.NewReader(os.Stdin)
+	}
+	return r, nil
+}
+
+// resolve returns the spelling a new name links to, given the known
+// entities by case-folded name and the fact mentioning it
+func (r *entityResolver) resolve(name, fact string, names map[string]string) string {
+	key := strings.ToLower(name)
+	if entity, ok := r.rules[key]; ok {
+		return entity
+	}
+	if entity, ok := r.decisions[key]; ok {
+		return entity
+	}
+
+	candidates := plausibleEntities(name, names)
+	if len(candidates) == 0 {
+		return name
+	}
+	if r.in == nil {
+		r.Unresolved = appendUnique(r.Unresolved, name)
+		return name
+	}
+
+	entity, ok := r.ask(name, fact, candidates)
+	if !ok {
+		r.Unresolved = appendUnique(r.Unresolved, name)
+		return name
+	}
+	r.decisions[key] = entity
+	if err := r.m.RecordEntityDecision(name, entity, entityDecidedByUser); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return entity
+}
+
+// ask prompts for the entity name refers to. It returns false when the
+// user skips the decision or input ends.
+func (r *entityResolver) ask(name, fact string, candidates []string) (string, bool) {
+	fmt.Fprintf(r.out, "\n%q could be an entity already in the graph.\n", name)
+	fmt.Fprintf(r.out, "  Fact: %s\n", fact)
+	for i, c := range candidates {
+		fmt.Fprintf(r.out, "  %d) %s\n", i+1, c)
+	}
+	fmt.Fprintf(r.out, "  n) a new entity %q\n", name)
+	fmt.Fprintln(r.out, "  s) skip (decide later)")
+
+	for {
+		fmt.Fprintf(r.out, "Choice [1-%d/n/s]: ", len(candidates))
+		line, err := r.in.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		switch {
+		case answer == "n":
+			return name, true
+		case answer == "s" || (answer == "" && err != nil):
+			return "", false
+		}
+		if i, convErr := strconv.Atoi(answer); convErr == nil && i >= 1 && i <= len(candidates) {
+			return candidates[i-1], true
+		}
+		if err != nil {
+			return "", false
+		}
+	}
+}
+
+// plausibleEntities returns the known entities name may refer to: those
+// whose words include all of its words, or whose words it includes, as
+// "Altman" and "Sam Altman" do
+func plausibleEntities(name string, names map[string]string) []string {
+	words := entityWords(name)
+	if len(words) == 0 {
+		return nil
+	}
+	var candidates []string
+	for key, entity := range names {
+		if key == strings.ToLower(name) {
+			continue
+		}
+		known := entityWords(entity)
+		if containsWords(known, words) || containsWords(words, known) {
+			candidates = append(candidates, entity)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// entityWords is the set of case-folded words in an entity name
+func entityWords(name string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[w] = true
+	}
+	return words
+}
+
+// containsWords reports whether every word of sub is in set
+func containsWords(set, sub map[string]bool) bool {
+	if len(sub) == 0 {
+		return false
+	}
+	for w := range sub {
+		if !set[w] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,662 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+// ExportCmd exports facts from the local patch store
+var ExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export facts from local patches, optionally filtered by a query",
+	Long: `Export facts from the patches stored under --data (sandbox runs,
+supplementary patches, imported bundles). With --query only the matching
+facts are exported, together with the edges between them, instead of
+everything.
+
+Query terms are separated by spaces and must all match. Prefix a term
+with - to negate it; quote values containing spaces.
+  topic:<name>        fact topic (case-insensitive)
+  tag:<name>          fact tag, including taxonomy topics from 'vkm tag'
+  source:<id>         patch source ID (video ID)
+  collection:<name>   collection the source was ingested under (--collection)
+  since:<date>        valid from this date on (YYYY, YYYY-MM or YYYY-MM-DD)
+  until:<date>        valid before the end of this period
+  confidence:<min>    confidence of at least min
+  text:<word>, word   claim text contains the word (case-insensitive)
+
+Each patch carries its source's license (see 'vkm licenses'), with rules
+from --licenses applied on top. With --exclude-nonderivable, patches whose
+source forbids derivative works (No-Derivatives licenses, the Standard
+YouTube License) are left out. Exports including facts from sources with
+restrictive licenses, or with no license information, are warned about.
+
+Facts carry their review history from 'vkm facts' (claim/history: who
+edited, rejected or merged them, when and why) and curators' notes from
+'vkm annotate' (claim/annotations; patch/annotations on patches).
+Rejected facts and merged duplicates are left out unless
+--include-retired is given.
+
+Formats:
+  json    patches holding the matching facts and edges (default)
+  jsonl   one fact per line, with its patch ID and source
+  csv     one fact per row
+  edn     patches as EDN, with the keywords, #uuid and #inst values of
+          core/resources/schema/patch.edn, for the Clojure core
+  sqlite  a standalone SQLite database (-o required) with tables for
+          sources, patches, commits, facts, fact_tags, fact_history,
+          annotations, edges and embeddings. Sources are completed from
+          the --manifest catalog, and embeddings of the exported facts
+          and their sources' transcript segments are copied from it as
+          little-endian float32 blobs.
+
+With --since-last only patches new or changed since the previous
+--since-last export are written, for incremental syncing into search
+indexes, wikis and other downstream systems. Each consumer keeps its own
+cursor in the --manifest, named with --cursor; the cursor advances only
+once the export is written. A changed patch (reviewed facts, new notes)
+is written whole, and consumers should replace the copy they hold with
+the same patch ID. Filters apply before the comparison, so a patch whose
+last matching fact was retired is not written again; a new cursor name
+starts from scratch.
+
+Examples:
+  vkm export --query "topic:category-theory since:2024-01"
+  vkm export --query 'source:dQw4w9WgXcQ confidence:0.8 -tag:supplementary' --format csv -o facts.csv
+  vkm export --exclude-nonderivable -o shareable.json
+  vkm export --format sqlite -o graph.db
+  vkm export --query collection:scaling-laws --format jsonl
+  vkm export --since-last --cursor search-index --format jsonl -o delta.jsonl`,
+	RunE: runExport,
+}
+
+var (
+	exportDataDir             string
+	exportManifest            string
+	exportQuery               string
+	exportFormat              string
+	exportOutput              string
+	exportLicenses            string
+	exportExcludeNonderivable bool
+	exportIncludeRetired      bool
+	exportSinceLast           bool
+	exportCursor              string
+)
+
+func init() {
+	ExportCmd.Flags().StringVar(&exportDataDir, "data", "data", "Directory holding local patches")
+	ExportCmd.Flags().StringVarP(&exportQuery, "query", "q", "", "Only export facts matching this query")
+	ExportCmd.Flags().StringVar(&exportFormat, "format", "json", "Output format (json, jsonl, csv, edn, sqlite)")
+	ExportCmd.Flags().StringVar(&exportManifest, "manifest", "data/manifest.db", "SQLite manifest with source details and embeddings (sqlite format) and export cursors")
+	ExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Output file (default stdout)")
+	ExportCmd.Flags().StringVar(&exportLicenses, "licenses", defaultLicenseConfig, "YAML file assigning licenses to sources")
+	ExportCmd.Flags().BoolVar(&exportExcludeNonderivable, "exclude-nonderivable", false, "Leave out patches whose source license forbids derivative works")
+	ExportCmd.Flags().BoolVar(&exportIncludeRetired, "include-retired", false, "Include facts rejected or merged away with 'vkm facts'")
+	ExportCmd.Flags().BoolVar(&exportSinceLast, "since-last", false, "Only export patches new or changed since the last --since-last export")
+	ExportCmd.Flags().StringVar(&exportCursor, "cursor", defaultExportCursor, "Name of the --since-last cursor, one per downstream consumer")
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	query, err := parseFactQuery(exportQuery)
+	if err != nil {
+		return err
+	}
+
+	licenses, err := loadLicenseConfig(exportLicenses)
+	if err != nil {
+		return err
+	}
+
+	patches, err := loadLocalPatches(exportDataDir)
+	if err != nil {
+		return err
+	}
+	for _, p := range patches {
+		resolvePatchLicense(p, licenses)
+	}
+	if exportExcludeNonderivable {
+		patches = excludeNonderivable(patches)
+	}
+	if !exportIncludeRetired {
+		patches = withoutRetiredFacts(patches)
+	}
+	selected := query.Select(patches)
+
+	if exportFormat == "sqlite" && exportOutput == "" {
+		return fmt.Errorf("--format sqlite needs an output file (-o)")
+	}
+	var manifest *Manifest
+	if exportFormat == "sqlite" || exportSinceLast {
+		if manifest, err = openManifest(exportManifest); err != nil {
+			return err
+		}
+		defer manifest.Close()
+	}
+	var hashes map[string]string
+	if exportSinceLast {
+		if selected, hashes, err = changedSinceCursor(manifest, exportCursor, selected); err != nil {
+			return err
+		}
+	}
+
+	if exportFormat == "sqlite" {
+		if err := writeSQLiteExport(exportOutput, selected, manifest); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+		return finishExport(manifest, selected, hashes)
+	}
+
+	var out io.Writer = os.Stdout
+	if exportOutput != "" {
+		f, err := os.Create(exportOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	switch exportFormat {
+	case "json":
+		err = writePatchesJSON(out, selected)
+	case "jsonl":
+		err = writeFactsJSONL(out, selected)
+	case "csv":
+		err = writeFactsCSV(out, selected)
+	case "edn":
+		err = writePatchesEDN(out, selected)
+	default:
+		return fmt.Errorf("unknown format %q (use json, jsonl, csv, edn or sqlite)", exportFormat)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return finishExport(manifest, selected, hashes)
+}
+
+// finishExport advances the --since-last cursor past the written patches
+// and reports the export
+func finishExport(m *Manifest, selected []*Patch, hashes map[string]string) error {
+	if exportSinceLast {
+		if err := m.AdvanceExportCursor(exportCursor, hashes); err != nil {
+			return err
+		}
+	}
+	reportExport(selected)
+	return nil
+}
+
+// reportExport summarizes what was exported on stderr
+func reportExport(selected []*Patch) {
+	facts := 0
+	for _, p := range selected {
+		facts += len(p.Facts)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d facts from %d patches\n", facts, len(selected))
+	warnRestrictiveLicenses(selected)
+}
+
+// excludeNonderivable drops patches whose source's license forbids
+// derivative works. Patches without a known license are kept.
+func excludeNonderivable(patches []*Patch) []*Patch {
+	var kept []*Patch
+	sources := make(map[string]bool)
+	for _, p := range patches {
+		if l, ok := patchLicense(p); ok && !l.Derivatives {
+			sources[orDefault(p.SourceID, p.ID)] = true
+			continue
+		}
+		kept = append(kept, p)
+	}
+	if excluded := len(patches) - len(kept); excluded > 0 {
+		fmt.Fprintf(os.Stderr, "Excluded %d patches from %d sources whose licenses forbid derivative works\n", excluded, len(sources))
+	}
+	return kept
+}
+
+// withoutRetiredFacts returns copies of the patches without rejected and
+// merged-away facts or the edges touching them
+func withoutRetiredFacts(patches []*Patch) []*Patch {
+	kept := make([]*Patch, 0, len(patches))
+	for _, p := range patches {
+		retired := make(map[string]bool)
+		for i := range p.Facts {
+			if p.Facts[i].Retired() {
+				retired[p.Facts[i].ID] = true
+			}
+		}
+		if len(retired) == 0 {
+			kept = append(kept, p)
+			continue
+		}
+		sub := *p
+		sub.Facts = nil
+		sub.Edges = []Edge{}
+		for _, f := range p.Facts {
+			if !retired[f.ID] {
+				sub.Facts = append(sub.Facts, f)
+			}
+		}
+		for _, e := range p.Edges {
+			if !retired[e.From] && !retired[e.To] {
+				sub.Edges = append(sub.Edges, e)
+			}
+		}
+		kept = append(kept, &sub)
+	}
+	return kept
+}
+
+// warnRestrictiveLicenses warns about exported facts derived from sources
+// whose licenses forbid derivatives or commercial use, or are unknown
+func warnRestrictiveLicenses(patches []*Patch) {
+	type restricted struct {
+		license sourceLicense
+		sources map[string]bool
+		facts   int
+	}
+	byLicense := make(map[string]*restricted)
+	unknown := make(map[string]bool)
+	for _, p := range patches {
+		source := orDefault(p.SourceID, p.ID)
+		l, ok := patchLicense(p)
+		if !ok {
+			unknown[source] = true
+			continue
+		}
+		if !l.Restrictive() {
+			continue
+		}
+		r := byLicense[l.ID]
+		if r == nil {
+			r = &restricted{license: l, sources: make(map[string]bool)}
+			byLicense[l.ID] = r
+		}
+		r.sources[source] = true
+		r.facts += len(p.Facts)
+	}
+
+	if len(byLicense) > 0 {
+		ids := make([]string, 0, len(byLicense))
+		for id := range byLicense {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		fmt.Fprintln(os.Stderr, "Warning: the export includes facts derived from sources with restrictive licenses:")
+		for _, id := range ids {
+			r := byLicense[id]
+			fmt.Fprintf(os.Stderr, "  %s (%s): %d facts from %d sources\n", id, r.license.Summary(), r.facts, len(r.sources))
+		}
+		if !exportExcludeNonderivable {
+			fmt.Fprintln(os.Stderr, "  Use --exclude-nonderivable to leave out sources that forbid derivative works")
+		}
+	}
+	if len(unknown) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d exported sources have no license information; run 'vkm licenses' to record it\n", len(unknown))
+	}
+}
+
+// loadLocalPatches reads every patch under root, from patch JSON files
+// and patch packs. Patches saved more than once (re-imported bundles,
+// say) are returned once.
+func loadLocalPatches(root string) ([]*Patch, error) {
+	var patches []*Patch
+	seen := make(map[string]bool)
+	err := streamLocalPatches(root, func(path string, p *Patch) error {
+		if !seen[p.ID] {
+			seen[p.ID] = true
+			patches = append(patches, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(patches, func(i, j int) bool { return patches[i].Timestamp.Before(patches[j].Timestamp) })
+	return patches, nil
+}
+
+// localPatchFile is a patch and the JSON file it was read from
+type localPatchFile struct {
+	Path  string
+	Patch *Patch
+}
+
+// loadLocalPatchFiles reads every patch JSON file under root, copies of
+// the same patch included. Patches in packs are left out: commands that
+// rewrite patches in place only rewrite JSON files.
+func loadLocalPatchFiles(root string) ([]localPatchFile, error) {
+	var files []localPatchFile
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if patch := readLocalPatchJSON(path); patch != nil {
+			files = append(files, localPatchFile{Path: path, Patch: patch})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return files, nil
+}
+
+// streamLocalPatches calls fn with every patch under root and the file
+// it is in, one patch at a time: those of patch JSON files and, read
+// without loading them whole, of patch packs. Copies of the same patch
+// are all passed. An error from fn stops the walk and is returned.
+func streamLocalPatches(root string, fn func(path string, p *Patch) error) error {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(path, patchPackExt) {
+			return streamPatchPack(path, fn)
+		}
+		if patch := readLocalPatchJSON(path); patch != nil {
+			return fn(path, patch)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return nil
+}
+
+// streamPatchPack calls fn with each patch of the pack at path. A pack
+// that can't be read to the end is warned about, keeping the patches
+// read before.
+func streamPatchPack(path string, fn func(path string, p *Patch) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", path, err)
+		return nil
+	}
+	defer f.Close()
+	pack, err := newPatchPackReader(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", path, err)
+		return nil
+	}
+	for {
+		patch, err := pack.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s is truncated or corrupt: %v\n", path, err)
+			return nil
+		}
+		if err := fn(path, patch); err != nil {
+			return err
+		}
+	}
+}
+
+// readLocalPatchJSON reads the patch JSON file at path, or returns nil if
+// path holds something else
+func readLocalPatchJSON(path string) *Patch {
+	if !strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".info.json") {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var shape map[string]json.RawMessage
+	if json.Unmarshal(data, &shape) != nil {
+		return nil
+	}
+	if _, ok := shape["patch/facts"]; !ok {
+		return nil
+	}
+	var patch Patch
+	if err := json.Unmarshal(data, &patch); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", path, err)
+		return nil
+	}
+	return &patch
+}
+
+// factQuery is a parsed --query: a conjunction of terms
+type factQuery struct {
+	terms []queryTerm
+}
+
+// queryTerm is one field:value condition, possibly negated
+type queryTerm struct {
+	field  string
+	value  string
+	negate bool
+	from   time.Time
+	to     time.Time
+	min    float64
+}
+
+// parseFactQuery parses the query language described in 'vkm export --help'
+func parseFactQuery(text string) (*factQuery, error) {
+	tokens, err := splitQuery(text)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &factQuery{}
+	for _, tok := range tokens {
+		term := queryTerm{field: "text"}
+		if strings.HasPrefix(tok, "-") && len(tok) > 1 {
+			term.negate = true
+			tok = tok[1:]
+		}
+		if field, value, ok := strings.Cut(tok, ":"); ok {
+			term.field, tok = strings.ToLower(field), value
+		}
+		term.value = strings.ToLower(tok)
+		if term.value == "" {
+			return nil, fmt.Errorf("empty value for %s: in query", term.field)
+		}
+
+		switch term.field {
+		case "topic", "tag", "source", "collection", "text":
+		case "since", "until":
+			if term.from, term.to, err = parseQueryPeriod(tok); err != nil {
+				return nil, err
+			}
+		case "confidence":
+			if term.min, err = strconv.ParseFloat(tok, 64); err != nil {
+				return nil, fmt.Errorf("invalid confidence %q in query", tok)
+			}
+		default:
+			return nil, fmt.Errorf("unknown query field %q", term.field)
+		}
+		q.terms = append(q.terms, term)
+	}
+	return q, nil
+}
+
+// splitQuery splits on whitespace, keeping double-quoted runs together
+func splitQuery(text string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	quoted := false
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in query")
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, nil
+}
+
+// parseQueryPeriod parses YYYY, YYYY-MM or YYYY-MM-DD as a half-open period
+func parseQueryPeriod(value string) (from, to time.Time, err error) {
+	for _, layout := range []struct {
+		format string
+		years  int
+		months int
+		days   int
+	}{
+		{"2006-01-02", 0, 0, 1},
+		{"2006-01", 0, 1, 0},
+		{"2006", 1, 0, 0},
+	} {
+		if t, err := time.Parse(layout.format, value); err == nil {
+			return t, t.AddDate(layout.years, layout.months, layout.days), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q in query (use YYYY, YYYY-MM or YYYY-MM-DD)", value)
+}
+
+// Match reports whether a fact in patch satisfies every term
+func (q *factQuery) Match(patch *Patch, fact *Fact) bool {
+	for _, t := range q.terms {
+		if t.match(patch, fact) == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (t queryTerm) match(patch *Patch, fact *Fact) bool {
+	switch t.field {
+	case "topic":
+		return strings.ToLower(fact.Topic) == t.value
+	case "tag":
+		for _, tag := range fact.Tags {
+			if strings.ToLower(tag) == t.value {
+				return true
+			}
+		}
+		return false
+	case "source":
+		return strings.ToLower(patch.SourceID) == t.value
+	case "collection":
+		return strings.ToLower(patchCollection(patch)) == t.value
+	case "since":
+		return !fact.ValidFrom.Before(t.from)
+	case "until":
+		return fact.ValidFrom.Before(t.to)
+	case "confidence":
+		return fact.Confidence >= t.min
+	default:
+		return strings.Contains(strings.ToLower(fact.Text), t.value)
+	}
+}
+
+// Select returns copies of the patches reduced to matching facts and the
+// edges between them; patches with no matching facts are dropped
+func (q *factQuery) Select(patches []*Patch) []*Patch {
+	var selected []*Patch
+	for _, p := range patches {
+		sub := *p
+		sub.Facts = nil
+		sub.Edges = []Edge{}
+		kept := make(map[string]bool)
+		for i := range p.Facts {
+			if q.Match(p, &p.Facts[i]) {
+				sub.Facts = append(sub.Facts, p.Facts[i])
+				kept[p.Facts[i].ID] = true
+			}
+		}
+		if len(sub.Facts) == 0 {
+			continue
+		}
+		for _, e := range p.Edges {
+			if kept[e.From] && kept[e.To] {
+				sub.Edges = append(sub.Edges, e)
+			}
+		}
+		selected = append(selected, &sub)
+	}
+	return selected
+}
+
+func writePatchesJSON(w io.Writer, patches []*Patch) error {
+	if patches == nil {
+		patches = []*Patch{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(patches)
+}
+
+// exportedFact is a fact flattened with its patch for jsonl export
+type exportedFact struct {
+	Fact
+	PatchID  string `json:"patch/id"`
+	SourceID string `json:"patch/source-id,omitempty"`
+	License  string `json:"patch/source-license,omitempty"`
+}
+
+func writeFactsJSONL(w io.Writer, patches []*Patch) error {
+	enc := json.NewEncoder(w)
+	for _, p := range patches {
+		for _, f := range p.Facts {
+			l, _ := patchLicense(p)
+			if err := enc.Encode(exportedFact{Fact: f, PatchID: p.ID, SourceID: p.SourceID, License: l.ID}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeFactsCSV(w io.Writer, patches []*Patch) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"fact_id", "patch_id", "source_id", "valid_from", "topic", "confidence", "tags", "text", "source_license", "history", "notes"})
+	for _, p := range patches {
+		l, _ := patchLicense(p)
+		for _, f := range p.Facts {
+			history := make([]string, len(f.History))
+			for i, e := range f.History {
+				history[i] = e.describe()
+			}
+			notes := make([]string, len(f.Annotations))
+			for i, a := range f.Annotations {
+				notes[i] = a.describe()
+			}
+			cw.Write([]string{
+				f.ID,
+				p.ID,
+				p.SourceID,
+				f.ValidFrom.UTC().Format(time.RFC3339),
+				f.Topic,
+				strconv.FormatFloat(f.Confidence, 'f', -1, 64),
+				strings.Join(f.Tags, ";"),
+				f.Text,
+				l.ID,
+				strings.Join(history, "; "),
+				strings.Join(notes, "; "),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
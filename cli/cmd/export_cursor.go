@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// defaultExportCursor is the --cursor of exports that don't name one
+const defaultExportCursor = "default"
+
+// ExportCursor returns the content hash of every patch last exported
+// under cursor, by patch ID
+func (m *Manifest) ExportCursor(cursor string) (map[string]string, error) {
+	rows, err := m.db.Query("SELECT patch_id, hash FROM export_cursors WHERE cursor = ?", cursor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export cursor: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var id, hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			return nil, fmt.Errorf("failed to read export cursor: %w", err)
+		}
+		hashes[id] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// AdvanceExportCursor records patches as exported under cursor with the
+// given content hashes
+func (m *Manifest) AdvanceExportCursor(cursor string, hashes map[string]string) error {
+	now := time.Now().UTC()
+	return m.write(func(tx *sql.Tx) error {
+		for id, hash := range hashes {
+			_, err := tx.Exec(`
+				INSERT INTO export_cursors (cursor, patch_id, hash, exported_at) VALUES (?, ?, ?, ?)
+				ON CONFLICT(cursor, patch_id) DO UPDATE SET
+					hash        = excluded.hash,
+					exported_at = excluded.exported_at`,
+				cursor, id, hash, now)
+			if err != nil {
+				return fmt.Errorf("failed to advance export cursor: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// exportedPatchHash fingerprints a patch as exported, so edits made since
+// (reviewed facts, new annotations, changed licenses) count as changes
+func exportedPatchHash(p *Patch) string {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// changedSinceCursor returns the patches that are new or changed since
+// the last export under cursor, with the hashes to advance it by
+func changedSinceCursor(m *Manifest, cursor string, patches []*Patch) ([]*Patch, map[string]string, error) {
+	seen, err := m.ExportCursor(cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	var changed []*Patch
+	hashes := make(map[string]string)
+	for _, p := range patches {
+		hash := exportedPatchHash(p)
+		if seen[p.ID] == hash {
+			continue
+		}
+		changed = append(changed, p)
+		hashes[p.ID] = hash
+	}
+	return changed, hashes, nil
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// ednKeywordValues are the keys whose values the schema types as
+// keywords; they are written as keywords when they are valid ones
+var ednKeywordValues = map[string]bool{"patch/source": true, "claim/topic": true, "edge/relation": true}
+
+// ednUUIDValues are the keys whose values the schema types as UUIDs;
+// they are written as #uuid when they are valid ones
+var ednUUIDValues = map[string]bool{"db/id": true, "edge/from": true, "edge/to": true, "claim/revises": true}
+
+var (
+	ednKeyword = regexp.MustCompile(`^[A-Za-z*+!_?<>=.-][A-Za-z0-9*+!_?<>=.:/-]*$`)
+	ednUUID    = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// writePatchesEDN writes patches as an EDN vector of maps in the shape of
+// core/resources/schema/patch.edn, so the Clojure core can read them with
+// clojure.edn: keys are namespaced keywords, IDs and edge ends that are
+// UUIDs are #uuid, times are #inst, and sources, topics and relations are keywords.
+func writePatchesEDN(w io.Writer, patches []*Patch) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+	for i, p := range patches {
+		if i > 0 {
+			bw.WriteString("\n ")
+		}
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		writeEDNValue(bw, "", v)
+	}
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
+
+// writeEDNValue writes a decoded JSON value as EDN; key is the map key it
+// is the value of, if any
+func writeEDNValue(w *bufio.Writer, key string, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("nil")
+	case bool:
+		fmt.Fprint(w, v)
+	case json.Number:
+		w.WriteString(v.String())
+	case string:
+		writeEDNString(w, key, v)
+	case []interface{}:
+		w.WriteString("[")
+		for i, item := range v {
+			if i > 0 {
+				w.WriteString(" ")
+			}
+			writeEDNValue(w, "", item)
+		}
+		w.WriteString("]")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w.WriteString("{")
+		for i, k := range keys {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			if ednKeyword.MatchString(k) {
+				w.WriteString(":" + k)
+			} else {
+				writeEDNString(w, "", k)
+			}
+			w.WriteString(" ")
+			writeEDNValue(w, k, v[k])
+		}
+		w.WriteString("}")
+	}
+}
+
+// writeEDNString writes s, the value of key, as the EDN value the schema
+// gives key: a keyword, #uuid, #inst, or else a string
+func writeEDNString(w *bufio.Writer, key, s string) {
+	switch {
+	case ednKeywordValues[key] && ednKeyword.MatchString(s):
+		w.WriteString(":" + s)
+		return
+	case ednUUIDValues[key] && ednUUID.MatchString(s):
+		w.WriteString(`#uuid "` + s + `"`)
+		return
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		w.WriteString(`#inst "` + t.UTC().Format("2006-01-02T15:04:05.000Z") + `"`)
+		return
+	}
+	w.WriteString(`"`)
+	for _, r := range s {
+		switch r {
+		case '"':
+			w.WriteString(`\"`)
+		case '\\':
+			w.WriteString(`\\`)
+		case '\n':
+			w.WriteString(`\n`)
+		case '\r':
+			w.WriteString(`\r`)
+		case '\t':
+			w.WriteString(`\t`)
+		default:
+			w.WriteRune(r)
+		}
+	}
+	w.WriteString(`"`)
+}
@@ -0,0 +1,345 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// sqliteExportSchema is the layout of 'vkm export --format sqlite'.
+// Timestamps are RFC 3339 text in UTC and metadata is JSON text, so the
+// file reads the same in any SQL tool.
+const sqliteExportSchema = `
+CREATE TABLE sources (
+	source_id   TEXT PRIMARY KEY,
+	kind        TEXT,
+	url         TEXT,
+	title       TEXT,
+	channel     TEXT,
+	published   TEXT,
+	collection  TEXT,
+	license     TEXT,
+	derivatives INTEGER,
+	commercial  INTEGER
+);
+CREATE TABLE patches (
+	patch_id  TEXT PRIMARY KEY,
+	source_id TEXT REFERENCES sources(source_id),
+	timestamp TEXT,
+	metadata  TEXT
+);
+CREATE TABLE commits (
+	patch_id       TEXT PRIMARY KEY REFERENCES patches(patch_id),
+	committed_at   TEXT,
+	published_at   TEXT,
+	ingested_at    TEXT,
+	playlist_id    TEXT,
+	playlist_index INTEGER,
+	sequence       INTEGER,
+	sandbox_run    TEXT
+);
+CREATE TABLE facts (
+	fact_id            TEXT PRIMARY KEY,
+	patch_id           TEXT NOT NULL REFERENCES patches(patch_id),
+	text               TEXT NOT NULL,
+	topic              TEXT,
+	confidence         REAL,
+	valid_from         TEXT,
+	chapter            TEXT,
+	timestamp_in_video REAL,
+	extracted_from     TEXT,
+	retired            INTEGER NOT NULL
+);
+CREATE TABLE fact_tags (
+	fact_id TEXT NOT NULL REFERENCES facts(fact_id),
+	tag     TEXT NOT NULL,
+	PRIMARY KEY (fact_id, tag)
+);
+CREATE TABLE fact_history (
+	fact_id     TEXT NOT NULL REFERENCES facts(fact_id),
+	seq         INTEGER NOT NULL,
+	action      TEXT NOT NULL,
+	by          TEXT,
+	at          TEXT,
+	reason      TEXT,
+	previous    TEXT,
+	merged_into TEXT,
+	merged_from TEXT,
+	PRIMARY KEY (fact_id, seq)
+);
+CREATE TABLE annotations (
+	patch_id TEXT NOT NULL REFERENCES patches(patch_id),
+	fact_id  TEXT,
+	note     TEXT NOT NULL,
+	by       TEXT,
+	at       TEXT
+);
+CREATE TABLE edges (
+	edge_id  TEXT PRIMARY KEY,
+	patch_id TEXT NOT NULL REFERENCES patches(patch_id),
+	from_id  TEXT NOT NULL,
+	to_id    TEXT NOT NULL,
+	relation TEXT,
+	strength REAL
+);
+CREATE TABLE embeddings (
+	kind    TEXT NOT NULL,
+	item_id TEXT NOT NULL,
+	model   TEXT NOT NULL,
+	dims    INTEGER NOT NULL,
+	vector  BLOB NOT NULL,
+	PRIMARY KEY (kind, item_id, model)
+);
+CREATE INDEX facts_patch ON facts(patch_id);
+CREATE INDEX facts_topic ON facts(topic);
+CREATE INDEX patches_source ON patches(source_id);
+CREATE INDEX edges_from ON edges(from_id);
+CREATE INDEX edges_to ON edges(to_id);
+`
+
+// writeSQLiteExport writes patches to a new SQLite database at path,
+// replacing any file there. Source details and embeddings come from the
+// manifest m.
+func writeSQLiteExport(path string, patches []*Patch, m *Manifest) error {
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to replace %s: %w", path, err)
+		}
+	}
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(sqliteExportSchema); err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+	sources, err := insertExportedPatches(tx, patches)
+	if err != nil {
+		return err
+	}
+	if err := insertExportedSources(tx, m, patches); err != nil {
+		return err
+	}
+	if err := insertExportedEmbeddings(tx, m, patches, sources); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rfc3339 formats t for the export, NULL for the zero time
+func rfc3339(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// jsonText encodes v as JSON text, or NULL when empty
+func jsonText(v interface{}) (interface{}, error) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		if len(m) == 0 {
+			return nil, nil
+		}
+	case nil:
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// nullable turns "" into NULL
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// insertExportedPatches writes patches with their commits, facts and
+// edges, returning the source IDs they came from
+func insertExportedPatches(tx *sql.Tx, patches []*Patch) (map[string]bool, error) {
+	sources := make(map[string]bool)
+	for _, p := range patches {
+		meta, err := jsonText(p.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode metadata of %s: %w", p.ID, err)
+		}
+		if p.SourceID != "" {
+			sources[p.SourceID] = true
+		}
+		if _, err := tx.Exec("INSERT INTO patches (patch_id, source_id, timestamp, metadata) VALUES (?, ?, ?, ?)",
+			p.ID, nullable(p.SourceID), rfc3339(p.Timestamp), meta); err != nil {
+			return nil, fmt.Errorf("failed to export patch %s: %w", p.ID, err)
+		}
+
+		str := func(key string) interface{} {
+			s, _ := p.Metadata[key].(string)
+			return nullable(s)
+		}
+		num := func(key string) interface{} {
+			if n, ok := p.Metadata[key].(float64); ok {
+				return int(n)
+			}
+			if n, ok := p.Metadata[key].(int); ok {
+				return n
+			}
+			return nil
+		}
+		if _, err := tx.Exec(`INSERT INTO commits (patch_id, committed_at, published_at, ingested_at, playlist_id, playlist_index, sequence, sandbox_run)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.ID, rfc3339(p.Timestamp), str("published-at"), str("ingested-at"), str("playlist-id"),
+			num("playlist-index"), num("sequence"), str("sandbox-run")); err != nil {
+			return nil, fmt.Errorf("failed to export commit of %s: %w", p.ID, err)
+		}
+
+		for _, a := range p.Annotations {
+			if _, err := tx.Exec("INSERT INTO annotations (patch_id, note, by, at) VALUES (?, ?, ?, ?)",
+				p.ID, a.Note, nullable(a.By), rfc3339(a.At)); err != nil {
+				return nil, fmt.Errorf("failed to export annotation of %s: %w", p.ID, err)
+			}
+		}
+		for i := range p.Facts {
+			if err := insertExportedFact(tx, p.ID, &p.Facts[i]); err != nil {
+				return nil, err
+			}
+		}
+		for _, e := range p.Edges {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO edges (edge_id, patch_id, from_id, to_id, relation, strength) VALUES (?, ?, ?, ?, ?, ?)`,
+				e.ID, p.ID, e.From, e.To, nullable(e.Relation), e.Strength); err != nil {
+				return nil, fmt.Errorf("failed to export edge %s: %w", e.ID, err)
+			}
+		}
+	}
+	return sources, nil
+}
+
+// insertExportedFact writes a fact with its tags, review history and
+// notes
+func insertExportedFact(tx *sql.Tx, patchID string, f *Fact) error {
+	var inVideo interface{}
+	if f.TimestampInVideo > 0 {
+		inVideo = f.TimestampInVideo
+	}
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO facts (fact_id, patch_id, text, topic, confidence, valid_from, chapter, timestamp_in_video, extracted_from, retired)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.ID, patchID, f.Text, nullable(f.Topic), f.Confidence, rfc3339(f.ValidFrom), nullable(f.Chapter),
+		inVideo, nullable(f.ExtractedFrom), f.Retired()); err != nil {
+		return fmt.Errorf("failed to export fact %s: %w", f.ID, err)
+	}
+	for _, tag := range f.Tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO fact_tags (fact_id, tag) VALUES (?, ?)", f.ID, tag); err != nil {
+			return fmt.Errorf("failed to export tags of %s: %w", f.ID, err)
+		}
+	}
+	for i, e := range f.History {
+		previous, err := jsonText(e.Previous)
+		if err != nil {
+			return fmt.Errorf("failed to encode history of %s: %w", f.ID, err)
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO fact_history (fact_id, seq, action, by, at, reason, previous, merged_into, merged_from)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			f.ID, i+1, e.Action, nullable(e.By), rfc3339(e.At), nullable(e.Reason), previous,
+			nullable(e.MergedInto), nullable(e.MergedFrom)); err != nil {
+			return fmt.Errorf("failed to export history of %s: %w", f.ID, err)
+		}
+	}
+	for _, a := range f.Annotations {
+		if _, err := tx.Exec("INSERT INTO annotations (patch_id, fact_id, note, by, at) VALUES (?, ?, ?, ?, ?)",
+			patchID, f.ID, a.Note, nullable(a.By), rfc3339(a.At)); err != nil {
+			return fmt.Errorf("failed to export annotation of %s: %w", f.ID, err)
+		}
+	}
+	return nil
+}
+
+// insertExportedSources writes one row per source, with its license from
+// the patches and its catalog entry from the manifest
+func insertExportedSources(tx *sql.Tx, m *Manifest, patches []*Patch) error {
+	done := make(map[string]bool)
+	for _, p := range patches {
+		if p.SourceID == "" || done[p.SourceID] {
+			continue
+		}
+		done[p.SourceID] = true
+
+		var license, derivatives, commercial interface{}
+		if l, ok := patchLicense(p); ok {
+			license, derivatives, commercial = l.ID, l.Derivatives, l.Commercial
+		}
+		url, _ := p.Metadata["source-url"].(string)
+		title, _ := p.Metadata["title"].(string)
+		item, err := m.ItemByVideoID(p.SourceID)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			item = &ManifestItem{}
+		}
+		if _, err := tx.Exec(`INSERT INTO sources (source_id, kind, url, title, channel, published, collection, license, derivatives, commercial)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.SourceID, nullable(p.Source), nullable(orDefault(item.URL, url)), nullable(orDefault(item.Title, title)),
+			nullable(item.Channel), nullable(item.Published), nullable(orDefault(item.Collection, patchCollection(p))),
+			license, derivatives, commercial); err != nil {
+			return fmt.Errorf("failed to export source %s: %w", p.SourceID, err)
+		}
+	}
+	return nil
+}
+
+// insertExportedEmbeddings copies the manifest's vectors for exported
+// facts and for transcript segments of exported sources
+func insertExportedEmbeddings(tx *sql.Tx, m *Manifest, patches []*Patch, sources map[string]bool) error {
+	facts := make(map[string]bool)
+	for _, p := range patches {
+		for _, f := range p.Facts {
+			facts[f.ID] = true
+		}
+	}
+
+	rows, err := m.db.Query("SELECT kind, item_id, model, dims, vector FROM embeddings ORDER BY kind, item_id, model")
+	if err != nil {
+		return fmt.Errorf("failed to read embeddings: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, id, model string
+		var dims int
+		var vector []byte
+		if err := rows.Scan(&kind, &id, &model, &dims, &vector); err != nil {
+			return fmt.Errorf("failed to read embeddings: %w", err)
+		}
+		switch kind {
+		case embedKindFact:
+			if !facts[id] {
+				continue
+			}
+		case embedKindSegment:
+			videoID, _, _ := strings.Cut(id, "#")
+			if !sources[videoID] {
+				continue
+			}
+		default:
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO embeddings (kind, item_id, model, dims, vector) VALUES (?, ?, ?, ?, ?)",
+			kind, id, model, dims, vector); err != nil {
+			return fmt.Errorf("failed to export embedding %s: %w", id, err)
+		}
+	}
+	return rows.Err()
+}
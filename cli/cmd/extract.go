@@ -0,0 +1,360 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fact mirrors the :fact schema in core/resources/schema/patch.edn
+type Fact struct {
+	ID               string    `json:"db/id"`
+	Text             string    `json:"claim/text"`
+	Topic            string    `json:"claim/topic,omitempty"`
+	Confidence       float64   `json:"claim/confidence"`
+	ExtractedFrom    string    `json:"claim/extracted-from,omitempty"`
+	TimestampInVideo float64   `json:"claim/timestamp-in-video,omitempty"`
+	Chapter          string    `json:"claim/chapter,omitempty"`
+	ValidFrom        time.Time `json:"claim/valid-from"`
+	Tags             []string  `json:"claim/tags,omitempty"`
+	// History records review edits, oldest first (see 'vkm facts')
+	History []FactEdit `json:"claim/history,omitempty"`
+	// Annotations are curators' notes (see 'vkm annotate')
+	Annotations []Annotation `json:"claim/annotations,omitempty"`
+}
+
+// Edge mirrors the :edge schema in core/resources/schema/patch.edn
+type Edge struct {
+	ID       string  `json:"db/id"`
+	From     string  `json:"edge/from"`
+	To       string  `json:"edge/to"`
+	Relation string  `json:"edge/relation"`
+	Strength float64 `json:"edge/strength"`
+}
+
+// Patch mirrors the :patch schema in core/resources/schema/patch.edn
+type Patch struct {
+	ID        string                 `json:"db/id"`
+	Timestamp time.Time              `json:"patch/timestamp"`
+	Source    string                 `json:"patch/source"`
+	SourceID  string                 `json:"patch/source-id,omitempty"`
+	Facts     []Fact                 `json:"patch/facts"`
+	Edges     []Edge                 `json:"patch/edges"`
+	Metadata  map[string]interface{} `json:"patch/metadata,omitempty"`
+	// Annotations are curators' notes (see 'vkm annotate')
+	Annotations []Annotation `json:"patch/annotations,omitempty"`
+}
+
+// claudeAPIURL is the Claude Messages API endpoint; 'vkm selftest' points
+// it at a mock
+var claudeAPIURL = "https://api.anthropic.com/v1/messages"
+
+// Same model and prompt the backend uses in vkm.semantic/extract-facts-from-text,
+// so locally extracted patches are comparable with backend ones.
+const (
+	claudeModel      = "claude-sonnet-4-20250514"
+	extractionPrompt = "You are a knowledge extraction system for a temporal knowledge graph. " +
+		"Extract structured factual claims from the following text.\n\n" +
+		"For each fact, provide:\n" +
+		"- text: A clear, atomic claim (one fact per entry)\n" +
+		"- confidence: Your certainty this is factual (0.0-1.0)\n" +
+		"- topic: A single keyword category (e.g., 'scaling', 'architecture', 'performance')\n\n" +
+		"Guidelines:\n" +
+		"- Break complex statements into atomic facts\n" +
+		"- Only extract verifiable claims, not opinions\n" +
+		"- Use confidence < 0.6 for uncertain claims\n" +
+		"- Keep text concise and clear\n\n" +
+		"Text to analyze:\n---\n%s\n---\n\n" +
+		"Respond ONLY with a valid JSON array, nothing else:\n" +
+		"[{\"text\": \"...\", \"confidence\": 0.85, \"topic\": \"scaling\"}]"
+)
+
+// claudeLightModel is used for cheap, lower-stakes extraction such as
+// comments and previews
+const claudeLightModel = "claude-3-5-haiku-20241022"
+
+// Extraction strategies. Two-pass extraction first asks for an outline of
+// the whole transcript, then extracts facts chunk by chunk with the outline
+// as context, so claims in long talks keep their referents and framing.
+const (
+	extractStrategySingle  = "single"
+	extractStrategyTwoPass = "two-pass"
+)
+
+// Prompts of the two-pass strategy, matching vkm.semantic/extract-facts-two-pass
+const (
+	outlinePrompt = "You are preparing a long transcript for fact extraction. " +
+		"Write an outline of the following text: its sections in order, and under each " +
+		"the main claims made and the people, systems and terms they refer to, with any " +
+		"abbreviations or pronouns resolved to full names.\n\n" +
+		"Text:\n---\n%s\n---\n\n" +
+		"Respond ONLY with the outline as a plain indented list, nothing else."
+	outlineContextPrompt = "Outline of the whole document, for context only. " +
+		"Extract facts from the text to analyze, not from the outline, and use the " +
+		"outline to resolve references and keep claims self-contained:\n---\n%s\n---\n\n"
+)
+
+// checkExtractStrategy validates a --strategy value
+func checkExtractStrategy(strategy string) error {
+	switch strategy {
+	case extractStrategySingle, extractStrategyTwoPass:
+		return nil
+	}
+	return fmt.Errorf("unknown extraction strategy %q (use single or two-pass)", strategy)
+}
+
+// twoPassChunkChars is the target size of the chunks facts are extracted
+// from in the second pass
+const twoPassChunkChars = 12000
+
+var codeBlockPattern = regexp.MustCompile("```(?:json)?\\s*\\n([\\s\\S]*?)\\n```")
+
+// newUUID returns a random RFC 4122 version 4 UUID string
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// newPatch builds a document patch from extracted facts
+func newPatch(sourceID string, facts []Fact) Patch {
+	return Patch{
+		ID:        newUUID(),
+		Timestamp: time.Now().UTC(),
+		Source:    "document",
+		SourceID:  sourceID,
+		Facts:     facts,
+		Edges:     []Edge{},
+	}
+}
+
+// extractFactsWithClaude extracts facts from text by calling the Claude API
+// directly, without going through the backend
+func extractFactsWithClaude(ctx context.Context, model, text, sourceID string) ([]Fact, error) {
+	return extractFactsWithPrompt(ctx, model, fmt.Sprintf(extractionPrompt, text), sourceID)
+}
+
+// extractFactsTwoPass outlines text, then extracts facts from each chunk
+// with the outline as context. Facts repeated across chunks are kept once.
+func extractFactsTwoPass(ctx context.Context, model, text, sourceID string) (facts []Fact, outline string, err error) {
+	outline, err = askClaude(ctx, model, fmt.Sprintf(outlinePrompt, text))
+	if err != nil {
+		return nil, "", fmt.Errorf("outline pass failed: %w", err)
+	}
+	outline = strings.TrimSpace(outline)
+
+	chunks := splitExtractionChunks(text, twoPassChunkChars)
+	seen := make(map[string]int)
+	for i, chunk := range chunks {
+		if len(chunks) > 1 {
+			fmt.Printf("    Extracting chunk %d/%d\n", i+1, len(chunks))
+		}
+		prompt := fmt.Sprintf(outlineContextPrompt, outline) + fmt.Sprintf(extractionPrompt, chunk)
+		chunkFacts, err := extractFactsWithPrompt(ctx, model, prompt, sourceID)
+		if err != nil {
+			return nil, "", fmt.Errorf("chunk %d/%d: %w", i+1, len(chunks), err)
+		}
+		for _, f := range chunkFacts {
+			key := strings.ToLower(strings.Join(strings.Fields(f.Text), " "))
+			if j, ok := seen[key]; ok {
+				if f.Confidence > facts[j].Confidence {
+					facts[j].Confidence = f.Confidence
+				}
+				continue
+			}
+			seen[key] = len(facts)
+			facts = append(facts, f)
+		}
+	}
+	return facts, outline, nil
+}
+
+var sentenceEndPattern = regexp.MustCompile(`[.!?]["')\]]*\s+`)
+
+// splitExtractionChunks splits text into chunks of about size characters,
+// breaking between sentences where it can
+func splitExtractionChunks(text string, size int) []string {
+	var chunks []string
+	var cur strings.Builder
+	start := 0
+	ends := sentenceEndPattern.FindAllStringIndex(text, -1)
+	ends = append(ends, []int{len(text), len(text)})
+	for _, end := range ends {
+		sentence := text[start:end[1]]
+		start = end[1]
+		if cur.Len() > 0 && cur.Len()+len(sentence) > size {
+			chunks = append(chunks, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		}
+		cur.WriteString(sentence)
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		chunks = append(chunks, s)
+	}
+	return chunks
+}
+
+// extractFactsWithPrompt sends prompt to model and parses the JSON array of
+// facts in its answer
+func extractFactsWithPrompt(ctx context.Context, model, prompt, sourceID string) ([]Fact, error) {
+	answer, err := askClaude(ctx, model, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return parseExtractedFacts(answer, sourceID)
+}
+
+// promptVersion identifies a prompt template by a short hash of its text,
+// so patches record which revision of the prompt produced them
+func promptVersion(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:4])
+}
+
+// claudeUsage tallies the input and output tokens askClaude has spent per
+// model in this process, so runs can report what they cost
+var claudeUsage = struct {
+	sync.Mutex
+	tokens map[string][2]int
+}{tokens: make(map[string][2]int)}
+
+// claudeSpend prices the tokens spent so far at tokenPrices
+func claudeSpend() float64 {
+	claudeUsage.Lock()
+	defer claudeUsage.Unlock()
+	var usd float64
+	for model, t := range claudeUsage.tokens {
+		price, ok := tokenPrices[model]
+		if !ok {
+			price = tokenPrices[claudeModel]
+		}
+		usd += (float64(t[0])*price[0] + float64(t[1])*price[1]) / 1e6
+	}
+	return usd
+}
+
+// askClaude sends a single-turn prompt to model and returns the text of
+// its answer. Models named ollama:<model> are asked on a local Ollama.
+func askClaude(ctx context.Context, model, prompt string) (string, error) {
+	if local, ok := ollamaModel(model); ok {
+		return askOllama(ctx, local, prompt)
+	}
+	apiKey := os.Getenv("CLAUDE_API_KEY")
+	if apiKey == "" {
+		return "", fmt.Errorf("CLAUDE_API_KEY environment variable not set")
+	}
+
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"model":       model,
+		"max_tokens":  4096,
+		"temperature": 0.0,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", claudeAPIURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Claude API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var claudeResp struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &claudeResp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	claudeUsage.Lock()
+	t := claudeUsage.tokens[model]
+	claudeUsage.tokens[model] = [2]int{t[0] + claudeResp.Usage.InputTokens, t[1] + claudeResp.Usage.OutputTokens}
+	claudeUsage.Unlock()
+	if len(claudeResp.Content) == 0 {
+		return "", fmt.Errorf("empty response from Claude API")
+	}
+
+	return claudeResp.Content[0].Text, nil
+}
+
+// parseExtractedFacts converts the model's JSON array answer into facts
+func parseExtractedFacts(content, sourceID string) ([]Fact, error) {
+	// Extract JSON from markdown code blocks if present
+	if strings.Contains(content, "```") {
+		if m := codeBlockPattern.FindStringSubmatch(content); m != nil {
+			content = m[1]
+		}
+	}
+
+	var factsData []struct {
+		Text       string   `json:"text"`
+		Confidence *float64 `json:"confidence"`
+		Topic      string   `json:"topic"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &factsData); err != nil {
+		return nil, fmt.Errorf("failed to parse extracted facts: %w", err)
+	}
+
+	now := time.Now().UTC()
+	facts := make([]Fact, 0, len(factsData))
+	for _, fd := range factsData {
+		if strings.TrimSpace(fd.Text) == "" {
+			continue
+		}
+		confidence := 0.5
+		if fd.Confidence != nil {
+			confidence = *fd.Confidence
+		}
+		facts = append(facts, Fact{
+			ID:            newUUID(),
+			Text:          fd.Text,
+			Topic:         fd.Topic,
+			Confidence:    confidence,
+			ExtractedFrom: sourceID,
+			ValidFrom:     now,
+		})
+	}
+
+	return facts, nil
+}
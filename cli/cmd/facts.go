@@ -0,0 +1,448 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// FactsCmd groups commands that review facts in local patches
+var FactsCmd = &cobra.Command{
+	Use:   "facts",
+	Short: "Edit, reject and merge facts in local patches, keeping an audit trail",
+	Long: `Review the facts in the patches stored under --data. Every edit,
+rejection and merge is recorded in the fact's claim/history: who made it
+(--by, default the current user), when, why (--reason) and what changed,
+so a fact's wording can always be traced back to what was extracted.
+
+Rejected facts, and duplicates merged into another fact, stay in their
+patches with their history but are left out of 'vkm export' (unless
+--include-retired) and 'vkm graph path'. Every copy of a patch under
+--data is updated.
+
+Fact IDs may be shortened to a unique prefix of at least 8 characters.
+
+Examples:
+  vkm facts edit 3f2a9c1e --text "GPT-4 was released in March 2023" --reason "wrong month"
+  vkm facts reject 77b0d412 --reason "opinion, not a claim"
+  vkm facts merge 3f2a9c1e 9c04e7aa 1d5b2f60 --reason duplicates
+  vkm facts history 3f2a9c1e`,
+}
+
+// FactsEditCmd corrects a fact
+var FactsEditCmd = &cobra.Command{
+	Use:   "edit <fact-id>",
+	Short: "Correct a fact's text, topic or confidence",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runFactsEdit,
+}
+
+// FactsRejectCmd rejects a fact
+var FactsRejectCmd = &cobra.Command{
+	Use:   "reject <fact-id>",
+	Short: "Reject a fact so it is no longer exported",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runFactsReject,
+}
+
+// FactsMergeCmd merges duplicate facts into one
+var FactsMergeCmd = &cobra.Command{
+	Use:   "merge <fact-id> <duplicate-id>...",
+	Short: "Merge duplicate facts into the first fact",
+	Long: `Merge duplicates into the first fact given. The duplicates are retired
+with a record of the fact they were merged into, and the fact they were
+merged into records each duplicate and gains its tags.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runFactsMerge,
+}
+
+// FactsHistoryCmd traces a fact's lineage
+var FactsHistoryCmd = &cobra.Command{
+	Use:   "history <fact-id>",
+	Short: "Trace a fact back to its source and print its edit history",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runFactsHistory,
+}
+
+var (
+	factsDataDir    string
+	factsBy         string
+	factsReason     string
+	factsText       string
+	factsTopic      string
+	factsConfidence float64
+)
+
+func init() {
+	FactsCmd.AddCommand(FactsEditCmd)
+	FactsCmd.AddCommand(FactsRejectCmd)
+	FactsCmd.AddCommand(FactsMergeCmd)
+	FactsCmd.AddCommand(FactsHistoryCmd)
+
+	FactsCmd.PersistentFlags().StringVar(&factsDataDir, "data", "data", "Directory holding local patches")
+	for _, c := range []*cobra.Command{FactsEditCmd, FactsRejectCmd, FactsMergeCmd} {
+		c.Flags().StringVar(&factsBy, "by", "", "Who is making the change (default the current user)")
+		c.Flags().StringVar(&factsReason, "reason", "", "Why the change is made (required)")
+	}
+	FactsEditCmd.Flags().StringVar(&factsText, "text", "", "New claim text")
+	FactsEditCmd.Flags().StringVar(&factsTopic, "topic", "", "New topic")
+	FactsEditCmd.Flags().Float64Var(&factsConfidence, "confidence", 0, "New confidence (0-1)")
+}
+
+// Review actions recorded in a fact's history
+const (
+	factActionEdit   = "edit"
+	factActionReject = "reject"
+	factActionMerge  = "merge"
+)
+
+// FactEdit is one entry of a fact's review history
+type FactEdit struct {
+	Action string    `json:"edit/action"`
+	By     string    `json:"edit/by"`
+	At     time.Time `json:"edit/at"`
+	Reason string    `json:"edit/reason,omitempty"`
+	// Previous holds the values an edit replaced, by attribute
+	Previous map[string]interface{} `json:"edit/previous,omitempty"`
+	// MergedInto is set on a duplicate retired by a merge, MergedFrom on
+	// the fact it was merged into
+	MergedInto string `json:"edit/merged-into,omitempty"`
+	MergedFrom string `json:"edit/merged-from,omitempty"`
+}
+
+// Retired reports whether a fact was rejected or merged into another fact
+func (f *Fact) Retired() bool {
+	for _, e := range f.History {
+		if e.Action == factActionReject || e.MergedInto != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// describe summarizes an edit on one line, e.g.
+// "2025-03-01 10:15 edit by alice: wrong month (text was "...")"
+func (e FactEdit) describe() string {
+	s := fmt.Sprintf("%s %s by %s", e.At.Local().Format("2006-01-02 15:04"), e.Action, e.By)
+	if e.Reason != "" {
+		s += ": " + e.Reason
+	}
+	var notes []string
+	attrs := make([]string, 0, len(e.Previous))
+	for attr := range e.Previous {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	for _, attr := range attrs {
+		notes = append(notes, fmt.Sprintf("%s was %v", strings.TrimPrefix(attr, "claim/"), quoteString(e.Previous[attr])))
+	}
+	if e.MergedInto != "" {
+		notes = append(notes, "merged into "+e.MergedInto)
+	}
+	if e.MergedFrom != "" {
+		notes = append(notes, "merged "+e.MergedFrom+" into it")
+	}
+	if len(notes) > 0 {
+		s += " (" + strings.Join(notes, ", ") + ")"
+	}
+	return s
+}
+
+func quoteString(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return v
+}
+
+// factReview is a batch of changes to facts in local patches, applied to
+// every copy of their patches
+type factReview struct {
+	dir   string
+	files []localPatchFile
+	// changed holds the indexes of files to write back
+	changed map[int]bool
+}
+
+func loadFactReview(dir string) (*factReview, error) {
+	files, err := loadLocalPatchFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &factReview{dir: dir, files: files, changed: make(map[int]bool)}, nil
+}
+
+// resolve finds the full ID of the fact id names, exactly or as a unique
+// prefix, and returns its first copy with its patch
+func (r *factReview) resolve(id string) (*Fact, *localPatchFile, error) {
+	var fact *Fact
+	var file *localPatchFile
+	for i := range r.files {
+		p := r.files[i].Patch
+		for j := range p.Facts {
+			f := &p.Facts[j]
+			if f.ID == id {
+				return f, &r.files[i], nil
+			}
+			if len(id) >= 8 && strings.HasPrefix(f.ID, id) {
+				if fact == nil {
+					fact, file = f, &r.files[i]
+				} else if fact.ID != f.ID {
+					return nil, nil, fmt.Errorf("fact ID prefix %q is ambiguous (%s, %s)", id, fact.ID, f.ID)
+				}
+			}
+		}
+	}
+	if fact == nil {
+		return nil, nil, fmt.Errorf("no fact %q under %s", id, r.dir)
+	}
+	return fact, file, nil
+}
+
+// apply runs change on every copy of the fact with the given full ID
+func (r *factReview) apply(id string, change func(f *Fact)) {
+	for i := range r.files {
+		p := r.files[i].Patch
+		for j := range p.Facts {
+			if p.Facts[j].ID == id {
+				change(&p.Facts[j])
+				r.changed[i] = true
+			}
+		}
+	}
+}
+
+// save writes back every changed patch file
+func (r *factReview) save() error {
+	for i := range r.files {
+		if !r.changed[i] {
+			continue
+		}
+		if err := writePatchFile(r.files[i].Path, *r.files[i].Patch); err != nil {
+			return fmt.Errorf("%s: %w", r.files[i].Path, err)
+		}
+	}
+	return nil
+}
+
+// newFactEdit starts a history entry from --by and --reason
+func newFactEdit(action string) (FactEdit, error) {
+	reason := strings.TrimSpace(factsReason)
+	if reason == "" {
+		return FactEdit{}, fmt.Errorf("--reason is required, so the history says why the fact changed")
+	}
+	by := strings.TrimSpace(factsBy)
+	if by == "" {
+		if u, err := user.Current(); err == nil {
+			by = u.Username
+		}
+	}
+	return FactEdit{Action: action, By: orDefault(by, "unknown"), At: time.Now().UTC(), Reason: reason}, nil
+}
+
+func runFactsEdit(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	if !flags.Changed("text") && !flags.Changed("topic") && !flags.Changed("confidence") {
+		return fmt.Errorf("nothing to change (use --text, --topic or --confidence)")
+	}
+	if flags.Changed("text") && strings.TrimSpace(factsText) == "" {
+		return fmt.Errorf("--text must not be empty (use 'vkm facts reject' to drop a fact)")
+	}
+	if factsConfidence < 0 || factsConfidence > 1 {
+		return fmt.Errorf("--confidence must be between 0 and 1")
+	}
+	edit, err := newFactEdit(factActionEdit)
+	if err != nil {
+		return err
+	}
+
+	review, err := loadFactReview(factsDataDir)
+	if err != nil {
+		return err
+	}
+	fact, _, err := review.resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	edit.Previous = make(map[string]interface{})
+	if flags.Changed("text") && factsText != fact.Text {
+		edit.Previous["claim/text"] = fact.Text
+	}
+	if flags.Changed("topic") && factsTopic != fact.Topic {
+		edit.Previous["claim/topic"] = fact.Topic
+	}
+	if flags.Changed("confidence") && factsConfidence != fact.Confidence {
+		edit.Previous["claim/confidence"] = fact.Confidence
+	}
+	if len(edit.Previous) == 0 {
+		fmt.Printf("Fact %s already reads that way, nothing changed\n", fact.ID)
+		return nil
+	}
+
+	review.apply(fact.ID, func(f *Fact) {
+		if _, ok := edit.Previous["claim/text"]; ok {
+			f.Text = factsText
+		}
+		if _, ok := edit.Previous["claim/topic"]; ok {
+			f.Topic = factsTopic
+		}
+		if _, ok := edit.Previous["claim/confidence"]; ok {
+			f.Confidence = factsConfidence
+		}
+		f.History = append(f.History, edit)
+	})
+	if err := review.save(); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Edited fact %s: %s\n", fact.ID, edit.describe())
+	return nil
+}
+
+func runFactsReject(cmd *cobra.Command, args []string) error {
+	edit, err := newFactEdit(factActionReject)
+	if err != nil {
+		return err
+	}
+	review, err := loadFactReview(factsDataDir)
+	if err != nil {
+		return err
+	}
+	fact, _, err := review.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	if fact.Retired() {
+		return fmt.Errorf("fact %s is already retired: %s", fact.ID, fact.History[len(fact.History)-1].describe())
+	}
+
+	review.apply(fact.ID, func(f *Fact) {
+		f.History = append(f.History, edit)
+	})
+	if err := review.save(); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Rejected fact %s: %s\n", fact.ID, fact.Text)
+	return nil
+}
+
+func runFactsMerge(cmd *cobra.Command, args []string) error {
+	edit, err := newFactEdit(factActionMerge)
+	if err != nil {
+		return err
+	}
+	review, err := loadFactReview(factsDataDir)
+	if err != nil {
+		return err
+	}
+	keep, _, err := review.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	if keep.Retired() {
+		return fmt.Errorf("fact %s is retired and can't absorb duplicates", keep.ID)
+	}
+
+	var duplicates []*Fact
+	seen := map[string]bool{keep.ID: true}
+	for _, id := range args[1:] {
+		dup, _, err := review.resolve(id)
+		if err != nil {
+			return err
+		}
+		if seen[dup.ID] {
+			continue
+		}
+		seen[dup.ID] = true
+		if dup.Retired() {
+			return fmt.Errorf("fact %s is already retired: %s", dup.ID, dup.History[len(dup.History)-1].describe())
+		}
+		duplicates = append(duplicates, dup)
+	}
+	if len(duplicates) == 0 {
+		return fmt.Errorf("no duplicates to merge into %s", keep.ID)
+	}
+
+	keepID := keep.ID
+	for _, dup := range duplicates {
+		dupID, tags := dup.ID, dup.Tags
+		retired := edit
+		retired.MergedInto = keepID
+		review.apply(dupID, func(f *Fact) {
+			f.History = append(f.History, retired)
+		})
+		absorbed := edit
+		absorbed.MergedFrom = dupID
+		review.apply(keepID, func(f *Fact) {
+			for _, t := range tags {
+				f.Tags = appendUnique(f.Tags, t)
+			}
+			f.History = append(f.History, absorbed)
+		})
+		fmt.Printf("✓ Merged %s into %s: %s\n", dupID, keepID, dup.Text)
+	}
+	return review.save()
+}
+
+func runFactsHistory(cmd *cobra.Command, args []string) error {
+	review, err := loadFactReview(factsDataDir)
+	if err != nil {
+		return err
+	}
+	fact, file, err := review.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	writeFactLineage(os.Stdout, review, fact, file, "")
+	return nil
+}
+
+// writeFactLineage prints where a fact came from and how it was reviewed,
+// following merges to the lineage of the duplicates merged into it
+func writeFactLineage(w io.Writer, r *factReview, f *Fact, file *localPatchFile, indent string) {
+	p := file.Patch
+	status := ""
+	if f.Retired() {
+		status = " [retired]"
+	}
+	fmt.Fprintf(w, "%sFact %s%s\n", indent, f.ID, status)
+	fmt.Fprintf(w, "%s  %q\n", indent, f.Text)
+	fmt.Fprintf(w, "%s  Topic %s, confidence %.2f, valid from %s\n", indent, orDefault(f.Topic, "(none)"), f.Confidence, f.ValidFrom.Format("2006-01-02"))
+
+	source := patchSource(p)
+	if url := patchSourceURL(p); url != "" {
+		source = url
+	}
+	if f.TimestampInVideo > 0 {
+		source += " @ " + formatVideoOffset(f.TimestampInVideo)
+	}
+	if f.Chapter != "" {
+		source += fmt.Sprintf(" (chapter %q)", f.Chapter)
+	}
+	fmt.Fprintf(w, "%s  Source: %s\n", indent, source)
+	fmt.Fprintf(w, "%s  Patch: %s, %s, %s\n", indent, p.ID, p.Timestamp.Local().Format("2006-01-02 15:04"), file.Path)
+	for _, a := range f.Annotations {
+		fmt.Fprintf(w, "%s  Note: %s\n", indent, a.describe())
+	}
+
+	if len(f.History) == 0 {
+		fmt.Fprintf(w, "%s  History: unedited since extraction\n", indent)
+		return
+	}
+	fmt.Fprintf(w, "%s  History:\n", indent)
+	for _, e := range f.History {
+		fmt.Fprintf(w, "%s    %s\n", indent, e.describe())
+		if e.MergedFrom == "" {
+			continue
+		}
+		if dup, dupFile, err := r.resolve(e.MergedFrom); err == nil {
+			writeFactLineage(w, r, dup, dupFile, indent+"      ")
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// itemAttempts is how many times an item is attempted before it is given
+// up on: its first attempt and the automatic retries after it
+const itemAttempts = 3
+
+// FailedCmd triages items that failed to process
+var FailedCmd = &cobra.Command{
+	Use:   "failed",
+	Short: "Triage items that failed to process",
+	Long: `Triage the items the pipeline failed on, so no source silently falls out
+of the corpus.
+
+Failed items wait in a retry queue in the manifest: 'vkm watch' retries
+them at each poll, and 'vkm pipeline --retry-failed' in its run, until
+they have been attempted three times in all. Items that still fail then
+stay on the failed list as given up on (exhausted) until they are
+retried or dismissed:
+
+  list     the failed items, with their attempts and last error
+  retry    put items back in the retry queue with fresh attempts
+  dismiss  take items off the failed list without retrying them
+
+Items are named by URL, or selected with --all.
+
+Examples:
+  vkm failed list
+  vkm failed retry https://www.youtube.com/watch?v=dQw4w9WgXcQ
+  vkm failed retry --all && vkm pipeline --retry-failed
+  vkm failed dismiss --all`,
+}
+
+// FailedListCmd lists failed items
+var FailedListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List failed items with their attempts and last error",
+	Args:  cobra.NoArgs,
+	RunE:  runFailedList,
+}
+
+// FailedRetryCmd requeues failed items
+var FailedRetryCmd = &cobra.Command{
+	Use:   "retry [url...]",
+	Short: "Put failed items back in the retry queue",
+	Long: `Put failed items back in the retry queue with fresh attempts. They are
+retried by the next 'vkm watch' poll, or right away with
+'vkm pipeline --retry-failed'. Dismissed items can be retried too.`,
+	RunE: runFailedRetry,
+}
+
+// FailedDismissCmd takes failed items off the failed list
+var FailedDismissCmd = &cobra.Command{
+	Use:   "dismiss [url...]",
+	Short: "Take failed items off the failed list without retrying them",
+	Long: `Take failed items off the failed list, for sources that are gone for
+good (deleted or private videos, say). Dismissed items are never retried
+automatically; 'vkm failed list --dismissed' still shows them, and
+'vkm failed retry' brings them back.`,
+	RunE: runFailedDismiss,
+}
+
+var (
+	failedManifest  string
+	failedAll       bool
+	failedDismissed bool
+)
+
+func init() {
+	FailedCmd.AddCommand(FailedListCmd)
+	FailedCmd.AddCommand(FailedRetryCmd)
+	FailedCmd.AddCommand(FailedDismissCmd)
+
+	FailedCmd.PersistentFlags().StringVar(&failedManifest, "manifest", "data/manifest.db", "SQLite manifest recording item progress")
+
+	FailedListCmd.Flags().BoolVar(&failedDismissed, "dismissed", false, "Also list dismissed items")
+	FailedRetryCmd.Flags().BoolVar(&failedAll, "all", false, "Retry every failed item")
+	FailedDismissCmd.Flags().BoolVar(&failedAll, "all", false, "Dismiss every failed item")
+}
+
+// FailedItems returns the items in the failed state, most recently failed
+// first, with dismissed ones only if includeDismissed
+func (m *Manifest) FailedItems(includeDismissed bool) ([]*ManifestItem, error) {
+	query := "SELECT " + manifestItemColumns + " FROM items WHERE state = ?"
+	if !includeDismissed {
+		query += " AND dismissed_at IS NULL"
+	}
+	return m.queryItems(query+" ORDER BY updated_at DESC", ItemFailed)
+}
+
+// RetryableItems returns the retry queue: failed items, not dismissed,
+// with attempts left, oldest failure first
+func (m *Manifest) RetryableItems() ([]*ManifestItem, error) {
+	return m.queryItems("SELECT "+manifestItemColumns+" FROM items WHERE state = ? AND dismissed_at IS NULL AND failures < ? ORDER BY updated_at",
+		ItemFailed, itemAttempts)
+}
+
+func (m *Manifest) queryItems(query string, args ...interface{}) ([]*ManifestItem, error) {
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*ManifestItem
+	for rows.Next() {
+		item, err := scanManifestItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest item: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// RequeueFailedItem puts a failed item back in the retry queue with fresh
+// attempts, undismissing it
+func (m *Manifest) RequeueFailedItem(url string) error {
+	return m.updateFailedItem(url, "UPDATE items SET failures = 0, dismissed_at = NULL WHERE url = ? AND state = ?")
+}
+
+// DismissFailedItem takes a failed item off the failed list
+func (m *Manifest) DismissFailedItem(url string) error {
+	return m.updateFailedItem(url, "UPDATE items SET dismissed_at = ? WHERE url = ? AND state = ?", time.Now().UTC())
+}
+
+// updateFailedItem runs update, whose last two parameters are the item's
+// URL and state, on a failed item
+func (m *Manifest) updateFailedItem(url, update string, args ...interface{}) error {
+	return m.write(func(tx *sql.Tx) error {
+		res, err := tx.Exec(update, append(args, url, ItemFailed)...)
+		if err != nil {
+			return fmt.Errorf("failed to update manifest item: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("no failed item %s", url)
+		}
+		return nil
+	})
+}
+
+// failedStatus describes where a failed item stands in the retry queue
+func failedStatus(item *ManifestItem) string {
+	switch {
+	case !item.DismissedAt.IsZero():
+		return "dismissed"
+	case item.Failures >= itemAttempts:
+		return "exhausted"
+	}
+	return "retrying"
+}
+
+// maxFailedError is the most of an item's last error 'vkm failed list'
+// shows
+const maxFailedError = 80
+
+func runFailedList(cmd *cobra.Command, args []string) error {
+	manifest, err := openManifest(failedManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	items, err := manifest.FailedItems(failedDismissed)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Println("No failed items")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "URL\tSTATUS\tATTEMPTS\tFAILED\tERROR")
+	exhausted := 0
+	for _, item := range items {
+		status := failedStatus(item)
+		if status == "exhausted" {
+			exhausted++
+		}
+		errText := strings.Join(strings.Fields(item.Error), " ")
+		if len(errText) > maxFailedError {
+			errText = errText[:maxFailedError-3] + "..."
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\t%s\n", item.URL, status, item.Failures, itemAttempts,
+			item.UpdatedAt.Local().Format("2006-01-02 15:04"), errText)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if exhausted > 0 {
+		fmt.Printf("\n⚠ %d item(s) failed all %d attempts; retry or dismiss them\n", exhausted, itemAttempts)
+	}
+	return nil
+}
+
+func runFailedRetry(cmd *cobra.Command, args []string) error {
+	return updateFailedItems(args, true, "Requeued", func(m *Manifest, url string) error { return m.RequeueFailedItem(url) },
+		"they are retried by the next 'vkm watch' poll or 'vkm pipeline --retry-failed'")
+}
+
+func runFailedDismiss(cmd *cobra.Command, args []string) error {
+	return updateFailedItems(args, false, "Dismissed", func(m *Manifest, url string) error { return m.DismissFailedItem(url) }, "")
+}
+
+// updateFailedItems applies update to the failed items named by urls, or
+// with --all to every one (dismissed ones if withDismissed), and reports
+// how many it applied to as done
+func updateFailedItems(urls []string, withDismissed bool, done string, update func(m *Manifest, url string) error, hint string) error {
+	if (len(urls) == 0) == !failedAll {
+		return fmt.Errorf("name failed items by URL, or use --all")
+	}
+
+	manifest, err := openManifest(failedManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	if failedAll {
+		items, err := manifest.FailedItems(withDismissed)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			urls = append(urls, item.URL)
+		}
+	}
+
+	n := 0
+	for _, url := range urls {
+		if err := update(manifest, url); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			continue
+		}
+		n++
+	}
+	fmt.Printf("✓ %s %d failed item(s)", done, n)
+	if hint != "" && n > 0 {
+		fmt.Printf("; %s", hint)
+	}
+	fmt.Println()
+	return nil
+}
+
+// retryFailedItems runs the manifest's retry queue through the pipeline,
+// as a BackfillDay of outcomes. Items whose video was processed since
+// are skipped.
+func retryFailedItems(ctx context.Context, run *pipelineRun, archive *downloadArchive) (BackfillDay, error) {
+	var counts BackfillDay
+	if run.manifest == nil {
+		return counts, nil
+	}
+	items, err := run.manifest.RetryableItems()
+	if err != nil {
+		return counts, err
+	}
+	for _, failed := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		if failed.VideoID != "" {
+			done, err := run.manifest.VideoProcessed(failed.VideoID)
+			if err != nil {
+				return counts, err
+			}
+			if done {
+				counts.Skipped++
+				continue
+			}
+		}
+
+		fmt.Printf("Retrying %s (attempt %d/%d)\n", failed.URL, failed.Failures+1, itemAttempts)
+		item := pipelineItem{URL: failed.URL, VideoID: failed.VideoID}
+		result, err := run.processItem(ctx, item)
+		if err != nil {
+			counts.Failed++
+			continue
+		}
+		archive.Add(item, result.VideoID)
+		counts.Processed++
+	}
+	return counts, nil
+}
+
+// failedRetryURLs returns the URLs of the retry queue of the pipeline's
+// manifest
+func failedRetryURLs() ([]string, error) {
+	manifest, err := openManifest(pipelineManifest)
+	if err != nil {
+		return nil, err
+	}
+	defer manifest.Close()
+
+	items, err := manifest.RetryableItems()
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, 0, len(items))
+	for _, item := range items {
+		urls = append(urls, item.URL)
+	}
+	if len(urls) > 0 {
+		fmt.Printf("Retrying %d failed item(s)\n", len(urls))
+	}
+	return urls, nil
+}
+
+// warnIfExhausted tells when the item at url has failed its last attempt
+// and is given up on
+func warnIfExhausted(m *Manifest, url string) {
+	if m == nil {
+		return
+	}
+	if item, err := m.GetItem(url); err == nil && item != nil && item.Failures >= itemAttempts {
+		fmt.Fprintf(os.Stderr, "  ⚠ Gave up after %d attempts; see 'vkm failed list'\n", item.Failures)
+	}
+}
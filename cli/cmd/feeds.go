@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// youtubeFeedURL is the public Atom feed for a channel's uploads. It needs no
+// API key and costs no quota, but only lists the 15 most recent videos.
+const youtubeFeedURL = "https://www.youtube.com/feeds/videos.xml"
+
+// youtubeOEmbedURL describes a single video. Like the feeds it needs no
+// key and costs no quota, but it gives the title and not the length.
+const youtubeOEmbedURL = "https://www.youtube.com/oembed"
+
+// FeedEntry is one video listed in a channel or playlist feed
+type FeedEntry struct {
+	VideoID     string
+	Title       string
+	ChannelID   string
+	PublishedAt time.Time
+	URL         string
+}
+
+type youtubeFeed struct {
+	Entries []struct {
+		VideoID   string `xml:"videoId"`
+		ChannelID string `xml:"channelId"`
+		Title     string `xml:"title"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Link      struct {
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// fetchChannelFeed lists recent uploads of a channel from its RSS feed
+func fetchChannelFeed(channelID string) ([]FeedEntry, error) {
+	return fetchYouTubeFeed(url.Values{"channel_id": {channelID}})
+}
+
+// fetchPlaylistFeed lists recent entries of a playlist from its RSS feed
+func fetchPlaylistFeed(playlistID string) ([]FeedEntry, error) {
+	return fetchYouTubeFeed(url.Values{"playlist_id": {playlistID}})
+}
+
+// fetchYouTubeTitle looks up the title of a video from its oEmbed
+// description
+func fetchYouTubeTitle(videoID string) (string, error) {
+	query := url.Values{"format": {"json"}, "url": {"https://www.youtube.com/watch?v=" + videoID}}
+	body, err := fetchCached(youtubeOEmbedURL + "?" + query.Encode())
+	if err != nil {
+		return "", err
+	}
+	var embed struct {
+		Title string `json:"title"`
+	}
+	if err := json.Unmarshal(body, &embed); err != nil {
+		return "", fmt.Errorf("failed to parse oEmbed description: %w", err)
+	}
+	return embed.Title, nil
+}
+
+func fetchYouTubeFeed(query url.Values) ([]FeedEntry, error) {
+	body, err := fetchCached(youtubeFeedURL + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var feed youtubeFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+
+	entries := make([]FeedEntry, 0, len(feed.Entries))
+	for _, e := range feed.Entries {
+		published, _ := time.Parse(time.RFC3339, e.Published)
+		link := e.Link.Href
+		if link == "" {
+			link = "https://www.youtube.com/watch?v=" + e.VideoID
+		}
+		entries = append(entries, FeedEntry{
+			VideoID:     e.VideoID,
+			Title:       e.Title,
+			ChannelID:   e.ChannelID,
+			PublishedAt: published,
+			URL:         link,
+		})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// GcCmd removes scratch directories left behind by dead runs
+var GcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove temp files left behind by interrupted runs",
+	Long: `Remove the scratch directories of vkm runs that are no longer running.
+
+Every vkm process keeps its temp files (caption downloads, trimmed audio,
+triage transcripts) in its own directory under the temp root, set with
+--temp-dir or VKM_TEMP_DIR and by default <os temp dir>/vkm, and removes it
+when it exits. Runs that crash or are killed leave theirs behind.
+
+A directory is removed when its process is gone. Directories of other
+machines sharing the temp root, and those without owner information, are
+removed once older than --older-than. Directories of other users are
+skipped. Partial downloads next to the output files are not touched, since
+the next download resumes them.
+
+Examples:
+  vkm gc
+  vkm gc --dry-run
+  vkm gc --temp-dir /scratch/vkm --older-than 6h`,
+	RunE: runGc,
+}
+
+var (
+	gcOlderThan time.Duration
+	gcDryRun    bool
+)
+
+func init() {
+	GcCmd.Flags().DurationVar(&gcOlderThan, "older-than", 24*time.Hour, "Age after which runs of other machines are removed")
+	GcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "List what would be removed without removing it")
+}
+
+func runGc(cmd *cobra.Command, args []string) error {
+	entries, err := os.ReadDir(tempRoot)
+	if os.IsNotExist(err) {
+		fmt.Printf("Nothing to clean in %s\n", tempRoot)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read temp root: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	removed, kept := 0, 0
+	var freed int64
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), tempRunPrefix) {
+			continue
+		}
+		dir := filepath.Join(tempRoot, e.Name())
+		if dir == tempRun.dir {
+			continue
+		}
+		reason := staleTempRun(dir, host)
+		if reason == "" {
+			kept++
+			continue
+		}
+
+		size := dirSize(dir)
+		if gcDryRun {
+			fmt.Printf("Would remove %s (%s, %s)\n", dir, reason, formatBytes(size))
+		} else if err := os.RemoveAll(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", dir, err)
+			continue
+		} else {
+			fmt.Printf("✓ Removed %s (%s, %s)\n", dir, reason, formatBytes(size))
+		}
+		removed++
+		freed += size
+	}
+
+	verb := "Removed"
+	if gcDryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("\n%s %d run directories (%s); %d still in use\n", verb, removed, formatBytes(freed), kept)
+	return nil
+}
+
+// staleTempRun returns why a run directory can be removed, or "" if it
+// may still be in use
+func staleTempRun(dir, host string) string {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return ""
+	}
+	old := time.Since(info.ModTime()) > gcOlderThan
+
+	data, err := os.ReadFile(filepath.Join(dir, tempOwnerFile))
+	if os.IsPermission(err) {
+		return ""
+	}
+	var owner tempOwner
+	if err != nil || json.Unmarshal(data, &owner) != nil || owner.PID == 0 {
+		if old {
+			return "no owner, older than " + gcOlderThan.String()
+		}
+		return ""
+	}
+	if owner.Host == host {
+		if processAlive(owner.PID) {
+			return ""
+		}
+		return fmt.Sprintf("process %d exited", owner.PID)
+	}
+	if old {
+		return fmt.Sprintf("run on %s, older than %s", owner.Host, gcOlderThan)
+	}
+	return ""
+}
+
+// dirSize sums the sizes of the files under dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// formatBytes prints a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
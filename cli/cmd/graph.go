@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// GraphCmd groups commands that query the backend's knowledge graph
+var GraphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Explore the knowledge graph",
+	Long: `Query the knowledge graph held by the backend (see 'vkm backend'), or
+the local patches under --data for path.
+
+Examples:
+  vkm graph diff --from 2024-01-01 --to 2024-06-01
+  vkm graph path "OpenAI" "Chinchilla"`,
+}
+
+// GraphDiffCmd summarizes graph changes between two times
+var GraphDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Summarize what entered and left the graph between two dates",
+	Long: `Compare the graph as it stood at --from with the graph at --to and list
+new sources and topics, facts added and retracted, and motives that formed
+or dissolved, as markdown for changelogs or as JSON.
+
+Times are when data entered the graph, not the facts' own valid-from
+dates: a 2019 video ingested last week shows up in last week's diff.
+Dates are YYYY-MM-DD (midnight UTC) or RFC 3339 times; --to defaults to
+now.
+
+Examples:
+  vkm graph diff --from 2024-01-01 --to 2024-06-01
+  vkm graph diff --from 2024-06-01 --format json -o changes.json`,
+	RunE: runGraphDiff,
+}
+
+var (
+	graphBackendURL string
+	graphDiffFrom   string
+	graphDiffTo     string
+	graphDiffFormat string
+	graphDiffOutput string
+)
+
+func init() {
+	GraphCmd.AddCommand(GraphDiffCmd)
+	GraphCmd.AddCommand(GraphPathCmd)
+
+	GraphCmd.PersistentFlags().StringVarP(&graphBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+
+	GraphDiffCmd.Flags().StringVar(&graphDiffFrom, "from", "", "Start of the period (YYYY-MM-DD or RFC 3339)")
+	GraphDiffCmd.Flags().StringVar(&graphDiffTo, "to", "", "End of the period (default now)")
+	GraphDiffCmd.Flags().StringVar(&graphDiffFormat, "format", "markdown", "Output format (markdown, json)")
+	GraphDiffCmd.Flags().StringVarP(&graphDiffOutput, "output", "o", "", "Output file (default stdout)")
+	GraphDiffCmd.MarkFlagRequired("from")
+
+	GraphPathCmd.Flags().StringVar(&graphPathData, "data", "data", "Directory holding local patches")
+	GraphPathCmd.Flags().IntVar(&graphPathLimit, "paths", 3, "Maximum number of paths to print")
+	GraphPathCmd.Flags().IntVar(&graphPathMaxHops, "max-hops", 6, "Longest path to search for, in links")
+}
+
+// graphFact is a fact as summarized by the backend's diff endpoint
+type graphFact struct {
+	ID         json.Number `json:"db/id"`
+	Text       string      `json:"claim/text"`
+	Topic      string      `json:"claim/topic,omitempty"`
+	Confidence float64     `json:"claim/confidence"`
+	ValidFrom  string      `json:"claim/valid-from,omitempty"`
+	Patch      struct {
+		SourceID string `json:"patch/source-id,omitempty"`
+	} `json:"claim/patch"`
+}
+
+// graphMotive is a motive as summarized by the backend's diff endpoint
+type graphMotive struct {
+	ID           json.Number `json:"db/id"`
+	ConceptWords []string    `json:"motive/concept-words"`
+	Confidence   float64     `json:"motive/confidence"`
+	ClusterSize  int         `json:"motive/cluster-size"`
+}
+
+// GraphDiff is what changed in the graph between two times
+type GraphDiff struct {
+	From             time.Time     `json:"from"`
+	To               time.Time     `json:"to"`
+	PatchesAdded     int           `json:"patches-added"`
+	SourcesAdded     []string      `json:"sources-added"`
+	TopicsAdded      []string      `json:"topics-added"`
+	TopicsRemoved    []string      `json:"topics-removed"`
+	FactsAdded       []graphFact   `json:"facts-added"`
+	FactsRetracted   []graphFact   `json:"facts-retracted"`
+	MotivesAdded     []graphMotive `json:"motives-added"`
+	MotivesRetracted []graphMotive `json:"motives-retracted"`
+}
+
+func runGraphDiff(cmd *cobra.Command, args []string) error {
+	from, err := parseGraphTime("from", graphDiffFrom)
+	if err != nil {
+		return err
+	}
+	to := time.Now().UTC()
+	if graphDiffTo != "" {
+		if to, err = parseGraphTime("to", graphDiffTo); err != nil {
+			return err
+		}
+	}
+	if from.After(to) {
+		return fmt.Errorf("--from must not be after --to")
+	}
+	if graphDiffFormat != "markdown" && graphDiffFormat != "json" {
+		return fmt.Errorf("unknown format %q (use markdown or json)", graphDiffFormat)
+	}
+
+	diff, err := fetchGraphDiff(cmd.Context(), graphBackendURL, from, to)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if graphDiffOutput != "" {
+		f, err := os.Create(graphDiffOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if graphDiffFormat == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	return writeGraphDiffMarkdown(out, diff)
+}
+
+// parseGraphTime parses a YYYY-MM-DD date (midnight UTC) or RFC 3339 time
+func parseGraphTime(name, value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --%s %q (use YYYY-MM-DD or RFC 3339)", name, value)
+}
+
+func fetchGraphDiff(ctx context.Context, backendURL string, from, to time.Time) (*GraphDiff, error) {
+	query := url.Values{}
+	query.Set("from", from.Format(time.RFC3339))
+	query.Set("to", to.Format(time.RFC3339))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", backendURL+"/api/graph/diff?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("backend error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var diff GraphDiff
+	if err := json.Unmarshal(body, &diff); err != nil {
+		return nil, fmt.Errorf("failed to parse diff: %w", err)
+	}
+	diff.From, diff.To = from, to
+	return &diff, nil
+}
+
+func writeGraphDiffMarkdown(w io.Writer, d *GraphDiff) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Graph changes %s → %s\n\n", formatGraphTime(d.From), formatGraphTime(d.To))
+	fmt.Fprintf(&b, "%d patches · %d facts added · %d facts retracted · %d new motives · %d motives dissolved\n",
+		d.PatchesAdded, len(d.FactsAdded), len(d.FactsRetracted), len(d.MotivesAdded), len(d.MotivesRetracted))
+
+	list := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n## %s (%d)\n\n", title, len(items))
+		for _, item := range items {
+			fmt.Fprintf(&b, "- %s\n", item)
+		}
+	}
+	facts := func(title string, facts []graphFact) {
+		if len(facts) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n## %s (%d)\n", title, len(facts))
+		byTopic := make(map[string][]graphFact)
+		for _, f := range facts {
+			topic := f.Topic
+			if topic == "" {
+				topic = "unknown"
+			}
+			byTopic[topic] = append(byTopic[topic], f)
+		}
+		topics := make([]string, 0, len(byTopic))
+		for t := range byTopic {
+			topics = append(topics, t)
+		}
+		sort.Strings(topics)
+		for _, t := range topics {
+			fmt.Fprintf(&b, "\n### %s\n\n", t)
+			for _, f := range byTopic[t] {
+				fmt.Fprintf(&b, "- %s _(%s, confidence %.2f)_\n", f.Text, orDefault(f.Patch.SourceID, "unknown source"), f.Confidence)
+			}
+		}
+	}
+	motives := func(title string, motives []graphMotive) {
+		if len(motives) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n## %s (%d)\n\n", title, len(motives))
+		for _, m := range motives {
+			words := append([]string(nil), m.ConceptWords...)
+			sort.Strings(words)
+			fmt.Fprintf(&b, "- %s _(%d facts, confidence %.2f)_\n", strings.Join(words, ", "), m.ClusterSize, m.Confidence)
+		}
+	}
+
+	list("New sources", d.SourcesAdded)
+	list("New topics", d.TopicsAdded)
+	list("Topics no longer present", d.TopicsRemoved)
+	facts("New facts", d.FactsAdded)
+	facts("Retracted facts", d.FactsRetracted)
+	motives("New motives", d.MotivesAdded)
+	motives("Dissolved motives", d.MotivesRetracted)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatGraphTime prints midnight-UTC times as plain dates
+func formatGraphTime(t time.Time) string {
+	t = t.UTC()
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
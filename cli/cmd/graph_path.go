@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// GraphPathCmd finds how two entities connect through local patches
+var GraphPathCmd = &cobra.Command{
+	Use:   "path <entity-a> <entity-b>",
+	Short: "Find how two entities connect through shared facts and topics",
+	Long: `Find the shortest chains connecting two entities through the local patches
+under --data, and print each chain with the facts and sources it passes
+through, to explore how two ideas relate across videos.
+
+The graph links each fact to the entities it mentions (as linked by
+'vkm enrich --steps entities'), to its topic, and to the facts its patch
+relates it to. Entities are matched case-insensitively; the two entities
+asked for also match facts that merely contain their name, so paths can
+be found before entities have been linked. A chain such as
+
+  OpenAI → fact → GPT-4 → fact → topic "scaling" → fact → Chinchilla
+
+reads: a fact mentions OpenAI and GPT-4, another mentions GPT-4 and is
+about scaling, as is a fact mentioning Chinchilla.
+
+Only chains of the shortest length found are printed, at most --paths of
+them, and none longer than --max-hops links. Facts rejected or merged
+away with 'vkm facts' are left out; the review history of facts on a
+path is printed under them.
+
+Examples:
+  vkm graph path "OpenAI" "Chinchilla"
+  vkm graph path transformers "attention" --paths 10 --max-hops 8`,
+	Args: cobra.ExactArgs(2),
+	RunE: runGraphPath,
+}
+
+var (
+	graphPathData    string
+	graphPathLimit   int
+	graphPathMaxHops int
+)
+
+// Node kinds in the path graph
+const (
+	pathNodeEntity = "entity"
+	pathNodeFact   = "fact"
+	pathNodeTopic  = "topic"
+)
+
+// pathNode is an entity, fact or topic in the path graph
+type pathNode struct {
+	Kind  string
+	Label string
+	Fact  *Fact
+	Patch *Patch
+}
+
+// pathGraph is the undirected graph of entities, facts and topics built
+// from local patches, keyed by "kind:id"
+type pathGraph struct {
+	nodes map[string]*pathNode
+	links map[string][]string
+}
+
+func runGraphPath(cmd *cobra.Command, args []string) error {
+	if graphPathLimit <= 0 {
+		return fmt.Errorf("--paths must be positive")
+	}
+	if graphPathMaxHops < 2 {
+		return fmt.Errorf("--max-hops must be at least 2")
+	}
+
+	patches, err := loadLocalPatches(graphPathData)
+	if err != nil {
+		return err
+	}
+	if len(patches) == 0 {
+		return fmt.Errorf("no patches found under %s", graphPathData)
+	}
+
+	g := buildPathGraph(patches, args)
+	from, to := pathEntityKey(args[0]), pathEntityKey(args[1])
+	for i, key := range []string{from, to} {
+		if len(g.links[key]) == 0 {
+			return fmt.Errorf("no facts mention %q", args[i])
+		}
+	}
+
+	paths := g.shortestPaths(from, to, graphPathMaxHops, graphPathLimit)
+	if len(paths) == 0 {
+		fmt.Printf("No connection between %q and %q within %d hops\n", args[0], args[1], graphPathMaxHops)
+		return nil
+	}
+	for i, path := range paths {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("Path %d (%d hops)\n", i+1, len(path)-1)
+		g.writePath(os.Stdout, path)
+	}
+	return nil
+}
+
+func pathEntityKey(name string) string {
+	return pathNodeEntity + ":" + strings.ToLower(strings.TrimSpace(name))
+}
+
+// buildPathGraph links facts to their entities, topics and related facts.
+// Facts whose text contains one of the query names also link to it.
+func buildPathGraph(patches []*Patch, query []string) *pathGraph {
+	g := &pathGraph{nodes: make(map[string]*pathNode), links: make(map[string][]string)}
+	link := func(a, b string) {
+		g.links[a] = appendUnique(g.links[a], b)
+		g.links[b] = appendUnique(g.links[b], a)
+	}
+	entity := func(name string) string {
+		key := pathEntityKey(name)
+		if g.nodes[key] == nil {
+			g.nodes[key] = &pathNode{Kind: pathNodeEntity, Label: strings.TrimSpace(name)}
+		}
+		return key
+	}
+
+	for _, p := range patches {
+		linked, _ := p.Metadata[metaEntities].(map[string]interface{})
+		for i := range p.Facts {
+			f := &p.Facts[i]
+			if f.Retired() {
+				continue
+			}
+			key := pathNodeFact + ":" + f.ID
+			g.nodes[key] = &pathNode{Kind: pathNodeFact, Label: f.Text, Fact: f, Patch: p}
+
+			for _, name := range stringList(linked[f.ID]) {
+				link(key, entity(name))
+			}
+			text := strings.ToLower(f.Text)
+			for _, name := range query {
+				if needle := strings.ToLower(strings.TrimSpace(name)); needle != "" && strings.Contains(text, needle) {
+					link(key, entity(name))
+				}
+			}
+			if f.Topic != "" {
+				topic := pathNodeTopic + ":" + strings.ToLower(f.Topic)
+				if g.nodes[topic] == nil {
+					g.nodes[topic] = &pathNode{Kind: pathNodeTopic, Label: f.Topic}
+				}
+				link(key, topic)
+			}
+		}
+		for _, e := range p.Edges {
+			if e.From != "" && e.To != "" && e.From != e.To {
+				link(pathNodeFact+":"+e.From, pathNodeFact+":"+e.To)
+			}
+		}
+	}
+
+	// Edges may name facts outside the loaded patches
+	for key := range g.links {
+		if g.nodes[key] == nil {
+			delete(g.links, key)
+		}
+	}
+	for key, next := range g.links {
+		kept := next[:0]
+		for _, n := range next {
+			if g.nodes[n] != nil {
+				kept = append(kept, n)
+			}
+		}
+		g.links[key] = kept
+	}
+	return g
+}
+
+// shortestPaths returns up to limit of the shortest paths from one node to
+// another, none longer than maxHops links. Paths are found breadth-first,
+// so all have the same length; they are listed in a stable order.
+func (g *pathGraph) shortestPaths(from, to string, maxHops, limit int) [][]string {
+	depth := map[string]int{from: 0}
+	parents := make(map[string][]string)
+	frontier := []string{from}
+
+	for hops := 1; hops <= maxHops && len(frontier) > 0 && depth[to] == 0; hops++ {
+		var next []string
+		for _, node := range frontier {
+			for _, n := range g.links[node] {
+				d, seen := depth[n]
+				if !seen {
+					depth[n] = hops
+					next = append(next, n)
+				}
+				if !seen || d == hops {
+					parents[n] = append(parents[n], node)
+				}
+			}
+		}
+		sort.Strings(next)
+		frontier = next
+	}
+	if _, ok := depth[to]; !ok || from == to {
+		return nil
+	}
+
+	// Walk back from the target through every parent, depth first
+	var paths [][]string
+	var walk func(node string, suffix []string)
+	walk = func(node string, suffix []string) {
+		if len(paths) >= limit {
+			return
+		}
+		suffix = append([]string{node}, suffix...)
+		if node == from {
+			paths = append(paths, suffix)
+			return
+		}
+		ps := append([]string(nil), parents[node]...)
+		sort.Strings(ps)
+		for _, p := range ps {
+			walk(p, suffix)
+		}
+	}
+	walk(to, nil)
+	return paths
+}
+
+// writePath prints a path one node per line, facts with their source
+func (g *pathGraph) writePath(w io.Writer, path []string) {
+	for _, key := range path {
+		n := g.nodes[key]
+		switch n.Kind {
+		case pathNodeEntity:
+			fmt.Fprintf(w, "  %s\n", n.Label)
+		case pathNodeTopic:
+			fmt.Fprintf(w, "    ↳ topic %q\n", n.Label)
+		case pathNodeFact:
+			source := patchSource(n.Patch)
+			if n.Fact.TimestampInVideo > 0 {
+				source += fmt.Sprintf(" @ %s", formatVideoOffset(n.Fact.TimestampInVideo))
+			}
+			fmt.Fprintf(w, "    ↳ %s (%s, confidence %.2f)\n", n.Label, source, n.Fact.Confidence)
+			for _, e := range n.Fact.History {
+				fmt.Fprintf(w, "        %s\n", e.describe())
+			}
+			for _, a := range n.Fact.Annotations {
+				fmt.Fprintf(w, "        note %s\n", a.describe())
+			}
+		}
+	}
+}
+
+// formatVideoOffset prints seconds into a video as m:ss or h:mm:ss
+func formatVideoOffset(seconds float64) string {
+	s := int(seconds)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
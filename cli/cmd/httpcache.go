@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// httpCacheDir holds cached metadata responses. Override with VKM_CACHE_DIR.
+var httpCacheDir = defaultHTTPCacheDir()
+
+func defaultHTTPCacheDir() string {
+	if dir := os.Getenv("VKM_CACHE_DIR"); dir != "" {
+		return filepath.Join(dir, "http")
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "vkm", "http")
+	}
+	return filepath.Join(os.TempDir(), "vkm-cache", "http")
+}
+
+// cachingTransport is an on-disk HTTP cache for metadata fetches (YouTube
+// Data API, RSS feeds, Wikidata). Cached GET responses are revalidated with
+// If-None-Match / If-Modified-Since, and a 304 is answered from disk, so
+// repeated polling of unchanged resources costs no body transfer and, for
+// the Data API, no quota.
+type cachingTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || strings.Contains(req.Header.Get("Cache-Control"), "no-store") {
+		return t.next.RoundTrip(req)
+	}
+
+	path := t.entryPath(req)
+	cached, cachedBody := t.load(path, req)
+
+	if cached != nil {
+		req = req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lm := cached.Header.Get("Last-Modified"); lm != "" {
+			req.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		cached.Body = io.NopCloser(bytes.NewReader(cachedBody))
+		cached.Header.Set("X-Vkm-Cache", "revalidated")
+		return cached, nil
+	}
+
+	if resp.StatusCode == http.StatusOK && cacheable(resp) {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		t.store(path, resp, body)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return resp, nil
+}
+
+// cacheable reports whether a response carries a validator we can revalidate
+func cacheable(resp *http.Response) bool {
+	if strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return false
+	}
+	return resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+func (t *cachingTransport) entryPath(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.String()))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(t.dir, key[:2], key)
+}
+
+// load returns the cached response and its body, or nil if there is none
+func (t *cachingTransport) load(path string, req *http.Request) (*http.Response, []byte) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil
+	}
+
+	return resp, body
+}
+
+// store writes the response atomically; cache failures are never fatal
+func (t *cachingTransport) store(path string, resp *http.Response, body []byte) {
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".entry-*")
+	if err != nil {
+		return
+	}
+	if _, err := tmp.Write(dump); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// newCachedHTTPClient returns a client for metadata fetches that goes
+// through the on-disk HTTP cache
+func newCachedHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &cachingTransport{
+			dir:  httpCacheDir,
+			next: http.DefaultTransport,
+		},
+	}
+}
+
+// fetchCached GETs url through the HTTP cache and returns the body
+func fetchCached(url string) ([]byte, error) {
+	client := newCachedHTTPClient(30 * time.Second)
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s failed (status %d)", url, resp.StatusCode)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// defaultUserAgent identifies vkm's requests; robots.txt groups for "vkm"
+// apply to it
+const defaultUserAgent = "Mozilla/5.0 (compatible; vkm; +https://github.com/epistemicSystems/vkm-graph)"
+
+// clientIDHeader carries the --client-id on every outbound request
+const clientIDHeader = "X-VKM-Client"
+
+var (
+	// userAgent is the User-Agent of outbound requests
+	userAgent = defaultUserAgent
+	// userAgentSet is whether userAgent was configured, rather than the
+	// default, and so is also passed to yt-dlp
+	userAgentSet bool
+	// clientID is the value of clientIDHeader, or empty to send none
+	clientID string
+)
+
+// SetIdentity sets the User-Agent and client identity header of outbound
+// traffic, so operators can pick vkm's requests out of their logs and
+// filter them: API, backend, feed and page fetches made with the default
+// HTTP transport, and yt-dlp (which gets --user-agent and --add-header).
+// The native YouTube client keeps the app User-Agent YouTube expects and
+// only gets the identity header. Empty values fall back to VKM_USER_AGENT
+// and VKM_CLIENT_ID. Call it after SetProxy, which configures the
+// transport this wraps.
+func SetIdentity(agent, id string) error {
+	if agent == "" {
+		agent = os.Getenv("VKM_USER_AGENT")
+	}
+	if id == "" {
+		id = os.Getenv("VKM_CLIENT_ID")
+	}
+	if err := checkHeaderValue("user agent", agent); err != nil {
+		return err
+	}
+	if err := checkHeaderValue("client id", id); err != nil {
+		return err
+	}
+
+	if agent != "" {
+		userAgent = agent
+		userAgentSet = true
+	}
+	clientID = id
+	if _, ok := http.DefaultTransport.(*identityTransport); !ok {
+		http.DefaultTransport = &identityTransport{next: http.DefaultTransport}
+	}
+	return nil
+}
+
+// checkHeaderValue rejects values that can't be sent as a header
+func checkHeaderValue(what, v string) error {
+	if strings.ContainsAny(v, "\r\n\x00") {
+		return fmt.Errorf("invalid %s %q: must be a single line", what, v)
+	}
+	return nil
+}
+
+// identityTransport adds the User-Agent, unless the request already has
+// one, and the client identity header to requests
+type identityTransport struct {
+	next http.RoundTripper
+}
+
+func (t *identityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	if clientID != "" {
+		req.Header.Set(clientIDHeader, clientID)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// identityArgs returns the yt-dlp options sending the configured identity
+func identityArgs() []string {
+	var args []string
+	if userAgentSet {
+		args = append(args, "--user-agent", userAgent)
+	}
+	if clientID != "" {
+		args = append(args, "--add-header", clientIDHeader+":"+clientID)
+	}
+	return args
+}
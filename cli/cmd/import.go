@@ -0,0 +1,400 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ImportCmd registers local recordings as if they had been downloaded
+var ImportCmd = &cobra.Command{
+	Use:   "import <files/dirs...>",
+	Short: "Import local audio and video files for transcription",
+	Long: `Register local recordings (lectures, meetings, podcasts) in the videos
+directory so they flow through transcribe and process exactly like
+downloaded YouTube content. Directories are searched recursively for
+audio and video files.
+
+Each file gets a stable ID derived from its contents ("local-" and 12 hex
+digits), so importing the same recording twice is a no-op, and a
+yt-dlp-style .info.json sidecar with its title (the file name), --channel,
+the file's modification date and, when ffprobe is available, its
+duration. Audio files are copied as is; the audio track of video files is
+extracted to --format with ffmpeg. With --move, originals are removed
+once imported.
+
+Imports are recorded in the manifest as downloaded, with a file:// URL.
+
+With --prefer-embedded-subs, a video file carrying a text subtitle track
+(SubRip, ASS, WebVTT or mov_text, as in mkv and mp4 files) is
+transcribed from it: ffmpeg extracts the track, and its cues become a
+transcript with their timestamps, saved under --transcripts and
+recorded as transcribed by "imported-embedded-subs". 'vkm transcribe'
+and the pipeline then don't run Whisper over the file. --subs-lang picks
+the track of a language, else the default track is used, else the
+first. Image-based subtitles (DVD, Blu-ray) have no text and are
+ignored.
+
+Examples:
+  vkm import ~/Recordings/lecture-01.m4a
+  vkm import ~/Meetings --channel "Team sync" --name-template '{{.ChannelSlug}}/{{.Date}}-{{.TitleSlug}}'
+  vkm import talk.mp4 --move
+  vkm import ~/Films --prefer-embedded-subs --subs-lang de
+
+` + nameTemplateHelp,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runImport,
+}
+
+var (
+	importOutputDir    string
+	importNameTemplate string
+	importManifest     string
+	importChannel      string
+	importFormat       string
+	importMove         bool
+	importTranscripts  string
+	importEmbeddedSubs bool
+	importSubsLang     string
+)
+
+func init() {
+	ImportCmd.Flags().StringVarP(&importOutputDir, "output", "o", "data/videos", "Output directory")
+	ImportCmd.Flags().StringVar(&importNameTemplate, "name-template", defaultNameTemplate, "Go template for output file names")
+	ImportCmd.Flags().StringVar(&importManifest, "manifest", "data/manifest.db", "SQLite manifest recording imports")
+	ImportCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	ImportCmd.Flags().StringVar(&importChannel, "channel", "local", "Channel name recorded for the imported files")
+	ImportCmd.Flags().StringVar(&importFormat, "format", "mp3", "Audio format for audio extracted from video files (mp3, wav, m4a)")
+	ImportCmd.Flags().BoolVar(&importMove, "move", false, "Remove the original files once imported")
+	ImportCmd.Flags().BoolVar(&importEmbeddedSubs, "prefer-embedded-subs", false, "Transcribe video files from their text subtitle track, when they have one, instead of Whisper")
+	ImportCmd.Flags().StringVar(&importSubsLang, "subs-lang", "en", "Language of the subtitle track to prefer (empty for the default track)")
+	ImportCmd.Flags().StringVar(&importTranscripts, "transcripts", "data/transcripts", "Output directory for transcripts from embedded subtitles")
+}
+
+// Extensions import recognizes; audio is copied, video has its audio
+// track extracted
+var (
+	importAudioExts = map[string]bool{".mp3": true, ".m4a": true, ".wav": true, ".ogg": true, ".opus": true, ".flac": true, ".aac": true, ".mpga": true}
+	importVideoExts = map[string]bool{".mp4": true, ".mkv": true, ".mov": true, ".webm": true, ".avi": true, ".mpeg": true, ".m4v": true}
+)
+
+func runImport(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	names, err := parseNameTemplate(importNameTemplate)
+	if err != nil {
+		return err
+	}
+
+	files, err := collectImportFiles(args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no audio or video files found")
+	}
+
+	if err := os.MkdirAll(importOutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	manifest, err := openManifest(importManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	imported, skipped, failed := 0, 0, 0
+	for i, path := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("[%d/%d] %s\n", i+1, len(files), path)
+		media, existed, err := importFile(ctx, manifest, path, names)
+		switch {
+		case err != nil:
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+		case existed:
+			fmt.Printf("  ✓ Already imported as %s: %s\n", media.VideoID, media.Path)
+			skipped++
+		default:
+			fmt.Printf("  ✓ Imported as %s: %s\n", media.VideoID, media.Path)
+			imported++
+		}
+	}
+
+	fmt.Printf("\nImported %d files", imported)
+	if skipped > 0 {
+		fmt.Printf(", %d already imported", skipped)
+	}
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+	}
+	fmt.Println()
+	return ctx.Err()
+}
+
+// collectImportFiles expands directories to the media files under them.
+// Files named explicitly must still have a recognized extension.
+func collectImportFiles(args []string) ([]string, error) {
+	isMedia := func(path string) bool {
+		ext := strings.ToLower(filepath.Ext(path))
+		return importAudioExts[ext] || importVideoExts[ext]
+	}
+
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", arg, err)
+		}
+		if !info.IsDir() {
+			if !isMedia(arg) {
+				fmt.Fprintf(os.Stderr, "Warning: skipping %s (not a recognized audio or video file)\n", arg)
+				continue
+			}
+			files = append(files, arg)
+			continue
+		}
+
+		var found []string
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && isMedia(path) {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", arg, err)
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// importFile copies or converts one file into the output directory and
+// records it, reporting whether it had been imported before
+func importFile(ctx context.Context, m *Manifest, path string, names *nameTemplate) (*downloadedMedia, bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	id, err := localMediaID(abs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if prev, err := m.ItemByVideoID(id); err == nil && prev != nil && prev.AudioPath != "" {
+		if _, err := os.Stat(prev.AudioPath); err == nil {
+			return &downloadedMedia{VideoID: id, Path: prev.AudioPath}, true, nil
+		}
+	}
+
+	stat, err := os.Stat(abs)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	title := strings.TrimSuffix(filepath.Base(abs), filepath.Ext(abs))
+	modified := stat.ModTime().UTC()
+	fields := nameFields{ID: id, Title: title, Channel: importChannel}.withDate(modified)
+	name, err := names.Render(fields)
+	if err != nil {
+		return nil, false, err
+	}
+	base := claimName(filepath.Join(importOutputDir, name), id)
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return nil, false, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(abs))
+	media := &downloadedMedia{VideoID: id, InfoPath: base + ".info.json"}
+	if importVideoExts[ext] {
+		media.Path = base + "." + importFormat
+		if err := extractAudio(ctx, abs, media.Path); err != nil {
+			return nil, false, err
+		}
+	} else {
+		media.Path = base + ext
+		if err := copyFile(abs, media.Path); err != nil {
+			return nil, false, err
+		}
+	}
+
+	info := map[string]interface{}{
+		"id":            id,
+		"title":         title,
+		"channel":       importChannel,
+		"uploader":      importChannel,
+		"upload_date":   modified.Format("20060102"),
+		"timestamp":     modified.Unix(),
+		"ext":           strings.TrimPrefix(filepath.Ext(media.Path), "."),
+		"extractor":     "local",
+		"webpage_url":   "file://" + filepath.ToSlash(abs),
+		"original_path": abs,
+	}
+	if d, err := probeDuration(ctx, media.Path); err == nil {
+		info["duration"] = d
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	if err := os.WriteFile(media.InfoPath, data, 0644); err != nil {
+		os.Remove(media.Path)
+		return nil, false, fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	item := ManifestItem{URL: info["webpage_url"].(string), VideoID: id, State: ItemDownloaded, AudioPath: media.Path}
+	if importEmbeddedSubs && importVideoExts[ext] {
+		if path, err := importEmbeddedSubsTranscript(ctx, abs, base, id, title, modified); err != nil {
+			if ctx.Err() != nil {
+				os.Remove(media.Path)
+				os.Remove(media.InfoPath)
+				return nil, false, err
+			}
+			fmt.Fprintf(os.Stderr, "  Warning: %v; imported without a transcript\n", err)
+		} else if path != "" {
+			item.State, item.TranscriptPath, item.TranscriptModel = ItemTranscribed, path, transcriptFromEmbeddedSubs
+		}
+	}
+	recordItem(m, withCatalog(item, media.InfoPath))
+
+	if importMove {
+		if err := os.Remove(abs); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", path, err)
+		}
+	}
+	return media, false, nil
+}
+
+// importEmbeddedSubsTranscript saves the transcript of a video file's
+// embedded subtitles under --transcripts, mirroring the audio's name
+// (base) under --output, and returns its path, or "" when the file has
+// no text subtitles
+func importEmbeddedSubsTranscript(ctx context.Context, src, base, id, title string, modified time.Time) (string, error) {
+	t, track, err := embeddedSubsTranscript(ctx, src, importSubsLang)
+	if err != nil || t == nil {
+		return "", err
+	}
+	t.VideoID, t.Title = id, title
+	t.PublishedAt = modified.Format(time.RFC3339)
+
+	rel, err := filepath.Rel(importOutputDir, base)
+	if err != nil {
+		rel = filepath.Base(base)
+	}
+	path := filepath.Join(importTranscripts, rel+".json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal transcript: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write transcript: %w", err)
+	}
+	fmt.Printf("  ✓ Transcript from %s subtitles (track %d, %s): %s\n",
+		orDefault(track.Language, "unknown-language"), track.Index, track.Codec, path)
+	return path, nil
+}
+
+// localMediaID derives a stable ID from a file's contents
+func localMediaID(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return "local-" + hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
+
+// copyFile copies src to dst through a temp file, so an interrupted copy
+// never leaves a truncated dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".import-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return nil
+}
+
+// extractAudio writes the audio track of a video file to dst with ffmpeg
+func extractAudio(ctx context.Context, src, dst string) error {
+	if _, err := findTool("ffmpeg"); err != nil {
+		return fmt.Errorf("%w (required to import video files)", err)
+	}
+	cmd := toolCommand(ctx, "ffmpeg",
+		"-y", "-loglevel", "error",
+		"-i", toolPath(src),
+		"-vn",
+		toolPath(dst))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(dst)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// probeDuration returns a media file's duration in whole seconds with
+// ffprobe
+func probeDuration(ctx context.Context, path string) (int, error) {
+	if _, err := findTool("ffprobe"); err != nil {
+		return 0, err
+	}
+	out, err := toolCommand(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		toolPath(path)).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse duration: %w", err)
+	}
+	return int(seconds + 0.5), nil
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ImportTranscriptCmd registers transcripts made elsewhere in the catalog
+var ImportTranscriptCmd = &cobra.Command{
+	Use:   "import-transcript <files/dirs...>",
+	Short: "Import existing SRT, VTT, otter.ai and Whisper JSON transcripts into the catalog",
+	Long: `Convert transcripts made elsewhere into vkm transcripts and record them
+in the manifest as transcribed, so recordings that already have a
+transcript don't need to be transcribed again. Directories are searched
+recursively. Nothing is sent to the backend; 'vkm upload-transcripts'
+converts transcripts and extracts their facts in one go.
+
+Formats are detected as by 'vkm upload-transcripts':
+  .srt    SubRip subtitles, one segment per cue
+  .vtt    WebVTT captions
+  .json   raw Whisper output (the API's verbose_json, the whisper CLI,
+          WhisperX), keeping word timings and speakers; or vkm transcripts
+  .txt    otter.ai text exports, keeping speakers and timestamps; other
+          text becomes one segment per paragraph
+
+Metadata comes from a .info.json beside the file or the file name (see
+'vkm upload-transcripts --help'). A transcript whose video is in the
+catalog (by the YouTube ID in its name or metadata, or --video-id for a
+single file) is attached to it: it takes the video's title, channel and
+publish date, and the video is marked transcribed. The pipeline, watch
+and serve modes then use the imported transcript instead of downloading
+and transcribing the video, and 'vkm transcribe' skips its audio.
+
+The manifest records the transcript model as "imported-" and the format
+("imported-srt", "imported-whisper-json"). Videos that already have a
+transcript are skipped unless --force is given.
+
+Examples:
+  vkm import-transcript ~/subtitles
+  vkm import-transcript talk.srt --video-id dQw4w9WgXcQ
+  vkm import-transcript ~/otter-exports --channel "Team sync"
+
+` + nameTemplateHelp,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runImportTranscript,
+}
+
+// transcriptImported prefixes the manifest's transcript model for
+// imported transcripts, before the format they were read as
+const transcriptImported = "imported-"
+
+var importTranscriptVideoID string
+
+func init() {
+	ImportTranscriptCmd.Flags().StringVarP(&ingestOutputDir, "output", "o", "data/transcripts", "Output directory for transcripts")
+	ImportTranscriptCmd.Flags().StringVar(&ingestNameTemplate, "name-template", defaultNameTemplate, "Go template for transcript file names")
+	ImportTranscriptCmd.Flags().StringVar(&ingestManifest, "manifest", "data/manifest.db", "SQLite manifest recording imported transcripts")
+	ImportTranscriptCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	ImportTranscriptCmd.Flags().StringVar(&uploadChannel, "channel", "", "Channel name recorded for transcripts without one")
+	ImportTranscriptCmd.Flags().StringVar(&importTranscriptVideoID, "video-id", "", "Catalog video to attach the transcript to (one file only)")
+	ImportTranscriptCmd.Flags().BoolVar(&ingestForce, "force", false, "Import transcripts even for videos that have one")
+}
+
+func runImportTranscript(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	names, err := parseNameTemplate(ingestNameTemplate)
+	if err != nil {
+		return err
+	}
+	files, err := collectTranscriptFiles(args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no transcript files found")
+	}
+	if importTranscriptVideoID != "" && len(files) > 1 {
+		return fmt.Errorf("--video-id attaches a single transcript, but %d files were found", len(files))
+	}
+	manifest, err := openManifest(ingestManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	imported, skipped, failed := 0, 0, 0
+	for i, path := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("[%d/%d] %s\n", i+1, len(files), path)
+		done, err := importTranscriptFile(manifest, path, names)
+		switch {
+		case err != nil:
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+		case done:
+			skipped++
+		default:
+			imported++
+		}
+	}
+
+	fmt.Printf("\nImported %d transcripts", imported)
+	if skipped > 0 {
+		fmt.Printf(", %d already transcribed", skipped)
+	}
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+	}
+	fmt.Println()
+	return ctx.Err()
+}
+
+// importTranscriptFile converts and records one transcript, reporting
+// whether it was skipped because its video has a transcript already
+func importTranscriptFile(m *Manifest, path string, names *nameTemplate) (bool, error) {
+	doc, format, err := readTranscriptFile(path)
+	if err != nil {
+		return false, err
+	}
+	if importTranscriptVideoID != "" {
+		doc.ID = importTranscriptVideoID
+	}
+
+	prev, err := m.ItemByVideoID(doc.ID)
+	if err != nil {
+		return false, err
+	}
+	if importTranscriptVideoID != "" && prev == nil {
+		return false, fmt.Errorf("video %s is not in the catalog", doc.ID)
+	}
+	infoPath := ""
+	if prev != nil {
+		if !ingestForce && prev.TranscriptPath != "" && (prev.State == ItemTranscribed || prev.State == ItemProcessed) {
+			if _, err := os.Stat(prev.TranscriptPath); err == nil {
+				fmt.Printf("  ✓ Already transcribed as %s: %s\n", doc.ID, prev.TranscriptPath)
+				return true, nil
+			}
+		}
+		infoPath = attachToCatalogItem(doc, prev)
+	}
+
+	media, err := saveDocument(doc, ingestOutputDir, names)
+	if err != nil {
+		return false, err
+	}
+	if infoPath == "" {
+		infoPath = media.InfoPath
+	}
+
+	// Items the pipeline already took further keep their state
+	state := ItemTranscribed
+	if prev != nil && prev.State == ItemProcessed {
+		state = prev.State
+	}
+	recordItem(m, withCatalog(ManifestItem{
+		URL:             doc.URL,
+		VideoID:         doc.ID,
+		State:           state,
+		TranscriptPath:  media.Path,
+		TranscriptModel: transcriptImported + format,
+	}, infoPath))
+
+	fmt.Printf("  ✓ Imported %s (%s, %d segments) as %s: %s\n", doc.Title, format, len(doc.Blocks), doc.ID, media.Path)
+	return false, nil
+}
+
+// attachToCatalogItem points doc at the catalog item of its video, with
+// the title, channel and publish date of the item's metadata in place of
+// those guessed from the file. It returns the item's info.json path, or
+// "" if it has none on disk.
+func attachToCatalogItem(doc *ingestedDocument, item *ManifestItem) string {
+	doc.URL = item.URL
+	infoPath := itemMetadataPath(item)
+	info, err := loadVideoMetadata(infoPath)
+	if err != nil {
+		doc.Title = orDefault(item.Title, doc.Title)
+		if item.Channel != "" {
+			doc.Site, doc.Author = item.Channel, ""
+		}
+		return ""
+	}
+	if title, _ := info["title"].(string); title != "" {
+		doc.Title = title
+	}
+	if channel, _ := info["channel"].(string); channel != "" {
+		doc.Site = channel
+	}
+	if uploader, _ := info["uploader"].(string); uploader != "" {
+		doc.Author = uploader
+	}
+	if published := publishedAtFromInfo(info); !published.IsZero() {
+		doc.Published = published
+	}
+	return infoPath
+}
+
+// importedTranscript returns the transcript imported for item's video,
+// if it has one, as media ready to be extracted
+func importedTranscript(m *Manifest, item pipelineItem) (*downloadedMedia, *Transcript) {
+	id := orDefault(item.VideoID, videoIDFromURL(item.URL))
+	if m == nil || id == "" {
+		return nil, nil
+	}
+	prev, err := m.ItemByVideoID(id)
+	if err != nil || !isImportedTranscript(prev) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(prev.TranscriptPath)
+	if err != nil {
+		return nil, nil
+	}
+	var t Transcript
+	if err := json.Unmarshal(data, &t); err != nil || len(t.Transcript) == 0 {
+		fmt.Fprintf(os.Stderr, "  Warning: imported transcript %s is unreadable; transcribing instead\n", prev.TranscriptPath)
+		return nil, nil
+	}
+	media := &downloadedMedia{VideoID: id, Path: prev.TranscriptPath, InfoPath: itemMetadataPath(prev), Captions: true}
+	return media, &t
+}
+
+// isImportedTranscript reports whether item's transcript was imported
+// with import-transcript
+func isImportedTranscript(item *ManifestItem) bool {
+	return item != nil && item.TranscriptPath != "" && strings.HasPrefix(item.TranscriptModel, transcriptImported)
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ingestedDocument is a written source (web article, paper) turned into
+// text blocks, ready to be saved as a transcript
+type ingestedDocument struct {
+	ID        string
+	URL       string
+	Kind      string
+	Title     string
+	Author    string
+	Site      string
+	Language  string
+	Published time.Time
+	Blocks    []documentBlock
+	Chapters  []Chapter
+	// Metadata holds source-specific provenance (arXiv ID, categories)
+	// added to the patch on extraction
+	Metadata map[string]interface{}
+}
+
+// documentBlock is a paragraph, heading or page of a document, or a cue
+// of an uploaded transcript
+type documentBlock struct {
+	Text string
+	// Page is the 1-based page the block starts on, 0 when the source has
+	// no pages
+	Page int
+	// Timestamp and Duration place a transcript's cues in the recording,
+	// in seconds
+	Timestamp float64
+	Duration  float64
+	// Speaker, Chapter and Words carry what a transcript's cue knows
+	// of who speaks, its chapter and the timing of its words
+	Speaker string
+	Chapter string
+	Words   []TranscriptWord
+}
+
+// documentID derives a stable ID for a document from its canonical
+// location, prefixed with its kind
+func documentID(kind, location string) string {
+	sum := sha256.Sum256([]byte(location))
+	return kind + "-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// Text joins the document's blocks into paragraphs, each after its
+// speaker when it has one
+func (d *ingestedDocument) Text() string {
+	parts := make([]string, len(d.Blocks))
+	for i, b := range d.Blocks {
+		parts[i] = b.Text
+		if b.Speaker != "" {
+			parts[i] = b.Speaker + ": " + b.Text
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// saveDocument writes doc as a transcript JSON (one segment per block)
+// with a yt-dlp-style .info.json beside it under dir, named with names,
+// so documents flow through the same steps as video transcripts
+func saveDocument(doc *ingestedDocument, dir string, names *nameTemplate) (*downloadedMedia, error) {
+	channel := orDefault(doc.Site, doc.Author)
+	fields := nameFields{ID: doc.ID, Title: doc.Title, Channel: channel}.withDate(doc.Published)
+	name, err := names.Render(fields)
+	if err != nil {
+		return nil, err
+	}
+	base := claimName(filepath.Join(dir, name), doc.ID)
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	transcript := Transcript{
+		VideoID:    doc.ID,
+		Title:      doc.Title,
+		Language:   doc.Language,
+		Transcript: make([]TranscriptSegment, 0, len(doc.Blocks)),
+		Chapters:   doc.Chapters,
+	}
+	if !doc.Published.IsZero() {
+		transcript.PublishedAt = doc.Published.Format(time.RFC3339)
+	}
+	for _, block := range doc.Blocks {
+		transcript.Transcript = append(transcript.Transcript, TranscriptSegment{
+			Timestamp: block.Timestamp,
+			Text:      block.Text,
+			Duration:  block.Duration,
+			Page:      block.Page,
+			Speaker:   block.Speaker,
+			Chapter:   block.Chapter,
+			Words:     block.Words,
+		})
+	}
+
+	info := map[string]interface{}{
+		"id":          doc.ID,
+		"title":       doc.Title,
+		"channel":     channel,
+		"uploader":    orDefault(doc.Author, doc.Site),
+		"webpage_url": doc.URL,
+		"extractor":   doc.Kind,
+	}
+	if !doc.Published.IsZero() {
+		info["upload_date"] = doc.Published.Format("20060102")
+		info["timestamp"] = doc.Published.Unix()
+	}
+
+	media := &downloadedMedia{VideoID: doc.ID, Path: base + ".json", InfoPath: base + ".info.json", Captions: true}
+	for path, v := range map[string]interface{}{media.Path: transcript, media.InfoPath: info} {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", filepath.Base(path), err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return media, nil
+}
+
+// ingestDocument saves doc, records it in the manifest as transcribed
+// and, with extract set, sends it to the backend for fact extraction
+func ingestDocument(ctx context.Context, m *Manifest, doc *ingestedDocument, dir string, names *nameTemplate, extract bool) error {
+	media, err := saveDocument(doc, dir, names)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  ✓ Saved %d blocks (%d characters): %s\n", len(doc.Blocks), len(doc.Text()), media.Path)
+	recordItem(m, withCatalog(ManifestItem{URL: doc.URL, VideoID: doc.ID, State: ItemTranscribed, TranscriptPath: media.Path}, media.InfoPath))
+	if !extract {
+		return nil
+	}
+
+	commit := patchCommit{Metadata: map[string]interface{}{"source-url": doc.URL, "source-kind": doc.Kind}}
+	if doc.Title != "" {
+		commit.Metadata["title"] = doc.Title
+	}
+	for k, v := range doc.Metadata {
+		commit.Metadata[k] = v
+	}
+	patchID, factsCount, err := uploadToBackend(ctx, doc.Text(), doc.ID, commit)
+	if err != nil {
+		return fmt.Errorf("fact extraction failed: %w", err)
+	}
+	fmt.Printf("  ✓ Extracted: %d facts (patch %s)\n", factsCount, patchID)
+	recordItem(m, ManifestItem{URL: doc.URL, VideoID: doc.ID, State: ItemProcessed, TranscriptPath: media.Path, PatchID: patchID})
+	return nil
+}
+
+// documentIngested reports whether a document needs no further work: it
+// was extracted already, or saved and extraction is not asked for
+func documentIngested(m *Manifest, id string, extract bool) (bool, error) {
+	prev, err := m.ItemByVideoID(id)
+	if err != nil || prev == nil {
+		return false, err
+	}
+	if prev.State == ItemProcessed {
+		return true, nil
+	}
+	if _, err := os.Stat(prev.TranscriptPath); err != nil || prev.TranscriptPath == "" {
+		return false, nil
+	}
+	return !extract && prev.State == ItemTranscribed, nil
+}
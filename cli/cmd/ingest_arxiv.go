@@ -0,0 +1,400 @@
+package cmd
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// IngestArxivCmd turns arXiv papers into transcripts
+var IngestArxivCmd = &cobra.Command{
+	Use:   "ingest-arxiv <id|url...|->",
+	Short: "Ingest arXiv papers as transcripts for fact extraction",
+	Long: `Fetch arXiv papers by ID or URL and save their text as transcripts, with
+their citation metadata, so papers become knowledge patches like videos.
+
+Papers are given as IDs (2203.15556, 2203.15556v2, hep-th/9901001,
+arXiv:2203.15556) or as abs, pdf or html URLs on arxiv.org. Title,
+authors, dates, categories, DOI and journal reference come from the arXiv
+API, in one request for all papers. The full text is read from the
+paper's PDF as 'vkm ingest-pdf' reads it (--pages for one segment per
+page); with --abstract-only just the abstract is ingested, without
+downloading the PDF or needing pdftotext.
+
+Papers get the ID "arxiv-" and their arXiv ID, and are recorded in the
+manifest with their abs URL; papers already ingested are skipped unless
+--force is given, which also picks up new versions. With --extract the
+text is sent to the backend for fact extraction, and the patch records
+the paper's provenance: arxiv-id, arxiv-version, authors, published-at,
+updated-at, categories, primary-category, doi, journal-ref and a
+citation line.
+
+IDs and URLs can also be read from a file with --from-file, or from stdin
+with a "-" argument, one per line, as for 'vkm ingest-url'.
+
+Requirements:
+  - pdftotext (poppler), unless --abstract-only
+
+Examples:
+  vkm ingest-arxiv 2203.15556
+  vkm ingest-arxiv --extract --strategy two-pass https://arxiv.org/abs/1706.03762
+  vkm ingest-arxiv --abstract-only --extract 2001.08361 2203.15556
+  vkm ingest-arxiv --from-file papers.txt
+
+` + nameTemplateHelp,
+	RunE: runIngestArxiv,
+}
+
+var ingestAbstractOnly bool
+
+func init() {
+	IngestArxivCmd.Flags().StringVarP(&ingestOutputDir, "output", "o", "data/transcripts", "Output directory for transcripts")
+	IngestArxivCmd.Flags().StringVar(&ingestNameTemplate, "name-template", defaultNameTemplate, "Go template for transcript file names")
+	IngestArxivCmd.Flags().StringVar(&ingestManifest, "manifest", "data/manifest.db", "SQLite manifest recording ingested documents")
+	IngestArxivCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	IngestArxivCmd.Flags().BoolVar(&ingestAbstractOnly, "abstract-only", false, "Ingest only the abstract, without downloading the PDF")
+	IngestArxivCmd.Flags().BoolVar(&ingestPages, "pages", false, "Make each page one segment instead of each paragraph")
+	IngestArxivCmd.Flags().BoolVar(&ingestExtract, "extract", false, "Send the text to the backend for fact extraction")
+	IngestArxivCmd.Flags().StringVarP(&pipelineBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	IngestArxivCmd.Flags().StringVar(&pipelineStrategy, "strategy", extractStrategySingle, "Fact extraction strategy with --extract (single, two-pass)")
+	IngestArxivCmd.Flags().BoolVar(&ingestForce, "force", false, "Ingest papers again even if the manifest has them")
+	IngestArxivCmd.Flags().StringVar(&urlListFile, "from-file", "", "Read more paper IDs or URLs from this file, one per line (- for stdin)")
+}
+
+const (
+	arxivAPIURL = "https://export.arxiv.org/api/query"
+	arxivAbsURL = "https://arxiv.org/abs/"
+	arxivPDFURL = "https://arxiv.org/pdf/"
+)
+
+// arxivIDPattern matches new-style (2203.15556) and old-style
+// (hep-th/9901001) arXiv IDs, with an optional version
+var arxivIDPattern = regexp.MustCompile(`^(\d{4}\.\d{4,5}|[a-z-]+(?:\.[A-Z]{2})?/\d{7})(v\d+)?$`)
+
+// arxivPaper is a paper's entry in the arXiv API's Atom feed
+type arxivPaper struct {
+	ID        string `xml:"id"`
+	Title     string `xml:"title"`
+	Summary   string `xml:"summary"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Authors   []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	DOI             string `xml:"http://arxiv.org/schemas/atom doi"`
+	JournalRef      string `xml:"http://arxiv.org/schemas/atom journal_ref"`
+	PrimaryCategory struct {
+		Term string `xml:"term,attr"`
+	} `xml:"http://arxiv.org/schemas/atom primary_category"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+}
+
+func runIngestArxiv(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if !ingestAbstractOnly {
+		if _, err := findTool("pdftotext"); err != nil {
+			return err
+		}
+	}
+	if err := checkExtractStrategy(pipelineStrategy); err != nil {
+		return err
+	}
+
+	args, err := expandURLArgs(args)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(args))
+	for i, arg := range args {
+		id, err := parseArxivID(arg)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+
+	names, err := parseNameTemplate(ingestNameTemplate)
+	if err != nil {
+		return err
+	}
+	manifest, err := openManifest(ingestManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	papers, err := fetchArxivPapers(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	ingested, skipped, failed := 0, 0, 0
+	for i, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("[%d/%d] arXiv:%s\n", i+1, len(ids), id)
+
+		paper, ok := papers[arxivBaseID(id)]
+		if !ok {
+			fmt.Printf("  ✗ Not found on arXiv\n")
+			failed++
+			continue
+		}
+		doc := paper.Document()
+		if !ingestForce {
+			done, err := documentIngested(manifest, doc.ID, ingestExtract)
+			if err != nil {
+				return err
+			}
+			if done {
+				fmt.Printf("  ✓ Already ingested as %s\n", doc.ID)
+				skipped++
+				continue
+			}
+		}
+		fmt.Printf("  %s\n  %s (%s)\n", doc.Title, doc.Author, strings.Join(paper.CategoryTerms(), ", "))
+
+		if ingestAbstractOnly {
+			doc.Blocks = []documentBlock{{Text: paper.Abstract()}}
+		} else if doc.Blocks, err = fetchArxivFullText(ctx, paper.VersionedID(), ingestPages); err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+			continue
+		}
+		if err := ingestDocument(ctx, manifest, doc, ingestOutputDir, names, ingestExtract); err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+			continue
+		}
+		ingested++
+	}
+
+	fmt.Printf("\nIngested %d papers", ingested)
+	if skipped > 0 {
+		fmt.Printf(", %d already ingested", skipped)
+	}
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+	}
+	fmt.Println()
+	return ctx.Err()
+}
+
+// parseArxivID extracts the arXiv ID from an ID, arXiv:ID or arxiv.org URL
+func parseArxivID(raw string) (string, error) {
+	s := strings.TrimSpace(raw)
+	if len(s) > 6 && strings.EqualFold(s[:6], "arxiv:") {
+		s = s[6:]
+	}
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		if host := strings.TrimPrefix(u.Hostname(), "www."); host != "arxiv.org" && host != "export.arxiv.org" {
+			return "", fmt.Errorf("not an arXiv URL: %s", raw)
+		}
+		s = strings.TrimPrefix(u.Path, "/")
+		for _, prefix := range []string{"abs/", "pdf/", "html/"} {
+			s = strings.TrimPrefix(s, prefix)
+		}
+		s = strings.TrimSuffix(strings.TrimSuffix(s, "/"), ".pdf")
+	}
+	if !arxivIDPattern.MatchString(s) {
+		return "", fmt.Errorf("invalid arXiv ID %q (use e.g. 2203.15556 or https://arxiv.org/abs/2203.15556)", raw)
+	}
+	return s, nil
+}
+
+// arxivBaseID strips the version from an arXiv ID
+func arxivBaseID(id string) string {
+	if m := arxivIDPattern.FindStringSubmatch(id); m != nil {
+		return m[1]
+	}
+	return id
+}
+
+// fetchArxivPapers looks papers up in the arXiv API, keyed by ID without
+// version. IDs the API doesn't know are missing from the result.
+func fetchArxivPapers(ctx context.Context, ids []string) (map[string]*arxivPaper, error) {
+	query := url.Values{"id_list": {strings.Join(ids, ",")}, "max_results": {fmt.Sprint(len(ids))}}
+	req, err := http.NewRequestWithContext(ctx, "GET", arxivAPIURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query arXiv: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read arXiv response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("arXiv API error (status %d): %s", resp.StatusCode, lastLine(string(body)))
+	}
+	return parseArxivFeed(body)
+}
+
+// parseArxivFeed reads the entries of an arXiv API response. The API
+// reports bad IDs as entries titled "Error"; those are skipped.
+func parseArxivFeed(data []byte) (map[string]*arxivPaper, error) {
+	var feed struct {
+		Entries []*arxivPaper `xml:"entry"`
+	}
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return nil, fmt.Errorf("failed to parse arXiv response: %w", err)
+	}
+
+	papers := make(map[string]*arxivPaper)
+	for _, p := range feed.Entries {
+		if strings.Contains(p.ID, "/api/errors") || strings.TrimSpace(p.Title) == "" {
+			continue
+		}
+		papers[arxivBaseID(p.VersionedID())] = p
+	}
+	return papers, nil
+}
+
+// VersionedID is the paper's arXiv ID with the version the API returned
+func (p *arxivPaper) VersionedID() string {
+	id := strings.TrimSpace(p.ID)
+	if i := strings.Index(id, "/abs/"); i >= 0 {
+		id = id[i+len("/abs/"):]
+	}
+	return id
+}
+
+// Abstract is the paper's abstract as one paragraph
+func (p *arxivPaper) Abstract() string {
+	return strings.Join(strings.Fields(p.Summary), " ")
+}
+
+// CategoryTerms lists the paper's categories, primary first
+func (p *arxivPaper) CategoryTerms() []string {
+	terms := []string{}
+	if p.PrimaryCategory.Term != "" {
+		terms = append(terms, p.PrimaryCategory.Term)
+	}
+	for _, c := range p.Categories {
+		if c.Term != "" && c.Term != p.PrimaryCategory.Term {
+			terms = append(terms, c.Term)
+		}
+	}
+	return terms
+}
+
+// Document describes the paper as a document without text blocks, with
+// its citation metadata as provenance
+func (p *arxivPaper) Document() *ingestedDocument {
+	versioned := p.VersionedID()
+	id := arxivBaseID(versioned)
+	title := strings.Join(strings.Fields(p.Title), " ")
+
+	var authors []string
+	for _, a := range p.Authors {
+		if name := strings.TrimSpace(a.Name); name != "" {
+			authors = append(authors, name)
+		}
+	}
+
+	doc := &ingestedDocument{
+		ID:     "arxiv-" + strings.ReplaceAll(id, "/", "-"),
+		URL:    arxivAbsURL + id,
+		Kind:   "arxiv",
+		Title:  title,
+		Author: citationAuthors(authors),
+		Site:   "arXiv",
+		Metadata: map[string]interface{}{
+			"arxiv-id":   id,
+			"authors":    authors,
+			"categories": p.CategoryTerms(),
+		},
+	}
+	if version := strings.TrimPrefix(versioned, id); version != "" {
+		doc.Metadata["arxiv-version"] = version
+	}
+	if p.PrimaryCategory.Term != "" {
+		doc.Metadata["primary-category"] = p.PrimaryCategory.Term
+	}
+	if t, ok := parseArticleTime(p.Published); ok {
+		doc.Published = t
+		doc.Metadata["published-at"] = t.Format(time.RFC3339)
+	}
+	if t, ok := parseArticleTime(p.Updated); ok {
+		doc.Metadata["updated-at"] = t.Format(time.RFC3339)
+	}
+	if doi := strings.TrimSpace(p.DOI); doi != "" {
+		doc.Metadata["doi"] = doi
+	}
+	if ref := strings.Join(strings.Fields(p.JournalRef), " "); ref != "" {
+		doc.Metadata["journal-ref"] = ref
+	}
+
+	year := ""
+	if !doc.Published.IsZero() {
+		year = fmt.Sprintf(" (%d)", doc.Published.Year())
+	}
+	doc.Metadata["citation"] = fmt.Sprintf("%s%s. %s. arXiv:%s", orDefault(doc.Author, "Anonymous"), year, title, versioned)
+	return doc
+}
+
+// citationAuthors names a paper's authors the way citations do: one or
+// two names in full, more as the first and "et al."
+func citationAuthors(authors []string) string {
+	switch len(authors) {
+	case 0:
+		return ""
+	case 1:
+		return authors[0]
+	case 2:
+		return authors[0] + " and " + authors[1]
+	default:
+		return authors[0] + " et al."
+	}
+}
+
+// fetchArxivFullText downloads a paper's PDF and extracts its text
+func fetchArxivFullText(ctx context.Context, id string, byPage bool) ([]documentBlock, error) {
+	f, err := newTempFile("arxiv-*.pdf")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", arxivPDFURL+id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download PDF: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download PDF (status %d)", resp.StatusCode)
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return nil, fmt.Errorf("failed to download PDF: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to save PDF: %w", err)
+	}
+	return pdfBlocks(ctx, f.Name(), byPage)
+}
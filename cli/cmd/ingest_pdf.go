@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// IngestPDFCmd turns PDFs into transcripts
+var IngestPDFCmd = &cobra.Command{
+	Use:   "ingest-pdf <file.pdf...>",
+	Short: "Ingest PDFs (papers, books) as transcripts for fact extraction",
+	Long: `Extract the text of PDFs and save it as transcripts, so papers and books
+can become knowledge patches like videos.
+
+Text is extracted with poppler's pdftotext and split into paragraphs,
+each a transcript segment recording the page it starts on. Words
+hyphenated across lines are rejoined, paragraphs continued on the next
+page are merged, and running headers, footers and page numbers that
+repeat on most pages are dropped. With --pages each page becomes one
+segment instead, keeping the document's page structure. Title, author and
+creation date come from the PDF's metadata (pdfinfo), falling back to the
+file name.
+
+PDFs get a stable ID from their contents ("pdf-" and 12 hex digits) and
+are recorded in the manifest with a file:// URL; PDFs already ingested
+are skipped unless --force is given. With --extract the text is also sent
+to the backend for fact extraction; --strategy two-pass suits long papers
+and books. Scanned PDFs without a text layer need OCR first (e.g.
+ocrmypdf).
+
+Requirements:
+  - pdftotext and pdfinfo (poppler: apt install poppler-utils,
+    brew install poppler or choco install poppler)
+
+Examples:
+  vkm ingest-pdf papers/chinchilla.pdf
+  vkm ingest-pdf --pages --extract books/*.pdf
+
+` + nameTemplateHelp,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runIngestPDF,
+}
+
+var ingestPages bool
+
+func init() {
+	IngestPDFCmd.Flags().StringVarP(&ingestOutputDir, "output", "o", "data/transcripts", "Output directory for transcripts")
+	IngestPDFCmd.Flags().StringVar(&ingestNameTemplate, "name-template", defaultNameTemplate, "Go template for transcript file names")
+	IngestPDFCmd.Flags().StringVar(&ingestManifest, "manifest", "data/manifest.db", "SQLite manifest recording ingested documents")
+	IngestPDFCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	IngestPDFCmd.Flags().BoolVar(&ingestPages, "pages", false, "Make each page one segment instead of each paragraph")
+	IngestPDFCmd.Flags().BoolVar(&ingestExtract, "extract", false, "Send the text to the backend for fact extraction")
+	IngestPDFCmd.Flags().StringVarP(&pipelineBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	IngestPDFCmd.Flags().StringVar(&pipelineStrategy, "strategy", extractStrategySingle, "Fact extraction strategy with --extract (single, two-pass)")
+	IngestPDFCmd.Flags().BoolVar(&ingestForce, "force", false, "Ingest PDFs again even if the manifest has them")
+}
+
+func runIngestPDF(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	for _, tool := range []string{"pdftotext", "pdfinfo"} {
+		if _, err := findTool(tool); err != nil {
+			return err
+		}
+	}
+
+	if err := checkExtractStrategy(pipelineStrategy); err != nil {
+		return err
+	}
+	names, err := parseNameTemplate(ingestNameTemplate)
+	if err != nil {
+		return err
+	}
+	manifest, err := openManifest(ingestManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	ingested, skipped, failed := 0, 0, 0
+	for i, path := range args {
+		if ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("[%d/%d] %s\n", i+1, len(args), path)
+
+		id, err := pdfDocumentID(path)
+		if err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+			continue
+		}
+		if !ingestForce {
+			done, err := documentIngested(manifest, id, ingestExtract)
+			if err != nil {
+				return err
+			}
+			if done {
+				fmt.Printf("  ✓ Already ingested as %s\n", id)
+				skipped++
+				continue
+			}
+		}
+
+		doc, err := readPDF(ctx, path, ingestPages)
+		if err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+			continue
+		}
+		doc.ID = id
+		fmt.Printf("  %s\n", doc.Title)
+		if err := ingestDocument(ctx, manifest, doc, ingestOutputDir, names, ingestExtract); err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+			continue
+		}
+		ingested++
+	}
+
+	fmt.Printf("\nIngested %d PDFs", ingested)
+	if skipped > 0 {
+		fmt.Printf(", %d already ingested", skipped)
+	}
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+	}
+	fmt.Println()
+	return ctx.Err()
+}
+
+// pdfDocumentID derives a PDF's ID from its contents, so renamed or moved
+// copies are recognized
+func pdfDocumentID(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return documentID("pdf", hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// readPDF extracts a PDF's metadata and text blocks
+func readPDF(ctx context.Context, path string, byPage bool) (*ingestedDocument, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	doc := &ingestedDocument{
+		URL:   "file://" + filepath.ToSlash(abs),
+		Kind:  "pdf",
+		Title: strings.TrimSuffix(filepath.Base(abs), filepath.Ext(abs)),
+	}
+
+	info, err := pdfInfo(ctx, abs)
+	if err != nil {
+		return nil, err
+	}
+	if t := strings.TrimSpace(info["Title"]); t != "" {
+		doc.Title = t
+	}
+	doc.Author = strings.TrimSpace(info["Author"])
+	if t, ok := parseArticleTime(info["CreationDate"]); ok {
+		doc.Published = t
+	}
+
+	if doc.Blocks, err = pdfBlocks(ctx, abs, byPage); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// pdfBlocks extracts a PDF's text as paragraphs, or as pages with byPage
+func pdfBlocks(ctx context.Context, path string, byPage bool) ([]documentBlock, error) {
+	var out, stderr bytes.Buffer
+	c := toolCommand(ctx, "pdftotext", "-enc", "UTF-8", toolPath(path), "-")
+	c.Stdout, c.Stderr = &out, &stderr
+	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("pdftotext failed: %v: %s", err, lastLine(stderr.String()))
+	}
+
+	// pdftotext ends every page with a form feed
+	lines := pdfPageLines(strings.Split(strings.TrimSuffix(out.String(), "\f"), "\f"))
+	var blocks []documentBlock
+	if byPage {
+		blocks = pdfPageBlocks(lines)
+	} else {
+		blocks = pdfParagraphs(lines)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no text found (scanned PDFs need OCR first)")
+	}
+	return blocks, nil
+}
+
+// pdfInfo reads the key: value metadata pdfinfo prints
+func pdfInfo(ctx context.Context, path string) (map[string]string, error) {
+	var out, stderr bytes.Buffer
+	c := toolCommand(ctx, "pdfinfo", "-isodates", toolPath(path))
+	c.Stdout, c.Stderr = &out, &stderr
+	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("pdfinfo failed: %v: %s", err, lastLine(stderr.String()))
+	}
+
+	info := make(map[string]string)
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), ":"); ok {
+			info[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return info, nil
+}
+
+var digitsPattern = regexp.MustCompile(`\d+`)
+
+// pdfPageLines returns each page's trimmed lines, without the running
+// headers and footers (first or last lines that recur, page numbers
+// aside, on at least half of the pages) and bare page numbers
+func pdfPageLines(pages []string) [][]string {
+	lines := make([][]string, len(pages))
+	edges := make(map[string]int)
+	for i, page := range pages {
+		for _, line := range strings.Split(page, "\n") {
+			lines[i] = append(lines[i], strings.TrimSpace(strings.ReplaceAll(line, "\u00a0", " ")))
+		}
+		seen := make(map[string]bool)
+		for _, line := range pdfEdgeLines(lines[i]) {
+			if key := digitsPattern.ReplaceAllString(line, "#"); !seen[key] {
+				seen[key] = true
+				edges[key]++
+			}
+		}
+	}
+
+	running := make(map[string]bool)
+	if len(pages) >= 4 {
+		for key, n := range edges {
+			if n*2 >= len(pages) {
+				running[key] = true
+			}
+		}
+	}
+
+	for i := range lines {
+		kept := lines[i][:0]
+		for _, line := range lines[i] {
+			key := digitsPattern.ReplaceAllString(line, "#")
+			if key == "#" || running[key] {
+				continue
+			}
+			kept = append(kept, line)
+		}
+		// Blank lines around dropped footers must not split a paragraph
+		// running on to the next page
+		for len(kept) > 0 && kept[len(kept)-1] == "" {
+			kept = kept[:len(kept)-1]
+		}
+		lines[i] = kept
+	}
+	return lines
+}
+
+// pdfEdgeLines returns the first and last non-empty lines of a page
+func pdfEdgeLines(lines []string) []string {
+	var edges []string
+	for _, line := range lines {
+		if line != "" {
+			edges = append(edges, line)
+			break
+		}
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i] != "" {
+			edges = append(edges, lines[i])
+			break
+		}
+	}
+	return edges
+}
+
+// pdfParagraphs splits the lines of pages into paragraphs at blank lines,
+// rejoining hyphenated words and paragraphs that run on to the next page
+func pdfParagraphs(lines [][]string) []documentBlock {
+	var blocks []documentBlock
+	var current []string
+	start := 0
+	flush := func() {
+		if len(current) > 0 {
+			blocks = append(blocks, documentBlock{Text: joinPDFLines(current), Page: start})
+			current = nil
+		}
+	}
+
+	for i, page := range lines {
+		for _, line := range page {
+			if line == "" {
+				flush()
+				continue
+			}
+			if len(current) == 0 {
+				start = i + 1
+			}
+			current = append(current, line)
+		}
+		// A paragraph cut off mid-sentence continues on the next page
+		if len(current) > 0 && (endsSentence(current[len(current)-1]) || i+1 == len(lines) || !startsLower(firstLine(lines[i+1]))) {
+			flush()
+		}
+	}
+	flush()
+	return blocks
+}
+
+// pdfPageBlocks makes one block per page, keeping paragraph breaks
+func pdfPageBlocks(lines [][]string) []documentBlock {
+	var blocks []documentBlock
+	for i := range lines {
+		var paragraphs []string
+		for _, p := range pdfParagraphs(lines[i : i+1]) {
+			paragraphs = append(paragraphs, p.Text)
+		}
+		if len(paragraphs) > 0 {
+			blocks = append(blocks, documentBlock{Text: strings.Join(paragraphs, "\n\n"), Page: i + 1})
+		}
+	}
+	return blocks
+}
+
+// joinPDFLines joins a paragraph's lines, undoing end-of-line hyphenation
+// when the word continues in lowercase
+func joinPDFLines(lines []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			if strings.HasSuffix(prev, "-") && len(prev) > 1 && startsLower(line) {
+				s := b.String()
+				b.Reset()
+				b.WriteString(strings.TrimSuffix(s, "-"))
+			} else {
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// endsSentence reports whether a line ends a sentence
+func endsSentence(line string) bool {
+	return strings.HasSuffix(line, ".") || strings.HasSuffix(line, "?") || strings.HasSuffix(line, "!") ||
+		strings.HasSuffix(line, ":") || strings.HasSuffix(line, `."`) || strings.HasSuffix(line, ".”")
+}
+
+// startsLower reports whether s starts with a lowercase letter
+func startsLower(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLower(r)
+}
+
+// firstLine returns the first non-empty line
+func firstLine(lines []string) string {
+	for _, line := range lines {
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,402 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// IngestURLCmd turns web articles into transcripts
+var IngestURLCmd = &cobra.Command{
+	Use:   "ingest-url <article-url...|->",
+	Short: "Ingest web articles as transcripts for fact extraction",
+	Long: `Fetch web pages, extract their readable text and save it as transcripts,
+so written sources enter the same fact-extraction pipeline as videos.
+
+The article body is found the way reader modes find it: navigation,
+sidebars, comments and other boilerplate are dropped, and the block with
+the most paragraph text (and the fewest links) wins. Its paragraphs,
+headings, list items and quotes become the transcript's segments. Title,
+author, site name and publish date are read from the page's metadata into
+a .info.json beside it.
+
+Articles get a stable ID from their canonical URL ("web-" and 12 hex
+digits) and are recorded in the manifest; articles already ingested are
+skipped unless --force is given. With --extract the text is also sent to
+the backend for fact extraction, as 'vkm pipeline' does with transcripts.
+
+Examples:
+  vkm ingest-url https://example.com/blog/scaling-laws
+  vkm ingest-url --extract --from-file reading-list.txt
+  vkm ingest-url <url> --name-template '{{.ChannelSlug}}/{{.Date}}-{{.TitleSlug}}'
+
+` + urlListHelp + `
+
+` + nameTemplateHelp,
+	RunE: runIngestURL,
+}
+
+var (
+	ingestOutputDir    string
+	ingestNameTemplate string
+	ingestManifest     string
+	ingestExtract      bool
+	ingestForce        bool
+)
+
+func init() {
+	IngestURLCmd.Flags().StringVarP(&ingestOutputDir, "output", "o", "data/transcripts", "Output directory for transcripts")
+	IngestURLCmd.Flags().StringVar(&ingestNameTemplate, "name-template", defaultNameTemplate, "Go template for transcript file names")
+	IngestURLCmd.Flags().StringVar(&ingestManifest, "manifest", "data/manifest.db", "SQLite manifest recording ingested documents")
+	IngestURLCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	IngestURLCmd.Flags().BoolVar(&ingestExtract, "extract", false, "Send the text to the backend for fact extraction")
+	IngestURLCmd.Flags().StringVarP(&pipelineBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	IngestURLCmd.Flags().StringVar(&pipelineStrategy, "strategy", extractStrategySingle, "Fact extraction strategy with --extract (single, two-pass)")
+	IngestURLCmd.Flags().BoolVar(&ingestForce, "force", false, "Ingest articles again even if the manifest has them")
+	IngestURLCmd.Flags().StringVar(&urlListFile, "from-file", "", "Read more article URLs from this file, one per line (- for stdin)")
+}
+
+// maxArticleBytes caps how much of a page is read
+const maxArticleBytes = 10 << 20
+
+func runIngestURL(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	args, err := expandURLArgs(args)
+	if err != nil {
+		return err
+	}
+	if err := checkExtractStrategy(pipelineStrategy); err != nil {
+		return err
+	}
+	names, err := parseNameTemplate(ingestNameTemplate)
+	if err != nil {
+		return err
+	}
+	manifest, err := openManifest(ingestManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	ingested, skipped, failed := 0, 0, 0
+	for i, raw := range args {
+		if ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("[%d/%d] %s\n", i+1, len(args), raw)
+
+		doc, err := fetchArticle(ctx, raw)
+		if err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+			continue
+		}
+		if !ingestForce {
+			done, err := documentIngested(manifest, doc.ID, ingestExtract)
+			if err != nil {
+				return err
+			}
+			if done {
+				fmt.Printf("  ✓ Already ingested as %s\n", doc.ID)
+				skipped++
+				continue
+			}
+		}
+		fmt.Printf("  %s\n", orDefault(doc.Title, "(untitled)"))
+		if err := ingestDocument(ctx, manifest, doc, ingestOutputDir, names, ingestExtract); err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+			continue
+		}
+		ingested++
+	}
+
+	fmt.Printf("\nIngested %d articles", ingested)
+	if skipped > 0 {
+		fmt.Printf(", %d already ingested", skipped)
+	}
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+	}
+	fmt.Println()
+	return ctx.Err()
+}
+
+// fetchArticle downloads a web page and extracts its article text
+func fetchArticle(ctx context.Context, raw string) (*ingestedDocument, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid URL %q (use http or https)", raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch page (status %d)", resp.StatusCode)
+	}
+	if ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); ct != "" && ct != "text/html" && ct != "application/xhtml+xml" {
+		return nil, fmt.Errorf("not a web page (%s)", ct)
+	}
+
+	root, err := html.Parse(io.LimitReader(resp.Body, maxArticleBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page: %w", err)
+	}
+
+	// Redirects and canonical links give the same article one ID
+	doc := extractArticle(root, resp.Request.URL)
+	if len(doc.Blocks) == 0 {
+		return nil, fmt.Errorf("no readable text found")
+	}
+	doc.ID = documentID("web", doc.URL)
+	return doc, nil
+}
+
+// Elements that never hold article text
+var articleSkipTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Nav: true,
+	atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Form: true,
+	atom.Iframe: true, atom.Svg: true, atom.Button: true, atom.Select: true,
+	atom.Figure: true, atom.Template: true, atom.Dialog: true, atom.Menu: true,
+}
+
+// articleBoilerplate matches class and id values of page furniture
+var articleBoilerplate = regexp.MustCompile(`(?i)comment|sidebar|footer|masthead|navbar|menu|share|social|promo|related|recommend|advert|sponsor|cookie|consent|newsletter|subscribe|popup|modal|breadcrumb|byline-tools`)
+
+// Elements whose text becomes one block each
+var articleBlockTags = map[atom.Atom]bool{
+	atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Li: true, atom.Blockquote: true,
+	atom.Pre: true, atom.Dd: true, atom.Dt: true, atom.Figcaption: true,
+}
+
+// extractArticle reads the page metadata and the text blocks of the
+// element that most likely holds the article
+func extractArticle(root *html.Node, pageURL *url.URL) *ingestedDocument {
+	doc := &ingestedDocument{URL: pageURL.String(), Kind: "web", Site: strings.TrimPrefix(pageURL.Hostname(), "www.")}
+	readArticleMeta(root, pageURL, doc)
+	pruneBoilerplate(root)
+
+	// Score containers by the paragraph text they hold, as reader modes
+	// do: each paragraph credits its parent fully and its grandparent half
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	credit := func(n *html.Node, score float64) {
+		if _, ok := scores[n]; !ok {
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+	walkHTML(root, func(n *html.Node) bool {
+		if n.Type != html.ElementNode || (n.DataAtom != atom.P && n.DataAtom != atom.Pre) {
+			return true
+		}
+		text := nodeText(n)
+		if len(text) < 25 {
+			return false
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+		if p := n.Parent; p != nil {
+			credit(p, score)
+			if g := p.Parent; g != nil {
+				credit(g, score/2)
+			}
+		}
+		return false
+	})
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, n := range candidates {
+		score := scores[n] * (1 - linkDensity(n))
+		if n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+			score *= 1.25
+		}
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best == nil {
+		return doc
+	}
+
+	walkHTML(best, func(n *html.Node) bool {
+		if n.Type != html.ElementNode || !articleBlockTags[n.DataAtom] {
+			return true
+		}
+		text := nodeText(n)
+		// Short blocks that are mostly links are leftover navigation
+		if text != "" && (len(text) > 80 || linkDensity(n) < 0.5) {
+			doc.Blocks = append(doc.Blocks, documentBlock{Text: text})
+		}
+		return false
+	})
+	if len(doc.Blocks) > 0 && doc.Blocks[0].Text == doc.Title {
+		doc.Blocks = doc.Blocks[1:]
+	}
+	return doc
+}
+
+// readArticleMeta fills doc from <title>, <meta>, <link rel=canonical>,
+// the first <time datetime> and <html lang>
+func readArticleMeta(root *html.Node, pageURL *url.URL, doc *ingestedDocument) {
+	meta := make(map[string]string)
+	var title, timeAttr string
+	walkHTML(root, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		switch n.DataAtom {
+		case atom.Html:
+			doc.Language = htmlAttr(n, "lang")
+		case atom.Title:
+			if title == "" {
+				title = nodeText(n)
+			}
+		case atom.Meta:
+			key := strings.ToLower(orDefault(htmlAttr(n, "property"), htmlAttr(n, "name")))
+			if key != "" && meta[key] == "" {
+				meta[key] = strings.TrimSpace(htmlAttr(n, "content"))
+			}
+		case atom.Link:
+			if strings.EqualFold(htmlAttr(n, "rel"), "canonical") {
+				if u, err := pageURL.Parse(htmlAttr(n, "href")); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+					doc.URL = u.String()
+				}
+			}
+		case atom.Time:
+			if timeAttr == "" {
+				timeAttr = htmlAttr(n, "datetime")
+			}
+		}
+		return true
+	})
+
+	doc.Title = orDefault(meta["og:title"], title)
+	doc.Author = orDefault(meta["author"], meta["article:author"])
+	if strings.HasPrefix(doc.Author, "http") {
+		doc.Author = ""
+	}
+	doc.Site = orDefault(meta["og:site_name"], doc.Site)
+	for _, v := range []string{meta["article:published_time"], meta["date"], meta["dc.date"], timeAttr} {
+		if t, ok := parseArticleTime(v); ok {
+			doc.Published = t
+			break
+		}
+	}
+}
+
+// parseArticleTime accepts the date formats pages commonly publish
+func parseArticleTime(v string) (time.Time, bool) {
+	v = strings.TrimSpace(v)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05Z07", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// pruneBoilerplate removes elements that never hold article text, and
+// those whose class or id names page furniture
+func pruneBoilerplate(root *html.Node) {
+	var remove []*html.Node
+	walkHTML(root, func(n *html.Node) bool {
+		if n.Type == html.CommentNode {
+			remove = append(remove, n)
+			return false
+		}
+		if n.Type != html.ElementNode || n.DataAtom == atom.Body || n.DataAtom == atom.Html {
+			return true
+		}
+		hint := htmlAttr(n, "class") + " " + htmlAttr(n, "id")
+		if articleSkipTags[n.DataAtom] || htmlAttr(n, "hidden") != "" || strings.EqualFold(htmlAttr(n, "aria-hidden"), "true") ||
+			(n.DataAtom != atom.Article && n.DataAtom != atom.Main && articleBoilerplate.MatchString(hint)) {
+			remove = append(remove, n)
+			return false
+		}
+		return true
+	})
+	for _, n := range remove {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+// walkHTML visits n and its descendants depth first; visit returns
+// whether to descend into a node
+func walkHTML(n *html.Node, visit func(*html.Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		walkHTML(c, visit)
+		c = next
+	}
+}
+
+var spacePattern = regexp.MustCompile(`\s+`)
+
+// nodeText is the text under n with whitespace collapsed
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	walkHTML(n, func(c *html.Node) bool {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		} else if c.Type == html.ElementNode && c.DataAtom == atom.Br {
+			b.WriteString(" ")
+		}
+		return true
+	})
+	return strings.TrimSpace(spacePattern.ReplaceAllString(b.String(), " "))
+}
+
+// linkDensity is the share of n's text inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	walkHTML(n, func(c *html.Node) bool {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			linked += len(nodeText(c))
+			return false
+		}
+		return true
+	})
+	return float64(linked) / float64(total)
+}
+
+// htmlAttr returns the value of n's attribute key, or ""
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// jobPhasesHelp describes the metadata and audio phases for serve modes'
+// --help
+const jobPhasesHelp = `Jobs run in two phases. --metadata-workers look up each queued video's
+title and duration, several at once: YouTube videos with the Data API
+(one unit of quota each, with YOUTUBE_API_KEY), or, without a key or
+once the day's quota is spent, with YouTube's oEmbed endpoint, which
+gives the title only; videos on other sites with a metadata-only yt-dlp
+call. The worker only downloads and processes videos whose metadata has
+been fetched (a video that can't be described goes on with none). With
+--audio-budget, the audio a day's jobs download is capped: a job starts
+only while its duration fits in what is left of the day's budget, so
+shorter videos may go ahead of a long one that has to wait for the next
+day. The first job of a day always starts, and videos of unknown
+duration aren't held back. --sleep-between waits that long after each
+job before downloading the next. --metadata-workers 0 turns the metadata
+phase off and jobs are processed in order.
+
+The two phases are two queues kept in the jobs table: a job waits for
+its metadata until it has some, then for its download. Keeping both in
+one table gives a job one ID and one state for the API to report
+throughout, and moves it from one queue to the next in the same write
+that records its metadata.`
+
+// metadataClaimTimeout is how long a metadata lookup may hold a job
+// before another worker takes it over, as after a crash
+const metadataClaimTimeout = 5 * time.Minute
+
+var (
+	serveMetadataWorkers int
+	serveAudioBudget     time.Duration
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{ServeAPICmd, ServeWebhooksCmd} {
+		cmd.Flags().IntVar(&serveMetadataWorkers, "metadata-workers", 4, "Parallel metadata lookups ahead of downloads (0 disables the metadata phase)")
+		cmd.Flags().DurationVar(&serveAudioBudget, "audio-budget", 0, "Most audio to download per day (e.g. 8h; 0 for no limit)")
+		cmd.Flags().DurationVar(&downloadSleepBetween, "sleep-between", 0, "Time to wait after each job before the next download (e.g. 5s)")
+	}
+}
+
+// isInternalJob reports whether job is one the worker queues itself
+// (enrichment, motive analysis, snapshots) rather than a URL to download
+func isInternalJob(job *Job) bool {
+	return isEnrichJob(job) || isMotivesJob(job) || isSnapshotJob(job)
+}
+
+// ClaimMetadataJob takes the oldest queued job whose metadata hasn't been
+// fetched and returns it, or nil when there is none. The job stays queued;
+// a claim older than stale is taken over by the next caller.
+func (m *Manifest) ClaimMetadataJob(stale time.Duration) (*Job, error) {
+	var job *Job
+	now := time.Now().UTC()
+	err := m.write(func(tx *sql.Tx) error {
+		var err error
+		job, err = scanJob(tx.QueryRow(`
+			UPDATE jobs SET metadata_claimed_at = ?
+			WHERE id = (SELECT id FROM jobs
+				WHERE state = ? AND metadata_at IS NULL AND url NOT LIKE 'vkm:%'
+					AND (metadata_claimed_at IS NULL OR metadata_claimed_at < ?)
+				ORDER BY id LIMIT 1)
+			RETURNING `+jobColumns,
+			now, JobQueued, now.Add(-stale)))
+		if errors.Is(err, sql.ErrNoRows) {
+			job = nil
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job metadata: %w", err)
+	}
+	return job, nil
+}
+
+// RecordJobMetadata records the metadata fetched for a job, which lets
+// the audio phase claim it. Unknown titles and durations are passed as
+// zero values.
+func (m *Manifest) RecordJobMetadata(id int64, title string, duration time.Duration) error {
+	return m.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE jobs SET title = NULLIF(?, ''), duration = NULLIF(?, 0), metadata_at = ?
+			WHERE id = ?`,
+			title, duration.Seconds(), time.Now().UTC(), id)
+		if err != nil {
+			return fmt.Errorf("failed to record metadata of job %d: %w", id, err)
+		}
+		return nil
+	})
+}
+
+// AudioUsedSince returns the duration of the videos of jobs started since
+// since, as far as their metadata knows it
+func (m *Manifest) AudioUsedSince(since time.Time) (time.Duration, error) {
+	var seconds float64
+	err := m.db.QueryRow(`
+		SELECT COALESCE(SUM(duration), 0) FROM jobs
+		WHERE started_at >= ? AND state != ? AND url NOT LIKE 'vkm:%'`,
+		since.UTC(), JobQueued).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum audio downloaded: %w", err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// ClaimAudioJob claims the oldest queued job that is ready to download:
+// its metadata has been fetched and its duration is at most remaining
+// (negative for no limit). Internal jobs are always ready.
+func (m *Manifest) ClaimAudioJob(remaining time.Duration) (*Job, error) {
+	where := "url LIKE 'vkm:%' OR (metadata_at IS NOT NULL"
+	var args []interface{}
+	if remaining >= 0 {
+		where += " AND COALESCE(duration, 0) <= ?"
+		args = append(args, remaining.Seconds())
+	}
+	return m.claimJob(where+")", "id", args...)
+}
+
+// claimPhasedJob claims the next job for the audio phase, keeping to
+// --audio-budget for the current day
+func claimPhasedJob(m *Manifest) (*Job, error) {
+	if serveAudioBudget <= 0 {
+		return m.ClaimAudioJob(-1)
+	}
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	used, err := m.AudioUsedSince(day)
+	if err != nil {
+		return nil, err
+	}
+	if used == 0 {
+		// A video longer than the whole budget would otherwise never run
+		return m.ClaimAudioJob(-1)
+	}
+	return m.ClaimAudioJob(max(serveAudioBudget-used, 0))
+}
+
+// claimServeJob claims the next job for the worker: through the audio
+// phase when the metadata phase is on, in order otherwise
+func claimServeJob(m *Manifest) (*Job, error) {
+	if serveMetadataWorkers <= 0 {
+		return m.ClaimNextJob()
+	}
+	return claimPhasedJob(m)
+}
+
+// startMetadataWorkers starts --metadata-workers goroutines fetching the
+// metadata of queued jobs until ctx is done
+func startMetadataWorkers(ctx context.Context, m *Manifest) error {
+	if serveMetadataWorkers < 0 {
+		return fmt.Errorf("--metadata-workers must not be negative")
+	}
+	if serveAudioBudget < 0 {
+		return fmt.Errorf("--audio-budget must not be negative")
+	}
+	if downloadSleepBetween < 0 {
+		return fmt.Errorf("--sleep-between must not be negative")
+	}
+	if serveMetadataWorkers == 0 {
+		if serveAudioBudget > 0 {
+			return fmt.Errorf("--audio-budget needs the metadata phase (--metadata-workers above 0)")
+		}
+		return nil
+	}
+	var client *youtubeDataClient
+	if key := youtubeAPIKey(); key != "" {
+		var err error
+		if client, err = newYouTubeDataClient(ctx, key, m); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < serveMetadataWorkers; i++ {
+		go runMetadataWorker(ctx, m, client)
+	}
+	fmt.Printf("Metadata phase: %d worker(s)", serveMetadataWorkers)
+	if serveAudioBudget > 0 {
+		fmt.Printf(", audio budget %s per day", serveAudioBudget)
+	}
+	fmt.Println()
+	return nil
+}
+
+// runMetadataWorker fetches the metadata of queued jobs one at a time
+// until ctx is done. client looks up YouTube videos; nil for none.
+func runMetadataWorker(ctx context.Context, m *Manifest, client *youtubeDataClient) {
+	for {
+		job, err := m.ClaimMetadataJob(metadataClaimTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(2 * time.Second):
+				continue
+			}
+		}
+
+		title, duration, err := lookupJobMetadata(ctx, client, job.URL)
+		if err != nil {
+			// Interrupted; the claim lapses and the next start retries
+			return
+		}
+		if err := m.RecordJobMetadata(job.ID, title, duration); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			continue
+		}
+		switch {
+		case duration > 0:
+			fmt.Printf("Job %d: %s (%s)\n", job.ID, orDefault(title, job.URL), formatVideoOffset(duration.Seconds()))
+		case title != "":
+			fmt.Printf("Job %d: %s (duration unknown)\n", job.ID, title)
+		default:
+			fmt.Printf("Job %d: metadata unknown, downloading without it\n", job.ID)
+		}
+	}
+}
+
+// lookupJobMetadata returns the title and duration of the video at url,
+// as far as they can be found: YouTube videos are looked up with client,
+// falling back to the oEmbed endpoint without it or its quota, and only
+// other sites' videos with yt-dlp. The error is ctx's, when interrupted.
+func lookupJobMetadata(ctx context.Context, client *youtubeDataClient, url string) (string, time.Duration, error) {
+	if siteForURL(url) != siteYouTube {
+		items := []pipelineItem{{URL: url}}
+		if err := fillVideoDetails(ctx, items); err != nil {
+			return "", 0, err
+		}
+		return items[0].Title, items[0].Duration, nil
+	}
+
+	videoID := videoIDFromURL(url)
+	if videoID == "" {
+		return "", 0, ctx.Err()
+	}
+	if client != nil {
+		details, err := client.VideoDetails(ctx, []string{videoID})
+		if ctx.Err() != nil {
+			return "", 0, ctx.Err()
+		}
+		if err == nil {
+			d := details[videoID]
+			return d.Title, d.Duration, nil
+		}
+		if !errors.Is(err, errQuotaExhausted) {
+			fmt.Fprintf(os.Stderr, "Warning: %v; looking up the title only\n", err)
+		}
+	}
+	title, err := fetchYouTubeTitle(videoID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to look up %s: %v\n", url, err)
+	}
+	return title, 0, ctx.Err()
+}
@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Job states recorded in the manifest
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// Job is a queued pipeline run for one URL, submitted by a serve mode
+type Job struct {
+	ID         int64      `json:"id"`
+	URL        string     `json:"url"`
+	Origin     string     `json:"origin"`
+	State      string     `json:"state"`
+	PatchID    string     `json:"patch_id,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Title, Duration (in seconds) and MetadataAt are set by the metadata
+	// phase, ahead of the download
+	Title      string     `json:"title,omitempty"`
+	Duration   float64    `json:"duration,omitempty"`
+	MetadataAt *time.Time `json:"metadata_at,omitempty"`
+}
+
+const jobColumns = `id, url, origin, state, COALESCE(patch_id, ''), COALESCE(error, ''),
+	created_at, started_at, finished_at, COALESCE(title, ''), COALESCE(duration, 0), metadata_at`
+
+func scanJob(row interface{ Scan(...interface{}) error }) (*Job, error) {
+	var job Job
+	var started, finished, metadata sql.NullTime
+	err := row.Scan(&job.ID, &job.URL, &job.Origin, &job.State, &job.PatchID, &job.Error,
+		&job.CreatedAt, &started, &finished, &job.Title, &job.Duration, &metadata)
+	if err != nil {
+		return nil, err
+	}
+	if started.Valid {
+		job.StartedAt = &started.Time
+	}
+	if finished.Valid {
+		job.FinishedAt = &finished.Time
+	}
+	if metadata.Valid {
+		job.MetadataAt = &metadata.Time
+	}
+	return &job, nil
+}
+
+// EnqueueJob queues url for processing unless it is already queued or
+// running, returning the job that covers it
+func (m *Manifest) EnqueueJob(url, origin string) (*Job, error) {
+	var job *Job
+	err := m.write(func(tx *sql.Tx) error {
+		existing, err := scanJob(tx.QueryRow(
+			"SELECT "+jobColumns+" FROM jobs WHERE url = ? AND state IN (?, ?) ORDER BY id LIMIT 1",
+			url, JobQueued, JobRunning))
+		if err == nil {
+			job = existing
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		job, err = scanJob(tx.QueryRow(
+			"INSERT INTO jobs (url, origin, state, created_at) VALUES (?, ?, ?, ?) RETURNING "+jobColumns,
+			url, origin, JobQueued, time.Now().UTC()))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return job, nil
+}
+
+// ClaimNextJob marks the oldest queued job as running and returns it, or
+// nil when the queue is empty
+func (m *Manifest) ClaimNextJob() (*Job, error) {
+	return m.claimJob("", "id")
+}
+
+// claimJob marks the first queued job matching where (an SQL condition,
+// or "" for any), in order, as running and returns it, or nil when none
+// matches
+func (m *Manifest) claimJob(where, order string, args ...interface{}) (*Job, error) {
+	query := "SELECT id FROM jobs WHERE state = ?"
+	if where != "" {
+		query += " AND (" + where + ")"
+	}
+	query += " ORDER BY " + order + " LIMIT 1"
+
+	var job *Job
+	err := m.write(func(tx *sql.Tx) error {
+		var err error
+		job, err = scanJob(tx.QueryRow(`
+			UPDATE jobs SET state = ?, started_at = ?
+			WHERE id = (`+query+`)
+			RETURNING `+jobColumns,
+			append([]interface{}{JobRunning, time.Now().UTC(), JobQueued}, args...)...))
+		if errors.Is(err, sql.ErrNoRows) {
+			job = nil
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return job, nil
+}
+
+// FinishJob records the outcome of a running job
+func (m *Manifest) FinishJob(id int64, state, patchID, errMsg string) error {
+	return m.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE jobs SET state = ?, patch_id = NULLIF(?, ''), error = NULLIF(?, ''), finished_at = ?
+			WHERE id = ?`,
+			state, patchID, errMsg, time.Now().UTC(), id)
+		if err != nil {
+			return fmt.Errorf("failed to finish job %d: %w", id, err)
+		}
+		return nil
+	})
+}
+
+// GetJob returns a job by ID, or nil if it does not exist
+func (m *Manifest) GetJob(id int64) (*Job, error) {
+	job, err := scanJob(m.db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job %d: %w", id, err)
+	}
+	return job, nil
+}
+
+// ListJobs returns the most recent jobs, optionally filtered by state
+func (m *Manifest) ListJobs(state string, limit int) ([]*Job, error) {
+	query := "SELECT " + jobColumns + " FROM jobs"
+	var args []interface{}
+	if state != "" {
+		query += " WHERE state = ?"
+		args = append(args, state)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list jobs: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// RequestJobCancel cancels a job. Queued jobs are canceled immediately;
+// running jobs are flagged so the worker processing them can stop. It
+// returns the job's state after the request.
+func (m *Manifest) RequestJobCancel(id int64) (string, error) {
+	var state string
+	err := m.write(func(tx *sql.Tx) error {
+		err := tx.QueryRow("SELECT state FROM jobs WHERE id = ?", id).Scan(&state)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("job %d not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read job %d: %w", id, err)
+		}
+
+		switch state {
+		case JobQueued:
+			_, err = tx.Exec("UPDATE jobs SET state = ?, finished_at = ? WHERE id = ?",
+				JobCanceled, time.Now().UTC(), id)
+			state = JobCanceled
+		case JobRunning:
+			_, err = tx.Exec("UPDATE jobs SET cancel_requested = 1 WHERE id = ?", id)
+		default:
+			return fmt.Errorf("job %d already %s", id, state)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to cancel job %d: %w", id, err)
+		}
+		return nil
+	})
+	return state, err
+}
+
+// JobCancelRequested reports whether cancellation was requested for a
+// running job
+func (m *Manifest) JobCancelRequested(id int64) (bool, error) {
+	var requested bool
+	err := m.db.QueryRow("SELECT cancel_requested FROM jobs WHERE id = ?", id).Scan(&requested)
+	if err != nil {
+		return false, fmt.Errorf("failed to read job %d: %w", id, err)
+	}
+	return requested, nil
+}
+
+// RequeueJob puts a running job back on the queue, for work interrupted by
+// a server shutdown rather than a cancel request
+func (m *Manifest) RequeueJob(id int64) error {
+	return m.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE jobs SET state = ?, started_at = NULL WHERE id = ? AND state = ?",
+			JobQueued, id, JobRunning)
+		if err != nil {
+			return fmt.Errorf("failed to requeue job %d: %w", id, err)
+		}
+		return nil
+	})
+}
+
+// DeleteJob removes a job that is not currently running
+func (m *Manifest) DeleteJob(id int64) error {
+	return m.write(func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM jobs WHERE id = ? AND state != ?", id, JobRunning)
+		if err != nil {
+			return fmt.Errorf("failed to delete job %d: %w", id, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("job %d not found or still running", id)
+		}
+		return nil
+	})
+}
+
+// JobCounts returns the number of jobs per origin and state
+func (m *Manifest) JobCounts() (map[string]map[string]int, error) {
+	rows, err := m.db.Query("SELECT origin, state, COUNT(*) FROM jobs GROUP BY origin, state")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count jobs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]map[string]int)
+	for rows.Next() {
+		var origin, state string
+		var n int
+		if err := rows.Scan(&origin, &state, &n); err != nil {
+			return nil, fmt.Errorf("failed to count jobs: %w", err)
+		}
+		if counts[origin] == nil {
+			counts[origin] = make(map[string]int)
+		}
+		counts[origin][state] = n
+	}
+	return counts, rows.Err()
+}
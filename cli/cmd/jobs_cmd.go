@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// JobsCmd inspects and manages the serve job queue
+var JobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Inspect and manage queued pipeline jobs",
+	Long: `Inspect and manage the pipeline jobs queued by 'vkm serve' modes.
+
+Examples:
+  vkm jobs list --state running
+  vkm jobs cancel 42`,
+}
+
+// JobsListCmd lists recent jobs
+var JobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recent jobs",
+	RunE:  runJobsList,
+}
+
+// JobsCancelCmd cancels a queued or running job
+var JobsCancelCmd = &cobra.Command{
+	Use:   "cancel [job-id]",
+	Short: "Cancel a queued or running job",
+	Long: `Cancel a job. Queued jobs are canceled immediately. Running jobs are
+flagged in the manifest; the worker processing them stops within a few
+seconds, removes partial downloads and transcripts, and marks the job
+canceled.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runJobsCancel,
+}
+
+var (
+	jobsManifest string
+	jobsState    string
+	jobsLimit    int
+)
+
+func init() {
+	JobsCmd.AddCommand(JobsListCmd)
+	JobsCmd.AddCommand(JobsCancelCmd)
+
+	JobsCmd.PersistentFlags().StringVar(&jobsManifest, "manifest", "data/manifest.db", "SQLite manifest holding the job queue")
+
+	JobsListCmd.Flags().StringVar(&jobsState, "state", "", "Only show jobs in this state")
+	JobsListCmd.Flags().IntVar(&jobsLimit, "limit", 50, "Maximum jobs to show")
+}
+
+func runJobsList(cmd *cobra.Command, args []string) error {
+	manifest, err := openManifest(jobsManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	jobs, err := manifest.ListJobs(jobsState, jobsLimit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tORIGIN\tURL\tCREATED")
+	for _, job := range jobs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+			job.ID, job.State, job.Origin, job.URL, job.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+func runJobsCancel(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid job id %q", args[0])
+	}
+
+	manifest, err := openManifest(jobsManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	state, err := manifest.RequestJobCancel(id)
+	if err != nil {
+		return err
+	}
+
+	if state == JobCanceled {
+		fmt.Printf("✓ Job %d canceled\n", id)
+	} else {
+		fmt.Printf("✓ Cancellation requested for running job %d\n", id)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Output layouts (--layout)
+const (
+	// layoutFlat names every file of a video after it, side by side:
+	// <name>.mp3, <name>.info.json
+	layoutFlat = "flat"
+	// layoutPerVideo gives each video its own directory with fixed file
+	// names: <name>/audio.mp3, <name>/info.json
+	layoutPerVideo = "per-video"
+)
+
+// File names of a video's artifacts in the per-video layout, without
+// extensions where they vary
+const (
+	perVideoAudio       = "audio"
+	perVideoInfo        = "info.json"
+	perVideoTranscript  = "transcript"
+	perVideoThumbnail   = "thumbnail"
+	perVideoDescription = "description.txt"
+)
+
+// layoutHelp documents --layout for command help text
+const layoutHelp = `Layout:
+By default (--layout flat) a video's files sit side by side in the
+output directory, named by --name-template. With --layout per-video each
+video gets a directory named by the template (the video ID by default)
+holding all of its artifacts under fixed names:
+  <video-id>/audio.mp3, <video-id>/info.json, <video-id>/thumbnail.jpg,
+  <video-id>/description.txt, <video-id>/transcript.json
+Transcripts from captions are saved there too, instead of --transcripts.
+Deleting a directory removes everything vkm knows about the video.`
+
+// outputLayout is the --layout of the download and pipeline commands
+var outputLayout string
+
+// setLayout selects the output layout files are named for
+func (t *nameTemplate) setLayout(layout string) error {
+	switch layout {
+	case "", layoutFlat:
+		t.perVideo = false
+	case layoutPerVideo:
+		t.perVideo = true
+	default:
+		return fmt.Errorf("unknown --layout %q (use %s or %s)", layout, layoutFlat, layoutPerVideo)
+	}
+	return nil
+}
+
+// isPerVideoFile reports whether path is a per-video artifact with the
+// given stem (audio.mp3 for perVideoAudio)
+func isPerVideoFile(path, stem string) bool {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name)) == stem
+}
+
+// infoPathFor returns the info.json belonging to a video's audio or
+// transcript in either layout
+func infoPathFor(path string) string {
+	if isPerVideoFile(path, perVideoAudio) || isPerVideoFile(path, perVideoTranscript) {
+		return filepath.Join(filepath.Dir(path), perVideoInfo)
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".info.json"
+}
+
+// claimDir resolves collisions for a per-video directory: if it already
+// belongs to another video, "-<id>" is appended
+func claimDir(dir, videoID string) string {
+	info, err := loadVideoMetadata(filepath.Join(dir, perVideoInfo))
+	if err != nil {
+		return dir
+	}
+	if id, _ := info["id"].(string); id == "" || id == videoID {
+		return dir
+	}
+	return dir + "-" + videoID
+}
+
+// applyPerVideoLayout moves a download and its sidecars into the video's
+// directory dir/name, updating media in place
+func applyPerVideoLayout(dir, name string, media *downloadedMedia) error {
+	itemDir := claimDir(filepath.Join(dir, name), media.VideoID)
+	if err := os.MkdirAll(itemDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	stem := perVideoAudio
+	if media.Captions {
+		stem = perVideoTranscript
+	}
+	moves := []struct {
+		path *string
+		name string
+	}{
+		{&media.Path, stem + filepath.Ext(media.Path)},
+		{&media.InfoPath, perVideoInfo},
+		{&media.ThumbnailPath, perVideoThumbnail + filepath.Ext(media.ThumbnailPath)},
+		{&media.DescriptionPath, perVideoDescription},
+	}
+	for _, m := range moves {
+		if *m.path == "" {
+			continue
+		}
+		newPath := filepath.Join(itemDir, m.name)
+		if newPath == *m.path {
+			continue
+		}
+		if err := os.Rename(*m.path, newPath); err != nil {
+			return fmt.Errorf("failed to move %s: %w", *m.path, err)
+		}
+		*m.path = newPath
+	}
+	return nil
+}
+
+// findPerVideoSidecars fills in the thumbnail and description in the
+// directory of a per-video info.json
+func findPerVideoSidecars(media *downloadedMedia) {
+	dir := filepath.Dir(media.InfoPath)
+	if path := filepath.Join(dir, perVideoDescription); fileExists(path) {
+		media.DescriptionPath = path
+	}
+	for _, ext := range thumbnailExtensions {
+		if path := filepath.Join(dir, perVideoThumbnail+ext); fileExists(path) {
+			media.ThumbnailPath = path
+			break
+		}
+	}
+}
+
+// captionDir is where transcripts from captions are saved: transcriptDir,
+// or the video's directory under videoDir in the per-video layout
+func captionDir(names *nameTemplate, transcriptDir, videoDir string) string {
+	if names.perVideo {
+		return videoDir
+	}
+	return transcriptDir
+}
@@ -0,0 +1,472 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// LicensesCmd records the licenses of the sources behind local patches
+var LicensesCmd = &cobra.Command{
+	Use:   "licenses",
+	Short: "Record and summarize the licenses of patch sources",
+	Long: `Record the license or terms of use of the source behind each local patch
+under --data in the patch's metadata (source-license), and summarize them.
+
+Licenses come from, in order of precedence:
+  1. rules in --config matching the patch's source ID or source URL
+  2. for YouTube sources, the Data API's status.license with
+     YOUTUBE_API_KEY set (1 quota unit per 50 videos), else yt-dlp's
+     metadata; videos without a Creative Commons license are under the
+     Standard YouTube License
+
+'vkm pipeline' records the license yt-dlp reports at download time, and
+'vkm check-sources' refreshes it along with availability. Sources with a
+recorded license are not looked up again unless --recheck is given;
+licenses set by --config always win.
+
+Known licenses, and whether they allow sharing derived facts and
+commercial use:
+  cc0, public-domain       derivatives, commercial
+  cc-by, cc-by-sa          derivatives, commercial
+  cc-by-nc, cc-by-nc-sa    derivatives, non-commercial only
+  cc-by-nd, cc-by-nc-nd    no derivatives
+  youtube-standard         no derivatives (all rights reserved)
+  all-rights-reserved      no derivatives
+
+The config file lists rules; other license names need derivatives and
+commercial set:
+
+  sources:
+    - source: dQw4w9WgXcQ
+      license: cc-by-nc
+    - url: https://example.com/papers/
+      license: example-terms
+      terms: Quotes allowed with attribution, no redistribution
+      derivatives: false
+      commercial: false
+
+'vkm export --exclude-nonderivable' leaves out patches whose source
+forbids derivative works, and export warns about restrictive licenses.
+
+Examples:
+  vkm licenses
+  vkm licenses --config data/licenses.yaml --recheck`,
+	RunE: runLicenses,
+}
+
+var (
+	licensesDataDir  string
+	licensesManifest string
+	licensesConfig   string
+	licensesRecheck  bool
+)
+
+func init() {
+	LicensesCmd.Flags().StringVar(&licensesDataDir, "data", "data", "Directory holding local patches")
+	LicensesCmd.Flags().StringVar(&licensesManifest, "manifest", "data/manifest.db", "SQLite manifest of downloads and API quota")
+	LicensesCmd.Flags().StringVar(&licensesConfig, "config", defaultLicenseConfig, "YAML file assigning licenses to sources")
+	LicensesCmd.Flags().BoolVar(&licensesRecheck, "recheck", false, "Look up licenses again even if already recorded")
+}
+
+// defaultLicenseConfig is where license rules are read from; a missing
+// file means no rules
+const defaultLicenseConfig = "data/licenses.yaml"
+
+// metaSourceLicense is the patch metadata key holding the source's license
+const metaSourceLicense = "source-license"
+
+// Where a license was learned
+const (
+	licenseViaConfig     = "config"
+	licenseViaYouTubeAPI = "youtube-api"
+	licenseViaYtDlp      = "yt-dlp"
+)
+
+// sourceLicense is the license or terms of use of a patch's source
+type sourceLicense struct {
+	ID string
+	// Terms is the license as the source states it, or notes from the
+	// config
+	Terms string
+	// Derivatives is whether derived works, extracted facts included, may
+	// be shared
+	Derivatives bool
+	Commercial  bool
+	From        string
+}
+
+// knownLicenses are the licenses recognized by name
+var knownLicenses = map[string]sourceLicense{
+	"cc0":                 {ID: "cc0", Terms: "CC0 public domain dedication", Derivatives: true, Commercial: true},
+	"public-domain":       {ID: "public-domain", Terms: "Public domain", Derivatives: true, Commercial: true},
+	"cc-by":               {ID: "cc-by", Terms: "Creative Commons Attribution", Derivatives: true, Commercial: true},
+	"cc-by-sa":            {ID: "cc-by-sa", Terms: "Creative Commons Attribution-ShareAlike", Derivatives: true, Commercial: true},
+	"cc-by-nc":            {ID: "cc-by-nc", Terms: "Creative Commons Attribution-NonCommercial", Derivatives: true},
+	"cc-by-nc-sa":         {ID: "cc-by-nc-sa", Terms: "Creative Commons Attribution-NonCommercial-ShareAlike", Derivatives: true},
+	"cc-by-nd":            {ID: "cc-by-nd", Terms: "Creative Commons Attribution-NoDerivatives", Commercial: true},
+	"cc-by-nc-nd":         {ID: "cc-by-nc-nd", Terms: "Creative Commons Attribution-NonCommercial-NoDerivatives"},
+	"youtube-standard":    {ID: "youtube-standard", Terms: "Standard YouTube License"},
+	"all-rights-reserved": {ID: "all-rights-reserved", Terms: "All rights reserved"},
+}
+
+// Restrictive reports whether the license limits derived works or
+// commercial use
+func (l sourceLicense) Restrictive() bool {
+	return !l.Derivatives || !l.Commercial
+}
+
+// Summary describes what the license allows
+func (l sourceLicense) Summary() string {
+	switch {
+	case !l.Derivatives:
+		return "no derivatives"
+	case !l.Commercial:
+		return "non-commercial only"
+	default:
+		return "derivatives, commercial"
+	}
+}
+
+// metadata is the license as stored in patch metadata
+func (l sourceLicense) metadata() map[string]interface{} {
+	m := map[string]interface{}{
+		"id":          l.ID,
+		"derivatives": l.Derivatives,
+		"commercial":  l.Commercial,
+		"from":        l.From,
+	}
+	if l.Terms != "" {
+		m["terms"] = l.Terms
+	}
+	return m
+}
+
+// patchLicense returns the license recorded in p's metadata
+func patchLicense(p *Patch) (sourceLicense, bool) {
+	m, ok := p.Metadata[metaSourceLicense].(map[string]interface{})
+	if !ok {
+		return sourceLicense{}, false
+	}
+	var l sourceLicense
+	l.ID, _ = m["id"].(string)
+	l.Terms, _ = m["terms"].(string)
+	l.Derivatives, _ = m["derivatives"].(bool)
+	l.Commercial, _ = m["commercial"].(bool)
+	l.From, _ = m["from"].(string)
+	return l, l.ID != ""
+}
+
+// setPatchLicense records l in p's metadata, reporting whether it changed.
+// Licenses from the config are only replaced by the config.
+func setPatchLicense(p *Patch, l sourceLicense) bool {
+	if prev, ok := patchLicense(p); ok {
+		if prev == l || (prev.From == licenseViaConfig && l.From != licenseViaConfig) {
+			return false
+		}
+	}
+	if p.Metadata == nil {
+		p.Metadata = make(map[string]interface{})
+	}
+	p.Metadata[metaSourceLicense] = l.metadata()
+	return true
+}
+
+// licenseFromYouTube maps the Data API's status.license
+func licenseFromYouTube(value string) (sourceLicense, bool) {
+	var l sourceLicense
+	switch value {
+	case "creativeCommon":
+		l = knownLicenses["cc-by"]
+	case "youtube":
+		l = knownLicenses["youtube-standard"]
+	default:
+		return l, false
+	}
+	l.From = licenseViaYouTubeAPI
+	return l, true
+}
+
+// licenseFromYtDlp maps the license field of yt-dlp metadata. yt-dlp
+// leaves it out for YouTube videos under the standard license.
+func licenseFromYtDlp(raw, extractor string) (sourceLicense, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		if !strings.EqualFold(extractor, "youtube") {
+			return sourceLicense{}, false
+		}
+		l := knownLicenses["youtube-standard"]
+		l.From = licenseViaYtDlp
+		return l, true
+	}
+
+	l, ok := knownLicenses[parseLicenseName(raw)]
+	if !ok {
+		return sourceLicense{}, false
+	}
+	l.Terms, l.From = raw, licenseViaYtDlp
+	return l, true
+}
+
+// licenseFromInfo reads the license from yt-dlp's .info.json metadata
+func licenseFromInfo(info map[string]interface{}) (sourceLicense, bool) {
+	raw, _ := info["license"].(string)
+	extractor, _ := info["extractor_key"].(string)
+	if extractor == "" {
+		extractor, _ = info["extractor"].(string)
+	}
+	return licenseFromYtDlp(raw, extractor)
+}
+
+var licenseWordPattern = regexp.MustCompile(`[a-z0-9]+`)
+
+// parseLicenseName recognizes license names as sites state them
+// ("Creative Commons Attribution license (reuse allowed)", "by-nc-sa",
+// creativecommons.org URLs) and returns the known license ID, or ""
+func parseLicenseName(raw string) string {
+	s := strings.ToLower(raw)
+	words := make(map[string]bool)
+	for _, w := range licenseWordPattern.FindAllString(s, -1) {
+		words[w] = true
+	}
+
+	switch {
+	case words["cc0"] || strings.Contains(s, "publicdomain/zero"):
+		return "cc0"
+	case strings.Contains(s, "public domain") || strings.Contains(s, "publicdomain"):
+		return "public-domain"
+	case strings.Contains(s, "all rights reserved"):
+		return "all-rights-reserved"
+	case strings.Contains(s, "standard youtube license"):
+		return "youtube-standard"
+	case strings.Contains(s, "creative commons") || strings.Contains(s, "creativecommons") || words["cc"] || s == "by" || strings.HasPrefix(s, "by-"):
+		id := "cc-by"
+		if words["nc"] || strings.Contains(s, "noncommercial") || strings.Contains(s, "non-commercial") {
+			id += "-nc"
+		}
+		if words["nd"] || strings.Contains(s, "noderiv") || strings.Contains(s, "no deriv") {
+			id += "-nd"
+		} else if words["sa"] || strings.Contains(s, "sharealike") || strings.Contains(s, "share alike") {
+			id += "-sa"
+		}
+		return id
+	}
+	return ""
+}
+
+// licenseRule assigns a license to sources by ID or URL prefix
+type licenseRule struct {
+	Source      string `yaml:"source"`
+	URL         string `yaml:"url"`
+	License     string `yaml:"license"`
+	Terms       string `yaml:"terms"`
+	Derivatives *bool  `yaml:"derivatives"`
+	Commercial  *bool  `yaml:"commercial"`
+
+	license sourceLicense
+}
+
+// licenseConfig is a parsed license config file
+type licenseConfig struct {
+	Sources []licenseRule `yaml:"sources"`
+}
+
+// loadLicenseConfig reads and validates a license config. A missing file
+// is an empty config.
+func loadLicenseConfig(path string) (*licenseConfig, error) {
+	c := &licenseConfig{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read license config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse license config %s: %w", path, err)
+	}
+
+	for i := range c.Sources {
+		r := &c.Sources[i]
+		if (r.Source == "") == (r.URL == "") {
+			return nil, fmt.Errorf("license config %s: rule %d needs exactly one of source or url", path, i+1)
+		}
+		id := strings.ToLower(strings.TrimSpace(r.License))
+		l, known := knownLicenses[id]
+		if !known {
+			if id == "" || r.Derivatives == nil || r.Commercial == nil {
+				return nil, fmt.Errorf("license config %s: unknown license %q in rule %d (set derivatives and commercial for custom terms)", path, r.License, i+1)
+			}
+			l = sourceLicense{ID: id}
+		}
+		if r.Terms != "" {
+			l.Terms = r.Terms
+		}
+		if r.Derivatives != nil {
+			l.Derivatives = *r.Derivatives
+		}
+		if r.Commercial != nil {
+			l.Commercial = *r.Commercial
+		}
+		l.From = licenseViaConfig
+		r.license = l
+	}
+	return c, nil
+}
+
+// Match returns the license the first matching rule assigns to p
+func (c *licenseConfig) Match(p *Patch) (sourceLicense, bool) {
+	url := patchSourceURL(p)
+	for _, r := range c.Sources {
+		if (r.Source != "" && r.Source == p.SourceID) || (r.URL != "" && url != "" && strings.HasPrefix(url, r.URL)) {
+			return r.license, true
+		}
+	}
+	return sourceLicense{}, false
+}
+
+// patchSourceURL returns where p's source lives: the URL ingested
+// documents record, or the watch URL of a YouTube video
+func patchSourceURL(p *Patch) string {
+	if url, _ := p.Metadata["source-url"].(string); url != "" {
+		return url
+	}
+	if youtubeIDPattern.MatchString(p.SourceID) {
+		return "https://www.youtube.com/watch?v=" + p.SourceID
+	}
+	return ""
+}
+
+// resolvePatchLicense applies the config to p and returns its license
+func resolvePatchLicense(p *Patch, c *licenseConfig) (sourceLicense, bool) {
+	if l, ok := c.Match(p); ok {
+		setPatchLicense(p, l)
+		return l, true
+	}
+	return patchLicense(p)
+}
+
+func runLicenses(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	config, err := loadLicenseConfig(licensesConfig)
+	if err != nil {
+		return err
+	}
+	files, err := loadLocalPatchFiles(licensesDataDir)
+	if err != nil {
+		return err
+	}
+
+	// Apply the config, and collect YouTube sources still to look up
+	dirty := make(map[string]bool)
+	bySource := make(map[string][]localPatchFile)
+	var due []string
+	for _, f := range files {
+		if l, ok := config.Match(f.Patch); ok {
+			if setPatchLicense(f.Patch, l) {
+				dirty[f.Path] = true
+			}
+			continue
+		}
+		id := f.Patch.SourceID
+		if !youtubeIDPattern.MatchString(id) {
+			continue
+		}
+		if _, seen := bySource[id]; !seen {
+			if _, known := patchLicense(f.Patch); !known || licensesRecheck {
+				due = append(due, id)
+			}
+		}
+		bySource[id] = append(bySource[id], f)
+	}
+	sort.Strings(due)
+
+	if len(due) > 0 {
+		if err := checkYtDlpInstalled(); err != nil {
+			return err
+		}
+		manifest, err := openManifest(licensesManifest)
+		if err != nil {
+			return err
+		}
+		defer manifest.Close()
+
+		fmt.Printf("Looking up licenses of %d source videos\n", len(due))
+		statuses, err := lookupSourceStatuses(ctx, manifest, due)
+		if err != nil {
+			return err
+		}
+		for _, id := range due {
+			s, ok := statuses[id]
+			if !ok || s.License == nil {
+				continue
+			}
+			for _, f := range bySource[id] {
+				if setPatchLicense(f.Patch, *s.License) {
+					dirty[f.Path] = true
+				}
+			}
+		}
+	}
+
+	for _, f := range files {
+		if dirty[f.Path] {
+			if err := writePatchFile(f.Path, *f.Patch); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Summarize by license, counting each source and patch once
+	type licenseCount struct {
+		license sourceLicense
+		sources map[string]bool
+		patches map[string]bool
+	}
+	counts := make(map[string]*licenseCount)
+	for _, f := range files {
+		l, ok := patchLicense(f.Patch)
+		key := l.ID
+		if !ok {
+			key = "unknown"
+		}
+		c := counts[key]
+		if c == nil {
+			c = &licenseCount{license: l, sources: make(map[string]bool), patches: make(map[string]bool)}
+			counts[key] = c
+		}
+		c.sources[orDefault(f.Patch.SourceID, f.Patch.ID)] = true
+		c.patches[f.Patch.ID] = true
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if a, b := len(counts[keys[i]].patches), len(counts[keys[j]].patches); a != b {
+			return a > b
+		}
+		return keys[i] < keys[j]
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nLICENSE\tSOURCES\tPATCHES\tALLOWS")
+	for _, k := range keys {
+		c := counts[k]
+		allows := c.license.Summary()
+		if k == "unknown" {
+			allows = "-"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", k, len(c.sources), len(c.patches), allows)
+	}
+	w.Flush()
+
+	fmt.Printf("\nUpdated %d patch files\n", len(dirty))
+	return ctx.Err()
+}
@@ -0,0 +1,595 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Item states recorded in the manifest
+const (
+	ItemPending     = "pending"
+	ItemDownloaded  = "downloaded"
+	ItemTranscribed = "transcribed"
+	ItemProcessed   = "processed"
+	ItemFailed      = "failed"
+	ItemCanceled    = "canceled"
+)
+
+// manifestMigrations are applied in order; the index of the last applied
+// migration + 1 is stored in PRAGMA user_version. Only ever append.
+var manifestMigrations = []string{
+	`CREATE TABLE items (
+		url             TEXT PRIMARY KEY,
+		video_id        TEXT,
+		state           TEXT NOT NULL,
+		audio_path      TEXT,
+		transcript_path TEXT,
+		patch_id        TEXT,
+		error           TEXT,
+		created_at      TIMESTAMP NOT NULL,
+		updated_at      TIMESTAMP NOT NULL
+	);
+	CREATE INDEX items_video_id ON items(video_id);
+	CREATE INDEX items_state ON items(state);`,
+	`CREATE TABLE api_quota (
+		api      TEXT NOT NULL,
+		day      TEXT NOT NULL,
+		endpoint TEXT NOT NULL,
+		units    INTEGER NOT NULL,
+		PRIMARY KEY (api, day, endpoint)
+	);`,
+	`CREATE TABLE jobs (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		url         TEXT NOT NULL,
+		origin      TEXT NOT NULL,
+		state       TEXT NOT NULL,
+		patch_id    TEXT,
+		error       TEXT,
+		created_at  TIMESTAMP NOT NULL,
+		started_at  TIMESTAMP,
+		finished_at TIMESTAMP
+	);
+	CREATE INDEX jobs_state ON jobs(state);`,
+	`ALTER TABLE jobs ADD COLUMN cancel_requested INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE backfills (
+		channel_id   TEXT PRIMARY KEY,
+		playlist_id  TEXT NOT NULL,
+		page_token   TEXT NOT NULL DEFAULT '',
+		page_offset  INTEGER NOT NULL DEFAULT 0,
+		position     INTEGER NOT NULL DEFAULT 0,
+		total        INTEGER NOT NULL DEFAULT 0,
+		completed_at TIMESTAMP,
+		created_at   TIMESTAMP NOT NULL,
+		updated_at   TIMESTAMP NOT NULL
+	);
+	CREATE TABLE backfill_days (
+		channel_id TEXT NOT NULL,
+		day        TEXT NOT NULL,
+		processed  INTEGER NOT NULL DEFAULT 0,
+		skipped    INTEGER NOT NULL DEFAULT 0,
+		failed     INTEGER NOT NULL DEFAULT 0,
+		facts      INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (channel_id, day)
+	);`,
+	`CREATE TABLE embeddings (
+		kind       TEXT NOT NULL,
+		item_id    TEXT NOT NULL,
+		model      TEXT NOT NULL,
+		text_hash  TEXT NOT NULL,
+		dims       INTEGER NOT NULL,
+		vector     BLOB NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (kind, item_id, model)
+	);
+	CREATE TABLE settings (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`,
+	`ALTER TABLE items ADD COLUMN transcript_model TEXT;`,
+	`ALTER TABLE items ADD COLUMN title TEXT;
+	ALTER TABLE items ADD COLUMN channel TEXT;
+	ALTER TABLE items ADD COLUMN published TEXT;
+	ALTER TABLE items ADD COLUMN info_path TEXT;
+	CREATE INDEX items_channel ON items(channel);
+	CREATE INDEX items_published ON items(published);`,
+	`ALTER TABLE items ADD COLUMN collection TEXT;
+	CREATE INDEX items_collection ON items(collection);`,
+	`CREATE TABLE entity_decisions (
+		name       TEXT PRIMARY KEY,
+		entity     TEXT NOT NULL,
+		decided_by TEXT NOT NULL,
+		decided_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE TABLE playlist_entries (
+		playlist   TEXT NOT NULL,
+		video_id   TEXT NOT NULL,
+		url        TEXT NOT NULL,
+		position   INTEGER NOT NULL,
+		first_seen TIMESTAMP NOT NULL,
+		last_seen  TIMESTAMP NOT NULL,
+		removed_at TIMESTAMP,
+		PRIMARY KEY (playlist, video_id)
+	);`,
+	`ALTER TABLE items ADD COLUMN pruned_at TIMESTAMP;`,
+	`CREATE TABLE export_cursors (
+		cursor      TEXT NOT NULL,
+		patch_id    TEXT NOT NULL,
+		hash        TEXT NOT NULL,
+		exported_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (cursor, patch_id)
+	);`,
+	`ALTER TABLE items ADD COLUMN attention TEXT;`,
+	`CREATE TABLE speakers (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		channel     TEXT NOT NULL,
+		name        TEXT,
+		role        TEXT,
+		merged_into INTEGER,
+		created_at  TIMESTAMP NOT NULL
+	);
+	CREATE TABLE speaker_voices (
+		video_id   TEXT NOT NULL,
+		label      TEXT NOT NULL,
+		speaker_id INTEGER NOT NULL,
+		model      TEXT NOT NULL,
+		dims       INTEGER NOT NULL,
+		vector     BLOB NOT NULL,
+		seconds    REAL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (video_id, label)
+	);
+	CREATE INDEX speaker_voices_speaker ON speaker_voices(speaker_id);`,
+	`ALTER TABLE items ADD COLUMN failures INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE items ADD COLUMN dismissed_at TIMESTAMP;`,
+	`ALTER TABLE items ADD COLUMN audio_conversion TEXT;`,
+	`ALTER TABLE jobs ADD COLUMN title TEXT;
+	ALTER TABLE jobs ADD COLUMN duration REAL;
+	ALTER TABLE jobs ADD COLUMN metadata_claimed_at TIMESTAMP;
+	ALTER TABLE jobs ADD COLUMN metadata_at TIMESTAMP;`,
+	`CREATE TABLE usage_runs (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		command     TEXT NOT NULL,
+		started_at  TIMESTAMP NOT NULL,
+		seconds     REAL NOT NULL,
+		outcome     TEXT NOT NULL,
+		downloaded  INTEGER NOT NULL DEFAULT 0,
+		transcribed INTEGER NOT NULL DEFAULT 0,
+		processed   INTEGER NOT NULL DEFAULT 0,
+		failed      INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX usage_runs_started ON usage_runs(started_at);
+	CREATE TABLE usage_stages (
+		run_id  INTEGER NOT NULL,
+		stage   TEXT NOT NULL,
+		items   INTEGER NOT NULL,
+		seconds REAL NOT NULL,
+		PRIMARY KEY (run_id, stage)
+	);`,
+	`CREATE TABLE snapshots (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		taken_at   TIMESTAMP NOT NULL,
+		dir        TEXT NOT NULL,
+		formats    TEXT NOT NULL,
+		patches    INTEGER NOT NULL,
+		facts      INTEGER NOT NULL,
+		edges      INTEGER NOT NULL,
+		bytes      INTEGER NOT NULL,
+		removed_at TIMESTAMP
+	);
+	CREATE INDEX snapshots_taken ON snapshots(taken_at);`,
+}
+
+// ManifestItem is one source tracked through the pipeline stages
+type ManifestItem struct {
+	URL            string
+	VideoID        string
+	State          string
+	AudioPath      string
+	TranscriptPath string
+	// TranscriptModel is what produced the transcript: a Whisper model
+	// ("whisper-1", "whisper-base.en") or transcriptFromCaptions
+	TranscriptModel string
+	// AudioConversion is how the audio was converted for transcription
+	// ("opus sent as ogg", "mkv converted to mp3 ..."); empty if it was
+	// transcribed as downloaded
+	AudioConversion string
+	PatchID         string
+	Error           string
+	// Title, Channel, Published (YYYY-MM-DD) and InfoPath catalog the
+	// item's metadata so it can be found without globbing for sidecars
+	Title     string
+	Channel   string
+	Published string
+	InfoPath  string
+	// Collection groups items of one research project across channels
+	// and document kinds (--collection)
+	Collection string
+	// PrunedAt is when 'vkm clean' removed the item's audio (or
+	// transcript) after it was transcribed; zero if it didn't
+	PrunedAt time.Time
+	// Attention lists the quality gates a processed item failed, "; "
+	// separated; empty if it passed them all
+	Attention string
+	// Failures counts the item's failed attempts since it was last
+	// processed or requeued; DismissedAt is when 'vkm failed dismiss'
+	// took it off the failed list, zero if it didn't
+	Failures    int
+	DismissedAt time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Manifest is the SQLite-backed record of what the CLI has worked on.
+//
+// The database runs in WAL mode so readers never block the writer, and every
+// write in this process is funneled through a single goroutine. Writes that
+// still collide with another process (a daemon worker and a CLI invocation,
+// say) are retried with backoff instead of surfacing "database is locked".
+type Manifest struct {
+	path   string
+	db     *sql.DB
+	writes chan manifestWrite
+	done   chan struct{}
+	refs   int
+}
+
+type manifestWrite struct {
+	fn     func(tx *sql.Tx) error
+	result chan error
+}
+
+var (
+	manifestsMu sync.Mutex
+	manifests   = make(map[string]*Manifest)
+)
+
+const (
+	manifestBusyRetries = 10
+	manifestBusyBackoff = 50 * time.Millisecond
+)
+
+// openManifest opens (or creates) the manifest at path. Manifests are shared
+// per path within a process so there is only ever one writer goroutine for a
+// given database file; call Close once per openManifest.
+func openManifest(path string) (*Manifest, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve manifest path: %w", err)
+	}
+
+	manifestsMu.Lock()
+	defer manifestsMu.Unlock()
+
+	if m, ok := manifests[abs]; ok {
+		m.refs++
+		return m, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+
+	dsn := "file:" + filepath.ToSlash(abs) +
+		"?_pragma=journal_mode(WAL)" +
+		"&_pragma=busy_timeout(5000)" +
+		"&_pragma=synchronous(NORMAL)" +
+		"&_pragma=foreign_keys(1)" +
+		"&_txlock=immediate" +
+		"&_time_format=sqlite"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+
+	m := &Manifest{
+		path:   abs,
+		db:     db,
+		writes: make(chan manifestWrite),
+		done:   make(chan struct{}),
+		refs:   1,
+	}
+	go m.writeLoop()
+
+	if err := m.migrate(); err != nil {
+		m.shutdown()
+		return nil, err
+	}
+
+	manifests[abs] = m
+	return m, nil
+}
+
+// Close releases this handle, shutting the writer down with the last one
+func (m *Manifest) Close() error {
+	manifestsMu.Lock()
+	defer manifestsMu.Unlock()
+
+	m.refs--
+	if m.refs > 0 {
+		return nil
+	}
+	delete(manifests, m.path)
+	return m.shutdown()
+}
+
+func (m *Manifest) shutdown() error {
+	close(m.writes)
+	<-m.done
+	return m.db.Close()
+}
+
+// writeLoop is the single writer goroutine for this manifest
+func (m *Manifest) writeLoop() {
+	defer close(m.done)
+	for w := range m.writes {
+		w.result <- m.runWrite(w.fn)
+	}
+}
+
+func (m *Manifest) runWrite(fn func(tx *sql.Tx) error) error {
+	var err error
+	backoff := manifestBusyBackoff
+
+	for attempt := 0; attempt <= manifestBusyRetries; attempt++ {
+		if err = m.tryWrite(fn); err == nil || !isBusyError(err) {
+			return err
+		}
+		time.Sleep(backoff)
+		if backoff < 2*time.Second {
+			backoff *= 2
+		}
+	}
+
+	return fmt.Errorf("manifest still busy after %d retries: %w", manifestBusyRetries, err)
+}
+
+func (m *Manifest) tryWrite(fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// write runs fn in a transaction on the writer goroutine
+func (m *Manifest) write(fn func(tx *sql.Tx) error) error {
+	result := make(chan error, 1)
+	m.writes <- manifestWrite{fn: fn, result: result}
+	return <-result
+}
+
+func isBusyError(err error) bool {
+	var se *sqlite.Error
+	if errors.As(err, &se) {
+		code := se.Code() & 0xff
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+	}
+	return false
+}
+
+func (m *Manifest) migrate() error {
+	return m.write(func(tx *sql.Tx) error {
+		var version int
+		if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+			return fmt.Errorf("failed to read manifest version: %w", err)
+		}
+
+		for i := version; i < len(manifestMigrations); i++ {
+			if _, err := tx.Exec(manifestMigrations[i]); err != nil {
+				return fmt.Errorf("failed to apply manifest migration %d: %w", i+1, err)
+			}
+		}
+
+		if version < len(manifestMigrations) {
+			if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(manifestMigrations))); err != nil {
+				return fmt.Errorf("failed to update manifest version: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// RecordItem inserts or updates an item. Empty fields leave the stored value
+// untouched, so callers only need to set what the current stage learned.
+// Recording an item failed counts a failed attempt; recording it
+// processed clears its failures and dismissal.
+func (m *Manifest) RecordItem(item ManifestItem) error {
+	now := time.Now().UTC()
+	return m.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO items (url, video_id, state, audio_path, transcript_path, transcript_model, audio_conversion, patch_id, error,
+				title, channel, published, info_path, collection, failures, created_at, updated_at)
+			VALUES (?, NULLIF(?, ''), ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+				NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), CASE WHEN ? = ? THEN 1 ELSE 0 END, ?, ?)
+			ON CONFLICT(url) DO UPDATE SET
+				video_id         = COALESCE(excluded.video_id, items.video_id),
+				state            = excluded.state,
+				audio_path       = COALESCE(excluded.audio_path, items.audio_path),
+				transcript_path  = COALESCE(excluded.transcript_path, items.transcript_path),
+				transcript_model = COALESCE(excluded.transcript_model, items.transcript_model),
+				audio_conversion = CASE WHEN excluded.transcript_model IS NULL THEN items.audio_conversion ELSE excluded.audio_conversion END,
+				patch_id         = COALESCE(excluded.patch_id, items.patch_id),
+				error            = excluded.error,
+				title            = COALESCE(excluded.title, items.title),
+				channel          = COALESCE(excluded.channel, items.channel),
+				published        = COALESCE(excluded.published, items.published),
+				info_path        = COALESCE(excluded.info_path, items.info_path),
+				collection       = COALESCE(excluded.collection, items.collection),
+				pruned_at        = CASE WHEN excluded.audio_path IS NULL THEN items.pruned_at END,
+				failures         = CASE excluded.state WHEN ? THEN items.failures + 1 WHEN ? THEN 0 ELSE items.failures END,
+				dismissed_at     = CASE WHEN excluded.state = ? THEN NULL ELSE items.dismissed_at END,
+				updated_at       = excluded.updated_at`,
+			item.URL, item.VideoID, item.State, item.AudioPath, item.TranscriptPath,
+			item.TranscriptModel, item.AudioConversion, item.PatchID, item.Error,
+			item.Title, item.Channel, item.Published, item.InfoPath, item.Collection, item.State, ItemFailed, now, now,
+			ItemFailed, ItemProcessed, ItemProcessed)
+		if err != nil {
+			return fmt.Errorf("failed to record manifest item: %w", err)
+		}
+		return nil
+	})
+}
+
+const manifestItemColumns = `url, COALESCE(video_id, ''), state, COALESCE(audio_path, ''),
+	COALESCE(transcript_path, ''), COALESCE(transcript_model, ''), COALESCE(audio_conversion, ''), COALESCE(patch_id, ''), COALESCE(error, ''),
+	COALESCE(title, ''), COALESCE(channel, ''), COALESCE(published, ''), COALESCE(info_path, ''),
+	COALESCE(collection, ''), pruned_at, COALESCE(attention, ''), failures, dismissed_at, created_at, updated_at`
+
+func scanManifestItem(row interface{ Scan(...interface{}) error }) (*ManifestItem, error) {
+	var item ManifestItem
+	var pruned, dismissed sql.NullTime
+	err := row.Scan(&item.URL, &item.VideoID, &item.State, &item.AudioPath,
+		&item.TranscriptPath, &item.TranscriptModel, &item.AudioConversion, &item.PatchID, &item.Error,
+		&item.Title, &item.Channel, &item.Published, &item.InfoPath, &item.Collection, &pruned, &item.Attention,
+		&item.Failures, &dismissed, &item.CreatedAt, &item.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	item.PrunedAt = pruned.Time
+	item.DismissedAt = dismissed.Time
+	return &item, nil
+}
+
+// GetItem returns the item recorded for url, or nil if there is none
+func (m *Manifest) GetItem(url string) (*ManifestItem, error) {
+	item, err := scanManifestItem(m.db.QueryRow(
+		"SELECT "+manifestItemColumns+" FROM items WHERE url = ?", url))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest item: %w", err)
+	}
+	return item, nil
+}
+
+// ItemByVideoID returns the most recently updated item for a video, or nil
+// if the video was never recorded
+func (m *Manifest) ItemByVideoID(videoID string) (*ManifestItem, error) {
+	item, err := scanManifestItem(m.db.QueryRow(
+		"SELECT "+manifestItemColumns+" FROM items WHERE video_id = ? ORDER BY updated_at DESC LIMIT 1", videoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest item: %w", err)
+	}
+	return item, nil
+}
+
+// ItemByAudioPath returns the most recently updated item whose audio was
+// saved at path, or nil if there is none
+func (m *Manifest) ItemByAudioPath(path string) (*ManifestItem, error) {
+	item, err := scanManifestItem(m.db.QueryRow(
+		"SELECT "+manifestItemColumns+" FROM items WHERE audio_path = ? ORDER BY updated_at DESC LIMIT 1", path))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest item: %w", err)
+	}
+	return item, nil
+}
+
+// Items returns every recorded item, oldest first
+func (m *Manifest) Items() ([]*ManifestItem, error) {
+	rows, err := m.db.Query("SELECT " + manifestItemColumns + " FROM items ORDER BY created_at, url")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*ManifestItem
+	for rows.Next() {
+		item, err := scanManifestItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest item: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// recordItem records item in m when a manifest is in use, filed under
+// --collection unless the item names one. Manifest failures are reported
+// but never abort the stage that produced them.
+func recordItem(m *Manifest, item ManifestItem) {
+	if m == nil {
+		return
+	}
+	if item.Collection == "" {
+		item.Collection = ingestCollection
+	}
+	if err := m.RecordItem(item); err != nil {
+		fmt.Fprintf(os.Stderr, "  Warning: %v\n", err)
+		return
+	}
+	countUsageItem(item.URL, item.State)
+}
+
+// AddQuotaUsage adds units spent on an API endpoint for the given quota day
+func (m *Manifest) AddQuotaUsage(api, day, endpoint string, units int) error {
+	return m.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO api_quota (api, day, endpoint, units) VALUES (?, ?, ?, ?)
+			ON CONFLICT(api, day, endpoint) DO UPDATE SET units = units + excluded.units`,
+			api, day, endpoint, units)
+		if err != nil {
+			return fmt.Errorf("failed to record quota usage: %w", err)
+		}
+		return nil
+	})
+}
+
+// QuotaUsage returns units spent per endpoint for an API on the given day
+func (m *Manifest) QuotaUsage(api, day string) (map[string]int, error) {
+	rows, err := m.db.Query("SELECT endpoint, units FROM api_quota WHERE api = ? AND day = ?", api, day)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quota usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := make(map[string]int)
+	for rows.Next() {
+		var endpoint string
+		var units int
+		if err := rows.Scan(&endpoint, &units); err != nil {
+			return nil, fmt.Errorf("failed to read quota usage: %w", err)
+		}
+		usage[endpoint] = units
+	}
+	return usage, rows.Err()
+}
+
+// UsageByAPI returns total units spent per API on the given day
+func (m *Manifest) UsageByAPI(day string) (map[string]int, error) {
+	rows, err := m.db.Query("SELECT api, SUM(units) FROM api_quota WHERE day = ? GROUP BY api", day)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quota usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := make(map[string]int)
+	for rows.Next() {
+		var api string
+		var units int
+		if err := rows.Scan(&api, &units); err != nil {
+			return nil, fmt.Errorf("failed to read quota usage: %w", err)
+		}
+		usage[api] = units
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Motive analysis runs as a job in the serve queue once each ingestion
+// batch has drained it, so it shows up in 'vkm jobs' like enrichment does
+const (
+	motivesJobURL    = "vkm:motives"
+	motivesJobOrigin = "batch"
+)
+
+// motivesCheckedSetting is the manifest setting holding the end of the
+// period motives were last analyzed over
+const motivesCheckedSetting = "motives.checked-at"
+
+// motiveAlertsHelp describes motive notifications for serve modes' --help
+const motiveAlertsHelp = `With --motive-webhook, each batch of ingested videos (the jobs
+processed until the queue runs empty) is followed by a motive analysis
+job: the backend's graph diff since the last analysis is checked for
+motives that formed, and those of at least --motive-min-size facts and
+--motive-min-confidence are POSTed to the webhook as JSON:
+
+  {"event": "motives.emerged", "text": "2 new motives emerged ...",
+   "from": "...", "to": "...", "patches_added": 5,
+   "sources": [...], "motives": [{"motive/concept-words": [...], ...}]}
+
+"text" is a readable summary, so Slack incoming webhooks (and
+Slack-compatible ones) post it as is. With VKM_MOTIVE_WEBHOOK_SECRET set,
+notifications are signed like generic inbound webhooks: X-Vkm-Timestamp
+and X-Vkm-Signature: sha256=<HMAC of "<timestamp>.<body>">. Only motives
+emerging after the first start with --motive-webhook are notified.`
+
+var (
+	serveMotiveWebhook       string
+	serveMotiveMinSize       int
+	serveMotiveMinConfidence float64
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{ServeAPICmd, ServeWebhooksCmd} {
+		cmd.Flags().StringVar(&serveMotiveWebhook, "motive-webhook", "", "POST a summary to this URL when new motives emerge after an ingestion batch")
+		cmd.Flags().IntVar(&serveMotiveMinSize, "motive-min-size", 3, "Fewest facts a new motive clusters to be notified")
+		cmd.Flags().Float64Var(&serveMotiveMinConfidence, "motive-min-confidence", 0.5, "Lowest confidence of a new motive to be notified")
+	}
+}
+
+// isMotivesJob reports whether job is a motive analysis rather than a URL
+// to process. Like enrichment jobs, only the worker queues one.
+func isMotivesJob(job *Job) bool {
+	return job.URL == motivesJobURL && job.Origin == motivesJobOrigin
+}
+
+// startMotiveAlerts checks --motive-webhook and, on the first start with
+// it, marks now as the point motives are analyzed from
+func startMotiveAlerts(m *Manifest) error {
+	if serveMotiveWebhook == "" {
+		return nil
+	}
+	if !strings.HasPrefix(serveMotiveWebhook, "http://") && !strings.HasPrefix(serveMotiveWebhook, "https://") {
+		return fmt.Errorf("invalid --motive-webhook %q (use an http or https URL)", serveMotiveWebhook)
+	}
+	checked, err := m.Setting(motivesCheckedSetting)
+	if err != nil {
+		return err
+	}
+	if checked == "" {
+		if err := m.SetSetting(motivesCheckedSetting, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("New motives are notified to %s after each ingestion batch\n", serveMotiveWebhook)
+	return nil
+}
+
+// queueMotiveAnalysis queues a motive analysis job, when notifications
+// are on
+func queueMotiveAnalysis(m *Manifest) {
+	if serveMotiveWebhook == "" {
+		return
+	}
+	if job, err := m.EnqueueJob(motivesJobURL, motivesJobOrigin); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		fmt.Printf("Queued motive analysis as job %d\n", job.ID)
+	}
+}
+
+// motiveNotification is the body POSTed to --motive-webhook
+type motiveNotification struct {
+	Event        string        `json:"event"`
+	Text         string        `json:"text"`
+	From         time.Time     `json:"from"`
+	To           time.Time     `json:"to"`
+	PatchesAdded int           `json:"patches_added"`
+	Sources      []string      `json:"sources"`
+	Motives      []graphMotive `json:"motives"`
+}
+
+// analyzeMotives notifies the motives that emerged in the graph since the
+// last analysis, and returns how many it notified. The analyzed period
+// only advances once the notification is delivered, so motives are not
+// lost to a webhook that is down.
+func analyzeMotives(ctx context.Context, m *Manifest, backendURL string) (int, error) {
+	checked, err := m.Setting(motivesCheckedSetting)
+	if err != nil {
+		return 0, err
+	}
+	to := time.Now().UTC().Truncate(time.Second)
+	from, err := time.Parse(time.RFC3339, checked)
+	if err != nil {
+		from = to
+	}
+
+	diff, err := fetchGraphDiff(ctx, backendURL, from, to)
+	if err != nil {
+		return 0, err
+	}
+	var emerged []graphMotive
+	for _, motive := range diff.MotivesAdded {
+		if motive.ClusterSize >= serveMotiveMinSize && motive.Confidence >= serveMotiveMinConfidence {
+			emerged = append(emerged, motive)
+		}
+	}
+
+	if len(emerged) > 0 {
+		sort.SliceStable(emerged, func(i, j int) bool { return emerged[i].ClusterSize > emerged[j].ClusterSize })
+		n := motiveNotification{
+			Event:        "motives.emerged",
+			Text:         motiveSummary(diff, emerged),
+			From:         from,
+			To:           to,
+			PatchesAdded: diff.PatchesAdded,
+			Sources:      diff.SourcesAdded,
+			Motives:      emerged,
+		}
+		fmt.Println(n.Text)
+		if err := postMotiveNotification(ctx, serveMotiveWebhook, n); err != nil {
+			return 0, err
+		}
+	}
+	return len(emerged), m.SetSetting(motivesCheckedSetting, to.Format(time.RFC3339))
+}
+
+// motiveSummary describes emerged motives in a few lines of text, largest
+// first
+func motiveSummary(diff *GraphDiff, emerged []graphMotive) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d new motive(s) emerged in the knowledge graph", len(emerged))
+	if n := len(diff.SourcesAdded); n > 0 {
+		fmt.Fprintf(&b, " from %d new source(s)", n)
+	}
+	fmt.Fprintf(&b, " (%s → %s):", formatGraphTime(diff.From), formatGraphTime(diff.To))
+	for _, motive := range emerged {
+		fmt.Fprintf(&b, "\n• %s (%d facts, confidence %.2f)",
+			strings.Join(motive.ConceptWords, ", "), motive.ClusterSize, motive.Confidence)
+	}
+	return b.String()
+}
+
+// postMotiveNotification POSTs n to webhookURL, signed with
+// VKM_MOTIVE_WEBHOOK_SECRET when it is set
+func postMotiveNotification(ctx context.Context, webhookURL string, n motiveNotification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := os.Getenv("VKM_MOTIVE_WEBHOOK_SECRET"); secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set("X-Vkm-Timestamp", timestamp)
+		req.Header.Set("X-Vkm-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send motive notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("motive webhook error (status %d): %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
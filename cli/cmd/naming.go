@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// Default --name-template values, matching the names yt-dlp produced before
+// templates were configurable
+const (
+	defaultNameTemplate         = "{{.ID}}"
+	defaultPlaylistNameTemplate = `{{printf "%03d" .PlaylistIndex}}-{{.ID}}`
+)
+
+// nameTemplateHelp documents --name-template for command help text
+const nameTemplateHelp = `Output names use a Go template (--name-template) over the video's
+metadata: .ID, .Title, .TitleSlug, .Channel, .ChannelSlug, .Date
+(YYYY-MM-DD), .Year, .Month, .PlaylistIndex and .Site (youtube,
+soundcloud, ...), plus a slug function.
+Slashes create subdirectories. The extension is added automatically, and
+a name already used by a different video gets "-<id>" appended.
+  --name-template '{{.ChannelSlug}}/{{.Date}}-{{.TitleSlug}}'`
+
+// nameFields are the values available to name templates
+type nameFields struct {
+	ID            string
+	Title         string
+	Channel       string
+	Date          string
+	Year          string
+	Month         string
+	PlaylistIndex int
+	// Site is where the media was downloaded from, as in the download
+	// archive; empty for local files
+	Site string
+}
+
+// TitleSlug is the title lowercased with runs of other characters as dashes
+func (f nameFields) TitleSlug() string { return slugify(f.Title) }
+
+// ChannelSlug is the channel name as a slug
+func (f nameFields) ChannelSlug() string { return slugify(f.Channel) }
+
+var slugPattern = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// slugify turns s into a lowercase, dash-separated filename fragment
+func slugify(s string) string {
+	slug := strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(slug) > 80 {
+		slug = strings.TrimRight(slug[:80], "-")
+	}
+	return slug
+}
+
+// withDate fills the date fields from a publish time
+func (f nameFields) withDate(t time.Time) nameFields {
+	if !t.IsZero() {
+		f.Date = t.Format("2006-01-02")
+		f.Year = t.Format("2006")
+		f.Month = t.Format("01")
+	}
+	return f
+}
+
+// nameFieldsFromInfo reads template fields from a yt-dlp .info.json
+func nameFieldsFromInfo(info map[string]interface{}) nameFields {
+	str := func(key string) string {
+		s, _ := info[key].(string)
+		return s
+	}
+	f := nameFields{ID: str("id"), Title: str("title"), Channel: str("channel"), Site: siteFromInfo(info)}
+	if f.Channel == "" {
+		f.Channel = str("uploader")
+	}
+	if idx, ok := info["playlist_index"].(float64); ok {
+		f.PlaylistIndex = int(idx)
+	}
+	return f.withDate(publishedAtFromInfo(info))
+}
+
+// nameTemplate renders output names for downloaded media
+type nameTemplate struct {
+	tmpl *template.Template
+	// sites are templates used instead of tmpl for media from a site
+	sites map[string]*template.Template
+	// perVideo renders directory names for the per-video layout
+	perVideo bool
+}
+
+// parseNameTemplate compiles a --name-template value
+func parseNameTemplate(text string) (*nameTemplate, error) {
+	tmpl, err := compileNameTemplate(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template: %w", err)
+	}
+	return &nameTemplate{tmpl: tmpl}, nil
+}
+
+// parseSiteNameTemplates compiles a --name-template value together with
+// --site-name-template overrides, keyed by site name
+func parseSiteNameTemplates(text string, bySite map[string]string) (*nameTemplate, error) {
+	t, err := parseNameTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	for site, siteText := range bySite {
+		tmpl, err := compileNameTemplate(siteText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name template for %s: %w", site, err)
+		}
+		if t.sites == nil {
+			t.sites = make(map[string]*template.Template)
+		}
+		t.sites[strings.ToLower(site)] = tmpl
+	}
+	return t, nil
+}
+
+func compileNameTemplate(text string) (*template.Template, error) {
+	return template.New("name").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"slug": slugify}).
+		Parse(text)
+}
+
+// Render returns the relative base name (without extension) for fields,
+// using the template for their site if there is one. Each path segment is
+// cleaned of characters that are unsafe in filenames.
+func (t *nameTemplate) Render(f nameFields) (string, error) {
+	tmpl := t.tmpl
+	if siteTmpl, ok := t.sites[f.Site]; ok {
+		tmpl = siteTmpl
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, f); err != nil {
+		return "", fmt.Errorf("failed to render name template: %w", err)
+	}
+
+	var segments []string
+	for _, seg := range strings.Split(buf.String(), "/") {
+		seg = CleanFilename(strings.TrimSpace(seg))
+		if seg == "" || seg == "." || seg == ".." {
+			continue
+		}
+		segments = append(segments, truncateSegment(seg))
+	}
+	if len(segments) == 0 {
+		return "", fmt.Errorf("name template produced an empty name for %s", f.ID)
+	}
+	return filepath.Join(segments...), nil
+}
+
+// maxNameSegment keeps each rendered path segment well below the 255-byte
+// filename limit, leaving room for suffixes like "-<id>.info.json"
+const maxNameSegment = 150
+
+// truncateSegment shortens a path segment to maxNameSegment bytes without
+// splitting a UTF-8 character
+func truncateSegment(seg string) string {
+	if len(seg) <= maxNameSegment {
+		return seg
+	}
+	cut := maxNameSegment
+	for cut > 0 && !utf8.RuneStart(seg[cut]) {
+		cut--
+	}
+	return strings.TrimRight(seg[:cut], ". -")
+}
+
+// downloadedMedia is an audio file fetched by a downloader and its
+// metadata sidecar
+type downloadedMedia struct {
+	VideoID  string
+	Path     string
+	InfoPath string
+
+	// ThumbnailPath and DescriptionPath are the video's thumbnail image
+	// and full description saved beside it, when the downloader saved them
+	ThumbnailPath   string
+	DescriptionPath string
+
+	// Captions marks Path as a transcript built from the video's captions
+	// (--prefer-captions) instead of audio
+	Captions bool
+}
+
+// thumbnailExtensions are the image formats thumbnails are saved in, in
+// order of preference
+var thumbnailExtensions = []string{".jpg", ".webp", ".png"}
+
+// sidecarBase returns the path of an info.json without its suffix
+func sidecarBase(infoPath string) string {
+	if base, ok := strings.CutSuffix(infoPath, ".info.json"); ok {
+		return base
+	}
+	return strings.TrimSuffix(infoPath, filepath.Ext(infoPath))
+}
+
+// findSidecars fills in the thumbnail and description saved beside
+// media's info.json
+func findSidecars(media *downloadedMedia) {
+	if media.InfoPath == "" {
+		return
+	}
+	if filepath.Base(media.InfoPath) == perVideoInfo {
+		findPerVideoSidecars(media)
+		return
+	}
+	base := sidecarBase(media.InfoPath)
+	if fileExists(base + ".description") {
+		media.DescriptionPath = base + ".description"
+	}
+	for _, ext := range thumbnailExtensions {
+		if fileExists(base + ext) {
+			media.ThumbnailPath = base + ext
+			break
+		}
+	}
+}
+
+// sidecarVideoID returns the video ID recorded in the sidecar for base,
+// or "" if there is none
+func sidecarVideoID(base string) string {
+	for _, path := range []string{base + ".info.json", base + ".json"} {
+		info, err := loadVideoMetadata(path)
+		if err != nil {
+			continue
+		}
+		for _, key := range []string{"id", "video_id"} {
+			if id, ok := info[key].(string); ok && id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// claimName resolves collisions for base: if files with that name already
+// belong to another video, "-<id>" is appended
+func claimName(base, videoID string) string {
+	existing, _ := filepath.Glob(globEscape(base) + ".*")
+	if len(existing) == 0 {
+		return base
+	}
+	if owner := sidecarVideoID(base); owner == videoID {
+		return base
+	}
+	return base + "-" + videoID
+}
+
+var globMetaPattern = regexp.MustCompile(`([*?\[\\])`)
+
+// globEscape escapes glob metacharacters in a literal path
+func globEscape(path string) string {
+	return globMetaPattern.ReplaceAllString(path, `\$1`)
+}
+
+// applyNameTemplate renames a download and its sidecar under dir according
+// to the template, or moves them into the video's directory in the
+// per-video layout, updating media in place
+func applyNameTemplate(t *nameTemplate, dir string, media *downloadedMedia, f nameFields) error {
+	name, err := t.Render(f)
+	if err != nil {
+		return err
+	}
+	if t.perVideo {
+		return applyPerVideoLayout(dir, name, media)
+	}
+
+	base := claimName(filepath.Join(dir, name), media.VideoID)
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	newPath := base + filepath.Ext(media.Path)
+	if newPath != media.Path {
+		if err := os.Rename(media.Path, newPath); err != nil {
+			return fmt.Errorf("failed to rename %s: %w", media.Path, err)
+		}
+		media.Path = newPath
+	}
+
+	if media.InfoPath != "" {
+		suffix := ".info.json"
+		if !strings.HasSuffix(media.InfoPath, suffix) {
+			suffix = ".json"
+		}
+		newInfo := base + suffix
+		if newInfo != media.InfoPath {
+			if err := os.Rename(media.InfoPath, newInfo); err != nil {
+				return fmt.Errorf("failed to rename %s: %w", media.InfoPath, err)
+			}
+			media.InfoPath = newInfo
+		}
+	}
+
+	for _, sidecar := range []*string{&media.ThumbnailPath, &media.DescriptionPath} {
+		if *sidecar == "" {
+			continue
+		}
+		newSidecar := base + filepath.Ext(*sidecar)
+		if newSidecar != *sidecar {
+			if err := os.Rename(*sidecar, newSidecar); err != nil {
+				return fmt.Errorf("failed to rename %s: %w", *sidecar, err)
+			}
+			*sidecar = newSidecar
+		}
+	}
+	return nil
+}
+
+// nameDownload applies the template to a yt-dlp download using its
+// .info.json sidecar
+func nameDownload(t *nameTemplate, dir string, media *downloadedMedia) error {
+	info, err := loadVideoMetadata(media.InfoPath)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata for %s: %w", media.VideoID, err)
+	}
+	return applyNameTemplate(t, dir, media, nameFieldsFromInfo(info))
+}
@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// NormalizeCmd consolidates the metadata sidecars of manifest items
+var NormalizeCmd = &cobra.Command{
+	Use:   "normalize",
+	Short: "Consolidate metadata sidecars into one .info.json per item",
+	Long: `Consolidate the metadata of every item in the manifest into one
+canonical sidecar: <name>.info.json beside its audio (or caption
+transcript), in yt-dlp's info.json format, which every command reads.
+
+Depending on the command that downloaded it, an item's metadata may be a
+yt-dlp <name>.info.json, a <name>.json written by older versions of
+'vkm download', a sidecar still named after the video ID beside renamed
+audio, or missing. normalize merges whatever exists into
+<name>.info.json, keeping yt-dlp's values where sidecars disagree and
+adding the manifest's video ID and URL where they are missing, then
+removes the merged files unless --keep-legacy is given. Items whose
+audio or transcript is gone are reported and skipped.
+
+Examples:
+  vkm normalize --dry-run
+  vkm normalize --manifest data/manifest.db --keep-legacy`,
+	Args: cobra.NoArgs,
+	RunE: runNormalize,
+}
+
+var (
+	normalizeManifest   string
+	normalizeDryRun     bool
+	normalizeKeepLegacy bool
+)
+
+func init() {
+	NormalizeCmd.Flags().StringVar(&normalizeManifest, "manifest", "data/manifest.db", "SQLite manifest listing the items to normalize")
+	NormalizeCmd.Flags().BoolVar(&normalizeDryRun, "dry-run", false, "Report what would change without writing or removing files")
+	NormalizeCmd.Flags().BoolVar(&normalizeKeepLegacy, "keep-legacy", false, "Keep sidecars after merging them into the canonical one")
+}
+
+// sidecarResult is what normalizing one item did
+type sidecarResult struct {
+	Path    string
+	Merged  []string
+	Changed bool
+	Missing bool
+}
+
+func runNormalize(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(normalizeManifest); err != nil {
+		return fmt.Errorf("no manifest at %s", normalizeManifest)
+	}
+	m, err := openManifest(normalizeManifest)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	items, err := m.Items()
+	if err != nil {
+		return err
+	}
+
+	changed, unchanged, missing, failed := 0, 0, 0, 0
+	seen := make(map[string]bool)
+	for _, item := range items {
+		base := itemBase(item)
+		if base == "" || seen[base] {
+			continue
+		}
+		seen[base] = true
+
+		res, err := normalizeSidecars(item, base)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", base, err)
+			failed++
+		case res.Missing:
+			fmt.Printf("- %s: files missing, skipped\n", base)
+			missing++
+		case !res.Changed:
+			unchanged++
+		default:
+			verb := "Wrote"
+			if normalizeDryRun {
+				verb = "Would write"
+			}
+			fmt.Printf("✓ %s %s", verb, res.Path)
+			if len(res.Merged) > 0 {
+				fmt.Printf(" (from %s)", strings.Join(res.Merged, ", "))
+			}
+			fmt.Println()
+			changed++
+		}
+	}
+
+	fmt.Printf("\n%d normalized, %d already canonical, %d missing", changed, unchanged, missing)
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+	}
+	fmt.Println()
+	if normalizeDryRun && changed > 0 {
+		fmt.Println("Dry run: nothing was written")
+	}
+	return nil
+}
+
+// itemBase is the path, without extension, an item's files share: its
+// audio's, or for caption items its transcript's
+func itemBase(item *ManifestItem) string {
+	path := item.AudioPath
+	if path == "" {
+		path = item.TranscriptPath
+	}
+	if path == "" {
+		return ""
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// itemInfoPath returns the info.json belonging to the item's files in
+// either layout, or "" if it has none on record
+func itemInfoPath(item *ManifestItem) string {
+	path := item.AudioPath
+	if path == "" {
+		path = item.TranscriptPath
+	}
+	if path == "" {
+		return ""
+	}
+	return infoPathFor(path)
+}
+
+// normalizeSidecars merges the sidecars of the item whose files are named
+// base into base.info.json
+func normalizeSidecars(item *ManifestItem, base string) (*sidecarResult, error) {
+	res := &sidecarResult{Path: base + ".info.json"}
+	if !fileExists(item.AudioPath) && !fileExists(item.TranscriptPath) {
+		res.Missing = true
+		return res, nil
+	}
+
+	candidates := []string{res.Path, base + ".json"}
+	if item.VideoID != "" && filepath.Base(base) != item.VideoID {
+		dir := filepath.Dir(base)
+		candidates = append(candidates, filepath.Join(dir, item.VideoID+".info.json"), filepath.Join(dir, item.VideoID+".json"))
+	}
+
+	var existing map[string]interface{}
+	merged := make(map[string]interface{})
+	var legacy []map[string]interface{}
+	var sources []string
+	for _, path := range candidates {
+		if path == item.TranscriptPath || !fileExists(path) {
+			continue
+		}
+		info, err := loadVideoMetadata(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if _, ok := info["transcript"]; ok {
+			continue // a transcript, not a sidecar
+		}
+		isLegacy := false
+		if _, ok := info["video_id"]; ok && info["id"] == nil {
+			isLegacy = true
+			var meta VideoMetadata
+			data, _ := json.Marshal(info)
+			if err := json.Unmarshal(data, &meta); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			info = videoMetadataInfo(meta)
+		}
+		if id, _ := info["id"].(string); id != "" && item.VideoID != "" && id != item.VideoID {
+			fmt.Fprintf(os.Stderr, "Warning: %s describes %s, not %s; skipped\n", path, id, item.VideoID)
+			continue
+		}
+
+		if path == res.Path {
+			existing = info
+		} else {
+			sources = append(sources, filepath.Base(path))
+		}
+		// yt-dlp sidecars are merged before legacy ones, so their values win
+		if !isLegacy {
+			mergeMissing(merged, info)
+		} else {
+			legacy = append(legacy, info)
+		}
+	}
+	for _, info := range legacy {
+		mergeMissing(merged, info)
+	}
+	mergeMissing(merged, map[string]interface{}{"id": item.VideoID, "webpage_url": item.URL})
+
+	// Round-trip through JSON so values compare as they would be read back
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	var written map[string]interface{}
+	json.Unmarshal(data, &written)
+	res.Merged = sources
+	res.Changed = len(sources) > 0 || !reflect.DeepEqual(existing, written)
+	if !res.Changed || normalizeDryRun {
+		return res, nil
+	}
+
+	if err := os.WriteFile(res.Path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", res.Path, err)
+	}
+	if !normalizeKeepLegacy {
+		for _, name := range sources {
+			os.Remove(filepath.Join(filepath.Dir(base), name))
+		}
+	}
+	return res, nil
+}
+
+// mergeMissing copies the keys of src that dst lacks, leaving out empty
+// strings
+func mergeMissing(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if _, ok := dst[k]; !ok && v != "" {
+			dst[k] = v
+		}
+	}
+}
+
+// fileExists reports whether path names an existing file
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// videoMetadataInfo converts VideoMetadata to yt-dlp's info.json format
+func videoMetadataInfo(m VideoMetadata) map[string]interface{} {
+	info := map[string]interface{}{
+		"id":          m.VideoID,
+		"title":       m.Title,
+		"channel":     m.ChannelID, // 'vkm download' records the author's name here
+		"uploader":    m.ChannelID,
+		"webpage_url": "https://www.youtube.com/watch?v=" + m.VideoID,
+		"extractor":   "youtube",
+	}
+	if m.Duration > 0 {
+		info["duration"] = m.Duration
+	}
+	if !m.PublishedAt.IsZero() {
+		info["upload_date"] = m.PublishedAt.UTC().Format("20060102")
+		info["timestamp"] = m.PublishedAt.Unix()
+	}
+	if m.FilePath != "" {
+		info["ext"] = strings.TrimPrefix(filepath.Ext(m.FilePath), ".")
+	}
+	if m.Description != "" {
+		info["description"] = m.Description
+	}
+	if m.Thumbnail != "" {
+		info["thumbnail"] = m.Thumbnail
+	}
+	if len(m.Chapters) > 0 {
+		chapters := make([]map[string]interface{}, len(m.Chapters))
+		for i, c := range m.Chapters {
+			chapters[i] = map[string]interface{}{"title": c.Title, "start_time": c.Start, "end_time": c.End}
+		}
+		info["chapters"] = chapters
+	}
+	return info
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ollamaModelPrefix marks model names served by a local Ollama instead of
+// a hosted API, as in ollama:llama3.1:8b
+const ollamaModelPrefix = "ollama:"
+
+// ollamaContextTokens is the context window local extraction asks Ollama
+// for; its own default of 2048 tokens truncates most transcripts
+const ollamaContextTokens = 32768
+
+// ollamaModel returns the Ollama model a model name refers to, and whether
+// it refers to one
+func ollamaModel(model string) (string, bool) {
+	return strings.CutPrefix(model, ollamaModelPrefix)
+}
+
+// ollamaURL is the base URL of the Ollama server: OLLAMA_HOST, as the
+// ollama CLI reads it, else its default local address
+func ollamaURL() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return "http://localhost:11434"
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// postOllama sends a JSON request to an Ollama API endpoint and decodes
+// its answer into out
+func postOllama(ctx context.Context, endpoint string, reqBody, out interface{}, timeout time.Duration) error {
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", ollamaURL()+endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Ollama at %s (is 'ollama serve' running?): %w", ollamaURL(), err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, string(body))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// askOllama sends a single-turn prompt to a local Ollama model and returns
+// the text of its answer. Local models are slow on long transcripts, so
+// requests may take up to ten minutes.
+func askOllama(ctx context.Context, model, prompt string) (string, error) {
+	var result struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	}
+	err := postOllama(ctx, "/api/chat", map[string]interface{}{
+		"model":  model,
+		"stream": false,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+		"options": map[string]interface{}{
+			"temperature": 0.0,
+			"num_ctx":     ollamaContextTokens,
+		},
+	}, &result, 10*time.Minute)
+	if err != nil {
+		return "", err
+	}
+	if result.Message.Content == "" {
+		return "", fmt.Errorf("empty response from Ollama model %s", model)
+	}
+	return result.Message.Content, nil
+}
+
+// embedOllama returns embeddings for texts from a local Ollama model
+func embedOllama(ctx context.Context, model string, texts []string) ([][]float64, error) {
+	var result struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	err := postOllama(ctx, "/api/embed", map[string]interface{}{
+		"model": model,
+		"input": texts,
+	}, &result, 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("Ollama returned %d embeddings for %d texts", len(result.Embeddings), len(texts))
+	}
+	return result.Embeddings, nil
+}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pipeline ordering modes for items expanded from a playlist
+const (
+	orderPlaylist = "playlist" // playlist index: lecture 1 before lecture 12
+	orderPublish  = "publish"  // publish date, oldest first
+	orderInput    = "input"    // as listed by yt-dlp / on the command line
+)
+
+// Commit time modes
+const (
+	commitTimeIngest  = "ingest"  // when the patch is created (playlists keep their sequence)
+	commitTimePublish = "publish" // when the video was published
+)
+
+// pipelineItem is one video to process, with the position it should take
+// in the commit sequence
+type pipelineItem struct {
+	URL           string
+	VideoID       string
+	PlaylistID    string
+	PlaylistIndex int
+	PublishedAt   time.Time
+	Sequence      int
+
+	// Title and Duration are known when a listing provided them
+	Title    string
+	Duration time.Duration
+}
+
+// patchCommit controls how an item's patch is committed: its timestamp
+// (zero means "now") and extra patch metadata
+type patchCommit struct {
+	Timestamp time.Time
+	Metadata  map[string]interface{}
+}
+
+// isPlaylistURL reports whether rawURL names a playlist rather than a
+// single video: a YouTube playlist, or a collection on another site such
+// as a SoundCloud set or Vimeo showcase. Watch URLs that carry a list=
+// parameter are treated as the video alone, matching yt-dlp's
+// --no-playlist.
+func isPlaylistURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if strings.TrimSuffix(u.Path, "/") == "/playlist" && u.Query().Get("list") != "" {
+		return true
+	}
+	return isSitePlaylist(siteForURL(rawURL), u.Path)
+}
+
+// expandPlaylist lists a playlist's videos with yt-dlp. Publish dates need
+// full metadata for every entry, so they're only fetched when withDates is
+// set; flat listings are much faster.
+func expandPlaylist(ctx context.Context, playlistURL string, withDates bool) ([]pipelineItem, error) {
+	args := []string{"--dump-single-json", "--skip-download", "--quiet"}
+	if !withDates {
+		args = append(args, "--flat-playlist")
+	}
+	args = append(args, playlistURL)
+
+	c, cleanup := ytDlpCommand(ctx, args...)
+	defer cleanup()
+	out, err := c.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var stderr string
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = string(exitErr.Stderr)
+		}
+		return nil, fmt.Errorf("failed to list playlist %s: %w", playlistURL, ytDlpError(err, stderr))
+	}
+
+	var playlist struct {
+		ID      string `json:"id"`
+		Entries []struct {
+			ID            string  `json:"id"`
+			URL           string  `json:"url"`
+			WebpageURL    string  `json:"webpage_url"`
+			PlaylistIndex int     `json:"playlist_index"`
+			UploadDate    string  `json:"upload_date"`
+			Timestamp     int64   `json:"timestamp"`
+			Title         string  `json:"title"`
+			Duration      float64 `json:"duration"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(out, &playlist); err != nil {
+		return nil, fmt.Errorf("failed to parse playlist %s: %w", playlistURL, err)
+	}
+
+	items := make([]pipelineItem, 0, len(playlist.Entries))
+	for i, e := range playlist.Entries {
+		if e.ID == "" {
+			continue
+		}
+		// Flat listings give each entry's page as url, full ones as
+		// webpage_url; YouTube's older listings gave only the ID
+		entryURL := orDefault(e.WebpageURL, e.URL)
+		if siteForURL(entryURL) == "" {
+			if siteForURL(playlistURL) != siteYouTube {
+				continue
+			}
+			entryURL = "https://www.youtube.com/watch?v=" + e.ID
+		}
+		item := pipelineItem{
+			URL:           entryURL,
+			VideoID:       e.ID,
+			PlaylistID:    playlist.ID,
+			PlaylistIndex: e.PlaylistIndex,
+			Title:         e.Title,
+			Duration:      time.Duration(e.Duration * float64(time.Second)),
+		}
+		if item.PlaylistIndex == 0 {
+			item.PlaylistIndex = i + 1
+		}
+		if e.Timestamp > 0 {
+			item.PublishedAt = time.Unix(e.Timestamp, 0).UTC()
+		} else if t, err := time.Parse("20060102", e.UploadDate); err == nil {
+			item.PublishedAt = t
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// orderItems sorts items in place by the given mode. Items without a known
+// publish date sort after dated ones, keeping their relative order.
+func orderItems(items []pipelineItem, order string) {
+	switch order {
+	case orderPlaylist:
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].PlaylistIndex < items[j].PlaylistIndex
+		})
+	case orderPublish:
+		sort.SliceStable(items, func(i, j int) bool {
+			a, b := items[i].PublishedAt, items[j].PublishedAt
+			if a.IsZero() || b.IsZero() {
+				return !a.IsZero() && b.IsZero()
+			}
+			return a.Before(b)
+		})
+	}
+}
+
+// expandPipelineArgs turns the pipeline's arguments into ordered items,
+// expanding playlist URLs and numbering every item's commit sequence.
+// withDates fetches publish dates even when the order doesn't need them.
+func expandPipelineArgs(ctx context.Context, args []string, order string, withDates bool) ([]pipelineItem, error) {
+	switch order {
+	case orderPlaylist, orderPublish, orderInput:
+	default:
+		return nil, fmt.Errorf("unknown order %q (use playlist, publish or input)", order)
+	}
+
+	var items []pipelineItem
+	for _, arg := range args {
+		if !isPlaylistURL(arg) {
+			items = append(items, pipelineItem{URL: arg})
+			continue
+		}
+
+		fmt.Printf("Listing playlist: %s\n", arg)
+		entries, err := expandPlaylist(ctx, arg, withDates || order == orderPublish)
+		if err != nil {
+			return nil, err
+		}
+		orderItems(entries, order)
+		fmt.Printf("  ✓ %d videos, ordered by %s\n", len(entries), order)
+		items = append(items, entries...)
+	}
+
+	for i := range items {
+		items[i].Sequence = i + 1
+	}
+	return items, nil
+}
+
+// commitFor derives an item's commit from its position. Playlist items are
+// stamped run start + sequence so their order in the graph follows the
+// playlist no matter how long each one takes to download and transcribe.
+// With --commit-time publish, items are stamped with their publish date
+// instead; the sequence offset keeps same-day uploads in order.
+func (r *pipelineRun) commitFor(item pipelineItem) patchCommit {
+	commit := patchCommit{Metadata: map[string]interface{}{}}
+	if item.PlaylistID != "" {
+		commit.Timestamp = r.startedAt.Add(time.Duration(item.Sequence) * time.Millisecond)
+		commit.Metadata["playlist-id"] = item.PlaylistID
+		commit.Metadata["playlist-index"] = item.PlaylistIndex
+		commit.Metadata["sequence"] = item.Sequence
+	}
+
+	if r.commitTime == commitTimePublish && !item.PublishedAt.IsZero() {
+		commit.Timestamp = item.PublishedAt.Add(time.Duration(item.Sequence) * time.Millisecond)
+		commit.Metadata["published-at"] = item.PublishedAt.Format(time.RFC3339)
+		commit.Metadata["ingested-at"] = time.Now().UTC().Format(time.RFC3339)
+	}
+	return commit
+}
+
+// publishedAtFromInfo reads a video's publish time from yt-dlp's
+// .info.json metadata, preferring the exact timestamp over upload_date
+func publishedAtFromInfo(info map[string]interface{}) time.Time {
+	if ts, ok := info["timestamp"].(float64); ok && ts > 0 {
+		return time.Unix(int64(ts), 0).UTC()
+	}
+	if day, ok := info["upload_date"].(string); ok {
+		if t, err := time.Parse("20060102", day); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
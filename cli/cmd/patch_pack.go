@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Patch packs store many patches in one compact binary file: a header
+// followed by a CBOR sequence (RFC 8742) with one item per patch. Each
+// item is the patch's JSON form (the same keys as a patch .json file) in
+// CBOR, so any CBOR library can read a pack, and packs are read one
+// patch at a time instead of parsed whole.
+const (
+	patchPackExt    = ".vkmpack"
+	patchPackHeader = "VKMPACK1\n"
+)
+
+// patchPackWriter writes patches to a pack
+type patchPackWriter struct {
+	w   *bufio.Writer
+	buf bytes.Buffer
+}
+
+// newPatchPackWriter starts a pack on w
+func newPatchPackWriter(w io.Writer) (*patchPackWriter, error) {
+	pw := &patchPackWriter{w: bufio.NewWriter(w)}
+	if _, err := pw.w.WriteString(patchPackHeader); err != nil {
+		return nil, fmt.Errorf("failed to write pack header: %w", err)
+	}
+	return pw, nil
+}
+
+// Write appends a patch to the pack
+func (pw *patchPackWriter) Write(p *Patch) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal patch %s: %w", p.ID, err)
+	}
+	pw.buf.Reset()
+	if err := jsonToCBOR(data, &pw.buf); err != nil {
+		return fmt.Errorf("failed to encode patch %s: %w", p.ID, err)
+	}
+	if _, err := pw.w.Write(pw.buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write patch %s: %w", p.ID, err)
+	}
+	return nil
+}
+
+// Close flushes the pack; it doesn't close the underlying writer
+func (pw *patchPackWriter) Close() error {
+	if err := pw.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write pack: %w", err)
+	}
+	return nil
+}
+
+// patchPackReader reads the patches of a pack one at a time
+type patchPackReader struct {
+	r   *bufio.Reader
+	buf bytes.Buffer
+}
+
+// newPatchPackReader checks r holds a pack and returns a reader of its
+// patches
+func newPatchPackReader(r io.Reader) (*patchPackReader, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	header := make([]byte, len(patchPackHeader))
+	if _, err := io.ReadFull(br, header); err != nil || string(header) != patchPackHeader {
+		return nil, fmt.Errorf("not a patch pack")
+	}
+	return &patchPackReader{r: br}, nil
+}
+
+// Next returns the next patch of the pack, or io.EOF after the last
+func (pr *patchPackReader) Next() (*Patch, error) {
+	if _, err := pr.r.Peek(1); err == io.EOF {
+		return nil, io.EOF
+	}
+	pr.buf.Reset()
+	if err := cborToJSON(pr.r, &pr.buf, 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("failed to decode patch: %w", err)
+	}
+	var p Patch
+	if err := json.Unmarshal(pr.buf.Bytes(), &p); err != nil {
+		return nil, fmt.Errorf("failed to decode patch: %w", err)
+	}
+	return &p, nil
+}
+
+// CBOR major types
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// cborIndefinite is the additional info of indefinite-length items, and
+// cborBreak ends them
+const (
+	cborIndefinite = 31
+	cborBreak      = 0xff
+)
+
+// cborMaxDepth bounds nesting, so a corrupt pack can't exhaust the stack
+const cborMaxDepth = 256
+
+// jsonToCBOR encodes one JSON value as CBOR. Objects and arrays are
+// written with indefinite lengths, so the JSON is transcoded token by
+// token; integers become CBOR integers and other numbers float64s.
+func jsonToCBOR(data []byte, out *bytes.Buffer) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch v := tok.(type) {
+		case json.Delim:
+			switch v {
+			case '{':
+				out.WriteByte(cborMap<<5 | cborIndefinite)
+			case '[':
+				out.WriteByte(cborArray<<5 | cborIndefinite)
+			default:
+				out.WriteByte(cborBreak)
+			}
+		case string:
+			writeCBORHead(out, cborText, uint64(len(v)))
+			out.WriteString(v)
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				if n >= 0 {
+					writeCBORHead(out, cborUint, uint64(n))
+				} else {
+					writeCBORHead(out, cborNegInt, uint64(-1-n))
+				}
+				continue
+			}
+			f, err := v.Float64()
+			if err != nil {
+				return err
+			}
+			out.WriteByte(cborSimple<<5 | 27)
+			binary.Write(out, binary.BigEndian, math.Float64bits(f))
+		case bool:
+			if v {
+				out.WriteByte(0xf5)
+			} else {
+				out.WriteByte(0xf4)
+			}
+		case nil:
+			out.WriteByte(0xf6)
+		}
+	}
+}
+
+// writeCBORHead writes the initial bytes of an item of major type major
+// with argument n, in the shortest form
+func writeCBORHead(out *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		out.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		out.WriteByte(major<<5 | 24)
+		out.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		out.WriteByte(major<<5 | 25)
+		binary.Write(out, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		out.WriteByte(major<<5 | 26)
+		binary.Write(out, binary.BigEndian, uint32(n))
+	default:
+		out.WriteByte(major<<5 | 27)
+		binary.Write(out, binary.BigEndian, n)
+	}
+}
+
+// readCBORHead reads the initial bytes of an item: its major type, its
+// additional info (cborIndefinite for indefinite lengths) and argument
+func readCBORHead(r *bufio.Reader) (major, info byte, arg uint64, err error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b>>5, b&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == cborIndefinite:
+		return major, info, 0, nil
+	case info > 27:
+		return 0, 0, 0, fmt.Errorf("malformed CBOR (additional info %d)", info)
+	}
+	size := 1 << (info - 24)
+	var raw [8]byte
+	if _, err := io.ReadFull(r, raw[8-size:]); err != nil {
+		return 0, 0, 0, err
+	}
+	return major, info, binary.BigEndian.Uint64(raw[:]), nil
+}
+
+// cborToJSON transcodes one CBOR item from r to JSON. Byte strings become
+// base64 strings and tags are dropped, keeping their content.
+func cborToJSON(r *bufio.Reader, out *bytes.Buffer, depth int) error {
+	if depth > cborMaxDepth {
+		return fmt.Errorf("CBOR nested too deeply")
+	}
+	major, info, arg, err := readCBORHead(r)
+	if err != nil {
+		return err
+	}
+	indefinite := info == cborIndefinite
+	switch major {
+	case cborUint:
+		out.WriteString(strconv.FormatUint(arg, 10))
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return fmt.Errorf("CBOR integer out of range")
+		}
+		out.WriteString(strconv.FormatInt(-1-int64(arg), 10))
+	case cborBytes, cborText:
+		s, err := readCBORString(r, major, arg, indefinite)
+		if err != nil {
+			return err
+		}
+		if major == cborBytes {
+			s = []byte(base64.StdEncoding.EncodeToString(s))
+		}
+		quoted, err := json.Marshal(string(s))
+		if err != nil {
+			return err
+		}
+		out.Write(quoted)
+	case cborArray, cborMap:
+		open, close := byte('['), byte(']')
+		if major == cborMap {
+			open, close = '{', '}'
+		}
+		out.WriteByte(open)
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if indefinite {
+				if b, err := r.Peek(1); err != nil {
+					return err
+				} else if b[0] == cborBreak {
+					r.ReadByte()
+					break
+				}
+			}
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if major == cborMap {
+				if err := cborToJSON(r, out, depth+1); err != nil {
+					return err
+				}
+				out.WriteByte(':')
+			}
+			if err := cborToJSON(r, out, depth+1); err != nil {
+				return err
+			}
+		}
+		out.WriteByte(close)
+	case cborTag:
+		return cborToJSON(r, out, depth+1)
+	case cborSimple:
+		return writeCBORSimple(out, info, arg)
+	}
+	return nil
+}
+
+// readCBORString reads the content of a byte or text string whose head
+// has been read, joining the chunks of indefinite-length ones
+func readCBORString(r *bufio.Reader, major byte, n uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		if n > 1<<30 {
+			return nil, fmt.Errorf("CBOR string too long (%d bytes)", n)
+		}
+		s := make([]byte, n)
+		_, err := io.ReadFull(r, s)
+		return s, err
+	}
+	var s []byte
+	for {
+		if b, err := r.Peek(1); err != nil {
+			return nil, err
+		} else if b[0] == cborBreak {
+			r.ReadByte()
+			return s, nil
+		}
+		chunkMajor, chunkInfo, chunkLen, err := readCBORHead(r)
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || chunkInfo == cborIndefinite {
+			return nil, fmt.Errorf("malformed CBOR string chunk")
+		}
+		chunk, err := readCBORString(r, major, chunkLen, false)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, chunk...)
+	}
+}
+
+// writeCBORSimple writes a CBOR simple value or float as JSON; for the
+// float encodings (info 25-27) arg holds the float's bits
+func writeCBORSimple(out *bytes.Buffer, info byte, arg uint64) error {
+	var f float64
+	switch {
+	case info == 27:
+		f = math.Float64frombits(arg)
+	case info == 26:
+		f = float64(math.Float32frombits(uint32(arg)))
+	case info == 25:
+		f = halfToFloat(uint16(arg))
+	case info == cborIndefinite:
+		return fmt.Errorf("unexpected CBOR break")
+	case arg == 20:
+		out.WriteString("false")
+		return nil
+	case arg == 21:
+		out.WriteString("true")
+		return nil
+	case arg == 22, arg == 23:
+		out.WriteString("null")
+		return nil
+	default:
+		return fmt.Errorf("unsupported CBOR simple value %d", arg)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		out.WriteString("null")
+		return nil
+	}
+	out.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	return nil
+}
+
+// halfToFloat converts an IEEE 754 half-precision float
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// PatchesCmd groups commands that manage how local patches are stored
+var PatchesCmd = &cobra.Command{
+	Use:   "patches",
+	Short: "Pack local patches into compact binary files and summarize them",
+	Long: `Manage the storage of the patches under --data (sandbox runs,
+supplementary patches, imported bundles).
+
+Each patch is normally a JSON file. For large corpora, 'vkm patches pack'
+moves them into a patch pack (` + patchPackExt + `): one compact binary file
+holding the patches as a CBOR sequence, each item a patch with the same
+keys as its JSON file. Packs are typically a third smaller than the JSON
+they replace and are read one patch at a time, so 'vkm export' (and its
+--query), 'vkm cite', 'vkm graph path' and 'vkm patches stats' stream
+through them instead of parsing everything up front.
+
+Packed patches are read-only: commands that rewrite patches in place
+('vkm facts', 'vkm tag', 'vkm licenses', 'vkm enrich', 'vkm
+check-sources') only see JSON files. Unpack a pack to edit its patches.
+
+Examples:
+  vkm patches pack --data data/sandbox --remove
+  vkm patches stats
+  vkm patches unpack data/sandbox/patches.vkmpack -o data/unpacked`,
+}
+
+// PatchesPackCmd moves local patch JSON files into a pack
+var PatchesPackCmd = &cobra.Command{
+	Use:   "pack",
+	Short: "Write the patch JSON files under --data into a patch pack",
+	Long: `Write every patch JSON file under --data into one patch pack, at -o
+(default <data>/patches` + patchPackExt + `). A patch saved more than once
+is packed once. With --remove the JSON files are deleted once the pack
+is written; without it they stay, and commands reading both see each
+patch once.
+
+The pack is written to a temporary file and renamed into place, so an
+interrupted run leaves no partial pack. Packing into an existing pack's
+path replaces it; pack into a new file to keep it.`,
+	Args: cobra.NoArgs,
+	RunE: runPatchesPack,
+}
+
+// PatchesUnpackCmd writes the patches of a pack back out as JSON files
+var PatchesUnpackCmd = &cobra.Command{
+	Use:   "unpack <pack>",
+	Short: "Write the patches of a patch pack as JSON files",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runPatchesUnpack,
+}
+
+// PatchesStatsCmd summarizes the local patch store
+var PatchesStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Count the patches, facts and sources under --data",
+	Long: `Count the patches, facts, edges and sources under --data, by source
+type, with the period the patches span and the disk space of JSON files
+and packs. Patches are streamed one at a time, so this stays fast and
+small on corpora too large to load whole.`,
+	Args: cobra.NoArgs,
+	RunE: runPatchesStats,
+}
+
+var (
+	patchesDataDir string
+	patchesOutput  string
+	patchesRemove  bool
+	patchesUnpack  string
+)
+
+func init() {
+	PatchesCmd.AddCommand(PatchesPackCmd)
+	PatchesCmd.AddCommand(PatchesUnpackCmd)
+	PatchesCmd.AddCommand(PatchesStatsCmd)
+
+	PatchesPackCmd.Flags().StringVar(&patchesDataDir, "data", "data", "Directory holding local patches")
+	PatchesPackCmd.Flags().StringVarP(&patchesOutput, "output", "o", "", "Pack file to write (default <data>/patches"+patchPackExt+")")
+	PatchesPackCmd.Flags().BoolVar(&patchesRemove, "remove", false, "Delete the packed JSON files once the pack is written")
+
+	PatchesUnpackCmd.Flags().StringVarP(&patchesUnpack, "output", "o", "data/unpacked", "Directory to write <patch-id>.json files to")
+
+	PatchesStatsCmd.Flags().StringVar(&patchesDataDir, "data", "data", "Directory holding local patches")
+}
+
+func runPatchesPack(cmd *cobra.Command, args []string) error {
+	output := patchesOutput
+	if output == "" {
+		output = filepath.Join(patchesDataDir, "patches"+patchPackExt)
+	}
+	if !strings.HasSuffix(output, patchPackExt) {
+		return fmt.Errorf("pack files must end in %s, so they are found under --data", patchPackExt)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(output), ".patches-*"+patchPackExt+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create pack: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	pack, err := newPatchPackWriter(tmp)
+	if err != nil {
+		return err
+	}
+
+	var packed []string
+	var jsonBytes int64
+	seen := make(map[string]bool)
+	err = streamLocalPatches(patchesDataDir, func(path string, p *Patch) error {
+		if strings.HasSuffix(path, patchPackExt) {
+			return nil
+		}
+		if fi, err := os.Stat(path); err == nil {
+			jsonBytes += fi.Size()
+		}
+		packed = append(packed, path)
+		if seen[p.ID] {
+			return nil
+		}
+		seen[p.ID] = true
+		return pack.Write(p)
+	})
+	if err != nil {
+		return err
+	}
+	if len(packed) == 0 {
+		return fmt.Errorf("no patch JSON files found under %s", patchesDataDir)
+	}
+	if err := pack.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write pack: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), output); err != nil {
+		return fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	var packBytes int64
+	if fi, err := os.Stat(output); err == nil {
+		packBytes = fi.Size()
+	}
+	fmt.Printf("✓ Packed %d patches from %d JSON files (%s) into %s (%s)\n",
+		len(seen), len(packed), formatBytes(jsonBytes), output, formatBytes(packBytes))
+
+	if patchesRemove {
+		removed := 0
+		for _, path := range packed {
+			if err := os.Remove(path); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				continue
+			}
+			removed++
+		}
+		fmt.Printf("Removed %d JSON files\n", removed)
+	}
+	return nil
+}
+
+func runPatchesUnpack(cmd *cobra.Command, args []string) error {
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open pack: %w", err)
+	}
+	defer f.Close()
+	pack, err := newPatchPackReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	if err := os.MkdirAll(patchesUnpack, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	count := 0
+	for {
+		p, err := pack.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w (%d patches written)", args[0], err, count)
+		}
+		if _, err := savePatchFile(patchesUnpack, *p); err != nil {
+			return err
+		}
+		count++
+	}
+	fmt.Printf("✓ Wrote %d patches to %s\n", count, patchesUnpack)
+	return nil
+}
+
+// patchStoreStats are the totals of 'vkm patches stats'
+type patchStoreStats struct {
+	jsonFiles, packs     int
+	jsonBytes, packBytes int64
+	patches, copies      int
+	facts, edges         int
+	sources              map[string]bool
+	bySource             map[string]int
+	first, last          time.Time
+}
+
+func runPatchesStats(cmd *cobra.Command, args []string) error {
+	stats := patchStoreStats{sources: make(map[string]bool), bySource: make(map[string]int)}
+	seen := make(map[string]bool)
+	files := make(map[string]bool)
+	err := streamLocalPatches(patchesDataDir, func(path string, p *Patch) error {
+		if !files[path] {
+			files[path] = true
+			var size int64
+			if fi, err := os.Stat(path); err == nil {
+				size = fi.Size()
+			}
+			if strings.HasSuffix(path, patchPackExt) {
+				stats.packs++
+				stats.packBytes += size
+			} else {
+				stats.jsonFiles++
+				stats.jsonBytes += size
+			}
+		}
+		if seen[p.ID] {
+			stats.copies++
+			return nil
+		}
+		seen[p.ID] = true
+
+		stats.patches++
+		stats.facts += len(p.Facts)
+		stats.edges += len(p.Edges)
+		stats.bySource[orDefault(p.Source, "unknown")]++
+		if p.SourceID != "" {
+			stats.sources[p.SourceID] = true
+		}
+		if !p.Timestamp.IsZero() {
+			if stats.first.IsZero() || p.Timestamp.Before(stats.first) {
+				stats.first = p.Timestamp
+			}
+			if p.Timestamp.After(stats.last) {
+				stats.last = p.Timestamp
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if stats.patches == 0 {
+		fmt.Printf("No patches found under %s\n", patchesDataDir)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Patches:\t%d", stats.patches)
+	if stats.copies > 0 {
+		fmt.Fprintf(w, " (plus %d copies)", stats.copies)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Facts:\t%d\n", stats.facts)
+	fmt.Fprintf(w, "Edges:\t%d\n", stats.edges)
+	fmt.Fprintf(w, "Sources:\t%d\n", len(stats.sources))
+	if !stats.first.IsZero() {
+		fmt.Fprintf(w, "Period:\t%s → %s\n", stats.first.Local().Format("2006-01-02"), stats.last.Local().Format("2006-01-02"))
+	}
+	fmt.Fprintf(w, "JSON files:\t%d (%s)\n", stats.jsonFiles, formatBytes(stats.jsonBytes))
+	fmt.Fprintf(w, "Packs:\t%d (%s)\n", stats.packs, formatBytes(stats.packBytes))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	kinds := make([]string, 0, len(stats.bySource))
+	for kind := range stats.bySource {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return stats.bySource[kinds[i]] > stats.bySource[kinds[j]] })
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE TYPE\tPATCHES")
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "%s\t%d\n", kind, stats.bySource[kind])
+	}
+	return w.Flush()
+}
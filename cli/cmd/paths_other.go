@@ -0,0 +1,9 @@
+//go:build !windows
+
+package cmd
+
+// toolPath prepares a path for an external tool; only Windows needs
+// rewriting
+func toolPath(path string) string {
+	return path
+}
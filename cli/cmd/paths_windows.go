@@ -0,0 +1,26 @@
+//go:build windows
+
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the classic Win32 path limit that many external tools still
+// enforce
+const maxPath = 260
+
+// toolPath prepares a path for an external tool. Go handles long paths
+// itself, but yt-dlp, ffmpeg and whisper need the \\?\ prefix to open
+// paths beyond MAX_PATH.
+func toolPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil || len(abs) < maxPath || strings.HasPrefix(abs, `\\?\`) {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
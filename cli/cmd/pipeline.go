@@ -2,28 +2,52 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 )
 
 var (
-	pipelineOutputDir string
+	pipelineOutputDir  string
 	pipelineBackendURL string
-	pipelineKeepFiles bool
+	pipelineKeepFiles  bool
+	pipelineSandbox    bool
+	pipelineSandboxDir string
+	pipelineManifest   string
+	pipelineComments   int
+	pipelineOrder      string
+	pipelineCommitTime string
+	pipelineNames      string
+	pipelineCaptions   bool
+	pipelineStrategy   string
+
+	pipelineExtractModel  string
+	pipelineSplitChapters bool
+	pipelineWaitBackend   time.Duration
+	pipelineRetryFailed   bool
+	pipelineDiarize       bool
+	pipelineSpeakers      int
 )
 
 // PipelineCmd runs the complete end-to-end pipeline
 var PipelineCmd = &cobra.Command{
-	Use:   "pipeline [youtube-url...]",
+	Use:   "pipeline [media-url...|-]",
 	Short: "Run complete pipeline: download → transcribe → extract → visualize",
-	Long: `Run the complete end-to-end pipeline for YouTube videos or playlists.
+	Long: `Run the complete end-to-end pipeline for YouTube videos or playlists, or
+media on any other site yt-dlp supports: SoundCloud tracks and sets,
+Vimeo videos and showcases, podcasts and more (see 'vkm download-simple
+--help'). Comments (--comments) are only fetched for YouTube videos.
 
 Steps:
 1. Download video(s) using yt-dlp
@@ -41,175 +65,1007 @@ Requires:
 Examples:
   vkm-cli pipeline "https://youtube.com/watch?v=..."
   vkm-cli pipeline "https://youtube.com/playlist?list=..." --keep-files
-  vkm-cli pipeline <url> --backend http://my-server:3000`,
-	Args: cobra.MinimumNArgs(1),
+  vkm-cli pipeline <url> --backend http://my-server:3000
+  vkm-cli pipeline --from-file urls.txt --prefer-captions
+  vkm-cli pipeline "https://youtube.com/playlist?list=..." --dry-run
+  vkm-cli pipeline --retry-failed
+
+Items that fail are recorded in the manifest and queued for retry.
+--retry-failed adds the retry queue to the run (with no URLs, runs only
+it); items are given up on after three attempts and wait on
+'vkm failed list' for triage.
+
+The backend's /health is checked before anything is downloaded. Where
+the backend starts alongside the pipeline (docker-compose, CI),
+--wait-for-backend 60s polls it with backoff for up to that long instead
+of failing at once.
+
+A transcript the backend (or a proxy in front of it) refuses as too
+large (413) is split in two at the paragraph or sentence boundary
+nearest its middle, again as often as needed, and each part stored as
+its own patch. The parts share a "split-parent" ID in their metadata and
+are numbered by "split-part" (1, 2, 2.1, ...), so they can be found
+together.
+
+Playlist URLs are expanded and their videos processed one by one in
+--order: playlist index (default), publish date, or input order as listed.
+Each patch is committed with a timestamp and "sequence" metadata derived
+from that position, so lecture 1 precedes lecture 12 in the graph.
+
+Backfills of older videos can use --commit-time publish to timestamp each
+patch with the video's publish date instead of the ingestion time, so the
+knowledge-evolution timeline reflects when claims were made. The
+ingestion time is kept in the patch metadata.
+
+With --prefer-captions, videos with manual or automatic captions in
+--caption-langs skip download and Whisper: the captions are converted to a
+transcript JSON under <output>/transcripts and sent for extraction as is.
+Videos without captions are downloaded and transcribed as usual.
+
+Downloaded audio is named with --name-template, or --site-name-template
+for the site it comes from, and transcripts mirror those names under
+<output>/transcripts (see 'vkm download-simple --help'). With --layout
+per-video, each video's audio, metadata and transcript.json share a
+directory under <output>/videos instead, and cleanup after processing
+removes the whole directory.
+
+Processed videos are added to the download archive shared with
+download-simple and download-playlist (--download-archive), and videos it
+lists are skipped unless --force is given.
+
+Sandbox mode (--sandbox) runs every stage but extracts facts locally with
+CLAUDE_API_KEY and writes patches to a per-run directory under --sandbox-dir
+instead of the backend, so new sources can be validated end-to-end without
+touching the shared graph:
+  vkm-cli pipeline <url> --sandbox --sandbox-dir data/sandbox
+
+Each sandbox run records its configuration (--extract-model, --strategy,
+prompt version, --prefer-captions) and each source's fact count,
+extraction time and Claude cost in run.json, so two runs over the same
+inputs can be compared with 'vkm runs compare'. --extract-model picks the
+Claude model sandbox runs extract with; the backend uses its own. Name an
+Ollama model as ollama:<model> to extract on a local Ollama server
+(OLLAMA_HOST, default localhost:11434) without CLAUDE_API_KEY.
+
+Audio is transcribed with the Whisper API by default. --transcriber local
+runs the whisper CLI instead (pip install openai-whisper), with
+--whisper-model on --device, and --transcriber whisper.cpp runs
+whisper.cpp with no Python (see 'vkm transcribe --help'); neither needs
+OPENAI_API_KEY. --transcriber deepgram transcribes with Deepgram, which
+is much cheaper for long audio and can label speakers, and --transcriber
+assemblyai with AssemblyAI.
+
+` + diarizeHelp + ` Patches of diarized transcripts list their
+speakers in a "speakers" metadata field.
+
+` + timestampsHelp + ` Patches of such transcripts
+say so with "timestamps": "word" in their metadata.
+
+` + deepgramHelp + `
+
+` + assemblyAIHelp + `
+
+Facts are extracted from each transcript in one pass by default. With
+--strategy two-pass, a first pass outlines the transcript (sections, main
+claims, the people and terms they refer to) and a second pass extracts
+facts chunk by chunk with the outline as context, which keeps claims in
+long talks and lectures self-contained and coherent at the cost of more
+API calls. The backend, or the sandbox's local extraction, runs the
+chosen strategy; two-pass sandbox patches keep the outline in their
+metadata.
+
+Comment ingestion (--comments N) fetches a video's top N comments with the
+YouTube Data API (YOUTUBE_API_KEY), extracts claims from the substantive
+ones with a smaller Claude model (CLAUDE_API_KEY) and keeps them as a
+separate low-trust patch: confidences are halved and facts are tagged
+"supplementary". Sandbox runs save it with the run's patches; otherwise it
+is written to <output>/supplementary, since the backend only accepts raw
+documents.
+
+Videos with chapters (from yt-dlp, or chapter markers in the
+description) have them kept in the transcript JSON and in the patch
+metadata. Sandbox runs extract facts chapter by chapter
+(--split-chapters, on by default), attributing each fact to its chapter
+title and placing it at the chapter's start, so facts can be traced to
+the part of a talk they came from. With Whisper, transcripts are
+requested with timestamps (whisper-1) so they can be split; the backend
+receives the chapters in the patch metadata.
+
+Recordings longer than --chunk-length (default 1h), such as Twitch VODs
+of multi-hour streams, are split with ffmpeg into chunks of that length,
+re-encoded as mono MP3 small enough for the Whisper API, and transcribed
+one by one; the transcript's timestamps run through the whole recording.
+Chunks run 10 seconds into each other so no word is lost at a cut, and
+the repeated speech is removed when they are stitched together. Files
+over the API's 25MB upload limit are chunked whatever their length.
+Twitch VODs keep their chapters, the game or category streamed in each
+part, with consecutive chapters of the same title merged. Twitch clips
+(clips.twitch.tv, twitch.tv/<channel>/clip/...) are processed like
+videos, and a channel's VOD list (twitch.tv/<channel>/videos) like a
+playlist.
+
+` + dryRunHelp + `
+
+` + urlListHelp + `
+
+` + sponsorBlockHelp + `
+
+` + durationFilterHelp + `
+
+` + qualityGatesHelp + `
+
+` + profileHelp,
 	RunE: runPipeline,
 }
 
 func init() {
 	PipelineCmd.Flags().StringVarP(&pipelineOutputDir, "output", "o", "data/pipeline", "Working directory for pipeline files")
 	PipelineCmd.Flags().StringVarP(&pipelineBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	PipelineCmd.Flags().DurationVar(&pipelineWaitBackend, "wait-for-backend", 0, "Wait up to this long (e.g. 60s) for the backend to become healthy")
 	PipelineCmd.Flags().BoolVarP(&pipelineKeepFiles, "keep-files", "k", false, "Keep downloaded videos and transcripts after processing")
+	PipelineCmd.Flags().BoolVar(&pipelineSandbox, "sandbox", false, "Write patches to a local sandbox directory instead of the backend")
+	PipelineCmd.Flags().StringVar(&pipelineSandboxDir, "sandbox-dir", "data/sandbox", "Root directory for sandbox runs")
+	PipelineCmd.Flags().StringVar(&pipelineManifest, "manifest", "data/manifest.db", "SQLite manifest recording item progress")
+	PipelineCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	PipelineCmd.Flags().StringVar(&pipelineOrder, "order", orderPlaylist, "Commit order for playlist videos (playlist, publish, input)")
+	PipelineCmd.Flags().StringVar(&pipelineNames, "name-template", defaultNameTemplate, "Go template for downloaded and transcript file names")
+	PipelineCmd.Flags().StringVar(&outputLayout, "layout", layoutFlat, "Output layout: flat, or per-video for a directory of files per video")
+	PipelineCmd.Flags().StringToStringVar(&siteNameTemplates, "site-name-template", nil, "Name template for one site, as site=template (repeatable)")
+	PipelineCmd.Flags().StringVar(&pipelineCommitTime, "commit-time", commitTimeIngest, "Patch timestamp source (ingest, publish)")
+	PipelineCmd.Flags().IntVar(&pipelineComments, "comments", 0, "Ingest facts from the top N comments per video (0 disables)")
+	PipelineCmd.Flags().BoolVar(&pipelineCaptions, "prefer-captions", false, "Use existing YouTube captions instead of downloading and transcribing audio")
+	PipelineCmd.Flags().StringVar(&captionLangs, "caption-langs", defaultCaptionLangs, "Caption languages to accept, as yt-dlp --sub-langs")
+	PipelineCmd.Flags().StringVar(&downloadArchivePath, "download-archive", defaultDownloadArchive, "File listing completed videos to skip")
+	PipelineCmd.Flags().BoolVar(&downloadForce, "force", false, "Process videos even if the download archive lists them")
+	PipelineCmd.Flags().StringVar(&pipelineStrategy, "strategy", extractStrategySingle, "Fact extraction strategy (single, two-pass)")
+	PipelineCmd.Flags().StringVar(&pipelineExtractModel, "extract-model", claudeModel, "Claude model, or ollama:<model>, for sandbox fact extraction (with --sandbox)")
+	PipelineCmd.Flags().StringVar(&pipelineTranscriber, "transcriber", transcriberAPI, "Transcribe with the Whisper API (api), Deepgram (deepgram), AssemblyAI (assemblyai), the local whisper CLI (local) or whisper.cpp")
+	PipelineCmd.Flags().StringVar(&deepgramConfigPath, "deepgram-config", defaultDeepgramConfig, "YAML file of Deepgram settings (with --transcriber deepgram)")
+	PipelineCmd.Flags().StringVar(&pipelineWhisperModel, "whisper-model", "base", "Model of local transcription (with --transcriber local or whisper.cpp)")
+	PipelineCmd.Flags().StringVar(&device, "device", "cpu", "Device the local whisper CLI runs on (cpu or cuda)")
+	PipelineCmd.Flags().BoolVar(&pipelineDiarize, "diarize", false, "Label the speaker of each transcript segment")
+	PipelineCmd.Flags().IntVar(&pipelineSpeakers, "speakers", 0, "Number of speakers to diarize Whisper transcripts for (with --diarize; 0 detects it)")
+	PipelineCmd.Flags().StringVar(&timestampGranularity, "timestamps", timestampsSegment, "Timestamp granularity: segment, or word to also time each word")
+	PipelineCmd.Flags().StringVar(&runProfileName, "profile", "", "Preset of flags to apply (gpu)")
+	PipelineCmd.Flags().StringVar(&sponsorBlockCategories, "sponsorblock-remove", defaultSponsorBlockCategories, "SponsorBlock categories to cut from audio and captions (none keeps videos whole)")
+	PipelineCmd.Flags().BoolVar(&pipelineSplitChapters, "split-chapters", true, "Extract sandbox facts chapter by chapter for videos with chapters")
+	PipelineCmd.Flags().DurationVar(&pipelineChunkLength, "chunk-length", defaultChunkLength, "Transcribe recordings longer than this in chunks of this length (0 sends them whole)")
+	PipelineCmd.Flags().StringVar(&pipelineQualityGates, "quality-gates", defaultQualityGates, "YAML file of quality gates that flag processed items as needing attention")
+	PipelineCmd.Flags().DurationVar(&minDuration, "min-duration", 0, "Skip videos shorter than this (e.g. 2m)")
+	PipelineCmd.Flags().DurationVar(&maxDuration, "max-duration", 0, "Skip videos longer than this (e.g. 3h)")
+	PipelineCmd.Flags().StringVar(&urlListFile, "from-file", "", "Read more video or playlist URLs from this file, one per line (- for stdin)")
+	PipelineCmd.Flags().BoolVar(&pipelineRetryFailed, "retry-failed", false, "Also retry the failed items queued for retry in the manifest (see 'vkm failed')")
+	PipelineCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the videos that would be processed, without processing them")
 }
 
 func runPipeline(cmd *cobra.Command, args []string) error {
-	// Check prerequisites
-	if err := checkPipelinePrerequisites(); err != nil {
+	if err := applyProfile(cmd); err != nil {
+		return err
+	}
+	if pipelineRetryFailed {
+		retries, err := failedRetryURLs()
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 && urlListFile == "" && len(retries) == 0 {
+			fmt.Println("No failed items to retry")
+			return nil
+		}
+		args = append(args, retries...)
+	}
+	args, err := expandURLArgs(args)
+	if err != nil {
+		return err
+	}
+
+	// Check prerequisites; a dry run only lists videos and needs no keys
+	// or backend
+	if dryRun {
+		if err := checkYtDlpInstalled(); err != nil {
+			return err
+		}
+	} else if err := checkPipelinePrerequisites(cmd.Context()); err != nil {
+		return err
+	}
+	if err := checkMediaURLs(args, ytDlpDownloader{}); err != nil {
+		return err
+	}
+
+	if pipelineCommitTime != commitTimeIngest && pipelineCommitTime != commitTimePublish {
+		return fmt.Errorf("unknown commit time %q (use ingest or publish)", pipelineCommitTime)
+	}
+	if err := checkExtractStrategy(pipelineStrategy); err != nil {
+		return err
+	}
+	if err := checkDurationLimits(); err != nil {
 		return err
 	}
+	if pipelineExtractModel != claudeModel && !pipelineSandbox {
+		return fmt.Errorf("--extract-model only applies to --sandbox runs; the backend extracts with its own model")
+	}
 
-	// Create working directories
-	videoDir := filepath.Join(pipelineOutputDir, "videos")
-	transcriptDir := filepath.Join(pipelineOutputDir, "transcripts")
+	items, err := expandPipelineArgs(cmd.Context(), args, pipelineOrder, pipelineCommitTime == commitTimePublish)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return dryRunPipeline(cmd.Context(), items)
+	}
+	if items, err = applyDurationLimits(cmd.Context(), items); err != nil {
+		return err
+	}
 
-	for _, dir := range []string{videoDir, transcriptDir} {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	run, err := newPipelineRun(pipelineOutputDir)
+	if err != nil {
+		return err
+	}
+	defer run.Close()
+
+	// Like the manifest, the archive only tracks real runs
+	var archive *downloadArchive
+	if run.sandbox == nil {
+		if archive, err = openDownloadArchive(downloadArchivePath); err != nil {
+			return err
 		}
 	}
 
 	fmt.Println("=== VKM Graph Pipeline ===")
-	fmt.Printf("Backend: %s\n", pipelineBackendURL)
+	if run.sandbox != nil {
+		fmt.Printf("Sandbox: %s (backend will not be contacted)\n", run.sandbox.Dir)
+	} else {
+		fmt.Printf("Backend: %s\n", pipelineBackendURL)
+	}
 	fmt.Printf("Working directory: %s\n\n", pipelineOutputDir)
 
-	totalProcessed := 0
+	totalProcessed, archived := 0, 0
+
+	for _, item := range items {
+		if archive.Skip(item) {
+			fmt.Printf("Skipping %s (in download archive; use --force to process again)\n\n", item.URL)
+			archived++
+			continue
+		}
+		result, err := run.processItem(cmd.Context(), item)
+		if err != nil {
+			if cmd.Context().Err() != nil {
+				fmt.Println("Interrupted")
+				break
+			}
+			continue
+		}
+		archive.Add(item, result.VideoID)
+		totalProcessed++
+	}
+	run.checkRunGates()
+
+	fmt.Printf("=== Pipeline Complete ===\n")
+	fmt.Printf("Successfully processed: %d/%d\n", totalProcessed, len(items)-archived)
+	if archived > 0 {
+		fmt.Printf("Skipped (download archive): %d\n", archived)
+	}
+	if run.attention > 0 {
+		fmt.Printf("Needing attention: %d (see 'vkm report attention')\n", run.attention)
+	}
+
+	if pipelineKeepFiles {
+		fmt.Printf("Files saved to: %s\n", pipelineOutputDir)
+	}
+	if run.sandbox != nil {
+		fmt.Printf("Sandbox patches saved to: %s\n", run.sandbox.Dir)
+	}
+
+	return nil
+}
+
+// pipelineRun holds the state shared by every item processed in one
+// invocation (or by one serve process)
+type pipelineRun struct {
+	videoDir         string
+	transcriptDir    string
+	supplementaryDir string
+	sandbox          *sandbox
+	manifest         *Manifest
+	youtube          *youtubeDataClient
+	quota            *Manifest
+	startedAt        time.Time
+	commitTime       string
+	names            *nameTemplate
+	gates            *qualityGates
+
+	// extractions and extractionErrors count the items that reached fact
+	// extraction and those whose extraction failed; processed lists the
+	// URLs of items processed, and attention how many failed a gate
+	extractions      int
+	extractionErrors int
+	processed        []string
+	attention        int
+}
+
+// pipelineResult describes a successfully processed item
+type pipelineResult struct {
+	VideoID    string
+	PatchID    string
+	FactsCount int
+}
+
+// newPipelineRun prepares working directories under outputDir and opens the
+// sandbox or manifest according to the pipeline flags
+func newPipelineRun(outputDir string) (*pipelineRun, error) {
+	run := &pipelineRun{
+		videoDir:         filepath.Join(outputDir, "videos"),
+		transcriptDir:    filepath.Join(outputDir, "transcripts"),
+		supplementaryDir: filepath.Join(outputDir, "supplementary"),
+		startedAt:        time.Now().UTC(),
+		commitTime:       pipelineCommitTime,
+	}
+
+	for _, dir := range []string{run.videoDir, run.transcriptDir, run.supplementaryDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	nameTemplateText := pipelineNames
+	if nameTemplateText == "" {
+		nameTemplateText = defaultNameTemplate
+	}
+	names, err := parseSiteNameTemplates(nameTemplateText, siteNameTemplates)
+	if err != nil {
+		return nil, err
+	}
+	if err := names.setLayout(outputLayout); err != nil {
+		return nil, err
+	}
+	run.names = names
+	if run.gates, err = loadQualityGates(pipelineQualityGates); err != nil {
+		return nil, err
+	}
+
+	if pipelineSandbox {
+		if run.sandbox, err = newSandbox(pipelineSandboxDir); err != nil {
+			return nil, err
+		}
+		if err := run.sandbox.StartRun(sandboxRunConfig()); err != nil {
+			return nil, err
+		}
+	} else {
+		// Sandbox runs stay out of the manifest so they never mark real
+		// items as processed
+		if run.manifest, err = openManifest(pipelineManifest); err != nil {
+			return nil, err
+		}
+	}
+
+	if pipelineComments > 0 {
+		// Data API quota is shared, so even sandbox runs account for it
+		run.quota = run.manifest
+		if run.quota == nil {
+			if run.quota, err = openManifest(pipelineManifest); err != nil {
+				run.Close()
+				return nil, err
+			}
+		}
+		if run.youtube, err = newYouTubeDataClient(context.Background(), youtubeAPIKey(), run.quota); err != nil {
+			run.Close()
+			return nil, err
+		}
+	}
+
+	return run, nil
+}
 
-	for _, url := range args {
-		fmt.Printf("Processing: %s\n", url)
+// Close releases the run's manifest handles
+func (r *pipelineRun) Close() error {
+	if r.quota != nil && r.quota != r.manifest {
+		r.quota.Close()
+	}
+	if r.manifest != nil {
+		return r.manifest.Close()
+	}
+	return nil
+}
+
+// processURL processes a single URL outside of any playlist ordering
+func (r *pipelineRun) processURL(ctx context.Context, url string) (*pipelineResult, error) {
+	return r.processItem(ctx, pipelineItem{URL: url})
+}
+
+// processItem runs download → transcribe → extract for a single item,
+// reporting progress on stdout and recording each stage in the manifest.
+// Canceling ctx stops the current stage, removes partial outputs and
+// records the item as canceled.
+func (r *pipelineRun) processItem(ctx context.Context, item pipelineItem) (*pipelineResult, error) {
+	url := item.URL
+	fmt.Printf("Processing: %s\n", url)
+	recordItem(r.manifest, ManifestItem{URL: url, State: ItemPending})
+
+	var partials []string
+	fail := func(format string, err error) (*pipelineResult, error) {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			fmt.Fprintf(os.Stderr, "  ✗ Canceled\n")
+			r.removePartials(partials)
+			recordItem(r.manifest, ManifestItem{URL: url, State: ItemCanceled, Error: err.Error()})
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, format, err)
+		recordItem(r.manifest, ManifestItem{URL: url, State: ItemFailed, Error: err.Error()})
+		warnIfExhausted(r.manifest, url)
+		return nil, err
+	}
+
+	var videoFile, videoID, infoPath, transcript, transcriptFile, sidecarFile string
+	var parsed *Transcript
 
+	// A transcript imported with 'vkm import-transcript' replaces
+	// download and Whisper
+	if media, t := importedTranscript(r.manifest, item); t != nil {
+		videoID, infoPath = media.VideoID, media.InfoPath
+		transcriptFile = media.Path
+		transcript, parsed = transcriptText(t), t
+		fmt.Printf("  ✓ Using imported transcript %s: %d characters\n", transcriptFile, len(transcript))
+		recordItem(r.manifest, withCatalog(ManifestItem{URL: url, VideoID: videoID, State: ItemTranscribed}, infoPath))
+	}
+
+	// With --prefer-captions, existing captions replace download and
+	// Whisper; videos without them fall through to the usual steps
+	if pipelineCaptions && transcriptFile == "" {
+		fmt.Println("  [1/4] Fetching captions...")
+		started := time.Now()
+		media, t, err := captionTranscript(ctx, item, captionDir(r.names, r.transcriptDir, r.videoDir), captionLangs, r.names)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return fail("  ✗ Caption fetch failed: %v\n", err)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "  Warning: %v; transcribing audio instead\n", err)
+		case media == nil:
+			fmt.Println("  No captions available; transcribing audio instead")
+		default:
+			videoID, infoPath = media.VideoID, media.InfoPath
+			transcriptFile = media.Path
+			transcript, parsed = transcriptText(t), t
+			partials = append(partials, transcriptFile, infoPath)
+			fmt.Printf("  ✓ Transcript from %s captions: %d characters\n", orDefault(t.Language, "unknown-language"), len(transcript))
+			timeUsageStage(usageStageCaptions, started)
+			recordItem(r.manifest, withCatalog(ManifestItem{URL: url, VideoID: videoID, State: ItemTranscribed, TranscriptPath: transcriptFile, TranscriptModel: transcriptFromCaptions}, infoPath))
+		}
+	}
+
+	if transcriptFile == "" {
 		// Step 1: Download
 		fmt.Println("  [1/4] Downloading...")
-		if err := downloadVideoForPipeline(url, videoDir); err != nil {
-			fmt.Fprintf(os.Stderr, "  ✗ Download failed: %v\n", err)
-			continue
+		started := time.Now()
+		media, err := downloadVideoForPipeline(ctx, url, r.videoDir)
+		if err != nil {
+			return fail("  ✗ Download failed: %v\n", err)
 		}
-
-		// Find downloaded file
-		videoFiles, err := filepath.Glob(filepath.Join(videoDir, "*"))
-		if err != nil || len(videoFiles) == 0 {
-			fmt.Fprintf(os.Stderr, "  ✗ No video file found\n")
-			continue
+		if err := nameDownload(r.names, r.videoDir, media); err != nil {
+			fmt.Fprintf(os.Stderr, "  Warning: %v\n", err)
 		}
-		videoFile := videoFiles[len(videoFiles)-1] // Get latest
+		partials = append(partials, media.Path, media.InfoPath)
+
+		videoFile, videoID, infoPath = media.Path, media.VideoID, media.InfoPath
 		fmt.Printf("  ✓ Downloaded: %s\n", filepath.Base(videoFile))
+		timeUsageStage(usageStageDownload, started)
+		recordItem(r.manifest, withCatalog(ManifestItem{URL: url, VideoID: videoID, State: ItemDownloaded, AudioPath: videoFile}, infoPath))
+
+		// Transcripts mirror the audio's templated name under transcriptDir
+		baseName := strings.TrimSuffix(filepath.Base(videoFile), filepath.Ext(videoFile))
+		if rel, err := filepath.Rel(r.videoDir, videoFile); err == nil {
+			baseName = strings.TrimSuffix(rel, filepath.Ext(rel))
+		}
 
 		// Step 2: Transcribe
-		fmt.Println("  [2/4] Transcribing with Whisper...")
-		transcript, err := transcribeForPipeline(videoFile)
+		fmt.Printf("  [2/4] Transcribing with %s...\n", pipelineTranscriberName())
+		started = time.Now()
+		parsed, err = transcribeForPipeline(ctx, videoFile, infoPath)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "  ✗ Transcription failed: %v\n", err)
 			if !pipelineKeepFiles {
-				os.Remove(videoFile)
+				r.removeFiles(videoFile)
 			}
-			continue
+			return fail("  ✗ Transcription failed: %v\n", err)
 		}
 
-		// Save transcript
-		baseName := strings.TrimSuffix(filepath.Base(videoFile), filepath.Ext(videoFile))
-		transcriptFile := filepath.Join(transcriptDir, baseName+".txt")
-		if err := os.WriteFile(transcriptFile, []byte(transcript), 0644); err != nil {
-			fmt.Fprintf(os.Stderr, "  ✗ Failed to save transcript: %v\n", err)
-			continue
+		transcript = transcriptText(parsed)
+
+		// Save transcript; the per-video layout keeps the timed transcript
+		// beside the audio
+		transcriptFile = filepath.Join(r.transcriptDir, baseName+".txt")
+		data := []byte(transcript)
+		if r.names.perVideo {
+			parsed.VideoID = videoID
+			transcriptFile = filepath.Join(filepath.Dir(videoFile), perVideoTranscript+".json")
+			if data, err = json.MarshalIndent(parsed, "", "  "); err != nil {
+				return fail("  ✗ Failed to save transcript: %v\n", err)
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(transcriptFile), 0755); err != nil {
+			return fail("  ✗ Failed to save transcript: %v\n", err)
+		}
+		if err := os.WriteFile(transcriptFile, data, 0644); err != nil {
+			return fail("  ✗ Failed to save transcript: %v\n", err)
+		}
+		if parsed.assemblyAI != nil {
+			if sidecarFile, err = saveAssemblyAISidecar(parsed.assemblyAI, transcriptFile); err != nil {
+				return fail("  ✗ Failed to save transcript: %v\n", err)
+			}
+			partials = append(partials, sidecarFile)
 		}
 		fmt.Printf("  ✓ Transcribed: %d characters\n", len(transcript))
+		timeUsageStage(usageStageTranscribe, started)
+		recordItem(r.manifest, ManifestItem{URL: url, State: ItemTranscribed, TranscriptPath: transcriptFile, TranscriptModel: pipelineTranscriptModel(), AudioConversion: parsed.audioConversion})
+		partials = append(partials, transcriptFile)
+	}
 
-		// Step 3: Extract facts via backend
-		fmt.Println("  [3/4] Extracting facts with Claude...")
-		patchID, factsCount, err := uploadToBackend(transcript, baseName)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "  ✗ Fact extraction failed: %v\n", err)
-			if !pipelineKeepFiles {
-				os.Remove(videoFile)
-				os.Remove(transcriptFile)
-			}
-			continue
+	if r.commitTime == commitTimePublish && item.PublishedAt.IsZero() {
+		if info, err := loadVideoMetadata(infoPath); err == nil {
+			item.PublishedAt = publishedAtFromInfo(info)
+		}
+		if item.PublishedAt.IsZero() {
+			fmt.Fprintf(os.Stderr, "  Warning: publish date unknown, committing at ingestion time\n")
 		}
-		fmt.Printf("  ✓ Extracted: %d facts\n", factsCount)
+	}
 
-		// Step 4: Complete
-		fmt.Printf("  [4/4] Complete!\n")
-		fmt.Printf("  → Patch ID: %s\n", patchID)
-		fmt.Printf("  → View at: http://localhost:5173 (switch to 'Backend Data')\n\n")
+	commit := r.commitFor(item)
+	if info, err := loadVideoMetadata(infoPath); err == nil {
+		if l, ok := licenseFromInfo(info); ok {
+			commit.Metadata[metaSourceLicense] = l.metadata()
+		}
+		if thumb, _ := info["thumbnail"].(string); thumb != "" {
+			commit.Metadata["thumbnail"] = thumb
+		}
+		if d, _ := info["description"].(string); d != "" {
+			commit.Metadata["description"] = d
+		}
+		if id, channelURL := channelFromInfo(info); id != "" || channelURL != "" {
+			commit.Metadata[metaChannelID] = id
+			commit.Metadata[metaChannelURL] = channelURL
+		}
+	}
+	if parsed != nil && parsed.audioConversion != "" {
+		commit.Metadata["audio-conversion"] = parsed.audioConversion
+	}
+	if speakers := parsed.speakers(); len(speakers) > 0 {
+		commit.Metadata["speakers"] = speakers
+	}
+	if parsed.hasWords() {
+		commit.Metadata["timestamps"] = timestampsWord
+	}
+	if parsed != nil && parsed.assemblyAI != nil {
+		if len(parsed.assemblyAI.Chapters) > 0 {
+			commit.Metadata["auto-chapters"] = parsed.assemblyAI.Chapters
+		}
+		if entities := parsed.assemblyAI.distinctEntities(); len(entities) > 0 {
+			commit.Metadata["entities"] = entities
+		}
+	}
+	var sections []chapterSection
+	if parsed != nil && len(parsed.Chapters) > 0 {
+		commit.Metadata["chapters"] = parsed.Chapters
+		if pipelineSplitChapters {
+			sections = chapterSections(parsed)
+		}
+	}
 
-		// Cleanup if not keeping files
+	// Step 3: Extract facts via backend
+	fmt.Println("  [3/4] Extracting facts with Claude...")
+	started := time.Now()
+	var patchID string
+	var factsCount int
+	var err error
+	if r.sandbox != nil {
+		patchID, factsCount, err = extractToSandbox(ctx, r.sandbox, transcript, videoID, commit, sections)
+	} else {
+		patchID, factsCount, err = uploadToBackend(ctx, transcript, videoID, commit)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			r.extractions++
+			r.extractionErrors++
+		}
 		if !pipelineKeepFiles {
-			os.Remove(videoFile)
-			os.Remove(transcriptFile)
+			r.removeFiles(videoFile, transcriptFile, sidecarFile)
 		}
+		return fail("  ✗ Fact extraction failed: %v\n", err)
+	}
+	fmt.Printf("  ✓ Extracted: %d facts\n", factsCount)
+	timeUsageStage(usageStageExtract, started)
+	recordItem(r.manifest, ManifestItem{URL: url, State: ItemProcessed, PatchID: patchID})
+	r.extractions++
+	r.checkItemGates(url, factsCount, audioDuration(infoPath, parsed), parsed)
 
-		totalProcessed++
+	if r.youtube != nil {
+		if err := r.ingestComments(ctx, videoID, patchID); err != nil {
+			fmt.Fprintf(os.Stderr, "  Warning: comment ingestion failed: %v\n", err)
+		}
 	}
 
-	fmt.Printf("=== Pipeline Complete ===\n")
-	fmt.Printf("Successfully processed: %d/%d\n", totalProcessed, len(args))
+	// Step 4: Complete
+	fmt.Printf("  [4/4] Complete!\n")
+	fmt.Printf("  → Patch ID: %s\n", patchID)
+	if r.sandbox != nil {
+		fmt.Printf("  → Sandbox patch: %s\n\n", filepath.Join(r.sandbox.Dir, "patches", patchID+".json"))
+	} else {
+		fmt.Printf("  → View at: http://localhost:5173 (switch to 'Backend Data')\n\n")
+	}
 
-	if pipelineKeepFiles {
-		fmt.Printf("Files saved to: %s\n", pipelineOutputDir)
+	// Cleanup if not keeping files
+	if !pipelineKeepFiles {
+		r.removeFiles(videoFile, transcriptFile, sidecarFile)
+	}
+
+	return &pipelineResult{VideoID: videoID, PatchID: patchID, FactsCount: factsCount}, nil
+}
+
+// ingestComments extracts supplementary facts from a video's top comments
+// and saves them as a separate low-trust patch, linked to patchID, the
+// video's own
+func (r *pipelineRun) ingestComments(ctx context.Context, videoID, patchID string) error {
+	comments, err := r.youtube.TopComments(ctx, videoID, pipelineComments)
+	if err != nil {
+		return err
+	}
+	comments = substantiveComments(comments)
+	if len(comments) == 0 {
+		fmt.Println("  ✓ Comments: nothing substantive")
+		return nil
 	}
 
+	facts, err := extractCommentFacts(ctx, videoID, comments)
+	if err != nil {
+		return err
+	}
+	if len(facts) == 0 {
+		fmt.Printf("  ✓ Comments: no claims in %d substantive comments\n", len(comments))
+		return nil
+	}
+
+	patch := newCommentPatch(videoID, patchID, facts, len(comments))
+	var path string
+	if r.sandbox != nil {
+		patch.Metadata["sandbox-run"] = r.sandbox.RunID
+		path, err = r.sandbox.SavePatch(patch)
+	} else {
+		path, err = savePatchFile(r.supplementaryDir, patch)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("  ✓ Comments: %d supplementary facts from %d comments → %s\n", len(facts), len(comments), path)
 	return nil
 }
 
-func checkPipelinePrerequisites() error {
+// removePartials deletes the outputs of a canceled item, including any
+// half-written yt-dlp downloads left in the video directory
+func (r *pipelineRun) removePartials(paths []string) {
+	leftovers, _ := filepath.Glob(filepath.Join(r.videoDir, "*.part"))
+	ytdl, _ := filepath.Glob(filepath.Join(r.videoDir, "*.ytdl"))
+	for _, path := range append(append(paths, leftovers...), ytdl...) {
+		os.Remove(path)
+	}
+	if r.names.perVideo {
+		// Directories of the per-video layout go too once empty
+		for _, path := range paths {
+			if dir := filepath.Dir(path); path != "" && dir != r.videoDir {
+				os.Remove(dir)
+			}
+		}
+	}
+}
+
+// removeFiles deletes a processed item's audio and transcript, or in the
+// per-video layout the directories holding them with everything else
+// saved for the item
+func (r *pipelineRun) removeFiles(paths ...string) {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if dir := filepath.Dir(path); r.names.perVideo && dir != r.videoDir {
+			os.RemoveAll(dir)
+			continue
+		}
+		os.Remove(path)
+	}
+}
+
+func checkPipelinePrerequisites(ctx context.Context) error {
 	// Check yt-dlp
-	if !commandExists("yt-dlp") {
-		return fmt.Errorf("yt-dlp not found. Install with: pip install yt-dlp")
+	if err := checkYtDlpInstalled(); err != nil {
+		return err
 	}
 
-	// Check OpenAI API key
-	if os.Getenv("OPENAI_API_KEY") == "" {
+	// Check the transcriber; the API one needs the OpenAI API key
+	if err := checkTranscriber(); err != nil {
+		return err
+	}
+	if pipelineTranscriber == transcriberAPI && os.Getenv("OPENAI_API_KEY") == "" {
 		return fmt.Errorf("OPENAI_API_KEY environment variable not set")
 	}
+	if err := checkTimestamps(pipelineTranscriber); err != nil {
+		return err
+	}
+	if pipelineDiarize && pipelineTranscriber != transcriberDeepgram && pipelineTranscriber != transcriberAssemblyAI {
+		if err := checkDiarizer(); err != nil {
+			return err
+		}
+	}
 
-	// Check backend health
-	resp, err := http.Get(pipelineBackendURL + "/health")
-	if err != nil {
-		return fmt.Errorf("backend not reachable at %s: %w", pipelineBackendURL, err)
+	if pipelineComments > 0 {
+		if youtubeAPIKey() == "" {
+			return fmt.Errorf("YOUTUBE_API_KEY environment variable not set (required for --comments)")
+		}
+		if os.Getenv("CLAUDE_API_KEY") == "" {
+			return fmt.Errorf("CLAUDE_API_KEY environment variable not set (required for --comments)")
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("backend health check failed (status %d)", resp.StatusCode)
+	// Sandbox runs extract locally and never talk to the backend
+	if pipelineSandbox {
+		if _, local := ollamaModel(pipelineExtractModel); !local && os.Getenv("CLAUDE_API_KEY") == "" {
+			return fmt.Errorf("CLAUDE_API_KEY environment variable not set (required for --sandbox)")
+		}
+		return nil
 	}
 
-	return nil
+	return waitForBackend(ctx, pipelineBackendURL, pipelineWaitBackend)
 }
 
-func downloadVideoForPipeline(url, outputDir string) error {
-	return downloadVideoWithYtDlp(url, outputDir)
+// Backend health polls start backendPollDelay apart and back off to
+// backendPollMaxDelay; each check gives up after backendPollTimeout
+const (
+	backendPollDelay    = 500 * time.Millisecond
+	backendPollMaxDelay = 5 * time.Second
+	backendPollTimeout  = 5 * time.Second
+)
+
+// waitForBackend checks the backend's /health, polling with backoff for
+// up to wait until it answers 200 OK. With wait 0 it checks once.
+func waitForBackend(ctx context.Context, backendURL string, wait time.Duration) error {
+	check := func() error {
+		checkCtx, cancel := context.WithTimeout(ctx, backendPollTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(checkCtx, http.MethodGet, backendURL+"/health", nil)
+		if err != nil {
+			return fmt.Errorf("invalid backend URL %s: %w", backendURL, err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("backend not reachable at %s: %w", backendURL, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("backend health check failed (status %d)", resp.StatusCode)
+		}
+		return nil
+	}
+
+	err := check()
+	if err == nil || wait <= 0 {
+		return err
+	}
+	fmt.Printf("Waiting up to %s for backend at %s...\n", wait, backendURL)
+	deadline := time.Now().Add(wait)
+	delay := backendPollDelay
+	for {
+		if time.Until(deadline) <= 0 {
+			return fmt.Errorf("backend not ready after %s: %w", wait, err)
+		}
+		timer := time.NewTimer(min(delay, time.Until(deadline)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if err = check(); err == nil {
+			fmt.Println("✓ Backend is ready")
+			return nil
+		}
+		delay = min(delay*2, backendPollMaxDelay)
+	}
+}
+
+func downloadVideoForPipeline(ctx context.Context, url, outputDir string) (*downloadedMedia, error) {
+	return downloadVideoWithYtDlp(ctx, url, outputDir)
 }
 
-func transcribeForPipeline(videoFile string) (string, error) {
+// transcribeForPipeline transcribes videoFile with the Whisper API, in
+// chunks of --chunk-length if the info.json at infoPath gives a longer
+// duration, with Deepgram or AssemblyAI, or locally, as --transcriber
+// says. Its segments are timed in the original video (SponsorBlock cuts
+// undone) and placed in the chapters of the info.json, or AssemblyAI's
+// auto-chapters.
+func transcribeForPipeline(ctx context.Context, videoFile, infoPath string) (*Transcript, error) {
+	if pipelineTranscriber == transcriberAssemblyAI {
+		if pipelineDiarize {
+			assemblyAISpeakerLabels = true
+		}
+		t, sidecar, err := requestAssemblyAITranscription(ctx, videoFile, os.Getenv("ASSEMBLYAI_API_KEY"))
+		if err != nil {
+			return nil, err
+		}
+		placeAssemblyAIInVideo(t, sidecar, infoPath)
+		t.assemblyAI = sidecar
+		return t, nil
+	}
+	if pipelineTranscriber == transcriberDeepgram {
+		settings, err := loadDeepgramSettings(deepgramConfigPath, nil)
+		if err != nil {
+			return nil, err
+		}
+		if pipelineDiarize {
+			settings.Diarize = &pipelineDiarize
+		}
+		t, err := requestDeepgramTranscription(ctx, videoFile, settings)
+		if err != nil {
+			return nil, err
+		}
+		placeInVideo(t, infoPath)
+		return t, nil
+	}
+
 	apiKey := os.Getenv("OPENAI_API_KEY")
-	return transcribeWithWhisper(videoFile, apiKey)
+	var duration float64
+	if info, err := loadVideoMetadata(infoPath); err == nil {
+		duration, _ = info["duration"].(float64)
+	}
+	var resp *WhisperResponse
+	var err error
+	switch {
+	case pipelineTranscriber == transcriberLocal || pipelineTranscriber == transcriberWhisperCpp:
+		resp, err = transcribeLocally(ctx, videoFile)
+	case pipelineChunkLength > 0 && duration > pipelineChunkLength.Seconds():
+		resp, err = transcribeInChunks(ctx, videoFile, apiKey, pipelineChunkLength)
+	default:
+		resp, err = requestWhisperTranscription(ctx, videoFile, apiKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Models without timestamps give the text alone
+	t := resp.transcript()
+	timed := len(resp.Segments) > 0
+	if pipelineDiarize {
+		// Speakers are diarized on the audio's clock, before its
+		// timestamps are moved into the video
+		if _, err := diarizeTranscript(ctx, t, videoFile, pipelineSpeakers); err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			fmt.Fprintf(os.Stderr, "  Warning: %v; transcript has no speaker labels\n", err)
+		}
+	}
+	if timed {
+		placeInVideo(t, infoPath)
+	}
+	return t, nil
 }
 
-func uploadToBackend(content, filename string) (patchID string, factsCount int, err error) {
-	reqBody, err := json.Marshal(map[string]string{
+// placeInVideo times a transcript's segments in the original video of the
+// info.json at infoPath (SponsorBlock cuts undone) and places them in its
+// chapters. Transcripts without an info.json are left as they are.
+func placeInVideo(t *Transcript, infoPath string) {
+	info, err := loadVideoMetadata(infoPath)
+	if err != nil {
+		return
+	}
+	if removed := cutSegments(info); len(removed) > 0 {
+		t.moveTimes(func(at float64) float64 { return originalVideoTime(at, removed) })
+	}
+	assignChapters(t, chaptersFromInfo(info))
+}
+
+// Backend uploads are retried up to uploadAttempts times, waiting
+// uploadRetryDelay (doubling) between attempts
+const (
+	uploadAttempts   = 3
+	uploadRetryDelay = 2 * time.Second
+)
+
+// uploadProgressThreshold is the request size from which uploads show a
+// progress bar
+const uploadProgressThreshold = 1 << 20
+
+// errUploadIncomplete marks an upload whose request body was not fully
+// sent, so the backend cannot have acted on it and it is safe to resend
+var errUploadIncomplete = errors.New("upload interrupted")
+
+// uploadToBackend sends a transcript to the backend for fact extraction.
+// Large uploads report progress on stderr, and canceling ctx aborts the
+// upload at once. The upload endpoint is not idempotent, so a request is
+// only resent when it provably did not reach the backend: the connection
+// failed before the whole body was sent, or a proxy in front of the
+// backend answered 502, 503 or 504 (or the backend 429). A transcript
+// refused as too large (413) is split and uploaded in parts instead
+// (see uploadInParts).
+func uploadToBackend(ctx context.Context, content, filename string, commit patchCommit) (patchID string, factsCount int, err error) {
+	commit = commit.withCollection()
+	upload := map[string]interface{}{
 		"content":  content,
 		"filename": filename,
-	})
+	}
+	if !commit.Timestamp.IsZero() {
+		upload["timestamp"] = commit.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	if len(commit.Metadata) > 0 {
+		upload["metadata"] = commit.Metadata
+	}
+	if pipelineStrategy != "" && pipelineStrategy != extractStrategySingle {
+		upload["strategy"] = pipelineStrategy
+	}
+
+	reqBody, err := json.Marshal(upload)
 	if err != nil {
 		return "", 0, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	resp, err := http.Post(
-		pipelineBackendURL+"/api/upload",
-		"application/json",
-		bytes.NewReader(reqBody),
-	)
+	delay := uploadRetryDelay
+	for attempt := 1; ; attempt++ {
+		patchID, factsCount, err = postUpload(ctx, reqBody)
+		if err == nil || ctx.Err() != nil || !errors.Is(err, errUploadIncomplete) || attempt == uploadAttempts {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  Warning: %v; retrying in %s (attempt %d/%d)\n", err, delay, attempt+1, uploadAttempts)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+	if ctx.Err() != nil {
+		return "", 0, fmt.Errorf("upload canceled: %w", ctx.Err())
+	}
+	if errors.Is(err, errUploadTooLarge) {
+		return uploadInParts(ctx, content, filename, commit, err)
+	}
+	return patchID, factsCount, err
+}
+
+// postUpload makes one upload request. Failures that are safe to retry
+// wrap errUploadIncomplete.
+func postUpload(ctx context.Context, reqBody []byte) (patchID string, factsCount int, err error) {
+	body := &uploadBody{r: bytes.NewReader(reqBody)}
+	if len(reqBody) >= uploadProgressThreshold {
+		body.bar = progressbar.DefaultBytes(int64(len(reqBody)), "  uploading")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", pipelineBackendURL+"/api/upload", body)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.ContentLength = int64(len(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if body.bar != nil && body.Sent() < int64(len(reqBody)) {
+		body.bar.Exit()
+	}
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to send request: %w", err)
+		if sent := body.Sent(); sent < int64(len(reqBody)) {
+			return "", 0, fmt.Errorf("%w after %d of %d bytes: %v", errUploadIncomplete, sent, len(reqBody), err)
+		}
+		// The backend may have received the transcript and stored a patch
+		return "", 0, fmt.Errorf("failed to read backend response (the patch may have been stored): %w", err)
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", 0, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", 0, fmt.Errorf("backend error (status %d): %s", resp.StatusCode, string(body))
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return "", 0, fmt.Errorf("%w: backend unavailable (status %d)", errUploadIncomplete, resp.StatusCode)
+	case http.StatusRequestEntityTooLarge:
+		return "", 0, fmt.Errorf("%w (status 413 for %d bytes)", errUploadTooLarge, len(reqBody))
+	default:
+		return "", 0, fmt.Errorf("backend error (status %d): %s", resp.StatusCode, string(respBody))
 	}
 
 	var result struct {
@@ -218,9 +1074,31 @@ func uploadToBackend(content, filename string) (patchID string, factsCount int,
 		Message    string `json:"message"`
 	}
 
-	if err := json.Unmarshal(body, &result); err != nil {
+	if err := json.Unmarshal(respBody, &result); err != nil {
 		return "", 0, fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	return result.PatchID, result.FactsCount, nil
 }
+
+// uploadBody is a request body that counts the bytes the transport has
+// read and advances an optional progress bar
+type uploadBody struct {
+	r    *bytes.Reader
+	bar  *progressbar.ProgressBar
+	sent atomic.Int64
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.sent.Add(int64(n))
+	if b.bar != nil && n > 0 {
+		b.bar.Add(n)
+	}
+	return n, err
+}
+
+// Sent returns how many bytes have been handed to the transport
+func (b *uploadBody) Sent() int64 {
+	return b.sent.Load()
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// PreviewResult is the triage summary for the opening minutes of one file
+type PreviewResult struct {
+	File            string         `json:"file"`
+	PreviewSeconds  float64        `json:"preview_seconds"`
+	TranscriptChars int            `json:"transcript_chars"`
+	Transcript      string         `json:"transcript"`
+	Facts           []Fact         `json:"facts"`
+	Topics          map[string]int `json:"topics"`
+	Score           float64        `json:"score"`
+}
+
+// trimAudio writes the first d of input to a small mono mp3 in a temp
+// directory, returning its path. The caller removes the file.
+func trimAudio(ctx context.Context, input string, d time.Duration) (string, error) {
+	tmp, err := newTempFile("preview-*.mp3")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+
+	cmd := toolCommand(ctx, "ffmpeg",
+		"-y", "-loglevel", "error",
+		"-t", fmt.Sprintf("%.0f", d.Seconds()),
+		"-i", toolPath(input),
+		"-vn", "-ac", "1", "-ar", "16000", "-b:a", "48k",
+		tmp.Name())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmp.Name())
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return tmp.Name(), nil
+}
+
+// previewFile transcribes the first d of a file and runs cheap extraction
+// over it. Score is facts per preview minute weighted by mean confidence.
+func previewFile(ctx context.Context, filePath, apiKey string, d time.Duration) (*PreviewResult, error) {
+	clip, err := trimAudio(ctx, filePath, d)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(clip)
+	// a file shorter than d gives a shorter clip; score it by its real length
+	if seconds, err := probeDuration(ctx, clip); err == nil && seconds > 0 {
+		d = min(d, time.Duration(seconds)*time.Second)
+	}
+
+	transcript, err := transcribeWithWhisper(ctx, clip, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	facts, err := extractFactsWithPrompt(ctx, claudeLightModel, fmt.Sprintf(extractionPrompt, transcript), base)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PreviewResult{
+		File:            filePath,
+		PreviewSeconds:  d.Seconds(),
+		TranscriptChars: len(transcript),
+		Transcript:      transcript,
+		Facts:           facts,
+		Topics:          make(map[string]int),
+	}
+
+	confidence := 0.0
+	for _, f := range facts {
+		confidence += f.Confidence
+		if f.Topic != "" {
+			result.Topics[f.Topic]++
+		}
+	}
+	// facts per minute × mean confidence reduces to summed confidence per minute
+	result.Score = confidence / d.Minutes()
+	return result, nil
+}
+
+// runWhisperPreview implements transcribe-whisper --preview: each file is
+// previewed, the result saved as <name>.preview.json, and files are ranked
+// by score so the most promising can be fully processed first
+func runWhisperPreview(cmd *cobra.Command, args []string, apiKey string) error {
+	if _, err := findTool("ffmpeg"); err != nil {
+		return fmt.Errorf("%w (required for --preview)", err)
+	}
+	if os.Getenv("CLAUDE_API_KEY") == "" {
+		return fmt.Errorf("CLAUDE_API_KEY environment variable not set (required for --preview)")
+	}
+
+	fmt.Printf("Previewing the first %s of %d file(s)...\n", transcribePreview, len(args))
+
+	var results []*PreviewResult
+	for i, filePath := range args {
+		fmt.Printf("[%d/%d] Previewing: %s\n", i+1, len(args), filePath)
+
+		result, err := previewFile(cmd.Context(), filePath, apiKey, transcribePreview)
+		if err != nil {
+			if cmd.Context().Err() != nil {
+				return cmd.Context().Err()
+			}
+			fmt.Fprintf(os.Stderr, "Error previewing %s: %v\n", filePath, err)
+			continue
+		}
+
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal preview: %w", err)
+		}
+		baseName := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+		outputPath := filepath.Join(transcribeOutputDir, baseName+".preview.json")
+		if err := os.WriteFile(outputPath, data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving preview %s: %v\n", outputPath, err)
+			continue
+		}
+
+		fmt.Printf("  ✓ %d facts, saved to: %s\n", len(result.Facts), outputPath)
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+
+	fmt.Printf("\nTriage ranking (facts/min × mean confidence):\n\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCORE\tFACTS\tTOP TOPICS\tFILE")
+	for _, r := range results {
+		fmt.Fprintf(w, "%.2f\t%d\t%s\t%s\n", r.Score, len(r.Facts), topTopics(r.Topics, 3), r.File)
+	}
+	return w.Flush()
+}
+
+// topTopics returns the n most frequent topics, comma separated
+func topTopics(topics map[string]int, n int) string {
+	names := make([]string, 0, len(topics))
+	for t := range topics {
+		names = append(names, t)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if topics[names[i]] != topics[names[j]] {
+			return topics[names[i]] > topics[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
@@ -19,6 +19,11 @@ This command calls the Clojure processing pipeline to:
 4. Store in Datomic
 5. Extract motives
 
+AssemblyAI sidecars beside the transcripts (<name>.assemblyai.json, from
+'vkm transcribe-assemblyai') are read with them: facts are labeled with
+the auto-chapters of transcripts without chapters of their own, and the
+patch metadata lists the detected entities.
+
 Example:
   vkm process --source my-channel --transcripts data/transcripts/my-channel`,
 	RunE: runProcess,
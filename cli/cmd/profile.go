@@ -0,0 +1,362 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Patch metadata keys of source profiles
+const (
+	metaChannelID     = "channel-id"
+	metaChannelURL    = "channel-url"
+	metaSourceProfile = "source-profile"
+	metaProfile       = "profile"
+)
+
+// profilePatchSource marks the patches holding source profiles
+const profilePatchSource = "channel-profile"
+
+// profileMaxAge is how long a source profile is kept before the channel
+// is crawled again
+const profileMaxAge = 30 * 24 * time.Hour
+
+// maxProfileDescription caps the self-description recorded for a source
+const maxProfileDescription = 1000
+
+// channelRedirectPattern matches the outbound links of a channel's about
+// page, which YouTube wraps in redirects (JSON-escaped in the page data)
+var channelRedirectPattern = regexp.MustCompile(`https://www\.youtube\.com/redirect\?[^"\s]+`)
+
+// plainURLPattern matches URLs written out in a description
+var plainURLPattern = regexp.MustCompile(`https?://[^\s"'<>()]+`)
+
+// sourceProfile is what crawling a channel's about page and the sites it
+// links to found out about who produces a source
+type sourceProfile struct {
+	ChannelID   string        `json:"channel-id"`
+	URL         string        `json:"url"`
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Links       []profileLink `json:"links,omitempty"`
+	CrawledAt   time.Time     `json:"crawled-at"`
+}
+
+// profileLink is a website a channel links to
+type profileLink struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Skipped says why the site wasn't fetched, e.g. robots.txt
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// patchChannel returns the channel ID and URL a patch's source was
+// published on: from its metadata, else from the info.json of the
+// video's download recorded in the manifest
+func patchChannel(m *Manifest, p *Patch) (id, channelURL string) {
+	id, _ = p.Metadata[metaChannelID].(string)
+	channelURL, _ = p.Metadata[metaChannelURL].(string)
+	if id != "" || channelURL != "" || p.SourceID == "" {
+		return id, channelURL
+	}
+	item, err := m.ItemByVideoID(p.SourceID)
+	if err != nil || item == nil || itemMetadataPath(item) == "" {
+		return "", ""
+	}
+	info, err := loadVideoMetadata(itemMetadataPath(item))
+	if err != nil {
+		return "", ""
+	}
+	return channelFromInfo(info)
+}
+
+// channelFromInfo reads the channel a video was published on from its
+// info.json
+func channelFromInfo(info map[string]interface{}) (id, channelURL string) {
+	id, _ = info["channel_id"].(string)
+	channelURL, _ = info["channel_url"].(string)
+	if channelURL == "" && strings.HasPrefix(id, "UC") {
+		channelURL = "https://www.youtube.com/channel/" + id
+	}
+	return id, channelURL
+}
+
+// enrichProfiles gives each channel the patches came from a source
+// profile patch under dataDir/profiles, crawling channels without a
+// recent one, and links the patches to it. It returns how many profiles
+// it crawled.
+func enrichProfiles(ctx context.Context, m *Manifest, opts enrichOptions, patches []*Patch, budget *enrichLimits, save func(*Patch) error) (int, error) {
+	type channel struct {
+		id, url string
+		patches []*Patch
+	}
+	channels := make(map[string]*channel)
+	var keys []string
+	for _, p := range patches {
+		if p.Source == profilePatchSource {
+			continue
+		}
+		if _, ok := p.Metadata["supplementary"]; ok {
+			continue
+		}
+		id, channelURL := patchChannel(m, p)
+		key := orDefault(id, channelURL)
+		if key == "" {
+			continue
+		}
+		c := channels[key]
+		if c == nil {
+			c = &channel{id: id, url: channelURL}
+			channels[key] = c
+			keys = append(keys, key)
+		}
+		c.patches = append(c.patches, p)
+	}
+	sort.Strings(keys)
+
+	dir := filepath.Join(opts.DataDir, "profiles")
+	crawler := newPoliteCrawler(opts.CrawlDelay)
+	crawled := 0
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return crawled, ctx.Err()
+		}
+		c := channels[key]
+		path := filepath.Join(dir, CleanFilename(key)+".json")
+		profilePatch, err := loadProfilePatch(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if profilePatch == nil || time.Since(profilePatch.Timestamp) > profileMaxAge {
+			if reason := budget.exhausted(); reason != "" {
+				return crawled, nil
+			}
+			profile, err := crawlChannelProfile(ctx, crawler, c.id, c.url, opts.ProfileLinks)
+			if err != nil {
+				if ctx.Err() != nil {
+					return crawled, ctx.Err()
+				}
+				fmt.Fprintf(os.Stderr, "✗ %s: profile crawl failed: %v\n", key, err)
+				continue
+			}
+			next := newProfilePatch(profile)
+			if profilePatch != nil {
+				next.ID = profilePatch.ID
+			}
+			profilePatch = &next
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return crawled, fmt.Errorf("failed to create %s: %w", dir, err)
+			}
+			if err := writePatchFile(path, next); err != nil {
+				return crawled, err
+			}
+			crawled++
+			fmt.Printf("✓ Profiled %s: %d linked sites → %s\n", orDefault(profile.Name, key), len(profile.Links), path)
+		}
+
+		for _, p := range c.patches {
+			if linked, _ := p.Metadata[metaSourceProfile].(string); linked == profilePatch.ID {
+				continue
+			}
+			if p.Metadata == nil {
+				p.Metadata = make(map[string]interface{})
+			}
+			p.Metadata[metaSourceProfile] = profilePatch.ID
+			if err := save(p); err != nil {
+				return crawled, err
+			}
+		}
+	}
+	return crawled, nil
+}
+
+// loadProfilePatch reads a profile patch, or returns nil if there is none
+func loadProfilePatch(path string) (*Patch, error) {
+	files, err := loadLocalPatchFiles(path)
+	if err != nil || len(files) == 0 {
+		if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return files[0].Patch, nil
+}
+
+// crawlChannelProfile reads a channel's name, self-description and links
+// from its about page, then the title and description of up to maxLinks
+// of the linked sites
+func crawlChannelProfile(ctx context.Context, crawler *politeCrawler, id, channelURL string, maxLinks int) (*sourceProfile, error) {
+	if channelURL == "" {
+		channelURL = "https://www.youtube.com/channel/" + id
+	}
+	aboutURL := strings.TrimSuffix(channelURL, "/") + "/about"
+	resp, err := crawler.Get(ctx, aboutURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxArticleBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", aboutURL, err)
+	}
+	root, err := html.Parse(strings.NewReader(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", aboutURL, err)
+	}
+
+	title, description := pageSummary(root)
+	profile := &sourceProfile{
+		ChannelID:   id,
+		URL:         channelURL,
+		Name:        strings.TrimSuffix(title, " - YouTube"),
+		Description: clipText(description, maxProfileDescription),
+		CrawledAt:   time.Now().UTC(),
+	}
+
+	for _, link := range channelLinks(string(body), description) {
+		if len(profile.Links) >= maxLinks {
+			break
+		}
+		l := profileLink{URL: link}
+		if resp, err := crawler.Get(ctx, link); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			l.Skipped = err.Error()
+		} else {
+			root, err := html.Parse(io.LimitReader(resp.Body, maxArticleBytes))
+			resp.Body.Close()
+			if err == nil {
+				l.Title, l.Description = pageSummary(root)
+				l.Description = clipText(l.Description, maxProfileDescription)
+			}
+		}
+		profile.Links = append(profile.Links, l)
+	}
+	return profile, nil
+}
+
+// channelLinks returns the external sites an about page links to, in
+// order and without duplicates: the page's redirect links, then URLs in
+// its description. Links back to YouTube and Google are left out.
+func channelLinks(page, description string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	add := func(raw string) {
+		u, err := url.Parse(strings.TrimRight(raw, ".,;"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		host := strings.TrimPrefix(u.Hostname(), "www.")
+		if host == "youtube.com" || host == "youtu.be" || strings.HasSuffix(host, ".youtube.com") ||
+			host == "google.com" || strings.HasSuffix(host, ".google.com") || host == "gstatic.com" {
+			return
+		}
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			links = append(links, u.String())
+		}
+	}
+	for _, raw := range channelRedirectPattern.FindAllString(page, -1) {
+		u, err := url.Parse(strings.ReplaceAll(raw, `\u0026`, "&"))
+		if err == nil {
+			add(u.Query().Get("q"))
+		}
+	}
+	for _, raw := range plainURLPattern.FindAllString(description, -1) {
+		add(raw)
+	}
+	return links
+}
+
+// pageSummary returns a page's title and description from its metadata
+func pageSummary(root *html.Node) (title, description string) {
+	meta := make(map[string]string)
+	walkHTML(root, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		switch n.DataAtom {
+		case atom.Title:
+			if title == "" {
+				title = nodeText(n)
+			}
+		case atom.Meta:
+			key := strings.ToLower(orDefault(htmlAttr(n, "property"), htmlAttr(n, "name")))
+			if key != "" && meta[key] == "" {
+				meta[key] = strings.TrimSpace(htmlAttr(n, "content"))
+			}
+		}
+		return true
+	})
+	return orDefault(meta["og:title"], title), orDefault(meta["og:description"], meta["description"])
+}
+
+// clipText shortens s to at most n bytes, at a word boundary
+func clipText(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	if i := strings.LastIndexByte(s, ' '); i > n/2 {
+		s = s[:i]
+	}
+	return s + "…"
+}
+
+// newProfilePatch records a source profile as a patch: the channel's
+// self-description and each site it links to are facts about the source,
+// and the crawl itself is kept in the metadata
+func newProfilePatch(profile *sourceProfile) Patch {
+	name := orDefault(profile.Name, profile.URL)
+	var facts []Fact
+	fact := func(text, from string) {
+		facts = append(facts, Fact{
+			ID:            newUUID(),
+			Text:          text,
+			Topic:         "source-profile",
+			Confidence:    0.9,
+			ExtractedFrom: from,
+			ValidFrom:     profile.CrawledAt,
+			Tags:          []string{"source-profile"},
+		})
+	}
+	if profile.Description != "" {
+		fact(fmt.Sprintf("The YouTube channel %s describes itself as: %s", name, profile.Description), profile.URL+"/about")
+	}
+	for _, l := range profile.Links {
+		if l.Skipped != "" {
+			continue
+		}
+		text := fmt.Sprintf("The YouTube channel %s links to %s", name, l.URL)
+		if l.Title != "" {
+			text += fmt.Sprintf(" (%s)", l.Title)
+		}
+		if l.Description != "" {
+			text += ": " + l.Description
+		}
+		fact(text, l.URL)
+	}
+
+	patch := newPatch(orDefault(profile.ChannelID, profile.URL), facts)
+	patch.Source = profilePatchSource
+	patch.Timestamp = profile.CrawledAt
+	patch.Metadata = map[string]interface{}{
+		"supplementary": profilePatchSource,
+		metaProfile:     profile,
+		"source-url":    profile.URL,
+	}
+	return patch
+}
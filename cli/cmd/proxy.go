@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// proxyURL is the proxy every outbound connection goes through, or nil to
+// use the standard HTTPS_PROXY / HTTP_PROXY / NO_PROXY environment
+var proxyURL *url.URL
+
+// SetProxy routes outbound traffic through a proxy: API and backend calls
+// made with the default HTTP transport, the native YouTube client, and
+// the external tools (yt-dlp gets --proxy, the rest the proxy environment
+// variables). Requests to localhost skip the proxy. An empty raw falls
+// back to VKM_PROXY, then to the standard environment. Supported schemes
+// are http, https and socks5.
+func SetProxy(raw string) error {
+	if raw == "" {
+		raw = os.Getenv("VKM_PROXY")
+	}
+	if raw == "" {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid proxy %q (use scheme://host:port)", raw)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q (use http, https or socks5)", u.Scheme)
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("cannot configure proxy: default HTTP transport was replaced")
+	}
+	// A local backend stays reachable, as with the standard environment
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if isLoopback(req.URL.Hostname()) {
+			return nil, nil
+		}
+		return u, nil
+	}
+	proxyURL = u
+	return nil
+}
+
+// isLoopback reports whether host names this machine
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// proxyEnv returns environment variables pointing child processes at the
+// configured proxy, or nil when none is set
+func proxyEnv() []string {
+	if proxyURL == nil {
+		return nil
+	}
+	p := proxyURL.String()
+	return []string{
+		"HTTP_PROXY=" + p, "http_proxy=" + p,
+		"HTTPS_PROXY=" + p, "https_proxy=" + p,
+		"ALL_PROXY=" + p, "all_proxy=" + p,
+	}
+}
@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultQualityGates is where pipeline quality gates are configured
+const defaultQualityGates = "data/quality-gates.yaml"
+
+// pipelineQualityGates is the quality gates file of pipeline runs
+var pipelineQualityGates = defaultQualityGates
+
+// qualityGatesHelp documents --quality-gates for the commands running
+// the pipeline
+const qualityGatesHelp = `Quality gates (--quality-gates, default ` + defaultQualityGates + `) catch
+silent low-quality ingestion. A processed item that fails one is still
+stored, but recorded in the manifest as needing attention, with the
+reasons, instead of as a plain success; 'vkm report attention' and the
+dashboard list such items. Each gate is optional:
+
+  min_facts_per_10min: 3          # facts per 10 minutes of audio
+  min_transcript_quality: 0.8     # share of Whisper segments with
+                                  # avg_logprob of -1.0 or better
+  max_extraction_error_rate: 0.2  # share of a run's items whose fact
+                                  # extraction failed
+
+The transcript gate skips transcripts without Whisper's confidence
+signals (captions, the API's whisper-1). The error rate gate applies at
+the end of a pipeline run, flagging every item the run processed.`
+
+// qualityGates are the thresholds processed items are held to. Nil
+// thresholds are not checked.
+type qualityGates struct {
+	MinFactsPer10Min       *float64 `yaml:"min_facts_per_10min"`
+	MinTranscriptQuality   *float64 `yaml:"min_transcript_quality"`
+	MaxExtractionErrorRate *float64 `yaml:"max_extraction_error_rate"`
+}
+
+// loadQualityGates reads a quality gates file. A missing file has no
+// gates.
+func loadQualityGates(path string) (*qualityGates, error) {
+	g := &qualityGates{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quality gates: %w", err)
+	}
+	if err := yaml.Unmarshal(data, g); err != nil {
+		return nil, fmt.Errorf("failed to parse quality gates %s: %w", path, err)
+	}
+	for name, v := range map[string]*float64{
+		"min_transcript_quality":    g.MinTranscriptQuality,
+		"max_extraction_error_rate": g.MaxExtractionErrorRate,
+	} {
+		if v != nil && (*v < 0 || *v > 1) {
+			return nil, fmt.Errorf("quality gates %s: %s must be between 0 and 1", path, name)
+		}
+	}
+	if g.MinFactsPer10Min != nil && *g.MinFactsPer10Min < 0 {
+		return nil, fmt.Errorf("quality gates %s: min_facts_per_10min must not be negative", path)
+	}
+	return g, nil
+}
+
+// transcriptQuality is the share of a transcript's scored segments whose
+// avg_logprob is at least lowConfidenceLogprob, or false when no segment
+// carries one
+func transcriptQuality(t *Transcript) (float64, bool) {
+	scored, good := 0, 0
+	for _, seg := range t.Transcript {
+		if seg.AvgLogprob == 0 {
+			continue
+		}
+		scored++
+		if seg.AvgLogprob >= lowConfidenceLogprob {
+			good++
+		}
+	}
+	if scored == 0 {
+		return 0, false
+	}
+	return float64(good) / float64(scored), true
+}
+
+// checkItem returns the reasons an item fails the gates: facts extracted
+// from audio of the given length (0 if unknown), and its transcript (nil
+// if there is none)
+func (g *qualityGates) checkItem(facts int, duration time.Duration, t *Transcript) []string {
+	var reasons []string
+	if g.MinFactsPer10Min != nil && duration > 0 {
+		rate := float64(facts) / (duration.Minutes() / 10)
+		if rate < *g.MinFactsPer10Min {
+			reasons = append(reasons, fmt.Sprintf("%.1f facts per 10 minutes (gate: at least %g)", rate, *g.MinFactsPer10Min))
+		}
+	}
+	if g.MinTranscriptQuality != nil && t != nil {
+		if q, ok := transcriptQuality(t); ok && q < *g.MinTranscriptQuality {
+			reasons = append(reasons, fmt.Sprintf("transcript quality %.2f (gate: at least %g)", q, *g.MinTranscriptQuality))
+		}
+	}
+	return reasons
+}
+
+// checkRun returns why a run fails the error rate gate after attempting
+// extraction attempts times, failed of them, or ""
+func (g *qualityGates) checkRun(attempts, failed int) string {
+	if g.MaxExtractionErrorRate == nil || attempts == 0 {
+		return ""
+	}
+	rate := float64(failed) / float64(attempts)
+	if rate <= *g.MaxExtractionErrorRate {
+		return ""
+	}
+	return fmt.Sprintf("run extraction error rate %.0f%% (gate: at most %.0f%%)", rate*100, *g.MaxExtractionErrorRate*100)
+}
+
+// audioDuration is the length of an item's audio: its metadata's
+// duration, else the end of its transcript
+func audioDuration(infoPath string, t *Transcript) time.Duration {
+	if info, err := loadVideoMetadata(infoPath); err == nil {
+		if d, ok := info["duration"].(float64); ok && d > 0 {
+			return time.Duration(d * float64(time.Second))
+		}
+	}
+	if t != nil {
+		return time.Duration(transcriptDuration(t) * float64(time.Second))
+	}
+	return 0
+}
+
+// SetAttention records the gates the item for url failed, replacing
+// earlier ones; no reasons clears them
+func (m *Manifest) SetAttention(url string, reasons []string) error {
+	return m.write(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("UPDATE items SET attention = NULLIF(?, '') WHERE url = ?", strings.Join(reasons, "; "), url); err != nil {
+			return fmt.Errorf("failed to record quality gates: %w", err)
+		}
+		return nil
+	})
+}
+
+// AddAttention adds a failed gate to those recorded for the item for url
+func (m *Manifest) AddAttention(url, reason string) error {
+	return m.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE items SET attention = CASE
+			WHEN attention IS NULL OR attention = '' THEN ? ELSE attention || '; ' || ? END
+			WHERE url = ?`, reason, reason, url)
+		if err != nil {
+			return fmt.Errorf("failed to record quality gates: %w", err)
+		}
+		return nil
+	})
+}
+
+// AttentionItems returns the processed items that failed a quality gate,
+// most recently updated first
+func (m *Manifest) AttentionItems() ([]*ManifestItem, error) {
+	rows, err := m.db.Query("SELECT "+manifestItemColumns+" FROM items WHERE state = ? AND attention IS NOT NULL AND attention != '' ORDER BY updated_at DESC", ItemProcessed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*ManifestItem
+	for rows.Next() {
+		item, err := scanManifestItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest item: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// ReportAttentionCmd lists processed items that failed a quality gate
+var ReportAttentionCmd = &cobra.Command{
+	Use:   "attention",
+	Short: "List processed items that failed a pipeline quality gate",
+	Long: `List the items the pipeline processed but recorded as needing
+attention, because they failed a quality gate, with the reasons.
+Processing an item again re-checks it.
+
+` + qualityGatesHelp + `
+
+Example:
+  vkm report attention`,
+	Args: cobra.NoArgs,
+	RunE: runReportAttention,
+}
+
+func init() {
+	ReportCmd.AddCommand(ReportAttentionCmd)
+
+	ReportAttentionCmd.Flags().StringVar(&reportManifest, "manifest", "data/manifest.db", "SQLite manifest path")
+}
+
+func runReportAttention(cmd *cobra.Command, args []string) error {
+	manifest, err := openManifest(reportManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	items, err := manifest.AttentionItems()
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Println("No items need attention")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "URL\tPATCH\tUPDATED\tREASONS")
+	for _, item := range items {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.URL, orDefault(item.PatchID, "-"),
+			item.UpdatedAt.Local().Format("2006-01-02 15:04"), item.Attention)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d items need attention\n", len(items))
+	return nil
+}
+
+// checkItemGates holds a processed item to the run's gates, reporting
+// and recording the ones it fails (or clearing those of earlier runs)
+func (r *pipelineRun) checkItemGates(url string, facts int, duration time.Duration, t *Transcript) {
+	r.processed = append(r.processed, url)
+	reasons := r.gates.checkItem(facts, duration, t)
+	if len(reasons) > 0 {
+		r.attention++
+		fmt.Printf("  ⚠ Needs attention: %s\n", strings.Join(reasons, "; "))
+	}
+	if r.manifest != nil {
+		if err := r.manifest.SetAttention(url, reasons); err != nil {
+			fmt.Fprintf(os.Stderr, "  Warning: %v\n", err)
+		}
+	}
+}
+
+// checkRunGates holds the run's extraction error rate to its gate,
+// flagging every item the run processed when it fails
+func (r *pipelineRun) checkRunGates() {
+	reason := r.gates.checkRun(r.extractions, r.extractionErrors)
+	if reason == "" || len(r.processed) == 0 {
+		return
+	}
+	fmt.Printf("⚠ Needs attention: %s\n", reason)
+	r.attention = len(r.processed)
+	if r.manifest == nil {
+		return
+	}
+	for _, url := range r.processed {
+		if err := r.manifest.AddAttention(url, reason); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// RecordCmd records the audio of a live stream
+var RecordCmd = &cobra.Command{
+	Use:   "record <live-url>",
+	Short: "Record a live stream's audio, transcribing it as it goes",
+	Long: `Record the audio of an ongoing live stream (YouTube, Twitch or any other
+site yt-dlp supports) for up to --until, or until interrupted. yt-dlp
+finds the stream and ffmpeg records it as mono MP3 into a directory
+under --output named after the stream and the time recording started,
+with the stream's info.json beside it.
+
+With --chunk, the recording is cut into files of that length
+(chunk-000.mp3, chunk-001.mp3, ...) as it goes. With --transcribe, each
+chunk is sent to the Whisper API (OPENAI_API_KEY) as soon as it is
+complete, so transcripts of a long talk arrive while it is still
+running; --upload also sends each chunk's transcript to the backend for
+fact extraction, timestamped with the time the chunk was recorded.
+Transcript timestamps count from the start of the recording, and
+transcript.json collects all chunks' segments once the recording ends.
+Without --chunk the whole recording is transcribed when it ends.
+
+Interrupting stops the recording; the chunks recorded so far are kept,
+and those not yet transcribed can be with 'vkm transcribe-whisper'.
+
+Requires yt-dlp and ffmpeg.
+
+Examples:
+  vkm record https://www.youtube.com/watch?v=LIVE_ID --until 2h
+  vkm record https://www.twitch.tv/somechannel --until 3h --chunk 10m --transcribe
+  vkm record <live-url> --until 90m --chunk 15m --upload --backend http://my-server:3000`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRecord,
+}
+
+var (
+	recordOutputDir  string
+	recordUntil      time.Duration
+	recordChunk      time.Duration
+	recordTranscribe bool
+	recordUpload     bool
+)
+
+func init() {
+	RecordCmd.Flags().StringVarP(&recordOutputDir, "output", "o", "data/recordings", "Directory for recordings")
+	RecordCmd.Flags().DurationVar(&recordUntil, "until", 0, "Stop recording after this long (e.g. 2h)")
+	RecordCmd.Flags().DurationVar(&recordChunk, "chunk", 0, "Cut the recording into files of this length (e.g. 10m)")
+	RecordCmd.Flags().BoolVar(&recordTranscribe, "transcribe", false, "Transcribe each chunk with the Whisper API as it completes")
+	RecordCmd.Flags().BoolVar(&recordUpload, "upload", false, "Send each chunk's transcript to the backend (implies --transcribe)")
+	RecordCmd.Flags().StringVarP(&pipelineBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	RecordCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	RecordCmd.MarkFlagRequired("until")
+}
+
+// recordPollInterval is how often the recording directory is checked for
+// completed chunks
+const recordPollInterval = 5 * time.Second
+
+// recording is a live stream being recorded into dir
+type recording struct {
+	dir       string
+	sourceID  string
+	startedAt time.Time
+	chunk     time.Duration
+	apiKey    string
+
+	transcribed map[string]bool
+	segments    []TranscriptSegment
+	language    string
+}
+
+func runRecord(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if recordUntil <= 0 {
+		return fmt.Errorf("--until must be positive")
+	}
+	if recordChunk < 0 || (recordChunk > 0 && recordChunk < 30*time.Second) {
+		return fmt.Errorf("--chunk must be at least 30s")
+	}
+	if recordUpload {
+		recordTranscribe = true
+	}
+	if err := checkYtDlpInstalled(); err != nil {
+		return err
+	}
+	if _, err := findTool("ffmpeg"); err != nil {
+		return fmt.Errorf("%w (required to record)", err)
+	}
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if recordTranscribe && apiKey == "" {
+		return fmt.Errorf("OPENAI_API_KEY environment variable not set (required for --transcribe)")
+	}
+	if recordUpload {
+		if err := waitForBackend(ctx, pipelineBackendURL, 0); err != nil {
+			return err
+		}
+	}
+
+	liveURL := args[0]
+	if err := checkMediaURLs([]string{liveURL}, ytDlpDownloader{}); err != nil {
+		return err
+	}
+	fmt.Printf("Looking up stream: %s\n", liveURL)
+	info, streamURL, err := liveStream(ctx, liveURL)
+	if err != nil {
+		return err
+	}
+	title, _ := info["title"].(string)
+	id, _ := info["id"].(string)
+	if live, _ := info["is_live"].(bool); !live {
+		fmt.Fprintf(os.Stderr, "Warning: %s is not live; recording it anyway\n", liveURL)
+	}
+
+	rec := &recording{
+		sourceID:    orDefault(id, "stream"),
+		startedAt:   time.Now().UTC(),
+		chunk:       recordChunk,
+		apiKey:      apiKey,
+		transcribed: make(map[string]bool),
+	}
+	rec.dir = filepath.Join(recordOutputDir, CleanFilename(rec.sourceID)+"-"+rec.startedAt.Format("20060102-150405"))
+	if err := os.MkdirAll(rec.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	info["recording_started_at"] = rec.startedAt.Format(time.RFC3339)
+	if data, err := json.MarshalIndent(info, "", "  "); err == nil {
+		if err := os.WriteFile(filepath.Join(rec.dir, "info.json"), data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save stream metadata: %v\n", err)
+		}
+	}
+
+	fmt.Printf("Recording: %s\n", orDefault(title, rec.sourceID))
+	fmt.Printf("  Until: %s (Ctrl+C stops earlier)\n", recordUntil)
+	if rec.chunk > 0 {
+		fmt.Printf("  Chunks: %s\n", rec.chunk)
+	}
+	fmt.Printf("  Saving to: %s\n\n", rec.dir)
+
+	ffmpeg := toolCommand(ctx, "ffmpeg", rec.ffmpegArgs(streamURL, info)...)
+	var stderr strings.Builder
+	ffmpeg.Stderr = &stderr
+	done := make(chan error, 1)
+	if err := ffmpeg.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	go func() { done <- ffmpeg.Wait() }()
+
+	ticker := time.NewTicker(recordPollInterval)
+	defer ticker.Stop()
+recording:
+	for {
+		select {
+		case <-ticker.C:
+			if rec.chunk > 0 && recordTranscribe {
+				// The newest chunk is still being written
+				rec.processChunks(ctx, 1)
+			}
+		case err := <-done:
+			if ctx.Err() != nil {
+				fmt.Println("\nRecording interrupted")
+				fmt.Printf("Chunks recorded so far are in %s\n", rec.dir)
+				return ctx.Err()
+			}
+			if err != nil && len(rec.chunks()) == 0 {
+				return fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: recording ended early: %v: %s\n", err, lastLine(stderr.String()))
+			}
+			break recording
+		}
+	}
+
+	fmt.Printf("✓ Recorded %s into %d file(s)\n", time.Since(rec.startedAt).Round(time.Second), len(rec.chunks()))
+	if !recordTranscribe {
+		fmt.Printf("\nNext step: Transcribe the recording\n")
+		fmt.Printf("  vkm transcribe-whisper %s\n", filepath.Join(rec.dir, "*.mp3"))
+		return nil
+	}
+	rec.processChunks(ctx, 0)
+	return rec.saveTranscript(title)
+}
+
+// liveStream looks up a live stream's metadata and the URL of its audio
+// (or combined) stream with yt-dlp
+func liveStream(ctx context.Context, liveURL string) (map[string]interface{}, string, error) {
+	c, cleanup := ytDlpCommand(ctx, "--dump-single-json", "--skip-download", "--no-playlist",
+		"--format", "bestaudio/best", "--quiet", liveURL)
+	defer cleanup()
+	out, err := c.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		var stderr string
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = string(exitErr.Stderr)
+		}
+		return nil, "", fmt.Errorf("failed to look up %s: %w", liveURL, ytDlpError(err, stderr))
+	}
+	var info map[string]interface{}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, "", fmt.Errorf("failed to parse stream metadata: %w", err)
+	}
+	streamURL, _ := info["url"].(string)
+	if streamURL == "" {
+		return nil, "", fmt.Errorf("yt-dlp found no stream URL for %s", liveURL)
+	}
+	return info, streamURL, nil
+}
+
+// ffmpegArgs records streamURL for --until as mono MP3, in chunk files
+// when chunked, sending the HTTP headers yt-dlp lists in info
+func (r *recording) ffmpegArgs(streamURL string, info map[string]interface{}) []string {
+	args := []string{"-y", "-loglevel", "error"}
+	if headers, ok := info["http_headers"].(map[string]interface{}); ok && len(headers) > 0 {
+		var lines []string
+		for k, v := range headers {
+			lines = append(lines, fmt.Sprintf("%s: %v\r\n", k, v))
+		}
+		sort.Strings(lines)
+		args = append(args, "-headers", strings.Join(lines, ""))
+	}
+	args = append(args,
+		"-i", streamURL,
+		"-t", fmt.Sprint(int(recordUntil.Seconds())),
+		"-vn", "-ac", "1", "-c:a", "libmp3lame", "-b:a", chunkBitrate,
+	)
+	if r.chunk > 0 {
+		return append(args, "-f", "segment", "-segment_time", fmt.Sprint(int(r.chunk.Seconds())), "-reset_timestamps", "1",
+			toolPath(filepath.Join(r.dir, "chunk-%03d.mp3")))
+	}
+	return append(args, toolPath(filepath.Join(r.dir, "recording.mp3")))
+}
+
+// chunks lists the recording's audio files in order
+func (r *recording) chunks() []string {
+	paths, _ := filepath.Glob(filepath.Join(r.dir, "*.mp3"))
+	sort.Strings(paths)
+	return paths
+}
+
+// processChunks transcribes (and with --upload, uploads) the chunks not
+// yet transcribed, leaving out the newest skip ones
+func (r *recording) processChunks(ctx context.Context, skip int) {
+	paths := r.chunks()
+	for i := 0; i < len(paths)-skip; i++ {
+		path := paths[i]
+		if r.transcribed[path] || ctx.Err() != nil {
+			continue
+		}
+		r.transcribed[path] = true
+		offset := float64(i) * r.chunk.Seconds()
+		if err := r.processChunk(ctx, path, i, offset); err != nil {
+			fmt.Fprintf(os.Stderr, "  ✗ %s: %v\n", filepath.Base(path), err)
+		}
+	}
+}
+
+// processChunk transcribes one chunk that starts offset seconds into the
+// recording, saving its transcript beside it
+func (r *recording) processChunk(ctx context.Context, path string, index int, offset float64) error {
+	resp, err := requestWhisperTranscription(ctx, path, r.apiKey)
+	if err != nil {
+		return err
+	}
+
+	t := &Transcript{VideoID: r.sourceID, Language: resp.Language}
+	for _, seg := range resp.Segments {
+		t.Transcript = append(t.Transcript, TranscriptSegment{
+			Timestamp: seg.Start + offset,
+			Text:      strings.TrimSpace(seg.Text),
+			Duration:  seg.End - seg.Start,
+		})
+	}
+	if len(t.Transcript) == 0 && strings.TrimSpace(resp.Text) != "" {
+		t.Transcript = []TranscriptSegment{{Timestamp: offset, Text: strings.TrimSpace(resp.Text)}}
+	}
+	r.segments = append(r.segments, t.Transcript...)
+	if r.language == "" {
+		r.language = t.Language
+	}
+
+	text := transcriptText(t)
+	transcriptPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal transcript: %w", err)
+	}
+	if err := os.WriteFile(transcriptPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to save transcript: %w", err)
+	}
+	fmt.Printf("  ✓ Transcribed %s: %d characters\n", filepath.Base(path), len(text))
+
+	if !recordUpload || text == "" {
+		return nil
+	}
+	commit := patchCommit{
+		Timestamp: r.startedAt.Add(time.Duration(offset * float64(time.Second))),
+		Metadata: map[string]interface{}{
+			"live-recording": r.startedAt.Format(time.RFC3339),
+			"live-chunk":     index + 1,
+			"live-offset":    offset,
+		},
+	}
+	patchID, factsCount, err := uploadToBackend(ctx, text, r.sourceID, commit)
+	if err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	fmt.Printf("  ✓ Uploaded %s: patch %s, %d facts\n", filepath.Base(path), patchID, factsCount)
+	return nil
+}
+
+// saveTranscript writes the segments of all chunks as transcript.json
+func (r *recording) saveTranscript(title string) error {
+	sort.SliceStable(r.segments, func(i, j int) bool { return r.segments[i].Timestamp < r.segments[j].Timestamp })
+	t := Transcript{
+		VideoID:     r.sourceID,
+		Title:       title,
+		PublishedAt: r.startedAt.Format(time.RFC3339),
+		Language:    r.language,
+		Transcript:  r.segments,
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal transcript: %w", err)
+	}
+	path := filepath.Join(r.dir, "transcript.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save transcript: %w", err)
+	}
+	fmt.Printf("\nTranscript saved to: %s (%d segments)\n", path, len(t.Transcript))
+	return nil
+}
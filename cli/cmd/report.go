@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ReportCmd groups corpus reporting subcommands
+var ReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarize the local corpus",
+	Long: `Generate summary reports over downloaded media and transcripts.
+
+Examples:
+  vkm report languages --transcripts data/transcripts
+  vkm report quota
+  vkm report extraction-quality --sample 30`,
+}
+
+// ReportLanguagesCmd summarizes transcripts by detected language
+var ReportLanguagesCmd = &cobra.Command{
+	Use:   "languages",
+	Short: "Summarize detected transcript languages and accuracy proxies",
+	Long: `Summarize detected languages across transcripts, with total audio
+duration and per-language transcription accuracy proxies.
+
+Accuracy proxies come from Whisper's per-segment signals:
+  - avg log-prob: mean of segment avg_logprob (closer to 0 is better)
+  - no-speech:    mean of segment no_speech_prob
+  - low-conf:     share of segments with avg_logprob below -1.0, the
+                  threshold Whisper itself uses to retry decoding
+
+Only JSON transcripts (as written by 'vkm transcribe') carry language and
+segment data; plain .txt transcripts are counted under "unknown".
+
+Example:
+  vkm report languages --transcripts data/transcripts --format json`,
+	RunE: runReportLanguages,
+}
+
+// ReportQuotaCmd shows today's YouTube Data API quota usage
+var ReportQuotaCmd = &cobra.Command{
+	Use:   "quota",
+	Short: "Show today's YouTube Data API quota usage",
+	Long: `Show YouTube Data API units spent today, per endpoint, as recorded in
+the manifest. Quota days reset at midnight Pacific Time.
+
+The daily budget defaults to 10000 units; set VKM_YOUTUBE_QUOTA to reserve
+part of a shared key's quota for other tools. Once the budget is spent,
+channel listing falls back to RSS feeds.`,
+	RunE: runReportQuota,
+}
+
+var (
+	reportTranscriptsDir string
+	reportFormat         string
+	reportManifest       string
+)
+
+func init() {
+	ReportCmd.AddCommand(ReportLanguagesCmd)
+	ReportCmd.AddCommand(ReportQuotaCmd)
+
+	ReportQuotaCmd.Flags().StringVar(&reportManifest, "manifest", "data/manifest.db", "SQLite manifest path")
+
+	ReportLanguagesCmd.Flags().StringVar(&reportTranscriptsDir, "transcripts", "data/transcripts", "Transcripts directory")
+	ReportLanguagesCmd.Flags().StringVar(&reportFormat, "format", "table", "Output format (table, json)")
+}
+
+// lowConfidenceLogprob is Whisper's logprob_threshold default
+const lowConfidenceLogprob = -1.0
+
+// LanguageStats aggregates transcripts sharing a detected language
+type LanguageStats struct {
+	Language        string  `json:"language"`
+	Files           int     `json:"files"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Segments        int     `json:"segments"`
+	AvgLogprob      float64 `json:"avg_logprob"`
+	AvgNoSpeechProb float64 `json:"avg_no_speech_prob"`
+	LowConfidence   float64 `json:"low_confidence_ratio"`
+
+	scoredSegments int
+	lowSegments    int
+	logprobSum     float64
+	noSpeechSum    float64
+}
+
+func runReportLanguages(cmd *cobra.Command, args []string) error {
+	stats := make(map[string]*LanguageStats)
+	get := func(lang string) *LanguageStats {
+		if lang == "" {
+			lang = "unknown"
+		}
+		if stats[lang] == nil {
+			stats[lang] = &LanguageStats{Language: lang}
+		}
+		return stats[lang]
+	}
+
+	err := filepath.Walk(reportTranscriptsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".txt":
+			get("").Files++
+		case ".json":
+			transcript, err := loadTranscript(path)
+			if err != nil {
+				// Not a transcript (e.g. a metadata sidecar)
+				return nil
+			}
+			addTranscriptStats(get(transcript.Language), transcript)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan transcripts: %w", err)
+	}
+
+	var rows []*LanguageStats
+	for _, s := range stats {
+		if s.Segments > 0 {
+			if s.scoredSegments > 0 {
+				s.AvgLogprob = s.logprobSum / float64(s.scoredSegments)
+				s.LowConfidence = float64(s.lowSegments) / float64(s.scoredSegments)
+			}
+			s.AvgNoSpeechProb = s.noSpeechSum / float64(s.Segments)
+		}
+		rows = append(rows, s)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].DurationSeconds != rows[j].DurationSeconds {
+			return rows[i].DurationSeconds > rows[j].DurationSeconds
+		}
+		return rows[i].Language < rows[j].Language
+	})
+
+	if reportFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+
+	if len(rows) == 0 {
+		fmt.Printf("No transcripts found in %s\n", reportTranscriptsDir)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LANGUAGE\tFILES\tDURATION\tSEGMENTS\tAVG LOG-PROB\tNO-SPEECH\tLOW-CONF")
+	for _, s := range rows {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%.3f\t%.3f\t%.1f%%\n",
+			s.Language, s.Files,
+			time.Duration(s.DurationSeconds*float64(time.Second)).Round(time.Second),
+			s.Segments, s.AvgLogprob, s.AvgNoSpeechProb, s.LowConfidence*100)
+	}
+	return w.Flush()
+}
+
+func addTranscriptStats(s *LanguageStats, transcript *Transcript) {
+	s.Files++
+	s.DurationSeconds += transcriptDuration(transcript)
+
+	for _, seg := range transcript.Transcript {
+		s.Segments++
+		s.noSpeechSum += seg.NoSpeechProb
+		if seg.AvgLogprob != 0 {
+			s.scoredSegments++
+			s.logprobSum += seg.AvgLogprob
+			if seg.AvgLogprob < lowConfidenceLogprob {
+				s.lowSegments++
+			}
+		}
+	}
+}
+
+// loadTranscript reads a transcript JSON file in the package's format
+func loadTranscript(path string) (*Transcript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var transcript Transcript
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		return nil, err
+	}
+	if transcript.Transcript == nil {
+		return nil, fmt.Errorf("%s is not a transcript", path)
+	}
+
+	return &transcript, nil
+}
+
+// transcriptDuration returns the end time of the last segment in seconds
+func transcriptDuration(transcript *Transcript) float64 {
+	var end float64
+	for _, seg := range transcript.Transcript {
+		if e := seg.Timestamp + seg.Duration; e > end {
+			end = e
+		}
+	}
+	return end
+}
+
+func runReportQuota(cmd *cobra.Command, args []string) error {
+	manifest, err := openManifest(reportManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	day := youtubeQuotaDay(time.Now())
+	usage, err := manifest.QuotaUsage(youtubeQuotaAPI, day)
+	if err != nil {
+		return err
+	}
+
+	endpoints := make([]string, 0, len(usage))
+	used := 0
+	for endpoint, units := range usage {
+		endpoints = append(endpoints, endpoint)
+		used += units
+	}
+	sort.Strings(endpoints)
+
+	limit := youtubeDailyQuota()
+	fmt.Printf("YouTube Data API quota for %s (Pacific Time)\n\n", day)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENDPOINT\tUNITS")
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(w, "%s\t%d\n", endpoint, usage[endpoint])
+	}
+	fmt.Fprintf(w, "total\t%d / %d\n", used, limit)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if used >= limit {
+		fmt.Println("\nQuota exhausted: channel listing will use RSS feeds until reset.")
+	}
+	return nil
+}
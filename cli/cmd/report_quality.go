@@ -0,0 +1,434 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ReportQualityCmd estimates extraction precision with a judge model
+var ReportQualityCmd = &cobra.Command{
+	Use:   "extraction-quality",
+	Short: "Estimate fact extraction precision with a judge LLM",
+	Long: `Sample document patches under --data, re-check a few facts from each
+against the video's transcript with a judge model (CLAUDE_API_KEY), and
+report estimated precision per channel and per prompt version.
+
+Each fact is judged supported, partial (distorted or missing qualifiers)
+or unsupported. Precision counts partial facts as half right; the range
+is a 95% Wilson interval, so small samples show their uncertainty.
+
+Channels come from the videos' .info.json files. Prompt versions are the
+"prompt-version" hash recorded in patch metadata by local extraction;
+patches extracted by the backend or before versions were recorded are
+reported as "unknown". Only patches whose transcript is found under --data
+are sampled. Long transcripts are cut down to the passages that overlap
+most with the claims being checked.
+
+Example:
+  vkm report extraction-quality --sample 30 --facts 5 --seed 1`,
+	RunE: runReportQuality,
+}
+
+var (
+	qualityDataDir    string
+	qualitySample     int
+	qualityFacts      int
+	qualitySeed       int64
+	qualityJudgeModel string
+	qualityFormat     string
+	qualityContext    int
+)
+
+func init() {
+	ReportCmd.AddCommand(ReportQualityCmd)
+
+	ReportQualityCmd.Flags().StringVar(&qualityDataDir, "data", "data", "Directory holding patches, transcripts and metadata")
+	ReportQualityCmd.Flags().IntVar(&qualitySample, "sample", 20, "Number of patches to sample")
+	ReportQualityCmd.Flags().IntVar(&qualityFacts, "facts", 5, "Facts to check per sampled patch")
+	ReportQualityCmd.Flags().Int64Var(&qualitySeed, "seed", 0, "Random seed for reproducible samples (0 picks one)")
+	ReportQualityCmd.Flags().StringVar(&qualityJudgeModel, "judge-model", claudeModel, "Claude model used as the judge")
+	ReportQualityCmd.Flags().StringVar(&qualityFormat, "format", "table", "Output format (table, json)")
+	ReportQualityCmd.Flags().IntVar(&qualityContext, "max-context", 60000, "Maximum transcript characters sent per patch")
+}
+
+// Judge verdicts
+const (
+	verdictSupported   = "supported"
+	verdictPartial     = "partial"
+	verdictUnsupported = "unsupported"
+)
+
+const judgePrompt = "You are auditing facts that were automatically extracted from a video transcript.\n\n" +
+	"Transcript:\n---\n%s\n---\n\n" +
+	"For each numbered claim, decide whether the transcript supports it:\n" +
+	"- supported: stated or directly implied by the transcript\n" +
+	"- partial: roughly right but distorted, overstated or missing key qualifiers\n" +
+	"- unsupported: not in the transcript, or contradicted by it\n\n" +
+	"Claims:\n%s\n" +
+	"Respond ONLY with a valid JSON array, nothing else:\n" +
+	"[{\"claim\": 1, \"verdict\": \"supported\"}]"
+
+// QualityStats aggregates judge verdicts for one group of patches
+type QualityStats struct {
+	Group       string  `json:"group"`
+	Patches     int     `json:"patches"`
+	Checked     int     `json:"checked"`
+	Supported   int     `json:"supported"`
+	Partial     int     `json:"partial"`
+	Unsupported int     `json:"unsupported"`
+	Precision   float64 `json:"precision"`
+	Low         float64 `json:"precision_low"`
+	High        float64 `json:"precision_high"`
+}
+
+// QualityReport is the extraction-quality result
+type QualityReport struct {
+	Seed            int64           `json:"seed"`
+	JudgeModel      string          `json:"judge_model"`
+	SampledPatches  int             `json:"sampled_patches"`
+	CheckedFacts    int             `json:"checked_facts"`
+	Overall         *QualityStats   `json:"overall"`
+	ByChannel       []*QualityStats `json:"by_channel"`
+	ByPromptVersion []*QualityStats `json:"by_prompt_version"`
+}
+
+// videoCorpus maps video IDs to their channel and transcript text
+type videoCorpus struct {
+	channels    map[string]string
+	transcripts map[string]string
+}
+
+func runReportQuality(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if os.Getenv("CLAUDE_API_KEY") == "" {
+		return fmt.Errorf("CLAUDE_API_KEY environment variable not set")
+	}
+	if qualityFormat != "table" && qualityFormat != "json" {
+		return fmt.Errorf("unknown format %q (use table or json)", qualityFormat)
+	}
+
+	patches, err := loadLocalPatches(qualityDataDir)
+	if err != nil {
+		return err
+	}
+	corpus, err := loadVideoCorpus(qualityDataDir)
+	if err != nil {
+		return err
+	}
+
+	var candidates []*Patch
+	for _, p := range patches {
+		if p.Source == "document" && len(p.Facts) > 0 && corpus.transcripts[p.SourceID] != "" {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no document patches with transcripts found under %s", qualityDataDir)
+	}
+
+	seed := qualitySeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+	rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	if len(candidates) > qualitySample {
+		candidates = candidates[:qualitySample]
+	}
+
+	report := &QualityReport{Seed: seed, JudgeModel: qualityJudgeModel, Overall: &QualityStats{Group: "all"}}
+	byChannel := make(map[string]*QualityStats)
+	byVersion := make(map[string]*QualityStats)
+	group := func(m map[string]*QualityStats, key string) *QualityStats {
+		if m[key] == nil {
+			m[key] = &QualityStats{Group: key}
+		}
+		return m[key]
+	}
+
+	for i, p := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+		facts := append([]Fact(nil), p.Facts...)
+		rng.Shuffle(len(facts), func(a, b int) { facts[a], facts[b] = facts[b], facts[a] })
+		if len(facts) > qualityFacts {
+			facts = facts[:qualityFacts]
+		}
+
+		fmt.Fprintf(os.Stderr, "[%d/%d] Judging %d facts from %s\n", i+1, len(candidates), len(facts), p.SourceID)
+		verdicts, err := judgeFacts(ctx, corpus.transcripts[p.SourceID], facts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: judging %s failed: %v\n", p.SourceID, err)
+			continue
+		}
+
+		channel := corpus.channels[p.SourceID]
+		if channel == "" {
+			channel = "unknown"
+		}
+		version, _ := p.Metadata["prompt-version"].(string)
+		if version == "" {
+			version = "unknown"
+		}
+
+		report.SampledPatches++
+		for _, s := range []*QualityStats{report.Overall, group(byChannel, channel), group(byVersion, version)} {
+			s.Patches++
+			for _, v := range verdicts {
+				s.add(v)
+			}
+		}
+	}
+
+	report.CheckedFacts = report.Overall.Checked
+	report.Overall.finish()
+	report.ByChannel = sortedQualityStats(byChannel)
+	report.ByPromptVersion = sortedQualityStats(byVersion)
+
+	if qualityFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return printQualityReport(report)
+}
+
+// add counts one verdict
+func (s *QualityStats) add(verdict string) {
+	s.Checked++
+	switch verdict {
+	case verdictSupported:
+		s.Supported++
+	case verdictPartial:
+		s.Partial++
+	default:
+		s.Unsupported++
+	}
+}
+
+// finish computes precision and its 95% Wilson interval
+func (s *QualityStats) finish() {
+	if s.Checked == 0 {
+		return
+	}
+	n := float64(s.Checked)
+	p := (float64(s.Supported) + 0.5*float64(s.Partial)) / n
+	const z = 1.96
+	denom := 1 + z*z/n
+	center := (p + z*z/(2*n)) / denom
+	margin := z * math.Sqrt(p*(1-p)/n+z*z/(4*n*n)) / denom
+	s.Precision = p
+	s.Low = math.Max(0, center-margin)
+	s.High = math.Min(1, center+margin)
+}
+
+func sortedQualityStats(m map[string]*QualityStats) []*QualityStats {
+	out := make([]*QualityStats, 0, len(m))
+	for _, s := range m {
+		s.finish()
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Checked != out[j].Checked {
+			return out[i].Checked > out[j].Checked
+		}
+		return out[i].Group < out[j].Group
+	})
+	return out
+}
+
+func printQualityReport(r *QualityReport) error {
+	fmt.Printf("Extraction quality: %d facts from %d patches, judged by %s (seed %d)\n\n",
+		r.CheckedFacts, r.SampledPatches, r.JudgeModel, r.Seed)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	section := func(title string, stats []*QualityStats) {
+		fmt.Fprintf(w, "%s\tPATCHES\tFACTS\tSUPPORTED\tPARTIAL\tUNSUPPORTED\tPRECISION\t95%% RANGE\n", title)
+		for _, s := range stats {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%.0f%%\t%.0f–%.0f%%\n",
+				s.Group, s.Patches, s.Checked, s.Supported, s.Partial, s.Unsupported,
+				100*s.Precision, 100*s.Low, 100*s.High)
+		}
+		fmt.Fprintln(w, "\t\t\t\t\t\t\t")
+	}
+	section("CHANNEL", r.ByChannel)
+	section("PROMPT VERSION", r.ByPromptVersion)
+	section("OVERALL", []*QualityStats{r.Overall})
+	return w.Flush()
+}
+
+// loadVideoCorpus reads channels from .info.json files and transcript text
+// from Whisper JSON and plain-text transcripts under root. Text transcripts
+// are matched to videos by ID or by the audio's templated name.
+func loadVideoCorpus(root string) (*videoCorpus, error) {
+	c := &videoCorpus{channels: make(map[string]string), transcripts: make(map[string]string)}
+	infoBases := make(map[string]string)
+	texts := make(map[string]string)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		switch {
+		case strings.HasSuffix(name, ".info.json"):
+			info, err := loadVideoMetadata(path)
+			if err != nil {
+				return nil
+			}
+			f := nameFieldsFromInfo(info)
+			if f.ID != "" {
+				c.channels[f.ID] = f.Channel
+				infoBases[strings.TrimSuffix(name, ".info.json")] = f.ID
+			}
+		case strings.HasSuffix(name, ".preview.json"):
+		case strings.HasSuffix(name, ".json"):
+			t, err := loadTranscript(path)
+			if err == nil && t.VideoID != "" && len(t.Transcript) > 0 {
+				c.transcripts[t.VideoID] = transcriptText(t)
+			}
+		case strings.HasSuffix(name, ".txt"):
+			data, err := os.ReadFile(path)
+			if err == nil {
+				texts[strings.TrimSuffix(name, ".txt")] = string(data)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+
+	for base, text := range texts {
+		id := base
+		if mapped, ok := infoBases[base]; ok {
+			id = mapped
+		}
+		if c.transcripts[id] == "" {
+			c.transcripts[id] = text
+		}
+	}
+	return c, nil
+}
+
+// judgeFacts asks the judge model whether the transcript supports each
+// fact, returning one verdict per fact
+func judgeFacts(ctx context.Context, transcript string, facts []Fact) ([]string, error) {
+	claims := make([]string, len(facts))
+	var list strings.Builder
+	for i, f := range facts {
+		claims[i] = f.Text
+		fmt.Fprintf(&list, "%d. %s\n", i+1, f.Text)
+	}
+
+	prompt := fmt.Sprintf(judgePrompt, transcriptExcerpt(transcript, claims, qualityContext), list.String())
+	answer, err := askClaude(ctx, qualityJudgeModel, prompt)
+	if err != nil {
+		return nil, err
+	}
+	if m := codeBlockPattern.FindStringSubmatch(answer); m != nil {
+		answer = m[1]
+	}
+
+	var judged []struct {
+		Claim   int    `json:"claim"`
+		Verdict string `json:"verdict"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(answer)), &judged); err != nil {
+		return nil, fmt.Errorf("failed to parse judge answer: %w", err)
+	}
+
+	verdicts := make([]string, len(facts))
+	for _, j := range judged {
+		if j.Claim < 1 || j.Claim > len(facts) {
+			continue
+		}
+		switch v := strings.ToLower(strings.TrimSpace(j.Verdict)); v {
+		case verdictSupported, verdictPartial, verdictUnsupported:
+			verdicts[j.Claim-1] = v
+		}
+	}
+	for i, v := range verdicts {
+		if v == "" {
+			return nil, fmt.Errorf("judge gave no verdict for claim %d", i+1)
+		}
+	}
+	return verdicts, nil
+}
+
+// excerptWindow is the size in characters of the passages transcriptExcerpt
+// chooses between
+const excerptWindow = 2000
+
+// transcriptExcerpt returns the transcript if it fits in budget characters,
+// and otherwise the passages sharing the most words with the claims, in
+// transcript order
+func transcriptExcerpt(transcript string, claims []string, budget int) string {
+	if len(transcript) <= budget {
+		return transcript
+	}
+
+	words := make(map[string]bool)
+	for _, c := range claims {
+		for _, w := range strings.Fields(strings.ToLower(c)) {
+			w = strings.Trim(w, ".,;:!?\"'()")
+			if len(w) >= 4 {
+				words[w] = true
+			}
+		}
+	}
+
+	type window struct {
+		start int
+		text  string
+		score int
+	}
+	var windows []window
+	fields := strings.Fields(transcript)
+	for i := 0; i < len(fields); {
+		var b strings.Builder
+		start := i
+		for ; i < len(fields) && b.Len() < excerptWindow; i++ {
+			b.WriteString(fields[i])
+			b.WriteByte(' ')
+		}
+		w := window{start: start, text: b.String()}
+		for _, f := range strings.Fields(strings.ToLower(w.text)) {
+			if words[strings.Trim(f, ".,;:!?\"'()")] {
+				w.score++
+			}
+		}
+		windows = append(windows, w)
+	}
+
+	sort.SliceStable(windows, func(i, j int) bool { return windows[i].score > windows[j].score })
+	var chosen []window
+	used := 0
+	for _, w := range windows {
+		if used+len(w.text) > budget {
+			break
+		}
+		chosen = append(chosen, w)
+		used += len(w.text)
+	}
+	sort.Slice(chosen, func(i, j int) bool { return chosen[i].start < chosen[j].start })
+
+	parts := make([]string, len(chosen))
+	for i, w := range chosen {
+		parts[i] = strings.TrimSpace(w.text)
+	}
+	return strings.Join(parts, "\n[...]\n")
+}
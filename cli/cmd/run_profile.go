@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// runProfileName is the --profile of the running command
+var runProfileName string
+
+// runProfiles are the presets --profile applies, as flag values by command
+// name. Flags given on the command line win over the preset.
+var runProfiles = map[string]map[string]map[string]string{
+	// gpu runs every stage on the local machine: Whisper large-v3 on CUDA,
+	// extraction by a local LLM on Ollama into the sandbox, and local
+	// embeddings in batches sized for a GPU
+	"gpu": {
+		"pipeline": {
+			"transcriber":   transcriberLocal,
+			"whisper-model": "large-v3",
+			"device":        "cuda",
+			"sandbox":       "true",
+			"extract-model": ollamaModelPrefix + "llama3.1:8b",
+		},
+		"watch": {
+			"transcriber":   transcriberLocal,
+			"whisper-model": "large-v3",
+			"device":        "cuda",
+			"sandbox":       "true",
+			"extract-model": ollamaModelPrefix + "llama3.1:8b",
+		},
+		"embed": {
+			"model": ollamaModelPrefix + "nomic-embed-text",
+			"batch": "256",
+		},
+	},
+}
+
+// profileHelp documents --profile for the commands taking it
+const profileHelp = `Profiles (--profile) preset several flags at once; flags given
+explicitly still win. --profile gpu is a fully offline, high-throughput
+ingestion path for a machine with a CUDA GPU and Ollama:
+  pipeline, watch  --transcriber local --whisper-model large-v3
+                   --device cuda --sandbox
+                   --extract-model ollama:llama3.1:8b
+  embed            --model ollama:nomic-embed-text --batch 256
+It needs the whisper CLI (pip install openai-whisper) and a running
+Ollama with the models pulled (ollama pull llama3.1:8b, ollama pull
+nomic-embed-text), but no API keys.`
+
+// applyProfile sets the flags of cmd that --profile presets, unless they
+// were given explicitly
+func applyProfile(cmd *cobra.Command) error {
+	if runProfileName == "" {
+		return nil
+	}
+	profile, ok := runProfiles[runProfileName]
+	if !ok {
+		var names []string
+		for name := range runProfiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile %q (available: %s)", runProfileName, strings.Join(names, ", "))
+	}
+
+	preset := profile[cmd.Name()]
+	names := make([]string, 0, len(preset))
+	for name := range preset {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var applied []string
+	for _, name := range names {
+		if cmd.Flags().Changed(name) {
+			continue
+		}
+		if err := cmd.Flags().Set(name, preset[name]); err != nil {
+			return fmt.Errorf("profile %s: failed to set --%s: %w", runProfileName, name, err)
+		}
+		applied = append(applied, fmt.Sprintf("--%s %s", name, preset[name]))
+	}
+	if len(applied) > 0 {
+		fmt.Printf("Profile %s: %s\n", runProfileName, strings.Join(applied, " "))
+	}
+	return nil
+}
+
+// Transcribers the pipeline can transcribe audio with: the Whisper API,
+// Deepgram, AssemblyAI, the whisper CLI or whisper.cpp
+const (
+	transcriberAPI        = "api"
+	transcriberDeepgram   = "deepgram"
+	transcriberAssemblyAI = "assemblyai"
+	transcriberLocal      = "local"
+	transcriberWhisperCpp = engineWhisperCpp
+)
+
+var (
+	pipelineTranscriber  string
+	pipelineWhisperModel string
+)
+
+// checkTranscriber validates --transcriber and that it is set up: a
+// Deepgram or AssemblyAI key, or the local engine installed
+func checkTranscriber() error {
+	switch pipelineTranscriber {
+	case transcriberAPI:
+		return nil
+	case transcriberDeepgram:
+		_, err := loadDeepgramSettings(deepgramConfigPath, nil)
+		return err
+	case transcriberAssemblyAI:
+		if os.Getenv("ASSEMBLYAI_API_KEY") == "" {
+			return fmt.Errorf("ASSEMBLYAI_API_KEY environment variable not set (required for --transcriber assemblyai)")
+		}
+		return nil
+	case transcriberLocal:
+		return checkTranscribeEngine(engineOpenAIWhisper)
+	case transcriberWhisperCpp:
+		return checkTranscribeEngine(engineWhisperCpp)
+	}
+	return fmt.Errorf("unknown transcriber %q (use %s, %s, %s, %s or %s)", pipelineTranscriber, transcriberAPI, transcriberDeepgram, transcriberAssemblyAI, transcriberLocal, transcriberWhisperCpp)
+}
+
+// pipelineTranscriptModel is the model the pipeline's transcripts are
+// recorded as produced by
+func pipelineTranscriptModel() string {
+	switch pipelineTranscriber {
+	case transcriberDeepgram:
+		if s, err := loadDeepgramSettings(deepgramConfigPath, nil); err == nil {
+			return "deepgram-" + s.Model
+		}
+		return "deepgram-" + deepgramModel
+	case transcriberAssemblyAI:
+		return "assemblyai-" + assemblyAISpeechModel
+	case transcriberLocal:
+		return localTranscriptModel(engineOpenAIWhisper, pipelineWhisperModel)
+	case transcriberWhisperCpp:
+		return localTranscriptModel(engineWhisperCpp, pipelineWhisperModel)
+	}
+	return whisperModel
+}
+
+// pipelineTranscriberName names --transcriber for progress output
+func pipelineTranscriberName() string {
+	switch pipelineTranscriber {
+	case transcriberDeepgram:
+		return "Deepgram"
+	case transcriberAssemblyAI:
+		return "AssemblyAI"
+	case transcriberLocal:
+		return "local Whisper"
+	case transcriberWhisperCpp:
+		return "whisper.cpp"
+	}
+	return "the Whisper API"
+}
+
+// transcribeLocally transcribes audioPath with the whisper CLI, running
+// --whisper-model on --device, or with whisper.cpp, into a response shaped
+// like the API's
+func transcribeLocally(ctx context.Context, audioPath string) (*WhisperResponse, error) {
+	dir, err := newTempDir("whisper-local-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	run := runOpenAIWhisper
+	if pipelineTranscriber == transcriberWhisperCpp {
+		run = runWhisperCpp
+	}
+	out, err := run(ctx, audioPath, dir, pipelineWhisperModel, whisperLanguage)
+	if err != nil {
+		return nil, err
+	}
+	resp := &WhisperResponse{Text: out.Text, Language: out.Language}
+	for _, seg := range out.Segments {
+		resp.Segments = append(resp.Segments, whisperSegment(seg))
+	}
+	return resp, nil
+}
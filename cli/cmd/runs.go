@@ -0,0 +1,473 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+// RunsCmd groups commands that inspect sandbox runs
+var RunsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "List and compare sandbox pipeline runs",
+	Long: `Inspect the runs 'vkm pipeline --sandbox' writes under --sandbox-dir.
+
+To A/B test a setting, process the same inputs in two sandbox runs that
+differ only in it, then compare them:
+  vkm pipeline --sandbox --from-file talks.txt --prefer-captions
+  vkm pipeline --sandbox --from-file talks.txt --prefer-captions --strategy two-pass
+  vkm runs list
+  vkm runs compare 20250301-101500-2947120583 20250301-104210-811603974
+
+With --collection, runs are listed and compared over the sources of one
+collection only, so its share of a run's cost can be read off directly.`,
+}
+
+// RunsListCmd lists sandbox runs
+var RunsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List sandbox runs with their configuration and totals",
+	Args:  cobra.NoArgs,
+	RunE:  runRunsList,
+}
+
+// RunsCompareCmd compares two sandbox runs
+var RunsCompareCmd = &cobra.Command{
+	Use:   "compare <run-a> <run-b>",
+	Short: "Compare the cost, speed and facts of two sandbox runs",
+	Long: `Compare two sandbox runs over the same inputs: their configurations,
+Claude cost, extraction time, fact counts and confidence, and how far
+their facts overlap.
+
+Runs are given as run IDs under --sandbox-dir or as run directories.
+Facts are compared source by source, for the sources both runs
+processed. Two facts match when their wording is the same after
+normalization, or when they share at least --similarity of their words
+(Jaccard); each fact matches at most one fact of the other run. Overlap
+is matched facts over all distinct facts, 1.0 meaning both runs
+extracted the same facts.
+
+Cost and time cover fact extraction only, as recorded in each run's
+run.json; runs from before run.json existed show them as unknown.
+
+Examples:
+  vkm runs compare 20250301-101500-2947120583 20250301-104210-811603974
+  vkm runs compare data/sandbox/20250301-101500-2947120583 data/sandbox/20250301-104210-811603974 --format json`,
+	Args: cobra.ExactArgs(2),
+	RunE: runRunsCompare,
+}
+
+var (
+	runsSandboxDir    string
+	runsCollection    string
+	runsFormat        string
+	runsSimilarity    float64
+	runsShowUnmatched int
+)
+
+func init() {
+	RunsCmd.AddCommand(RunsListCmd)
+	RunsCmd.AddCommand(RunsCompareCmd)
+
+	RunsCmd.PersistentFlags().StringVar(&runsSandboxDir, "sandbox-dir", "data/sandbox", "Root directory for sandbox runs")
+	RunsCmd.PersistentFlags().StringVar(&runsCollection, "collection", "", "Only count sources ingested under this collection")
+	RunsCompareCmd.Flags().StringVar(&runsFormat, "format", "text", "Output format (text, json)")
+	RunsCompareCmd.Flags().Float64Var(&runsSimilarity, "similarity", 0.6, "Word overlap (0-1) from which two facts match")
+	RunsCompareCmd.Flags().IntVar(&runsShowUnmatched, "show-unmatched", 5, "Facts found by only one run to print per run (text format)")
+}
+
+// loadedRun is a sandbox run read back from disk
+type loadedRun struct {
+	Dir     string
+	Record  sandboxRun
+	Patches map[string]*Patch // by source ID
+	// Recorded reports whether the run has a run.json
+	Recorded bool
+}
+
+// loadRun reads a run given as a run ID under --sandbox-dir or as a path.
+// Supplementary patches (comments) and, with --collection, patches from
+// other collections are left out.
+func loadRun(ref string) (*loadedRun, error) {
+	dir := ref
+	if _, err := os.Stat(filepath.Join(dir, "patches")); err != nil {
+		dir = filepath.Join(runsSandboxDir, ref)
+		if _, err := os.Stat(filepath.Join(dir, "patches")); err != nil {
+			return nil, fmt.Errorf("no sandbox run %q (not a run directory or a run ID under %s)", ref, runsSandboxDir)
+		}
+	}
+
+	run := &loadedRun{Dir: dir, Patches: make(map[string]*Patch)}
+	if data, err := os.ReadFile(filepath.Join(dir, sandboxRunFile)); err == nil {
+		if err := json.Unmarshal(data, &run.Record); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, sandboxRunFile), err)
+		}
+		run.Recorded = true
+	}
+	if run.Record.RunID == "" {
+		run.Record.RunID = filepath.Base(dir)
+	}
+
+	patches, err := loadLocalPatches(filepath.Join(dir, "patches"))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range patches {
+		if _, ok := p.Metadata["supplementary"]; ok {
+			continue
+		}
+		if runsCollection != "" && patchCollection(p) != runsCollection {
+			continue
+		}
+		run.Patches[orDefault(p.SourceID, p.ID)] = p
+	}
+	return run, nil
+}
+
+// runTotals sums a run's facts, extraction time and cost over sources
+type runTotals struct {
+	Sources        int     `json:"sources"`
+	Facts          int     `json:"facts"`
+	FactsPerSource float64 `json:"facts_per_source"`
+	MeanConfidence float64 `json:"mean_confidence"`
+	Seconds        float64 `json:"extraction_seconds"`
+	CostUSD        float64 `json:"cost_usd"`
+	// Recorded is false when time and cost are unknown
+	Recorded bool `json:"recorded"`
+}
+
+// totals sums the run over the given sources
+func (r *loadedRun) totals(sources []string) runTotals {
+	items := make(map[string]sandboxRunItem)
+	for _, item := range r.Record.Items {
+		items[item.SourceID] = item
+	}
+	t := runTotals{Sources: len(sources), Recorded: r.Recorded}
+	var confidence float64
+	for _, id := range sources {
+		p := r.Patches[id]
+		t.Facts += len(p.Facts)
+		for _, f := range p.Facts {
+			confidence += f.Confidence
+		}
+		t.Seconds += items[id].Seconds
+		t.CostUSD += items[id].CostUSD
+	}
+	if t.Sources > 0 {
+		t.FactsPerSource = float64(t.Facts) / float64(t.Sources)
+	}
+	if t.Facts > 0 {
+		t.MeanConfidence = confidence / float64(t.Facts)
+	}
+	return t
+}
+
+// sourceComparison compares the facts two runs extracted from one source
+type sourceComparison struct {
+	SourceID string   `json:"source_id"`
+	FactsA   int      `json:"facts_a"`
+	FactsB   int      `json:"facts_b"`
+	Matched  int      `json:"matched"`
+	Overlap  float64  `json:"overlap"`
+	OnlyA    []string `json:"only_a"`
+	OnlyB    []string `json:"only_b"`
+}
+
+// runComparison is the result of 'vkm runs compare'
+type runComparison struct {
+	RunA    string               `json:"run_a"`
+	RunB    string               `json:"run_b"`
+	Config  map[string][2]string `json:"config"`
+	TotalsA runTotals            `json:"totals_a"`
+	TotalsB runTotals            `json:"totals_b"`
+	Overlap float64              `json:"overlap"`
+	Matched int                  `json:"matched"`
+	OnlyInA []string             `json:"sources_only_in_a"`
+	OnlyInB []string             `json:"sources_only_in_b"`
+	Sources []sourceComparison   `json:"sources"`
+}
+
+func runRunsCompare(cmd *cobra.Command, args []string) error {
+	if runsFormat != "text" && runsFormat != "json" {
+		return fmt.Errorf("unknown format %q (use text or json)", runsFormat)
+	}
+	if runsSimilarity <= 0 || runsSimilarity > 1 {
+		return fmt.Errorf("--similarity must be between 0 and 1")
+	}
+	a, err := loadRun(args[0])
+	if err != nil {
+		return err
+	}
+	b, err := loadRun(args[1])
+	if err != nil {
+		return err
+	}
+
+	c := compareRuns(a, b, runsSimilarity)
+	if runsFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+	printRunComparison(os.Stdout, c)
+	return nil
+}
+
+// compareRuns compares two runs over the sources both processed
+func compareRuns(a, b *loadedRun, similarity float64) *runComparison {
+	c := &runComparison{RunA: a.Record.RunID, RunB: b.Record.RunID, Config: make(map[string][2]string)}
+	for k, v := range a.Record.Config {
+		c.Config[k] = [2]string{v, b.Record.Config[k]}
+	}
+	for k, v := range b.Record.Config {
+		if _, ok := a.Record.Config[k]; !ok {
+			c.Config[k] = [2]string{"", v}
+		}
+	}
+
+	var common []string
+	for id := range a.Patches {
+		if _, ok := b.Patches[id]; ok {
+			common = append(common, id)
+		} else {
+			c.OnlyInA = append(c.OnlyInA, id)
+		}
+	}
+	for id := range b.Patches {
+		if _, ok := a.Patches[id]; !ok {
+			c.OnlyInB = append(c.OnlyInB, id)
+		}
+	}
+	sort.Strings(common)
+	sort.Strings(c.OnlyInA)
+	sort.Strings(c.OnlyInB)
+
+	c.TotalsA, c.TotalsB = a.totals(common), b.totals(common)
+	distinct := 0
+	for _, id := range common {
+		s := compareFacts(id, a.Patches[id].Facts, b.Patches[id].Facts, similarity)
+		c.Sources = append(c.Sources, s)
+		c.Matched += s.Matched
+		distinct += s.FactsA + s.FactsB - s.Matched
+	}
+	if distinct > 0 {
+		c.Overlap = float64(c.Matched) / float64(distinct)
+	}
+	return c
+}
+
+// compareFacts matches two runs' facts for one source: identical wording
+// first, then the most similar remaining pairs down to similarity
+func compareFacts(sourceID string, factsA, factsB []Fact, similarity float64) sourceComparison {
+	s := sourceComparison{SourceID: sourceID, FactsA: len(factsA), FactsB: len(factsB)}
+	wordsA, wordsB := make([]map[string]bool, len(factsA)), make([]map[string]bool, len(factsB))
+	for i, f := range factsA {
+		wordsA[i] = factWords(f.Text)
+	}
+	for j, f := range factsB {
+		wordsB[j] = factWords(f.Text)
+	}
+
+	type pair struct {
+		i, j  int
+		score float64
+	}
+	var pairs []pair
+	for i := range factsA {
+		for j := range factsB {
+			score := wordJaccard(wordsA[i], wordsB[j])
+			if normalizeFactText(factsA[i].Text) == normalizeFactText(factsB[j].Text) {
+				score = 2 // identical wording beats any partial match
+			}
+			if score >= similarity {
+				pairs = append(pairs, pair{i, j, score})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(x, y int) bool { return pairs[x].score > pairs[y].score })
+
+	usedA, usedB := make([]bool, len(factsA)), make([]bool, len(factsB))
+	for _, p := range pairs {
+		if usedA[p.i] || usedB[p.j] {
+			continue
+		}
+		usedA[p.i], usedB[p.j] = true, true
+		s.Matched++
+	}
+	for i, used := range usedA {
+		if !used {
+			s.OnlyA = append(s.OnlyA, factsA[i].Text)
+		}
+	}
+	for j, used := range usedB {
+		if !used {
+			s.OnlyB = append(s.OnlyB, factsB[j].Text)
+		}
+	}
+	if distinct := s.FactsA + s.FactsB - s.Matched; distinct > 0 {
+		s.Overlap = float64(s.Matched) / float64(distinct)
+	}
+	return s
+}
+
+// normalizeFactText lowercases text and collapses its whitespace
+func normalizeFactText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// factWords is the set of lowercased words of three or more letters or
+// digits in text
+func factWords(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(w)) >= 3 {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+// wordJaccard is the size of the intersection of two word sets over the
+// size of their union
+func wordJaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range a {
+		if b[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func printRunComparison(out io.Writer, c *runComparison) {
+	fmt.Fprintf(out, "A: %s\nB: %s\n", c.RunA, c.RunB)
+
+	if len(c.Config) > 0 {
+		keys := make([]string, 0, len(c.Config))
+		for k := range c.Config {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "\nSETTING\tA\tB\t")
+		for _, k := range keys {
+			v := c.Config[k]
+			mark := ""
+			if v[0] != v[1] {
+				mark = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k, orDefault(v[0], "-"), orDefault(v[1], "-"), mark)
+		}
+		w.Flush()
+	}
+
+	a, b := c.TotalsA, c.TotalsB
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "\nOVER %d SHARED SOURCES\tA\tB\tB-A\n", a.Sources)
+	fmt.Fprintf(w, "Facts\t%d\t%d\t%+d\n", a.Facts, b.Facts, b.Facts-a.Facts)
+	fmt.Fprintf(w, "Facts per source\t%.1f\t%.1f\t%+.1f\n", a.FactsPerSource, b.FactsPerSource, b.FactsPerSource-a.FactsPerSource)
+	fmt.Fprintf(w, "Mean confidence\t%.2f\t%.2f\t%+.2f\n", a.MeanConfidence, b.MeanConfidence, b.MeanConfidence-a.MeanConfidence)
+	if a.Recorded && b.Recorded {
+		fmt.Fprintf(w, "Extraction time\t%s\t%s\t%+.0fs\n", secondsString(a.Seconds), secondsString(b.Seconds), b.Seconds-a.Seconds)
+		fmt.Fprintf(w, "Claude cost\t$%.4f\t$%.4f\t%+.4f\n", a.CostUSD, b.CostUSD, b.CostUSD-a.CostUSD)
+	} else {
+		fmt.Fprintln(w, "Extraction time, cost\tunknown (run without run.json)\t\t")
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\nFact overlap: %.0f%% (%d matched, %d only in A, %d only in B)\n",
+		c.Overlap*100, c.Matched, a.Facts-c.Matched, b.Facts-c.Matched)
+	if len(c.OnlyInA)+len(c.OnlyInB) > 0 {
+		fmt.Fprintf(out, "Sources not in both runs (not compared): %d only in A, %d only in B\n", len(c.OnlyInA), len(c.OnlyInB))
+	}
+
+	if len(c.Sources) > 0 {
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "\nSOURCE\tFACTS A\tFACTS B\tMATCHED\tOVERLAP")
+		for _, s := range c.Sources {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.0f%%\n", s.SourceID, s.FactsA, s.FactsB, s.Matched, s.Overlap*100)
+		}
+		w.Flush()
+	}
+
+	if runsShowUnmatched > 0 {
+		printUnmatched(out, "A", c.Sources, func(s sourceComparison) []string { return s.OnlyA })
+		printUnmatched(out, "B", c.Sources, func(s sourceComparison) []string { return s.OnlyB })
+	}
+}
+
+// printUnmatched prints up to --show-unmatched facts only one run found
+func printUnmatched(out io.Writer, run string, sources []sourceComparison, only func(sourceComparison) []string) {
+	var facts []string
+	for _, s := range sources {
+		for _, f := range only(s) {
+			facts = append(facts, s.SourceID+": "+f)
+		}
+	}
+	if len(facts) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "\nOnly in %s:\n", run)
+	for i, f := range facts {
+		if i == runsShowUnmatched {
+			fmt.Fprintf(out, "  ... and %d more\n", len(facts)-i)
+			break
+		}
+		fmt.Fprintf(out, "  - %s\n", f)
+	}
+}
+
+// secondsString prints a duration in seconds rounded to the second
+func secondsString(s float64) string {
+	return (time.Duration(s) * time.Second).String()
+}
+
+func runRunsList(cmd *cobra.Command, args []string) error {
+	entries, err := os.ReadDir(runsSandboxDir)
+	if os.IsNotExist(err) {
+		fmt.Printf("No sandbox runs in %s\n", runsSandboxDir)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read sandbox directory: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tSOURCES\tFACTS\tCOST\tMODEL\tSTRATEGY\tPROMPT")
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		run, err := loadRun(filepath.Join(runsSandboxDir, e.Name()))
+		if err != nil || (runsCollection != "" && len(run.Patches) == 0) {
+			continue
+		}
+		sources := make([]string, 0, len(run.Patches))
+		for id := range run.Patches {
+			sources = append(sources, id)
+		}
+		t := run.totals(sources)
+		cost := "?"
+		if t.Recorded {
+			cost = fmt.Sprintf("$%.4f", t.CostUSD)
+		}
+		cfg := run.Record.Config
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", run.Record.RunID, t.Sources, t.Facts, cost,
+			orDefault(cfg["extract-model"], "?"), orDefault(cfg["strategy"], "?"), orDefault(cfg["prompt-version"], "?"))
+	}
+	return w.Flush()
+}
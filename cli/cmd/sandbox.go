@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sandbox is a per-run directory that receives patches instead of the backend.
+// Each run gets its own subdirectory so runs can be compared side by side and
+// discarded without affecting the shared graph.
+type sandbox struct {
+	RunID string
+	Dir   string
+
+	mu  sync.Mutex
+	run *sandboxRun
+}
+
+// sandboxRunFile is the file in a run's directory recording its
+// configuration and per-source results, for 'vkm runs'
+const sandboxRunFile = "run.json"
+
+// sandboxRun is the record of a sandbox run kept in its run.json
+type sandboxRun struct {
+	RunID     string            `json:"run_id"`
+	StartedAt time.Time         `json:"started_at"`
+	Config    map[string]string `json:"config"`
+	Items     []sandboxRunItem  `json:"items"`
+}
+
+// sandboxRunItem is one source extracted in a sandbox run
+type sandboxRunItem struct {
+	SourceID string  `json:"source_id"`
+	PatchID  string  `json:"patch_id"`
+	Facts    int     `json:"facts"`
+	Seconds  float64 `json:"extraction_seconds"`
+	CostUSD  float64 `json:"cost_usd"`
+}
+
+// newSandbox creates the directory for a new sandbox run under root. Run
+// IDs start with the time the run started, and end in a random suffix so
+// runs started within the same second don't share a directory.
+func newSandbox(root string) (*sandbox, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(root, time.Now().UTC().Format("20060102-150405")+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "patches"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+
+	return &sandbox{RunID: filepath.Base(dir), Dir: dir}, nil
+}
+
+// StartRun records the configuration the run extracts with, starting its
+// run.json
+func (s *sandbox) StartRun(config map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run = &sandboxRun{RunID: s.RunID, StartedAt: time.Now().UTC(), Config: config, Items: []sandboxRunItem{}}
+	return s.writeRun()
+}
+
+// RecordItem adds an extracted source to the run's run.json, if the run
+// was started with StartRun
+func (s *sandbox) RecordItem(item sandboxRunItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.run == nil {
+		return nil
+	}
+	s.run.Items = append(s.run.Items, item)
+	return s.writeRun()
+}
+
+func (s *sandbox) writeRun() error {
+	data, err := json.MarshalIndent(s.run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run record: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.Dir, sandboxRunFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write run record: %w", err)
+	}
+	return nil
+}
+
+// SavePatch writes a patch as JSON into the sandbox and returns its path
+func (s *sandbox) SavePatch(patch Patch) (string, error) {
+	return savePatchFile(filepath.Join(s.Dir, "patches"), patch)
+}
+
+// savePatchFile writes a patch as <id>.json in dir and returns its path
+func savePatchFile(dir string, patch Patch) (string, error) {
+	path := filepath.Join(dir, patch.ID+".json")
+	if err := writePatchFile(path, patch); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// writePatchFile writes a patch as indented JSON to path
+func writePatchFile(path string, patch Patch) error {
+	data, err := json.MarshalIndent(patch, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal patch: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write patch: %w", err)
+	}
+	return nil
+}
+
+// extractToSandbox runs fact extraction locally and stores the resulting
+// patch in the sandbox. It mirrors uploadToBackend but never contacts the
+// backend.
+func extractToSandbox(ctx context.Context, sb *sandbox, content, filename string, commit patchCommit, sections []chapterSection) (patchID string, factsCount int, err error) {
+	var facts []Fact
+	var outline string
+	start, spent := time.Now(), claudeSpend()
+	if len(sections) > 0 {
+		facts, outline, err = extractChapterFacts(ctx, sections, filename)
+	} else {
+		facts, outline, err = extractFacts(ctx, content, filename)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	item := sandboxRunItem{
+		SourceID: filename,
+		Facts:    len(facts),
+		Seconds:  time.Since(start).Seconds(),
+		CostUSD:  claudeSpend() - spent,
+	}
+
+	patch := newPatch(filename, facts)
+	if !commit.Timestamp.IsZero() {
+		patch.Timestamp = commit.Timestamp.UTC()
+		for i := range patch.Facts {
+			patch.Facts[i].ValidFrom = patch.Timestamp
+		}
+	}
+	patch.Metadata = map[string]interface{}{
+		"sandbox-run":    sb.RunID,
+		"prompt-version": promptVersion(extractionPrompt),
+		"extract-model":  pipelineExtractModel,
+	}
+	if outline != "" {
+		patch.Metadata["extraction-strategy"] = extractStrategyTwoPass
+		patch.Metadata["prompt-version"] = promptVersion(outlinePrompt + outlineContextPrompt + extractionPrompt)
+		patch.Metadata["outline"] = outline
+	}
+	for k, v := range commit.withCollection().Metadata {
+		patch.Metadata[k] = v
+	}
+
+	if _, err := sb.SavePatch(patch); err != nil {
+		return "", 0, err
+	}
+	item.PatchID = patch.ID
+	if err := sb.RecordItem(item); err != nil {
+		fmt.Fprintf(os.Stderr, "  Warning: %v\n", err)
+	}
+
+	return patch.ID, len(facts), nil
+}
+
+// extractFacts extracts facts from content with --extract-model and
+// --strategy, returning the outline of two-pass extraction
+func extractFacts(ctx context.Context, content, sourceID string) ([]Fact, string, error) {
+	if pipelineStrategy == extractStrategyTwoPass {
+		return extractFactsTwoPass(ctx, pipelineExtractModel, content, sourceID)
+	}
+	facts, err := extractFactsWithClaude(ctx, pipelineExtractModel, content, sourceID)
+	return facts, "", err
+}
+
+// extractChapterFacts extracts facts one chapter at a time, attributing
+// each to its chapter and, when Claude gives no timestamp, placing it at
+// the chapter's start
+func extractChapterFacts(ctx context.Context, sections []chapterSection, sourceID string) ([]Fact, string, error) {
+	var facts []Fact
+	var outlines []string
+	for _, s := range sections {
+		chapterFacts, outline, err := extractFacts(ctx, s.Text, sourceID)
+		if err != nil {
+			return nil, "", fmt.Errorf("chapter %q: %w", s.Chapter.Title, err)
+		}
+		for i := range chapterFacts {
+			chapterFacts[i].Chapter = s.Chapter.Title
+			if chapterFacts[i].TimestampInVideo == 0 {
+				chapterFacts[i].TimestampInVideo = s.Chapter.Start
+			}
+		}
+		facts = append(facts, chapterFacts...)
+		if outline != "" {
+			outlines = append(outlines, "## "+s.Chapter.Title+"\n"+outline)
+		}
+	}
+	return facts, strings.Join(outlines, "\n\n"), nil
+}
+
+// sandboxRunConfig is the configuration a pipeline sandbox run records:
+// everything that changes which facts it extracts
+func sandboxRunConfig() map[string]string {
+	prompt := extractionPrompt
+	if pipelineStrategy == extractStrategyTwoPass {
+		prompt = outlinePrompt + outlineContextPrompt + extractionPrompt
+	}
+	return map[string]string{
+		"extract-model":   pipelineExtractModel,
+		"strategy":        pipelineStrategy,
+		"prompt-version":  promptVersion(prompt),
+		"prefer-captions": strconv.FormatBool(pipelineCaptions),
+		"caption-langs":   captionLangs,
+		"comments":        strconv.Itoa(pipelineComments),
+		"split-chapters":  strconv.FormatBool(pipelineSplitChapters),
+	}
+}
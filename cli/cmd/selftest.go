@@ -0,0 +1,489 @@
+package cmd
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// SelftestCmd checks an installation end to end with a bundled sample
+var SelftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check the installation end to end with a bundled sample",
+	Long: `Check that vkm works on this machine: first the installation (yt-dlp,
+ffmpeg, the OPENAI_API_KEY and CLAUDE_API_KEY keys, the backend's
+/health), then every pipeline stage on a tiny audio sample built into
+vkm.
+
+The stages run against a local mock of the Whisper API, the Claude API
+and the backend, so no keys are used, nothing is stored in the graph
+and the outputs are always the same:
+  1. download   yt-dlp fetches the sample from the mock and ffmpeg
+                extracts its audio, as in 'vkm pipeline'
+  2. transcribe the audio is sent to the mock Whisper API and the
+                response converted into a transcript
+  3. extract    facts are extracted from the transcript through the mock
+                Claude API into a sandbox patch
+  4. upload     the transcript is sent to the mock backend's /api/upload
+Each stage's output is compared with golden output built into vkm, so a
+stage that behaves differently after an upgrade (of vkm, yt-dlp or
+ffmpeg) is reported with the first difference. Later stages still run
+when one fails, on the bundled sample if the download failed.
+
+The installation checks use the real keys and --backend; --no-backend
+skips the backend for machines that only run sandbox pipelines. The
+command fails if any check or stage does.
+
+Examples:
+  vkm selftest
+  vkm selftest --backend http://my-server:3000
+  vkm selftest --no-backend --output selftest-run`,
+	Args: cobra.NoArgs,
+	RunE: runSelftest,
+}
+
+var (
+	selftestNoBackend bool
+	selftestOutput    string
+)
+
+func init() {
+	SelftestCmd.Flags().StringVarP(&pipelineBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	SelftestCmd.Flags().BoolVar(&selftestNoBackend, "no-backend", false, "Don't check the backend")
+	SelftestCmd.Flags().StringVarP(&selftestOutput, "output", "o", "", "Keep the stages' files in this directory (default: a temporary directory)")
+}
+
+// The mock providers' answers, and the golden output of each stage
+var (
+	//go:embed selftest/whisper_response.json
+	selftestWhisperResponse []byte
+	//go:embed selftest/claude_response.txt
+	selftestClaudeResponse string
+	//go:embed selftest/golden_transcript.json
+	selftestGoldenTranscript []byte
+	//go:embed selftest/golden_patch.json
+	selftestGoldenPatch []byte
+	//go:embed selftest/golden_upload.json
+	selftestGoldenUpload []byte
+)
+
+// selftestSourceID is the source ID the sample is processed under
+const selftestSourceID = "vkm-selftest"
+
+// selftestPatchID is the patch ID the mock backend answers with
+const selftestPatchID = "00000000-0000-4000-8000-5e1f7e57da7a"
+
+// selftestResults counts a self-test's checks as they are reported
+type selftestResults struct {
+	checks, failed int
+}
+
+func (r *selftestResults) pass(name, detail string) {
+	r.checks++
+	fmt.Printf("  ✓ %-12s %s\n", name, detail)
+}
+
+func (r *selftestResults) fail(name string, err error) {
+	r.checks++
+	r.failed++
+	fmt.Printf("  ✗ %-12s %v\n", name, err)
+}
+
+func (r *selftestResults) skip(name, reason string) {
+	fmt.Printf("  - %-12s %s\n", name, reason)
+}
+
+func runSelftest(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	results := &selftestResults{}
+
+	fmt.Println("Installation:")
+	if path, err := findTool("yt-dlp"); err != nil {
+		results.fail("yt-dlp", err)
+	} else if version, err := ytDlpVersion(path); err != nil {
+		results.fail("yt-dlp", fmt.Errorf("%s failed to run: %w", path, err))
+	} else {
+		results.pass("yt-dlp", fmt.Sprintf("%s (%s)", version, path))
+	}
+	if commandExists("ffmpeg") {
+		results.pass("ffmpeg", "found")
+	} else {
+		results.fail("ffmpeg", missingToolError("ffmpeg"))
+	}
+	if os.Getenv("OPENAI_API_KEY") != "" {
+		results.pass("OpenAI key", "OPENAI_API_KEY is set")
+	} else {
+		results.fail("OpenAI key", fmt.Errorf("OPENAI_API_KEY is not set (needed for transcription)"))
+	}
+	if os.Getenv("CLAUDE_API_KEY") != "" {
+		results.pass("Claude key", "CLAUDE_API_KEY is set")
+	} else {
+		results.skip("Claude key", "CLAUDE_API_KEY is not set (only needed for --sandbox and --comments)")
+	}
+	if selftestNoBackend {
+		results.skip("backend", "skipped (--no-backend)")
+	} else if err := waitForBackend(ctx, pipelineBackendURL, 0); err != nil {
+		results.fail("backend", err)
+	} else {
+		results.pass("backend", pipelineBackendURL+" is healthy")
+	}
+
+	dir := selftestOutput
+	if dir == "" {
+		var err error
+		if dir, err = newTempDir("selftest-*"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+	}
+	if err := runSelftestStages(cmd, dir, results); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if results.failed > 0 {
+		return fmt.Errorf("self-test failed: %d of %d checks failed", results.failed, results.checks)
+	}
+	fmt.Printf("✓ Self-test passed (%d checks)\n", results.checks)
+	if selftestOutput != "" {
+		fmt.Printf("Stage outputs saved to: %s\n", selftestOutput)
+	}
+	return nil
+}
+
+// runSelftestStages runs the sample through every pipeline stage against
+// the mock providers, comparing each stage's output with its golden output
+func runSelftestStages(cmd *cobra.Command, dir string, results *selftestResults) error {
+	ctx := cmd.Context()
+	videoDir := filepath.Join(dir, "videos")
+	if err := os.MkdirAll(videoDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	mock := newSelftestMock()
+	defer mock.Close()
+	restore := mock.install()
+	defer restore()
+
+	fmt.Printf("\nPipeline (mock providers at %s):\n", mock.URL)
+
+	// 1. Download
+	samplePath := filepath.Join(videoDir, selftestSourceID+".wav")
+	infoPath := ""
+	if media, err := downloadVideoForPipeline(ctx, mock.URL+"/media/"+selftestSourceID+".wav", videoDir); err != nil {
+		results.fail("download", err)
+	} else if fi, err := os.Stat(media.Path); err != nil || fi.Size() == 0 {
+		results.fail("download", fmt.Errorf("yt-dlp reported %s, but it is missing or empty", media.Path))
+	} else if _, err := loadVideoMetadata(media.InfoPath); err != nil {
+		results.fail("download", fmt.Errorf("failed to read metadata %s: %w", media.InfoPath, err))
+	} else {
+		samplePath, infoPath = media.Path, media.InfoPath
+		results.pass("download", fmt.Sprintf("%s (%d bytes)", filepath.Base(media.Path), fi.Size()))
+	}
+	if infoPath == "" {
+		// Later stages still get audio to work on
+		if err := os.WriteFile(samplePath, selftestSample(), 0644); err != nil {
+			return fmt.Errorf("failed to write sample: %w", err)
+		}
+	}
+
+	// 2. Transcribe
+	var text string
+	if transcript, err := transcribeForPipeline(ctx, samplePath, infoPath); err != nil {
+		results.fail("transcribe", err)
+	} else {
+		text = transcriptText(transcript)
+		if err := compareGolden(dir, "transcript.json", transcript, selftestGoldenTranscript); err != nil {
+			results.fail("transcribe", err)
+		} else {
+			results.pass("transcribe", fmt.Sprintf("%d segments, %d characters", len(transcript.Transcript), len(text)))
+		}
+	}
+	if text == "" {
+		// Extraction and upload are checked on the golden transcript
+		var golden Transcript
+		if err := json.Unmarshal(selftestGoldenTranscript, &golden); err != nil {
+			return fmt.Errorf("invalid golden transcript: %w", err)
+		}
+		text = transcriptText(&golden)
+	}
+
+	// 3. Extract
+	sb, err := newSandbox(filepath.Join(dir, "sandbox"))
+	if err != nil {
+		return err
+	}
+	if patchID, _, err := extractToSandbox(ctx, sb, text, selftestSourceID, patchCommit{}, nil); err != nil {
+		results.fail("extract", err)
+	} else if patch, err := readPatchFile(filepath.Join(sb.Dir, "patches", patchID+".json")); err != nil {
+		results.fail("extract", err)
+	} else if err := compareGolden(dir, "patch.json", selftestPatchSummary(patch), selftestGoldenPatch); err != nil {
+		results.fail("extract", err)
+	} else {
+		results.pass("extract", fmt.Sprintf("%d facts", len(patch.Facts)))
+	}
+
+	// 4. Upload
+	if patchID, factsCount, err := uploadToBackend(ctx, text, selftestSourceID, patchCommit{}); err != nil {
+		results.fail("upload", err)
+	} else if patchID != selftestPatchID {
+		results.fail("upload", fmt.Errorf("backend answered patch %s, but the upload reported %q", selftestPatchID, patchID))
+	} else if err := compareGolden(dir, "upload.json", mock.lastUpload(), selftestGoldenUpload); err != nil {
+		results.fail("upload", err)
+	} else {
+		results.pass("upload", fmt.Sprintf("patch %s, %d facts", patchID, factsCount))
+	}
+	return nil
+}
+
+// selftestPatchSummary is the part of an extracted patch that doesn't
+// change between runs: no IDs or timestamps
+func selftestPatchSummary(p *Patch) map[string]interface{} {
+	facts := make([]map[string]interface{}, 0, len(p.Facts))
+	for _, f := range p.Facts {
+		facts = append(facts, map[string]interface{}{
+			"text":           f.Text,
+			"topic":          f.Topic,
+			"confidence":     f.Confidence,
+			"extracted-from": f.ExtractedFrom,
+		})
+	}
+	return map[string]interface{}{
+		"source":        p.Source,
+		"source-id":     p.SourceID,
+		"facts":         facts,
+		"extract-model": p.Metadata["extract-model"],
+	}
+}
+
+// readPatchFile reads a patch written by writePatchFile
+func readPatchFile(path string) (*Patch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch: %w", err)
+	}
+	var p Patch
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse patch %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// compareGolden saves a stage's output as name in dir and compares it,
+// as indented JSON, with the golden output. A difference is reported at
+// its first line.
+func compareGolden(dir, name string, output interface{}, golden []byte) error {
+	got, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), append(got, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to save output: %w", err)
+	}
+
+	// The golden file is normalized the same way, so formatting differences
+	// don't count
+	var parsed interface{}
+	if err := json.Unmarshal(golden, &parsed); err != nil {
+		return fmt.Errorf("invalid golden %s: %w", name, err)
+	}
+	want, _ := json.MarshalIndent(parsed, "", "  ")
+	var normalized interface{}
+	json.Unmarshal(got, &normalized)
+	got, _ = json.MarshalIndent(normalized, "", "  ")
+	if bytes.Equal(got, want) {
+		return nil
+	}
+
+	gotLines, wantLines := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := 0; i < max(len(gotLines), len(wantLines)); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = strings.TrimSpace(gotLines[i])
+		}
+		if i < len(wantLines) {
+			w = strings.TrimSpace(wantLines[i])
+		}
+		if g != w {
+			return fmt.Errorf("%s differs from the golden output at line %d: got %q, want %q", name, i+1, g, w)
+		}
+	}
+	return nil
+}
+
+// selftestSample is the bundled audio: a second of a 440 Hz tone as
+// 16 kHz mono 16-bit WAV
+func selftestSample() []byte {
+	const rate = 16000
+	samples := make([]int16, rate)
+	for i := range samples {
+		samples[i] = int16(8000 * math.Sin(2*math.Pi*440*float64(i)/rate))
+	}
+
+	var buf bytes.Buffer
+	dataSize := uint32(len(samples) * 2)
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, 36+dataSize)
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, struct {
+		ChunkSize     uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}{16, 1, 1, rate, rate * 2, 2, 16})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, dataSize)
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
+
+// selftestMock serves the sample and stands in for the Whisper API, the
+// Claude API and the backend. Requests missing what the real service
+// requires are answered 400, so a client that stops sending it fails
+// its stage.
+type selftestMock struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	upload map[string]interface{}
+}
+
+func newSelftestMock() *selftestMock {
+	m := &selftestMock{}
+	mux := http.NewServeMux()
+	sample := selftestSample()
+	mux.HandleFunc("/media/"+selftestSourceID+".wav", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/wav")
+		http.ServeContent(w, r, selftestSourceID+".wav", time.Time{}, bytes.NewReader(sample))
+	})
+	mux.HandleFunc("/v1/audio/transcriptions", m.whisper)
+	mux.HandleFunc("/v1/messages", m.claude)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/api/upload", m.backendUpload)
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+// install points the Whisper and Claude clients and the backend URL at
+// the mock, with stand-in keys where none are set and a scratch cache of
+// Whisper responses, and returns a func that undoes it
+func (m *selftestMock) install() func() {
+	savedWhisper, savedClaude, savedBackend, savedCache := whisperAPIURL, claudeAPIURL, pipelineBackendURL, whisperCacheDir
+	whisperAPIURL = m.URL + "/v1/audio/transcriptions"
+	if dir, err := newTempDir("selftest-whisper-*"); err == nil {
+		whisperCacheDir = dir
+	}
+	claudeAPIURL = m.URL + "/v1/messages"
+	pipelineBackendURL = m.URL
+
+	var unset []string
+	for _, key := range []string{"OPENAI_API_KEY", "CLAUDE_API_KEY"} {
+		if os.Getenv(key) == "" {
+			os.Setenv(key, "selftest")
+			unset = append(unset, key)
+		}
+	}
+	return func() {
+		if whisperCacheDir != savedCache {
+			os.RemoveAll(whisperCacheDir)
+		}
+		whisperAPIURL, claudeAPIURL, pipelineBackendURL, whisperCacheDir = savedWhisper, savedClaude, savedBackend, savedCache
+		for _, key := range unset {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func (m *selftestMock) whisper(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		http.Error(w, "missing Authorization header", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "expected a multipart form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	if n, _ := io.Copy(io.Discard, file); n == 0 {
+		http.Error(w, "empty file", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("model") == "" {
+		http.Error(w, "missing model", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(selftestWhisperResponse)
+}
+
+func (m *selftestMock) claude(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("x-api-key") == "" || r.Header.Get("anthropic-version") == "" {
+		http.Error(w, "missing x-api-key or anthropic-version header", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model == "" || len(req.Messages) == 0 {
+		http.Error(w, "expected a model and messages", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": selftestClaudeResponse}},
+		"usage":   map[string]int{"input_tokens": len(req.Messages[0].Content) / 4, "output_tokens": len(selftestClaudeResponse) / 4},
+	})
+}
+
+func (m *selftestMock) backendUpload(w http.ResponseWriter, r *http.Request) {
+	var upload map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&upload); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if content, _ := upload["content"].(string); content == "" {
+		http.Error(w, "missing content", http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	m.upload = upload
+	m.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"patch-id":    selftestPatchID,
+		"facts-count": 2,
+		"message":     "stored",
+	})
+}
+
+// lastUpload is the body of the last upload the mock backend received
+func (m *selftestMock) lastUpload() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.upload
+}
@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ServeCmd groups the long-running server modes
+var ServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run vkm as a long-running service",
+	Long: `Run vkm as a long-running service that accepts work over HTTP and
+processes it with the pipeline.
+
+Examples:
+  vkm serve token --role submit --name ci
+  vkm serve api --addr :8080
+  vkm serve api --enrich-at 03:00 --enrich-max-cost 2
+  vkm serve api --snapshot-at 04:00 --snapshot-keep 14
+  vkm serve api --metadata-workers 8 --audio-budget 6h --sleep-between 30s
+  vkm serve webhooks --addr :8080
+  vkm serve public --snapshot graph.json`,
+}
+
+// ServeWebhooksCmd receives signed webhooks and processes referenced videos
+var ServeWebhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "Receive signed webhooks and queue referenced videos",
+	Long: `Listen for inbound webhooks and queue the videos they reference as
+pipeline jobs in the manifest, processing them with a background worker.
+
+Endpoints (each is disabled unless its secret is set):
+  /webhooks/websub   YouTube push notifications      VKM_WEBSUB_SECRET
+  /webhooks/slack    Slack events / slash commands   SLACK_SIGNING_SECRET
+  /webhooks/generic  {"urls": [...]} JSON payloads   VKM_WEBHOOK_SECRET
+
+WebSub subscriptions are confirmed, and their deliveries queued, only for
+the channels listed in VKM_WEBSUB_CHANNELS (comma-separated channel IDs).
+Deliveries whose newest entry is over a day old are refused as replays.
+
+Generic requests must send X-Vkm-Timestamp (unix seconds) and
+X-Vkm-Signature: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">.
+Requests older than 5 minutes and replayed signatures are rejected.
+
+` + jobPhasesHelp + `
+
+` + motiveAlertsHelp + `
+
+Example:
+  VKM_WEBHOOK_SECRET=... vkm serve webhooks --addr :8080 --backend http://localhost:3000`,
+	RunE: runServeWebhooks,
+}
+
+var serveAddr string
+
+func init() {
+	ServeCmd.AddCommand(ServeWebhooksCmd)
+
+	ServeWebhooksCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "Address to listen on")
+	ServeWebhooksCmd.Flags().StringVarP(&pipelineOutputDir, "output", "o", "data/pipeline", "Working directory for pipeline files")
+	ServeWebhooksCmd.Flags().StringVarP(&pipelineBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	ServeWebhooksCmd.Flags().DurationVar(&pipelineWaitBackend, "wait-for-backend", 0, "Wait up to this long (e.g. 60s) for the backend to become healthy")
+	ServeWebhooksCmd.Flags().StringVar(&pipelineManifest, "manifest", "data/manifest.db", "SQLite manifest holding the job queue")
+}
+
+func runServeWebhooks(cmd *cobra.Command, args []string) error {
+	secrets := webhookSecretsFromEnv()
+	if secrets.WebSub == "" && secrets.Slack == "" && secrets.Generic == "" {
+		return fmt.Errorf("no webhook secrets configured (set VKM_WEBSUB_SECRET, SLACK_SIGNING_SECRET or VKM_WEBHOOK_SECRET)")
+	}
+
+	if err := checkPipelinePrerequisites(cmd.Context()); err != nil {
+		return err
+	}
+
+	run, err := newPipelineRun(pipelineOutputDir)
+	if err != nil {
+		return err
+	}
+	defer run.Close()
+
+	mux := http.NewServeMux()
+	newWebhookHandler(secrets, run.manifest).Register(mux)
+
+	return serveWithWorker(mux, run)
+}
+
+// serveWithWorker serves mux on serveAddr while a worker drains the job
+// queue, until interrupted. With --enrich-at it also queues a nightly
+// enrichment job, and with --snapshot-at a daily snapshot job.
+func serveWithWorker(mux *http.ServeMux, run *pipelineRun) error {
+	var enrichAt, snapshotAt time.Time
+	if serveEnrichAt != "" {
+		var err error
+		if enrichAt, err = time.Parse("15:04", serveEnrichAt); err != nil {
+			return fmt.Errorf("invalid --enrich-at %q (use HH:MM)", serveEnrichAt)
+		}
+	}
+	if serveSnapshotAt != "" {
+		var err error
+		if snapshotAt, err = time.Parse("15:04", serveSnapshotAt); err != nil {
+			return fmt.Errorf("invalid --snapshot-at %q (use HH:MM)", serveSnapshotAt)
+		}
+		if _, err := snapshotOptionsFromFlags(); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := startMotiveAlerts(run.manifest); err != nil {
+		return err
+	}
+	if err := startMetadataWorkers(ctx, run.manifest); err != nil {
+		return err
+	}
+	if serveEnrichAt != "" {
+		go scheduleDailyJob(ctx, run.manifest, enrichAt, enrichJobURL, enrichJobOrigin, "nightly enrichment")
+		fmt.Printf("Enrichment scheduled daily at %s (budget %s, $%.2f)\n", serveEnrichAt, enrichBudget, enrichMaxCost)
+	}
+	if serveSnapshotAt != "" {
+		go scheduleDailyJob(ctx, run.manifest, snapshotAt, snapshotJobURL, snapshotJobOrigin, "graph snapshot")
+		fmt.Printf("Snapshots scheduled daily at %s into %s (keeping %d, plus %d monthly)\n", serveSnapshotAt, snapshotDir, snapshotKeep, snapshotKeepMonthly)
+	}
+
+	server := &http.Server{
+		Addr:              serveAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		runJobWorker(ctx, run)
+	}()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("Listening on %s\n", serveAddr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		stop()
+		<-workerDone
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	<-workerDone
+	return nil
+}
+
+// runJobWorker processes queued jobs one at a time until ctx is done,
+// waiting --sleep-between after each before the next download. Once a
+// batch of URLs has been processed and the queue is empty, it queues a
+// motive analysis (with --motive-webhook).
+func runJobWorker(ctx context.Context, run *pipelineRun) {
+	ingested := false
+	for {
+		job, err := claimServeJob(run.manifest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if job == nil && ingested && err == nil {
+			ingested = false
+			queueMotiveAnalysis(run.manifest)
+			continue
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(2 * time.Second):
+				continue
+			}
+		}
+
+		if job.Title != "" {
+			fmt.Printf("Job %d (%s): %s\n", job.ID, job.Origin, job.Title)
+		} else {
+			fmt.Printf("Job %d (%s)\n", job.ID, job.Origin)
+		}
+		if isInternalJob(job) {
+			runJob(ctx, run, job)
+			continue
+		}
+		if err := downloadPacer.wait(ctx); err != nil {
+			run.manifest.RequeueJob(job.ID)
+			return
+		}
+		if runJob(ctx, run, job) {
+			ingested = true
+		}
+		downloadPacer.done(downloadSleepBetween)
+	}
+}
+
+// runJob processes one claimed job, and reports whether it succeeded. The
+// job is canceled when a cancel is requested through the manifest, and
+// requeued when ctx ends because the server is shutting down.
+func runJob(ctx context.Context, run *pipelineRun, job *Job) bool {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	canceled := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-ticker.C:
+				if requested, _ := run.manifest.JobCancelRequested(job.ID); requested {
+					close(canceled)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	var patchID string
+	var err error
+	switch {
+	case isEnrichJob(job):
+		_, err = runEnrichment(jobCtx, run.manifest, enrichOptionsFromFlags())
+	case isMotivesJob(job):
+		_, err = analyzeMotives(jobCtx, run.manifest, pipelineBackendURL)
+	case isSnapshotJob(job):
+		var opts snapshotOptions
+		if opts, err = snapshotOptionsFromFlags(); err == nil {
+			_, err = takeSnapshot(jobCtx, run.manifest, opts)
+		}
+	default:
+		var result *pipelineResult
+		if result, err = run.processURL(jobCtx, job.URL); err == nil {
+			patchID = result.PatchID
+		}
+	}
+	cancel()
+	succeeded := err == nil
+
+	switch {
+	case err == nil:
+		err = run.manifest.FinishJob(job.ID, JobSucceeded, patchID, "")
+	case isClosed(canceled):
+		err = run.manifest.FinishJob(job.ID, JobCanceled, "", "canceled on request")
+	case ctx.Err() != nil:
+		err = run.manifest.RequeueJob(job.ID)
+	default:
+		err = run.manifest.FinishJob(job.ID, JobFailed, "", err.Error())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return succeeded
+}
+
+// isClosed reports whether ch has been closed
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
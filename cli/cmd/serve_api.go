@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ServeAPICmd runs the shared ingestion API
+var ServeAPICmd = &cobra.Command{
+	Use:   "api",
+	Short: "Run the ingestion API with token-based access control",
+	Long: `Run an HTTP API that lets a team share one ingestion service. Submitted
+URLs are queued as jobs in the manifest and processed by a background worker.
+
+Every /api request needs "Authorization: Bearer <token>". Tokens are listed
+in the tokens file (see 'vkm serve token') with one of three roles:
+
+  read    GET    /api/jobs              list jobs (?state=queued&limit=50)
+          GET    /api/jobs/<id>         show a job
+          GET    /api/dashboard         queue, usage and per-source stats
+  submit  POST   /api/jobs              queue URLs: {"urls": ["https://..."]}
+  admin   all of the above, plus
+          POST   /api/jobs/<id>/cancel  cancel a queued or running job
+          DELETE /api/jobs/<id>         remove a job that is not running
+
+A dashboard showing queue depth, running jobs, recent failures, API usage
+and per-source stats is served at /dashboard; paste a read token into it.
+
+GET /health is unauthenticated. Signed webhooks (see 'vkm serve webhooks')
+are mounted under /webhooks/ when their secrets are set.
+
+` + jobPhasesHelp + `
+
+` + motiveAlertsHelp + `
+
+Examples:
+  vkm serve api --addr :8080 --tokens data/api-tokens
+  vkm serve api --motive-webhook https://hooks.slack.com/services/...`,
+	RunE: runServeAPI,
+}
+
+var serveTokensPath string
+
+func init() {
+	ServeCmd.AddCommand(ServeAPICmd)
+
+	ServeAPICmd.Flags().StringVar(&serveAddr, "addr", ":8080", "Address to listen on")
+	ServeAPICmd.Flags().StringVar(&serveTokensPath, "tokens", "data/api-tokens", "Tokens file (\"<role> <token> [name]\" per line)")
+	ServeAPICmd.Flags().StringVarP(&pipelineOutputDir, "output", "o", "data/pipeline", "Working directory for pipeline files")
+	ServeAPICmd.Flags().StringVarP(&pipelineBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	ServeAPICmd.Flags().DurationVar(&pipelineWaitBackend, "wait-for-backend", 0, "Wait up to this long (e.g. 60s) for the backend to become healthy")
+	ServeAPICmd.Flags().StringVar(&pipelineManifest, "manifest", "data/manifest.db", "SQLite manifest holding the job queue")
+}
+
+func runServeAPI(cmd *cobra.Command, args []string) error {
+	tokens, err := loadAPITokens(serveTokensPath)
+	if err != nil {
+		return err
+	}
+
+	if err := checkPipelinePrerequisites(cmd.Context()); err != nil {
+		return err
+	}
+
+	run, err := newPipelineRun(pipelineOutputDir)
+	if err != nil {
+		return err
+	}
+	defer run.Close()
+
+	mux := http.NewServeMux()
+	api := &apiServer{manifest: run.manifest, tokens: tokens}
+	api.Register(mux)
+
+	if secrets := webhookSecretsFromEnv(); secrets != (webhookSecrets{}) {
+		newWebhookHandler(secrets, run.manifest).Register(mux)
+	}
+
+	return serveWithWorker(mux, run)
+}
+
+// apiServer implements the /api endpoints
+type apiServer struct {
+	manifest *Manifest
+	tokens   *apiTokenStore
+}
+
+// Register mounts the API endpoints on mux
+func (a *apiServer) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "service": "vkm-cli"})
+	})
+	mux.HandleFunc("/dashboard", serveDashboardPage)
+	mux.HandleFunc("/api/dashboard", a.tokens.require(RoleRead, a.dashboard))
+	mux.HandleFunc("/api/jobs", a.handleJobs)
+	mux.HandleFunc("/api/jobs/", a.handleJob)
+}
+
+func (a *apiServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.tokens.require(RoleRead, a.listJobs)(w, r)
+	case http.MethodPost:
+		a.tokens.require(RoleSubmit, a.submitJobs)(w, r)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (a *apiServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/cancel") {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		a.tokens.require(RoleAdmin, a.cancelJob)(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.tokens.require(RoleRead, a.getJob)(w, r)
+	case http.MethodDelete:
+		a.tokens.require(RoleAdmin, a.deleteJob)(w, r)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (a *apiServer) listJobs(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+
+	jobs, err := a.manifest.ListJobs(r.URL.Query().Get("state"), limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if jobs == nil {
+		jobs = []*Job{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": jobs, "count": len(jobs)})
+}
+
+func (a *apiServer) submitJobs(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URLs []string `json:"urls"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, webhookMaxBytes)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(req.URLs) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "no urls provided")
+		return
+	}
+	if err := checkSubmittedURLs(req.URLs); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	jobs := make([]*Job, 0, len(req.URLs))
+	for _, u := range req.URLs {
+		job, err := a.manifest.EnqueueJob(u, "api")
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		jobs = append(jobs, job)
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"jobs": jobs})
+}
+
+// jobIDFromPath parses the <id> in /api/jobs/<id> and /api/jobs/<id>/cancel
+func jobIDFromPath(path string) (int64, error) {
+	idStr := strings.Trim(strings.TrimPrefix(path, "/api/jobs/"), "/")
+	idStr = strings.TrimSuffix(idStr, "/cancel")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid job id %q", idStr)
+	}
+	return id, nil
+}
+
+func (a *apiServer) getJob(w http.ResponseWriter, r *http.Request) {
+	id, err := jobIDFromPath(r.URL.Path)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := a.manifest.GetJob(id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if job == nil {
+		writeJSONError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (a *apiServer) deleteJob(w http.ResponseWriter, r *http.Request) {
+	id, err := jobIDFromPath(r.URL.Path)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := a.manifest.DeleteJob(id); err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiServer) cancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := jobIDFromPath(r.URL.Path)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	state, err := a.manifest.RequestJobCancel(id)
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"id": id, "state": state})
+}
@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ServePublicCmd serves a read-only snapshot of the graph
+var ServePublicCmd = &cobra.Command{
+	Use:   "public",
+	Short: "Serve a read-only, anonymized graph snapshot",
+	Long: `Serve a snapshot of the graph read-only, with fact search and a timeline
+view, so research progress can be shared publicly without exposing the
+ingestion backend, the manifest or the job queue.
+
+The snapshot is a 'vkm export' JSON file, loaded once at startup. It is
+anonymized before serving: patch metadata is cut down to what describes
+the source (title, URL, kind, publish date, authors and citation for
+papers, license, topics, chapters), dropping sandbox runs, local paths,
+outlines, prompt versions and anything else recorded during ingestion.
+Curators' notes from 'vkm annotate' and the review history of 'vkm
+facts' are left out, as are facts it rejected or merged away, even when
+the snapshot includes them (--include-retired, 'vkm snapshot').
+
+Endpoints (all GET, no authentication):
+  /                  search and timeline page
+  /api/search        matching facts (?q=<query>&limit=50), with the query
+                     language of 'vkm export --help'
+  /api/timeline      facts and new sources per month (?q=<query>)
+  /api/stats         patch, fact, source and topic counts
+  /health            liveness check
+
+Examples:
+  vkm export --exclude-nonderivable -o graph.json
+  vkm serve public --snapshot graph.json --addr :8080`,
+	RunE: runServePublic,
+}
+
+var servePublicSnapshot string
+
+func init() {
+	ServeCmd.AddCommand(ServePublicCmd)
+
+	ServePublicCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "Address to listen on")
+	ServePublicCmd.Flags().StringVar(&servePublicSnapshot, "snapshot", "", "Graph snapshot written by 'vkm export' (json format)")
+	ServePublicCmd.MarkFlagRequired("snapshot")
+}
+
+//go:embed public.html
+var publicHTML []byte
+
+// publicMetadataKeys are the patch metadata keys that describe a source
+// and are kept in public snapshots; all others are dropped
+var publicMetadataKeys = map[string]bool{
+	"title":           true,
+	"channel":         true,
+	"source-url":      true,
+	"source-kind":     true,
+	"published-at":    true,
+	"sequence":        true,
+	"authors":         true,
+	"citation":        true,
+	"doi":             true,
+	"arxiv-id":        true,
+	"chapters":        true,
+	"thumbnail":       true,
+	"description":     true,
+	"supplementary":   true,
+	"trust":           true,
+	metaSourceLicense: true,
+	metaSourceStatus:  true,
+	metaTopics:        true,
+}
+
+// publicSearchLimit caps the facts one search returns
+const publicSearchLimit = 500
+
+func runServePublic(cmd *cobra.Command, args []string) error {
+	patches, err := loadSnapshot(servePublicSnapshot)
+	if err != nil {
+		return err
+	}
+	snap := newPublicSnapshot(patches)
+	fmt.Printf("Loaded %d facts from %d patches (%d sources)\n", snap.stats.Facts, snap.stats.Patches, snap.stats.Sources)
+
+	mux := http.NewServeMux()
+	snap.Register(mux)
+
+	server := &http.Server{
+		Addr:              serveAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("Listening on %s\n", serveAddr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	ctx := cmd.Context()
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	return nil
+}
+
+// loadSnapshot reads the patches of a 'vkm export' JSON file
+func loadSnapshot(path string) ([]*Patch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	var patches []*Patch
+	if err := json.Unmarshal(data, &patches); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s (expected 'vkm export' JSON): %w", path, err)
+	}
+	return patches, nil
+}
+
+// anonymizePatch returns a copy of p keeping only public metadata, and
+// no curators' notes or review history. Retired facts are dropped first,
+// by newPublicSnapshot.
+func anonymizePatch(p *Patch) *Patch {
+	public := *p
+	public.Metadata = nil
+	for k, v := range p.Metadata {
+		if !publicMetadataKeys[k] {
+			continue
+		}
+		// Local files (ingested PDFs) would reveal paths on the ingesting
+		// machine
+		if u, ok := v.(string); ok && k == "source-url" && strings.HasPrefix(u, "file:") {
+			continue
+		}
+		if public.Metadata == nil {
+			public.Metadata = make(map[string]interface{})
+		}
+		public.Metadata[k] = v
+	}
+
+	// Curators' notes and review history name their authors and are
+	// private to the curators
+	public.Annotations = nil
+	public.Facts = make([]Fact, len(p.Facts))
+	for i, f := range p.Facts {
+		f.Annotations, f.History = nil, nil
+		public.Facts[i] = f
+	}
+	return &public
+}
+
+// publicSnapshot serves an anonymized, read-only set of patches
+type publicSnapshot struct {
+	patches []*Patch
+	stats   publicStats
+}
+
+// publicStats summarizes a snapshot
+type publicStats struct {
+	Patches int            `json:"patches"`
+	Facts   int            `json:"facts"`
+	Edges   int            `json:"edges"`
+	Sources int            `json:"sources"`
+	Topics  map[string]int `json:"topics"`
+	From    string         `json:"from,omitempty"`
+	To      string         `json:"to,omitempty"`
+}
+
+// publicFact is a search result: a fact with its source
+type publicFact struct {
+	Fact
+	PatchID     string `json:"patch/id"`
+	SourceID    string `json:"patch/source-id,omitempty"`
+	SourceTitle string `json:"source/title,omitempty"`
+	SourceURL   string `json:"source/url,omitempty"`
+}
+
+// timelineMonth is one month of the timeline view
+type timelineMonth struct {
+	Month      string         `json:"month"`
+	Facts      int            `json:"facts"`
+	NewSources []string       `json:"new_sources"`
+	Topics     map[string]int `json:"topics"`
+}
+
+func newPublicSnapshot(patches []*Patch) *publicSnapshot {
+	s := &publicSnapshot{stats: publicStats{Topics: make(map[string]int)}}
+	sources := make(map[string]bool)
+	var from, to time.Time
+	for _, p := range withoutRetiredFacts(patches) {
+		p = anonymizePatch(p)
+		s.patches = append(s.patches, p)
+		s.stats.Facts += len(p.Facts)
+		s.stats.Edges += len(p.Edges)
+		sources[orDefault(p.SourceID, p.ID)] = true
+		for i := range p.Facts {
+			if t := p.Facts[i].Topic; t != "" {
+				s.stats.Topics[t]++
+			}
+			at := factTime(p, &p.Facts[i])
+			if from.IsZero() || at.Before(from) {
+				from = at
+			}
+			if at.After(to) {
+				to = at
+			}
+		}
+	}
+	s.stats.Patches = len(s.patches)
+	s.stats.Sources = len(sources)
+	if !from.IsZero() {
+		s.stats.From, s.stats.To = from.Format("2006-01-02"), to.Format("2006-01-02")
+	}
+	return s
+}
+
+// factTime places a fact on the timeline: its valid-from date, or its
+// patch's timestamp when it has none
+func factTime(p *Patch, f *Fact) time.Time {
+	if !f.ValidFrom.IsZero() {
+		return f.ValidFrom.UTC()
+	}
+	return p.Timestamp.UTC()
+}
+
+// Register mounts the public endpoints on mux
+func (s *publicSnapshot) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/health", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "service": "vkm-public"})
+	}))
+	mux.HandleFunc("/api/search", s.readOnly(s.search))
+	mux.HandleFunc("/api/timeline", s.readOnly(s.timeline))
+	mux.HandleFunc("/api/stats", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.stats)
+	}))
+	mux.HandleFunc("/", s.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(publicHTML)
+	}))
+}
+
+// readOnly rejects everything but GET and HEAD
+func (s *publicSnapshot) readOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSONError(w, http.StatusMethodNotAllowed, "this server is read-only")
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		next(w, r)
+	}
+}
+
+// query selects the patches and facts matching the request's q parameter
+func (s *publicSnapshot) query(w http.ResponseWriter, r *http.Request) ([]*Patch, bool) {
+	q, err := parseFactQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return q.Select(s.patches), true
+}
+
+func (s *publicSnapshot) search(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = min(v, publicSearchLimit)
+	}
+	selected, ok := s.query(w, r)
+	if !ok {
+		return
+	}
+
+	facts := []publicFact{}
+	total := 0
+	for _, p := range selected {
+		title, _ := p.Metadata["title"].(string)
+		url, _ := p.Metadata["source-url"].(string)
+		for _, f := range p.Facts {
+			total++
+			facts = append(facts, publicFact{Fact: f, PatchID: p.ID, SourceID: p.SourceID, SourceTitle: title, SourceURL: url})
+		}
+	}
+	// Most confident first, then newest
+	sort.SliceStable(facts, func(i, j int) bool {
+		if facts[i].Confidence != facts[j].Confidence {
+			return facts[i].Confidence > facts[j].Confidence
+		}
+		return facts[i].ValidFrom.After(facts[j].ValidFrom)
+	})
+	if len(facts) > limit {
+		facts = facts[:limit]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"facts": facts, "count": len(facts), "total": total})
+}
+
+func (s *publicSnapshot) timeline(w http.ResponseWriter, r *http.Request) {
+	selected, ok := s.query(w, r)
+	if !ok {
+		return
+	}
+
+	months := make(map[string]*timelineMonth)
+	firstSeen := make(map[string]string)
+	for _, p := range selected {
+		source := orDefault(p.SourceID, p.ID)
+		for i := range p.Facts {
+			month := factTime(p, &p.Facts[i]).Format("2006-01")
+			m := months[month]
+			if m == nil {
+				m = &timelineMonth{Month: month, NewSources: []string{}, Topics: make(map[string]int)}
+				months[month] = m
+			}
+			m.Facts++
+			if t := p.Facts[i].Topic; t != "" {
+				m.Topics[t]++
+			}
+			if first, ok := firstSeen[source]; !ok || month < first {
+				firstSeen[source] = month
+			}
+		}
+	}
+	for source, month := range firstSeen {
+		months[month].NewSources = append(months[month].NewSources, source)
+	}
+
+	timeline := make([]*timelineMonth, 0, len(months))
+	for _, m := range months {
+		sort.Strings(m.NewSources)
+		timeline = append(timeline, m)
+	}
+	sort.Slice(timeline, func(i, j int) bool { return timeline[i].Month < timeline[j].Month })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"months": timeline})
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// siteHelp documents which sites the download commands take
+const siteHelp = `Sites:
+  Besides YouTube, any site yt-dlp has an extractor for can be downloaded
+  from: SoundCloud tracks and sets, Vimeo videos and showcases, Bandcamp,
+  Mixcloud, Twitch VODs and clips, TED talks, archive.org and hundreds more. URLs are
+  checked before anything is downloaded; links to sites vkm doesn't list
+  are handed to yt-dlp to find an extractor, falling back to its generic
+  one. The built-in YouTube client (--downloader native) only takes
+  YouTube URLs.
+  Templates can differ per site with --site-name-template, keyed by the
+  site's name as in the download archive (youtube, soundcloud, vimeo,
+  ...); .Site holds it in any template.
+  --site-name-template soundcloud='{{.ChannelSlug}}/{{.TitleSlug}}'`
+
+// siteYouTube is the site name of YouTube, the only site the built-in
+// client downloads from
+const siteYouTube = "youtube"
+
+// siteGeneric names sites vkm doesn't list, as yt-dlp's generic extractor
+// does
+const siteGeneric = "generic"
+
+// mediaSite is a site yt-dlp downloads from. Name is yt-dlp's extractor
+// key for the site's single items, lowercased as in its download archive.
+type mediaSite struct {
+	Name  string
+	Hosts []string
+}
+
+// mediaSites are the sites vkm recognizes by host
+var mediaSites = []mediaSite{
+	{Name: siteYouTube, Hosts: []string{"youtube.com", "youtu.be", "youtube-nocookie.com"}},
+	{Name: "soundcloud", Hosts: []string{"soundcloud.com"}},
+	{Name: "vimeo", Hosts: []string{"vimeo.com"}},
+	{Name: "bandcamp", Hosts: []string{"bandcamp.com"}},
+	{Name: "mixcloud", Hosts: []string{"mixcloud.com"}},
+	{Name: "twitchclips", Hosts: []string{"clips.twitch.tv"}},
+	{Name: "twitchvod", Hosts: []string{"twitch.tv"}},
+	{Name: "dailymotion", Hosts: []string{"dailymotion.com", "dai.ly"}},
+	{Name: "tedtalk", Hosts: []string{"ted.com"}},
+	{Name: "archiveorg", Hosts: []string{"archive.org"}},
+	{Name: "applepodcasts", Hosts: []string{"podcasts.apple.com"}},
+	{Name: "rumble", Hosts: []string{"rumble.com"}},
+}
+
+// siteNameTemplates is the --site-name-template of the download commands:
+// name templates by site, used instead of --name-template
+var siteNameTemplates map[string]string
+
+// siteForURL returns the name of the site rawURL is on, siteGeneric for
+// hosts vkm doesn't list, or "" if rawURL isn't an http(s) URL
+func siteForURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if (host == "twitch.tv" || strings.HasSuffix(host, ".twitch.tv")) && strings.Contains(u.Path, "/clip/") {
+		return "twitchclips"
+	}
+	for _, site := range mediaSites {
+		for _, h := range site.Hosts {
+			if host == h || strings.HasSuffix(host, "."+h) {
+				return site.Name
+			}
+		}
+	}
+	return siteGeneric
+}
+
+// sitePlaylistPaths are path segments marking collections (sets, albums,
+// showcases) on sites other than YouTube
+var sitePlaylistPaths = map[string][]string{
+	"soundcloud": {"sets"},
+	"vimeo":      {"showcase", "album"},
+	"bandcamp":   {"album"},
+	"mixcloud":   {"playlists"},
+}
+
+// isSitePlaylist reports whether path on site names a collection rather
+// than a single item
+func isSitePlaylist(site, path string) bool {
+	if site == "twitchvod" {
+		// twitch.tv/<channel>/videos lists VODs; twitch.tv/videos/<id> is one
+		parts := strings.Split(strings.Trim(path, "/"), "/")
+		return len(parts) == 2 && parts[1] == "videos"
+	}
+	for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		for _, marker := range sitePlaylistPaths[site] {
+			if seg == marker {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkSubmittedURLs rejects URLs submitted to a serve mode that aren't
+// http or https URLs, before they are queued. Queued URLs end up on
+// yt-dlp's command line, so anything else could pass it options.
+func checkSubmittedURLs(urls []string) error {
+	for _, raw := range urls {
+		if siteForURL(raw) == "" {
+			return fmt.Errorf("%q is not an http or https URL", raw)
+		}
+	}
+	return nil
+}
+
+// checkMediaURLs rejects URLs the downloader can't fetch: anything but
+// http(s) links, and sites other than YouTube for the built-in client.
+// Hosts vkm doesn't list are reported once each, as yt-dlp decides.
+func checkMediaURLs(urls []string, d videoDownloader) error {
+	var invalid []string
+	unknown := make(map[string]bool)
+	for _, raw := range urls {
+		site := siteForURL(raw)
+		switch {
+		case site == "":
+			invalid = append(invalid, fmt.Sprintf("%q is not an http or https URL", raw))
+		case site != siteYouTube && !d.Features().OtherSites:
+			invalid = append(invalid, fmt.Sprintf("%s is not on YouTube, the only site the %s downloads from (install yt-dlp for other sites)", raw, d.Name()))
+		case site == siteGeneric:
+			u, _ := url.Parse(raw)
+			unknown[u.Hostname()] = true
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("can't download %d URL(s):\n  %s", len(invalid), strings.Join(invalid, "\n  "))
+	}
+
+	hosts := make([]string, 0, len(unknown))
+	for h := range unknown {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	for _, h := range hosts {
+		fmt.Fprintf(os.Stderr, "Warning: %s is not a site vkm lists; yt-dlp will look for an extractor (or use its generic one)\n", h)
+	}
+	return nil
+}
+
+// siteFromInfo returns the site a yt-dlp .info.json was downloaded from:
+// the listed site of its page, else its extractor
+func siteFromInfo(info map[string]interface{}) string {
+	page, _ := info["webpage_url"].(string)
+	if site := siteForURL(page); site != "" && site != siteGeneric {
+		return site
+	}
+	if key, _ := info["extractor_key"].(string); key != "" {
+		return strings.ToLower(key)
+	}
+	if name, _ := info["extractor"].(string); name != "" {
+		return strings.ToLower(name)
+	}
+	return siteForURL(page)
+}
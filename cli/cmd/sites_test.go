@@ -0,0 +1,90 @@
+package cmd
+
+import "testing"
+
+func TestSiteForURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", siteYouTube},
+		{"https://youtu.be/dQw4w9WgXcQ", siteYouTube},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ", siteYouTube},
+		{"  https://www.youtube.com/watch?v=dQw4w9WgXcQ\n", siteYouTube},
+		{"https://soundcloud.com/artist/track", "soundcloud"},
+		{"https://soundcloud.com/artist/sets/album", "soundcloud"},
+		{"https://vimeo.com/123456", "vimeo"},
+		{"https://player.vimeo.com/video/123456", "vimeo"},
+		{"https://artist.bandcamp.com/album/record", "bandcamp"},
+		{"https://www.mixcloud.com/host/show/", "mixcloud"},
+		{"https://www.twitch.tv/videos/123456", "twitchvod"},
+		{"https://www.twitch.tv/streamer/clip/SomeClip", "twitchclips"},
+		{"https://clips.twitch.tv/SomeClip", "twitchclips"},
+		{"https://dai.ly/x8abc", "dailymotion"},
+		{"https://www.ted.com/talks/some_talk", "tedtalk"},
+		{"https://archive.org/details/item", "archiveorg"},
+		{"https://podcasts.apple.com/us/podcast/show/id123", "applepodcasts"},
+		{"https://rumble.com/v123-video.html", "rumble"},
+		{"http://example.com/video.mp4", siteGeneric},
+		{"https://notyoutube.com/watch?v=dQw4w9WgXcQ", siteGeneric},
+
+		{"", ""},
+		{"--exec=id", ""},
+		{"-o/tmp/x", ""},
+		{"ftp://example.com/video.mp4", ""},
+		{"file:///etc/passwd", ""},
+		{"javascript:alert(1)", ""},
+		{"youtube.com/watch?v=dQw4w9WgXcQ", ""},
+		{"https://", ""},
+		{"https://[::1", ""},
+	}
+	for _, tt := range tests {
+		if got := siteForURL(tt.url); got != tt.want {
+			t.Errorf("siteForURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestCheckMediaURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		urls    []string
+		d       videoDownloader
+		wantErr bool
+	}{
+		{"youtube with yt-dlp", []string{"https://www.youtube.com/watch?v=dQw4w9WgXcQ"}, ytDlpDownloader{}, false},
+		{"other sites with yt-dlp", []string{"https://soundcloud.com/artist/track", "https://vimeo.com/123456"}, ytDlpDownloader{}, false},
+		{"unlisted host with yt-dlp", []string{"https://example.com/video"}, ytDlpDownloader{}, false},
+		{"youtube with native", []string{"https://youtu.be/dQw4w9WgXcQ"}, nativeDownloader{}, false},
+		{"other site with native", []string{"https://vimeo.com/123456"}, nativeDownloader{}, true},
+		{"option with yt-dlp", []string{"--exec=id"}, ytDlpDownloader{}, true},
+		{"option after a valid URL", []string{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "--exec=touch /tmp/x"}, ytDlpDownloader{}, true},
+		{"non-http scheme", []string{"file:///etc/passwd"}, ytDlpDownloader{}, true},
+	}
+	for _, tt := range tests {
+		err := checkMediaURLs(tt.urls, tt.d)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkMediaURLs(%q) error = %v, want error %v", tt.name, tt.urls, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckSubmittedURLs(t *testing.T) {
+	tests := []struct {
+		urls    []string
+		wantErr bool
+	}{
+		{[]string{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "https://soundcloud.com/artist/track"}, false},
+		{[]string{"https://example.com/video"}, false},
+		{nil, false},
+		{[]string{"--exec=id"}, true},
+		{[]string{"https://vimeo.com/123456", "--batch-file=/etc/passwd"}, true},
+		{[]string{"ftp://example.com/video.mp4"}, true},
+	}
+	for _, tt := range tests {
+		err := checkSubmittedURLs(tt.urls)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkSubmittedURLs(%q) error = %v, want error %v", tt.urls, err, tt.wantErr)
+		}
+	}
+}
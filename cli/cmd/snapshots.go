@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// SnapshotCmd exports the whole local graph as a point-in-time backup
+var SnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Back up the local graph as a dated snapshot, pruning old ones",
+	Long: `Export every patch under --data as a snapshot in <output>/<date>/, record
+it in the manifest, and remove the snapshots the retention policy no
+longer keeps. 'vkm serve' modes take one daily with --snapshot-at HH:MM,
+as a job in their queue, with the options below as --snapshot-<option>.
+
+` + snapshotHelp + `
+
+Examples:
+  vkm snapshot
+  vkm snapshot --formats edn --keep 30 --keep-monthly 0
+  vkm snapshot list`,
+	Args: cobra.NoArgs,
+	RunE: runSnapshot,
+}
+
+// SnapshotListCmd lists the snapshots recorded in the manifest
+var SnapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the graph snapshots recorded in the manifest",
+	Args:  cobra.NoArgs,
+	RunE:  runSnapshotList,
+}
+
+const snapshotHelp = `Snapshots:
+  A snapshot holds every patch as it is at the time, retired facts,
+  review history and notes included, in each of --formats:
+    graph.json  'vkm export' JSON, which 'vkm serve public' also serves
+    graph.edn   EDN in the shape of the core's patch schema
+    graph.db    a standalone SQLite database, as 'vkm export --format
+                sqlite' writes it
+  It is written beside the snapshot directory and renamed into place, so
+  an interrupted snapshot leaves no partial one; a second snapshot on the
+  same day replaces the first.
+
+  Retention keeps the --keep newest snapshots, plus the newest of each of
+  the last --keep-monthly months; the rest are deleted (and marked
+  removed in the manifest). --keep 0 keeps every snapshot. Only
+  snapshots recorded in the manifest are ever deleted.`
+
+// snapshotFormats are the files a snapshot can hold, by format
+var snapshotFormats = map[string]string{"json": "graph.json", "edn": "graph.edn", "sqlite": "graph.db"}
+
+// Scheduled snapshots run as a job in the serve queue, like nightly
+// enrichment
+const (
+	snapshotJobURL    = "vkm:snapshot"
+	snapshotJobOrigin = "scheduled"
+)
+
+var (
+	snapshotDataDir     string
+	snapshotDir         string
+	snapshotFormatList  string
+	snapshotKeep        int
+	snapshotKeepMonthly int
+	snapshotManifest    string
+	snapshotListAll     bool
+
+	// serveSnapshotAt is the local time of day serve modes queue a
+	// snapshot
+	serveSnapshotAt string
+)
+
+func init() {
+	SnapshotCmd.AddCommand(SnapshotListCmd)
+
+	SnapshotCmd.Flags().StringVar(&snapshotDataDir, "data", "data", "Directory holding local patches")
+	SnapshotCmd.Flags().StringVarP(&snapshotDir, "output", "o", "snapshots", "Directory to write dated snapshots to")
+	SnapshotCmd.Flags().StringVar(&snapshotFormatList, "formats", "json,edn,sqlite", "Comma-separated formats to write (json, edn, sqlite)")
+	SnapshotCmd.Flags().IntVar(&snapshotKeep, "keep", 7, "Newest snapshots to keep (0 keeps all)")
+	SnapshotCmd.Flags().IntVar(&snapshotKeepMonthly, "keep-monthly", 12, "Also keep the newest snapshot of each of this many recent months")
+	SnapshotCmd.Flags().StringVar(&snapshotManifest, "manifest", "data/manifest.db", "SQLite manifest recording snapshots")
+
+	SnapshotListCmd.Flags().StringVar(&snapshotManifest, "manifest", "data/manifest.db", "SQLite manifest recording snapshots")
+	SnapshotListCmd.Flags().BoolVar(&snapshotListAll, "all", false, "Include snapshots removed by retention")
+
+	for _, cmd := range []*cobra.Command{ServeAPICmd, ServeWebhooksCmd} {
+		cmd.Flags().StringVar(&serveSnapshotAt, "snapshot-at", "", "Queue 'vkm snapshot' daily at this local time (HH:MM)")
+		cmd.Flags().StringVar(&snapshotDataDir, "snapshot-data", "data", "Directory holding the local patches to snapshot")
+		cmd.Flags().StringVar(&snapshotDir, "snapshot-dir", "snapshots", "Directory to write dated snapshots to")
+		cmd.Flags().StringVar(&snapshotFormatList, "snapshot-formats", "json,edn,sqlite", "Comma-separated snapshot formats (json, edn, sqlite)")
+		cmd.Flags().IntVar(&snapshotKeep, "snapshot-keep", 7, "Newest snapshots to keep (0 keeps all)")
+		cmd.Flags().IntVar(&snapshotKeepMonthly, "snapshot-keep-monthly", 12, "Also keep the newest snapshot of each of this many recent months")
+	}
+}
+
+// isSnapshotJob reports whether job is a scheduled snapshot rather than
+// a URL to process. Only the scheduler can queue one.
+func isSnapshotJob(job *Job) bool {
+	return job.URL == snapshotJobURL && job.Origin == snapshotJobOrigin
+}
+
+// Snapshot is a graph snapshot recorded in the manifest
+type Snapshot struct {
+	ID        int64
+	TakenAt   time.Time
+	Dir       string
+	Formats   []string
+	Patches   int
+	Facts     int
+	Edges     int
+	Bytes     int64
+	RemovedAt *time.Time
+}
+
+// snapshotOptions configure takeSnapshot
+type snapshotOptions struct {
+	DataDir     string
+	Dir         string
+	Formats     []string
+	Keep        int
+	KeepMonthly int
+}
+
+// snapshotOptionsFromFlags collects the snapshot flags, checking
+// --formats
+func snapshotOptionsFromFlags() (snapshotOptions, error) {
+	opts := snapshotOptions{DataDir: snapshotDataDir, Dir: snapshotDir, Keep: snapshotKeep, KeepMonthly: snapshotKeepMonthly}
+	for _, format := range strings.Split(snapshotFormatList, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format == "" {
+			continue
+		}
+		if snapshotFormats[format] == "" {
+			return opts, fmt.Errorf("unknown snapshot format %q (use json, edn or sqlite)", format)
+		}
+		opts.Formats = appendUnique(opts.Formats, format)
+	}
+	if len(opts.Formats) == 0 {
+		return opts, fmt.Errorf("no snapshot formats given")
+	}
+	if opts.Keep < 0 || opts.KeepMonthly < 0 {
+		return opts, fmt.Errorf("snapshot retention counts can't be negative")
+	}
+	return opts, nil
+}
+
+func runSnapshot(cmd *cobra.Command, args []string) error {
+	opts, err := snapshotOptionsFromFlags()
+	if err != nil {
+		return err
+	}
+	manifest, err := openManifest(snapshotManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	_, err = takeSnapshot(cmd.Context(), manifest, opts)
+	return err
+}
+
+// takeSnapshot writes every local patch to a dated snapshot directory,
+// records it in m and applies the retention policy
+func takeSnapshot(ctx context.Context, m *Manifest, opts snapshotOptions) (*Snapshot, error) {
+	patches, err := loadLocalPatches(opts.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no patches found under %s", opts.DataDir)
+	}
+
+	now := time.Now()
+	snap := &Snapshot{TakenAt: now.UTC(), Dir: filepath.Join(opts.Dir, now.Format("2006-01-02")), Formats: opts.Formats, Patches: len(patches)}
+	for _, p := range patches {
+		snap.Facts += len(p.Facts)
+		snap.Edges += len(p.Edges)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	tmp, err := os.MkdirTemp(opts.Dir, "."+filepath.Base(snap.Dir)+"-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	for _, format := range opts.Formats {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		path := filepath.Join(tmp, snapshotFormats[format])
+		if err := writeSnapshotFile(path, format, patches, m); err != nil {
+			return nil, fmt.Errorf("failed to write %s snapshot: %w", format, err)
+		}
+		if fi, err := os.Stat(path); err == nil {
+			snap.Bytes += fi.Size()
+		}
+	}
+
+	if err := os.RemoveAll(snap.Dir); err != nil {
+		return nil, fmt.Errorf("failed to replace %s: %w", snap.Dir, err)
+	}
+	if err := os.Rename(tmp, snap.Dir); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := m.RecordSnapshot(snap); err != nil {
+		return nil, err
+	}
+	fmt.Printf("✓ Snapshot of %d facts from %d patches written to %s (%s, %s)\n",
+		snap.Facts, snap.Patches, snap.Dir, strings.Join(snap.Formats, ", "), formatBytes(snap.Bytes))
+
+	removed, err := pruneSnapshots(m, opts.Keep, opts.KeepMonthly)
+	if err != nil {
+		return snap, err
+	}
+	for _, s := range removed {
+		fmt.Printf("  Removed snapshot %s\n", s.Dir)
+	}
+	return snap, nil
+}
+
+// writeSnapshotFile writes patches to path in format
+func writeSnapshotFile(path, format string, patches []*Patch, m *Manifest) error {
+	if format == "sqlite" {
+		return writeSQLiteExport(path, patches, m)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if format == "edn" {
+		err = writePatchesEDN(f, patches)
+	} else {
+		err = writePatchesJSON(f, patches)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// pruneSnapshots deletes the snapshots retention doesn't keep: all but
+// the keep newest and the newest of each of the last keepMonthly months.
+// A keep of 0 keeps everything. It returns the snapshots removed.
+func pruneSnapshots(m *Manifest, keep, keepMonthly int) ([]Snapshot, error) {
+	if keep == 0 {
+		return nil, nil
+	}
+	snaps, err := m.Snapshots(false)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make(map[int64]bool)
+	months := make(map[string]bool)
+	for i, s := range snaps {
+		if i < keep {
+			kept[s.ID] = true
+		}
+		month := s.TakenAt.Local().Format("2006-01")
+		if !months[month] && len(months) < keepMonthly {
+			months[month] = true
+			kept[s.ID] = true
+		}
+	}
+
+	var removed []Snapshot
+	for _, s := range snaps {
+		if kept[s.ID] {
+			continue
+		}
+		if err := os.RemoveAll(s.Dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove snapshot %s: %v\n", s.Dir, err)
+			continue
+		}
+		if err := m.MarkSnapshotRemoved(s.ID); err != nil {
+			return removed, err
+		}
+		removed = append(removed, s)
+	}
+	return removed, nil
+}
+
+func runSnapshotList(cmd *cobra.Command, args []string) error {
+	manifest, err := openManifest(snapshotManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	snaps, err := manifest.Snapshots(snapshotListAll)
+	if err != nil {
+		return err
+	}
+	if len(snaps) == 0 {
+		fmt.Println("No snapshots recorded")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAKEN\tDIRECTORY\tFORMATS\tPATCHES\tFACTS\tSIZE\tSTATUS")
+	for _, s := range snaps {
+		status := "kept"
+		if s.RemovedAt != nil {
+			status = "removed " + s.RemovedAt.Local().Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			s.TakenAt.Local().Format("2006-01-02 15:04"), s.Dir, strings.Join(s.Formats, ","),
+			s.Patches, s.Facts, formatBytes(s.Bytes), status)
+	}
+	return w.Flush()
+}
+
+// RecordSnapshot stores a snapshot taken, marking any earlier one in the
+// same directory (which it replaced) as removed
+func (m *Manifest) RecordSnapshot(s *Snapshot) error {
+	return m.write(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("UPDATE snapshots SET removed_at = ? WHERE dir = ? AND removed_at IS NULL", s.TakenAt, s.Dir); err != nil {
+			return fmt.Errorf("failed to record snapshot: %w", err)
+		}
+		res, err := tx.Exec(`
+			INSERT INTO snapshots (taken_at, dir, formats, patches, facts, edges, bytes)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			s.TakenAt, s.Dir, strings.Join(s.Formats, ","), s.Patches, s.Facts, s.Edges, s.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to record snapshot: %w", err)
+		}
+		s.ID, err = res.LastInsertId()
+		return err
+	})
+}
+
+// MarkSnapshotRemoved records that a snapshot's directory was deleted
+func (m *Manifest) MarkSnapshotRemoved(id int64) error {
+	return m.write(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("UPDATE snapshots SET removed_at = ? WHERE id = ?", time.Now().UTC(), id); err != nil {
+			return fmt.Errorf("failed to record snapshot removal: %w", err)
+		}
+		return nil
+	})
+}
+
+// Snapshots returns the recorded snapshots, newest first: those on disk,
+// or with all also those removed
+func (m *Manifest) Snapshots(all bool) ([]Snapshot, error) {
+	query := "SELECT id, taken_at, dir, formats, patches, facts, edges, bytes, removed_at FROM snapshots"
+	if !all {
+		query += " WHERE removed_at IS NULL"
+	}
+	rows, err := m.db.Query(query + " ORDER BY taken_at DESC, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snaps []Snapshot
+	for rows.Next() {
+		var s Snapshot
+		var formats string
+		var removed sql.NullTime
+		if err := rows.Scan(&s.ID, &s.TakenAt, &s.Dir, &formats, &s.Patches, &s.Facts, &s.Edges, &s.Bytes, &removed); err != nil {
+			return nil, fmt.Errorf("failed to read snapshots: %w", err)
+		}
+		s.Formats = strings.Split(formats, ",")
+		if removed.Valid {
+			s.RemovedAt = &removed.Time
+		}
+		snaps = append(snaps, s)
+	}
+	return snaps, rows.Err()
+}
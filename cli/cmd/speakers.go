@@ -0,0 +1,529 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// SpeakersCmd manages the registry of speakers recognized by voice
+var SpeakersCmd = &cobra.Command{
+	Use:   "speakers",
+	Short: "Recognize speakers across a channel's videos by their voices",
+	Long: `Keep a registry of the people speaking in a channel's videos, so facts
+can be attributed to the same person ("the host", "guest X") in every
+video they appear in, rather than to a diarizer's per-video SPEAKER_00.
+
+Speakers are recognized by voice embeddings. 'vkm speakers import' reads
+the voices a diarizer found in a video, one embedding per speaker label,
+and matches each against the speakers already registered for the
+video's channel by cosine similarity; voices like none of them (below
+--threshold) register a new, unnamed speaker. Name speakers with
+'vkm speakers label', and merge two profiles that turn out to be the
+same person with 'vkm speakers merge'.
+
+Voice files are JSON:
+
+  {
+    "video_id": "dQw4w9WgXcQ",
+    "channel": "Example Podcast",
+    "model": "pyannote/wespeaker-voxceleb-resnet34-LM",
+    "speakers": [
+      {"label": "SPEAKER_00", "embedding": [0.12, -0.03, ...], "seconds": 2710.5}
+    ]
+  }
+
+"seconds" (how long the speaker talks) is optional. The channel defaults
+to the manifest's catalog entry for the video. Voices are only compared
+with voices embedded by the same model.
+
+Examples:
+  vkm speakers import data/voices/*.json
+  vkm speakers list --channel "Example Podcast"
+  vkm speakers label 3 --name "Jane Doe" --role host
+  vkm speakers merge 7 3`,
+}
+
+// SpeakersImportCmd matches a video's voices to registered speakers
+var SpeakersImportCmd = &cobra.Command{
+	Use:   "import <voices.json>...",
+	Short: "Match the voices diarized in videos to registered speakers",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runSpeakersImport,
+}
+
+// SpeakersListCmd lists registered speakers
+var SpeakersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List registered speakers with the videos they speak in",
+	Args:  cobra.NoArgs,
+	RunE:  runSpeakersList,
+}
+
+// SpeakersLabelCmd names a speaker
+var SpeakersLabelCmd = &cobra.Command{
+	Use:   "label <speaker-id>",
+	Short: "Name a speaker and give their role",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSpeakersLabel,
+}
+
+// SpeakersMergeCmd merges two profiles of one person
+var SpeakersMergeCmd = &cobra.Command{
+	Use:   "merge <speaker-id> <into-speaker-id>",
+	Short: "Merge a speaker profile into another of the same person",
+	Long: `Move every voice of the first speaker to the second, which keeps its
+name and role (or takes the first's, if it has none). The first ID keeps
+resolving to the merged speaker.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runSpeakersMerge,
+}
+
+var (
+	speakersManifest  string
+	speakersThreshold float64
+	speakersChannel   string
+	speakersName      string
+	speakersRole      string
+)
+
+func init() {
+	SpeakersCmd.AddCommand(SpeakersImportCmd)
+	SpeakersCmd.AddCommand(SpeakersListCmd)
+	SpeakersCmd.AddCommand(SpeakersLabelCmd)
+	SpeakersCmd.AddCommand(SpeakersMergeCmd)
+
+	SpeakersCmd.PersistentFlags().StringVar(&speakersManifest, "manifest", "data/manifest.db", "SQLite manifest holding the speaker registry")
+	SpeakersImportCmd.Flags().Float64Var(&speakersThreshold, "threshold", 0.7, "Cosine similarity a voice needs to match a registered speaker")
+	SpeakersImportCmd.Flags().StringVar(&speakersChannel, "channel", "", "Channel of the videos (default: from the voice file, else the catalog)")
+	SpeakersListCmd.Flags().StringVar(&speakersChannel, "channel", "", "Only list speakers of this channel")
+	SpeakersLabelCmd.Flags().StringVar(&speakersName, "name", "", "Name of the speaker")
+	SpeakersLabelCmd.Flags().StringVar(&speakersRole, "role", "", "Role of the speaker in the channel's videos (e.g. host, guest, narrator)")
+}
+
+// speakerVoicesFile is the format 'vkm speakers import' reads
+type speakerVoicesFile struct {
+	VideoID  string `json:"video_id"`
+	Channel  string `json:"channel"`
+	Model    string `json:"model"`
+	Speakers []struct {
+		Label     string    `json:"label"`
+		Embedding []float64 `json:"embedding"`
+		Seconds   float64   `json:"seconds"`
+	} `json:"speakers"`
+}
+
+// speakerProfile is a person recognized across a channel's videos
+type speakerProfile struct {
+	ID      int64
+	Channel string
+	Name    string
+	Role    string
+	Videos  int
+	Seconds float64
+}
+
+// displayName is how attributed facts name the speaker: "Jane Doe
+// (host)", or "Speaker 3" until labeled
+func (p *speakerProfile) displayName() string {
+	name := orDefault(p.Name, fmt.Sprintf("Speaker %d", p.ID))
+	if p.Role != "" {
+		name += " (" + p.Role + ")"
+	}
+	return name
+}
+
+// decodeVector unpacks a vector packed by encodeVector
+func decodeVector(packed []byte) []float64 {
+	v := make([]float64, len(packed)/4)
+	for i := range v {
+		v[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(packed[4*i:])))
+	}
+	return v
+}
+
+// speakerCentroids returns the mean of the normalized voices of each
+// active speaker of channel embedded by model, by speaker ID
+func (m *Manifest) speakerCentroids(channel, model string) (map[int64][]float64, error) {
+	rows, err := m.db.Query(`
+		SELECT v.speaker_id, v.vector FROM speaker_voices v JOIN speakers s ON s.id = v.speaker_id
+		WHERE s.channel = ? AND s.merged_into IS NULL AND v.model = ?`, channel, model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read speaker voices: %w", err)
+	}
+	defer rows.Close()
+
+	sums := make(map[int64][]float64)
+	for rows.Next() {
+		var id int64
+		var packed []byte
+		if err := rows.Scan(&id, &packed); err != nil {
+			return nil, fmt.Errorf("failed to read speaker voices: %w", err)
+		}
+		v := decodeVector(normalizeVector(packed))
+		if sums[id] == nil {
+			sums[id] = make([]float64, len(v))
+		}
+		if len(v) != len(sums[id]) {
+			continue
+		}
+		for i, x := range v {
+			sums[id][i] += x
+		}
+	}
+	return sums, rows.Err()
+}
+
+// voiceMatch pairs a voice of a video with a registered speaker
+type voiceMatch struct {
+	voice      int
+	speaker    int64
+	similarity float64
+}
+
+// ImportSpeakerVoices registers the voices of one video, matching each to
+// the most similar speaker of the channel at or above threshold, or to a
+// new speaker. No two voices of a video match the same speaker. Returns
+// the speaker of each voice, in the file's order, and which are new.
+func (m *Manifest) ImportSpeakerVoices(f *speakerVoicesFile, threshold float64) ([]int64, []bool, error) {
+	centroids, err := m.speakerCentroids(f.Channel, f.Model)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Greedily take the most similar pairs first
+	var pairs []voiceMatch
+	for i, s := range f.Speakers {
+		for id, c := range centroids {
+			if len(c) != len(s.Embedding) {
+				continue
+			}
+			if sim := cosineSimilarity(s.Embedding, c); sim >= threshold {
+				pairs = append(pairs, voiceMatch{voice: i, speaker: id, similarity: sim})
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].similarity > pairs[j].similarity })
+	ids := make([]int64, len(f.Speakers))
+	taken := make(map[int64]bool)
+	for _, p := range pairs {
+		if ids[p.voice] != 0 || taken[p.speaker] {
+			continue
+		}
+		ids[p.voice] = p.speaker
+		taken[p.speaker] = true
+	}
+
+	created := make([]bool, len(f.Speakers))
+	now := time.Now().UTC()
+	err = m.write(func(tx *sql.Tx) error {
+		for i, s := range f.Speakers {
+			if ids[i] == 0 {
+				res, err := tx.Exec("INSERT INTO speakers (channel, created_at) VALUES (?, ?)", f.Channel, now)
+				if err != nil {
+					return fmt.Errorf("failed to register speaker: %w", err)
+				}
+				if ids[i], err = res.LastInsertId(); err != nil {
+					return fmt.Errorf("failed to register speaker: %w", err)
+				}
+				created[i] = true
+			}
+			_, err := tx.Exec(`
+				INSERT INTO speaker_voices (video_id, label, speaker_id, model, dims, vector, seconds, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT(video_id, label) DO UPDATE SET
+					speaker_id = excluded.speaker_id,
+					model      = excluded.model,
+					dims       = excluded.dims,
+					vector     = excluded.vector,
+					seconds    = excluded.seconds,
+					created_at = excluded.created_at`,
+				f.VideoID, s.Label, ids[i], f.Model, len(s.Embedding), encodeVector(s.Embedding), s.Seconds, now)
+			if err != nil {
+				return fmt.Errorf("failed to record voice: %w", err)
+			}
+		}
+		return nil
+	})
+	return ids, created, err
+}
+
+// SpeakerForVoice returns the speaker a video's diarized label was
+// matched to, following merges, or nil if the voice was never imported
+func (m *Manifest) SpeakerForVoice(videoID, label string) (*speakerProfile, error) {
+	var id int64
+	err := m.db.QueryRow("SELECT speaker_id FROM speaker_voices WHERE video_id = ? AND label = ?", videoID, label).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read speaker voices: %w", err)
+	}
+	return m.Speaker(id)
+}
+
+// Speaker returns the speaker with id, following merges, or nil
+func (m *Manifest) Speaker(id int64) (*speakerProfile, error) {
+	for hops := 0; hops < 32; hops++ {
+		var p speakerProfile
+		var name, role sql.NullString
+		var merged sql.NullInt64
+		err := m.db.QueryRow("SELECT id, channel, name, role, merged_into FROM speakers WHERE id = ?", id).
+			Scan(&p.ID, &p.Channel, &name, &role, &merged)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read speaker: %w", err)
+		}
+		if merged.Valid {
+			id = merged.Int64
+			continue
+		}
+		p.Name, p.Role = name.String, role.String
+		return &p, nil
+	}
+	return nil, fmt.Errorf("speaker %d is merged in a cycle", id)
+}
+
+// Speakers returns the active speakers, of channel unless it is "", with
+// how many videos they speak in and for how long
+func (m *Manifest) Speakers(channel string) ([]*speakerProfile, error) {
+	rows, err := m.db.Query(`
+		SELECT s.id, s.channel, COALESCE(s.name, ''), COALESCE(s.role, ''),
+			COUNT(DISTINCT v.video_id), COALESCE(SUM(v.seconds), 0)
+		FROM speakers s LEFT JOIN speaker_voices v ON v.speaker_id = s.id
+		WHERE s.merged_into IS NULL AND (? = '' OR s.channel = ?)
+		GROUP BY s.id ORDER BY s.channel, s.id`, channel, channel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read speakers: %w", err)
+	}
+	defer rows.Close()
+
+	var speakers []*speakerProfile
+	for rows.Next() {
+		var p speakerProfile
+		if err := rows.Scan(&p.ID, &p.Channel, &p.Name, &p.Role, &p.Videos, &p.Seconds); err != nil {
+			return nil, fmt.Errorf("failed to read speakers: %w", err)
+		}
+		speakers = append(speakers, &p)
+	}
+	return speakers, rows.Err()
+}
+
+// LabelSpeaker sets the name and role of a speaker; empty values leave
+// them as they are
+func (m *Manifest) LabelSpeaker(id int64, name, role string) error {
+	return m.write(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE speakers SET name = COALESCE(NULLIF(?, ''), name), role = COALESCE(NULLIF(?, ''), role) WHERE id = ?`,
+			name, role, id)
+		if err != nil {
+			return fmt.Errorf("failed to label speaker: %w", err)
+		}
+		return nil
+	})
+}
+
+// MergeSpeakers moves the voices of speaker from to speaker into, which
+// takes from's name and role where it has none
+func (m *Manifest) MergeSpeakers(from, into int64) error {
+	return m.write(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("UPDATE speaker_voices SET speaker_id = ? WHERE speaker_id = ?", into, from); err != nil {
+			return fmt.Errorf("failed to merge speakers: %w", err)
+		}
+		_, err := tx.Exec(`UPDATE speakers SET
+				name = COALESCE(name, (SELECT name FROM speakers WHERE id = ?)),
+				role = COALESCE(role, (SELECT role FROM speakers WHERE id = ?))
+			WHERE id = ?`, from, from, into)
+		if err != nil {
+			return fmt.Errorf("failed to merge speakers: %w", err)
+		}
+		if _, err := tx.Exec("UPDATE speakers SET merged_into = ? WHERE id = ? OR merged_into = ?", into, from, from); err != nil {
+			return fmt.Errorf("failed to merge speakers: %w", err)
+		}
+		return nil
+	})
+}
+
+// loadSpeakerVoices reads and checks a voice file, filling in its channel
+func loadSpeakerVoices(m *Manifest, path string) (*speakerVoicesFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var f speakerVoicesFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if f.VideoID == "" {
+		return nil, fmt.Errorf("%s: video_id is required", path)
+	}
+	for i, s := range f.Speakers {
+		if s.Label == "" || len(s.Embedding) == 0 {
+			return nil, fmt.Errorf("%s: speaker %d needs a label and an embedding", path, i+1)
+		}
+	}
+	f.Model = orDefault(f.Model, "unknown")
+	f.Channel = orDefault(speakersChannel, f.Channel)
+	if f.Channel == "" {
+		if item, err := m.ItemByVideoID(f.VideoID); err == nil && item != nil {
+			f.Channel = item.Channel
+		}
+	}
+	if f.Channel == "" {
+		return nil, fmt.Errorf("%s: channel of %s unknown; give it with --channel", path, f.VideoID)
+	}
+	return &f, nil
+}
+
+func runSpeakersImport(cmd *cobra.Command, args []string) error {
+	if speakersThreshold <= 0 || speakersThreshold > 1 {
+		return fmt.Errorf("--threshold must be in (0, 1]")
+	}
+	manifest, err := openManifest(speakersManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	for _, path := range args {
+		f, err := loadSpeakerVoices(manifest, path)
+		if err != nil {
+			return err
+		}
+		ids, created, err := manifest.ImportSpeakerVoices(f, speakersThreshold)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ %s (%s): %d voices\n", f.VideoID, f.Channel, len(ids))
+		for i, id := range ids {
+			p, err := manifest.Speaker(id)
+			if err != nil || p == nil {
+				continue
+			}
+			how := "matched"
+			if created[i] {
+				how = "new"
+			}
+			fmt.Printf("  %s → %s [%d, %s]\n", f.Speakers[i].Label, p.displayName(), p.ID, how)
+		}
+	}
+	return nil
+}
+
+func runSpeakersList(cmd *cobra.Command, args []string) error {
+	manifest, err := openManifest(speakersManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	speakers, err := manifest.Speakers(speakersChannel)
+	if err != nil {
+		return err
+	}
+	if len(speakers) == 0 {
+		fmt.Println("No speakers registered (see 'vkm speakers import')")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tROLE\tCHANNEL\tVIDEOS\tSPEAKING")
+	for _, p := range speakers {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n", p.ID, orDefault(p.Name, "-"), orDefault(p.Role, "-"), p.Channel,
+			p.Videos, formatVideoOffset(p.Seconds))
+	}
+	return w.Flush()
+}
+
+// parseSpeakerID parses a speaker ID argument
+func parseSpeakerID(s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid speaker ID %q", s)
+	}
+	return id, nil
+}
+
+func runSpeakersLabel(cmd *cobra.Command, args []string) error {
+	id, err := parseSpeakerID(args[0])
+	if err != nil {
+		return err
+	}
+	name, role := strings.TrimSpace(speakersName), strings.TrimSpace(speakersRole)
+	if name == "" && role == "" {
+		return fmt.Errorf("give --name, --role or both")
+	}
+	manifest, err := openManifest(speakersManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	p, err := manifest.Speaker(id)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("no speaker %d", id)
+	}
+	if err := manifest.LabelSpeaker(p.ID, name, role); err != nil {
+		return err
+	}
+	if p, err = manifest.Speaker(p.ID); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Speaker %d is %s\n", p.ID, p.displayName())
+	return nil
+}
+
+func runSpeakersMerge(cmd *cobra.Command, args []string) error {
+	from, err := parseSpeakerID(args[0])
+	if err != nil {
+		return err
+	}
+	into, err := parseSpeakerID(args[1])
+	if err != nil {
+		return err
+	}
+	manifest, err := openManifest(speakersManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	a, err := manifest.Speaker(from)
+	if err != nil {
+		return err
+	}
+	b, err := manifest.Speaker(into)
+	if err != nil {
+		return err
+	}
+	switch {
+	case a == nil:
+		return fmt.Errorf("no speaker %d", from)
+	case b == nil:
+		return fmt.Errorf("no speaker %d", into)
+	case a.ID == b.ID:
+		return fmt.Errorf("speakers %d and %d are already the same", from, into)
+	}
+	if err := manifest.MergeSpeakers(a.ID, b.ID); err != nil {
+		return err
+	}
+	if b, err = manifest.Speaker(b.ID); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Merged speaker %d into %d: %s\n", a.ID, b.ID, b.displayName())
+	return nil
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// defaultSponsorBlockCategories are the SponsorBlock segments removed
+// unless --sponsorblock-remove says otherwise
+const defaultSponsorBlockCategories = "sponsor,selfpromo,interaction,intro,outro"
+
+const sponsorBlockHelp = `SponsorBlock:
+  Segments SponsorBlock users marked in --sponsorblock-remove categories
+  (sponsor reads, self-promotion, subscribe reminders, intros and outros
+  by default) are cut from downloaded audio before transcription, and
+  caption cues inside them are dropped, so they cost no Whisper time and
+  yield no facts. Any of yt-dlp's categories can be listed (sponsor,
+  intro, outro, selfpromo, preview, filler, interaction,
+  music_offtopic, or all); "none" keeps videos whole. Whisper timestamps
+  are mapped back to the original video, using the segments recorded in
+  the .info.json, so fact links still point at the right moment. Videos
+  SponsorBlock knows nothing about are kept whole.`
+
+// sponsorBlockCategories is the --sponsorblock-remove of the commands
+// that download from YouTube
+var sponsorBlockCategories string
+
+// sponsorBlockArgs returns the yt-dlp arguments removing
+// --sponsorblock-remove segments, or none when it is disabled
+func sponsorBlockArgs() []string {
+	cats := strings.TrimSpace(sponsorBlockCategories)
+	if cats == "" || cats == "none" {
+		return nil
+	}
+	return []string{"--sponsorblock-remove", cats}
+}
+
+// sponsorSegment is a span of the original video SponsorBlock removed
+type sponsorSegment struct {
+	Start    float64
+	End      float64
+	Category string
+}
+
+// removedSegmentsKey is the info.json key under which downloads record
+// the segments cut from their audio, for transcription to map
+// timestamps back however --sponsorblock-remove is set then
+const removedSegmentsKey = "vkm_sponsorblock_removed"
+
+// removedSegments reads the SponsorBlock segments yt-dlp recorded in a
+// video's info.json, sorted and with overlaps merged. Only the categories
+// of the current --sponsorblock-remove count, since yt-dlp records every
+// segment it fetched.
+func removedSegments(info map[string]interface{}) []sponsorSegment {
+	cats := sponsorBlockArgs()
+	if len(cats) == 0 {
+		return nil
+	}
+	wanted := make(map[string]bool)
+	for _, c := range strings.Split(cats[1], ",") {
+		wanted[strings.TrimSpace(c)] = true
+	}
+
+	chapters, _ := info["sponsorblock_chapters"].([]interface{})
+	var segments []sponsorSegment
+	for _, c := range chapters {
+		ch, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		start, _ := ch["start_time"].(float64)
+		end, _ := ch["end_time"].(float64)
+		category, _ := ch["category"].(string)
+		if end <= start || !(wanted["all"] || wanted[category]) || wanted["-"+category] {
+			continue
+		}
+		segments = append(segments, sponsorSegment{Start: start, End: end, Category: category})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Start < segments[j].Start })
+
+	merged := segments[:0]
+	for _, s := range segments {
+		if n := len(merged); n > 0 && s.Start <= merged[n-1].End {
+			if s.End > merged[n-1].End {
+				merged[n-1].End = s.End
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// markRemovedSegments records in the info.json at infoPath the segments
+// cut from the audio downloaded with it, and returns them
+func markRemovedSegments(infoPath string) ([]sponsorSegment, error) {
+	info, err := loadVideoMetadata(infoPath)
+	if err != nil {
+		return nil, err
+	}
+	removed := removedSegments(info)
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	spans := make([][2]float64, len(removed))
+	for i, s := range removed {
+		spans[i] = [2]float64{s.Start, s.End}
+	}
+	info[removedSegmentsKey] = spans
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(infoPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to update %s: %w", infoPath, err)
+	}
+	return removed, nil
+}
+
+// cutSegments reads the segments markRemovedSegments recorded in a
+// video's info.json
+func cutSegments(info map[string]interface{}) []sponsorSegment {
+	spans, _ := info[removedSegmentsKey].([]interface{})
+	var segments []sponsorSegment
+	for _, span := range spans {
+		if se, ok := span.([]interface{}); ok && len(se) == 2 {
+			start, _ := se[0].(float64)
+			end, _ := se[1].(float64)
+			segments = append(segments, sponsorSegment{Start: start, End: end})
+		}
+	}
+	return segments
+}
+
+// originalVideoTime maps a time in audio with segments removed back to
+// the same moment in the original video
+func originalVideoTime(t float64, segments []sponsorSegment) float64 {
+	for _, s := range segments {
+		if s.Start > t {
+			break
+		}
+		t += s.End - s.Start
+	}
+	return t
+}
+
+// insideSegments reports whether a time in the original video falls in
+// one of segments
+func insideSegments(t float64, segments []sponsorSegment) bool {
+	for _, s := range segments {
+		if t >= s.Start && t < s.End {
+			return true
+		}
+	}
+	return false
+}
+
+// describeRemoved summarizes segments for progress output, e.g.
+// "1:05 (sponsor, intro)"
+func describeRemoved(segments []sponsorSegment) string {
+	var total float64
+	var cats []string
+	seen := make(map[string]bool)
+	for _, s := range segments {
+		total += s.End - s.Start
+		if !seen[s.Category] {
+			seen[s.Category] = true
+			cats = append(cats, s.Category)
+		}
+	}
+	return fmt.Sprintf("%s (%s)", formatVideoOffset(total), strings.Join(cats, ", "))
+}
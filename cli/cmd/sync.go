@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// SyncPlaylistCmd keeps a local copy of a playlist up to date
+var SyncPlaylistCmd = &cobra.Command{
+	Use:   "sync-playlist <playlist-url>",
+	Short: "Download a playlist's new entries since the last sync",
+	Long: `Bring a local copy of a playlist up to date: list the playlist as it is
+now, compare it with the manifest's catalog, and download only the
+entries that have no local copy yet. Run it again whenever the playlist
+may have grown, e.g. a course adding a lecture each week.
+
+The manifest remembers which videos each synced playlist held. With
+--detect-removals, entries seen in an earlier sync that are gone from
+the playlist now are reported and marked removed; their files are left
+alone. Removal detection trusts the listing to be complete, so leave it
+off when the listing is known to be partial (region-locked or private
+entries yt-dlp skips).
+
+Downloads are named and laid out as with download-playlist, whose
+download archive, captions, duration limit and rate limit flags apply
+here too. Entries skipped for their length are looked at again on each
+sync, so changing the limits picks them up.
+
+Examples:
+  vkm sync-playlist https://youtube.com/playlist?list=PLxxx
+  vkm sync-playlist --detect-removals --dry-run https://youtube.com/playlist?list=PLxxx`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSyncPlaylist,
+}
+
+var syncDetectRemovals bool
+
+func init() {
+	SyncPlaylistCmd.Flags().StringVarP(&playlistOutputDir, "output", "o", "data/videos", "Output directory")
+	SyncPlaylistCmd.Flags().StringVar(&playlistNameTemplate, "name-template", defaultPlaylistNameTemplate, "Go template for output file names")
+	SyncPlaylistCmd.Flags().StringVar(&outputLayout, "layout", layoutFlat, "Output layout: flat, or per-video for a directory of files per video")
+	SyncPlaylistCmd.Flags().StringToStringVar(&siteNameTemplates, "site-name-template", nil, "Name template for one site, as site=template (repeatable)")
+	SyncPlaylistCmd.Flags().StringVar(&playlistManifest, "manifest", "data/manifest.db", "SQLite manifest holding the catalog and synced playlists")
+	SyncPlaylistCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	SyncPlaylistCmd.Flags().BoolVar(&playlistCaptions, "prefer-captions", false, "Save existing YouTube captions as transcripts instead of downloading audio")
+	SyncPlaylistCmd.Flags().StringVar(&playlistTranscripts, "transcripts", "data/transcripts", "Directory for caption transcripts (with --prefer-captions)")
+	SyncPlaylistCmd.Flags().StringVar(&captionLangs, "caption-langs", defaultCaptionLangs, "Caption languages to accept, as yt-dlp --sub-langs")
+	SyncPlaylistCmd.Flags().StringVar(&downloadArchivePath, "download-archive", defaultDownloadArchive, "File listing completed videos to skip")
+	SyncPlaylistCmd.Flags().BoolVar(&downloadForce, "force", false, "Download videos even if the download archive lists them")
+	SyncPlaylistCmd.Flags().StringVar(&sponsorBlockCategories, "sponsorblock-remove", defaultSponsorBlockCategories, "SponsorBlock categories to cut from audio and captions (none keeps videos whole)")
+	SyncPlaylistCmd.Flags().StringVar(&downloaderChoice, "downloader", downloaderAuto, "Downloader to use (auto, yt-dlp, native)")
+	SyncPlaylistCmd.Flags().StringVar(&downloadRateLimit, "rate-limit", "", "Maximum download rate in bytes per second (e.g. 500K, 2M)")
+	SyncPlaylistCmd.Flags().DurationVar(&downloadSleepBetween, "sleep-between", 0, "Time to wait between downloads (e.g. 5s)")
+	SyncPlaylistCmd.Flags().DurationVar(&minDuration, "min-duration", 0, "Skip videos shorter than this (e.g. 2m)")
+	SyncPlaylistCmd.Flags().DurationVar(&maxDuration, "max-duration", 0, "Skip videos longer than this (e.g. 3h)")
+	SyncPlaylistCmd.Flags().BoolVar(&syncDetectRemovals, "detect-removals", false, "Report and mark entries removed from the playlist since the last sync")
+	SyncPlaylistCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List new and removed entries, without downloading or recording anything")
+}
+
+// playlistEntry is a video a synced playlist held
+type playlistEntry struct {
+	VideoID   string
+	URL       string
+	Position  int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// RemovedAt is when a sync found the video gone from the playlist
+	RemovedAt time.Time
+}
+
+// PlaylistEntries returns the videos recorded for a synced playlist, by
+// video ID
+func (m *Manifest) PlaylistEntries(playlist string) (map[string]*playlistEntry, error) {
+	rows, err := m.db.Query(`SELECT video_id, url, position, first_seen, last_seen, removed_at
+		FROM playlist_entries WHERE playlist = ?`, playlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make(map[string]*playlistEntry)
+	for rows.Next() {
+		var e playlistEntry
+		var removed sql.NullTime
+		if err := rows.Scan(&e.VideoID, &e.URL, &e.Position, &e.FirstSeen, &e.LastSeen, &removed); err != nil {
+			return nil, fmt.Errorf("failed to read playlist entries: %w", err)
+		}
+		e.RemovedAt = removed.Time
+		entries[e.VideoID] = &e
+	}
+	return entries, rows.Err()
+}
+
+// RecordPlaylistSync records the playlist's current entries, bringing
+// back any marked removed, and marks the removed IDs as gone
+func (m *Manifest) RecordPlaylistSync(playlist string, items []pipelineItem, removed []string) error {
+	now := time.Now().UTC()
+	return m.write(func(tx *sql.Tx) error {
+		for i, item := range items {
+			_, err := tx.Exec(`
+				INSERT INTO playlist_entries (playlist, video_id, url, position, first_seen, last_seen)
+				VALUES (?, ?, ?, ?, ?, ?)
+				ON CONFLICT(playlist, video_id) DO UPDATE SET
+					url        = excluded.url,
+					position   = excluded.position,
+					last_seen  = excluded.last_seen,
+					removed_at = NULL`,
+				playlist, item.VideoID, item.URL, i+1, now, now)
+			if err != nil {
+				return fmt.Errorf("failed to record playlist entry: %w", err)
+			}
+		}
+		for _, id := range removed {
+			if _, err := tx.Exec("UPDATE playlist_entries SET removed_at = ? WHERE playlist = ? AND video_id = ?",
+				now, playlist, id); err != nil {
+				return fmt.Errorf("failed to record playlist removal: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// playlistKey identifies a playlist in the manifest: its ID when the
+// listing gives one, else its URL
+func playlistKey(playlistURL string, items []pipelineItem) string {
+	for _, item := range items {
+		if item.PlaylistID != "" {
+			return item.PlaylistID
+		}
+	}
+	return playlistURL
+}
+
+// localCopy returns where the manifest records a downloaded copy of item
+// (its audio, or a transcript from captions) that still exists, or ""
+func localCopy(m *Manifest, item pipelineItem) string {
+	if path := downloadedAudioPath(m, item); path != "" {
+		return path
+	}
+	if m == nil || item.VideoID == "" {
+		return ""
+	}
+	prev, err := m.ItemByVideoID(item.VideoID)
+	if err != nil || prev == nil || prev.State == ItemPending {
+		return ""
+	}
+	if prev.Pruned() && !downloadForce {
+		// 'vkm clean' removed it once it was transcribed
+		return orDefault(prev.TranscriptPath, prev.AudioPath)
+	}
+	if prev.TranscriptPath == "" || !fileExists(prev.TranscriptPath) {
+		return ""
+	}
+	return prev.TranscriptPath
+}
+
+func runSyncPlaylist(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	playlistURL := args[0]
+
+	downloader, err := selectDownloader(transcodeOptions{Format: audioFormat}, false)
+	if err != nil {
+		return err
+	}
+	if err := checkMediaURLs([]string{playlistURL}, downloader); err != nil {
+		return err
+	}
+	if err := checkDurationLimits(); err != nil {
+		return err
+	}
+	names, err := parseSiteNameTemplates(playlistNameTemplate, siteNameTemplates)
+	if err != nil {
+		return err
+	}
+	if err := names.setLayout(outputLayout); err != nil {
+		return err
+	}
+	archive, err := openDownloadArchive(downloadArchivePath)
+	if err != nil {
+		return err
+	}
+
+	items, err := downloader.ListPlaylist(ctx, playlistURL)
+	if err != nil {
+		return err
+	}
+	key := playlistKey(playlistURL, items)
+
+	// A dry run reads an existing manifest but creates none
+	var manifest *Manifest
+	if _, statErr := os.Stat(playlistManifest); statErr == nil || !dryRun {
+		if manifest, err = openManifest(playlistManifest); err != nil {
+			return err
+		}
+		defer manifest.Close()
+	}
+	known := make(map[string]*playlistEntry)
+	if manifest != nil {
+		if known, err = manifest.PlaylistEntries(key); err != nil {
+			return err
+		}
+	}
+
+	var fresh []pipelineItem
+	current := make(map[string]bool)
+	for _, item := range items {
+		current[item.VideoID] = true
+		if archive.Skip(item) || localCopy(manifest, item) != "" {
+			continue
+		}
+		fresh = append(fresh, item)
+	}
+	var removed []string
+	if syncDetectRemovals {
+		for id, e := range known {
+			if !current[id] && e.RemovedAt.IsZero() {
+				removed = append(removed, id)
+			}
+		}
+	}
+
+	fmt.Printf("Playlist %s: %d entries, %d new since the last sync\n", playlistURL, len(items), len(fresh))
+	reportRemovedEntries(manifest, removed)
+
+	if dryRun {
+		if len(fresh) == 0 {
+			return nil
+		}
+		fmt.Println()
+		return dryRunDownloads(ctx, fresh, archive, playlistManifest)
+	}
+
+	if fresh, err = applyDurationLimits(ctx, fresh); err != nil {
+		return err
+	}
+	if len(fresh) > 0 {
+		if err := os.MkdirAll(playlistOutputDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	downloaded, failed := syncEntries(ctx, downloader, manifest, archive, fresh, names)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := manifest.RecordPlaylistSync(key, items, removed); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d downloaded, %d failed, %d already present", downloaded, failed, len(items)-len(fresh))
+	if syncDetectRemovals {
+		fmt.Printf(", %d removed from the playlist", len(removed))
+	}
+	fmt.Println()
+	if failed > 0 {
+		fmt.Println("Run the same command again to retry failed entries.")
+	}
+	return nil
+}
+
+// syncEntries downloads a playlist's new entries, returning how many
+// were downloaded and how many failed
+func syncEntries(ctx context.Context, d videoDownloader, m *Manifest, archive *downloadArchive, items []pipelineItem, names *nameTemplate) (downloaded, failed int) {
+	transcriptDir := ""
+	if playlistCaptions {
+		transcriptDir = captionDir(names, playlistTranscripts, playlistOutputDir)
+	}
+
+	for i, item := range items {
+		fmt.Printf("[%d/%d] %s\n", i+1, len(items), item.URL)
+		media, _, err := downloadResumable(ctx, d, m, item, playlistOutputDir, transcriptDir, names)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return downloaded, failed
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Warning: Failed to download %s: %v\n", item.URL, err)
+			failed++
+		default:
+			archive.Add(item, media.VideoID)
+			if media.Captions {
+				fmt.Printf("✓ Transcript from captions: %s\n", media.Path)
+			}
+			downloaded++
+		}
+	}
+	return downloaded, failed
+}
+
+// reportRemovedEntries lists videos gone from the playlist with the
+// local copy each left behind
+func reportRemovedEntries(m *Manifest, removed []string) {
+	if len(removed) == 0 {
+		return
+	}
+	fmt.Printf("%d entries removed from the playlist since the last sync:\n", len(removed))
+	for _, id := range removed {
+		where := "no local copy"
+		if path := localCopy(m, pipelineItem{VideoID: id}); path != "" {
+			where = "kept at " + path
+		}
+		fmt.Printf("  - %s (%s)\n", id, where)
+	}
+}
@@ -0,0 +1,431 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// TagCmd tags local patches with topics from a taxonomy
+var TagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Tag local patches with topics from a taxonomy",
+	Long: `Classify the facts in local patches under --data against a topic taxonomy
+and record matching topics as fact tags, so queries like
+'vkm export --query tag:reinforcement-learning' can filter by them.
+
+The taxonomy is a YAML tree of topics:
+
+  topics:
+    - name: machine-learning
+      description: Training and evaluating statistical models
+      keywords: [neural network, gradient descent]
+      children:
+        - name: reinforcement-learning
+          description: Agents learning from rewards
+          keywords: [reward model, policy gradient]
+
+A fact tagged with a topic is also tagged with the topic's ancestors. Facts
+containing one of a topic's keywords always match it. Beyond keywords,
+--method embeddings (OPENAI_API_KEY) matches topics whose name,
+description and keywords embed close to the fact (--threshold), and
+--method llm (CLAUDE_API_KEY) asks Claude to pick topics for each fact.
+
+Each patch records the taxonomy version it was tagged with and the topics
+of its facts in its metadata. Patches already tagged with the current
+taxonomy are skipped unless --retag is given; retagging replaces the tags
+an earlier taxonomy added and leaves other tags alone.
+
+Examples:
+  vkm tag --taxonomy data/taxonomy.yaml
+  vkm tag --method llm --retag
+  vkm export --query "tag:machine-learning since:2024"`,
+	RunE: runTag,
+}
+
+var (
+	tagDataDir   string
+	tagTaxonomy  string
+	tagMethod    string
+	tagThreshold float64
+	tagMaxTopics int
+	tagRetag     bool
+	tagDryRun    bool
+)
+
+func init() {
+	TagCmd.Flags().StringVar(&tagDataDir, "data", "data", "Directory holding local patches")
+	TagCmd.Flags().StringVar(&tagTaxonomy, "taxonomy", "data/taxonomy.yaml", "Topic taxonomy YAML file")
+	TagCmd.Flags().StringVar(&tagMethod, "method", "embeddings", "Classification method (keywords, embeddings, llm)")
+	TagCmd.Flags().Float64Var(&tagThreshold, "threshold", 0.45, "Minimum cosine similarity for an embedding match")
+	TagCmd.Flags().IntVar(&tagMaxTopics, "max-topics", 3, "Maximum taxonomy topics per fact, before adding ancestors")
+	TagCmd.Flags().BoolVar(&tagRetag, "retag", false, "Tag patches again even if the taxonomy hasn't changed")
+	TagCmd.Flags().BoolVar(&tagDryRun, "dry-run", false, "Print the topics each patch would get without writing")
+}
+
+// Classification methods
+const (
+	tagMethodKeywords   = "keywords"
+	tagMethodEmbeddings = "embeddings"
+	tagMethodLLM        = "llm"
+)
+
+// TaxonomyTopic is a node of the topic taxonomy
+type TaxonomyTopic struct {
+	Name        string          `yaml:"name"`
+	Description string          `yaml:"description"`
+	Keywords    []string        `yaml:"keywords"`
+	Children    []TaxonomyTopic `yaml:"children"`
+
+	parent *TaxonomyTopic
+}
+
+// Taxonomy is a parsed taxonomy file, flattened for classification
+type Taxonomy struct {
+	Topics  []TaxonomyTopic `yaml:"topics"`
+	Version string          `yaml:"-"`
+
+	all    []*TaxonomyTopic
+	byName map[string]*TaxonomyTopic
+}
+
+// loadTaxonomy reads and validates a taxonomy file. Its version is a short
+// hash of the file contents.
+func loadTaxonomy(path string) (*Taxonomy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read taxonomy: %w", err)
+	}
+
+	var t Taxonomy
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse taxonomy %s: %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	t.Version = hex.EncodeToString(sum[:4])
+	t.byName = make(map[string]*TaxonomyTopic)
+
+	var walk func(topics []TaxonomyTopic, parent *TaxonomyTopic) error
+	walk = func(topics []TaxonomyTopic, parent *TaxonomyTopic) error {
+		for i := range topics {
+			topic := &topics[i]
+			topic.Name = strings.TrimSpace(topic.Name)
+			if topic.Name == "" {
+				return fmt.Errorf("taxonomy %s has a topic without a name", path)
+			}
+			if t.byName[topic.Name] != nil {
+				return fmt.Errorf("taxonomy %s lists topic %q twice", path, topic.Name)
+			}
+			topic.parent = parent
+			t.byName[topic.Name] = topic
+			t.all = append(t.all, topic)
+			if err := walk(topic.Children, topic); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(t.Topics, nil); err != nil {
+		return nil, err
+	}
+	if len(t.all) == 0 {
+		return nil, fmt.Errorf("taxonomy %s has no topics", path)
+	}
+	return &t, nil
+}
+
+// withAncestors returns names plus every ancestor of each, sorted
+func (t *Taxonomy) withAncestors(names []string) []string {
+	set := make(map[string]bool)
+	for _, name := range names {
+		for topic := t.byName[name]; topic != nil; topic = topic.parent {
+			set[topic.Name] = true
+		}
+	}
+	out := make([]string, 0, len(set))
+	for name := range set {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// embeddingText describes a topic for embedding
+func (topic *TaxonomyTopic) embeddingText() string {
+	text := strings.ReplaceAll(topic.Name, "-", " ")
+	if topic.Description != "" {
+		text += ": " + topic.Description
+	}
+	if len(topic.Keywords) > 0 {
+		text += ". Keywords: " + strings.Join(topic.Keywords, ", ")
+	}
+	return text
+}
+
+// keywordMatches returns topics with a keyword occurring in text
+func (t *Taxonomy) keywordMatches(text string) []string {
+	text = strings.ToLower(text)
+	var names []string
+	for _, topic := range t.all {
+		for _, kw := range topic.Keywords {
+			if kw = strings.ToLower(strings.TrimSpace(kw)); kw != "" && strings.Contains(text, kw) {
+				names = append(names, topic.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// Patch metadata keys written by tag
+const (
+	metaTaxonomyVersion = "taxonomy-version"
+	metaTopics          = "topics"
+)
+
+func runTag(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	switch tagMethod {
+	case tagMethodKeywords:
+	case tagMethodEmbeddings:
+		if os.Getenv("OPENAI_API_KEY") == "" {
+			return fmt.Errorf("OPENAI_API_KEY environment variable not set")
+		}
+	case tagMethodLLM:
+		if os.Getenv("CLAUDE_API_KEY") == "" {
+			return fmt.Errorf("CLAUDE_API_KEY environment variable not set")
+		}
+	default:
+		return fmt.Errorf("unknown method %q (use keywords, embeddings or llm)", tagMethod)
+	}
+
+	taxonomy, err := loadTaxonomy(tagTaxonomy)
+	if err != nil {
+		return err
+	}
+	files, err := loadLocalPatchFiles(tagDataDir)
+	if err != nil {
+		return err
+	}
+
+	var topicVecs [][]float64
+	if tagMethod == tagMethodEmbeddings {
+		texts := make([]string, len(taxonomy.all))
+		for i, topic := range taxonomy.all {
+			texts[i] = topic.embeddingText()
+		}
+		if topicVecs, err = embedTexts(ctx, texts); err != nil {
+			return fmt.Errorf("failed to embed taxonomy: %w", err)
+		}
+	}
+
+	fmt.Printf("Taxonomy %s: %d topics (version %s), method %s\n\n", tagTaxonomy, len(taxonomy.all), taxonomy.Version, tagMethod)
+
+	// Copies of a patch get the same tags, classified once
+	classified := make(map[string][][]string)
+	var tagged, skipped, failed int
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		p := f.Patch
+		if len(p.Facts) == 0 {
+			continue
+		}
+		if version, _ := p.Metadata[metaTaxonomyVersion].(string); version == taxonomy.Version && !tagRetag {
+			skipped++
+			continue
+		}
+
+		factTopics, ok := classified[p.ID]
+		if !ok {
+			if factTopics, err = classifyFacts(ctx, taxonomy, topicVecs, p.Facts); err != nil {
+				fmt.Fprintf(os.Stderr, "✗ %s: %v\n", f.Path, err)
+				failed++
+				continue
+			}
+			classified[p.ID] = factTopics
+		}
+
+		topics := applyTaxonomyTags(taxonomy, p, factTopics)
+		if tagDryRun {
+			fmt.Printf("%s: %s\n", f.Path, strings.Join(topics, ", "))
+			continue
+		}
+		if err := writePatchFile(f.Path, *p); err != nil {
+			return err
+		}
+		fmt.Printf("✓ %s: %s\n", f.Path, orDefault(strings.Join(topics, ", "), "no topics"))
+		tagged++
+	}
+
+	fmt.Printf("\nTagged %d patches, %d already tagged with this taxonomy, %d failed\n", tagged, skipped, failed)
+	return nil
+}
+
+// classifyFacts returns the taxonomy topics (without ancestors) each fact
+// matches, by keyword plus the selected method
+func classifyFacts(ctx context.Context, t *Taxonomy, topicVecs [][]float64, facts []Fact) ([][]string, error) {
+	matches := make([][]string, len(facts))
+	for i, f := range facts {
+		matches[i] = t.keywordMatches(f.Text)
+	}
+
+	switch tagMethod {
+	case tagMethodEmbeddings:
+		texts := make([]string, len(facts))
+		for i, f := range facts {
+			texts[i] = f.Text
+		}
+		vecs, err := embedTexts(ctx, texts)
+		if err != nil {
+			return nil, err
+		}
+		for i, vec := range vecs {
+			type scored struct {
+				name  string
+				score float64
+			}
+			var hits []scored
+			for j, topicVec := range topicVecs {
+				if s := cosineSimilarity(vec, topicVec); s >= tagThreshold {
+					hits = append(hits, scored{t.all[j].Name, s})
+				}
+			}
+			sort.Slice(hits, func(a, b int) bool { return hits[a].score > hits[b].score })
+			for _, h := range hits {
+				matches[i] = append(matches[i], h.name)
+			}
+		}
+	case tagMethodLLM:
+		picked, err := classifyFactsWithClaude(ctx, t, facts)
+		if err != nil {
+			return nil, err
+		}
+		for i := range matches {
+			matches[i] = append(matches[i], picked[i]...)
+		}
+	}
+
+	for i := range matches {
+		matches[i] = firstUnique(matches[i], tagMaxTopics)
+	}
+	return matches, nil
+}
+
+// firstUnique returns up to n distinct names in their original order
+func firstUnique(names []string, n int) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, name := range names {
+		if len(out) == n {
+			break
+		}
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+const taxonomyPrompt = "Classify each numbered fact into topics from this taxonomy. " +
+	"Use only the topic names listed; a fact may have several topics or none.\n\n" +
+	"Topics:\n%s\n" +
+	"Facts:\n%s\n" +
+	"Respond ONLY with a valid JSON array, nothing else:\n" +
+	"[{\"fact\": 1, \"topics\": [\"topic-name\"]}]"
+
+// classifyFactsWithClaude asks Claude to pick taxonomy topics for facts;
+// names outside the taxonomy are dropped
+func classifyFactsWithClaude(ctx context.Context, t *Taxonomy, facts []Fact) ([][]string, error) {
+	var topics, list strings.Builder
+	for _, topic := range t.all {
+		fmt.Fprintf(&topics, "- %s", topic.Name)
+		if topic.Description != "" {
+			fmt.Fprintf(&topics, ": %s", topic.Description)
+		}
+		topics.WriteByte('\n')
+	}
+	for i, f := range facts {
+		fmt.Fprintf(&list, "%d. %s\n", i+1, f.Text)
+	}
+
+	answer, err := askClaude(ctx, claudeLightModel, fmt.Sprintf(taxonomyPrompt, topics.String(), list.String()))
+	if err != nil {
+		return nil, err
+	}
+	if m := codeBlockPattern.FindStringSubmatch(answer); m != nil {
+		answer = m[1]
+	}
+
+	var picked []struct {
+		Fact   int      `json:"fact"`
+		Topics []string `json:"topics"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(answer)), &picked); err != nil {
+		return nil, fmt.Errorf("failed to parse classification: %w", err)
+	}
+
+	out := make([][]string, len(facts))
+	for _, p := range picked {
+		if p.Fact < 1 || p.Fact > len(facts) {
+			continue
+		}
+		for _, name := range p.Topics {
+			if t.byName[name] != nil {
+				out[p.Fact-1] = append(out[p.Fact-1], name)
+			}
+		}
+	}
+	return out, nil
+}
+
+// applyTaxonomyTags replaces the taxonomy tags on p's facts with factTopics
+// and their ancestors, records the taxonomy in p's metadata and returns
+// the patch's topics
+func applyTaxonomyTags(t *Taxonomy, p *Patch, factTopics [][]string) []string {
+	// Tags from this taxonomy or the one the patch was last tagged with
+	// are replaced; anything else on the fact stays
+	managed := make(map[string]bool)
+	for name := range t.byName {
+		managed[name] = true
+	}
+	if previous, ok := p.Metadata[metaTopics].([]interface{}); ok {
+		for _, name := range previous {
+			if s, ok := name.(string); ok {
+				managed[s] = true
+			}
+		}
+	}
+
+	var all []string
+	for i := range p.Facts {
+		var tags []string
+		for _, tag := range p.Facts[i].Tags {
+			if !managed[tag] {
+				tags = append(tags, tag)
+			}
+		}
+		topics := t.withAncestors(factTopics[i])
+		p.Facts[i].Tags = append(tags, topics...)
+		all = append(all, topics...)
+	}
+
+	patchTopics := t.withAncestors(all)
+	if p.Metadata == nil {
+		p.Metadata = make(map[string]interface{})
+	}
+	p.Metadata[metaTaxonomyVersion] = t.Version
+	p.Metadata[metaTopics] = patchTopics
+	return patchTopics
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// tempRunPrefix starts the name of every run's scratch directory, so gc
+// leaves anything else under the temp root alone
+const tempRunPrefix = "run-"
+
+// tempOwnerFile records which process owns a run directory
+const tempOwnerFile = ".owner.json"
+
+// tempRoot holds one scratch directory per vkm process
+var tempRoot = filepath.Join(os.TempDir(), "vkm")
+
+// tempRun is this process's scratch directory, created on first use
+var tempRun struct {
+	once sync.Once
+	dir  string
+	err  error
+}
+
+// tempOwner is the content of a run directory's owner file
+type tempOwner struct {
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// SetTempRoot sets the directory that holds each run's scratch files. An
+// empty raw falls back to VKM_TEMP_DIR, then to <os temp dir>/vkm.
+func SetTempRoot(raw string) error {
+	if raw == "" {
+		raw = os.Getenv("VKM_TEMP_DIR")
+	}
+	if raw == "" {
+		return nil
+	}
+	abs, err := filepath.Abs(raw)
+	if err != nil {
+		return fmt.Errorf("invalid temp directory %q: %w", raw, err)
+	}
+	tempRoot = abs
+	return nil
+}
+
+// tempDir returns this process's scratch directory under the temp root,
+// creating it on first use. Each process gets its own directory, so
+// parallel runs never share scratch files.
+func tempDir() (string, error) {
+	tempRun.once.Do(func() {
+		tempRun.dir, tempRun.err = createTempRun()
+	})
+	return tempRun.dir, tempRun.err
+}
+
+func createTempRun() (string, error) {
+	if err := os.MkdirAll(filepath.Dir(tempRoot), 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp root: %w", err)
+	}
+	// Like /tmp itself, a shared root is writable by everyone but only
+	// owners may remove their runs
+	if err := os.Mkdir(tempRoot, 0755); err == nil {
+		os.Chmod(tempRoot, 0777|os.ModeSticky)
+	} else if !os.IsExist(err) {
+		return "", fmt.Errorf("failed to create temp root: %w", err)
+	}
+
+	now := time.Now()
+	dir, err := os.MkdirTemp(tempRoot, fmt.Sprintf("%s%s-%d-", tempRunPrefix, now.Format("20060102-150405"), os.Getpid()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	data, err := json.Marshal(tempOwner{Host: host, PID: os.Getpid(), StartedAt: now.UTC()})
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, tempOwnerFile), data, 0644)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to write temp directory owner: %w", err)
+	}
+	return dir, nil
+}
+
+// newTempDir creates a scratch directory in this run's temp directory
+func newTempDir(pattern string) (string, error) {
+	root, err := tempDir()
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(root, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	return dir, nil
+}
+
+// newTempFile creates a scratch file in this run's temp directory
+func newTempFile(pattern string) (*os.File, error) {
+	root, err := tempDir()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(root, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	return f, nil
+}
+
+// CleanupTemp removes this run's temp directory, if one was created.
+// Runs that die before calling it leave their directory for 'vkm gc'.
+func CleanupTemp() {
+	if tempRun.dir != "" {
+		os.RemoveAll(tempRun.dir)
+	}
+}
+
+// moveFile renames src to dst, copying across filesystems when the temp
+// root and the destination are on different devices
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	os.Remove(src)
+	return nil
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rateLimitHelp = `Rate limiting:
+  --rate-limit caps each download's bandwidth, in bytes per second with
+  an optional K, M or G suffix (e.g. 500K or 2M), whichever downloader
+  is used. --sleep-between waits that long (e.g. 5s or 1m) after a
+  download finishes before the next one starts, so large channel scrapes
+  leave room on the connection and are less likely to be throttled by
+  YouTube. Videos skipped as already downloaded don't wait. With
+  --concurrency, each parallel download is limited separately.`
+
+// downloadRateLimit is the --rate-limit of the download commands
+var downloadRateLimit string
+
+// downloadSleepBetween is the --sleep-between of the download commands
+var downloadSleepBetween time.Duration
+
+// parseRateLimit parses a --rate-limit in bytes per second, like yt-dlp's
+// --limit-rate: a number with an optional K, M or G suffix (powers of
+// 1024). An empty value means no limit and gives 0.
+func parseRateLimit(s string) (int64, error) {
+	value := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	if value == "" {
+		return 0, nil
+	}
+	multiplier := 1.0
+	switch value[len(value)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n*multiplier < 1 {
+		return 0, fmt.Errorf("invalid --rate-limit %q (use bytes per second, e.g. 500K or 2M)", s)
+	}
+	return int64(n * multiplier), nil
+}
+
+// formatRate formats a rate in bytes per second for messages
+func formatRate(rate int64) string {
+	switch {
+	case rate >= 1<<20:
+		return strconv.FormatFloat(float64(rate)/(1<<20), 'f', -1, 64) + " MiB/s"
+	case rate >= 1<<10:
+		return strconv.FormatFloat(float64(rate)/(1<<10), 'f', -1, 64) + " KiB/s"
+	}
+	return fmt.Sprintf("%d B/s", rate)
+}
+
+// throttledReader reads from r no faster than rate bytes per second on
+// average, in small enough chunks that the flow stays even
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	rate  int64
+	start time.Time
+	read  int64
+}
+
+func newThrottledReader(ctx context.Context, r io.Reader, rate int64) *throttledReader {
+	return &throttledReader{ctx: ctx, r: r, rate: rate}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	if chunk := int(max(t.rate/10, 1)); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	due := time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second))
+	if wait := due - time.Since(t.start); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		}
+	}
+	return n, err
+}
+
+// downloadPacer keeps --sleep-between of quiet after each download
+var downloadPacer pacer
+
+// pacer spaces out work: wait blocks until the delay given to the last
+// done has passed
+type pacer struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	wait := time.Until(p.next)
+	p.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *pacer) done(delay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next = time.Now().Add(delay)
+}
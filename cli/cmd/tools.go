@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// managedBinDir is where vkm looks for binaries it manages itself (see
+// 'vkm deps update'), checked before PATH. Set VKM_BIN_DIR to override.
+func managedBinDir() string {
+	if dir := os.Getenv("VKM_BIN_DIR"); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "vkm", "bin")
+	}
+	return filepath.Join(os.TempDir(), "vkm", "bin")
+}
+
+// findTool locates an external tool in the managed binary directory or on
+// PATH. A managed copy wins, so 'vkm deps update' takes effect even with
+// an older system-wide install. exec.LookPath already applies PATHEXT on
+// Windows, so "yt-dlp" finds yt-dlp.exe.
+func findTool(name string) (string, error) {
+	candidate := filepath.Join(managedBinDir(), name)
+	if runtime.GOOS == "windows" {
+		candidate += ".exe"
+	}
+	if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+		return candidate, nil
+	}
+
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	return "", missingToolError(name)
+}
+
+// commandExists reports whether an executable is available on PATH or in
+// the managed binary directory
+func commandExists(name string) bool {
+	_, err := findTool(name)
+	return err == nil
+}
+
+// toolCommand builds a command for an external tool, resolved through
+// findTool. An unresolved name is left for exec to report. A proxy set
+// with --proxy is passed on to the tool, and yt-dlp also gets the identity
+// set with --user-agent and --client-id.
+func toolCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	path, err := findTool(name)
+	if err != nil {
+		path = name
+	}
+	if name == "yt-dlp" {
+		args = append(identityArgs(), args...)
+	}
+	if proxyURL != nil && name == "yt-dlp" {
+		args = append([]string{"--proxy", proxyURL.String()}, args...)
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	if env := proxyEnv(); env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
+// ytDlpCommand builds a yt-dlp command with toolCommand, also signed in
+// with the YouTube login of 'vkm auth login' for YouTube URLs. Call
+// cleanup once the command has finished.
+func ytDlpCommand(ctx context.Context, args ...string) (cmd *exec.Cmd, cleanup func()) {
+	auth, cleanup := youtubeAuthArgs(ctx, args)
+	return toolCommand(ctx, "yt-dlp", append(auth, args...)...), cleanup
+}
+
+// missingToolError explains how to install a tool on the current OS
+func missingToolError(name string) error {
+	if name == "yt-dlp" || name == "ffmpeg" {
+		return fmt.Errorf("%s not found. Install with: vkm deps install %s, or %s", name, name, installHint(name))
+	}
+	return fmt.Errorf("%s not found. Install with: %s (or place it in %s)", name, installHint(name), managedBinDir())
+}
+
+// installHint returns the usual install command for a tool on this OS
+func installHint(name string) string {
+	hints := map[string]map[string]string{
+		"yt-dlp": {
+			"windows": "winget install yt-dlp.yt-dlp",
+			"darwin":  "brew install yt-dlp",
+			"":        "pip install yt-dlp",
+		},
+		"ffmpeg": {
+			"windows": "winget install Gyan.FFmpeg",
+			"darwin":  "brew install ffmpeg",
+			"":        "apt install ffmpeg (or your distribution's package manager)",
+		},
+		"whisper": {
+			"": "pip install openai-whisper",
+		},
+		"pdftotext": {
+			"windows": "choco install poppler",
+			"darwin":  "brew install poppler",
+			"":        "apt install poppler-utils (or your distribution's package manager)",
+		},
+		"pdfinfo": {
+			"windows": "choco install poppler",
+			"darwin":  "brew install poppler",
+			"":        "apt install poppler-utils (or your distribution's package manager)",
+		},
+		"clojure": {
+			"windows": "see https://clojure.org/guides/install_clojure#_windows_instructions",
+			"darwin":  "brew install clojure/tools/clojure",
+			"":        "see https://clojure.org/guides/install_clojure",
+		},
+	}
+
+	byOS, ok := hints[name]
+	if !ok {
+		return "your package manager"
+	}
+	if hint, ok := byOS[runtime.GOOS]; ok {
+		return hint
+	}
+	return byOS[""]
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"sort"
+	"strings"
+)
+
+// audioEncoders maps the audio formats downloads can be transcoded to to
+// their ffmpeg encoders
+var audioEncoders = map[string]string{
+	"mp3":  "libmp3lame",
+	"m4a":  "aac",
+	"wav":  "pcm_s16le",
+	"opus": "libopus",
+	"flac": "flac",
+}
+
+// transcodeOptions are the output settings of transcodeAudio; zero values
+// keep ffmpeg's defaults for the format
+type transcodeOptions struct {
+	Format     string
+	SampleRate int
+	Bitrate    string
+}
+
+// checkTranscodeOptions validates options given on the command line
+func checkTranscodeOptions(o transcodeOptions) error {
+	if _, ok := audioEncoders[o.Format]; !ok {
+		formats := make([]string, 0, len(audioEncoders))
+		for f := range audioEncoders {
+			formats = append(formats, f)
+		}
+		sort.Strings(formats)
+		return fmt.Errorf("unknown audio format %q (use %s)", o.Format, strings.Join(formats, ", "))
+	}
+	if o.SampleRate < 0 {
+		return fmt.Errorf("--sample-rate must not be negative")
+	}
+	return nil
+}
+
+// streamExtension picks the file extension for a stream's MIME type
+// ("audio/mp4; codecs=\"mp4a.40.2\"" is m4a, "audio/webm" webm), so
+// untranscoded downloads are named for the container they are in
+func streamExtension(mimeType string) string {
+	media, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return "bin"
+	}
+	switch media {
+	case "audio/mp4":
+		return "m4a"
+	case "video/mp4":
+		return "mp4"
+	case "audio/webm", "video/webm":
+		return "webm"
+	case "audio/mpeg":
+		return "mp3"
+	case "audio/ogg":
+		return "ogg"
+	case "audio/wav", "audio/x-wav":
+		return "wav"
+	}
+	return "bin"
+}
+
+// needsTranscode reports whether a stream saved with extension ext must
+// be transcoded to match o
+func needsTranscode(ext string, o transcodeOptions) bool {
+	return ext != o.Format || o.SampleRate > 0 || o.Bitrate != ""
+}
+
+// transcodeAudio converts src to dst with ffmpeg, encoding the audio track
+// as o.Format and dropping any video
+func transcodeAudio(ctx context.Context, src, dst string, o transcodeOptions) error {
+	if _, err := findTool("ffmpeg"); err != nil {
+		return fmt.Errorf("%w (required to transcode downloads; --no-transcode keeps the original stream)", err)
+	}
+	args := []string{"-y", "-loglevel", "error", "-i", toolPath(src), "-vn", "-c:a", audioEncoders[o.Format]}
+	if o.SampleRate > 0 {
+		args = append(args, "-ar", fmt.Sprint(o.SampleRate))
+	}
+	if o.Bitrate != "" {
+		args = append(args, "-b:a", o.Bitrate)
+	}
+	args = append(args, toolPath(dst))
+
+	cmd := toolCommand(ctx, "ffmpeg", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(dst)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
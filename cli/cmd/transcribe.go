@@ -1,12 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -19,39 +21,118 @@ var TranscribeCmd = &cobra.Command{
 
 Requires whisper to be installed:
   pip install openai-whisper
-
-Example:
-  vkm transcribe --input data/videos --output data/transcripts --model base`,
+or whisper.cpp for --engine whisper.cpp.
+
+Without --language, each file's language is taken from the yt-dlp
+.info.json beside it, or detected by running the tiny model over its
+first 30 seconds (which needs ffmpeg). English audio is then transcribed
+with the English-only variant of --model (tiny.en, base.en, small.en,
+medium.en), which is faster and more accurate on English than the
+multilingual model of the same size; other languages use --model as
+given. Pass --english-models=false, or an exact model name such as
+base.en or large-v3, to choose the model yourself.
+
+The model that produced each transcript (e.g. "whisper-base.en") is
+recorded in the manifest for audio files it tracks.
+
+Videos with chapters in their .info.json (yt-dlp's, or chapter markers
+in the description) keep them in the transcript, and each segment names
+the chapter it starts in, so 'vkm pipeline' can extract facts chapter by
+chapter.
+
+Audio downloaded with --layout per-video (<video-id>/audio.mp3) is
+transcribed to transcript.json in its own directory rather than --output.
+
+` + diarizeHelp + ` The voice of each speaker is saved beside the
+transcript as <name>.voices.json, for 'vkm speakers import'.
+
+` + timestampsHelp + `
+
+` + engineHelp + `
+
+Examples:
+  vkm transcribe --input data/videos --output data/transcripts --model base
+  vkm transcribe --model small --language de
+  vkm transcribe --model medium --english-models=false
+  vkm transcribe --engine whisper.cpp --model large-v3
+  vkm transcribe --input data/podcasts --diarize --speakers 2
+  vkm transcribe --model small --timestamps word`,
 	RunE: runTranscribe,
 }
 
 var (
-	inputDir    string
-	transcriptOutputDir string
-	whisperModel string
-	language    string
-	device      string
+	inputDir               string
+	transcriptOutputDir    string
+	localWhisperModel      string
+	language               string
+	device                 string
+	transcribeEnglishModel bool
+	transcribeManifest     string
+	transcribeDiarize      bool
+	transcribeSpeakers     int
 )
 
 func init() {
 	TranscribeCmd.Flags().StringVar(&inputDir, "input", "data/videos", "Input directory with audio files")
 	TranscribeCmd.Flags().StringVar(&transcriptOutputDir, "output", "data/transcripts", "Output directory for transcripts")
-	TranscribeCmd.Flags().StringVar(&whisperModel, "model", "base", "Whisper model size (tiny, base, small, medium, large)")
-	TranscribeCmd.Flags().StringVar(&language, "language", "en", "Language code (default: en)")
+	TranscribeCmd.Flags().StringVar(&localWhisperModel, "model", "base", "Whisper model size (tiny, base, small, medium, large) or exact model name")
+	TranscribeCmd.Flags().StringVar(&language, "language", "", "Language code (default: detect per file)")
+	TranscribeCmd.Flags().StringVar(&transcribeEngine, "engine", engineOpenAIWhisper, "Transcription engine (openai-whisper, whisper.cpp)")
 	TranscribeCmd.Flags().StringVar(&device, "device", "cpu", "Device to use (cpu or cuda)")
+	TranscribeCmd.Flags().BoolVar(&transcribeEnglishModel, "english-models", true, "Use the English-only variant of --model for English audio")
+	TranscribeCmd.Flags().StringVar(&transcribeManifest, "manifest", "data/manifest.db", "SQLite manifest to record transcript models in")
+	TranscribeCmd.Flags().BoolVar(&transcribeDiarize, "diarize", false, "Label the speaker of each segment with a pyannote.audio diarization pass")
+	TranscribeCmd.Flags().IntVar(&transcribeSpeakers, "speakers", 0, "Number of speakers to diarize (with --diarize; 0 detects it)")
+	TranscribeCmd.Flags().StringVar(&timestampGranularity, "timestamps", timestampsSegment, "Timestamp granularity: segment, or word to also time each word")
 }
 
+// languageDetectModel and languageDetectClip are the model and audio
+// length used to detect a file's language before transcribing it
+const (
+	languageDetectModel = "tiny"
+	languageDetectClip  = 30 * time.Second
+)
+
+// englishOnlySizes are the model sizes with an English-only variant
+var englishOnlySizes = map[string]bool{"tiny": true, "base": true, "small": true, "medium": true}
+
 type TranscriptSegment struct {
 	Timestamp float64 `json:"timestamp"`
 	Text      string  `json:"text"`
 	Duration  float64 `json:"duration"`
+
+	// Page locates segments of documents ingested from PDFs
+	Page int `json:"page,omitempty"`
+
+	// Chapter is the title of the video chapter the segment starts in
+	Chapter string `json:"chapter,omitempty"`
+
+	// Speaker is the diarizer's label of who speaks, e.g. SPEAKER_00
+	Speaker string `json:"speaker,omitempty"`
+
+	// Words are timed with --timestamps word
+	Words []TranscriptWord `json:"words,omitempty"`
+
+	// Whisper's per-segment confidence signals, kept as accuracy proxies
+	AvgLogprob   float64 `json:"avg_logprob,omitempty"`
+	NoSpeechProb float64 `json:"no_speech_prob,omitempty"`
 }
 
 type Transcript struct {
-	VideoID    string               `json:"video_id"`
-	Title      string               `json:"title"`
+	VideoID     string              `json:"video_id"`
+	Title       string              `json:"title"`
 	PublishedAt string              `json:"published_at"`
+	Language    string              `json:"language,omitempty"`
 	Transcript  []TranscriptSegment `json:"transcript"`
+	Chapters    []Chapter           `json:"chapters,omitempty"`
+
+	// assemblyAI is AssemblyAI's sidecar output, saved beside the
+	// transcript rather than in it
+	assemblyAI *assemblyAISidecar
+
+	// audioConversion is how the audio was converted for transcription,
+	// recorded in the item's provenance
+	audioConversion string
 }
 
 func runTranscribe(cmd *cobra.Command, args []string) error {
@@ -60,14 +141,28 @@ func runTranscribe(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Check if whisper is installed
-	if err := checkWhisperInstalled(); err != nil {
+	// Check the engine is installed
+	if err := checkTranscribeEngine(transcribeEngine); err != nil {
+		return err
+	}
+	if err := checkTimestamps(transcribeEngine); err != nil {
 		return err
 	}
+	if transcribeDiarize {
+		if err := checkDiarizer(); err != nil {
+			return err
+		}
+	}
 
 	fmt.Printf("Transcribing files from: %s\n", inputDir)
 	fmt.Printf("Output directory: %s\n", transcriptOutputDir)
-	fmt.Printf("Whisper model: %s\n", whisperModel)
+	fmt.Printf("Whisper model: %s (%s)\n", localWhisperModel, transcribeEngine)
+
+	manifest, err := openManifest(transcribeManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
 
 	// Find all audio files
 	files, err := findAudioFiles(inputDir)
@@ -80,11 +175,29 @@ func runTranscribe(cmd *cobra.Command, args []string) error {
 	// Transcribe each file
 	for i, file := range files {
 		fmt.Printf("[%d/%d] Transcribing: %s\n", i+1, len(files), filepath.Base(file))
+		if item, err := manifest.ItemByAudioPath(file); err == nil && isImportedTranscript(item) {
+			fmt.Printf("  ✓ Transcript imported: %s\n\n", item.TranscriptPath)
+			continue
+		}
+
+		lang := language
+		if lang == "" {
+			lang = detectAudioLanguage(cmd.Context(), file)
+		}
+		model := localWhisperModelFor(localWhisperModel, lang)
+		fmt.Printf("  Language: %s, model: %s\n", orDefault(lang, "unknown"), model)
 
-		if err := transcribeFile(file, transcriptOutputDir); err != nil {
+		started := time.Now()
+		outputPath, err := transcribeFile(cmd.Context(), file, transcriptOutputDir, model, lang)
+		if err != nil {
+			if cmd.Context().Err() != nil {
+				return cmd.Context().Err()
+			}
 			fmt.Fprintf(os.Stderr, "Warning: Failed to transcribe %s: %v\n", file, err)
 			continue
 		}
+		recordTranscriptModel(manifest, file, outputPath, localTranscriptModel(transcribeEngine, model))
+		timeUsageStage(usageStageTranscribe, started)
 
 		fmt.Printf("✓ Completed\n\n")
 	}
@@ -94,9 +207,12 @@ func runTranscribe(cmd *cobra.Command, args []string) error {
 }
 
 func checkWhisperInstalled() error {
-	cmd := exec.Command("whisper", "--help")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("whisper not found - please install with: pip install openai-whisper")
+	path, err := findTool("whisper")
+	if err != nil {
+		return err
+	}
+	if err := exec.Command(path, "--help").Run(); err != nil {
+		return fmt.Errorf("whisper at %s failed to run: %w", path, err)
 	}
 	return nil
 }
@@ -122,81 +238,244 @@ func findAudioFiles(dir string) ([]string, error) {
 	return files, err
 }
 
-func transcribeFile(audioPath string, outputDir string) error {
-	// Get base name without extension
-	baseName := strings.TrimSuffix(filepath.Base(audioPath), filepath.Ext(audioPath))
-
-	// Output paths
-	tempOutputDir := filepath.Join(outputDir, "temp")
-	os.MkdirAll(tempOutputDir, 0755)
+// localWhisperModelFor returns the model to transcribe audio in lang with:
+// the English-only variant of model for English audio, when it has one
+// and --english-models is on, and model itself otherwise
+func localWhisperModelFor(model, lang string) string {
+	if transcribeEnglishModel && lang == "en" && englishOnlySizes[model] {
+		return model + ".en"
+	}
+	return model
+}
 
-	// Run whisper
-	args := []string{
-		audioPath,
-		"--model", whisperModel,
-		"--language", language,
-		"--output_format", "json",
-		"--output_dir", tempOutputDir,
-		"--device", device,
+// detectAudioLanguage returns the language of an audio file: the language
+// yt-dlp recorded in the .info.json beside it, or else the one the tiny
+// model detects in its first seconds. It returns "" when neither works,
+// leaving detection to the transcription itself.
+func detectAudioLanguage(ctx context.Context, audioPath string) string {
+	infoPath := infoPathFor(audioPath)
+	if info, err := loadVideoMetadata(infoPath); err == nil {
+		if lang, _ := info["language"].(string); lang != "" {
+			return normalizeLanguage(lang)
+		}
+	}
+	if transcribeEngine == engineWhisperCpp {
+		// The tiny model needs Python; whisper.cpp detects it instead
+		return ""
 	}
 
-	cmd := exec.Command("whisper", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	clip, err := trimAudio(ctx, audioPath, languageDetectClip)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  Warning: language detection failed: %v\n", err)
+		return ""
+	}
+	defer os.Remove(clip)
+	dir, err := newTempDir("language-")
+	if err != nil {
+		return ""
+	}
+	defer os.RemoveAll(dir)
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("whisper command failed: %w", err)
+	c := toolCommand(ctx, "whisper", toolPath(clip),
+		"--model", languageDetectModel,
+		"--output_format", "json",
+		"--output_dir", toolPath(dir),
+		"--device", device)
+	if out, err := c.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "  Warning: language detection failed: %v: %s\n", err, strings.TrimSpace(string(out)))
+		return ""
+	}
+	baseName := strings.TrimSuffix(filepath.Base(clip), filepath.Ext(clip))
+	data, err := os.ReadFile(filepath.Join(dir, baseName+".json"))
+	if err != nil {
+		return ""
 	}
+	var detected struct {
+		Language string `json:"language"`
+	}
+	json.Unmarshal(data, &detected)
+	return normalizeLanguage(detected.Language)
+}
 
-	// Parse whisper output
-	whisperOutputPath := filepath.Join(tempOutputDir, baseName+".json")
-	whisperOutput, err := os.ReadFile(whisperOutputPath)
+// normalizeLanguage reduces a language tag ("en-US", "EN") to the code
+// Whisper takes ("en")
+func normalizeLanguage(lang string) string {
+	lang, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(lang)), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	return lang
+}
+
+// recordTranscriptModel records in the manifest which model transcribed
+// an audio file, if the manifest tracks the file
+func recordTranscriptModel(m *Manifest, audioPath, transcriptPath, model string) {
+	item, err := m.ItemByAudioPath(audioPath)
 	if err != nil {
-		return fmt.Errorf("failed to read whisper output: %w", err)
+		fmt.Fprintf(os.Stderr, "  Warning: %v\n", err)
+		return
 	}
+	if item == nil {
+		return
+	}
+	state := item.State
+	if state == ItemPending || state == ItemDownloaded {
+		state = ItemTranscribed
+	}
+	recordItem(m, ManifestItem{URL: item.URL, State: state, TranscriptPath: transcriptPath, TranscriptModel: model})
+}
 
-	// Parse JSON
-	var whisperData struct {
-		Text     string `json:"text"`
-		Segments []struct {
-			Start float64 `json:"start"`
-			End   float64 `json:"end"`
-			Text  string  `json:"text"`
-		} `json:"segments"`
+// transcribeFile transcribes audioPath with the local --engine and saves
+// the transcript JSON in outputDir, returning its path. An empty lang
+// leaves language detection to the engine.
+func transcribeFile(ctx context.Context, audioPath, outputDir, model, lang string) (string, error) {
+	// Get base name without extension
+	baseName := strings.TrimSuffix(filepath.Base(audioPath), filepath.Ext(audioPath))
+	videoID := baseName
+	outputPath := filepath.Join(outputDir, baseName+".json")
+	if isPerVideoFile(audioPath, perVideoAudio) {
+		// Audio in the per-video layout is transcribed into its directory
+		videoID = filepath.Base(filepath.Dir(audioPath))
+		outputPath = filepath.Join(filepath.Dir(audioPath), perVideoTranscript+".json")
 	}
 
-	if err := json.Unmarshal(whisperOutput, &whisperData); err != nil {
-		return fmt.Errorf("failed to parse whisper output: %w", err)
+	run := runOpenAIWhisper
+	if transcribeEngine == engineWhisperCpp {
+		run = runWhisperCpp
+	}
+	whisperData, err := run(ctx, audioPath, outputDir, model, lang)
+	if err != nil {
+		return "", err
 	}
 
 	// Convert to our transcript format
 	transcript := Transcript{
-		VideoID: baseName,
-		Title:   baseName,
+		VideoID:    videoID,
+		Title:      videoID,
+		Language:   whisperData.Language,
 		Transcript: make([]TranscriptSegment, len(whisperData.Segments)),
 	}
 
 	for i, seg := range whisperData.Segments {
 		transcript.Transcript[i] = TranscriptSegment{
-			Timestamp: seg.Start,
-			Text:      strings.TrimSpace(seg.Text),
-			Duration:  seg.End - seg.Start,
+			Timestamp:    seg.Start,
+			Text:         strings.TrimSpace(seg.Text),
+			Duration:     seg.End - seg.Start,
+			AvgLogprob:   seg.AvgLogprob,
+			NoSpeechProb: seg.NoSpeechProb,
+			Words:        trimWords(seg.Words),
+		}
+	}
+
+	// Speakers are diarized on the audio's clock, before its timestamps
+	// are moved into the video
+	var speakers *diarization
+	if transcribeDiarize {
+		if speakers, err = diarizeTranscript(ctx, &transcript, audioPath, transcribeSpeakers); err != nil {
+			if ctx.Err() != nil {
+				return "", err
+			}
+			fmt.Fprintf(os.Stderr, "  Warning: %v; transcript has no speaker labels\n", err)
+		}
+	}
+
+	// Audio downloaded with SponsorBlock segments cut is shorter than its
+	// video; timestamps are moved to where they play in the video before
+	// segments are placed in the video's chapters
+	infoPath := infoPathFor(audioPath)
+	if info, err := loadVideoMetadata(infoPath); err == nil {
+		if removed := cutSegments(info); len(removed) > 0 {
+			transcript.moveTimes(func(at float64) float64 { return originalVideoTime(at, removed) })
 		}
+		assignChapters(&transcript, chaptersFromInfo(info))
 	}
 
 	// Save our transcript format
-	outputPath := filepath.Join(outputDir, baseName+".json")
 	data, err := json.MarshalIndent(transcript, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal transcript: %w", err)
+		return "", fmt.Errorf("failed to marshal transcript: %w", err)
 	}
 
 	if err := os.WriteFile(outputPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write transcript: %w", err)
+		return "", fmt.Errorf("failed to write transcript: %w", err)
+	}
+
+	if speakers != nil {
+		voicesPath, err := saveSpeakerVoices(speakers, outputPath, videoID, infoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  Warning: %v\n", err)
+		} else if voicesPath != "" {
+			fmt.Printf("  ✓ Voices: %s (register with 'vkm speakers import')\n", voicesPath)
+		}
+	}
+
+	return outputPath, nil
+}
+
+// localWhisperOutput is the JSON output of the whisper CLI, which local
+// engines are read into
+type localWhisperOutput struct {
+	Text     string                `json:"text"`
+	Language string                `json:"language"`
+	Segments []localWhisperSegment `json:"segments"`
+}
+
+type localWhisperSegment struct {
+	Start        float64 `json:"start"`
+	End          float64 `json:"end"`
+	Text         string  `json:"text"`
+	AvgLogprob   float64 `json:"avg_logprob"`
+	NoSpeechProb float64 `json:"no_speech_prob"`
+
+	// Words come with --word_timestamps
+	Words []TranscriptWord `json:"words,omitempty"`
+}
+
+// runOpenAIWhisper transcribes audioPath with the whisper CLI, through a
+// temp directory under outputDir
+func runOpenAIWhisper(ctx context.Context, audioPath, outputDir, model, lang string) (*localWhisperOutput, error) {
+	baseName := strings.TrimSuffix(filepath.Base(audioPath), filepath.Ext(audioPath))
+
+	// Output paths
+	tempOutputDir := filepath.Join(outputDir, "temp")
+	os.MkdirAll(tempOutputDir, 0755)
+
+	// Run whisper
+	args := []string{
+		toolPath(audioPath),
+		"--model", model,
+		"--output_format", "json",
+		"--output_dir", toolPath(tempOutputDir),
+		"--device", device,
+	}
+	if lang != "" {
+		args = append(args, "--language", lang)
+	}
+	if wordTimestamps() {
+		args = append(args, "--word_timestamps", "True")
+	}
+
+	cmd := toolCommand(ctx, "whisper", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("whisper command failed: %w", err)
+	}
+
+	// Parse whisper output
+	whisperOutputPath := filepath.Join(tempOutputDir, baseName+".json")
+	whisperOutput, err := os.ReadFile(whisperOutputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read whisper output: %w", err)
+	}
+
+	// Parse JSON
+	var whisperData localWhisperOutput
+	if err := json.Unmarshal(whisperOutput, &whisperData); err != nil {
+		return nil, fmt.Errorf("failed to parse whisper output: %w", err)
 	}
 
 	// Clean up temp file
 	os.Remove(whisperOutputPath)
 
-	return nil
+	return &whisperData, nil
 }
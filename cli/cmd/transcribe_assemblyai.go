@@ -0,0 +1,405 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// assemblyAIAPIURL is the root of AssemblyAI's v2 API
+var assemblyAIAPIURL = "https://api.assemblyai.com/v2"
+
+// assemblyAIPollInterval is how often a submitted transcription is checked
+var assemblyAIPollInterval = 3 * time.Second
+
+// assemblyAISidecarExt names the sidecar saved beside each AssemblyAI
+// transcript: <name>.assemblyai.json for transcript <name>.json
+const assemblyAISidecarExt = ".assemblyai.json"
+
+// assemblyAIHelp documents AssemblyAI for the commands using it
+const assemblyAIHelp = `AssemblyAI reads its API key from ASSEMBLYAI_API_KEY. Besides the
+transcript it returns auto-chapters (a headline, gist and summary per
+topic shift) and the entities it detects (people, organizations,
+locations, ...), saved beside the transcript as a sidecar,
+<name>` + assemblyAISidecarExt + `. Videos without chapter markers are split into
+its auto-chapters, so extraction goes topic by topic, and the patch
+metadata records the chapters and entities. Auto-chapters are only
+available for English audio.`
+
+var (
+	assemblyAIOutputDir     string
+	assemblyAISpeechModel   string
+	assemblyAILanguage      string
+	assemblyAISpeakerLabels bool
+	assemblyAIAutoChapters  bool
+	assemblyAIEntities      bool
+)
+
+// TranscribeAssemblyAICmd transcribes audio/video files with AssemblyAI
+var TranscribeAssemblyAICmd = &cobra.Command{
+	Use:   "transcribe-assemblyai [file...]",
+	Short: "Transcribe audio/video files using AssemblyAI, with auto-chapters and entities",
+	Long: `Transcribe audio or video files with AssemblyAI. Transcripts are saved as
+timed JSON (<output>/<name>.json), a segment per sentence; files with a
+yt-dlp .info.json beside them are timed in the original video and placed
+in its chapters.
+
+` + assemblyAIHelp + `
+
+Examples:
+  vkm transcribe-assemblyai data/videos/*.mp3
+  vkm transcribe-assemblyai interview.m4a --speaker-labels --no-entities`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runTranscribeAssemblyAI,
+}
+
+func init() {
+	TranscribeAssemblyAICmd.Flags().StringVarP(&assemblyAIOutputDir, "output", "o", "data/transcripts", "Output directory for transcripts")
+	TranscribeAssemblyAICmd.Flags().StringVarP(&assemblyAISpeechModel, "model", "m", "universal", "AssemblyAI speech model")
+	TranscribeAssemblyAICmd.Flags().StringVarP(&assemblyAILanguage, "language", "l", "", "Audio language (detected per file if not specified)")
+	TranscribeAssemblyAICmd.Flags().BoolVar(&assemblyAISpeakerLabels, "speaker-labels", false, "Label the speaker of each segment")
+	TranscribeAssemblyAICmd.Flags().BoolVar(&assemblyAIAutoChapters, "auto-chapters", true, "Detect chapters and summarize them")
+	TranscribeAssemblyAICmd.Flags().BoolVar(&assemblyAIEntities, "entities", true, "Detect named entities")
+}
+
+// assemblyAISidecar is the structured output AssemblyAI gives beside a
+// transcript, timed like its segments
+type assemblyAISidecar struct {
+	TranscriptID string           `json:"transcript_id"`
+	Chapters     []autoChapter    `json:"chapters"`
+	Entities     []detectedEntity `json:"entities"`
+}
+
+// autoChapter is a chapter AssemblyAI found by topic shifts
+type autoChapter struct {
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Headline string  `json:"headline"`
+	Gist     string  `json:"gist"`
+	Summary  string  `json:"summary"`
+}
+
+// detectedEntity is a named entity AssemblyAI found in the audio
+type detectedEntity struct {
+	Type  string  `json:"type"`
+	Text  string  `json:"text"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// transcriptChapters returns the auto-chapters as transcript chapters,
+// titled by their headlines
+func (s *assemblyAISidecar) transcriptChapters() []Chapter {
+	chapters := make([]Chapter, 0, len(s.Chapters))
+	for _, c := range s.Chapters {
+		chapters = append(chapters, Chapter{Title: c.Headline, Start: c.Start, End: c.End})
+	}
+	return chapters
+}
+
+// distinctEntities returns each entity once, at its first mention
+func (s *assemblyAISidecar) distinctEntities() []detectedEntity {
+	seen := make(map[string]bool)
+	var entities []detectedEntity
+	for _, e := range s.Entities {
+		key := e.Type + "\x00" + strings.ToLower(e.Text)
+		if !seen[key] {
+			seen[key] = true
+			entities = append(entities, e)
+		}
+	}
+	return entities
+}
+
+// assemblyAISidecarPath is where the sidecar of the transcript at
+// transcriptPath is saved
+func assemblyAISidecarPath(transcriptPath string) string {
+	return strings.TrimSuffix(transcriptPath, filepath.Ext(transcriptPath)) + assemblyAISidecarExt
+}
+
+// saveAssemblyAISidecar writes s beside the transcript at transcriptPath
+// and returns its path
+func saveAssemblyAISidecar(s *assemblyAISidecar, transcriptPath string) (string, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal sidecar: %w", err)
+	}
+	path := assemblyAISidecarPath(transcriptPath)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	return path, nil
+}
+
+func runTranscribeAssemblyAI(cmd *cobra.Command, args []string) error {
+	apiKey := os.Getenv("ASSEMBLYAI_API_KEY")
+	if apiKey == "" {
+		return fmt.Errorf("ASSEMBLYAI_API_KEY environment variable not set")
+	}
+	if err := os.MkdirAll(assemblyAIOutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	fmt.Printf("Transcribing %d file(s) with AssemblyAI %s...\n", len(args), assemblyAISpeechModel)
+
+	successCount := 0
+	for i, filePath := range args {
+		fmt.Printf("[%d/%d] Transcribing: %s\n", i+1, len(args), filePath)
+		started := time.Now()
+
+		t, sidecar, err := requestAssemblyAITranscription(cmd.Context(), filePath, apiKey)
+		if err != nil {
+			if cmd.Context().Err() != nil {
+				return cmd.Context().Err()
+			}
+			fmt.Fprintf(os.Stderr, "Error transcribing %s: %v\n", filePath, err)
+			continue
+		}
+		baseName := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+		t.VideoID, t.Title = baseName, baseName
+		placeAssemblyAIInVideo(t, sidecar, infoPathFor(filePath))
+
+		data, err := json.MarshalIndent(t, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal transcript: %w", err)
+		}
+		outputPath := filepath.Join(assemblyAIOutputDir, baseName+".json")
+		if err := os.WriteFile(outputPath, data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving transcript %s: %v\n", outputPath, err)
+			continue
+		}
+		sidecarPath, err := saveAssemblyAISidecar(sidecar, outputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving sidecar for %s: %v\n", outputPath, err)
+			continue
+		}
+
+		fmt.Printf("  ✓ Saved to: %s (%d segments)\n", outputPath, len(t.Transcript))
+		fmt.Printf("  ✓ Sidecar: %s (%d chapters, %d entities)\n", sidecarPath, len(sidecar.Chapters), len(sidecar.distinctEntities()))
+		timeUsageStage(usageStageTranscribe, started)
+		successCount++
+	}
+
+	fmt.Printf("\nCompleted: %d/%d transcriptions successful\n", successCount, len(args))
+	return nil
+}
+
+// placeAssemblyAIInVideo places t in its video like placeInVideo, and
+// times the sidecar's chapters and entities there too. Videos without
+// chapters of their own are split into the auto-chapters.
+func placeAssemblyAIInVideo(t *Transcript, s *assemblyAISidecar, infoPath string) {
+	if info, err := loadVideoMetadata(infoPath); err == nil {
+		if removed := cutSegments(info); len(removed) > 0 {
+			for i := range s.Chapters {
+				s.Chapters[i].Start = originalVideoTime(s.Chapters[i].Start, removed)
+				s.Chapters[i].End = originalVideoTime(s.Chapters[i].End, removed)
+			}
+			for i := range s.Entities {
+				s.Entities[i].Start = originalVideoTime(s.Entities[i].Start, removed)
+				s.Entities[i].End = originalVideoTime(s.Entities[i].End, removed)
+			}
+		}
+	}
+	placeInVideo(t, infoPath)
+	if len(t.Chapters) == 0 && len(s.Chapters) > 0 {
+		assignChapters(t, s.transcriptChapters())
+	}
+}
+
+// assemblyAITranscript is the part of AssemblyAI's transcript resource
+// transcripts and sidecars are made from. Times are in milliseconds.
+type assemblyAITranscript struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	Error        string `json:"error"`
+	LanguageCode string `json:"language_code"`
+	Text         string `json:"text"`
+	Chapters     []struct {
+		Start    int64  `json:"start"`
+		End      int64  `json:"end"`
+		Headline string `json:"headline"`
+		Gist     string `json:"gist"`
+		Summary  string `json:"summary"`
+	} `json:"chapters"`
+	Entities []struct {
+		EntityType string `json:"entity_type"`
+		Text       string `json:"text"`
+		Start      int64  `json:"start"`
+		End        int64  `json:"end"`
+	} `json:"entities"`
+}
+
+// requestAssemblyAITranscription uploads filePath to AssemblyAI, waits
+// for its transcription and returns the transcript, a segment per
+// sentence, with its sidecar
+func requestAssemblyAITranscription(ctx context.Context, filePath, apiKey string) (*Transcript, *assemblyAISidecar, error) {
+	audioURL, err := uploadToAssemblyAI(ctx, filePath, apiKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := map[string]interface{}{
+		"audio_url":        audioURL,
+		"speech_model":     assemblyAISpeechModel,
+		"punctuate":        true,
+		"format_text":      true,
+		"speaker_labels":   assemblyAISpeakerLabels,
+		"auto_chapters":    assemblyAIAutoChapters,
+		"entity_detection": assemblyAIEntities,
+	}
+	if assemblyAILanguage != "" {
+		req["language_code"] = assemblyAILanguage
+	} else {
+		req["language_detection"] = true
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	var submitted assemblyAITranscript
+	if err := callAssemblyAI(ctx, "POST", "/transcript", apiKey, bytes.NewReader(body), &submitted); err != nil {
+		return nil, nil, err
+	}
+
+	// Transcription runs asynchronously; poll until it is done
+	result := submitted
+	for result.Status != "completed" {
+		if result.Status == "error" {
+			return nil, nil, fmt.Errorf("AssemblyAI transcription failed: %s", result.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(assemblyAIPollInterval):
+		}
+		if err := callAssemblyAI(ctx, "GET", "/transcript/"+submitted.ID, apiKey, nil, &result); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var sentences struct {
+		Sentences []struct {
+			Text    string  `json:"text"`
+			Start   int64   `json:"start"`
+			End     int64   `json:"end"`
+			Speaker *string `json:"speaker"`
+			Words   []struct {
+				Text  string `json:"text"`
+				Start int64  `json:"start"`
+				End   int64  `json:"end"`
+			} `json:"words"`
+		} `json:"sentences"`
+	}
+	if err := callAssemblyAI(ctx, "GET", "/transcript/"+submitted.ID+"/sentences", apiKey, nil, &sentences); err != nil {
+		return nil, nil, err
+	}
+
+	lang := assemblyAILanguage
+	if lang == "" {
+		lang = normalizeLanguage(result.LanguageCode)
+	}
+	t := &Transcript{Language: lang}
+	for _, s := range sentences.Sentences {
+		seg := TranscriptSegment{
+			Timestamp: float64(s.Start) / 1000,
+			Text:      strings.TrimSpace(s.Text),
+			Duration:  float64(s.End-s.Start) / 1000,
+		}
+		// AssemblyAI labels speakers A, B, ...; they are numbered like
+		// the other diarizing transcribers' so the speakers registry
+		// matches them alike
+		if s.Speaker != nil && len(*s.Speaker) == 1 && (*s.Speaker)[0] >= 'A' && (*s.Speaker)[0] <= 'Z' {
+			seg.Speaker = fmt.Sprintf("SPEAKER_%02d", (*s.Speaker)[0]-'A')
+		}
+		if wordTimestamps() {
+			for _, w := range s.Words {
+				seg.Words = append(seg.Words, TranscriptWord{Word: w.Text, Start: float64(w.Start) / 1000, End: float64(w.End) / 1000})
+			}
+		}
+		t.Transcript = append(t.Transcript, seg)
+	}
+	if len(t.Transcript) == 0 {
+		t.Transcript = []TranscriptSegment{{Text: strings.TrimSpace(result.Text)}}
+	}
+
+	sidecar := &assemblyAISidecar{TranscriptID: result.ID}
+	for _, c := range result.Chapters {
+		sidecar.Chapters = append(sidecar.Chapters, autoChapter{
+			Start:    float64(c.Start) / 1000,
+			End:      float64(c.End) / 1000,
+			Headline: c.Headline,
+			Gist:     c.Gist,
+			Summary:  c.Summary,
+		})
+	}
+	for _, e := range result.Entities {
+		sidecar.Entities = append(sidecar.Entities, detectedEntity{
+			Type:  e.EntityType,
+			Text:  e.Text,
+			Start: float64(e.Start) / 1000,
+			End:   float64(e.End) / 1000,
+		})
+	}
+	return t, sidecar, nil
+}
+
+// uploadToAssemblyAI uploads filePath to AssemblyAI's storage and returns
+// the URL transcription requests refer to it by
+func uploadToAssemblyAI(ctx context.Context, filePath, apiKey string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	var uploaded struct {
+		UploadURL string `json:"upload_url"`
+	}
+	if err := callAssemblyAI(ctx, "POST", "/upload", apiKey, f, &uploaded); err != nil {
+		return "", err
+	}
+	return uploaded.UploadURL, nil
+}
+
+// callAssemblyAI sends a request to AssemblyAI's API and decodes its JSON
+// answer into out
+func callAssemblyAI(ctx context.Context, method, path, apiKey string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, assemblyAIAPIURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", apiKey)
+	if path == "/upload" {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("AssemblyAI API error (status %d): %s", resp.StatusCode, string(data))
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
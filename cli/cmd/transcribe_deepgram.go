@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultDeepgramConfig is where Deepgram settings are configured
+const defaultDeepgramConfig = "data/deepgram.yaml"
+
+// deepgramAPIURL is Deepgram's pre-recorded transcription endpoint
+var deepgramAPIURL = "https://api.deepgram.com/v1/listen"
+
+// deepgramHelp documents Deepgram settings for the commands using it
+const deepgramHelp = `Deepgram reads its API key from DEEPGRAM_API_KEY, else from the
+api_key of the Deepgram config (--deepgram-config, default
+` + defaultDeepgramConfig + `), which can also set its other options:
+
+  api_key: ...
+  model: nova-3        # Deepgram model
+  language: en         # detected per file when unset
+  diarize: true        # label each segment's speaker (SPEAKER_00, ...)
+  smart_format: true   # punctuation, numerals, dates and the like
+
+Segments follow Deepgram's utterances, so with diarization each one is a
+single speaker's turn.`
+
+var (
+	deepgramConfigPath  = defaultDeepgramConfig
+	deepgramOutputDir   string
+	deepgramModel       string
+	deepgramLanguage    string
+	deepgramDiarize     bool
+	deepgramSmartFormat bool
+)
+
+// TranscribeDeepgramCmd transcribes audio/video files with Deepgram
+var TranscribeDeepgramCmd = &cobra.Command{
+	Use:   "transcribe-deepgram [file...]",
+	Short: "Transcribe audio/video files using the Deepgram API",
+	Long: `Transcribe audio or video files with Deepgram's pre-recorded API, which
+costs much less than the Whisper API for long audio and takes files of
+any length without chunking. Transcripts are saved as timed JSON
+(<output>/<name>.json); files with a yt-dlp .info.json beside them are
+timed in the original video and placed in its chapters.
+
+` + deepgramHelp + `
+
+Flags override the config file.
+
+Examples:
+  vkm transcribe-deepgram data/videos/*.mp3
+  vkm transcribe-deepgram interview.m4a --diarize --language de`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runTranscribeDeepgram,
+}
+
+func init() {
+	TranscribeDeepgramCmd.Flags().StringVarP(&deepgramOutputDir, "output", "o", "data/transcripts", "Output directory for transcripts")
+	TranscribeDeepgramCmd.Flags().StringVar(&deepgramConfigPath, "deepgram-config", defaultDeepgramConfig, "YAML file of Deepgram settings")
+	TranscribeDeepgramCmd.Flags().StringVarP(&deepgramModel, "model", "m", "nova-3", "Deepgram model")
+	TranscribeDeepgramCmd.Flags().StringVarP(&deepgramLanguage, "language", "l", "", "Audio language (detected per file if not specified)")
+	TranscribeDeepgramCmd.Flags().BoolVar(&deepgramDiarize, "diarize", false, "Label the speaker of each segment")
+	TranscribeDeepgramCmd.Flags().BoolVar(&deepgramSmartFormat, "smart-format", true, "Format punctuation, numerals and dates")
+}
+
+// deepgramSettings are the key and options Deepgram requests are made with
+type deepgramSettings struct {
+	APIKey      string `yaml:"api_key"`
+	Model       string `yaml:"model"`
+	Language    string `yaml:"language"`
+	Diarize     *bool  `yaml:"diarize"`
+	SmartFormat *bool  `yaml:"smart_format"`
+}
+
+// loadDeepgramSettings reads the Deepgram config at path (a missing file
+// sets nothing), applies the flags of cmd given explicitly (cmd may be
+// nil) and DEEPGRAM_API_KEY, and fills in defaults
+func loadDeepgramSettings(path string, cmd *cobra.Command) (*deepgramSettings, error) {
+	s := &deepgramSettings{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read Deepgram config: %w", err)
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("failed to parse Deepgram config %s: %w", path, err)
+		}
+	}
+
+	changed := func(name string) bool { return cmd != nil && cmd.Flags().Changed(name) }
+	if changed("model") || s.Model == "" {
+		s.Model = deepgramModel
+	}
+	if changed("language") || s.Language == "" {
+		s.Language = deepgramLanguage
+	}
+	if changed("diarize") || s.Diarize == nil {
+		s.Diarize = &deepgramDiarize
+	}
+	if changed("smart-format") || s.SmartFormat == nil {
+		s.SmartFormat = &deepgramSmartFormat
+	}
+	if key := os.Getenv("DEEPGRAM_API_KEY"); key != "" {
+		s.APIKey = key
+	}
+	if s.APIKey == "" {
+		return nil, fmt.Errorf("DEEPGRAM_API_KEY environment variable not set (or api_key in %s)", path)
+	}
+	return s, nil
+}
+
+func runTranscribeDeepgram(cmd *cobra.Command, args []string) error {
+	settings, err := loadDeepgramSettings(deepgramConfigPath, cmd)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(deepgramOutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	fmt.Printf("Transcribing %d file(s) with Deepgram %s...\n", len(args), settings.Model)
+
+	successCount := 0
+	for i, filePath := range args {
+		fmt.Printf("[%d/%d] Transcribing: %s\n", i+1, len(args), filePath)
+		started := time.Now()
+
+		t, err := requestDeepgramTranscription(cmd.Context(), filePath, settings)
+		if err != nil {
+			if cmd.Context().Err() != nil {
+				return cmd.Context().Err()
+			}
+			fmt.Fprintf(os.Stderr, "Error transcribing %s: %v\n", filePath, err)
+			continue
+		}
+		baseName := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+		t.VideoID, t.Title = baseName, baseName
+		placeInVideo(t, infoPathFor(filePath))
+
+		data, err := json.MarshalIndent(t, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal transcript: %w", err)
+		}
+		outputPath := filepath.Join(deepgramOutputDir, baseName+".json")
+		if err := os.WriteFile(outputPath, data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving transcript %s: %v\n", outputPath, err)
+			continue
+		}
+
+		fmt.Printf("  ✓ Saved to: %s (%d segments)\n", outputPath, len(t.Transcript))
+		timeUsageStage(usageStageTranscribe, started)
+		successCount++
+	}
+
+	fmt.Printf("\nCompleted: %d/%d transcriptions successful\n", successCount, len(args))
+	return nil
+}
+
+// deepgramResponse is the part of Deepgram's answer transcripts are made
+// from
+type deepgramResponse struct {
+	Results struct {
+		Channels []struct {
+			DetectedLanguage string `json:"detected_language"`
+			Alternatives     []struct {
+				Transcript string `json:"transcript"`
+			} `json:"alternatives"`
+		} `json:"channels"`
+		Utterances []struct {
+			Start      float64 `json:"start"`
+			End        float64 `json:"end"`
+			Transcript string  `json:"transcript"`
+			Speaker    *int    `json:"speaker"`
+			Words      []struct {
+				Word           string  `json:"word"`
+				PunctuatedWord string  `json:"punctuated_word"`
+				Start          float64 `json:"start"`
+				End            float64 `json:"end"`
+			} `json:"words"`
+		} `json:"utterances"`
+	} `json:"results"`
+}
+
+// requestDeepgramTranscription sends filePath to Deepgram and returns its
+// transcript, with a segment per utterance
+func requestDeepgramTranscription(ctx context.Context, filePath string, s *deepgramSettings) (*Transcript, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	query := url.Values{}
+	query.Set("model", s.Model)
+	query.Set("utterances", "true")
+	query.Set("punctuate", "true")
+	query.Set("smart_format", strconv.FormatBool(*s.SmartFormat))
+	query.Set("diarize", strconv.FormatBool(*s.Diarize))
+	if s.Language != "" {
+		query.Set("language", s.Language)
+	} else {
+		query.Set("detect_language", "true")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", deepgramAPIURL+"?"+query.Encode(), f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(filePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Authorization", "Token "+s.APIKey)
+	req.Header.Set("Content-Type", contentType)
+
+	client := &http.Client{Timeout: 30 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Deepgram API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var dg deepgramResponse
+	if err := json.Unmarshal(body, &dg); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return deepgramTranscript(&dg, s.Language), nil
+}
+
+// deepgramTranscript converts a Deepgram answer to a transcript: a
+// segment per utterance, labeled with its speaker when diarized, with
+// its words with --timestamps word
+func deepgramTranscript(dg *deepgramResponse, lang string) *Transcript {
+	t := &Transcript{Language: lang}
+	if len(dg.Results.Channels) > 0 && t.Language == "" {
+		t.Language = normalizeLanguage(dg.Results.Channels[0].DetectedLanguage)
+	}
+	for _, u := range dg.Results.Utterances {
+		seg := TranscriptSegment{
+			Timestamp: u.Start,
+			Text:      strings.TrimSpace(u.Transcript),
+			Duration:  u.End - u.Start,
+		}
+		if u.Speaker != nil {
+			seg.Speaker = fmt.Sprintf("SPEAKER_%02d", *u.Speaker)
+		}
+		if wordTimestamps() {
+			for _, w := range u.Words {
+				seg.Words = append(seg.Words, TranscriptWord{Word: orDefault(w.PunctuatedWord, w.Word), Start: w.Start, End: w.End})
+			}
+		}
+		t.Transcript = append(t.Transcript, seg)
+	}
+	if len(t.Transcript) == 0 && len(dg.Results.Channels) > 0 && len(dg.Results.Channels[0].Alternatives) > 0 {
+		t.Transcript = []TranscriptSegment{{Text: strings.TrimSpace(dg.Results.Channels[0].Alternatives[0].Transcript)}}
+	}
+	return t
+}
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -10,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -19,6 +22,7 @@ var (
 	transcribeOutputDir string
 	whisperModel        string
 	whisperLanguage     string
+	transcribePreview   time.Duration
 )
 
 // TranscribeWhisperCmd transcribes audio/video files using OpenAI Whisper API
@@ -31,10 +35,43 @@ Requires OPENAI_API_KEY environment variable to be set.
 
 Supported formats: mp3, mp4, mpeg, mpga, m4a, wav, webm
 
+Each file's transcript is saved twice in --output: as plain text
+(<name>.txt) and as timed JSON (<name>.json) with a segment per stretch
+of speech, its start and duration in seconds, so facts can link back to
+the moment in the video they come from. Models without timestamps
+(anything but whisper-1) give the JSON a single untimed segment. Files
+with a yt-dlp .info.json beside them are timed in the original video and
+placed in its chapters, as 'vkm transcribe' does.
+
+` + timestampsHelp + `
+
+Completed transcriptions are cached (under $VKM_CACHE_DIR/whisper, else
+the user cache directory), so a file or chunk transcribed once with the
+same model and language is never sent again.
+
+Requests are resent only when the API provably did not transcribe them
+(the upload broke off, or it answered 429 or 5xx); a request that times
+out after the upload finished is reported rather than resent, since it
+may have been billed.
+
+Files over the API's 25MB limit are split with ffmpeg into chunks of up
+to an hour, re-encoded small enough to upload, each running 10 seconds
+into the next so no word is lost at a cut. The chunks' transcripts are
+stitched back together with the repeated speech removed.
+
+` + whisperRateLimitHelp + `
+
 Examples:
   vkm-cli transcribe-whisper video.mp4
   vkm-cli transcribe-whisper *.mp3 --output transcripts/
-  vkm-cli transcribe-whisper audio.mp3 --model whisper-1 --language en`,
+  vkm-cli transcribe-whisper audio.mp3 --model whisper-1 --language en
+  vkm-cli transcribe-whisper data/videos/*.mp3 -j 4 --rpm 500
+
+Preview mode (--preview 5m) transcribes only the first N minutes of each
+file (trimmed with ffmpeg), extracts facts with a smaller Claude model
+(CLAUDE_API_KEY) and ranks the files by fact density, so a large archive
+can be triaged before paying for full processing:
+  vkm-cli transcribe-whisper data/videos/*.mp3 --preview 5m`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: runTranscribeWhisper,
 }
@@ -43,47 +80,154 @@ func init() {
 	TranscribeWhisperCmd.Flags().StringVarP(&transcribeOutputDir, "output", "o", "data/transcripts", "Output directory for transcripts")
 	TranscribeWhisperCmd.Flags().StringVarP(&whisperModel, "model", "m", "whisper-1", "Whisper model to use")
 	TranscribeWhisperCmd.Flags().StringVarP(&whisperLanguage, "language", "l", "", "Audio language (optional, auto-detected if not specified)")
+	TranscribeWhisperCmd.Flags().DurationVar(&transcribePreview, "preview", 0, "Only transcribe the first N minutes (e.g. 5m) and rank files by extracted facts")
+	TranscribeWhisperCmd.Flags().StringVar(&timestampGranularity, "timestamps", timestampsSegment, "Timestamp granularity: segment, or word to also time each word")
+	TranscribeWhisperCmd.Flags().IntVarP(&whisperConcurrency, "concurrency", "j", 1, "Number of files to transcribe in parallel")
+	TranscribeWhisperCmd.Flags().IntVar(&whisperRPM, "rpm", 50, "Whisper API requests per minute to stay within (0 for no limit)")
+	TranscribeWhisperCmd.Flags().IntVar(&whisperTPM, "tpm", 0, "Audio tokens per minute to stay within, for token-billed models (0 for no limit)")
 }
 
 type WhisperResponse struct {
 	Text string `json:"text"`
+
+	// Language and Segments come with the verbose_json format
+	Language string           `json:"language,omitempty"`
+	Segments []whisperSegment `json:"segments,omitempty"`
+
+	// Words come with word timestamp granularity
+	Words []TranscriptWord `json:"words,omitempty"`
+
+	// conversion is how the audio was converted for the API, if it was
+	conversion string
+}
+
+type whisperSegment struct {
+	Start        float64 `json:"start"`
+	End          float64 `json:"end"`
+	Text         string  `json:"text"`
+	AvgLogprob   float64 `json:"avg_logprob,omitempty"`
+	NoSpeechProb float64 `json:"no_speech_prob,omitempty"`
+
+	// Words are timed per segment by the local whisper CLI
+	Words []TranscriptWord `json:"words,omitempty"`
+}
+
+// transcript converts a response into a Transcript with a segment per
+// timed segment, and timed words in the segments they are spoken in.
+// Responses without timestamps give a single untimed segment of the whole
+// text.
+func (r *WhisperResponse) transcript() *Transcript {
+	t := &Transcript{Language: r.Language, audioConversion: r.conversion}
+	for _, seg := range r.Segments {
+		t.Transcript = append(t.Transcript, TranscriptSegment{
+			Timestamp:    seg.Start,
+			Text:         strings.TrimSpace(seg.Text),
+			Duration:     seg.End - seg.Start,
+			AvgLogprob:   seg.AvgLogprob,
+			NoSpeechProb: seg.NoSpeechProb,
+			Words:        trimWords(seg.Words),
+		})
+	}
+	if len(t.Transcript) == 0 {
+		t.Transcript = []TranscriptSegment{{Text: strings.TrimSpace(r.Text)}}
+	}
+	assignWords(t, trimWords(r.Words))
+	return t
 }
 
+// whisperAPIURL is the OpenAI transcription endpoint; 'vkm selftest'
+// points it at a mock
+var whisperAPIURL = "https://api.openai.com/v1/audio/transcriptions"
+
+// whisperTimestampModels are the API models whose verbose_json responses
+// carry timestamped segments
+var whisperTimestampModels = map[string]bool{"whisper-1": true}
+
 func runTranscribeWhisper(cmd *cobra.Command, args []string) error {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
 		return fmt.Errorf("OPENAI_API_KEY environment variable not set")
 	}
+	if err := checkTimestamps(transcriberAPI); err != nil {
+		return err
+	}
 
 	// Create output directory
 	if err := os.MkdirAll(transcribeOutputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	fmt.Printf("Transcribing %d file(s)...\n", len(args))
+	if transcribePreview > 0 {
+		return runWhisperPreview(cmd, args, apiKey)
+	}
 
-	successCount := 0
-	for i, filePath := range args {
-		fmt.Printf("[%d/%d] Transcribing: %s\n", i+1, len(args), filePath)
+	if whisperConcurrency < 1 {
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+	whisperLimiter = newWhisperRateLimiter(whisperRPM, whisperTPM)
+	defer func() { whisperLimiter = nil }()
+
+	ctx := cmd.Context()
+	workers := min(whisperConcurrency, len(args))
+	fmt.Printf("Transcribing %d file(s)...\n", len(args))
 
-		transcript, err := transcribeWithWhisper(filePath, apiKey)
+	var (
+		mu           sync.Mutex
+		finished     int
+		successCount int
+	)
+	report := func(filePath string, saved *whisperSaved, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		finished++
+		prefix := "  "
+		if workers > 1 {
+			prefix = fmt.Sprintf("[%d/%d] ", finished, len(args))
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error transcribing %s: %v\n", filePath, err)
-			continue
+			fmt.Fprintf(os.Stderr, "%sError transcribing %s: %v\n", prefix, filePath, err)
+			return
 		}
+		fmt.Printf("%s✓ Saved to: %s (%d segments in %s)\n", prefix, saved.textPath, saved.segments, filepath.Base(saved.jsonPath))
+		successCount++
+	}
 
-		// Save transcript
-		baseName := filepath.Base(filePath)
-		outputName := strings.TrimSuffix(baseName, filepath.Ext(baseName)) + ".txt"
-		outputPath := filepath.Join(transcribeOutputDir, outputName)
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for filePath := range queue {
+				started := time.Now()
+				saved, err := transcribeWhisperFile(ctx, filePath, apiKey)
+				if ctx.Err() != nil {
+					return
+				}
+				if err == nil {
+					timeUsageStage(usageStageTranscribe, started)
+				}
+				report(filePath, saved, err)
+			}
+		}()
+	}
 
-		if err := os.WriteFile(outputPath, []byte(transcript), 0644); err != nil {
-			fmt.Fprintf(os.Stderr, "Error saving transcript %s: %v\n", outputPath, err)
-			continue
+feed:
+	for i, filePath := range args {
+		if workers == 1 {
+			fmt.Printf("[%d/%d] Transcribing: %s\n", i+1, len(args), filePath)
 		}
+		select {
+		case queue <- filePath:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
 
-		fmt.Printf("  ✓ Saved to: %s\n", outputPath)
-		successCount++
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
 
 	fmt.Printf("\nCompleted: %d/%d transcriptions successful\n", successCount, len(args))
@@ -91,22 +235,193 @@ func runTranscribeWhisper(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func transcribeWithWhisper(filePath, apiKey string) (string, error) {
+// whisperSaved is where transcribeWhisperFile saved a transcript
+type whisperSaved struct {
+	textPath, jsonPath string
+	segments           int
+}
+
+// transcribeWhisperFile transcribes filePath with the Whisper API and
+// saves its text and timed transcript in --output
+func transcribeWhisperFile(ctx context.Context, filePath, apiKey string) (*whisperSaved, error) {
+	resp, err := requestWhisperTranscription(ctx, filePath, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save the text, and the timed transcript beside it
+	baseName := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	textPath := filepath.Join(transcribeOutputDir, baseName+".txt")
+	if err := os.WriteFile(textPath, []byte(resp.Text), 0644); err != nil {
+		return nil, fmt.Errorf("failed to save transcript %s: %w", textPath, err)
+	}
+
+	t := resp.transcript()
+	t.VideoID, t.Title = baseName, baseName
+	if len(resp.Segments) > 0 {
+		placeInVideo(t, infoPathFor(filePath))
+	}
+	jsonPath := filepath.Join(transcribeOutputDir, baseName+".json")
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err == nil {
+		err = os.WriteFile(jsonPath, data, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save transcript %s: %w", jsonPath, err)
+	}
+	return &whisperSaved{textPath: textPath, jsonPath: jsonPath, segments: len(t.Transcript)}, nil
+}
+
+func transcribeWithWhisper(ctx context.Context, filePath, apiKey string) (string, error) {
+	resp, err := requestWhisperTranscription(ctx, filePath, apiKey)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// whisperMaxUploadBytes is the largest file the Whisper API accepts
+const whisperMaxUploadBytes = 25 * 1024 * 1024
+
+// requestWhisperTranscription sends filePath to the OpenAI transcription
+// API, asking for timestamped segments when the model provides them.
+// Files over the API's upload limit are transcribed in chunks. A file
+// transcribed before with the same settings is answered from
+// whisperCacheDir. Audio in a format the API doesn't take, or that it
+// refuses to decode, is converted first (see whisperUploadAudio).
+func requestWhisperTranscription(ctx context.Context, filePath, apiKey string) (*WhisperResponse, error) {
+	if fi, err := os.Stat(filePath); err == nil && fi.Size() > whisperMaxUploadBytes {
+		fmt.Printf("  %s is over the API's 25MB limit (%s); transcribing it in chunks\n", filepath.Base(filePath), formatBytes(fi.Size()))
+		return transcribeInChunks(ctx, filePath, apiKey, defaultChunkLength)
+	}
+	dir, err := newTempDir("whisper-audio-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	upload, conversion, err := whisperUploadAudio(ctx, filePath, dir, false)
+	if err != nil {
+		return nil, err
+	}
+	key, err := whisperFileKey(upload)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := requestWhisperResumable(ctx, upload, apiKey, key)
+	if errors.Is(err, errWhisperFormat) && !strings.Contains(conversion, "ffmpeg") {
+		fmt.Fprintf(os.Stderr, "  Warning: the Whisper API could not decode %s; converting it\n", filepath.Base(filePath))
+		if upload, conversion, err = whisperUploadAudio(ctx, filePath, dir, true); err != nil {
+			return nil, err
+		}
+		if key, err = whisperFileKey(upload); err != nil {
+			return nil, err
+		}
+		resp, err = requestWhisperResumable(ctx, upload, apiKey, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.conversion = conversion
+	return resp, nil
+}
+
+// whisperResponseFormat is the response format asked of whisperModel
+func whisperResponseFormat() string {
+	if whisperTimestampModels[whisperModel] {
+		return "verbose_json"
+	}
+	return "json"
+}
+
+// whisperWordTimestamps reports whether words are timed by whisperModel,
+// as --timestamps word asks
+func whisperWordTimestamps() bool {
+	return wordTimestamps() && whisperTimestampModels[whisperModel]
+}
+
+// requestWhisperResumable transcribes filePath as the request identified
+// by key. A completed response is cached before it is used, and reused
+// instead of resending the audio. The API has no way to fetch a result
+// whose response was lost, so only requests that provably were not
+// transcribed are resent; one that timed out after the upload finished
+// is reported instead, as resending it may be billed twice.
+func requestWhisperResumable(ctx context.Context, filePath, apiKey, key string) (*WhisperResponse, error) {
+	if cached := cachedWhisperResponse(key); cached != nil {
+		var whisperResp WhisperResponse
+		if err := json.Unmarshal(cached, &whisperResp); err == nil {
+			fmt.Printf("  Reusing the earlier transcription of %s\n", filepath.Base(filePath))
+			return &whisperResp, nil
+		}
+	}
+
+	reqBody, contentType, err := whisperRequestBody(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var respBody []byte
+	delay := whisperRetryDelay
+	for attempt := 1; ; attempt++ {
+		if err = whisperLimiter.wait(ctx, filePath); err != nil {
+			break
+		}
+		respBody, err = postWhisper(ctx, reqBody, contentType, apiKey, key)
+		attempts := whisperAttempts
+		var limited *errWhisperRateLimited
+		if errors.As(err, &limited) {
+			attempts = whisperRateLimitAttempts
+		}
+		if err == nil || ctx.Err() != nil || !errors.Is(err, errWhisperNotSent) || attempt >= attempts {
+			break
+		}
+		wait := whisperRateLimitDelay(err, delay)
+		if limited != nil {
+			whisperLimiter.pause(wait)
+		}
+		fmt.Fprintf(os.Stderr, "  Warning: %s: %v; retrying in %s (attempt %d/%d)\n", filepath.Base(filePath), err, wait.Round(time.Second), attempt+1, attempts)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		delay = min(delay*2, time.Minute)
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("transcription canceled: %w", ctx.Err())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var whisperResp WhisperResponse
+	if err := json.Unmarshal(respBody, &whisperResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	storeWhisperResponse(key, respBody)
+
+	return &whisperResp, nil
+}
+
+// whisperRequestBody builds the multipart form transcribing filePath,
+// returning it with its content type
+func whisperRequestBody(filePath string) ([]byte, string, error) {
 	// Open the file
 	file, err := os.Open(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
+		return nil, "", fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
 	// Check file size (Whisper has 25MB limit)
 	fileInfo, err := file.Stat()
 	if err != nil {
-		return "", fmt.Errorf("failed to stat file: %w", err)
+		return nil, "", fmt.Errorf("failed to stat file: %w", err)
 	}
-	const maxSize = 25 * 1024 * 1024 // 25MB
-	if fileInfo.Size() > maxSize {
-		return "", fmt.Errorf("file size %d bytes exceeds Whisper API limit of 25MB", fileInfo.Size())
+	if fileInfo.Size() > whisperMaxUploadBytes {
+		return nil, "", fmt.Errorf("file size %d bytes exceeds Whisper API limit of 25MB", fileInfo.Size())
 	}
 
 	// Create multipart form
@@ -116,68 +431,106 @@ func transcribeWithWhisper(filePath, apiKey string) (string, error) {
 	// Add file
 	part, err := writer.CreateFormFile("file", filepath.Base(filePath))
 	if err != nil {
-		return "", fmt.Errorf("failed to create form file: %w", err)
+		return nil, "", fmt.Errorf("failed to create form file: %w", err)
 	}
 	if _, err := io.Copy(part, file); err != nil {
-		return "", fmt.Errorf("failed to copy file: %w", err)
+		return nil, "", fmt.Errorf("failed to copy file: %w", err)
 	}
 
 	// Add model
 	if err := writer.WriteField("model", whisperModel); err != nil {
-		return "", fmt.Errorf("failed to write model field: %w", err)
+		return nil, "", fmt.Errorf("failed to write model field: %w", err)
 	}
 
 	// Add language if specified
 	if whisperLanguage != "" {
 		if err := writer.WriteField("language", whisperLanguage); err != nil {
-			return "", fmt.Errorf("failed to write language field: %w", err)
+			return nil, "", fmt.Errorf("failed to write language field: %w", err)
 		}
 	}
 
 	// Add response format
-	if err := writer.WriteField("response_format", "json"); err != nil {
-		return "", fmt.Errorf("failed to write response_format field: %w", err)
+	if err := writer.WriteField("response_format", whisperResponseFormat()); err != nil {
+		return nil, "", fmt.Errorf("failed to write response_format field: %w", err)
+	}
+	if whisperWordTimestamps() {
+		for _, g := range []string{"segment", "word"} {
+			if err := writer.WriteField("timestamp_granularities[]", g); err != nil {
+				return nil, "", fmt.Errorf("failed to write timestamp_granularities field: %w", err)
+			}
+		}
 	}
 
 	if err := writer.Close(); err != nil {
-		return "", fmt.Errorf("failed to close writer: %w", err)
+		return nil, "", fmt.Errorf("failed to close writer: %w", err)
 	}
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
 
-	// Create HTTP request
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/audio/transcriptions", &body)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+// whisperHTTPClient returns a client for Whisper requests that waits up
+// to timeout for an answer. Whisper can take a while once it has the
+// audio; the wait starts when the upload is done, so slow connections
+// don't eat into it. The client goes through the default transport's
+// proxy and sends the configured identity, as other requests do.
+func whisperHTTPClient(timeout time.Duration) *http.Client {
+	next := http.DefaultTransport
+	identity, wrapped := next.(*identityTransport)
+	if wrapped {
+		next = identity.next
 	}
+	transport, ok := next.(*http.Transport)
+	if !ok {
+		// Not a transport the timeout can be set on; bound the whole request
+		return &http.Client{Transport: http.DefaultTransport, Timeout: timeout}
+	}
+	transport = transport.Clone()
+	transport.ResponseHeaderTimeout = timeout
+	if wrapped {
+		return &http.Client{Transport: &identityTransport{next: transport}}
+	}
+	return &http.Client{Transport: transport}
+}
 
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	// Send request with timeout
-	client := &http.Client{
-		Timeout: 5 * time.Minute, // Whisper can take a while
+// postWhisper makes one transcription request, tagged with key so it can
+// be traced in OpenAI's logs. Failures that are safe to retry wrap
+// errWhisperNotSent.
+func postWhisper(ctx context.Context, reqBody []byte, contentType, apiKey, key string) ([]byte, error) {
+	body := &uploadBody{r: bytes.NewReader(reqBody)}
+	req, err := http.NewRequestWithContext(ctx, "POST", whisperAPIURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	req.ContentLength = int64(len(reqBody))
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Client-Request-Id", "vkm-"+key[:32])
 
-	resp, err := client.Do(req)
+	resp, err := whisperHTTPClient(whisperResponseTimeout).Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		if sent := body.Sent(); sent < int64(len(reqBody)) {
+			return nil, fmt.Errorf("%w: upload broke off after %d of %d bytes: %v", errWhisperNotSent, sent, len(reqBody), err)
+		}
+		// The audio arrived and may have been transcribed and billed
+		return nil, fmt.Errorf("no response after uploading the audio (it may have been transcribed and billed; not resent automatically): %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return respBody, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, &errWhisperRateLimited{retryAfter: whisperRetryAfter(resp.Header), requestID: resp.Header.Get("X-Request-Id")}
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("%w: API unavailable (status %d, request %s)", errWhisperNotSent, resp.StatusCode, resp.Header.Get("X-Request-Id"))
+	case resp.StatusCode == http.StatusBadRequest && whisperFormatRejected(respBody):
+		return nil, fmt.Errorf("%w (status 400): %s", errWhisperFormat, string(respBody))
+	default:
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
 	}
-
-	// Parse response
-	var whisperResp WhisperResponse
-	if err := json.Unmarshal(respBody, &whisperResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	return whisperResp.Text, nil
 }
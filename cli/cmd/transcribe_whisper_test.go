@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWhisperHTTPClientWithIdentity(t *testing.T) {
+	transport, agent, agentSet, id := http.DefaultTransport, userAgent, userAgentSet, clientID
+	t.Cleanup(func() {
+		http.DefaultTransport, userAgent, userAgentSet, clientID = transport, agent, agentSet, id
+	})
+	if err := SetIdentity("vkm-test", "test-client"); err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.Header.Get("User-Agent") != "vkm-test" || r.Header.Get(clientIDHeader) != "test-client" {
+			t.Errorf("request sent without the identity: User-Agent %q, %s %q",
+				r.Header.Get("User-Agent"), clientIDHeader, r.Header.Get(clientIDHeader))
+		}
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := whisperHTTPClient(100 * time.Millisecond)
+	if _, ok := client.Transport.(*identityTransport); !ok {
+		t.Fatalf("client transport is %T, want *identityTransport", client.Transport)
+	}
+
+	resp, err := client.Post(server.URL+"/fast", "text/plain", strings.NewReader("audio"))
+	if err != nil {
+		t.Fatalf("fast answer: %v", err)
+	}
+	resp.Body.Close()
+
+	start := time.Now()
+	_, err = client.Post(server.URL+"/slow", "text/plain", strings.NewReader("audio"))
+	if err == nil {
+		t.Fatal("slow answer: want a timeout, got none")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("slow answer timed out after %s, want about 100ms", elapsed)
+	}
+}
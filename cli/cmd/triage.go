@@ -0,0 +1,524 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// TriageCmd ranks videos by relevance before running the full pipeline
+var TriageCmd = &cobra.Command{
+	Use:   "triage [url-or-file...]",
+	Short: "Rank videos by keyword relevance to plan ingestion",
+	Long: `Score videos against a set of keywords using cheap transcripts, and
+produce an ordered ingestion plan for the expensive full pipeline.
+
+Transcripts come from YouTube captions (manual or automatic) fetched with
+yt-dlp. Videos without captions are transcribed locally with a tiny Whisper
+model when whisper is installed. Local audio files and existing .txt/.json
+transcripts are accepted too. Playlist URLs are expanded.
+
+Each keyword (or phrase) is counted case-insensitively; the score sums
+log(1 + hits per 1000 words) over keywords and adds the fraction of
+keywords that appear at all. With --embeddings, the cosine similarity
+between the keywords and the best-matching transcript chunk (OpenAI
+text-embedding-3-small, OPENAI_API_KEY) is added as well, catching videos
+that discuss a topic without naming it.
+
+Examples:
+  vkm triage --keywords "category theory,sheaf" https://youtube.com/playlist?list=PLxxx
+  vkm triage --keywords "scaling laws" --embeddings data/videos/*.mp3
+  vkm triage --keywords sheaf --format urls <urls...> | xargs vkm pipeline`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runTriage,
+}
+
+var (
+	triageKeywords   string
+	triageWorkDir    string
+	triagePlanPath   string
+	triageFormat     string
+	triageModel      string
+	triageEmbeddings bool
+)
+
+func init() {
+	TriageCmd.Flags().StringVar(&triageKeywords, "keywords", "", "Comma-separated keywords or phrases (required)")
+	TriageCmd.Flags().StringVar(&triageWorkDir, "work", "", "Directory for captions and cheap transcripts (default: the run's temp directory)")
+	TriageCmd.Flags().StringVar(&triagePlanPath, "plan", "data/triage-plan.json", "Where to write the ordered ingestion plan")
+	TriageCmd.Flags().StringVar(&triageFormat, "format", "table", "Output format (table, json, urls)")
+	TriageCmd.Flags().StringVar(&triageModel, "model", "tiny", "Local Whisper model for videos without captions")
+	TriageCmd.Flags().BoolVar(&triageEmbeddings, "embeddings", false, "Add embedding similarity to the score (needs OPENAI_API_KEY)")
+	TriageCmd.MarkFlagRequired("keywords")
+}
+
+// TriageEntry is one scored video in an ingestion plan
+type TriageEntry struct {
+	Rank        int            `json:"rank"`
+	Source      string         `json:"source"`
+	Transcript  string         `json:"transcript_via"`
+	Words       int            `json:"words"`
+	KeywordHits map[string]int `json:"keyword_hits"`
+	Similarity  float64        `json:"similarity,omitempty"`
+	Score       float64        `json:"score"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// TriagePlan is the ordered output of vkm triage
+type TriagePlan struct {
+	Keywords  []string       `json:"keywords"`
+	CreatedAt time.Time      `json:"created_at"`
+	Entries   []*TriageEntry `json:"entries"`
+}
+
+func runTriage(cmd *cobra.Command, args []string) error {
+	keywords := splitKeywords(triageKeywords)
+	if len(keywords) == 0 {
+		return fmt.Errorf("no keywords provided")
+	}
+	if triageEmbeddings && os.Getenv("OPENAI_API_KEY") == "" {
+		return fmt.Errorf("OPENAI_API_KEY environment variable not set (required for --embeddings)")
+	}
+	if triageWorkDir != "" {
+		if err := os.MkdirAll(triageWorkDir, 0755); err != nil {
+			return fmt.Errorf("failed to create work directory: %w", err)
+		}
+	}
+
+	ctx := cmd.Context()
+	sources, err := expandTriageArgs(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	var keywordVec []float64
+	if triageEmbeddings {
+		vecs, err := embedTexts(ctx, []string{strings.Join(keywords, ", ")})
+		if err != nil {
+			return err
+		}
+		keywordVec = vecs[0]
+	}
+
+	// Progress goes to stderr so --format urls can be piped
+	plan := &TriagePlan{Keywords: keywords, CreatedAt: time.Now().UTC()}
+	for i, source := range sources {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", i+1, len(sources), source)
+
+		entry := &TriageEntry{Source: source}
+		plan.Entries = append(plan.Entries, entry)
+
+		text, via, err := cheapTranscript(ctx, source)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			entry.Error = err.Error()
+			fmt.Fprintf(os.Stderr, "  ✗ %v\n", err)
+			continue
+		}
+		entry.Transcript = via
+		scoreKeywords(entry, text, keywords)
+
+		if keywordVec != nil {
+			if sim, err := bestChunkSimilarity(ctx, text, keywordVec); err != nil {
+				fmt.Fprintf(os.Stderr, "  Warning: embedding failed: %v\n", err)
+			} else {
+				entry.Similarity = sim
+				entry.Score += sim
+			}
+		}
+		fmt.Fprintf(os.Stderr, "  ✓ score %.2f (%s)\n", entry.Score, via)
+	}
+
+	sort.SliceStable(plan.Entries, func(i, j int) bool {
+		a, b := plan.Entries[i], plan.Entries[j]
+		if (a.Error == "") != (b.Error == "") {
+			return a.Error == ""
+		}
+		return a.Score > b.Score
+	})
+	for i, e := range plan.Entries {
+		e.Rank = i + 1
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	if err := os.WriteFile(triagePlanPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+
+	switch triageFormat {
+	case "json":
+		fmt.Println(string(data))
+	case "urls":
+		for _, e := range plan.Entries {
+			if e.Error == "" {
+				fmt.Println(e.Source)
+			}
+		}
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RANK\tSCORE\tHITS\tVIA\tSOURCE")
+		for _, e := range plan.Entries {
+			if e.Error != "" {
+				fmt.Fprintf(w, "%d\t-\t-\tfailed\t%s\n", e.Rank, e.Source)
+				continue
+			}
+			hits := 0
+			for _, n := range e.KeywordHits {
+				hits += n
+			}
+			fmt.Fprintf(w, "%d\t%.2f\t%d\t%s\t%s\n", e.Rank, e.Score, hits, e.Transcript, e.Source)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("\nPlan saved to: %s\n", triagePlanPath)
+		fmt.Println("Next step: process the top entries")
+		fmt.Printf("  vkm triage --keywords %q --format urls ... | head -n 10 | xargs vkm pipeline\n", triageKeywords)
+	}
+	return nil
+}
+
+// splitKeywords parses the comma-separated --keywords value
+func splitKeywords(s string) []string {
+	var keywords []string
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
+
+// expandTriageArgs expands playlist URLs into their videos
+func expandTriageArgs(ctx context.Context, args []string) ([]string, error) {
+	var sources []string
+	for _, arg := range args {
+		if !isPlaylistURL(arg) {
+			sources = append(sources, arg)
+			continue
+		}
+		items, err := expandPlaylist(ctx, arg, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			sources = append(sources, item.URL)
+		}
+	}
+	return sources, nil
+}
+
+// cheapTranscript returns plain transcript text for a source and how it
+// was obtained: an existing transcript, captions, or a tiny Whisper model
+func cheapTranscript(ctx context.Context, source string) (text, via string, err error) {
+	if _, statErr := os.Stat(source); statErr == nil {
+		switch strings.ToLower(filepath.Ext(source)) {
+		case ".txt":
+			data, err := os.ReadFile(source)
+			return string(data), "transcript", err
+		case ".json":
+			transcript, err := loadTranscript(source)
+			if err != nil {
+				return "", "", err
+			}
+			return transcriptText(transcript), "transcript", nil
+		}
+		text, err := whisperTinyText(ctx, source)
+		return text, "whisper-" + triageModel, err
+	}
+
+	if text, err := fetchCaptions(ctx, source); err == nil && text != "" {
+		return text, "captions", nil
+	}
+
+	if !commandExists("whisper") {
+		return "", "", fmt.Errorf("no captions available and whisper is not installed")
+	}
+	dir, err := triageTempDir("audio-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(dir)
+
+	media, err := downloadVideoWithYtDlp(ctx, source, dir)
+	if err != nil {
+		return "", "", fmt.Errorf("download failed: %w", err)
+	}
+	text, err = whisperTinyText(ctx, media.Path)
+	return text, "whisper-" + triageModel, err
+}
+
+// triageTempDir creates a scratch directory in --work, or in the run's
+// temp directory when none is given
+func triageTempDir(pattern string) (string, error) {
+	if triageWorkDir == "" {
+		return newTempDir(pattern)
+	}
+	return os.MkdirTemp(triageWorkDir, pattern)
+}
+
+// transcriptText joins a transcript's segments into plain text. Diarized
+// transcripts start a paragraph at each change of speaker, led by the
+// speaker's label ("SPEAKER_01: ..."), so extraction can tell who says
+// what.
+func transcriptText(t *Transcript) string {
+	var b strings.Builder
+	speaker := ""
+	for i, seg := range t.Transcript {
+		switch {
+		case seg.Speaker != "" && seg.Speaker != speaker:
+			if i > 0 {
+				b.WriteString("\n\n")
+			}
+			b.WriteString(seg.Speaker + ": ")
+			speaker = seg.Speaker
+		case i > 0:
+			b.WriteString(" ")
+		}
+		b.WriteString(seg.Text)
+	}
+	return b.String()
+}
+
+var (
+	vttTagPattern   = regexp.MustCompile(`<[^>]+>`)
+	vttCueIDPattern = regexp.MustCompile(`^\d+$`)
+)
+
+// fetchCaptions downloads a video's manual or automatic captions with
+// yt-dlp and returns them as plain text
+func fetchCaptions(ctx context.Context, videoURL string) (string, error) {
+	dir, err := triageTempDir("captions-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{
+		"--skip-download", "--write-subs", "--write-auto-subs",
+		"--sub-langs", defaultCaptionLangs, "--sub-format", "vtt",
+		"--quiet", "--no-playlist",
+		"--output", filepath.Join(toolPath(dir), "%(id)s.%(ext)s"),
+		videoURL,
+	}
+
+	c, cleanup := ytDlpCommand(ctx, args...)
+	defer cleanup()
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("failed to fetch captions: %w", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.vtt"))
+	if len(files) == 0 {
+		return "", nil
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		return "", err
+	}
+	return vttText(string(data)), nil
+}
+
+// vttText strips WebVTT headers, timings and tags. Automatic captions
+// repeat each line as it scrolls, so consecutive duplicates are dropped.
+func vttText(vtt string) string {
+	var lines []string
+	last := ""
+	for _, line := range strings.Split(vtt, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "WEBVTT" || strings.Contains(line, "-->") ||
+			vttCueIDPattern.MatchString(line) ||
+			strings.HasPrefix(line, "Kind:") || strings.HasPrefix(line, "Language:") {
+			continue
+		}
+		line = strings.TrimSpace(vttTagPattern.ReplaceAllString(line, ""))
+		if line == "" || line == last {
+			continue
+		}
+		lines = append(lines, line)
+		last = line
+	}
+	return strings.Join(lines, " ")
+}
+
+// whisperTinyText transcribes a file with the local whisper CLI using the
+// triage model and returns the text
+func whisperTinyText(ctx context.Context, audioPath string) (string, error) {
+	if _, err := findTool("whisper"); err != nil {
+		return "", err
+	}
+	dir, err := triageTempDir("whisper-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := toolCommand(ctx, "whisper", toolPath(audioPath),
+		"--model", triageModel,
+		"--output_format", "txt",
+		"--output_dir", toolPath(dir))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("whisper command failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	baseName := strings.TrimSuffix(filepath.Base(audioPath), filepath.Ext(audioPath))
+	data, err := os.ReadFile(filepath.Join(dir, baseName+".txt"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read whisper output: %w", err)
+	}
+	return string(data), nil
+}
+
+// scoreKeywords counts keyword hits in text and sets the entry's keyword
+// score: Σ log(1 + hits per 1000 words) plus the share of keywords present
+func scoreKeywords(entry *TriageEntry, text string, keywords []string) {
+	lower := strings.ToLower(text)
+	entry.Words = len(strings.Fields(text))
+	entry.KeywordHits = make(map[string]int, len(keywords))
+	if entry.Words == 0 {
+		return
+	}
+
+	matched := 0
+	for _, k := range keywords {
+		hits := strings.Count(lower, strings.ToLower(k))
+		entry.KeywordHits[k] = hits
+		if hits > 0 {
+			matched++
+			entry.Score += math.Log1p(float64(hits) * 1000 / float64(entry.Words))
+		}
+	}
+	entry.Score += float64(matched) / float64(len(keywords))
+}
+
+// triageChunkWords is the size of the transcript windows compared against
+// the keywords; whole transcripts dilute a topic discussed in one section
+const triageChunkWords = 300
+
+// bestChunkSimilarity returns the highest cosine similarity between the
+// keyword embedding and any chunk of the text
+func bestChunkSimilarity(ctx context.Context, text string, keywordVec []float64) (float64, error) {
+	words := strings.Fields(text)
+	var chunks []string
+	for start := 0; start < len(words); start += triageChunkWords {
+		end := start + triageChunkWords
+		if end > len(words) {
+			end = len(words)
+		}
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+	}
+	if len(chunks) == 0 {
+		return 0, nil
+	}
+
+	vecs, err := embedTexts(ctx, chunks)
+	if err != nil {
+		return 0, err
+	}
+	best := 0.0
+	for _, v := range vecs {
+		if sim := cosineSimilarity(keywordVec, v); sim > best {
+			best = sim
+		}
+	}
+	return best, nil
+}
+
+// defaultEmbeddingModel is the OpenAI model used unless a store has been
+// migrated to another one with 'vkm embed --recompute'
+const defaultEmbeddingModel = "text-embedding-3-small"
+
+// embedTexts returns OpenAI embeddings for texts, in order
+func embedTexts(ctx context.Context, texts []string) ([][]float64, error) {
+	return embedTextsWithModel(ctx, defaultEmbeddingModel, texts)
+}
+
+// embedTextsWithModel returns embeddings for texts from the given model,
+// which is an OpenAI model or ollama:<model> for a local Ollama
+func embedTextsWithModel(ctx context.Context, model string, texts []string) ([][]float64, error) {
+	if local, ok := ollamaModel(model); ok {
+		return embedOllama(ctx, local, texts)
+	}
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"model": model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/embeddings", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("OPENAI_API_KEY"))
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	vecs := make([][]float64, len(texts))
+	for _, d := range result.Data {
+		if d.Index >= 0 && d.Index < len(vecs) {
+			vecs[d.Index] = d.Embedding
+		}
+	}
+	return vecs, nil
+}
+
+// cosineSimilarity of two equal-length vectors
+func cosineSimilarity(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
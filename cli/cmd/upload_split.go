@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// errUploadTooLarge marks an upload the backend (or a proxy in front of
+// it) refused with 413 Payload Too Large
+var errUploadTooLarge = errors.New("upload too large for the backend")
+
+// Patch metadata keys linking the parts of a split upload
+const (
+	// metaSplitParent is an ID shared by all parts of one upload
+	metaSplitParent = "split-parent"
+	// metaSplitPart is a part's position, "1", "2", and "2.1", "2.2" for
+	// parts split again
+	metaSplitPart = "split-part"
+	// metaSplitParts is the number of parts at the part's level
+	metaSplitParts = "split-parts"
+)
+
+// minSplitLength is the shortest text split further; a part this short
+// that is still too large means the limit is not about the transcript
+const minSplitLength = 1000
+
+// uploadInParts uploads content the backend refused as too large as two
+// halves, cut at the paragraph or sentence boundary nearest the middle,
+// each stored as its own patch linked to the others by metaSplitParent.
+// Halves that are still too large are split again. It returns the first
+// part's patch ID and the facts of all parts.
+func uploadInParts(ctx context.Context, content, filename string, commit patchCommit, tooLarge error) (patchID string, factsCount int, err error) {
+	if len(content) < 2*minSplitLength {
+		return "", 0, fmt.Errorf("%w; a transcript of %d characters can't usefully be split further", tooLarge, len(content))
+	}
+
+	parent, _ := commit.Metadata[metaSplitParent].(string)
+	prefix, _ := commit.Metadata[metaSplitPart].(string)
+	if parent == "" {
+		parent = newUUID()
+		fmt.Printf("  Backend refused %d characters as too large; uploading in parts (%s %s)\n", len(content), metaSplitParent, parent)
+	}
+
+	parts := splitText(content)
+	for i, part := range parts {
+		label := fmt.Sprint(i + 1)
+		if prefix != "" {
+			label = prefix + "." + label
+		}
+		partCommit := patchCommit{Timestamp: commit.Timestamp, Metadata: make(map[string]interface{}, len(commit.Metadata)+3)}
+		for k, v := range commit.Metadata {
+			partCommit.Metadata[k] = v
+		}
+		partCommit.Metadata[metaSplitParent] = parent
+		partCommit.Metadata[metaSplitPart] = label
+		partCommit.Metadata[metaSplitParts] = len(parts)
+
+		id, facts, err := uploadToBackend(ctx, part, filename, partCommit)
+		if err != nil && i > 0 {
+			return "", 0, fmt.Errorf("part %s: %w (the parts before it are stored, with %s %s)", label, err, metaSplitParent, parent)
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("part %s: %w", label, err)
+		}
+		fmt.Printf("  ✓ Part %s (%d characters): patch %s, %d facts\n", label, len(part), id, facts)
+		if patchID == "" {
+			patchID = id
+		}
+		factsCount += facts
+	}
+	return patchID, factsCount, nil
+}
+
+// splitText cuts text in two at the boundary nearest its middle: a blank
+// line if there is one in the middle half, else a line break, a sentence
+// end, or a space
+func splitText(text string) []string {
+	mid := len(text) / 2
+	lo, hi := len(text)/4, len(text)*3/4
+	for _, sep := range []string{"\n\n", "\n", ". ", "? ", "! ", " "} {
+		best := -1
+		for i := lo; i < hi; {
+			j := strings.Index(text[i:hi], sep)
+			if j < 0 {
+				break
+			}
+			at := i + j + len(sep)
+			if best < 0 || abs(at-mid) < abs(best-mid) {
+				best = at
+			}
+			i = at
+		}
+		if best > 0 {
+			return []string{strings.TrimSpace(text[:best]), strings.TrimSpace(text[best:])}
+		}
+	}
+	for mid > 0 && !utf8.RuneStart(text[mid]) {
+		mid--
+	}
+	return []string{text[:mid], text[mid:]}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,456 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// UploadTranscriptsCmd brings existing transcript collections into the graph
+var UploadTranscriptsCmd = &cobra.Command{
+	Use:   "upload-transcripts <files/dirs...>",
+	Short: "Upload existing transcripts (txt, srt, vtt, json) for fact extraction",
+	Long: `Convert transcripts made elsewhere (otter.ai exports, subtitle files,
+earlier Whisper runs) into vkm transcripts and send them to the backend
+for fact extraction. Directories are searched recursively.
+
+Formats are detected from the extension and, for .txt files, the
+contents:
+  .srt    SubRip subtitles, one segment per cue
+  .vtt    WebVTT captions, as YouTube and yt-dlp write them
+  .json   vkm transcripts or Whisper output ("segments" with start/end)
+  .txt    plain text, one segment per paragraph; otter.ai exports
+          ("Speaker 1  0:05" lines) keep their speakers and timestamps.
+          A .txt holding SRT or WebVTT is read as such.
+
+Metadata is inferred from what surrounds each file: a yt-dlp .info.json
+beside it gives title, channel, publish date and URL; otherwise an
+11-character YouTube ID in brackets ("Talk [dQw4w9WgXcQ].en.srt") links
+the transcript to its video, a date in the name (2024-03-01 or
+20240301) becomes the publish date, a language code before the extension
+its language, and the rest of the name its title. Transcripts without a
+YouTube ID get a stable ID from their contents ("transcript-" and 12 hex
+digits).
+
+Each transcript is saved to --output with a .info.json and recorded in
+the manifest; transcripts already uploaded (or videos already processed)
+are skipped unless --force is given. --no-extract only converts and
+saves them.
+
+Examples:
+  vkm upload-transcripts ~/otter-exports --channel "Team sync"
+  vkm upload-transcripts archive/subtitles --strategy two-pass
+
+` + nameTemplateHelp,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runUploadTranscripts,
+}
+
+var (
+	uploadChannel   string
+	uploadNoExtract bool
+)
+
+func init() {
+	UploadTranscriptsCmd.Flags().StringVarP(&ingestOutputDir, "output", "o", "data/transcripts", "Output directory for transcripts")
+	UploadTranscriptsCmd.Flags().StringVar(&ingestNameTemplate, "name-template", defaultNameTemplate, "Go template for transcript file names")
+	UploadTranscriptsCmd.Flags().StringVar(&ingestManifest, "manifest", "data/manifest.db", "SQLite manifest recording uploaded transcripts")
+	UploadTranscriptsCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	UploadTranscriptsCmd.Flags().StringVar(&uploadChannel, "channel", "", "Channel name recorded for transcripts without one")
+	UploadTranscriptsCmd.Flags().BoolVar(&uploadNoExtract, "no-extract", false, "Convert and save transcripts without fact extraction")
+	UploadTranscriptsCmd.Flags().StringVarP(&pipelineBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	UploadTranscriptsCmd.Flags().StringVar(&pipelineStrategy, "strategy", extractStrategySingle, "Fact extraction strategy (single, two-pass)")
+	UploadTranscriptsCmd.Flags().BoolVar(&ingestForce, "force", false, "Upload transcripts again even if the manifest has them")
+}
+
+// Transcript formats upload-transcripts reads. Files are found by the
+// first four; otter.ai text exports and Whisper's JSON output are told
+// apart by their contents.
+const (
+	transcriptFormatText    = "txt"
+	transcriptFormatSRT     = "srt"
+	transcriptFormatVTT     = "vtt"
+	transcriptFormatJSON    = "json"
+	transcriptFormatOtter   = "otter"
+	transcriptFormatWhisper = "whisper-json"
+)
+
+var (
+	// bracketedIDPattern finds the YouTube ID yt-dlp puts in file names
+	bracketedIDPattern = regexp.MustCompile(`\[([A-Za-z0-9_-]{11})\]`)
+	// nameDatePattern finds a date in a file name
+	nameDatePattern = regexp.MustCompile(`(?:^|[^0-9])(\d{4})-?(\d{2})-?(\d{2})(?:[^0-9]|$)`)
+	// languageSuffixPattern matches the language code before a
+	// transcript's extension (talk.en.srt, talk.pt-BR.vtt)
+	languageSuffixPattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z]{2,4})?$`)
+	// srtCommaPattern matches SRT's hh:mm:ss,ttt timestamps
+	srtCommaPattern = regexp.MustCompile(`(\d{2}:\d{2}:\d{2}),(\d{3})`)
+	// otterHeaderPattern matches the speaker and time lines of otter.ai
+	// text exports ("Speaker 1  0:05", "Jane Doe  1:02:30")
+	otterHeaderPattern = regexp.MustCompile(`^(.*?)\s+((?:\d+:)?\d{1,2}:\d{2})$`)
+)
+
+func runUploadTranscripts(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	extract := !uploadNoExtract
+
+	if extract {
+		if err := checkExtractStrategy(pipelineStrategy); err != nil {
+			return err
+		}
+	}
+	names, err := parseNameTemplate(ingestNameTemplate)
+	if err != nil {
+		return err
+	}
+	files, err := collectTranscriptFiles(args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no transcript files found")
+	}
+	manifest, err := openManifest(ingestManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	uploaded, skipped, failed := 0, 0, 0
+	for i, path := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("[%d/%d] %s\n", i+1, len(files), path)
+
+		doc, format, err := readTranscriptFile(path)
+		if err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+			continue
+		}
+		if !ingestForce {
+			done, err := documentIngested(manifest, doc.ID, extract)
+			if err != nil {
+				return err
+			}
+			if done {
+				fmt.Printf("  ✓ Already uploaded as %s\n", doc.ID)
+				skipped++
+				continue
+			}
+		}
+
+		fmt.Printf("  %s (%s, %d segments)\n", doc.Title, format, len(doc.Blocks))
+		if err := ingestDocument(ctx, manifest, doc, ingestOutputDir, names, extract); err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+			continue
+		}
+		uploaded++
+	}
+
+	fmt.Printf("\nUploaded %d transcripts", uploaded)
+	if skipped > 0 {
+		fmt.Printf(", %d already uploaded", skipped)
+	}
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+	}
+	fmt.Println()
+	return ctx.Err()
+}
+
+// transcriptFileFormat returns the format a file's extension names, or ""
+// for files upload-transcripts doesn't read. yt-dlp's .info.json
+// sidecars are metadata, not transcripts.
+func transcriptFileFormat(path string) string {
+	if strings.HasSuffix(path, ".info.json") {
+		return ""
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".txt":
+		return transcriptFormatText
+	case ".srt":
+		return transcriptFormatSRT
+	case ".vtt":
+		return transcriptFormatVTT
+	case ".json":
+		return transcriptFormatJSON
+	}
+	return ""
+}
+
+// collectTranscriptFiles expands directories to the transcript files
+// under them. Files named explicitly must still have a recognized
+// extension.
+func collectTranscriptFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", arg, err)
+		}
+		if !info.IsDir() {
+			if transcriptFileFormat(arg) == "" {
+				fmt.Fprintf(os.Stderr, "Warning: skipping %s (not a txt, srt, vtt or json transcript)\n", arg)
+				continue
+			}
+			files = append(files, arg)
+			continue
+		}
+
+		var found []string
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && transcriptFileFormat(path) != "" {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", arg, err)
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// readTranscriptFile converts a transcript file into a document with the
+// metadata inferred for it, and returns the format it was read as
+func readTranscriptFile(path string) (*ingestedDocument, string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	format := transcriptFileFormat(abs)
+	if format == transcriptFormatText {
+		// Subtitles are often passed around renamed to .txt
+		trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\ufeff")))
+		switch {
+		case bytes.HasPrefix(trimmed, []byte("WEBVTT")):
+			format = transcriptFormatVTT
+		case srtCommaPattern.Match(trimmed) && bytes.Contains(trimmed, []byte("-->")):
+			format = transcriptFormatSRT
+		}
+	}
+
+	doc := &ingestedDocument{URL: "file://" + filepath.ToSlash(abs), Kind: "transcript"}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	switch format {
+	case transcriptFormatSRT:
+		doc.Blocks = segmentBlocks(parseVTT(srtCommaPattern.ReplaceAllString(text, "$1.$2")))
+	case transcriptFormatVTT:
+		doc.Blocks = segmentBlocks(parseVTT(text))
+	case transcriptFormatJSON:
+		if format, err = readJSONTranscript(data, doc); err != nil {
+			return nil, "", fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	default:
+		doc.Blocks = textTranscriptBlocks(text)
+		for _, b := range doc.Blocks {
+			if b.Speaker != "" {
+				format = transcriptFormatOtter
+				break
+			}
+		}
+	}
+	if len(doc.Blocks) == 0 {
+		return nil, "", fmt.Errorf("no transcript text found in %s", path)
+	}
+
+	inferTranscriptMetadata(abs, doc)
+	if doc.ID == "" {
+		sum := sha256.Sum256(data)
+		doc.ID = documentID("transcript", hex.EncodeToString(sum[:]))
+	}
+	return doc, format, nil
+}
+
+// segmentBlocks turns transcript segments into document blocks
+func segmentBlocks(segments []TranscriptSegment) []documentBlock {
+	blocks := make([]documentBlock, 0, len(segments))
+	for _, seg := range segments {
+		if text := strings.TrimSpace(seg.Text); text != "" {
+			blocks = append(blocks, documentBlock{
+				Text:      text,
+				Timestamp: seg.Timestamp,
+				Duration:  seg.Duration,
+				Speaker:   seg.Speaker,
+				Chapter:   seg.Chapter,
+				Words:     seg.Words,
+			})
+		}
+	}
+	return blocks
+}
+
+// readJSONTranscript reads a vkm transcript or Whisper's JSON output into
+// doc, with the title, language, publish date and chapters a vkm
+// transcript has, and returns the format it was read as. Whisper's word
+// timings are kept, from its segments (the whisper CLI's
+// --word_timestamps, WhisperX) or the API's top-level "words".
+func readJSONTranscript(data []byte, doc *ingestedDocument) (string, error) {
+	var parsed struct {
+		Transcript
+		Text     string `json:"text"`
+		Segments []struct {
+			Start   float64          `json:"start"`
+			End     float64          `json:"end"`
+			Text    string           `json:"text"`
+			Speaker string           `json:"speaker"`
+			Words   []TranscriptWord `json:"words"`
+		} `json:"segments"`
+		Words []TranscriptWord `json:"words"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return "", err
+	}
+
+	format := transcriptFormatWhisper
+	switch {
+	case len(parsed.Transcript.Transcript) > 0:
+		format = transcriptFormatJSON
+		doc.Blocks = segmentBlocks(parsed.Transcript.Transcript)
+		doc.Chapters = parsed.Chapters
+		doc.Title = parsed.Title
+		if youtubeIDPattern.MatchString(parsed.VideoID) {
+			doc.ID = parsed.VideoID
+		}
+		if t, err := time.Parse(time.RFC3339, parsed.PublishedAt); err == nil {
+			doc.Published = t
+		}
+	case len(parsed.Segments) > 0:
+		t := &Transcript{}
+		for _, seg := range parsed.Segments {
+			t.Transcript = append(t.Transcript, TranscriptSegment{
+				Timestamp: seg.Start,
+				Text:      seg.Text,
+				Duration:  seg.End - seg.Start,
+				Speaker:   seg.Speaker,
+				Words:     trimWords(seg.Words),
+			})
+		}
+		if !t.hasWords() {
+			assignWords(t, trimWords(parsed.Words))
+		}
+		doc.Blocks = segmentBlocks(t.Transcript)
+	case strings.TrimSpace(parsed.Text) != "":
+		doc.Blocks = textTranscriptBlocks(parsed.Text)
+	default:
+		return "", fmt.Errorf("not a vkm or Whisper transcript")
+	}
+	doc.Language = parsed.Language
+	return format, nil
+}
+
+// textTranscriptBlocks splits a plain text transcript into paragraphs.
+// otter.ai exports, where each paragraph starts with a "Speaker  0:05"
+// line, become timed segments labeled with their speaker.
+func textTranscriptBlocks(text string) []documentBlock {
+	var blocks []documentBlock
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		lines := strings.Split(strings.TrimSpace(para), "\n")
+		block := documentBlock{}
+		if m := otterHeaderPattern.FindStringSubmatch(strings.TrimSpace(lines[0])); m != nil && len(lines) > 1 {
+			if ts, err := parseVTTTimestamp(m[2]); err == nil {
+				block.Timestamp = ts
+				block.Speaker = m[1]
+				lines = lines[1:]
+			}
+		}
+		for i := range lines {
+			lines[i] = strings.TrimSpace(lines[i])
+		}
+		if block.Text = strings.TrimSpace(strings.Join(lines, " ")); block.Text != "" {
+			blocks = append(blocks, block)
+		}
+	}
+
+	// Timed paragraphs last until the next one starts
+	for i := 0; i+1 < len(blocks); i++ {
+		if next := blocks[i+1].Timestamp; next > blocks[i].Timestamp {
+			blocks[i].Duration = next - blocks[i].Timestamp
+		}
+	}
+	return blocks
+}
+
+// inferTranscriptMetadata fills in what doc doesn't know yet from the
+// .info.json beside the file at path, or else from its name
+func inferTranscriptMetadata(path string, doc *ingestedDocument) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	lang := ""
+	if i := strings.LastIndex(base, "."); i >= 0 && languageSuffixPattern.MatchString(base[i+1:]) {
+		lang = base[i+1:]
+		base = base[:i]
+	}
+	if doc.Language == "" {
+		doc.Language = lang
+	}
+
+	if info, err := loadVideoMetadata(infoPathFor(base + filepath.Ext(path))); err == nil {
+		if id, _ := info["id"].(string); doc.ID == "" && id != "" {
+			doc.ID = id
+		}
+		if title, _ := info["title"].(string); doc.Title == "" {
+			doc.Title = title
+		}
+		doc.Site, _ = info["channel"].(string)
+		doc.Author, _ = info["uploader"].(string)
+		if u, _ := info["webpage_url"].(string); u != "" {
+			doc.URL = u
+		}
+		if doc.Published.IsZero() {
+			doc.Published = publishedAtFromInfo(info)
+		}
+	}
+
+	name := filepath.Base(base)
+	if m := bracketedIDPattern.FindStringSubmatch(name); m != nil {
+		if doc.ID == "" {
+			doc.ID = m[1]
+		}
+		name = strings.Replace(name, m[0], "", 1)
+	}
+	if youtubeIDPattern.MatchString(doc.ID) && strings.HasPrefix(doc.URL, "file://") {
+		doc.URL = "https://www.youtube.com/watch?v=" + doc.ID
+	}
+	if m := nameDatePattern.FindStringSubmatchIndex(name); m != nil {
+		day := name[m[2]:m[3]] + name[m[4]:m[5]] + name[m[6]:m[7]]
+		if t, err := time.Parse("20060102", day); err == nil {
+			if doc.Published.IsZero() {
+				doc.Published = t
+			}
+			name = name[:m[2]] + name[m[7]:]
+		}
+	}
+	if doc.Title == "" {
+		doc.Title = strings.Trim(strings.Join(strings.Fields(strings.NewReplacer("_", " ").Replace(name)), " "), " -.")
+	}
+	if doc.Title == "" {
+		doc.Title = filepath.Base(path)
+	}
+	if doc.Site == "" && doc.Author == "" {
+		doc.Site = uploadChannel
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const urlListHelp = `URL lists:
+  --from-file reads more URLs from a file, one per line, and a "-"
+  argument (or --from-file -) reads them from stdin, so scripts can pipe
+  in hundreds at a time. Blank lines and # comments, on their own line or
+  after a URL and a space, are skipped, as are repeated URLs.`
+
+// urlListFile is the --from-file of the commands that take URLs
+var urlListFile string
+
+// expandURLArgs returns the URL arguments with "-" replaced by the URLs
+// on stdin and the URLs of --from-file appended, in order, without
+// repeats
+func expandURLArgs(args []string) ([]string, error) {
+	var urls []string
+	stdinRead := false
+	readStdin := func() error {
+		if stdinRead {
+			return fmt.Errorf("stdin can only be read once")
+		}
+		stdinRead = true
+		list, err := readURLList(os.Stdin, "stdin")
+		urls = append(urls, list...)
+		return err
+	}
+
+	for _, arg := range args {
+		if arg == "-" {
+			if err := readStdin(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		urls = append(urls, arg)
+	}
+
+	switch urlListFile {
+	case "":
+	case "-":
+		if err := readStdin(); err != nil {
+			return nil, err
+		}
+	default:
+		f, err := os.Open(urlListFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open URL list: %w", err)
+		}
+		defer f.Close()
+		list, err := readURLList(f, urlListFile)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, list...)
+	}
+
+	seen := make(map[string]bool, len(urls))
+	unique := urls[:0]
+	for _, u := range urls {
+		if !seen[u] {
+			seen[u] = true
+			unique = append(unique, u)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("no URLs given (pass them as arguments, with --from-file or on stdin with -)")
+	}
+	return unique, nil
+}
+
+// readURLList reads one URL per line, skipping blank lines and comments.
+// A # only starts a comment at the start of a line or after whitespace,
+// since URLs may carry # fragments.
+func readURLList(r io.Reader, name string) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "\uFEFF")
+		for i := 0; i < len(line); i++ {
+			if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+				line = line[:i]
+				break
+			}
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			urls = append(urls, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read URLs from %s: %w", name, err)
+	}
+	return urls, nil
+}
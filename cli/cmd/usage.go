@@ -0,0 +1,447 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ReportUsageCmd summarizes the usage statistics recorded in the manifest
+var ReportUsageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Summarize the commands run, items processed and where the time went",
+	Long: `Summarize how vkm has been used on this machine: the commands run and
+how long they took, the items they downloaded, transcribed and processed,
+and the time each pipeline stage spent per item, so the slowest stage
+stands out.
+
+Each command records its usage in its --manifest (data/manifest.db for
+commands without one) when it exits, if the manifest exists. Statistics
+never leave the machine: nothing is sent anywhere, and they are only read
+by this report. Set VKM_USAGE_STATS=off to stop recording them.
+
+Items count each source once per command, by the state it was left in:
+a video downloaded and then processed counts as processed, one that
+failed after downloading as failed. Stage times cover the stages items
+completed: downloads, caption fetches, transcriptions and fact
+extractions.
+
+Examples:
+  vkm report usage
+  vkm report usage --since 7d --format json`,
+	Args: cobra.NoArgs,
+	RunE: runReportUsage,
+}
+
+var (
+	usageManifest string
+	usageSince    string
+	usageFormat   string
+)
+
+func init() {
+	ReportCmd.AddCommand(ReportUsageCmd)
+
+	ReportUsageCmd.Flags().StringVar(&usageManifest, "manifest", "data/manifest.db", "SQLite manifest path")
+	ReportUsageCmd.Flags().StringVar(&usageSince, "since", "30d", "Only count commands started within this long (e.g. 7d, 12h; 0 for all)")
+	ReportUsageCmd.Flags().StringVar(&usageFormat, "format", "table", "Output format (table, json)")
+}
+
+// Pipeline stages timed in usage statistics
+const (
+	usageStageDownload   = "download"
+	usageStageCaptions   = "captions"
+	usageStageTranscribe = "transcribe"
+	usageStageExtract    = "extract"
+)
+
+// usageRun collects the usage of the running command until FinishUsage
+// records it. Serve workers update it concurrently.
+var usageRun struct {
+	sync.Mutex
+	command  string
+	manifest string
+	started  time.Time
+	// items maps each source's URL to the last state it was recorded in
+	items  map[string]string
+	stages map[string]*usageStage
+}
+
+// usageStage totals the items that completed a stage and the time they
+// took
+type usageStage struct {
+	Items   int     `json:"items"`
+	Seconds float64 `json:"seconds"`
+}
+
+// StartUsage begins collecting the usage of c, unless VKM_USAGE_STATS is
+// off. It is recorded in the manifest c's --manifest names.
+func StartUsage(c *cobra.Command) {
+	if strings.EqualFold(os.Getenv("VKM_USAGE_STATS"), "off") {
+		return
+	}
+	manifest := "data/manifest.db"
+	if f := c.Flags().Lookup("manifest"); f != nil {
+		manifest = f.Value.String()
+	}
+	usageRun.Lock()
+	defer usageRun.Unlock()
+	usageRun.command = strings.TrimPrefix(c.CommandPath(), c.Root().Name()+" ")
+	usageRun.manifest = manifest
+	usageRun.started = time.Now()
+	usageRun.items = make(map[string]string)
+	usageRun.stages = make(map[string]*usageStage)
+}
+
+// countUsageItem counts a source recorded in state
+func countUsageItem(url, state string) {
+	usageRun.Lock()
+	defer usageRun.Unlock()
+	if usageRun.items == nil {
+		return
+	}
+	switch state {
+	case ItemDownloaded, ItemTranscribed, ItemProcessed, ItemFailed:
+		usageRun.items[url] = state
+	}
+}
+
+// timeUsageStage counts an item that completed stage, started at start
+func timeUsageStage(stage string, start time.Time) {
+	usageRun.Lock()
+	defer usageRun.Unlock()
+	if usageRun.stages == nil {
+		return
+	}
+	s := usageRun.stages[stage]
+	if s == nil {
+		s = &usageStage{}
+		usageRun.stages[stage] = s
+	}
+	s.Items++
+	s.Seconds += time.Since(start).Seconds()
+}
+
+// FinishUsage records the running command's usage, ended with err, in its
+// manifest. Commands whose manifest doesn't exist record nothing, so
+// statistics never create a data directory of their own.
+func FinishUsage(err error) {
+	usageRun.Lock()
+	defer usageRun.Unlock()
+	if usageRun.started.IsZero() || usageRun.manifest == "" {
+		return
+	}
+	if _, statErr := os.Stat(usageRun.manifest); statErr != nil {
+		return
+	}
+
+	run := usageRecord{
+		Command:   usageRun.command,
+		StartedAt: usageRun.started.UTC(),
+		Seconds:   time.Since(usageRun.started).Seconds(),
+		Outcome:   "ok",
+		Stages:    usageRun.stages,
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		run.Outcome = "canceled"
+	case err != nil:
+		run.Outcome = "failed"
+	}
+	for _, state := range usageRun.items {
+		run.addItem(state)
+	}
+
+	m, openErr := openManifest(usageRun.manifest)
+	if openErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record usage: %v\n", openErr)
+		return
+	}
+	defer m.Close()
+	if err := m.RecordUsage(run); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// usageRecord is the usage of one command
+type usageRecord struct {
+	Command     string
+	StartedAt   time.Time
+	Seconds     float64
+	Outcome     string
+	Downloaded  int
+	Transcribed int
+	Processed   int
+	Failed      int
+	Stages      map[string]*usageStage
+}
+
+// addItem counts an item left in state
+func (r *usageRecord) addItem(state string) {
+	switch state {
+	case ItemDownloaded:
+		r.Downloaded++
+	case ItemTranscribed:
+		r.Transcribed++
+	case ItemProcessed:
+		r.Processed++
+	case ItemFailed:
+		r.Failed++
+	}
+}
+
+// RecordUsage stores the usage of one command
+func (m *Manifest) RecordUsage(r usageRecord) error {
+	return m.write(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			INSERT INTO usage_runs (command, started_at, seconds, outcome, downloaded, transcribed, processed, failed)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.Command, r.StartedAt, r.Seconds, r.Outcome, r.Downloaded, r.Transcribed, r.Processed, r.Failed)
+		if err != nil {
+			return fmt.Errorf("failed to record usage: %w", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to record usage: %w", err)
+		}
+		for stage, s := range r.Stages {
+			_, err := tx.Exec(`INSERT INTO usage_stages (run_id, stage, items, seconds) VALUES (?, ?, ?, ?)`,
+				id, stage, s.Items, s.Seconds)
+			if err != nil {
+				return fmt.Errorf("failed to record usage: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// usageCommand totals the runs of one command
+type usageCommand struct {
+	Command  string  `json:"command"`
+	Runs     int     `json:"runs"`
+	Failed   int     `json:"failed"`
+	Canceled int     `json:"canceled"`
+	Seconds  float64 `json:"seconds"`
+}
+
+// usageDay totals the runs started on one local day
+type usageDay struct {
+	Day       string  `json:"day"`
+	Runs      int     `json:"runs"`
+	Seconds   float64 `json:"seconds"`
+	Processed int     `json:"processed"`
+}
+
+// usageReport is the output of 'vkm report usage'
+type usageReport struct {
+	Since       *time.Time             `json:"since,omitempty"`
+	Runs        int                    `json:"runs"`
+	Seconds     float64                `json:"seconds"`
+	Downloaded  int                    `json:"downloaded"`
+	Transcribed int                    `json:"transcribed"`
+	Processed   int                    `json:"processed"`
+	Failed      int                    `json:"failed"`
+	Commands    []usageCommand         `json:"commands"`
+	Stages      map[string]*usageStage `json:"stages"`
+	Days        []usageDay             `json:"days"`
+}
+
+// UsageSince totals the usage of the commands started since since (all of
+// them for a zero time)
+func (m *Manifest) UsageSince(since time.Time) (*usageReport, error) {
+	report := &usageReport{Stages: make(map[string]*usageStage)}
+	if !since.IsZero() {
+		report.Since = &since
+	}
+
+	rows, err := m.db.Query(`
+		SELECT command, started_at, seconds, outcome, downloaded, transcribed, processed, failed
+		FROM usage_runs WHERE started_at >= ? ORDER BY started_at`, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage: %w", err)
+	}
+	defer rows.Close()
+	commands := make(map[string]*usageCommand)
+	days := make(map[string]*usageDay)
+	for rows.Next() {
+		var r usageRecord
+		if err := rows.Scan(&r.Command, &r.StartedAt, &r.Seconds, &r.Outcome,
+			&r.Downloaded, &r.Transcribed, &r.Processed, &r.Failed); err != nil {
+			return nil, fmt.Errorf("failed to read usage: %w", err)
+		}
+		report.Runs++
+		report.Seconds += r.Seconds
+		report.Downloaded += r.Downloaded
+		report.Transcribed += r.Transcribed
+		report.Processed += r.Processed
+		report.Failed += r.Failed
+
+		c := commands[r.Command]
+		if c == nil {
+			c = &usageCommand{Command: r.Command}
+			commands[r.Command] = c
+		}
+		c.Runs++
+		c.Seconds += r.Seconds
+		switch r.Outcome {
+		case "failed":
+			c.Failed++
+		case "canceled":
+			c.Canceled++
+		}
+
+		day := r.StartedAt.Local().Format("2006-01-02")
+		d := days[day]
+		if d == nil {
+			d = &usageDay{Day: day}
+			days[day] = d
+		}
+		d.Runs++
+		d.Seconds += r.Seconds
+		d.Processed += r.Processed
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage: %w", err)
+	}
+
+	stages, err := m.db.Query(`
+		SELECT s.stage, SUM(s.items), SUM(s.seconds)
+		FROM usage_stages s JOIN usage_runs r ON r.id = s.run_id
+		WHERE r.started_at >= ? GROUP BY s.stage`, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage: %w", err)
+	}
+	defer stages.Close()
+	for stages.Next() {
+		var stage string
+		var s usageStage
+		if err := stages.Scan(&stage, &s.Items, &s.Seconds); err != nil {
+			return nil, fmt.Errorf("failed to read usage: %w", err)
+		}
+		report.Stages[stage] = &s
+	}
+	if err := stages.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage: %w", err)
+	}
+
+	for _, c := range commands {
+		report.Commands = append(report.Commands, *c)
+	}
+	sort.Slice(report.Commands, func(i, j int) bool {
+		if report.Commands[i].Seconds != report.Commands[j].Seconds {
+			return report.Commands[i].Seconds > report.Commands[j].Seconds
+		}
+		return report.Commands[i].Command < report.Commands[j].Command
+	})
+	for _, d := range days {
+		report.Days = append(report.Days, *d)
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Day < report.Days[j].Day })
+	return report, nil
+}
+
+func runReportUsage(cmd *cobra.Command, args []string) error {
+	var since time.Time
+	if usageSince != "0" {
+		age, err := parseAge(usageSince)
+		if err != nil {
+			return err
+		}
+		since = time.Now().Add(-age)
+	}
+
+	manifest, err := openManifest(usageManifest)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+	report, err := manifest.UsageSince(since)
+	if err != nil {
+		return err
+	}
+
+	if usageFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	if report.Runs == 0 {
+		fmt.Println("No usage recorded yet")
+		return nil
+	}
+
+	period := "all time"
+	if !since.IsZero() {
+		period = "since " + since.Local().Format("2006-01-02 15:04")
+	}
+	fmt.Printf("Usage %s: %d commands, %s\n", period, report.Runs, formatUsageTime(report.Seconds))
+	fmt.Printf("Items: %d downloaded, %d transcribed, %d processed, %d failed\n",
+		report.Downloaded, report.Transcribed, report.Processed, report.Failed)
+	if report.Processed > 0 && report.Seconds > 0 {
+		fmt.Printf("Throughput: %.1f items processed per hour of command time\n", float64(report.Processed)/(report.Seconds/3600))
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMMAND\tRUNS\tFAILED\tCANCELED\tTOTAL TIME\tAVG TIME")
+	for _, c := range report.Commands {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", c.Command, c.Runs, c.Failed, c.Canceled,
+			formatUsageTime(c.Seconds), formatUsageTime(c.Seconds/float64(c.Runs)))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(report.Stages) > 0 {
+		var total float64
+		for _, s := range report.Stages {
+			total += s.Seconds
+		}
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STAGE\tITEMS\tTOTAL TIME\tPER ITEM\tSHARE")
+		for _, stage := range []string{usageStageCaptions, usageStageDownload, usageStageTranscribe, usageStageExtract} {
+			s := report.Stages[stage]
+			if s == nil || s.Items == 0 {
+				continue
+			}
+			share := 0.0
+			if total > 0 {
+				share = s.Seconds / total * 100
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%.0f%%\n", stage, s.Items,
+				formatUsageTime(s.Seconds), formatUsageTime(s.Seconds/float64(s.Items)), share)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tCOMMANDS\tTIME\tPROCESSED")
+	for _, d := range report.Days {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\n", d.Day, d.Runs, formatUsageTime(d.Seconds), d.Processed)
+	}
+	return w.Flush()
+}
+
+// formatUsageTime formats seconds for the usage report, to the second
+// above a minute and the tenth of a second below
+func formatUsageTime(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second))
+	if d >= time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
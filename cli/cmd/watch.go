@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// WatchCmd polls a channel or playlist and pipelines new videos
+var WatchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Poll a channel or playlist and process new videos",
+	Long: `Poll a channel's or playlist's RSS feed every --interval and run each new
+video through the pipeline, oldest first. Feeds cost no Data API quota.
+
+Videos already in the feed when watch starts are taken as seen, so only
+later uploads are processed; --backlog processes those too. Either way
+videos the manifest records as processed, or the download archive lists,
+are skipped, so restarting watch with --backlog picks up whatever was
+published while it was down (feeds list the 15 most recent videos).
+Failed items in the manifest are retried at each poll until they have
+been attempted three times in all; items that still fail wait on
+'vkm failed list' for triage.
+
+Runs until interrupted. Requires everything 'vkm pipeline' needs, and
+takes its --transcriber, --diarize, --timestamps, --extract-model and
+--profile (see 'vkm pipeline --help'); --profile gpu watches a channel
+fully offline.
+
+Examples:
+  vkm watch --channel UCxxx --interval 1h
+  vkm watch --playlist PLxxx --interval 30m --prefer-captions
+  vkm watch --channel UCxxx --backlog --sandbox
+  vkm watch --channel UCxxx --profile gpu`,
+	RunE: runWatch,
+}
+
+var (
+	watchChannel  string
+	watchPlaylist string
+	watchInterval time.Duration
+	watchBacklog  bool
+)
+
+func init() {
+	WatchCmd.Flags().StringVar(&watchChannel, "channel", "", "YouTube channel ID (UC...) to watch")
+	WatchCmd.Flags().StringVar(&watchPlaylist, "playlist", "", "YouTube playlist ID (PL...) to watch")
+	WatchCmd.Flags().DurationVar(&watchInterval, "interval", time.Hour, "Time between feed polls")
+	WatchCmd.Flags().BoolVar(&watchBacklog, "backlog", false, "Also process videos already in the feed when watch starts")
+	WatchCmd.Flags().StringVarP(&pipelineOutputDir, "output", "o", "data/pipeline", "Working directory for pipeline files")
+	WatchCmd.Flags().StringVarP(&pipelineBackendURL, "backend", "b", "http://localhost:3000", "Backend API URL")
+	WatchCmd.Flags().DurationVar(&pipelineWaitBackend, "wait-for-backend", 0, "Wait up to this long (e.g. 60s) for the backend to become healthy")
+	WatchCmd.Flags().BoolVarP(&pipelineKeepFiles, "keep-files", "k", false, "Keep downloaded videos and transcripts after processing")
+	WatchCmd.Flags().BoolVar(&pipelineSandbox, "sandbox", false, "Write patches to a local sandbox directory instead of the backend")
+	WatchCmd.Flags().StringVar(&pipelineSandboxDir, "sandbox-dir", "data/sandbox", "Root directory for sandbox runs")
+	WatchCmd.Flags().StringVar(&pipelineManifest, "manifest", "data/manifest.db", "SQLite manifest recording item progress")
+	WatchCmd.Flags().StringVar(&ingestCollection, "collection", "", collectionFlagUsage)
+	WatchCmd.Flags().StringVar(&pipelineNames, "name-template", defaultNameTemplate, "Go template for downloaded and transcript file names")
+	WatchCmd.Flags().StringVar(&outputLayout, "layout", layoutFlat, "Output layout: flat, or per-video for a directory of files per video")
+	WatchCmd.Flags().StringVar(&pipelineCommitTime, "commit-time", commitTimeIngest, "Patch timestamp source (ingest, publish)")
+	WatchCmd.Flags().IntVar(&pipelineComments, "comments", 0, "Ingest facts from the top N comments per video (0 disables)")
+	WatchCmd.Flags().DurationVar(&pipelineChunkLength, "chunk-length", defaultChunkLength, "Transcribe recordings longer than this in chunks of this length (0 sends them whole)")
+	WatchCmd.Flags().BoolVar(&pipelineCaptions, "prefer-captions", false, "Use existing YouTube captions instead of downloading and transcribing audio")
+	WatchCmd.Flags().StringVar(&captionLangs, "caption-langs", defaultCaptionLangs, "Caption languages to accept, as yt-dlp --sub-langs")
+	WatchCmd.Flags().StringVar(&downloadArchivePath, "download-archive", defaultDownloadArchive, "File listing completed videos to skip")
+	WatchCmd.Flags().BoolVar(&downloadForce, "force", false, "Process videos even if the download archive lists them")
+	WatchCmd.Flags().StringVar(&pipelineExtractModel, "extract-model", claudeModel, "Claude model, or ollama:<model>, for sandbox fact extraction (with --sandbox)")
+	WatchCmd.Flags().StringVar(&pipelineTranscriber, "transcriber", transcriberAPI, "Transcribe with the Whisper API (api), Deepgram (deepgram), AssemblyAI (assemblyai), the local whisper CLI (local) or whisper.cpp")
+	WatchCmd.Flags().StringVar(&deepgramConfigPath, "deepgram-config", defaultDeepgramConfig, "YAML file of Deepgram settings (with --transcriber deepgram)")
+	WatchCmd.Flags().StringVar(&pipelineWhisperModel, "whisper-model", "base", "Model of local transcription (with --transcriber local or whisper.cpp)")
+	WatchCmd.Flags().StringVar(&device, "device", "cpu", "Device the local whisper CLI runs on (cpu or cuda)")
+	WatchCmd.Flags().BoolVar(&pipelineDiarize, "diarize", false, "Label the speaker of each transcript segment")
+	WatchCmd.Flags().IntVar(&pipelineSpeakers, "speakers", 0, "Number of speakers to diarize Whisper transcripts for (with --diarize; 0 detects it)")
+	WatchCmd.Flags().StringVar(&timestampGranularity, "timestamps", timestampsSegment, "Timestamp granularity: segment, or word to also time each word")
+	WatchCmd.Flags().StringVar(&runProfileName, "profile", "", "Preset of flags to apply (gpu)")
+	WatchCmd.Flags().StringVar(&pipelineQualityGates, "quality-gates", defaultQualityGates, "YAML file of quality gates that flag processed items as needing attention")
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if err := applyProfile(cmd); err != nil {
+		return err
+	}
+
+	if (watchChannel == "") == (watchPlaylist == "") {
+		return fmt.Errorf("specify exactly one of --channel or --playlist")
+	}
+	if watchInterval < time.Minute {
+		return fmt.Errorf("--interval must be at least 1m")
+	}
+	if pipelineCommitTime != commitTimeIngest && pipelineCommitTime != commitTimePublish {
+		return fmt.Errorf("unknown commit time %q (use ingest or publish)", pipelineCommitTime)
+	}
+	if pipelineExtractModel != claudeModel && !pipelineSandbox {
+		return fmt.Errorf("--extract-model only applies to --sandbox runs; the backend extracts with its own model")
+	}
+	if err := checkPipelinePrerequisites(cmd.Context()); err != nil {
+		return err
+	}
+
+	run, err := newPipelineRun(pipelineOutputDir)
+	if err != nil {
+		return err
+	}
+	defer run.Close()
+
+	var archive *downloadArchive
+	if run.sandbox == nil {
+		if archive, err = openDownloadArchive(downloadArchivePath); err != nil {
+			return err
+		}
+	}
+
+	source := "channel " + watchChannel
+	fetch := func() ([]FeedEntry, error) { return fetchChannelFeed(watchChannel) }
+	if watchPlaylist != "" {
+		source = "playlist " + watchPlaylist
+		fetch = func() ([]FeedEntry, error) { return fetchPlaylistFeed(watchPlaylist) }
+	}
+
+	fmt.Println("=== VKM Watch ===")
+	fmt.Printf("Watching %s every %s\n", source, watchInterval)
+	if run.sandbox != nil {
+		fmt.Printf("Sandbox: %s (backend will not be contacted)\n\n", run.sandbox.Dir)
+	} else {
+		fmt.Printf("Backend: %s\n\n", pipelineBackendURL)
+	}
+
+	seen := make(map[string]bool)
+	first := true
+	var counts BackfillDay
+
+	for {
+		// Items failed at earlier polls (or runs) are retried first, so a
+		// video failing now waits an interval before its next attempt
+		retried, err := retryFailedItems(ctx, run, archive)
+		if err != nil {
+			return err
+		}
+		counts.Processed += retried.Processed
+		counts.Failed += retried.Failed
+
+		entries, err := fetch()
+		if err != nil {
+			// A missed poll is retried at the next interval
+			fmt.Fprintf(os.Stderr, "Warning: failed to poll %s: %v\n", source, err)
+		} else {
+			fresh := newFeedEntries(entries, seen, first && !watchBacklog)
+			first = false
+			if len(fresh) > 0 {
+				fmt.Printf("[%s] %d new videos\n", time.Now().Format("2006-01-02 15:04"), len(fresh))
+			}
+			for _, entry := range fresh {
+				outcome, err := watchProcess(ctx, run, archive, entry)
+				if err != nil {
+					return err
+				}
+				if ctx.Err() != nil {
+					break
+				}
+				counts.Processed += outcome.Processed
+				counts.Skipped += outcome.Skipped
+				counts.Failed += outcome.Failed
+			}
+		}
+
+		if !waitForNextPoll(ctx, watchInterval) {
+			break
+		}
+	}
+
+	fmt.Printf("\nStopped watching %s: %d processed, %d skipped, %d failed\n",
+		source, counts.Processed, counts.Skipped, counts.Failed)
+	return nil
+}
+
+// newFeedEntries returns the entries not seen before, oldest first, and
+// marks every entry as seen. With baseline set nothing is returned, so the
+// first poll only records what the feed already lists.
+func newFeedEntries(entries []FeedEntry, seen map[string]bool, baseline bool) []FeedEntry {
+	var fresh []FeedEntry
+	for _, e := range entries {
+		if e.VideoID == "" || seen[e.VideoID] {
+			continue
+		}
+		seen[e.VideoID] = true
+		if !baseline {
+			fresh = append(fresh, e)
+		}
+	}
+	sort.SliceStable(fresh, func(i, j int) bool {
+		return fresh[i].PublishedAt.Before(fresh[j].PublishedAt)
+	})
+	return fresh
+}
+
+// watchProcess runs one feed entry through the pipeline unless the
+// manifest or download archive already covers it, and returns the outcome
+// as a one-video BackfillDay. Pipeline failures are outcomes; errors are
+// reserved for the manifest.
+func watchProcess(ctx context.Context, run *pipelineRun, archive *downloadArchive, entry FeedEntry) (BackfillDay, error) {
+	var outcome BackfillDay
+	item := pipelineItem{
+		URL:         entry.URL,
+		VideoID:     entry.VideoID,
+		PublishedAt: entry.PublishedAt,
+	}
+
+	if run.manifest != nil {
+		done, err := run.manifest.VideoProcessed(entry.VideoID)
+		if err != nil {
+			return outcome, err
+		}
+		if done {
+			fmt.Printf("Skipping %s (already processed)\n", entry.VideoID)
+			outcome.Skipped = 1
+			return outcome, nil
+		}
+	}
+	if archive.Skip(item) {
+		fmt.Printf("Skipping %s (in download archive; use --force to process again)\n", entry.VideoID)
+		outcome.Skipped = 1
+		return outcome, nil
+	}
+
+	fmt.Printf("New video: %s\n", entry.Title)
+	result, err := run.processItem(ctx, item)
+	if err != nil {
+		outcome.Failed = 1
+		return outcome, nil
+	}
+	archive.Add(item, result.VideoID)
+	outcome.Processed = 1
+	return outcome, nil
+}
+
+// waitForNextPoll sleeps for interval, returning false if ctx is canceled
+// first
+func waitForNextPoll(ctx context.Context, interval time.Duration) bool {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,445 @@
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Inbound webhooks are authenticated before anything is queued:
+//
+//   - WebSub (YouTube push notifications): X-Hub-Signature, an HMAC of the
+//     body keyed with the hub.secret given at subscription time
+//   - Slack: X-Slack-Signature, Slack's v0 HMAC-SHA256 over the request
+//     timestamp and body, keyed with the app's signing secret
+//   - Generic: X-Vkm-Signature, HMAC-SHA256 over "<timestamp>.<body>" with
+//     the timestamp sent in X-Vkm-Timestamp
+//
+// Timestamped schemes reject requests outside webhookMaxSkew, and every
+// accepted signature is remembered for that window so a captured request
+// cannot be replayed. WebSub signs no timestamp, so its deliveries are
+// refused once their newest entry is older than webSubMaxAge, and their
+// signatures remembered that long. An endpoint whose secret is not
+// configured is disabled rather than left open.
+
+const (
+	webhookMaxSkew  = 5 * time.Minute
+	webSubMaxAge    = 24 * time.Hour
+	webhookMaxBytes = 1 << 20
+)
+
+// webhookSecrets are read from the environment
+type webhookSecrets struct {
+	WebSub  string // VKM_WEBSUB_SECRET
+	Slack   string // SLACK_SIGNING_SECRET
+	Generic string // VKM_WEBHOOK_SECRET
+}
+
+func webhookSecretsFromEnv() webhookSecrets {
+	return webhookSecrets{
+		WebSub:  os.Getenv("VKM_WEBSUB_SECRET"),
+		Slack:   os.Getenv("SLACK_SIGNING_SECRET"),
+		Generic: os.Getenv("VKM_WEBHOOK_SECRET"),
+	}
+}
+
+// webSubChannelsFromEnv reads VKM_WEBSUB_CHANNELS, the comma-separated
+// IDs of the YouTube channels this server subscribed to
+func webSubChannelsFromEnv() map[string]bool {
+	channels := make(map[string]bool)
+	for _, id := range strings.Split(os.Getenv("VKM_WEBSUB_CHANNELS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			channels[id] = true
+		}
+	}
+	return channels
+}
+
+// replayCache remembers accepted signatures until they can no longer pass
+// the timestamp check
+type replayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	ttl  time.Duration
+}
+
+func newReplayCache(ttl time.Duration) *replayCache {
+	return &replayCache{seen: make(map[string]time.Time), ttl: ttl}
+}
+
+// Seen records key and reports whether it was already present
+func (c *replayCache) Seen(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, expires := range c.seen {
+		if now.After(expires) {
+			delete(c.seen, k)
+		}
+	}
+
+	if _, ok := c.seen[key]; ok {
+		return true
+	}
+	c.seen[key] = now.Add(c.ttl)
+	return false
+}
+
+// verifyHMAC compares a hex-encoded MAC against one computed over message
+func verifyHMAC(newHash func() hash.Hash, secret, message []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, secret)
+	mac.Write(message)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// checkTimestamp rejects unix timestamps outside the allowed skew
+func checkTimestamp(value string, now time.Time) error {
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid timestamp")
+	}
+	skew := now.Sub(time.Unix(ts, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > webhookMaxSkew {
+		return fmt.Errorf("timestamp outside allowed window")
+	}
+	return nil
+}
+
+// verifyWebSubSignature checks X-Hub-Signature ("sha1=..." or "sha256=...")
+func verifyWebSubSignature(secret string, body []byte, header string) error {
+	algo, sig, ok := strings.Cut(header, "=")
+	if !ok {
+		return fmt.Errorf("missing signature")
+	}
+	var newHash func() hash.Hash
+	switch algo {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", algo)
+	}
+	if !verifyHMAC(newHash, []byte(secret), body, sig) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// checkFeedAge rejects a WebSub delivery whose newest entry was updated
+// more than webSubMaxAge before now. Deliveries without entries (deleted
+// videos) queue nothing and pass.
+func checkFeedAge(feed youtubeFeed, now time.Time) error {
+	var newest time.Time
+	for _, e := range feed.Entries {
+		updated, err := time.Parse(time.RFC3339, orDefault(e.Updated, e.Published))
+		if err != nil {
+			return fmt.Errorf("entry without a valid update time")
+		}
+		if updated.After(newest) {
+			newest = updated
+		}
+	}
+	if len(feed.Entries) > 0 && (now.Sub(newest) > webSubMaxAge || newest.Sub(now) > webhookMaxSkew) {
+		return fmt.Errorf("delivery outside allowed window")
+	}
+	return nil
+}
+
+// webSubTopicChannel returns the channel ID of a YouTube WebSub topic
+// ("https://www.youtube.com/xml/feeds/videos.xml?channel_id=<id>")
+func webSubTopicChannel(topic string) string {
+	u, err := url.Parse(topic)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("channel_id")
+}
+
+// verifySlackSignature implements Slack's v0 request signing
+func verifySlackSignature(secret string, body []byte, timestamp, header string, now time.Time) error {
+	if err := checkTimestamp(timestamp, now); err != nil {
+		return err
+	}
+	sig, ok := strings.CutPrefix(header, "v0=")
+	if !ok {
+		return fmt.Errorf("missing signature")
+	}
+	base := append([]byte("v0:"+timestamp+":"), body...)
+	if !verifyHMAC(sha256.New, []byte(secret), base, sig) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// verifyGenericSignature checks X-Vkm-Signature over "<timestamp>.<body>"
+func verifyGenericSignature(secret string, body []byte, timestamp, header string, now time.Time) error {
+	if err := checkTimestamp(timestamp, now); err != nil {
+		return err
+	}
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return fmt.Errorf("missing signature")
+	}
+	base := append([]byte(timestamp+"."), body...)
+	if !verifyHMAC(sha256.New, []byte(secret), base, sig) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// webhookHandler authenticates inbound webhooks and queues the videos they
+// reference as pipeline jobs
+type webhookHandler struct {
+	secrets  webhookSecrets
+	manifest *Manifest
+	replays  *replayCache
+
+	// webSubChannels are the channels WebSub subscriptions are confirmed
+	// and deliveries accepted for; webSubReplays remembers deliveries
+	// for webSubMaxAge
+	webSubChannels map[string]bool
+	webSubReplays  *replayCache
+}
+
+func newWebhookHandler(secrets webhookSecrets, manifest *Manifest) *webhookHandler {
+	return &webhookHandler{
+		secrets:        secrets,
+		manifest:       manifest,
+		replays:        newReplayCache(webhookMaxSkew),
+		webSubChannels: webSubChannelsFromEnv(),
+		webSubReplays:  newReplayCache(webSubMaxAge + webhookMaxSkew),
+	}
+}
+
+// Register mounts the webhook endpoints on mux
+func (h *webhookHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/webhooks/websub", h.handleWebSub)
+	mux.HandleFunc("/webhooks/slack", h.handleSlack)
+	mux.HandleFunc("/webhooks/generic", h.handleGeneric)
+}
+
+func readWebhookBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBytes))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return nil, false
+	}
+	return body, true
+}
+
+// reject logs and answers an authentication failure without detail
+func (h *webhookHandler) reject(w http.ResponseWriter, r *http.Request, err error) {
+	fmt.Fprintf(os.Stderr, "Rejected webhook %s from %s: %v\n", r.URL.Path, r.RemoteAddr, err)
+	writeJSONError(w, http.StatusUnauthorized, "invalid signature")
+}
+
+func (h *webhookHandler) handleWebSub(w http.ResponseWriter, r *http.Request) {
+	if h.secrets.WebSub == "" {
+		writeJSONError(w, http.StatusNotFound, "websub webhook not configured")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// Subscription intent verification: echo the challenge, for
+		// subscriptions to the channels this server follows only
+		q := r.URL.Query()
+		mode := q.Get("hub.mode")
+		if (mode != "subscribe" && mode != "unsubscribe") || q.Get("hub.challenge") == "" {
+			writeJSONError(w, http.StatusBadRequest, "invalid verification request")
+			return
+		}
+		if !h.webSubChannels[webSubTopicChannel(q.Get("hub.topic"))] {
+			fmt.Fprintf(os.Stderr, "Refused WebSub %s of %q (not in VKM_WEBSUB_CHANNELS)\n", mode, q.Get("hub.topic"))
+			writeJSONError(w, http.StatusNotFound, "unknown topic")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, q.Get("hub.challenge"))
+
+	case http.MethodPost:
+		body, ok := readWebhookBody(w, r)
+		if !ok {
+			return
+		}
+		sig := r.Header.Get("X-Hub-Signature")
+		if err := verifyWebSubSignature(h.secrets.WebSub, body, sig); err != nil {
+			h.reject(w, r, err)
+			return
+		}
+
+		var feed youtubeFeed
+		if err := xml.Unmarshal(body, &feed); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid feed")
+			return
+		}
+		if err := checkFeedAge(feed, time.Now()); err != nil {
+			h.reject(w, r, err)
+			return
+		}
+		if h.webSubReplays.Seen(sig) {
+			h.reject(w, r, fmt.Errorf("replayed delivery"))
+			return
+		}
+		var urls []string
+		for _, e := range feed.Entries {
+			if e.VideoID != "" && h.webSubChannels[e.ChannelID] {
+				urls = append(urls, "https://www.youtube.com/watch?v="+e.VideoID)
+			}
+		}
+		h.enqueue(w, urls, "websub")
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *webhookHandler) handleSlack(w http.ResponseWriter, r *http.Request) {
+	if h.secrets.Slack == "" {
+		writeJSONError(w, http.StatusNotFound, "slack webhook not configured")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	body, ok := readWebhookBody(w, r)
+	if !ok {
+		return
+	}
+	sig := r.Header.Get("X-Slack-Signature")
+	err := verifySlackSignature(h.secrets.Slack, body, r.Header.Get("X-Slack-Request-Timestamp"), sig, time.Now())
+	if err != nil {
+		h.reject(w, r, err)
+		return
+	}
+	if h.replays.Seen(sig) {
+		h.reject(w, r, fmt.Errorf("replayed request"))
+		return
+	}
+
+	var text string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		// Slash command
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid form body")
+			return
+		}
+		text = form.Get("text")
+	} else {
+		// Events API
+		var event struct {
+			Type      string `json:"type"`
+			Challenge string `json:"challenge"`
+			Event     struct {
+				Text string `json:"text"`
+			} `json:"event"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if event.Type == "url_verification" {
+			writeJSON(w, http.StatusOK, map[string]string{"challenge": event.Challenge})
+			return
+		}
+		text = event.Event.Text
+	}
+
+	h.enqueue(w, extractVideoURLs(text), "slack")
+}
+
+func (h *webhookHandler) handleGeneric(w http.ResponseWriter, r *http.Request) {
+	if h.secrets.Generic == "" {
+		writeJSONError(w, http.StatusNotFound, "generic webhook not configured")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	body, ok := readWebhookBody(w, r)
+	if !ok {
+		return
+	}
+	sig := r.Header.Get("X-Vkm-Signature")
+	err := verifyGenericSignature(h.secrets.Generic, body, r.Header.Get("X-Vkm-Timestamp"), sig, time.Now())
+	if err != nil {
+		h.reject(w, r, err)
+		return
+	}
+	if h.replays.Seen(sig) {
+		h.reject(w, r, fmt.Errorf("replayed request"))
+		return
+	}
+
+	var payload struct {
+		URLs []string `json:"urls"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	h.enqueue(w, payload.URLs, "webhook")
+}
+
+func (h *webhookHandler) enqueue(w http.ResponseWriter, urls []string, origin string) {
+	if err := checkSubmittedURLs(urls); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var ids []int64
+	for _, u := range urls {
+		job, err := h.manifest.EnqueueJob(u, origin)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		ids = append(ids, job.ID)
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"queued": ids})
+}
+
+var videoURLPattern = regexp.MustCompile(`https?://(?:www\.|m\.)?(?:youtube\.com/watch\?v=|youtu\.be/)[A-Za-z0-9_-]{11}`)
+
+// extractVideoURLs finds YouTube video links in free text
+func extractVideoURLs(text string) []string {
+	return videoURLPattern.FindAllString(text, -1)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
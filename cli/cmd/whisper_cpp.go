@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// Local transcription engines of 'vkm transcribe --engine'
+const (
+	engineOpenAIWhisper = "openai-whisper"
+	engineWhisperCpp    = "whisper.cpp"
+)
+
+// transcribeEngine is the --engine of local transcription
+var transcribeEngine = engineOpenAIWhisper
+
+// whisperCppModelURL is where whisper.cpp's ggml models are published,
+// by model name
+const whisperCppModelURL = "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-%s.bin"
+
+// whisperCppModels are the ggml models whisper.cpp publishes
+var whisperCppModels = map[string]bool{
+	"tiny": true, "tiny.en": true, "base": true, "base.en": true,
+	"small": true, "small.en": true, "medium": true, "medium.en": true,
+	"large-v1": true, "large-v2": true, "large-v3": true, "large-v3-turbo": true,
+}
+
+// whisperCppModelAliases map openai-whisper model names to the ggml model
+// of the same weights
+var whisperCppModelAliases = map[string]string{
+	"large": "large-v3",
+	"turbo": "large-v3-turbo",
+}
+
+// whisperCppTools are the names whisper.cpp's command-line program is
+// installed under: whisper-cli in its own builds, whisper-cpp in Homebrew
+var whisperCppTools = []string{"whisper-cli", "whisper-cpp"}
+
+// engineHelp documents --engine for the transcribe commands
+const engineHelp = `Engines (--engine):
+  openai-whisper  the Python whisper CLI (pip install openai-whisper)
+  whisper.cpp     whisper.cpp's whisper-cli, with no Python and no API
+                  key. Build it from https://github.com/ggml-org/whisper.cpp
+                  (or brew install whisper-cpp) and put whisper-cli on PATH
+                  or in vkm's managed binary directory. The ggml model for
+                  --model is downloaded on first use into the model
+                  directory (VKM_MODEL_DIR, default <user cache>/vkm/models);
+                  'vkm deps install whisper.cpp-model@<model>' fetches one
+                  ahead of time. Without --language or a language in the
+                  .info.json, whisper.cpp detects the language itself.`
+
+// checkTranscribeEngine validates engine and that its program is installed
+func checkTranscribeEngine(engine string) error {
+	switch engine {
+	case engineOpenAIWhisper:
+		return checkWhisperInstalled()
+	case engineWhisperCpp:
+		_, err := whisperCppTool()
+		return err
+	}
+	return fmt.Errorf("unknown engine %q (use %s or %s)", engine, engineOpenAIWhisper, engineWhisperCpp)
+}
+
+// whisperCppTool returns the name whisper.cpp's program is found under
+func whisperCppTool() (string, error) {
+	for _, name := range whisperCppTools {
+		if _, err := findTool(name); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("whisper.cpp not found: build whisper-cli from https://github.com/ggml-org/whisper.cpp (or brew install whisper-cpp) and put it on PATH or in %s", managedBinDir())
+}
+
+// whisperCppModelName returns the ggml model name for model
+func whisperCppModelName(model string) (string, error) {
+	if alias, ok := whisperCppModelAliases[model]; ok {
+		model = alias
+	}
+	if !whisperCppModels[model] {
+		var names []string
+		for name := range whisperCppModels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("whisper.cpp has no model %q (available: %s)", model, strings.Join(names, ", "))
+	}
+	return model, nil
+}
+
+// whisperCppModelDir is where downloaded ggml models are kept
+func whisperCppModelDir() string {
+	if dir := os.Getenv("VKM_MODEL_DIR"); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "vkm", "models")
+	}
+	return filepath.Join(os.TempDir(), "vkm", "models")
+}
+
+// ensureWhisperCppModel returns the path of the ggml file of model,
+// downloading it first if it is missing or force is set
+func ensureWhisperCppModel(ctx context.Context, model string, force bool) (string, error) {
+	name, err := whisperCppModelName(model)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(whisperCppModelDir(), "ggml-"+name+".bin")
+	if fileExists(path) && !force {
+		return path, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	url := fmt.Sprintf(whisperCppModelURL, name)
+	fmt.Printf("Downloading whisper.cpp model %s\n", name)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	client := &http.Client{Timeout: time.Hour}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s (status %d)", url, resp.StatusCode)
+	}
+
+	// Models are written beside their final path and renamed into place,
+	// so an interrupted download never leaves a truncated model behind
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".download-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	bar := progressbar.DefaultBytes(resp.ContentLength, "  downloading")
+	n, err := io.Copy(io.MultiWriter(tmp, bar), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if resp.ContentLength > 0 && n != resp.ContentLength {
+		return "", fmt.Errorf("download of %s is incomplete (%s of %s)", url, formatBytes(n), formatBytes(resp.ContentLength))
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to install %s: %w", path, err)
+	}
+	fmt.Printf("✓ Downloaded model: %s (%s)\n", path, formatBytes(n))
+	return path, nil
+}
+
+// localTranscriptModel is the model name transcripts of engine running
+// model are recorded under, e.g. "whisper-base.en"
+func localTranscriptModel(engine, model string) string {
+	if engine == engineWhisperCpp {
+		return "whisper.cpp-" + model
+	}
+	return "whisper-" + model
+}
+
+// whisperCppThreads is how many CPU threads whisper.cpp decodes with
+func whisperCppThreads() int {
+	if n := runtime.NumCPU(); n < 8 {
+		return n
+	}
+	return 8
+}
+
+// runWhisperCpp transcribes audioPath with whisper.cpp, converting it to
+// the 16 kHz mono WAV whisper.cpp reads first. outputDir is unused: its
+// files go through a temp directory.
+func runWhisperCpp(ctx context.Context, audioPath, outputDir, model, lang string) (*localWhisperOutput, error) {
+	tool, err := whisperCppTool()
+	if err != nil {
+		return nil, err
+	}
+	modelPath, err := ensureWhisperCppModel(ctx, model, false)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := newTempDir("whisper-cpp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	wav := filepath.Join(dir, "audio.wav")
+	if out, err := toolCommand(ctx, "ffmpeg", "-nostdin", "-y", "-i", toolPath(audioPath),
+		"-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", toolPath(wav)).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed to convert audio for whisper.cpp: %v: %s", err, lastLine(string(out)))
+	}
+
+	outPrefix := filepath.Join(dir, "transcript")
+	cmd := toolCommand(ctx, tool,
+		"-m", toolPath(modelPath),
+		"-f", toolPath(wav),
+		"-l", orDefault(lang, "auto"),
+		"-t", strconv.Itoa(whisperCppThreads()),
+		"-oj", "-of", toolPath(outPrefix),
+		"-np")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("whisper.cpp failed: %w", err)
+	}
+
+	data, err := os.ReadFile(outPrefix + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read whisper.cpp output: %w", err)
+	}
+	var result struct {
+		Result struct {
+			Language string `json:"language"`
+		} `json:"result"`
+		Transcription []struct {
+			Offsets struct {
+				From int64 `json:"from"`
+				To   int64 `json:"to"`
+			} `json:"offsets"`
+			Text string `json:"text"`
+		} `json:"transcription"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse whisper.cpp output: %w", err)
+	}
+
+	out := &localWhisperOutput{Language: result.Result.Language}
+	var text []string
+	for _, seg := range result.Transcription {
+		out.Segments = append(out.Segments, localWhisperSegment{
+			Start: float64(seg.Offsets.From) / 1000,
+			End:   float64(seg.Offsets.To) / 1000,
+			Text:  seg.Text,
+		})
+		text = append(text, strings.TrimSpace(seg.Text))
+	}
+	out.Text = strings.Join(text, " ")
+	return out, nil
+}
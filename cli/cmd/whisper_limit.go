@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const whisperRateLimitHelp = `Parallel transcription:
+  --concurrency (-j) transcribes that many files at once. Requests are
+  paced to stay within the account's OpenAI rate limits: --rpm requests
+  per minute (50 by default, the lowest tier's limit for the audio
+  models; 0 for none) and, for models billed by the token
+  (gpt-4o-transcribe and its mini), --tpm audio tokens per minute,
+  counted at about 1000 per minute of audio (off by default; set it to
+  the account's limit). A request the API still turns away with 429
+  waits as long as the API asks (Retry-After), or 5s doubling up to a
+  minute, holding back every other request meanwhile, and is retried up
+  to 8 times.`
+
+// whisperRateLimitAttempts is how often a request the API answers with
+// 429 is sent before giving up. Only provably unsent requests get a 429,
+// so retrying them is never billed twice.
+const whisperRateLimitAttempts = 8
+
+// whisperTokensPerMinute estimates the audio tokens a minute of audio is
+// billed as by the token-billed transcription models
+const whisperTokensPerMinute = 1000
+
+// whisperAssumedBitrate estimates the length of audio ffprobe can't time,
+// in bytes per second (128 kbps)
+const whisperAssumedBitrate = 16000
+
+var (
+	whisperConcurrency int
+	whisperRPM         int
+	whisperTPM         int
+)
+
+// whisperLimiter paces Whisper API requests to --rpm and --tpm. It is
+// nil, and requests are sent unpaced, outside transcribe-whisper.
+var whisperLimiter *whisperRateLimiter
+
+// whisperRateLimiter holds back Whisper API requests to a number of
+// requests and audio tokens per minute, and all of them while the API
+// has asked for a pause
+type whisperRateLimiter struct {
+	requests, tokens *tokenBucket
+
+	mu     sync.Mutex
+	paused time.Time
+}
+
+// newWhisperRateLimiter paces requests to rpm requests and tpm tokens a
+// minute; a limit of 0 or less is no limit
+func newWhisperRateLimiter(rpm, tpm int) *whisperRateLimiter {
+	return &whisperRateLimiter{requests: newTokenBucket(rpm), tokens: newTokenBucket(tpm)}
+}
+
+// wait blocks until a request with the audio at path may be sent
+func (l *whisperRateLimiter) wait(ctx context.Context, path string) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		pause := time.Until(l.paused)
+		l.mu.Unlock()
+		if pause <= 0 {
+			break
+		}
+		if err := sleepContext(ctx, pause); err != nil {
+			return err
+		}
+	}
+	if err := l.requests.take(ctx, 1); err != nil {
+		return err
+	}
+	if l.tokens != nil && !whisperTimestampModels[whisperModel] {
+		return l.tokens.take(ctx, whisperAudioTokens(ctx, path))
+	}
+	return nil
+}
+
+// pause holds back every request for d, as a 429 asks
+func (l *whisperRateLimiter) pause(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.paused) {
+		l.paused = until
+	}
+}
+
+// whisperAudioTokens estimates the audio tokens transcribing path costs,
+// from its duration, or its size when ffprobe can't time it
+func whisperAudioTokens(ctx context.Context, path string) float64 {
+	seconds, err := probeDuration(ctx, path)
+	if err != nil || seconds <= 0 {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return 0
+		}
+		seconds = int(fi.Size() / whisperAssumedBitrate)
+	}
+	return float64(seconds) / 60 * whisperTokensPerMinute
+}
+
+// tokenBucket is a token bucket refilled at a rate per minute, holding
+// at most a minute's worth
+type tokenBucket struct {
+	mu       sync.Mutex
+	perMin   float64
+	tokens   float64
+	refilled time.Time
+}
+
+// newTokenBucket returns a full bucket of perMin tokens a minute, or nil
+// (which never blocks) when perMin is 0 or less
+func newTokenBucket(perMin int) *tokenBucket {
+	if perMin <= 0 {
+		return nil
+	}
+	return &tokenBucket{perMin: float64(perMin), tokens: float64(perMin), refilled: time.Now()}
+}
+
+// take blocks until n tokens are in the bucket and removes them. More
+// than the bucket holds waits for a full bucket, and empties it.
+func (b *tokenBucket) take(ctx context.Context, n float64) error {
+	if b == nil {
+		return nil
+	}
+	n = min(n, b.perMin)
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = min(b.perMin, b.tokens+now.Sub(b.refilled).Minutes()*b.perMin)
+		b.refilled = now
+		if b.tokens >= n {
+			b.tokens -= n
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((n - b.tokens) / b.perMin * float64(time.Minute))
+		b.mu.Unlock()
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// errWhisperRateLimited is a 429 answer of the Whisper API, with the wait
+// it asked for, if any. It wraps errWhisperNotSent.
+type errWhisperRateLimited struct {
+	retryAfter time.Duration
+	requestID  string
+}
+
+func (e *errWhisperRateLimited) Error() string {
+	return fmt.Sprintf("%v: rate limited (status 429, request %s)", errWhisperNotSent, e.requestID)
+}
+
+func (e *errWhisperRateLimited) Unwrap() error {
+	return errWhisperNotSent
+}
+
+// whisperRetryAfter reads the wait a 429 response asks for from its
+// Retry-After header (seconds or an HTTP date), else the time until its
+// request limit resets
+func whisperRetryAfter(h http.Header) time.Duration {
+	if v := h.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return time.Until(at)
+		}
+	}
+	// OpenAI reports resets as durations ("1s", "6m0s", "120ms")
+	if d, err := time.ParseDuration(h.Get("X-Ratelimit-Reset-Requests")); err == nil {
+		return d
+	}
+	return 0
+}
+
+// whisperRateLimitDelay is how long to wait before resending a request
+// that failed with err: what a 429 asked for, else delay
+func whisperRateLimitDelay(err error, delay time.Duration) time.Duration {
+	var limited *errWhisperRateLimited
+	if errors.As(err, &limited) && limited.retryAfter > 0 {
+		return limited.retryAfter
+	}
+	return delay
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Whisper API requests are retried up to whisperAttempts times, waiting
+// whisperRetryDelay (doubling, up to a minute) between attempts, when
+// they provably were not transcribed: the upload broke off, or the API
+// answered 5xx. A 429 is retried up to whisperRateLimitAttempts times.
+const (
+	whisperAttempts   = 3
+	whisperRetryDelay = 5 * time.Second
+)
+
+// whisperResponseTimeout is how long the API may take to answer once the
+// audio is fully uploaded. Slow uploads don't count against it.
+const whisperResponseTimeout = 10 * time.Minute
+
+// errWhisperNotSent marks a transcription request the API cannot have
+// acted on, so it is safe to resend
+var errWhisperNotSent = errors.New("transcription request not completed")
+
+// whisperCacheDir holds the responses of completed Whisper API requests,
+// so a request whose audio was transcribed is never paid for twice: a
+// rerun after a later failure (another chunk timing out, the backend
+// being down) reads them back instead of resending the audio. Override
+// with VKM_CACHE_DIR.
+var whisperCacheDir = filepath.Join(filepath.Dir(httpCacheDir), "whisper")
+
+// whisperRequestKey identifies a transcription request: the audio's
+// content (or, for a chunk, the recording's key, chunk length and
+// position) with the model, language, response format and timestamp
+// granularity asked for
+func whisperRequestKey(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		fmt.Fprintf(h, "%s\x00", p)
+	}
+	fmt.Fprintf(h, "%s\x00%s\x00%s", whisperModel, whisperLanguage, whisperResponseFormat())
+	if whisperWordTimestamps() {
+		fmt.Fprint(h, "\x00words")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// whisperFileKey is the request key of transcribing path whole
+func whisperFileKey(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return whisperRequestKey(hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// whisperChunkKey is the request key of a chunk of the recording with
+// key recordingKey, so chunks are recognized even if ffmpeg encodes them
+// differently on a rerun
+func whisperChunkKey(recordingKey string, length, overlap time.Duration, index int) string {
+	if overlap == 0 {
+		return whisperRequestKey(recordingKey, length.String(), fmt.Sprint(index))
+	}
+	return whisperRequestKey(recordingKey, length.String(), fmt.Sprint(index), "overlap="+overlap.String())
+}
+
+// cachedWhisperResponse returns the stored response of a completed
+// request, or nil
+func cachedWhisperResponse(key string) []byte {
+	data, err := os.ReadFile(filepath.Join(whisperCacheDir, key+".json"))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// storeWhisperResponse keeps a completed request's response; failing to
+// only costs a resend later, so it warns rather than fails
+func storeWhisperResponse(key string, body []byte) {
+	if err := os.MkdirAll(whisperCacheDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "  Warning: failed to cache transcription: %v\n", err)
+		return
+	}
+	path := filepath.Join(whisperCacheDir, key+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "  Warning: failed to cache transcription: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		fmt.Fprintf(os.Stderr, "  Warning: failed to cache transcription: %v\n", err)
+	}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Timestamp granularities of --timestamps
+const (
+	timestampsSegment = "segment"
+	timestampsWord    = "word"
+)
+
+// timestampsHelp describes --timestamps for commands' --help
+const timestampsHelp = `With --timestamps word, each segment of the transcript also lists its
+words with their start and end times ("words": [{"word", "start",
+"end"}]), so a fact can be anchored to the moment it is said rather
+than the start of its segment. The Whisper API (whisper-1), the local
+whisper CLI, Deepgram and AssemblyAI time words; whisper.cpp and models
+without timestamps keep segment timestamps only.`
+
+// timestampGranularity is --timestamps: segment, or word to also time
+// each word where the transcriber supports it
+var timestampGranularity = timestampsSegment
+
+// TranscriptWord is one word of a segment, timed like the segment
+type TranscriptWord struct {
+	Word  string  `json:"word"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// wordTimestamps reports whether --timestamps asks for word timestamps
+func wordTimestamps() bool {
+	return timestampGranularity == timestampsWord
+}
+
+// checkTimestamps checks --timestamps, and warns when the transcriber
+// (a --transcriber or --engine value) can't time words
+func checkTimestamps(transcriber string) error {
+	switch timestampGranularity {
+	case timestampsSegment:
+		return nil
+	case timestampsWord:
+	default:
+		return fmt.Errorf("unknown --timestamps %q (use segment or word)", timestampGranularity)
+	}
+	switch transcriber {
+	case engineWhisperCpp:
+		fmt.Fprintln(os.Stderr, "Warning: whisper.cpp doesn't time words; transcripts keep segment timestamps")
+	case transcriberAPI:
+		if !whisperTimestampModels[whisperModel] {
+			fmt.Fprintf(os.Stderr, "Warning: %s doesn't time words; transcripts keep segment timestamps\n", whisperModel)
+		}
+	}
+	return nil
+}
+
+// assignWords adds words to the segments they are spoken in: each word
+// goes to the last segment starting at or before it. Segments must be in
+// order.
+func assignWords(t *Transcript, words []TranscriptWord) {
+	for _, w := range words {
+		i := sort.Search(len(t.Transcript), func(i int) bool { return t.Transcript[i].Timestamp > w.Start }) - 1
+		if i < 0 {
+			i = 0
+		}
+		if len(t.Transcript) > 0 {
+			t.Transcript[i].Words = append(t.Transcript[i].Words, w)
+		}
+	}
+}
+
+// trimWords returns words with the spaces transcribers pad them with
+// trimmed, dropping empty ones
+func trimWords(words []TranscriptWord) []TranscriptWord {
+	var trimmed []TranscriptWord
+	for _, w := range words {
+		if w.Word = strings.TrimSpace(w.Word); w.Word != "" {
+			trimmed = append(trimmed, w)
+		}
+	}
+	return trimmed
+}
+
+// moveTimes maps the times of a transcript's segments and words with
+// move, as when SponsorBlock cuts are undone
+func (t *Transcript) moveTimes(move func(float64) float64) {
+	for i := range t.Transcript {
+		seg := &t.Transcript[i]
+		seg.Timestamp = move(seg.Timestamp)
+		for j := range seg.Words {
+			seg.Words[j].Start = move(seg.Words[j].Start)
+			seg.Words[j].End = move(seg.Words[j].End)
+		}
+	}
+}
+
+// hasWords reports whether a transcript's words are timed
+func (t *Transcript) hasWords() bool {
+	if t == nil {
+		return false
+	}
+	for _, seg := range t.Transcript {
+		if len(seg.Words) > 0 {
+			return true
+		}
+	}
+	return false
+}
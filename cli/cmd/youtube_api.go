@@ -0,0 +1,443 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+// youtubeQuotaAPI is the api key used for Data API rows in the manifest
+const youtubeQuotaAPI = "youtube-data-v3"
+
+// youtubeQuotaCosts are the documented units charged per Data API call.
+// See https://developers.google.com/youtube/v3/determine_quota_cost
+var youtubeQuotaCosts = map[string]int{
+	"channels.list":       1,
+	"playlistItems.list":  1,
+	"playlists.list":      1,
+	"videos.list":         1,
+	"commentThreads.list": 1,
+	"search.list":         100,
+}
+
+// defaultYouTubeDailyQuota is the quota Google grants new projects
+const defaultYouTubeDailyQuota = 10000
+
+// errQuotaExhausted is returned instead of calling the API once the day's
+// budget is spent
+var errQuotaExhausted = errors.New("YouTube Data API daily quota exhausted")
+
+// youtubeQuotaLocation is where quota days begin: Google resets Data API
+// quota at midnight Pacific Time
+var youtubeQuotaLocation = func() *time.Location {
+	if loc, err := time.LoadLocation("America/Los_Angeles"); err == nil {
+		return loc
+	}
+	return time.FixedZone("PT", -8*60*60)
+}()
+
+// youtubeQuotaDay returns the quota day a moment falls in
+func youtubeQuotaDay(t time.Time) string {
+	return t.In(youtubeQuotaLocation).Format("2006-01-02")
+}
+
+// youtubeAPIKey returns the Data API key from YOUTUBE_API_KEY
+func youtubeAPIKey() string {
+	return os.Getenv("YOUTUBE_API_KEY")
+}
+
+// youtubeDailyQuota returns the configured daily budget. Set
+// VKM_YOUTUBE_QUOTA to stay below Google's limit when the key is shared.
+func youtubeDailyQuota() int {
+	if v, err := strconv.Atoi(os.Getenv("VKM_YOUTUBE_QUOTA")); err == nil && v > 0 {
+		return v
+	}
+	return defaultYouTubeDailyQuota
+}
+
+// youtubeDataClient wraps the Data API service with quota accounting.
+// Every call is charged against a daily budget persisted in the manifest,
+// so separate invocations (and the daemon) share one view of what's left.
+type youtubeDataClient struct {
+	svc      *youtube.Service
+	manifest *Manifest
+	limit    int
+}
+
+// apiKeyTransport adds the API key to every request. The generated client
+// ignores option.WithAPIKey when a custom HTTP client is supplied.
+type apiKeyTransport struct {
+	key  string
+	next http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	q := req.URL.Query()
+	q.Set("key", t.key)
+	req.URL.RawQuery = q.Encode()
+	return t.next.RoundTrip(req)
+}
+
+// newYouTubeDataClient creates a quota-aware Data API client
+func newYouTubeDataClient(ctx context.Context, apiKey string, manifest *Manifest) (*youtubeDataClient, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("YouTube Data API key not set (use YOUTUBE_API_KEY)")
+	}
+
+	httpClient := newCachedHTTPClient(30 * time.Second)
+	httpClient.Transport = &apiKeyTransport{key: apiKey, next: httpClient.Transport}
+
+	svc, err := youtube.NewService(ctx, option.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create YouTube client: %w", err)
+	}
+
+	return &youtubeDataClient{svc: svc, manifest: manifest, limit: youtubeDailyQuota()}, nil
+}
+
+// Remaining returns the units left in today's budget
+func (c *youtubeDataClient) Remaining() (int, error) {
+	usage, err := c.manifest.QuotaUsage(youtubeQuotaAPI, youtubeQuotaDay(time.Now()))
+	if err != nil {
+		return 0, err
+	}
+	used := 0
+	for _, units := range usage {
+		used += units
+	}
+	return c.limit - used, nil
+}
+
+// spend charges an endpoint call against the budget, refusing it when the
+// budget can't cover the cost
+func (c *youtubeDataClient) spend(endpoint string) error {
+	cost := youtubeQuotaCosts[endpoint]
+	remaining, err := c.Remaining()
+	if err != nil {
+		return err
+	}
+	if remaining < cost {
+		return errQuotaExhausted
+	}
+	return c.manifest.AddQuotaUsage(youtubeQuotaAPI, youtubeQuotaDay(time.Now()), endpoint, cost)
+}
+
+// checkQuotaError marks the day's budget as spent when Google reports the
+// quota exceeded, so later calls fail fast, and maps the error
+func (c *youtubeDataClient) checkQuotaError(endpoint string, err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return err
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == "quotaExceeded" || item.Reason == "dailyLimitExceeded" {
+			if remaining, rerr := c.Remaining(); rerr == nil && remaining > 0 {
+				c.manifest.AddQuotaUsage(youtubeQuotaAPI, youtubeQuotaDay(time.Now()), endpoint, remaining)
+			}
+			return errQuotaExhausted
+		}
+	}
+	return err
+}
+
+// UploadsPlaylistID returns the ID of the playlist holding a channel's uploads
+func (c *youtubeDataClient) UploadsPlaylistID(ctx context.Context, channelID string) (string, error) {
+	if err := c.spend("channels.list"); err != nil {
+		return "", err
+	}
+
+	resp, err := c.svc.Channels.List([]string{"contentDetails"}).Id(channelID).Context(ctx).Do()
+	if err != nil {
+		return "", c.checkQuotaError("channels.list", fmt.Errorf("failed to look up channel %s: %w", channelID, err))
+	}
+	if len(resp.Items) == 0 || resp.Items[0].ContentDetails == nil || resp.Items[0].ContentDetails.RelatedPlaylists == nil {
+		return "", fmt.Errorf("channel %s not found", channelID)
+	}
+
+	return resp.Items[0].ContentDetails.RelatedPlaylists.Uploads, nil
+}
+
+// PlaylistEntries pages through a playlist, calling fn for each entry until
+// fn returns false or the playlist ends
+func (c *youtubeDataClient) PlaylistEntries(ctx context.Context, playlistID string, fn func(FeedEntry) bool) error {
+	pageToken := ""
+	for {
+		page, err := c.PlaylistPage(ctx, playlistID, pageToken)
+		if err != nil {
+			return err
+		}
+		for _, entry := range page.Entries {
+			if !fn(entry) {
+				return nil
+			}
+		}
+		if page.NextToken == "" {
+			return nil
+		}
+		pageToken = page.NextToken
+	}
+}
+
+// playlistPage is one page of up to 50 playlist entries
+type playlistPage struct {
+	Entries   []FeedEntry
+	NextToken string
+	Total     int64
+}
+
+// PlaylistPage fetches the page of a playlist starting at pageToken ("" for
+// the first page). Tokens can be stored to resume listing later.
+func (c *youtubeDataClient) PlaylistPage(ctx context.Context, playlistID, pageToken string) (*playlistPage, error) {
+	if err := c.spend("playlistItems.list"); err != nil {
+		return nil, err
+	}
+
+	call := c.svc.PlaylistItems.List([]string{"snippet", "contentDetails"}).
+		PlaylistId(playlistID).
+		MaxResults(50).
+		Context(ctx)
+	if pageToken != "" {
+		call = call.PageToken(pageToken)
+	}
+
+	resp, err := call.Do()
+	if err != nil {
+		return nil, c.checkQuotaError("playlistItems.list", fmt.Errorf("failed to list playlist %s: %w", playlistID, err))
+	}
+
+	page := &playlistPage{NextToken: resp.NextPageToken}
+	if resp.PageInfo != nil {
+		page.Total = resp.PageInfo.TotalResults
+	}
+	for _, item := range resp.Items {
+		if item.ContentDetails == nil || item.Snippet == nil {
+			continue
+		}
+		published, _ := time.Parse(time.RFC3339, item.ContentDetails.VideoPublishedAt)
+		page.Entries = append(page.Entries, FeedEntry{
+			VideoID:     item.ContentDetails.VideoId,
+			Title:       item.Snippet.Title,
+			ChannelID:   item.Snippet.VideoOwnerChannelId,
+			PublishedAt: published,
+			URL:         "https://www.youtube.com/watch?v=" + item.ContentDetails.VideoId,
+		})
+	}
+	return page, nil
+}
+
+// listChannelVideos enumerates a channel's uploads, newest first, stopping
+// after max entries (0 means no limit). Only videos published in
+// [after, before) are returned; zero times leave that side open, and paging
+// stops at the first upload older than after. It uses the Data API when a
+// key is given and quota remains, and otherwise degrades to the channel's
+// RSS feed, which only covers the most recent uploads.
+func listChannelVideos(ctx context.Context, channelID string, max int, after, before time.Time, apiKey string, manifest *Manifest) ([]FeedEntry, error) {
+	var entries []FeedEntry
+	collect := func(e FeedEntry) bool {
+		if e.PublishedAt.IsZero() && !(after.IsZero() && before.IsZero()) {
+			return true
+		}
+		if !before.IsZero() && !e.PublishedAt.Before(before) {
+			return true
+		}
+		if !after.IsZero() && e.PublishedAt.Before(after) {
+			return false
+		}
+		entries = append(entries, e)
+		return max <= 0 || len(entries) < max
+	}
+
+	if apiKey != "" && manifest != nil {
+		client, err := newYouTubeDataClient(ctx, apiKey, manifest)
+		if err != nil {
+			return nil, err
+		}
+
+		uploads, err := client.UploadsPlaylistID(ctx, channelID)
+		if err == nil {
+			err = client.PlaylistEntries(ctx, uploads, collect)
+		}
+		if err == nil {
+			return entries, nil
+		}
+		if !errors.Is(err, errQuotaExhausted) {
+			return nil, err
+		}
+
+		fmt.Fprintf(os.Stderr, "Warning: %v; falling back to RSS feed (most recent uploads only)\n", err)
+	}
+
+	feed, err := fetchChannelFeed(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep anything the API already returned and top up from the feed
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		seen[e.VideoID] = true
+	}
+	for _, e := range feed {
+		if seen[e.VideoID] {
+			continue
+		}
+		if !collect(e) {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// TopComments returns up to max top-level comments on a video, ordered by
+// YouTube's relevance ranking
+func (c *youtubeDataClient) TopComments(ctx context.Context, videoID string, max int) ([]VideoComment, error) {
+	if err := c.spend("commentThreads.list"); err != nil {
+		return nil, err
+	}
+
+	if max > 100 {
+		max = 100
+	}
+	resp, err := c.svc.CommentThreads.List([]string{"snippet"}).
+		VideoId(videoID).
+		Order("relevance").
+		TextFormat("plainText").
+		MaxResults(int64(max)).
+		Context(ctx).
+		Do()
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden {
+			for _, item := range apiErr.Errors {
+				if item.Reason == "commentsDisabled" {
+					return nil, nil
+				}
+			}
+		}
+		return nil, c.checkQuotaError("commentThreads.list", fmt.Errorf("failed to list comments on %s: %w", videoID, err))
+	}
+
+	comments := make([]VideoComment, 0, len(resp.Items))
+	for _, thread := range resp.Items {
+		if thread.Snippet == nil || thread.Snippet.TopLevelComment == nil || thread.Snippet.TopLevelComment.Snippet == nil {
+			continue
+		}
+		snippet := thread.Snippet.TopLevelComment.Snippet
+		published, _ := time.Parse(time.RFC3339, snippet.PublishedAt)
+		comments = append(comments, VideoComment{
+			ID:          thread.Id,
+			Author:      snippet.AuthorDisplayName,
+			Text:        snippet.TextDisplay,
+			LikeCount:   snippet.LikeCount,
+			ReplyCount:  thread.Snippet.TotalReplyCount,
+			PublishedAt: published,
+		})
+	}
+	return comments, nil
+}
+
+// VideoAvailability looks up to 50 videos and returns the availability and
+// license of each one the API still knows. Private and deleted videos are
+// missing from the response rather than reported.
+func (c *youtubeDataClient) VideoAvailability(ctx context.Context, ids []string) (map[string]sourceStatus, error) {
+	if err := c.spend("videos.list"); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.svc.Videos.List([]string{"status", "contentDetails"}).Id(ids...).Context(ctx).Do()
+	if err != nil {
+		return nil, c.checkQuotaError("videos.list", fmt.Errorf("failed to look up videos: %w", err))
+	}
+
+	statuses := make(map[string]sourceStatus, len(resp.Items))
+	for _, v := range resp.Items {
+		s := sourceStatus{VideoID: v.Id, Status: sourceAvailable}
+		if v.Status != nil {
+			if l, ok := licenseFromYouTube(v.Status.License); ok {
+				s.License = &l
+			}
+			switch {
+			case v.Status.UploadStatus == "deleted" || v.Status.UploadStatus == "rejected" || v.Status.UploadStatus == "failed":
+				s.Status = sourceRemoved
+				s.Reason = strings.TrimSpace(v.Status.UploadStatus + " " + v.Status.RejectionReason + v.Status.FailureReason)
+			case v.Status.PrivacyStatus == "private":
+				s.Status, s.Reason = sourcePrivate, "private"
+			case v.Status.PrivacyStatus == "unlisted":
+				s.Status, s.Reason = sourceAtRisk, "unlisted"
+			}
+		}
+		if s.Status == sourceAvailable && v.ContentDetails != nil {
+			switch {
+			case v.ContentDetails.ContentRating != nil && v.ContentDetails.ContentRating.YtRating == "ytAgeRestricted":
+				s.Status, s.Reason = sourceAtRisk, "age-restricted"
+			case v.ContentDetails.RegionRestriction != nil && len(v.ContentDetails.RegionRestriction.Blocked) > 0:
+				s.Status, s.Reason = sourceAtRisk, "blocked in some regions"
+			}
+		}
+		statuses[v.Id] = s
+	}
+	return statuses, nil
+}
+
+// videoDetails is what the Data API says of a video's title and length
+type videoDetails struct {
+	Title    string
+	Duration time.Duration
+}
+
+// youtubeDurationPattern matches the ISO 8601 durations the Data API
+// gives video lengths in (P1DT2H3M4S, PT45S, P0D)
+var youtubeDurationPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseYouTubeDuration parses a Data API video length, returning 0 for
+// one it can't read
+func parseYouTubeDuration(s string) time.Duration {
+	m := youtubeDurationPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		n, _ := strconv.Atoi(m[i+1])
+		d += time.Duration(n) * unit
+	}
+	return d
+}
+
+// VideoDetails looks up the titles and lengths of up to 50 videos. Videos
+// the API doesn't know are missing from the result.
+func (c *youtubeDataClient) VideoDetails(ctx context.Context, ids []string) (map[string]videoDetails, error) {
+	if err := c.spend("videos.list"); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.svc.Videos.List([]string{"snippet", "contentDetails"}).Id(ids...).Context(ctx).Do()
+	if err != nil {
+		return nil, c.checkQuotaError("videos.list", fmt.Errorf("failed to look up videos: %w", err))
+	}
+
+	details := make(map[string]videoDetails, len(resp.Items))
+	for _, v := range resp.Items {
+		var d videoDetails
+		if v.Snippet != nil {
+			d.Title = v.Snippet.Title
+		}
+		if v.ContentDetails != nil {
+			d.Duration = parseYouTubeDuration(v.ContentDetails.Duration)
+		}
+		details[v.Id] = d
+	}
+	return details, nil
+}
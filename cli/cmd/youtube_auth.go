@@ -0,0 +1,528 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// AuthCmd manages the YouTube login used for restricted videos
+var AuthCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Sign in to YouTube to download age-restricted and region-locked videos",
+	Long: `Sign in to a YouTube account with OAuth, so videos it is entitled to
+watch (age-restricted ones, or region-locked ones its region allows) can
+be downloaded. Signing in is optional; without it such videos fail to
+download as before.
+
+'vkm auth login' uses Google's device flow: it prints a code to enter at
+google.com/device on any device, and waits until you have approved it.
+It needs an OAuth client of the "TVs and Limited Input devices" type
+from a Google Cloud project, given with --oauth-client-id and
+--oauth-client-secret or VKM_YOUTUBE_CLIENT_ID and
+VKM_YOUTUBE_CLIENT_SECRET.
+
+The tokens are kept in the system keychain (macOS Keychain, or the
+Secret Service through secret-tool on Linux), else in a file only you
+can read in the user config directory. vkm refreshes them as needed.
+
+While signed in, yt-dlp gets the access token as an Authorization header
+for YouTube URLs only, with YouTube's TV client (the one that accepts
+OAuth tokens), and the built-in client sends it to YouTube hosts.
+
+Examples:
+  vkm auth login --oauth-client-id 123.apps.googleusercontent.com --oauth-client-secret XXX
+  vkm auth status
+  vkm auth logout`,
+}
+
+// AuthLoginCmd runs the OAuth device flow
+var AuthLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Sign in to YouTube with the OAuth device flow",
+	Args:  cobra.NoArgs,
+	RunE:  runAuthLogin,
+}
+
+// AuthLogoutCmd forgets the stored tokens
+var AuthLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the stored YouTube tokens",
+	Args:  cobra.NoArgs,
+	RunE:  runAuthLogout,
+}
+
+// AuthStatusCmd reports whether vkm is signed in
+var AuthStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether YouTube tokens are stored and still valid",
+	Args:  cobra.NoArgs,
+	RunE:  runAuthStatus,
+}
+
+var (
+	oauthClientID     string
+	oauthClientSecret string
+)
+
+func init() {
+	AuthCmd.AddCommand(AuthLoginCmd)
+	AuthCmd.AddCommand(AuthLogoutCmd)
+	AuthCmd.AddCommand(AuthStatusCmd)
+
+	AuthLoginCmd.Flags().StringVar(&oauthClientID, "oauth-client-id", "", "OAuth client ID (default $VKM_YOUTUBE_CLIENT_ID)")
+	AuthLoginCmd.Flags().StringVar(&oauthClientSecret, "oauth-client-secret", "", "OAuth client secret (default $VKM_YOUTUBE_CLIENT_SECRET)")
+}
+
+// Google's OAuth endpoints for the device flow
+var (
+	googleDeviceCodeURL = "https://oauth2.googleapis.com/device/code"
+	googleTokenURL      = "https://oauth2.googleapis.com/token"
+)
+
+// youtubeOAuthScope grants access to the account's YouTube data
+const youtubeOAuthScope = "https://www.googleapis.com/auth/youtube"
+
+// tokenRefreshMargin is how long before expiry an access token is renewed
+const tokenRefreshMargin = time.Minute
+
+// youtubeToken is a stored login. The client it was issued to is kept
+// with it, as refreshing needs the same client.
+type youtubeToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret"`
+}
+
+// oauthTokenResponse is the token endpoint's answer
+type oauthTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func runAuthLogin(cmd *cobra.Command, args []string) error {
+	id := orDefault(oauthClientID, os.Getenv("VKM_YOUTUBE_CLIENT_ID"))
+	secret := orDefault(oauthClientSecret, os.Getenv("VKM_YOUTUBE_CLIENT_SECRET"))
+	if id == "" || secret == "" {
+		return fmt.Errorf("an OAuth client is required: pass --oauth-client-id and --oauth-client-secret, or set VKM_YOUTUBE_CLIENT_ID and VKM_YOUTUBE_CLIENT_SECRET")
+	}
+
+	token, err := deviceFlowLogin(cmd.Context(), id, secret)
+	if err != nil {
+		return err
+	}
+	where, err := saveYouTubeToken(token)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Signed in; tokens stored in %s\n", where)
+	return nil
+}
+
+func runAuthLogout(cmd *cobra.Command, args []string) error {
+	removed, err := deleteYouTubeToken()
+	if err != nil {
+		return err
+	}
+	if !removed {
+		fmt.Println("Not signed in")
+		return nil
+	}
+	fmt.Println("✓ Signed out; stored tokens removed")
+	fmt.Println("  (revoke vkm's access at https://myaccount.google.com/permissions to invalidate them)")
+	return nil
+}
+
+func runAuthStatus(cmd *cobra.Command, args []string) error {
+	token, where, err := loadYouTubeToken()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		fmt.Println("Not signed in (run 'vkm auth login')")
+		return nil
+	}
+	fmt.Printf("Signed in; tokens stored in %s\n", where)
+	if _, err := freshYouTubeToken(cmd.Context(), token); err != nil {
+		return fmt.Errorf("stored tokens no longer work (run 'vkm auth login' again): %w", err)
+	}
+	fmt.Println("✓ Access token is valid")
+	return nil
+}
+
+// deviceFlowLogin asks the user to approve a device code and waits for
+// Google to issue tokens for it
+func deviceFlowLogin(ctx context.Context, clientID, clientSecret string) (*youtubeToken, error) {
+	var code struct {
+		DeviceCode      string `json:"device_code"`
+		UserCode        string `json:"user_code"`
+		VerificationURL string `json:"verification_url"`
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+	}
+	if err := postOAuthForm(ctx, googleDeviceCodeURL, url.Values{
+		"client_id": {clientID},
+		"scope":     {youtubeOAuthScope},
+	}, &code); err != nil {
+		return nil, fmt.Errorf("failed to start sign-in: %w", err)
+	}
+
+	fmt.Printf("Go to %s and enter the code: %s\n", code.VerificationURL, code.UserCode)
+	fmt.Println("Waiting for approval...")
+
+	interval := time.Duration(max(code.Interval, 5)) * time.Second
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		var resp oauthTokenResponse
+		err := postOAuthForm(ctx, googleTokenURL, url.Values{
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+			"device_code":   {code.DeviceCode},
+			"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+		}, &resp)
+		switch {
+		case resp.Error == "authorization_pending":
+			continue
+		case resp.Error == "slow_down":
+			interval += 5 * time.Second
+			continue
+		case resp.Error == "access_denied":
+			return nil, fmt.Errorf("sign-in was declined")
+		case err != nil:
+			return nil, fmt.Errorf("sign-in failed: %w", err)
+		}
+		return &youtubeToken{
+			AccessToken:  resp.AccessToken,
+			RefreshToken: resp.RefreshToken,
+			Expiry:       time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second),
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+		}, nil
+	}
+	return nil, fmt.Errorf("the code expired before it was approved; run 'vkm auth login' again")
+}
+
+// freshYouTubeToken returns t's access token, refreshing it (and storing
+// the refreshed token) when it is about to expire
+func freshYouTubeToken(ctx context.Context, t *youtubeToken) (string, error) {
+	if time.Until(t.Expiry) > tokenRefreshMargin {
+		return t.AccessToken, nil
+	}
+	var resp oauthTokenResponse
+	if err := postOAuthForm(ctx, googleTokenURL, url.Values{
+		"client_id":     {t.ClientID},
+		"client_secret": {t.ClientSecret},
+		"refresh_token": {t.RefreshToken},
+		"grant_type":    {"refresh_token"},
+	}, &resp); err != nil {
+		return "", fmt.Errorf("failed to refresh YouTube access token: %w", err)
+	}
+	t.AccessToken = resp.AccessToken
+	t.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	if resp.RefreshToken != "" {
+		t.RefreshToken = resp.RefreshToken
+	}
+	if _, err := saveYouTubeToken(t); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return t.AccessToken, nil
+}
+
+// postOAuthForm posts form to an OAuth endpoint and decodes its JSON
+// answer into out, which is filled in on errors too so callers can read
+// the error code
+func postOAuthForm(ctx context.Context, endpoint string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("unexpected response (status %d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e oauthTokenResponse
+		json.Unmarshal(body, &e)
+		return fmt.Errorf("%s (status %d): %s", orDefault(e.Error, "error"), resp.StatusCode, e.ErrorDescription)
+	}
+	return nil
+}
+
+// Where tokens are kept in the system keychain
+const (
+	keychainService = "vkm"
+	keychainAccount = "youtube-oauth"
+)
+
+// keychainTool returns the keychain command of this system, or "" when
+// tokens go to youtubeTokenFile instead
+func keychainTool() string {
+	var tool string
+	switch runtime.GOOS {
+	case "darwin":
+		tool = "security"
+	case "linux", "freebsd", "openbsd":
+		tool = "secret-tool"
+	default:
+		return ""
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return ""
+	}
+	return tool
+}
+
+// youtubeTokenFile is where tokens are kept without a keychain
+func youtubeTokenFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no keychain and no config directory to store tokens in: %w", err)
+	}
+	return filepath.Join(dir, "vkm", "youtube-oauth.json"), nil
+}
+
+// keychainLookup returns the tokens tool holds, or nil
+func keychainLookup(tool string) []byte {
+	var data []byte
+	switch tool {
+	case "security":
+		data, _ = exec.Command(tool, "find-generic-password", "-s", keychainService, "-a", keychainAccount, "-w").Output()
+	case "secret-tool":
+		data, _ = exec.Command(tool, "lookup", "service", keychainService, "account", keychainAccount).Output()
+	}
+	return data
+}
+
+// saveYouTubeToken stores t, returning where
+func saveYouTubeToken(t *youtubeToken) (string, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode tokens: %w", err)
+	}
+	var c *exec.Cmd
+	tool := keychainTool()
+	switch tool {
+	case "security":
+		// Commands read from stdin with -i, with the tokens in hex, keep
+		// them off the command line, where any local user can read them
+		c = exec.Command(tool, "-i")
+		c.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -X %x\n", keychainService, keychainAccount, data))
+	case "secret-tool":
+		c = exec.Command(tool, "store", "--label=vkm YouTube login", "service", keychainService, "account", keychainAccount)
+		c.Stdin = bytes.NewReader(data)
+	}
+	if c != nil {
+		out, err := c.CombinedOutput()
+		// security -i goes on after a failed command, so what was stored
+		// is read back
+		if err == nil && !bytes.Equal(bytes.TrimSpace(keychainLookup(tool)), data) {
+			err = fmt.Errorf("the tokens read back differ")
+		}
+		if err == nil {
+			return "the system keychain", nil
+		}
+		fmt.Fprintf(os.Stderr, "Warning: keychain unavailable (%v: %s); storing tokens in a file\n", err, strings.TrimSpace(string(out)))
+	}
+
+	path, err := youtubeTokenFile()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to store tokens: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to store tokens: %w", err)
+	}
+	return path, nil
+}
+
+// loadYouTubeToken returns the stored login and where it is kept, or nil
+// when not signed in
+func loadYouTubeToken() (*youtubeToken, string, error) {
+	where := "the system keychain"
+	data := keychainLookup(keychainTool())
+	if len(bytes.TrimSpace(data)) == 0 {
+		path, err := youtubeTokenFile()
+		if err != nil {
+			return nil, "", nil
+		}
+		data, err = os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read tokens: %w", err)
+		}
+		where = path
+	}
+	var t youtubeToken
+	if err := json.Unmarshal(bytes.TrimSpace(data), &t); err != nil {
+		return nil, "", fmt.Errorf("stored tokens in %s are unreadable (run 'vkm auth login' again): %w", where, err)
+	}
+	return &t, where, nil
+}
+
+// deleteYouTubeToken removes the stored login from the keychain and the
+// token file, reporting whether there was one
+func deleteYouTubeToken() (bool, error) {
+	t, _, err := loadYouTubeToken()
+	if err != nil || t == nil {
+		return false, err
+	}
+	switch tool := keychainTool(); tool {
+	case "security":
+		exec.Command(tool, "delete-generic-password", "-s", keychainService, "-a", keychainAccount).Run()
+	case "secret-tool":
+		exec.Command(tool, "clear", "service", keychainService, "account", keychainAccount).Run()
+	}
+	if path, err := youtubeTokenFile(); err == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return true, nil
+}
+
+// youtubeAuth is the login downloads use, loaded on first use
+var youtubeAuth struct {
+	sync.Mutex
+	loaded bool
+	token  *youtubeToken
+}
+
+// youtubeAccessToken returns a valid access token when signed in, or ""
+// (after a warning, if the stored login no longer works)
+func youtubeAccessToken(ctx context.Context) string {
+	youtubeAuth.Lock()
+	defer youtubeAuth.Unlock()
+	if !youtubeAuth.loaded {
+		youtubeAuth.loaded = true
+		t, _, err := loadYouTubeToken()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		youtubeAuth.token = t
+	}
+	if youtubeAuth.token == nil {
+		return ""
+	}
+	access, err := freshYouTubeToken(ctx, youtubeAuth.token)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; downloading without signing in (run 'vkm auth login' again)\n", err)
+		youtubeAuth.token = nil
+		return ""
+	}
+	return access
+}
+
+// youtubeAuthArgs returns the yt-dlp options signing in to YouTube when
+// args download from it, and a func removing the file they name once
+// yt-dlp is done. Other sites never see the token. It is handed over in
+// a config file only the user can read, since any local user can read a
+// command line.
+func youtubeAuthArgs(ctx context.Context, args []string) ([]string, func()) {
+	onYouTube := false
+	for _, a := range args {
+		if siteForURL(a) == siteYouTube {
+			onYouTube = true
+			break
+		}
+	}
+	if !onYouTube {
+		return nil, func() {}
+	}
+	access := youtubeAccessToken(ctx)
+	if access == "" {
+		return nil, func() {}
+	}
+
+	f, err := newTempFile("youtube-auth-*.conf")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; downloading without signing in\n", err)
+		return nil, func() {}
+	}
+	remove := func() { os.Remove(f.Name()) }
+	err = f.Chmod(0600)
+	if err == nil {
+		_, err = fmt.Fprintf(f, "--add-header \"Authorization:Bearer %s\"\n", access)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		remove()
+		fmt.Fprintf(os.Stderr, "Warning: failed to write the YouTube login for yt-dlp: %v; downloading without signing in\n", err)
+		return nil, func() {}
+	}
+	return []string{
+		"--config-locations", toolPath(f.Name()),
+		"--extractor-args", "youtube:player_client=tv",
+	}, remove
+}
+
+// youtubeAuthTransport sends the access token to YouTube hosts, for the
+// built-in client
+type youtubeAuthTransport struct {
+	next http.RoundTripper
+}
+
+func (t *youtubeAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	if host == "youtube.com" || strings.HasSuffix(host, ".youtube.com") {
+		if access := youtubeAccessToken(req.Context()); access != "" {
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", "Bearer "+access)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// youtubeAuthHint suggests signing in when yt-dlp's output says a video
+// needs an account, and vkm isn't signed in
+func youtubeAuthHint(stderr string) string {
+	for _, fragment := range []string{"Sign in to confirm your age", "age-restricted", "not available in your country", "uploader has not made this video available"} {
+		if strings.Contains(stderr, fragment) {
+			if t, _, _ := loadYouTubeToken(); t == nil {
+				return " (an account that can watch it may help: see 'vkm auth login')"
+			}
+			return ""
+		}
+	}
+	return ""
+}
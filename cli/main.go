@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/epistemicSystems/vkm-graph/cli/cmd"
 	"github.com/spf13/cobra"
@@ -17,21 +20,91 @@ knowledge sources (YouTube videos) for the Knowledge Graph Evolution System.
 The system treats knowledge patches as points in a moduli stack, with commits
 as morphisms that trace understanding evolution over time.`,
 	Version: "0.1.0",
+	PersistentPreRunE: func(c *cobra.Command, args []string) error {
+		cmd.StartUsage(c)
+		if err := cmd.SetTempRoot(tempDir); err != nil {
+			return err
+		}
+		if err := cmd.SetProxy(proxy); err != nil {
+			return err
+		}
+		return cmd.SetIdentity(userAgent, clientID)
+	},
 }
 
+var (
+	proxy     string
+	tempDir   string
+	userAgent string
+	clientID  string
+)
+
 func init() {
+	rootCmd.PersistentFlags().StringVar(&proxy, "proxy", "", "HTTP(S) or SOCKS5 proxy for all outbound traffic (default $VKM_PROXY)")
+	rootCmd.PersistentFlags().StringVar(&userAgent, "user-agent", "", "User-Agent for outbound requests (default $VKM_USER_AGENT, else a vkm agent)")
+	rootCmd.PersistentFlags().StringVar(&clientID, "client-id", "", "Value of the X-VKM-Client header sent with outbound requests, to identify this installation (default $VKM_CLIENT_ID)")
+	rootCmd.PersistentFlags().StringVar(&tempDir, "temp-dir", "", "Root for per-run temp files (default $VKM_TEMP_DIR, else <os temp dir>/vkm)")
+
 	// Add subcommands
 	rootCmd.AddCommand(cmd.DownloadCmd)
 	rootCmd.AddCommand(cmd.DownloadSimpleCmd)
 	rootCmd.AddCommand(cmd.DownloadPlaylistCmd)
+	rootCmd.AddCommand(cmd.SyncPlaylistCmd)
+	rootCmd.AddCommand(cmd.AuthCmd)
 	rootCmd.AddCommand(cmd.TranscribeCmd)
 	rootCmd.AddCommand(cmd.TranscribeWhisperCmd)
+	rootCmd.AddCommand(cmd.TranscribeDeepgramCmd)
+	rootCmd.AddCommand(cmd.TranscribeAssemblyAICmd)
 	rootCmd.AddCommand(cmd.ProcessCmd)
 	rootCmd.AddCommand(cmd.PipelineCmd)
+	rootCmd.AddCommand(cmd.ReportCmd)
+	rootCmd.AddCommand(cmd.ServeCmd)
+	rootCmd.AddCommand(cmd.JobsCmd)
+	rootCmd.AddCommand(cmd.FailedCmd)
+	rootCmd.AddCommand(cmd.BackendCmd)
+	rootCmd.AddCommand(cmd.TriageCmd)
+	rootCmd.AddCommand(cmd.BackfillCmd)
+	rootCmd.AddCommand(cmd.BundleCmd)
+	rootCmd.AddCommand(cmd.ExportCmd)
+	rootCmd.AddCommand(cmd.EmbedCmd)
+	rootCmd.AddCommand(cmd.GraphCmd)
+	rootCmd.AddCommand(cmd.TagCmd)
+	rootCmd.AddCommand(cmd.EnrichCmd)
+	rootCmd.AddCommand(cmd.CheckSourcesCmd)
+	rootCmd.AddCommand(cmd.DepsCmd)
+	rootCmd.AddCommand(cmd.WatchCmd)
+	rootCmd.AddCommand(cmd.ImportCmd)
+	rootCmd.AddCommand(cmd.GcCmd)
+	rootCmd.AddCommand(cmd.CleanCmd)
+	rootCmd.AddCommand(cmd.IngestURLCmd)
+	rootCmd.AddCommand(cmd.IngestPDFCmd)
+	rootCmd.AddCommand(cmd.IngestArxivCmd)
+	rootCmd.AddCommand(cmd.LicensesCmd)
+	rootCmd.AddCommand(cmd.RunsCmd)
+	rootCmd.AddCommand(cmd.NormalizeCmd)
+	rootCmd.AddCommand(cmd.FactsCmd)
+	rootCmd.AddCommand(cmd.UploadTranscriptsCmd)
+	rootCmd.AddCommand(cmd.ImportTranscriptCmd)
+	rootCmd.AddCommand(cmd.AnnotateCmd)
+	rootCmd.AddCommand(cmd.SelftestCmd)
+	rootCmd.AddCommand(cmd.RecordCmd)
+	rootCmd.AddCommand(cmd.ListCmd)
+	rootCmd.AddCommand(cmd.SpeakersCmd)
+	rootCmd.AddCommand(cmd.CiteCmd)
+	rootCmd.AddCommand(cmd.PatchesCmd)
+	rootCmd.AddCommand(cmd.SnapshotCmd)
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	// Commands receive a context that is canceled on Ctrl-C/SIGTERM so
+	// long-running stages can stop cooperatively
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := rootCmd.ExecuteContext(ctx)
+	cmd.FinishUsage(err)
+	cmd.CleanupTemp()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
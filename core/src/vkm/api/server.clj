@@ -4,7 +4,7 @@
    Exposes endpoints for:
    - Document upload and processing
    - Patch querying
-   - Database statistics
+   - Database statistics and backend configuration
 
    Run with: clj -M:server"
   (:require [ring.adapter.jetty :as jetty]
@@ -16,6 +16,7 @@
             [compojure.route :as route]
             [clojure.tools.logging :as log]
             [clojure.edn :as edn]
+            [clojure.string :as str]
             [cheshire.core :as json]
             [vkm.db :as db]
             [vkm.patch :as patch]
@@ -78,6 +79,24 @@
       (log/error "Failed to get stats:" (.getMessage e))
       (error-response "Failed to retrieve statistics" :status 500))))
 
+(defn info-handler
+  "Describe the backend's configuration: its extraction and embedding
+   models, schema version, patch counts and storage statistics."
+  [_]
+  (try
+    (success-response {:service "vkm-graph-api"
+                       :version "0.1.0"
+                       :extraction {:model semantic/claude-model
+                                    :strategies ["single" "two-pass"]
+                                    :api-key-set (not (str/blank? semantic/*claude-api-key*))}
+                       :embeddings {:model semantic/embedding-model
+                                    :dimensions semantic/embedding-dimensions}
+                       :database (db/db-info)
+                       :counts (db/db-stats)})
+    (catch Exception e
+      (log/error "Failed to describe backend:" (.getMessage e))
+      (error-response "Failed to describe backend" :status 500))))
+
 (defn list-patches-handler
   "List all patches."
   [request]
@@ -107,28 +126,49 @@
 (defn upload-document-handler
   "Process uploaded document and create patches.
 
-   Expects multipart form with 'file' field containing document text."
+   Expects multipart form with 'file' field containing document text.
+   Optional 'timestamp' (ISO-8601) sets the commit time, so clients can
+   order patches by source position or publish date; optional 'metadata'
+   is merged into the patch metadata. Optional 'strategy' selects fact
+   extraction: \"single\" (default) or \"two-pass\", which outlines the
+   document first and extracts facts chunk by chunk with the outline as
+   context; two-pass patches keep the outline in their metadata."
   [request]
   (try
     (let [body (get request :body)
           content (get body "content")
-          filename (get body "filename" "document.txt")]
-
-      (if (empty? content)
+          filename (get body "filename" "document.txt")
+          timestamp (some-> (get body "timestamp") java.time.Instant/parse)
+          metadata (into {} (map (fn [[k v]] [(keyword k) v]))
+                         (get body "metadata" {}))
+          strategy (get body "strategy" "single")]
+
+      (cond
+        (empty? content)
         (error-response "No content provided")
 
+        (not (#{"single" "two-pass"} strategy))
+        (error-response (str "Unknown extraction strategy: " strategy))
+
+        :else
         (do
           (log/info "Processing document:" filename)
 
           ;; Extract facts from content
-          (let [facts (semantic/extract-facts-from-text content)
+          (let [{:keys [facts outline]} (if (= strategy "two-pass")
+                                          (semantic/extract-facts-two-pass content)
+                                          {:facts (semantic/extract-facts-from-text content)})
 
                 ;; Build patch
                 patch (patch/make-patch
                        {:source :document
                         :source-id filename
                         :facts facts
-                        :edges []})
+                        :edges []
+                        :metadata (cond-> metadata
+                                    outline (assoc :extraction-strategy "two-pass"
+                                                   :outline outline))
+                        :timestamp timestamp})
 
                 ;; Store patch
                 patch-id (db/store-patch! patch)]
@@ -143,6 +183,88 @@
       (log/error "Failed to process document:" (.getMessage e))
       (error-response (.getMessage e) :status 500))))
 
+(defn json->patch
+  "Convert a patch exported as JSON with EDN-style keys (as written by the
+   CLI sandbox and vkm bundles) into patch data for db/store-patch!.
+   wrap-json-body has already turned keys like \"claim/text\" into
+   :claim/text; values still need their types restored.
+
+   The patch and its facts get fresh IDs; edges are remapped to them."
+  [body]
+  (let [instant #(some-> % java.time.Instant/parse)
+        fact-ids (into {} (map (fn [f] [(:db/id f) (patch/uuid)]))
+                       (:patch/facts body))
+        ->fact (fn [f]
+                 (cond-> {:db/id (get fact-ids (:db/id f))
+                          :claim/text (:claim/text f)
+                          :claim/confidence (:claim/confidence f)
+                          :claim/valid-from (or (instant (:claim/valid-from f))
+                                                (patch/now))}
+                   (seq (:claim/topic f))
+                   (assoc :claim/topic (keyword (:claim/topic f)))
+
+                   (:claim/extracted-from f)
+                   (assoc :claim/extracted-from (:claim/extracted-from f))
+
+                   (:claim/timestamp-in-video f)
+                   (assoc :claim/timestamp-in-video (:claim/timestamp-in-video f))
+
+                   (seq (:claim/tags f))
+                   (assoc :claim/tags (mapv keyword (:claim/tags f)))))
+        ->edge (fn [e]
+                 {:db/id (patch/uuid)
+                  :edge/from (get fact-ids (:edge/from e))
+                  :edge/to (get fact-ids (:edge/to e))
+                  :edge/relation (keyword (:edge/relation e))
+                  :edge/strength (:edge/strength e)})]
+    (patch/make-patch
+     {:source (keyword (:patch/source body "document"))
+      :source-id (:patch/source-id body)
+      :facts (mapv ->fact (:patch/facts body))
+      :edges (mapv ->edge (:patch/edges body))
+      :metadata (:patch/metadata body {})
+      :timestamp (instant (:patch/timestamp body))})))
+
+(defn import-patch-handler
+  "Store a pre-built patch without re-running fact extraction.
+
+   Body: a patch in the JSON form of the :patch schema, e.g. the patch.json
+   of a vkm bundle."
+  [request]
+  (try
+    (let [body (get request :body)
+          facts (:patch/facts body)]
+      (if (empty? facts)
+        (error-response "Patch has no facts")
+        (let [patch-id (db/store-patch! (json->patch body))]
+          (log/info "Imported patch:" patch-id "with" (count facts) "facts")
+          (success-response {:patch-id patch-id
+                            :facts-count (count facts)
+                            :message "Patch imported successfully"}))))
+    (catch Exception e
+      (log/error "Failed to import patch:" (.getMessage e))
+      (error-response (.getMessage e) :status 500))))
+
+(defn graph-diff-handler
+  "Summarize graph changes between two times.
+
+   Query params: from, to (ISO-8601 instants; to defaults to now)"
+  [request]
+  (try
+    (let [params (:query-params request)
+          instant #(some-> % java.time.Instant/parse java.util.Date/from)
+          from (instant (get params "from"))
+          to (or (instant (get params "to")) (java.util.Date.))]
+      (cond
+        (nil? from) (error-response "Missing from")
+        (.after from to) (error-response "from must not be after to")
+        :else (success-response (db/graph-diff from to))))
+    (catch java.time.format.DateTimeParseException e
+      (error-response (str "Invalid time: " (.getMessage e))))
+    (catch Exception e
+      (log/error "Failed to diff graph:" (.getMessage e))
+      (error-response "Failed to diff graph" :status 500))))
+
 (defn process-transcripts-handler
   "Process transcripts directory and create patches.
 
@@ -204,14 +326,19 @@
   ;; Health check
   (GET "/health" [] health-handler)
 
-  ;; Database stats
+  ;; Database stats and configuration
   (GET "/api/stats" [] stats-handler)
+  (GET "/api/info" [] info-handler)
 
   ;; Patches
   (GET "/api/patches" [] list-patches-handler)
   (GET "/api/patches/:id" [] get-patch-handler)
+  (POST "/api/patches" [] import-patch-handler)
   (POST "/api/patches/query" [] query-patches-handler)
 
+  ;; Graph
+  (GET "/api/graph/diff" [] graph-diff-handler)
+
   ;; Upload & processing
   (POST "/api/upload" [] upload-document-handler)
   (POST "/api/process" [] process-transcripts-handler)
@@ -326,6 +453,9 @@
   ;; Stats
   (http/get "http://localhost:3000/api/stats")
 
+  ;; Configuration
+  (http/get "http://localhost:3000/api/info")
+
   ;; Upload document
   (http/post "http://localhost:3000/api/upload"
              {:body (json/generate-string
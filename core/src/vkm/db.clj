@@ -9,6 +9,8 @@
   (:require [datomic.api :as d]
             [clojure.java.io :as io]
             [clojure.edn :as edn]
+            [clojure.set]
+            [clojure.string :as str]
             [clojure.tools.logging :as log]
             [vkm.patch :as patch]
             [java-time :as jt]))
@@ -19,6 +21,17 @@
 
 (defonce conn (atom nil))
 
+;; The URI and schema the connection was initialized with
+(defonce db-uri (atom nil))
+(defonce schema-version (atom nil))
+
+(defn- short-hash
+  "First 8 hex digits of the SHA-256 of s."
+  [s]
+  (let [digest (.digest (java.security.MessageDigest/getInstance "SHA-256")
+                        (.getBytes ^String s "UTF-8"))]
+    (apply str (map #(format "%02x" %) (take 4 digest)))))
+
 (defn init-db!
   "Initialize database connection and install schema.
 
@@ -34,10 +47,14 @@
 
     ;; Connect
     (reset! conn (d/connect uri))
+    (reset! db-uri uri)
 
     ;; Load and transact schema
-    (let [schema (edn/read-string (slurp schema-path))]
+    (let [schema-text (slurp schema-path)
+          schema (edn/read-string schema-text)]
       (d/transact @conn schema)
+      (reset! schema-version {:version (short-hash schema-text)
+                              :attributes (count (filter :db/ident schema))})
       (log/info "Database initialized and schema installed"))
 
     {:success true
@@ -81,9 +98,18 @@
       (:claim/timestamp-in-video fact)
       (assoc :claim/timestamp-in-video (:claim/timestamp-in-video fact))
 
+      (:claim/chapter fact)
+      (assoc :claim/chapter (:claim/chapter fact))
+
       (:claim/tags fact)
       (assoc :claim/tags (:claim/tags fact))
 
+      (seq (:claim/history fact))
+      (assoc :claim/history (pr-str (:claim/history fact)))
+
+      (seq (:claim/annotations fact))
+      (assoc :claim/annotations (pr-str (:claim/annotations fact)))
+
       (:claim/lod fact)
       (assoc :claim/lod (:claim/lod fact)))))
 
@@ -127,6 +153,10 @@
                   (assoc patch-tx :patch/source-id (:patch/source-id patch))
                   patch-tx)
 
+        patch-tx (if (seq (:patch/annotations patch))
+                  (assoc patch-tx :patch/annotations (pr-str (:patch/annotations patch)))
+                  patch-tx)
+
         ;; Transact patch first to get ID
         patch-result (d/transact @conn [patch-tx])
         patch-id (d/resolve-tempid (:db-after patch-result)
@@ -264,6 +294,50 @@
                     claim-id)]
     (sort-by second results)))
 
+;; ============================================================
+;; Snapshot diffs
+;; ============================================================
+
+(defn- fact-summaries
+  "Pull display fields for fact entities from db."
+  [db ids]
+  (map #(d/pull db '[:db/id :claim/text :claim/topic :claim/confidence
+                     :claim/valid-from {:claim/patch [:patch/source-id]}] %)
+       ids))
+
+(defn- motive-summaries
+  "Pull display fields for motive entities from db."
+  [db ids]
+  (map #(d/pull db '[:db/id :motive/concept-words :motive/confidence
+                     :motive/cluster-size] %)
+       ids))
+
+(defn graph-diff
+  "Summarize what entered and left the graph between two instants.
+
+   Compares the database as of each instant (transaction time), so facts
+   imported today about old videos count as new and retractions show up
+   as removals. Topics and sources are the graph's entities: a topic or
+   source is new when no fact or patch referenced it at from."
+  [^java.util.Date from ^java.util.Date to]
+  (let [db (get-db)
+        before (d/as-of db from)
+        after (d/as-of db to)
+        ids (fn [db attr]
+              (set (d/q '[:find [?e ...] :in $ ?a :where [?e ?a]] db attr)))
+        values (fn [db attr]
+                 (set (d/q '[:find [?v ...] :in $ ?a :where [_ ?a ?v]] db attr)))
+        added (fn [attr f] (clojure.set/difference (f after attr) (f before attr)))
+        removed (fn [attr f] (clojure.set/difference (f before attr) (f after attr)))]
+    {:facts-added (fact-summaries after (added :claim/text ids))
+     :facts-retracted (fact-summaries before (removed :claim/text ids))
+     :motives-added (motive-summaries after (added :motive/concept-words ids))
+     :motives-retracted (motive-summaries before (removed :motive/concept-words ids))
+     :topics-added (sort (added :claim/topic values))
+     :topics-removed (sort (removed :claim/topic values))
+     :sources-added (sort (added :patch/source-id values))
+     :patches-added (count (added :patch/timestamp ids))}))
+
 ;; ============================================================
 ;; Morphism storage
 ;; ============================================================
@@ -409,6 +483,17 @@
      :morphisms num-morphisms
      :motives num-motives}))
 
+(defn db-info
+  "Describe the database: its URI, the installed schema's version (a
+   hash of the schema file) and storage statistics."
+  []
+  (let [db (get-db)]
+    {:uri @db-uri
+     :in-memory (boolean (some-> @db-uri (str/starts-with? "datomic:mem:")))
+     :schema @schema-version
+     :basis-t (d/basis-t db)
+     :datoms (:datoms (d/db-stats db))}))
+
 ;; ============================================================
 ;; Example usage
 ;; ============================================================
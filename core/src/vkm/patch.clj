@@ -27,6 +27,7 @@
 (s/def ::patch/edges (s/coll-of ::edge))
 (s/def ::patch/embeddings (s/coll-of ::embedding))
 (s/def ::patch/metadata map?)
+(s/def ::patch/annotations (s/coll-of map? :kind vector?))
 
 (s/def ::patch
   (s/keys :req [:db/id
@@ -36,12 +37,15 @@
                 :patch/edges]
           :opt [:patch/source-id
                 :patch/embeddings
-                :patch/metadata]))
+                :patch/metadata
+                :patch/annotations]))
 
 (s/def ::claim/text string?)
 (s/def ::claim/topic keyword?)
 (s/def ::claim/confidence ::confidence)
 (s/def ::claim/valid-from ::instant)
+(s/def ::claim/history (s/coll-of map? :kind vector?))
+(s/def ::claim/annotations (s/coll-of map? :kind vector?))
 
 (s/def ::fact
   (s/keys :req [:db/id
@@ -51,8 +55,11 @@
           :opt [:claim/topic
                 :claim/extracted-from
                 :claim/timestamp-in-video
+                :claim/chapter
                 :claim/revises
                 :claim/tags
+                :claim/history
+                :claim/annotations
                 :claim/lod]))
 
 (s/def ::edge/from ::uuid)
@@ -133,11 +140,12 @@
    Optional:
    - source-id: Source identifier
    - embeddings: Vector of embeddings
-   - metadata: Additional metadata map"
-  [{:keys [source facts edges source-id embeddings metadata]
+   - metadata: Additional metadata map
+   - timestamp: Commit instant (defaults to now)"
+  [{:keys [source facts edges source-id embeddings metadata timestamp]
     :or {edges [] embeddings [] metadata {}}}]
   (let [patch {:db/id (uuid)
-               :patch/timestamp (now)
+               :patch/timestamp (or timestamp (now))
                :patch/source source
                :patch/facts facts
                :patch/edges edges
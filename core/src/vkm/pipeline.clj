@@ -12,7 +12,8 @@
             [vkm.semantic :as semantic]
             [vkm.db :as db]
             [clojure.java.io :as io]
-            [clojure.edn :as edn]
+            [clojure.string :as str]
+            [cheshire.core :as json]
             [clojure.tools.logging :as log]
             [aero.core :as aero]
             [java-time :as jt])
@@ -44,11 +45,48 @@
 ;; Transcript processing
 ;; ============================================================
 
+(def sidecar-suffix
+  "Suffix of the AssemblyAI sidecar saved beside a transcript: auto-chapters
+   and detected entities."
+  ".assemblyai.json")
+
+(defn sidecar-file?
+  "Whether path is a transcript's sidecar rather than a transcript."
+  [path]
+  (str/ends-with? path sidecar-suffix))
+
+(defn load-sidecar
+  "Load the AssemblyAI sidecar beside a transcript file, if there is one."
+  [filepath]
+  (let [sidecar (io/file (str (str/replace filepath #"\.[^./\\]+$" "") sidecar-suffix))]
+    (when (.exists sidecar)
+      (json/parse-string (slurp sidecar) true))))
+
 (defn load-transcript
-  "Load a transcript JSON file."
+  "Load a transcript JSON file, with the auto-chapters and entities of its
+   sidecar. Transcripts without chapters of their own take the
+   auto-chapters, titled by their headlines."
   [filepath]
   (when (.exists (io/file filepath))
-    (edn/read-string (slurp filepath))))
+    (let [transcript (json/parse-string (slurp filepath) true)
+          sidecar (load-sidecar filepath)]
+      (cond-> transcript
+        (and (empty? (:chapters transcript)) (seq (:chapters sidecar)))
+        (assoc :chapters (mapv (fn [c] {:title (:headline c)
+                                        :start (:start c)
+                                        :end (:end c)})
+                               (:chapters sidecar)))
+
+        (seq (:entities sidecar))
+        (assoc :entities (:entities sidecar))))))
+
+(defn chapter-at
+  "Title of the transcript chapter spanning time t (seconds), if any."
+  [transcript t]
+  (->> (:chapters transcript)
+       (filter #(<= (:start %) t))
+       last
+       :title))
 
 (defn chunk-transcript
   "Split transcript into manageable chunks for processing.
@@ -82,8 +120,9 @@
 
 (defn extract-facts-from-chunk
   "Extract facts from a single transcript chunk using Claude."
-  [chunk video-id chunk-idx config]
+  [transcript chunk video-id chunk-idx config]
   (let [text (chunk->text chunk)
+        chapter (chapter-at transcript (:timestamp (first chunk) 0))
         extraction-config (get-in config [:ingestion :fact-extraction])
         confidence-threshold (:confidence-threshold extraction-config 0.5)
 
@@ -92,12 +131,13 @@
 
         ;; Add metadata
         facts (map (fn [fact]
-                    (assoc fact
-                           :claim/extracted-from video-id
-                           :claim/timestamp-in-video
-                           (* chunk-idx
-                              (get-in config [:ingestion :fact-extraction :chunk-duration-minutes] 10)
-                              60)))
+                    (cond-> (assoc fact
+                                   :claim/extracted-from video-id
+                                   :claim/timestamp-in-video
+                                   (* chunk-idx
+                                      (get-in config [:ingestion :fact-extraction :chunk-duration-minutes] 10)
+                                      60))
+                      chapter (assoc :claim/chapter chapter)))
                   raw-facts)]
 
     ;; Filter by confidence
@@ -113,7 +153,7 @@
         ;; Process chunks in parallel
         all-facts (pmap-indexed
                    (fn [idx chunk]
-                     (extract-facts-from-chunk chunk video-id idx config))
+                     (extract-facts-from-chunk transcript chunk video-id idx config))
                    chunks)]
 
     (vec (apply concat all-facts))))
@@ -149,14 +189,21 @@
                                 config))
                              transcripts))
 
+        ;; Entities detected across the transcripts, each once
+        entities (->> transcripts
+                      (mapcat :entities)
+                      (map (fn [e] {:type (:type e) :text (:text e)}))
+                      (distinct))
+
         ;; Create patch
         patch (patch/make-patch
                {:source :youtube-channel
                 :source-id source-id
                 :facts (vec all-facts)
                 :edges []  ;; Edges will be inferred
-                :metadata {:num-transcripts (count transcripts)
-                          :processed-at (jt/instant)}})]
+                :metadata (cond-> {:num-transcripts (count transcripts)
+                                   :processed-at (jt/instant)}
+                            (seq entities) (assoc :entities (vec entities)))})]
 
     (log/info "Created patch with" (count all-facts) "facts")
     patch))
@@ -231,7 +278,7 @@
 
   ;; Step 1: Find all transcript files
   (let [transcript-files (vec (.listFiles (io/file transcript-dir)))
-        transcript-paths (map #(.getPath %) transcript-files)
+        transcript-paths (remove sidecar-file? (map #(.getPath %) transcript-files))
 
         ;; Step 2-3: Build patch
         patch (build-patch-from-transcripts source-id transcript-paths config)
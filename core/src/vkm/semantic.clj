@@ -20,6 +20,8 @@
 (def ^:dynamic *openai-api-key* (System/getenv "OPENAI_API_KEY"))
 (def ^:dynamic *claude-api-key* (System/getenv "CLAUDE_API_KEY"))
 
+(def claude-model "claude-sonnet-4-20250514")
+
 (def embedding-model "text-embedding-3-small")
 (def embedding-dimensions 1536)
 
@@ -344,10 +346,14 @@
 (defn extract-facts-from-text
   "Extract structured facts from text using Claude API.
 
+   An optional context (the outline of the whole document, in two-pass
+   extraction) is given to the model to resolve references, but facts
+   are only extracted from text.
+
    Returns a vector of fact maps with enhanced error handling and retry logic."
-  [text & {:keys [api-key model max-retries]
+  [text & {:keys [api-key model max-retries context]
            :or {api-key *claude-api-key*
-                model "claude-sonnet-4-20250514"
+                model claude-model
                 max-retries 3}}]
   (if (or (nil? api-key) (str/blank? api-key))
     (do
@@ -355,7 +361,12 @@
       [])
     (letfn [(attempt [retry-count]
               (try
-                (let [prompt (str "You are a knowledge extraction system for a temporal knowledge graph. "
+                (let [prompt (str (when context
+                                   (str "Outline of the whole document, for context only. "
+                                        "Extract facts from the text to analyze, not from the outline, and use the "
+                                        "outline to resolve references and keep claims self-contained:\n---\n"
+                                        context "\n---\n\n"))
+                                 "You are a knowledge extraction system for a temporal knowledge graph. "
                                  "Extract structured factual claims from the following text.\n\n"
                                  "For each fact, provide:\n"
                                  "- text: A clear, atomic claim (one fact per entry)\n"
@@ -438,6 +449,91 @@
                   [])))]
       (attempt 0))))
 
+;; ============================================================
+;; Two-pass extraction: outline, then facts per chunk
+;; ============================================================
+
+(def two-pass-chunk-chars
+  "Target size of the chunks facts are extracted from in the second pass."
+  12000)
+
+(defn outline-text
+  "Ask Claude for an outline of text: its sections, the main claims in
+   each and the people, systems and terms they refer to. Returns nil when
+   the outline could not be produced."
+  [text & {:keys [api-key model]
+           :or {api-key *claude-api-key*
+                model claude-model}}]
+  (when-not (str/blank? api-key)
+    (try
+      (let [prompt (str "You are preparing a long transcript for fact extraction. "
+                        "Write an outline of the following text: its sections in order, and under each "
+                        "the main claims made and the people, systems and terms they refer to, with any "
+                        "abbreviations or pronouns resolved to full names.\n\n"
+                        "Text:\n---\n" text "\n---\n\n"
+                        "Respond ONLY with the outline as a plain indented list, nothing else.")
+            response (http/post "https://api.anthropic.com/v1/messages"
+                                {:headers {"x-api-key" api-key
+                                           "anthropic-version" "2023-06-01"
+                                           "Content-Type" "application/json"}
+                                 :body (json/generate-string
+                                        {:model model
+                                         :max_tokens 4096
+                                         :temperature 0.0
+                                         :messages [{:role "user"
+                                                     :content prompt}]})
+                                 :as :json
+                                 :socket-timeout 120000
+                                 :connection-timeout 10000})]
+        (some-> (get-in response [:body :content 0 :text]) str/trim not-empty))
+      (catch Exception e
+        (log/error "Failed to outline text:" (.getMessage e))
+        nil))))
+
+(defn split-into-chunks
+  "Split text into chunks of about size characters, breaking between
+   sentences where possible."
+  [text size]
+  (let [sentences (re-seq #"(?s).+?(?:[.!?][\"')\]]*\s+|$)" text)]
+    (->> sentences
+         (reduce (fn [chunks sentence]
+                   (let [current (peek chunks)]
+                     (if (and current
+                              (pos? (count current))
+                              (> (+ (count current) (count sentence)) size))
+                       (conj chunks sentence)
+                       (conj (if current (pop chunks) chunks)
+                             (str current sentence)))))
+                 [])
+         (map str/trim)
+         (remove str/blank?)
+         vec)))
+
+(defn extract-facts-two-pass
+  "Extract facts in two passes: outline the whole text, then extract facts
+   chunk by chunk with the outline as context, which keeps claims in long
+   talks coherent. Facts repeated across chunks are kept once. Falls back
+   to single-pass extraction when no outline can be produced.
+
+   Returns {:facts [...] :outline \"...\"}."
+  [text & {:keys [chunk-chars]
+           :or {chunk-chars two-pass-chunk-chars}}]
+  (if-let [outline (outline-text text)]
+    (let [chunks (split-into-chunks text chunk-chars)
+          facts (->> chunks
+                     (mapcat #(extract-facts-from-text % :context outline))
+                     (reduce (fn [[seen kept] fact]
+                               (let [k (-> (:claim/text fact) str str/lower-case
+                                           (str/replace #"\s+" " ") str/trim)]
+                                 (if (seen k)
+                                   [seen kept]
+                                   [(conj seen k) (conj kept fact)])))
+                             [#{} []])
+                     second)]
+      (log/info "Two-pass extraction:" (count chunks) "chunks," (count facts) "facts")
+      {:facts facts :outline outline})
+    {:facts (extract-facts-from-text text)}))
+
 ;; ============================================================
 ;; Enhanced AI: Contradiction Detection
 ;; ============================================================
@@ -488,7 +584,7 @@
                                                     "anthropic-version" "2023-06-01"
                                                     "Content-Type" "application/json"}
                                            :body (json/generate-string
-                                                 {:model "claude-sonnet-4-20250514"
+                                                 {:model claude-model
                                                   :max_tokens 500
                                                   :temperature 0.0
                                                   :messages [{:role "user"
@@ -559,7 +655,7 @@
                                                "anthropic-version" "2023-06-01"
                                                "Content-Type" "application/json"}
                                       :body (json/generate-string
-                                            {:model "claude-sonnet-4-20250514"
+                                            {:model claude-model
                                              :max_tokens 2000
                                              :temperature 0.0
                                              :messages [{:role "user"
@@ -705,7 +801,7 @@
                                          "anthropic-version" "2023-06-01"
                                          "Content-Type" "application/json"}
                                 :body (json/generate-string
-                                      {:model "claude-sonnet-4-20250514"
+                                      {:model claude-model
                                        :max_tokens 4096
                                        :temperature 0.0
                                        :messages [{:role "user"
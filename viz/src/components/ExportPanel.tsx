@@ -158,6 +158,10 @@ ${svgString}`;
       lines.push('');
       lines.push(`**Source:** ${JSON.stringify(patch['patch/source'])}`);
       lines.push('');
+      (patch['patch/annotations'] ?? []).forEach((note) => {
+        lines.push(`> ${note['annotation/note']} (${note['annotation/by']})`);
+        lines.push('');
+      });
       lines.push('### Facts');
       lines.push('');
 
@@ -166,6 +170,9 @@ ${svgString}`;
         lines.push(
           `${factIndex + 1}. **${fact['claim/text']}** (${confidence}% confidence, topic: ${fact['claim/topic']})`
         );
+        (fact['claim/annotations'] ?? []).forEach((note) => {
+          lines.push(`   - _Note:_ ${note['annotation/note']} (${note['annotation/by']})`);
+        });
       });
 
       lines.push('');
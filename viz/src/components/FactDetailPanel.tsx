@@ -106,6 +106,21 @@ export const FactDetailPanel: React.FC<FactDetailPanelProps> = ({
           </div>
         )}
 
+        {fact['claim/annotations'] && fact['claim/annotations'].length > 0 && (
+          <div className="fact-detail-section">
+            <label className="fact-detail-label">Curator Notes</label>
+            {fact['claim/annotations'].map((note, index) => (
+              <p key={index} className="metadata-value">
+                {note['annotation/note']}
+                <br />
+                <small>
+                  {note['annotation/by']}, {new Date(note['annotation/at']).toLocaleString()}
+                </small>
+              </p>
+            ))}
+          </div>
+        )}
+
         {/* Actions */}
         <div className="fact-detail-actions">
           <button
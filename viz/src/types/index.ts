@@ -19,6 +19,14 @@ export interface Fact {
   'claim/revises'?: string;
   'claim/tags'?: string[];
   'claim/lod'?: number; // 0-3
+  'claim/annotations'?: Annotation[];
+}
+
+/** A curator's note on a patch or fact (vkm annotate) */
+export interface Annotation {
+  'annotation/note': string;
+  'annotation/by': string;
+  'annotation/at': string; // ISO timestamp
 }
 
 export interface Edge {
@@ -55,6 +63,7 @@ export interface Patch {
   'patch/edges': Edge[];
   'patch/embeddings'?: Embedding[];
   'patch/metadata'?: Record<string, unknown>;
+  'patch/annotations'?: Annotation[];
 }
 
 export type PatchSource =